@@ -0,0 +1,318 @@
+// the command line interface of abstrastore, which operates on the bucket that the MINIO_ environment variables configure, see
+// minio.Setup, which are also read from a .env file in the working directory, if there is one.
+//
+//	abstrastore shell [-timeout <duration>] [-output table|json|ndjson]
+//	abstrastore exec [-timeout <duration>] [-output table|json|ndjson] <statement>...
+//	abstrastore export-bundle [-encryption-key <file>] [-signing-key <file>] <database>.<table>
+//	abstrastore verify-bundle [-decryption-key <file>] [-public-key <file>] [<bundle>]
+//
+// see the USAGE for the exit codes, on which scripts can rely.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/term"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/shell"
+)
+
+const USAGE = `usage: abstrastore <command> [flags]
+
+commands:
+  shell    an interactive prompt, with which tables are queried and written, see HELP within it. statements which are piped
+           into it are executed until the first one fails
+  exec     executes the statements that are its arguments, in order, until the first one fails
+  export-bundle
+           writes the objects of the table to stdout as a bundle, which is encrypted and signed if the keys are given
+  verify-bundle
+           reads a bundle from the file, or else from stdin, and checks that it is complete, unchanged, and signed by the
+           public key, if one is given, without connecting to the store
+
+flags of shell and exec:
+  -timeout <duration>               of the transactions that are begun, 1m by default
+  -output table|json|ndjson         of the results, table by default. json writes an object with the kind of statement and
+                                    its rows per statement, and ndjson writes each row on a line of its own
+
+flags of export-bundle and verify-bundle, whose files contain hex encoded keys:
+  -encryption-key, -decryption-key  the 32 byte key, with which the objects are encrypted
+  -signing-key                      the ed25519 private key, or its 32 byte seed, with which the bundle is signed
+  -public-key                       the ed25519 public key, whose signature the bundle must have
+
+exit codes:
+  0  every statement succeeded, or the bundle is valid
+  1  a statement failed, or the store cannot be used, which is written to stderr
+  2  the command or its flags are not valid
+  3  the bundle is not valid, i.e. it cannot be decrypted, was changed or cut short, or is not signed by the public key
+`
+
+const (
+	EXIT_OK             = 0
+	EXIT_FAILED         = 1
+	EXIT_USAGE          = 2
+	EXIT_INVALID_BUNDLE = 3
+)
+
+type callback struct{}
+
+func (c *callback) ErrorDuringGc(err error) {
+	fmt.Fprintf(os.Stderr, "error during garbage collection: %s\n", err)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, USAGE)
+		os.Exit(EXIT_USAGE)
+	}
+	var err error
+	switch os.Args[1] {
+	case "shell":
+		err = runShell(os.Args[2:])
+	case "exec":
+		err = runExec(os.Args[2:])
+	case "export-bundle":
+		err = runExportBundle(os.Args[2:])
+	case "verify-bundle":
+		err = runVerifyBundle(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(USAGE)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n\n%s", os.Args[1], USAGE)
+		os.Exit(EXIT_USAGE)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		if errors.Is(err, minio.InvalidBundleError) {
+			os.Exit(EXIT_INVALID_BUNDLE)
+		}
+		os.Exit(EXIT_FAILED)
+	}
+	os.Exit(EXIT_OK)
+}
+
+func connect() *minio.MinioRepository {
+	// the environment takes precedence over the file, which is optional
+	_ = godotenv.Load()
+	defer func() {
+		// Setup panics if the store cannot be used, which would otherwise exit with the code of a usage error
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", r)
+			os.Exit(EXIT_FAILED)
+		}
+	}()
+	minio.Setup(&callback{})
+	return minio.GetRepository()
+}
+
+// parses the flags that all commands have, exiting with EXIT_USAGE if they are not valid, and returns the remaining arguments
+func parseFlags(command string, args []string) (time.Duration, string, []string) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	timeout := flags.Duration("timeout", time.Minute, "the timeout of the transactions that are begun")
+	output := flags.String("output", shell.OUTPUT_TABLE, "the format of the results, i.e. "+strings.Join(shell.OUTPUTS, ", "))
+	if err := flags.Parse(args); err != nil {
+		os.Exit(EXIT_USAGE)
+	}
+	if !slices.Contains(shell.OUTPUTS, *output) {
+		fmt.Fprintf(os.Stderr, "unknown output %s, rather than one of %s\n", *output, strings.Join(shell.OUTPUTS, ", "))
+		os.Exit(EXIT_USAGE)
+	}
+	return *timeout, *output, flags.Args()
+}
+
+func newShell(out io.Writer, timeout time.Duration, output string) *shell.Shell {
+	sh := shell.NewShell(connect(), out, timeout)
+	_ = sh.SetOutput(output) // validated by parseFlags
+	return sh
+}
+
+func runExec(args []string) error {
+	timeout, output, statements := parseFlags("exec", args)
+	if len(statements) == 0 {
+		fmt.Fprint(os.Stderr, "exec expects at least one statement\n\n"+USAGE)
+		os.Exit(EXIT_USAGE)
+	}
+	return newShell(os.Stdout, timeout, output).Run(context.Background(), strings.NewReader(strings.Join(statements, "\n")))
+}
+
+func runShell(args []string) error {
+	timeout, output, _ := parseFlags("shell", args)
+
+	ctx := context.Background()
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		// e.g. a script piped into the shell
+		return newShell(os.Stdout, timeout, output).Run(ctx, os.Stdin)
+	}
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	sh := newShell(terminal, timeout, output)
+	if err := sh.Refresh(ctx); err != nil {
+		fmt.Fprintf(terminal, "error: the tables cannot be completed, since the registry cannot be read: %s\n", err)
+	}
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return complete(terminal, sh, line, pos)
+	}
+	fmt.Fprintln(terminal, "type HELP for the statements, and EXIT or ctrl-D to leave")
+	defer sh.Execute(ctx, "ROLLBACK")
+	for {
+		terminal.SetPrompt(sh.Prompt())
+		line, err := terminal.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := sh.Execute(ctx, line); errors.Is(err, shell.ErrExit) {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(terminal, "error: %s\n", err)
+		}
+	}
+}
+
+// parses the flags of a bundle command, exiting with EXIT_USAGE if they are not valid, and returns the hex encoded keys read
+// from the files of the flags, by name, and the remaining arguments
+func parseBundleFlags(command string, args []string, keys ...string) (map[string][]byte, []string) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	files := make(map[string]*string, len(keys))
+	for _, key := range keys {
+		files[key] = flags.String(key, "", "the file containing the hex encoded key")
+	}
+	if err := flags.Parse(args); err != nil {
+		os.Exit(EXIT_USAGE)
+	}
+	read := make(map[string][]byte, len(keys))
+	for key, file := range files {
+		if *file == "" {
+			continue
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "the %s cannot be read: %s\n", key, err)
+			os.Exit(EXIT_USAGE)
+		}
+		if read[key], err = hex.DecodeString(string(bytes.TrimSpace(data))); err != nil {
+			fmt.Fprintf(os.Stderr, "the %s in %s is not hex encoded: %s\n", key, *file, err)
+			os.Exit(EXIT_USAGE)
+		}
+	}
+	return read, flags.Args()
+}
+
+func runExportBundle(args []string) error {
+	keys, rest := parseBundleFlags("export-bundle", args, "encryption-key", "signing-key")
+	if len(rest) != 1 || !strings.Contains(rest[0], ".") {
+		fmt.Fprint(os.Stderr, "export-bundle expects a table, e.g. <database>.<table>\n\n"+USAGE)
+		os.Exit(EXIT_USAGE)
+	}
+	database, name, _ := strings.Cut(rest[0], ".")
+	options := minio.BundleOptions{EncryptionKey: keys["encryption-key"]}
+	switch signingKey := keys["signing-key"]; len(signingKey) {
+	case 0:
+	case ed25519.SeedSize:
+		options.SigningKey = ed25519.NewKeyFromSeed(signingKey)
+	case ed25519.PrivateKeySize:
+		options.SigningKey = ed25519.PrivateKey(signingKey)
+	default:
+		fmt.Fprintf(os.Stderr, "the signing key must have %d or %d bytes, not %d\n", ed25519.SeedSize, ed25519.PrivateKeySize, len(signingKey))
+		os.Exit(EXIT_USAGE)
+	}
+
+	ctx := context.Background()
+	repo := connect()
+	table, err := repo.LoadTable(ctx, schema.Database(database), name)
+	if err != nil {
+		return err
+	}
+	count, err := minio.ExportBundle(ctx, repo, table, os.Stdout, options)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d objects of %s.%s\n", count, database, name)
+	return nil
+}
+
+func runVerifyBundle(args []string) error {
+	keys, rest := parseBundleFlags("verify-bundle", args, "decryption-key", "public-key")
+	if len(rest) > 1 {
+		fmt.Fprint(os.Stderr, "verify-bundle expects at most one bundle\n\n"+USAGE)
+		os.Exit(EXIT_USAGE)
+	}
+	options := minio.BundleVerifyOptions{DecryptionKey: keys["decryption-key"]}
+	if publicKey := keys["public-key"]; publicKey != nil {
+		if len(publicKey) != ed25519.PublicKeySize {
+			fmt.Fprintf(os.Stderr, "the public key must have %d bytes, not %d\n", ed25519.PublicKeySize, len(publicKey))
+			os.Exit(EXIT_USAGE)
+		}
+		options.PublicKey = ed25519.PublicKey(publicKey)
+	}
+	in := io.Reader(os.Stdin)
+	if len(rest) == 1 {
+		file, err := os.Open(rest[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	count := 0
+	header, err := minio.VerifyBundle(in, options, func(json.RawMessage) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("the bundle of %s.%s with %d objects is valid, encrypted: %t, signed: %t\n", header.Database, header.Table, count, header.Encrypted, header.Signed)
+	return nil
+}
+
+// completes the word before the cursor with the longest prefix of its candidates, and lists them if there are several
+func complete(terminal *term.Terminal, sh *shell.Shell, line string, pos int) (string, int, bool) {
+	candidates := sh.Complete(line[:pos])
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	start := strings.LastIndexAny(line[:pos], " \t") + 1
+	completion := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(completion)) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		completion += " "
+	} else if len(completion) <= pos-start {
+		// nothing more to complete, so show what the word can be
+		fmt.Fprintln(terminal, strings.Join(candidates, "  "))
+		return "", 0, false
+	}
+	return line[:start] + completion + line[pos:], start + len(completion), true
+}
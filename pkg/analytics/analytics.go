@@ -0,0 +1,160 @@
+// converts the record batches of minio.ScanTable into Apache Arrow record batches, so that tables can be queried in process by
+// engines which read Arrow, e.g. DuckDB, without an export step. this is a module of its own, so that the store does not depend on
+// Arrow. with DuckDB, the reader of a table is registered as a view, e.g. with go-duckdb:
+//
+//	reader, err := analytics.ScanTable(ctx, repo, &tx, table, columns, 0, memory.DefaultAllocator)
+//	...
+//	defer reader.Release()
+//	duck, err := duckdb.NewArrowFromConn(conn)
+//	...
+//	release, err := duck.RegisterView(reader, "issues")
+//	...
+//	defer release()
+//	rows, err := db.QueryContext(ctx, "SELECT status, count(*) FROM issues GROUP BY status")
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync/atomic"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// the name of the first column of the Arrow record batches, which holds the id of each row
+const ID_COLUMN = "_id"
+
+// returns the Arrow schema of record batches with the given columns, whose first column is the id of each row. strings and JSON
+// are utf8, numbers are float64, and times are timestamps in microseconds in UTC.
+func Schema(columns []minio.Column) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, 0, len(columns)+1)
+	fields = append(fields, arrow.Field{Name: ID_COLUMN, Type: arrow.BinaryTypes.String})
+	for _, column := range columns {
+		var dataType arrow.DataType
+		switch column.Type {
+		case minio.COLUMN_STRING, minio.COLUMN_JSON:
+			dataType = arrow.BinaryTypes.String
+		case minio.COLUMN_NUMBER:
+			dataType = arrow.PrimitiveTypes.Float64
+		case minio.COLUMN_BOOLEAN:
+			dataType = arrow.FixedWidthTypes.Boolean
+		case minio.COLUMN_TIME:
+			dataType = arrow.FixedWidthTypes.Timestamp_us
+		default:
+			return nil, fmt.Errorf("ADB-0355 column %s has the unknown type %s", column.Name, column.Type)
+		}
+		fields = append(fields, arrow.Field{Name: column.Name, Type: dataType, Nullable: true})
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// converts a record batch into an Arrow record batch of the schema, which must be that of its columns, see Schema. the caller
+// releases it.
+func NewRecordBatch(mem memory.Allocator, schema *arrow.Schema, batch *minio.RecordBatch) arrow.RecordBatch {
+	builder := array.NewRecordBuilder(mem, schema)
+	defer builder.Release()
+	builder.Reserve(batch.Rows)
+	builder.Field(0).(*array.StringBuilder).AppendValues(batch.Ids, nil)
+	for i, column := range batch.Columns {
+		values := batch.Values[i]
+		switch column.Type {
+		case minio.COLUMN_NUMBER:
+			builder.Field(i+1).(*array.Float64Builder).AppendValues(values.Numbers, values.Valid)
+		case minio.COLUMN_BOOLEAN:
+			builder.Field(i+1).(*array.BooleanBuilder).AppendValues(values.Booleans, values.Valid)
+		case minio.COLUMN_TIME:
+			timestamps := make([]arrow.Timestamp, len(values.Times))
+			for j, t := range values.Times {
+				timestamps[j] = arrow.Timestamp(t.UnixMicro())
+			}
+			builder.Field(i+1).(*array.TimestampBuilder).AppendValues(timestamps, values.Valid)
+		default:
+			builder.Field(i+1).(*array.StringBuilder).AppendValues(values.Strings, values.Valid)
+		}
+	}
+	return builder.NewRecordBatch()
+}
+
+// returns a reader of the objects of the table which exist within the transaction, as Arrow record batches with the given
+// columns, which are read as the reader is advanced. see minio.ScanTable, e.g. for why a read only transaction should be used,
+// and minio.InferredColumns, for the columns of a table whose schema is inferred. the caller releases the reader, which stops the
+// scan if it has not ended.
+func ScanTable(ctx context.Context, repo *minio.MinioRepository, tx *schema.Transaction, table schema.Table, columns []minio.Column, size int, mem memory.Allocator) (array.RecordReader, error) {
+	arrowSchema, err := Schema(columns)
+	if err != nil {
+		return nil, err
+	}
+	next, stop := iter.Pull2(minio.ScanTable(ctx, repo, tx, table, columns, size))
+	reader := &recordReader{schema: arrowSchema, mem: mem, next: next, stop: stop}
+	reader.refCount.Add(1)
+	return reader, nil
+}
+
+// an array.RecordReader over the record batches of a scan
+type recordReader struct {
+	refCount atomic.Int64
+	schema   *arrow.Schema
+	mem      memory.Allocator
+	next     func() (*minio.RecordBatch, error, bool)
+	stop     func()
+	current  arrow.RecordBatch
+	err      error
+}
+
+func (r *recordReader) Retain() {
+	r.refCount.Add(1)
+}
+
+func (r *recordReader) Release() {
+	if r.refCount.Add(-1) == 0 {
+		r.releaseCurrent()
+		r.stop()
+	}
+}
+
+func (r *recordReader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+func (r *recordReader) Next() bool {
+	r.releaseCurrent()
+	if r.err != nil {
+		return false
+	}
+	batch, err, ok := r.next()
+	if !ok {
+		return false
+	}
+	if err != nil {
+		r.err = err
+		return false
+	}
+	r.current = NewRecordBatch(r.mem, r.schema, batch)
+	return true
+}
+
+func (r *recordReader) RecordBatch() arrow.RecordBatch {
+	return r.current
+}
+
+// Deprecated: Use RecordBatch instead.
+func (r *recordReader) Record() arrow.Record {
+	return r.current
+}
+
+// the error which ended the scan, if any
+func (r *recordReader) Err() error {
+	return r.err
+}
+
+func (r *recordReader) releaseCurrent() {
+	if r.current != nil {
+		r.current.Release()
+		r.current = nil
+	}
+}
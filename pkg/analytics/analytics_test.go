@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema_RejectsColumnsOfUnknownTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Schema([]minio.Column{{Name: "Title", Type: "text"}})
+	assert.ErrorContains(err, "ADB-0355")
+}
+
+func TestNewRecordBatch_ConvertsEachColumnWithItsNulls(t *testing.T) {
+	assert := assert.New(t)
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	columns := []minio.Column{
+		{Name: "Title", Type: minio.COLUMN_STRING},
+		{Name: "Votes", Type: minio.COLUMN_NUMBER},
+		{Name: "Open", Type: minio.COLUMN_BOOLEAN},
+		{Name: "Created", Type: minio.COLUMN_TIME},
+		{Name: "Labels", Type: minio.COLUMN_JSON},
+	}
+	created := time.Date(2025, 1, 2, 3, 4, 5, 6000, time.UTC)
+	batch := &minio.RecordBatch{
+		Columns: columns,
+		Values: []minio.ColumnValues{
+			{Strings: []string{"a", ""}, Valid: []bool{true, false}},
+			{Numbers: []float64{1.5, 0}, Valid: []bool{true, false}},
+			{Booleans: []bool{true, false}, Valid: []bool{true, true}},
+			{Times: []time.Time{created, {}}, Valid: []bool{true, false}},
+			{Strings: []string{`["bug"]`, ""}, Valid: []bool{true, false}},
+		},
+		Ids:  []string{"1", "2"},
+		Rows: 2,
+	}
+
+	arrowSchema, err := Schema(columns)
+	assert.NoError(err)
+	record := NewRecordBatch(mem, arrowSchema, batch)
+	defer record.Release()
+
+	assert.Equal(int64(2), record.NumRows())
+	assert.Equal(ID_COLUMN, record.ColumnName(0))
+	assert.Equal([]string{"1", "2"}, []string{record.Column(0).(*array.String).Value(0), record.Column(0).(*array.String).Value(1)})
+	assert.Equal("a", record.Column(1).(*array.String).Value(0))
+	assert.True(record.Column(1).IsNull(1))
+	assert.Equal(1.5, record.Column(2).(*array.Float64).Value(0))
+	assert.True(record.Column(2).IsNull(1))
+	assert.False(record.Column(3).(*array.Boolean).Value(1))
+	assert.False(record.Column(3).IsNull(1))
+	assert.Equal(arrow.Timestamp(created.UnixMicro()), record.Column(4).(*array.Timestamp).Value(0))
+	assert.True(record.Column(4).IsNull(1))
+	assert.Equal(`["bug"]`, record.Column(5).(*array.String).Value(0))
+	assert.True(record.Column(5).IsNull(1))
+}
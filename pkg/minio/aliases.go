@@ -0,0 +1,70 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// points the logical table name at the given physical one. since the pointer is a single object, the switch is atomic,
+// e.g. for a blue/green data migration, or when the physical prefix differs per environment.
+func (r *MinioRepository) SetTableAlias(ctx context.Context, database schema.Database, logicalName string, physicalName string) error {
+	alias := schema.TableAlias{
+		Database: string(database),
+		LogicalName: logicalName,
+		PhysicalName: physicalName,
+	}
+	data, err := json.Marshal(alias)
+	if err != nil {
+		return err
+	}
+	path := schema.AliasPath(database, logicalName)
+	_, err = r.Client.PutObject(ctx, r.BucketName, path, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("ADB-0049 failed to put table alias %s: %w", path, err)
+	}
+	return nil
+}
+
+// removes the alias, so that the logical name is used as the physical name again
+func (r *MinioRepository) RemoveTableAlias(ctx context.Context, database schema.Database, logicalName string) error {
+	path := schema.AliasPath(database, logicalName)
+	err := r.Client.RemoveObject(ctx, r.BucketName, path, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("ADB-0050 failed to remove table alias %s: %w", path, err)
+	}
+	return nil
+}
+
+// returns the table that the logical one is an alias of, or the logical table itself if it has no alias.
+// the code can refer to logical names, and resolve them before use, e.g. once per request.
+func (r *MinioRepository) ResolveTable(ctx context.Context, logical schema.Table) (schema.Table, error) {
+	path := schema.AliasPath(logical.Database, logical.Name)
+	_, exists, err := r.statObject(ctx, path)
+	if err != nil {
+		return logical, err
+	}
+	if !exists {
+		return logical, nil
+	}
+
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return logical, fmt.Errorf("ADB-0051 failed to get table alias %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return logical, fmt.Errorf("ADB-0051 failed to get table alias %s: %w", path, err)
+	}
+	var alias schema.TableAlias
+	if err := json.Unmarshal(b, &alias); err != nil {
+		return logical, err
+	}
+	return logical.WithName(alias.PhysicalName), nil
+}
@@ -0,0 +1,188 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"slices"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the types of the columns of record batches, which are held as Go slices of string, float64, bool and time.Time
+const (
+	COLUMN_STRING  = "string"
+	COLUMN_NUMBER  = "number"
+	COLUMN_BOOLEAN = "boolean"
+	// RFC 3339 strings
+	COLUMN_TIME = "time"
+	// any value, e.g. an object or array, as JSON text, which analytics engines can query with their JSON functions
+	COLUMN_JSON = "json"
+)
+
+// the number of rows of the record batches that ScanTable returns, unless a size is given
+const DEFAULT_RECORD_BATCH_SIZE = 1024
+
+// a column of the record batches of a table
+type Column struct {
+	// the key in the JSON objects
+	Name string
+	// one of the column types, e.g. COLUMN_STRING
+	Type string
+}
+
+// the values of a column of a record batch, of which only the slice of its type is set
+type ColumnValues struct {
+	Strings  []string
+	Numbers  []float64
+	Booleans []bool
+	Times    []time.Time
+	// false where the value is null or missing
+	Valid []bool
+}
+
+// the rows of a table in columnar form, as plain Go slices. this package does not depend on Apache Arrow or DuckDB. the module
+// pkg/analytics converts batches into Arrow record batches, which DuckDB can query as a view.
+type RecordBatch struct {
+	Columns []Column
+	// in the order of the columns
+	Values []ColumnValues
+	// the id of each row
+	Ids  []string
+	Rows int
+}
+
+// returns the columns of a table found by InferSchema, i.e. one per field, typed if it only has values of one type, and JSON
+// otherwise. fields whose values are times, according to the index suggested for them, are time columns.
+func InferredColumns(table InferredTable) []Column {
+	columns := make([]Column, 0, len(table.Fields))
+	for _, field := range table.Fields {
+		types := slices.DeleteFunc(slices.Clone(field.Types), func(t string) bool { return t == "null" })
+		column := Column{Name: field.Key, Type: COLUMN_JSON}
+		if len(types) == 1 {
+			switch types[0] {
+			case "string":
+				column.Type = COLUMN_STRING
+				if slices.ContainsFunc(table.Suggestions, func(suggestion IndexSuggestion) bool {
+					return suggestion.Index.Field == field.Field && suggestion.Index.Time
+				}) {
+					column.Type = COLUMN_TIME
+				}
+			case "number":
+				column.Type = COLUMN_NUMBER
+			case "boolean":
+				column.Type = COLUMN_BOOLEAN
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// iterates over the objects of the table which exist within the transaction, as record batches with the given columns, so that
+// they can be analysed in process without exporting them to files first. use a read only transaction, so that all batches come
+// from the same consistent snapshot, whose cache is bypassed, see schema.Transaction.BypassCache, so that memory does not grow
+// with the size of the table. size is the number of rows per batch, or zero for DEFAULT_RECORD_BATCH_SIZE. values which do not
+// have the type of their column are an error, except in JSON columns.
+func ScanTable(ctx context.Context, repo *MinioRepository, tx *schema.Transaction, table schema.Table, columns []Column, size int) iter.Seq2[*RecordBatch, error] {
+	if size <= 0 {
+		size = DEFAULT_RECORD_BATCH_SIZE
+	}
+	return func(yield func(*RecordBatch, error) bool) {
+		// including the time that the batches are processed for, since they are read as they are consumed
+		defer repo.recordDuration(ctx, METRIC_SCAN_DURATION, schema.Now(), map[string]string{"database": string(table.Database), "table": table.Name})
+		batch := newRecordBatch(columns, size)
+		for result, err := range ExportTable[map[string]json.RawMessage](ctx, repo, tx, table) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			id, _ := table.IdFromPath(result.Path)
+			if err := batch.append(id, *result.Object); err != nil {
+				yield(nil, err)
+				return
+			}
+			if batch.Rows == size {
+				if !yield(batch, nil) {
+					return
+				}
+				batch = newRecordBatch(columns, size)
+			}
+		}
+		if batch.Rows > 0 {
+			yield(batch, nil)
+		}
+	}
+}
+
+func newRecordBatch(columns []Column, size int) *RecordBatch {
+	batch := &RecordBatch{Columns: columns, Values: make([]ColumnValues, len(columns)), Ids: make([]string, 0, size)}
+	for i, column := range columns {
+		values := ColumnValues{Valid: make([]bool, 0, size)}
+		switch column.Type {
+		case COLUMN_NUMBER:
+			values.Numbers = make([]float64, 0, size)
+		case COLUMN_BOOLEAN:
+			values.Booleans = make([]bool, 0, size)
+		case COLUMN_TIME:
+			values.Times = make([]time.Time, 0, size)
+		default:
+			values.Strings = make([]string, 0, size)
+		}
+		batch.Values[i] = values
+	}
+	return batch
+}
+
+// appends a row, with the zero value of its column where the object has no value
+func (b *RecordBatch) append(id string, object map[string]json.RawMessage) error {
+	for i, column := range b.Columns {
+		values := &b.Values[i]
+		raw, ok := object[column.Name]
+		valid := ok && string(raw) != "null"
+		var err error
+		switch column.Type {
+		case COLUMN_NUMBER:
+			var number float64
+			if valid {
+				err = json.Unmarshal(raw, &number)
+			}
+			values.Numbers = append(values.Numbers, number)
+		case COLUMN_BOOLEAN:
+			var boolean bool
+			if valid {
+				err = json.Unmarshal(raw, &boolean)
+			}
+			values.Booleans = append(values.Booleans, boolean)
+		case COLUMN_TIME:
+			var t time.Time
+			if valid {
+				err = json.Unmarshal(raw, &t)
+			}
+			values.Times = append(values.Times, t)
+		case COLUMN_STRING:
+			var s string
+			if valid {
+				err = json.Unmarshal(raw, &s)
+			}
+			values.Strings = append(values.Strings, s)
+		case COLUMN_JSON:
+			s := ""
+			if valid {
+				s = string(raw)
+			}
+			values.Strings = append(values.Strings, s)
+		default:
+			return fmt.Errorf("ADB-0135 column %s has the unknown type %s", column.Name, column.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("ADB-0135 the value of column %s of object %s is not of type %s: %w", column.Name, id, column.Type, err)
+		}
+		values.Valid = append(values.Valid, valid)
+	}
+	b.Ids = append(b.Ids, id)
+	b.Rows++
+	return nil
+}
@@ -0,0 +1,88 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// instead of only deleting committed transactions, keep a copy of them in the archive for the given retention period,
+// which gives an auditable history of what each transaction changed (paths, final ETags and version ids).
+// archived transactions are removed by the garbage collector once the retention period is over.
+func (r *MinioRepository) EnableTransactionArchive(retention time.Duration) {
+	r.archiveRetention.Store(int64(retention))
+}
+
+func (r *MinioRepository) DisableTransactionArchive() {
+	r.archiveRetention.Store(0)
+}
+
+func (r *MinioRepository) archiveTransaction(ctx context.Context, tx *schema.Transaction, retention time.Duration) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	_, err = r.Client.PutObject(ctx, r.BucketName, tx.GetArchivePath(), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("ADB-0042 Failed to archive tx %s at path %s, %w", tx.Id, tx.GetArchivePath(), err)
+	}
+
+	// mark it to be cleared up once the retention period is over
+	until := fmt.Sprintf("%d", schema.Now().Add(retention).UnixMicro())
+	contents := []byte(tx.GetArchivePath())
+	gcPath := GC_ROOT + until
+	_, err = r.Client.PutObject(ctx, r.BucketName, gcPath, bytes.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("ADB-0043 Failed to put gc entry at path %s for archived tx %s, %w", gcPath, tx.Id, err)
+	}
+	return nil
+}
+
+// reads all transactions of all tenants in the archive, those of each tenant oldest first
+func (r *MinioRepository) GetArchivedTransactions(ctx context.Context, transactions *[]schema.Transaction) error {
+	tenants, err := r.allTenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := r.GetArchivedTransactionsOfTenant(ctx, tenant, transactions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reads all transactions of the tenant in the archive, oldest first
+func (r *MinioRepository) GetArchivedTransactionsOfTenant(ctx context.Context, tenant schema.Tenant, transactions *[]schema.Transaction) error {
+	tx := schema.NewTransaction(0)
+	tx.Tenant = tenant
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:    tx.GetArchiveRootPath(),
+		Recursive: false,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		txData, err := r.Client.GetObject(ctx, r.BucketName, object.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(txData)
+		txData.Close()
+		if err != nil {
+			return err
+		}
+		var transaction schema.Transaction
+		if err := json.Unmarshal(b, &transaction); err != nil {
+			return err
+		}
+		*transactions = append(*transactions, transaction)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package minio
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// commits many small transactions together, e.g. for workloads producing many of them per second.
+// the ETag preconditions of all of them are validated first, listing the transactions in progress only once, and those which fail
+// are neither committed nor rolled back, so that the caller can decide what to do with them, as with Validate.
+// the others are then committed in parallel, so that their round trips to the object store are interleaved.
+// each transaction is still committed atomically on its own, i.e. some may commit while others fail.
+// returns the results in the same order as the transactions.
+func (r *MinioRepository) CommitBatch(ctx context.Context, transactions []*schema.Transaction) []*CommitResult {
+	results := make([]*CommitResult, len(transactions))
+	if len(transactions) == 0 {
+		return results
+	}
+
+	// //////////////////////////////////////////////////
+	// validate all of them first
+	// //////////////////////////////////////////////////
+	// those of the tenants of the transactions, which only write the objects of their tenant
+	transactionsInProgress := make(map[string]uint64)
+	var err error
+	listed := make(map[schema.Tenant]bool)
+	for _, tx := range transactions {
+		if listed[tx.Tenant] || err != nil {
+			continue
+		}
+		listed[tx.Tenant] = true
+		var inProgress map[string]uint64
+		if inProgress, err = r.getOtherTransactionsInProgress(ctx, &schema.Transaction{Tenant: tx.Tenant}); err == nil {
+			maps.Copy(transactionsInProgress, inProgress)
+		}
+	}
+	if err != nil {
+		for i := range transactions {
+			results[i] = &CommitResult{FailedStepIndex: -1, Errors: []error{err}}
+		}
+		return results
+	}
+	toCommit := make([]int, 0, len(transactions))
+	for i, tx := range transactions {
+		if err := tx.IsOk(); err != nil {
+			results[i] = &CommitResult{FailedStepIndex: -1, Errors: []error{err}}
+			continue
+		}
+		others := maps.Clone(transactionsInProgress)
+		delete(others, tx.Id)
+		if errs := r.validateAgainst(ctx, tx, others); len(errs) > 0 {
+			results[i] = &CommitResult{FailedStepIndex: -1, Errors: errs}
+			continue
+		}
+		toCommit = append(toCommit, i)
+	}
+
+	// //////////////////////////////////////////////////
+	// then commit the valid ones, interleaved
+	// //////////////////////////////////////////////////
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, COMMIT_PARALLELISM)
+	for _, i := range toCommit {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i] = r.CommitWithResult(ctx, transactions[i])
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
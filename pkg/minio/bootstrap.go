@@ -0,0 +1,154 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the number of objects from the snapshot that are passed to the handler at once
+const BOOTSTRAP_BATCH_SIZE = 100
+
+// called with the snapshot, and then with the change sets which follow it
+type BootstrapHandler func(ctx context.Context, changeSet ChangeSet) error
+
+// bootstraps a new consumer, by passing a consistent snapshot of the table to the handler, as inserts in change sets without
+// an offset, followed by the change sets that were committed while the snapshot was being read. the position is then committed,
+// so that polling continues with the live change stream, without gaps or duplicates.
+//
+// since a transaction can commit shortly after the snapshot starts, even though the snapshot contains its changes, the change
+// sets around the snapshot are compared with the versions that the snapshot read, and changes which it already contains are
+// dropped. this means that an object which is absent from the snapshot, and is inserted and deleted around it, is dropped
+// entirely, since the net result is the same.
+//
+// this blocks until the change sets around the snapshot have settled. if it fails, nothing is committed, and it can be retried.
+func (c *ChangeConsumer) Bootstrap(ctx context.Context, table schema.Table, handler BootstrapHandler) error {
+	if c.committed != nil {
+		return fmt.Errorf("ADB-0072 consumer %s has already committed offset %s, so it cannot be bootstrapped", c.Name, c.committed.Offset)
+	}
+	position, err := c.repo.bootstrap(ctx, table, c.filter, "consumer "+c.Name, handler)
+	if err != nil {
+		return err
+	}
+	c.position = position
+	return c.Commit(ctx)
+}
+
+// passes the snapshot of the table and the change sets around it to the handler, as Bootstrap does, and returns the position in
+// the change log which follows them. the name is that of whatever is bootstrapped, for errors.
+func (r *MinioRepository) bootstrap(ctx context.Context, table schema.Table, filter *ChangeFilter, name string, handler BootstrapHandler) (string, error) {
+	// //////////////////////////////////////////////////
+	// snapshot
+	// //////////////////////////////////////////////////
+	tx := schema.NewReadOnlyTransaction(time.Hour)
+	tx.CacheLimits = schema.CacheLimits{MaxEntries: 1} // each object is read once
+	windowStart := tx.StartMicroseconds - CHANGE_LOG_SETTLE_MICROS
+	etags := make(map[string]string) // path to etag of the version in the snapshot
+	batch := ChangeSet{CommitMicros: tx.StartMicroseconds, Changes: make([]Change, 0, BOOTSTRAP_BATCH_SIZE)}
+	for id, err := range r.listIds(ctx, table) {
+		if err != nil {
+			return "", err
+		}
+		var data json.RawMessage
+		etag, _, err := getByPath(ctx, r, &tx, table.Path(id), &data)
+		if err != nil {
+			if errors.Is(err, NoSuchKeyError) {
+				// written after the snapshot started, or deleted before it
+				continue
+			}
+			return "", err
+		}
+		etags[table.Path(id)] = *etag
+		batch.Changes = append(batch.Changes, Change{Database: string(table.Database), Table: table.Name, Id: id, Operation: CHANGE_INSERT, ETag: *etag, Data: data})
+		if len(batch.Changes) == BOOTSTRAP_BATCH_SIZE {
+			if err := handleSnapshot(ctx, batch, filter, name, handler); err != nil {
+				return "", err
+			}
+			batch.Changes = make([]Change, 0, BOOTSTRAP_BATCH_SIZE)
+		}
+	}
+	if err := handleSnapshot(ctx, batch, filter, name, handler); err != nil {
+		return "", err
+	}
+
+	// //////////////////////////////////////////////////
+	// change sets around the snapshot
+	// //////////////////////////////////////////////////
+	// anything committed after this is certainly not in the snapshot
+	windowEnd := time.Now().UnixMicro() + CHANGE_LOG_SETTLE_MICROS
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(time.Duration(windowEnd-time.Now().UnixMicro()+CHANGE_LOG_SETTLE_MICROS) * time.Microsecond):
+	}
+
+	window := make([]ChangeSet, 0, 10)
+	position := fmt.Sprintf("%s%d", CHANGE_LOG_ROOT, windowStart)
+	for {
+		changeSets, err := r.readChangeLog(ctx, position, BOOTSTRAP_BATCH_SIZE)
+		if err != nil {
+			return "", err
+		}
+		for _, changeSet := range changeSets {
+			if changeSet.CommitMicros > windowEnd {
+				break
+			}
+			window = append(window, changeSet)
+			position = changeSet.Offset
+		}
+		if len(changeSets) < BOOTSTRAP_BATCH_SIZE || changeSets[len(changeSets)-1].CommitMicros > windowEnd {
+			break
+		}
+	}
+
+	// changes up to and including the version in the snapshot are already contained in it. for objects absent from the snapshot,
+	// that is up to and including their last deletion.
+	contained := make(map[string][2]int) // path to position of the last contained change in the window
+	for i, changeSet := range window {
+		for j, change := range changeSet.Changes {
+			if change.Database != string(table.Database) || change.Table != table.Name {
+				continue
+			}
+			path := table.Path(change.Id)
+			etag, inSnapshot := etags[path]
+			if (inSnapshot && change.ETag == etag) || (!inSnapshot && change.Operation == CHANGE_DELETE) {
+				contained[path] = [2]int{i, j}
+			}
+		}
+	}
+	for i, changeSet := range window {
+		changes := make([]Change, 0, len(changeSet.Changes))
+		for j, change := range changeSet.Changes {
+			if last, ok := contained[table.Path(change.Id)]; ok && change.Database == string(table.Database) && change.Table == table.Name {
+				if i < last[0] || (i == last[0] && j <= last[1]) {
+					continue
+				}
+			}
+			changes = append(changes, change)
+		}
+		changeSet.Changes = changes
+		if changeSet = filter.apply(changeSet); len(changeSet.Changes) == 0 {
+			continue
+		}
+		if err := handler(ctx, changeSet); err != nil {
+			return "", fmt.Errorf("ADB-0073 failed to handle change set %s for %s: %w", changeSet.Offset, name, err)
+		}
+	}
+
+	// continue after the window, rather than after the last change set in it, so that nothing in the window is read again
+	return fmt.Sprintf("%s%d", CHANGE_LOG_ROOT, windowEnd+1), nil
+}
+
+func handleSnapshot(ctx context.Context, batch ChangeSet, filter *ChangeFilter, name string, handler BootstrapHandler) error {
+	if batch = filter.apply(batch); len(batch.Changes) == 0 {
+		return nil
+	}
+	if err := handler(ctx, batch); err != nil {
+		return fmt.Errorf("ADB-0073 failed to handle snapshot for %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package minio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the first line of every bundle
+const BUNDLE_MAGIC = "abstrastore-bundle/1\n"
+
+// the largest frame of a bundle which is read, so that a corrupt length cannot exhaust memory
+const MAX_BUNDLE_FRAME_SIZE = 64 * 1024 * 1024
+
+const bundleNoncePrefixSize = 7
+
+// how a bundle is protected. the zero value writes a bundle which is only checksummed, e.g. for backups on trusted storage
+type BundleOptions struct {
+	// optional; a 32 byte key, with which the objects are encrypted with AES-256-GCM, so that only those with the key can read them
+	EncryptionKey []byte
+	// optional; the key with which the bundle is signed, so that those with the public key can tell that it was not changed
+	SigningKey ed25519.PrivateKey
+}
+
+// how a bundle is read. see VerifyBundle
+type BundleVerifyOptions struct {
+	// required if the bundle is encrypted
+	DecryptionKey []byte
+	// optional; if set, the bundle must be signed with the private key of this public key
+	PublicKey ed25519.PublicKey
+}
+
+// describes a bundle. it is written in the clear, and is authenticated along with the objects
+type BundleHeader struct {
+	Database      string `json:"database"`
+	Table         string `json:"table"`
+	CreatedMicros int64  `json:"createdMicros"`
+	Encrypted     bool   `json:"encrypted"`
+	Signed        bool   `json:"signed"`
+	// the random prefix of the nonces of the frames, if it is encrypted
+	NoncePrefix []byte `json:"noncePrefix,omitempty"`
+}
+
+// the last line of a bundle
+type bundleTrailer struct {
+	// of everything before the trailer
+	SHA256    string `json:"sha256"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// writes the objects of the table which exist when it starts to a bundle, e.g. to hand them to a third party or to store them off
+// site, which is encrypted and signed according to the options, so that it is confidential and tamper evident. the objects are
+// read from the snapshot of a read-only transaction whose cache is bypassed, see schema.Transaction.BypassCache, and written as
+// they are stored, one JSON document per line, in frames of EXPORT_PAGE_SIZE objects, each of which is encrypted on its own, so
+// that memory is bounded by the size of a frame, rather than growing with the size of the table. the last frame is marked, so
+// that a bundle which was cut short is detected. a checksum of the whole bundle, and its signature, follow the frames. see
+// VerifyBundle
+// Returns: the number of objects written
+func ExportBundle(ctx context.Context, repo *MinioRepository, table schema.Table, w io.Writer, options BundleOptions) (int, error) {
+	header := BundleHeader{Database: string(table.Database), Table: table.Name, CreatedMicros: schema.Now().UnixMicro(), Signed: options.SigningKey != nil}
+	var aead cipher.AEAD
+	if options.EncryptionKey != nil {
+		var err error
+		if aead, err = newBundleCipher(options.EncryptionKey); err != nil {
+			return 0, err
+		}
+		header.Encrypted = true
+		header.NoncePrefix = make([]byte, bundleNoncePrefixSize)
+		if _, err := rand.Read(header.NoncePrefix); err != nil {
+			return 0, err
+		}
+	}
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return 0, err
+	}
+	headerData = append(headerData, '\n')
+
+	digest := sha256.New()
+	out := io.MultiWriter(w, digest)
+	if _, err := io.WriteString(out, BUNDLE_MAGIC); err != nil {
+		return 0, err
+	}
+	if _, err := out.Write(headerData); err != nil {
+		return 0, err
+	}
+	frames := 0
+	writeFrame := func(plain []byte, last bool) error {
+		data := plain
+		if aead != nil {
+			data = aead.Seal(nil, bundleNonce(header.NoncePrefix, frames, last), plain, headerData)
+		}
+		length := make([]byte, 5)
+		binary.BigEndian.PutUint32(length, uint32(len(data)))
+		if last {
+			length[4] = 1
+		}
+		frames++
+		if _, err := out.Write(length); err != nil {
+			return err
+		}
+		_, err := out.Write(data)
+		return err
+	}
+
+	count := 0
+	frame := bytes.Buffer{}
+	snapshot := schema.NewReadOnlyTransaction(schema.MaxTimeout())
+	// each object is read once, so caching them would only make memory grow with the size of the table
+	snapshot.BypassCache = true
+	for result, err := range ExportTable[json.RawMessage](ctx, repo, &snapshot, table) {
+		if err != nil {
+			return count, err
+		}
+		// compacted, so that it has no newlines
+		line := bytes.Buffer{}
+		if err := json.Compact(&line, *result.Object); err != nil {
+			return count, err
+		}
+		frame.Write(line.Bytes())
+		frame.WriteByte('\n')
+		count++
+		if count%EXPORT_PAGE_SIZE == 0 {
+			if err := writeFrame(frame.Bytes(), false); err != nil {
+				return count, err
+			}
+			frame.Reset()
+		}
+	}
+	if err := writeFrame(frame.Bytes(), true); err != nil {
+		return count, err
+	}
+
+	sum := digest.Sum(nil)
+	trailer := bundleTrailer{SHA256: hex.EncodeToString(sum)}
+	if options.SigningKey != nil {
+		trailer.Signature = ed25519.Sign(options.SigningKey, sum)
+	}
+	trailerData, err := json.Marshal(trailer)
+	if err != nil {
+		return count, err
+	}
+	_, err = w.Write(append(trailerData, '\n'))
+	return count, err
+}
+
+// reads a bundle written by ExportBundle, passing each of its objects to the handler, and returns an InvalidBundleError if it
+// cannot be decrypted, was changed or cut short, or is not signed by the public key of the options. since the signature is at
+// the end, the objects are passed to the handler before the bundle is known to be valid, so the handler stages them, e.g. in a
+// transaction which is only committed if no error is returned. a handler which does nothing verifies the bundle.
+func VerifyBundle(r io.Reader, options BundleVerifyOptions, handler func(object json.RawMessage) error) (*BundleHeader, error) {
+	invalid := func(format string, args ...any) error {
+		return &InvalidBundleErrorWithDetails{Details: "ADB-0158 " + fmt.Sprintf(format, args...)}
+	}
+	digest := sha256.New()
+	in := bufio.NewReader(r)
+	magic, err := readBundleLine(in, digest, len(BUNDLE_MAGIC))
+	if err != nil || string(magic) != BUNDLE_MAGIC {
+		return nil, invalid("not a bundle")
+	}
+	headerData, err := readBundleLine(in, digest, MAX_BUNDLE_FRAME_SIZE)
+	if err != nil {
+		return nil, invalid("the header cannot be read: %s", err)
+	}
+	var header BundleHeader
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, invalid("the header cannot be read: %s", err)
+	}
+	if options.PublicKey != nil && !header.Signed {
+		return nil, invalid("the bundle of %s/%s is not signed", header.Database, header.Table)
+	}
+	var aead cipher.AEAD
+	if header.Encrypted {
+		if options.DecryptionKey == nil {
+			return nil, invalid("the bundle of %s/%s is encrypted, but there is no key", header.Database, header.Table)
+		}
+		if aead, err = newBundleCipher(options.DecryptionKey); err != nil {
+			return nil, err
+		}
+		if len(header.NoncePrefix) != bundleNoncePrefixSize {
+			return nil, invalid("the nonce of the bundle is invalid")
+		}
+	}
+
+	for frames, last := 0, false; !last; frames++ {
+		length := make([]byte, 5)
+		if _, err := io.ReadFull(in, length); err != nil {
+			return nil, invalid("the bundle was cut short after %d frames", frames)
+		}
+		digest.Write(length)
+		size := binary.BigEndian.Uint32(length)
+		last = length[4] == 1
+		if size > MAX_BUNDLE_FRAME_SIZE || length[4] > 1 {
+			return nil, invalid("frame %d is corrupt", frames)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return nil, invalid("the bundle was cut short in frame %d", frames)
+		}
+		digest.Write(data)
+		if aead != nil {
+			if data, err = aead.Open(nil, bundleNonce(header.NoncePrefix, frames, last), data, headerData); err != nil {
+				return nil, invalid("frame %d cannot be decrypted, since the key is wrong or the bundle was changed", frames)
+			}
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			if !json.Valid(line) {
+				return nil, invalid("frame %d contains an object which is not JSON", frames)
+			}
+			if err := handler(json.RawMessage(line)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sum := digest.Sum(nil)
+	trailerData, err := in.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var trailer bundleTrailer
+	if err := json.Unmarshal(trailerData, &trailer); err != nil {
+		return nil, invalid("the trailer cannot be read: %s", err)
+	}
+	if trailer.SHA256 != hex.EncodeToString(sum) {
+		return nil, invalid("the checksum does not match, so the bundle was changed")
+	}
+	if header.Signed != (trailer.Signature != nil) {
+		return nil, invalid("the signature does not match the header")
+	}
+	if options.PublicKey != nil && !ed25519.Verify(options.PublicKey, sum, trailer.Signature) {
+		return nil, invalid("the signature is not that of the public key, so the bundle was changed, or signed by someone else")
+	}
+	return &header, nil
+}
+
+func newBundleCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("ADB-0354 the key of a bundle must have 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// the nonce of a frame contains its position and whether it is the last, so that frames cannot be reordered, dropped or repeated
+func bundleNonce(prefix []byte, frame int, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[bundleNoncePrefixSize:], uint32(frame))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// reads a line, including its newline, adding it to the digest
+func readBundleLine(in *bufio.Reader, digest hash.Hash, max int) ([]byte, error) {
+	line := make([]byte, 0, 64)
+	for len(line) < max {
+		b, err := in.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			digest.Write(line)
+			return line, nil
+		}
+	}
+	return nil, fmt.Errorf("the line is longer than %d bytes", max)
+}
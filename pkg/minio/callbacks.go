@@ -1,7 +1,33 @@
 package minio
 
+import "github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+
 type Callback interface {
 	
 	// called if there is an error during garbage collection
 	ErrorDuringGc(err error)
 }
+
+// optionally implemented by the callback passed to Setup, in order to export metrics about index maintenance,
+// e.g. the lag of a backfill
+type IndexHealthCallback interface {
+
+	// called each time that progress is made maintaining an index, with a copy of its health
+	IndexHealthChanged(health IndexHealth)
+}
+
+// optionally implemented by the callback passed to Setup, in order to export metrics about the storage that is reclaimed,
+// e.g. by CleanStaleMultipartUploads
+type StorageReclaimedCallback interface {
+
+	// called each time that an incomplete multipart upload is aborted, with the number of bytes that its parts occupied
+	MultipartUploadAborted(path string, bytes int64)
+}
+
+// optionally implemented by the callback passed to Setup, in order to be alerted when external objects that records link to
+// change or disappear, e.g. while VerifyLinks runs periodically
+type ExternalLinkCallback interface {
+
+	// called each time that a link of a record of the table fails verification
+	ExternalLinkFailedVerification(table schema.Table, issue LinkIssue)
+}
@@ -0,0 +1,165 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// the names of the features that a backend may support, see Capabilities
+const (
+	// object versions, which transactions, time travel and the history of objects rely on
+	CAPABILITY_VERSIONING = "versioning"
+	// retention and legal holds of object versions, i.e. WORM storage
+	CAPABILITY_OBJECT_LOCK = "object-lock"
+	// S3 Select, i.e. queries which are evaluated by the backend, so that filters can be pushed down
+	CAPABILITY_SELECT = "select"
+	// bucket notifications, i.e. events published when objects are written, e.g. for event driven change data capture
+	CAPABILITY_NOTIFICATIONS = "notifications"
+)
+
+// the folder below which the objects that the support of S3 Select is probed with are written, each with a name of its own, so
+// that processes which probe at the same time do not remove each other's. it is in the folder of the system database, rather
+// than at the root of the bucket, next to the data of the application
+const CAPABILITIES_PROBE_FOLDER = string(schema.SYSTEM_DATABASE) + "/capabilities/"
+
+// what the bucket of the repository supports. features which are not supported should be disabled, or fail with an
+// UnsupportedCapabilityError when they are used
+type Capabilities struct {
+	Versioning    bool `json:"versioning"`
+	ObjectLock    bool `json:"objectLock"`
+	Select        bool `json:"select"`
+	Notifications bool `json:"notifications"`
+}
+
+// true if the capability, e.g. CAPABILITY_SELECT, is supported. unknown capabilities are not
+func (c Capabilities) Supports(capability string) bool {
+	switch capability {
+	case CAPABILITY_VERSIONING:
+		return c.Versioning
+	case CAPABILITY_OBJECT_LOCK:
+		return c.ObjectLock
+	case CAPABILITY_SELECT:
+		return c.Select
+	case CAPABILITY_NOTIFICATIONS:
+		return c.Notifications
+	default:
+		return false
+	}
+}
+
+// returns what the bucket supports, probing it the first time that it is called, and returning the same result after that,
+// since the configuration of buckets rarely changes. probing S3 Select writes and removes a small object below
+// CAPABILITIES_PROBE_FOLDER. errors which the backend returns because it does not implement a feature, e.g. `NotImplemented`, or
+// because it is not configured, mean that it is not supported, whereas others are returned, e.g. because access is denied or the
+// backend cannot be reached, since they say nothing about the support, and the probe is repeated the next time.
+func (r *MinioRepository) Capabilities(ctx context.Context) (Capabilities, error) {
+	r.capabilitiesMu.Lock()
+	defer r.capabilitiesMu.Unlock()
+	if r.capabilities != nil {
+		return *r.capabilities, nil
+	}
+	capabilities := Capabilities{}
+
+	versioning, err := r.Client.GetBucketVersioning(ctx, r.BucketName)
+	if supported, err := probed(err, "versioning"); err != nil {
+		return capabilities, err
+	} else {
+		capabilities.Versioning = supported && versioning.Enabled()
+	}
+
+	objectLock, _, _, _, err := r.Client.GetObjectLockConfig(ctx, r.BucketName)
+	if supported, err := probed(err, "object lock"); err != nil {
+		return capabilities, err
+	} else {
+		capabilities.ObjectLock = supported && objectLock == "Enabled"
+	}
+
+	_, err = r.Client.GetBucketNotification(ctx, r.BucketName)
+	if capabilities.Notifications, err = probed(err, "notifications"); err != nil {
+		return capabilities, err
+	}
+
+	if capabilities.Select, err = r.probeSelect(ctx); err != nil {
+		return capabilities, err
+	}
+
+	r.capabilities = &capabilities
+	return capabilities, nil
+}
+
+// returns an UnsupportedCapabilityError naming the first of the capabilities which the bucket does not support, e.g. so that a
+// feature which relies on them fails clearly when it is enabled, rather than later, when it is used
+func (r *MinioRepository) RequireCapabilities(ctx context.Context, capabilities ...string) error {
+	supported, err := r.Capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	for _, capability := range capabilities {
+		if !supported.Supports(capability) {
+			return &UnsupportedCapabilityErrorWithDetails{Details: fmt.Sprintf("ADB-0144 bucket %s does not support %s", r.BucketName, capability), Capability: capability}
+		}
+	}
+	return nil
+}
+
+func (r *MinioRepository) probeSelect(ctx context.Context) (bool, error) {
+	probe := `{"probe":1}` + "\n"
+	path := CAPABILITIES_PROBE_FOLDER + "select-probe-" + uuid.New().String() + ".json"
+	if _, err := r.Client.PutObject(ctx, r.BucketName, path, strings.NewReader(probe), int64(len(probe)), minio.PutObjectOptions{ContentType: "application/json"}); err != nil {
+		return false, fmt.Errorf("ADB-0229 failed to write the probe of select %s: %w", path, err)
+	}
+	defer r.Client.RemoveObject(context.WithoutCancel(ctx), r.BucketName, path, minio.RemoveObjectOptions{})
+
+	results, err := r.Client.SelectObjectContent(ctx, r.BucketName, path, minio.SelectObjectOptions{
+		Expression:          "SELECT s.probe FROM S3Object s",
+		ExpressionType:      minio.QueryExpressionTypeSQL,
+		InputSerialization:  minio.SelectObjectInputSerialization{JSON: &minio.JSONInputOptions{Type: minio.JSONLinesType}},
+		OutputSerialization: minio.SelectObjectOutputSerialization{JSON: &minio.JSONOutputOptions{}},
+	})
+	if err == nil {
+		defer results.Close()
+		var b []byte
+		if b, err = io.ReadAll(results); err == nil {
+			return strings.Contains(string(b), "1"), nil
+		}
+	}
+	return probed(err, "select")
+}
+
+// returns false if the error means that the feature is not implemented, or not configured, and the error if it means something
+// else, e.g. that access is denied, which is no reason to consider the feature unsupported
+func probed(err error, feature string) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	response := minio.ToErrorResponse(err)
+	switch {
+	case response.StatusCode == http.StatusNotImplemented,
+		response.StatusCode == http.StatusMethodNotAllowed,
+		response.Code == "NotImplemented",
+		response.Code == "XNotImplemented",
+		response.Code == "MethodNotAllowed",
+		response.Code == "ObjectLockConfigurationNotFoundError":
+		return false, nil
+	case response.StatusCode == http.StatusUnauthorized, response.StatusCode == http.StatusForbidden:
+		return false, fmt.Errorf("ADB-0230 access was denied when probing the support of %s, so it is unknown: %w", feature, err)
+	default:
+		return false, fmt.Errorf("ADB-0231 failed to probe the support of %s: %w", feature, err)
+	}
+}
+
+// fails with an UnsupportedCapabilityError if the table is written with protection that the bucket does not support, i.e.
+// versions that are retained, see schema.TableStorage.VersionRetention, which need object locking
+func (r *MinioRepository) checkStorageCapabilities(ctx context.Context, table schema.Table) error {
+	if table.Storage.VersionRetention == 0 {
+		return nil
+	}
+	return r.RequireCapabilities(ctx, CAPABILITY_OBJECT_LOCK)
+}
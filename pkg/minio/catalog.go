@@ -0,0 +1,115 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// a table as it is stored, e.g. for admin UIs and tooling. the counts and sizes are approximate, since the objects are listed
+// rather than read in a transaction, i.e. writes of transactions that are in progress are counted, and older versions are not.
+type TableDescription struct {
+	schema.TableDefinition
+
+	// the number of objects of the table
+	Records int `json:"records"`
+
+	// the bytes of the objects of the table, of the entries of its indices, and of everything else that is stored about it below
+	// `<database>/<table>/`, e.g. reverse indices, unique claims and attachments
+	Size int64 `json:"size"`
+
+	// in the order of the definition
+	IndexDescriptions []IndexDescription `json:"indexDescriptions"`
+}
+
+// an index of a table, as it is stored
+type IndexDescription struct {
+	schema.IndexDefinition
+
+	// the number of entries, including those of entities whose value is null, unless the index is sparse
+	Entries int `json:"entries"`
+}
+
+// returns the descriptions of the tables of the database in the schema registry, ordered by name, see DescribeTable. tables
+// which have path templates or layouts are described as their definitions say, i.e. with the default layout, since layouts are
+// declared by code.
+func (r *MinioRepository) ListTables(ctx context.Context, database schema.Database) ([]TableDescription, error) {
+	definitions, err := r.ListTableDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	descriptions := make([]TableDescription, 0)
+	for _, definition := range definitions {
+		if definition.Database != string(database) {
+			continue
+		}
+		table := schema.Table{Database: database, Name: definition.Name, PathTemplate: definition.PathTemplate}
+		description, err := r.describeTable(ctx, &table, definition)
+		if err != nil {
+			return nil, err
+		}
+		descriptions = append(descriptions, *description)
+	}
+	return descriptions, nil
+}
+
+// returns the description of the table, whose definition is that which is registered in the schema registry, or that of the
+// table if it is not registered, together with the approximate number of its records and entries of its indices, and the size of
+// what is stored. the objects of the table are listed, so this takes as long as a scan of their paths.
+func (r *MinioRepository) DescribeTable(ctx context.Context, table schema.Table) (*TableDescription, error) {
+	definition, err := r.GetTableDefinition(ctx, table.SchemaPath())
+	if err != nil {
+		return nil, err
+	}
+	if definition == nil {
+		d := table.Definition()
+		definition = &d
+	}
+	return r.describeTable(ctx, &table, *definition)
+}
+
+func (r *MinioRepository) describeTable(ctx context.Context, table *schema.Table, definition schema.TableDefinition) (*TableDescription, error) {
+	description := &TableDescription{TableDefinition: definition, IndexDescriptions: make([]IndexDescription, len(definition.Indices))}
+	prefixes := make([]string, len(definition.Indices))
+	for i, field := range definition.Indices {
+		description.IndexDescriptions[i].IndexDefinition = schema.IndexDefinition{Field: field}
+		if len(definition.IndexOptions) == len(definition.Indices) {
+			description.IndexDescriptions[i].IndexDefinition = definition.IndexOptions[i]
+		}
+		index := schema.Index{Table: *table, Field: field, Revision: description.IndexDescriptions[i].Revision}
+		prefixes[i] = index.PathPrefix() + "/"
+	}
+
+	// everything is below the folder of the table, except the objects of tables with path templates, which may be anywhere
+	folders := []string{table.Folder()}
+	if dataPrefix := table.DataPathPrefix(); !strings.HasPrefix(dataPrefix, folders[0]) {
+		folders = append(folders, dataPrefix)
+	}
+	for _, folder := range folders {
+		for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: folder, Recursive: true}) {
+			if object.Err != nil {
+				return nil, fmt.Errorf("ADB-0163 failed to list the objects of table %s/%s: %w", table.Database, table.Name, object.Err)
+			}
+			if _, ok := table.IdFromPath(object.Key); ok {
+				description.Records++
+				description.Size += object.Size
+				continue
+			}
+			if folder != folders[0] {
+				// something else that happens to share the prefix of the path template
+				continue
+			}
+			description.Size += object.Size
+			for i, prefix := range prefixes {
+				if strings.HasPrefix(object.Key, prefix) {
+					description.IndexDescriptions[i].Entries++
+					break
+				}
+			}
+		}
+	}
+	return description, nil
+}
@@ -0,0 +1,115 @@
+package minio
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// limits the changes that a consumer receives, and the fields of the objects in them, so that it only receives what it needs.
+type ChangeFilter struct {
+	// only changes to these tables are received. empty means all tables.
+	Tables []schema.Table
+
+	// only changes to objects whose indexed field has the value are received, compared case insensitively, like indices.
+	// the fields must be indexed in every table of the filter. deletions are always received, since they contain no object.
+	IndexedFieldEquals map[string]string
+
+	// only these fields of the objects are received. empty means all fields.
+	Fields []string
+}
+
+// sets the filter that is applied to the changes that this consumer polls, replacing any that was set before. nil removes it.
+func (c *ChangeConsumer) SetFilter(filter *ChangeFilter) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	c.filter = filter
+	return nil
+}
+
+// returns an error if the filter is on a field which is not indexed in every table of the filter
+func (f *ChangeFilter) validate() error {
+	if f == nil {
+		return nil
+	}
+	for field := range f.IndexedFieldEquals {
+		if len(f.Tables) == 0 {
+			return fmt.Errorf("ADB-0078 the filter on field %s requires the tables to be specified, since it must be indexed", field)
+		}
+		for _, table := range f.Tables {
+			if !slices.ContainsFunc(table.Indices, func(index schema.Index) bool { return index.Field == field }) {
+				return fmt.Errorf("ADB-0078 the filter on field %s is not possible, since it is not indexed in table %s", field, table.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// returns the change set with only the changes that the filter lets through, projected to the fields of the filter
+func (f *ChangeFilter) apply(changeSet ChangeSet) ChangeSet {
+	if f == nil {
+		return changeSet
+	}
+	changes := make([]Change, 0, len(changeSet.Changes))
+	for _, change := range changeSet.Changes {
+		if len(f.Tables) > 0 && !slices.ContainsFunc(f.Tables, func(table schema.Table) bool {
+			return string(table.Database) == change.Database && table.Name == change.Table
+		}) {
+			continue
+		}
+		if change.Data == nil {
+			changes = append(changes, change)
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(change.Data, &object); err != nil {
+			// not an object, so there are no fields to filter by
+			changes = append(changes, change)
+			continue
+		}
+		if !f.matches(object) {
+			continue
+		}
+		if len(f.Fields) > 0 {
+			projected := make(map[string]json.RawMessage, len(f.Fields))
+			for key, value := range object {
+				if slices.ContainsFunc(f.Fields, func(field string) bool { return strings.EqualFold(field, key) }) {
+					projected[key] = value
+				}
+			}
+			data, err := json.Marshal(projected)
+			if err == nil {
+				change.Data = data
+			}
+		}
+		changes = append(changes, change)
+	}
+	changeSet.Changes = changes
+	return changeSet
+}
+
+// fields are matched to JSON keys case insensitively, the same way as encoding/json does when unmarshalling
+func (f *ChangeFilter) matches(object map[string]json.RawMessage) bool {
+	for field, expected := range f.IndexedFieldEquals {
+		actual := ""
+		for key, value := range object {
+			if strings.EqualFold(field, key) {
+				var s string
+				if err := json.Unmarshal(value, &s); err == nil {
+					actual = s
+				} else if string(value) != "null" {
+					actual = string(value)
+				}
+				break
+			}
+		}
+		if !strings.EqualFold(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,373 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the change log (CDC stream) contains one object per committed transaction, named `<commitMicros>___<txId>.json`,
+// so that listing it returns the changes in commit order.
+const CHANGE_LOG_ROOT = "cdc/"
+
+// entries are only read once they are this old, since an entry for a transaction which committed earlier could
+// otherwise be written after one which committed later, and be skipped by a consumer.
+const CHANGE_LOG_SETTLE_MICROS = 5 * 1000 * 1000 // 5 seconds
+
+const CHANGE_INSERT = "insert"
+const CHANGE_UPDATE = "update"
+const CHANGE_DELETE = "delete"
+
+// the changes made by a single committed transaction
+type ChangeSet struct {
+	// the offset of this change set in the change log
+	Offset        string   `json:"-"`
+	TransactionId string   `json:"transactionId"`
+	CommitMicros  int64    `json:"commitMicros"`
+	Changes       []Change `json:"changes"`
+}
+
+// the net change to one object. if a transaction changes an object multiple times, only the final state is recorded.
+type Change struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Id       string `json:"id"`
+	// the tenant of the table, or empty for the default tenant
+	Tenant schema.Tenant `json:"tenant,omitempty"`
+	// insert, update or delete
+	Operation string `json:"operation"`
+	ETag      string `json:"etag"`
+	VersionId string `json:"versionId"`
+	// the object as written, or nil if it was deleted
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// records the changes of each committed transaction in the change log, so that downstream processors can tail them.
+// tables in the system database are never recorded. the entry is written before the changes become visible, so a transaction
+// whose entry cannot be written is rolled back, rather than committed without it.
+func (r *MinioRepository) EnableChangeLog() {
+	r.changeLogEnabled = true
+}
+
+func (r *MinioRepository) DisableChangeLog() {
+	r.changeLogEnabled = false
+}
+
+// writes the change set of the transaction to the change log, unless it changed nothing that is recorded
+func (r *MinioRepository) appendToChangeLog(ctx context.Context, tx *schema.Transaction, commitMicros int64) error {
+	changeSet := ChangeSet{
+		TransactionId: tx.Id,
+		CommitMicros:  commitMicros,
+		Changes:       netChanges(tx),
+	}
+	if len(changeSet.Changes) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(changeSet)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s%d%s%s.json", CHANGE_LOG_ROOT, commitMicros, schema.TIMESTAMP_ID_SEPARATOR, tx.Id)
+	_, err = r.Client.PutObject(ctx, r.BucketName, path, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("ADB-0067 Failed to append tx %s to the change log at path %s, %w", tx.Id, path, err)
+	}
+	return nil
+}
+
+// collapses the data steps of the transaction into one change per object
+func netChanges(tx *schema.Transaction) []Change {
+	changes := make([]Change, 0, len(tx.Steps))
+	positions := make(map[string]int) // path to position in changes, or -1 if the change cancelled out
+	for _, step := range tx.Steps {
+		if step.Skipped {
+			continue
+		}
+		var operation string
+		switch step.Type {
+		case schema.STEP_INSERT_DATA:
+			operation = CHANGE_INSERT
+		case schema.STEP_UPDATE_DATA:
+			operation = CHANGE_UPDATE
+		case schema.STEP_DELETE_DATA:
+			operation = CHANGE_DELETE
+		default:
+			continue
+		}
+		coordinates, err := schema.DatabaseTableIdTupleFromDataPath(step.Path)
+		if err != nil || coordinates.Database == string(schema.SYSTEM_DATABASE) {
+			continue
+		}
+		change := Change{Database: coordinates.Database, Table: coordinates.Table, Id: coordinates.Id, Tenant: coordinates.Tenant, Operation: operation}
+		if step.FinalETag != nil {
+			change.ETag = *step.FinalETag
+		}
+		if step.FinalVersionId != nil {
+			change.VersionId = *step.FinalVersionId
+		}
+		if operation != CHANGE_DELETE {
+			data, err := tx.StepData(step)
+			if err != nil {
+				continue
+			}
+			change.Data = json.RawMessage(data)
+		}
+
+		position, exists := positions[step.Path]
+		if !exists || position == -1 {
+			if exists && operation == CHANGE_INSERT {
+				// deleted and inserted again => net update
+				change.Operation = CHANGE_UPDATE
+			}
+			positions[step.Path] = len(changes)
+			changes = append(changes, change)
+			continue
+		}
+		previous := changes[position].Operation
+		if previous == CHANGE_INSERT && operation == CHANGE_DELETE {
+			// never visible to anyone
+			positions[step.Path] = -1
+			changes[position].Operation = ""
+			continue
+		}
+		if previous == CHANGE_INSERT {
+			change.Operation = CHANGE_INSERT
+		} else if previous == CHANGE_DELETE && operation == CHANGE_INSERT {
+			change.Operation = CHANGE_UPDATE
+		}
+		changes[position] = change
+	}
+
+	result := make([]Change, 0, len(changes))
+	for _, change := range changes {
+		if change.Operation != "" {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// reads up to max change sets from the change log, which come after the given offset and have settled. "" is the start of the log.
+func (r *MinioRepository) readChangeLog(ctx context.Context, offset string, max int) ([]ChangeSet, error) {
+	settledBefore := time.Now().UnixMicro() - CHANGE_LOG_SETTLE_MICROS
+	changeSets := make([]ChangeSet, 0, max)
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel() // stop listing once enough are read
+	for object := range r.Client.ListObjects(listCtx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:     CHANGE_LOG_ROOT,
+		StartAfter: offset,
+		Recursive:  true,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if len(changeSets) >= max {
+			break
+		}
+		changeSet, err := r.readChangeSet(ctx, object.Key)
+		if err != nil {
+			return nil, err
+		}
+		if changeSet.CommitMicros >= settledBefore {
+			break
+		}
+		changeSets = append(changeSets, *changeSet)
+	}
+	return changeSets, nil
+}
+
+func (r *MinioRepository) readChangeSet(ctx context.Context, path string) (*ChangeSet, error) {
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0068 failed to get change set %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0068 failed to get change set %s: %w", path, err)
+	}
+	var changeSet ChangeSet
+	if err := json.Unmarshal(b, &changeSet); err != nil {
+		return nil, err
+	}
+	changeSet.Offset = path
+	return &changeSet, nil
+}
+
+// //////////////////////////////////////////////////
+// consumers
+// //////////////////////////////////////////////////
+
+// the system table in which the committed offset of each named consumer is stored
+var T_CHANGE_LOG_CONSUMERS = schema.NewTable(schema.SYSTEM_DATABASE, "change_log_consumers", []string{})
+
+// the committed offset of a named consumer
+type ConsumerOffset struct {
+	Id     string `json:"id"`
+	Offset string `json:"offset"`
+}
+
+// a named consumer of the change log, with its own committed offset, so that multiple downstream processors can tail
+// changes at their own pace. it pulls changes, so it is never sent more than it asks for.
+// instances sharing a name share the committed offset; committing concurrently results in a StaleObjectError.
+type ChangeConsumer struct {
+	repo *MinioRepository
+	Name string
+
+	// where the next poll continues from
+	position string
+
+	committed *ConsumerOffset
+	etag      *string
+
+	// nil unless set
+	filter *ChangeFilter
+}
+
+// returns the consumer with the given name, positioned at its committed offset, i.e. the start of the log if it is new
+func (r *MinioRepository) NewChangeConsumer(ctx context.Context, name string) (*ChangeConsumer, error) {
+	consumer := &ChangeConsumer{repo: r, Name: name}
+	tx := schema.NewReadOnlyTransaction(10 * time.Second)
+	offset := &ConsumerOffset{}
+	etag, err := NewTypedQuery[ConsumerOffset](r, ctx, &tx).SelectFromTable(T_CHANGE_LOG_CONSUMERS).WhereIdEquals(name).Find(offset)
+	if err != nil {
+		if !errors.Is(err, NoSuchKeyError) {
+			return nil, err
+		}
+		return consumer, nil
+	}
+	consumer.committed = offset
+	consumer.etag = etag
+	consumer.position = offset.Offset
+	return consumer, nil
+}
+
+// returns up to max change sets following the current position, and moves the position past them.
+// the position is not committed until Commit is called.
+// change sets which the filter removes completely are skipped.
+func (c *ChangeConsumer) Poll(ctx context.Context, max int) ([]ChangeSet, error) {
+	result := make([]ChangeSet, 0, max)
+	for len(result) < max {
+		changeSets, err := c.repo.readChangeLog(ctx, c.position, max-len(result))
+		if err != nil {
+			return nil, err
+		}
+		if len(changeSets) == 0 {
+			break
+		}
+		for _, changeSet := range changeSets {
+			if changeSet = c.filter.apply(changeSet); len(changeSet.Changes) > 0 {
+				result = append(result, changeSet)
+			}
+		}
+		c.position = changeSets[len(changeSets)-1].Offset
+	}
+	return result, nil
+}
+
+// the position that the next poll continues from
+func (c *ChangeConsumer) Position() string {
+	return c.position
+}
+
+// moves the position, in order to replay from any offset. "" replays from the start of the log.
+func (c *ChangeConsumer) Seek(offset string) {
+	c.position = offset
+}
+
+// persists the current position as the consumer's committed offset
+func (c *ChangeConsumer) Commit(ctx context.Context) error {
+	tx, err := c.repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	offset, etag, err := c.writeOffset(ctx, &tx, c.position)
+	if err != nil {
+		c.repo.Rollback(ctx, &tx)
+		return err
+	}
+	if errs := c.repo.Commit(ctx, &tx); len(errs) > 0 {
+		return errs[0]
+	}
+	c.committed = offset
+	c.etag = etag
+	return nil
+}
+
+// called for each change set, with the transaction in which the offset is advanced past it
+type ChangeSetHandler func(ctx context.Context, tx *schema.Transaction, changeSet ChangeSet) error
+
+// polls up to max change sets following the committed offset, and applies them with the handler, within a single transaction
+// which also advances the committed offset. so data that the handler derives from the changes and writes into the store
+// is written exactly once: if anything fails, e.g. because another instance of the consumer advanced the offset first,
+// nothing is written, and the position is reset to the committed offset, so the same changes can be processed again.
+// returns the number of change sets that were applied.
+func (c *ChangeConsumer) Apply(ctx context.Context, max int, timeout time.Duration, handler ChangeSetHandler) (int, error) {
+	c.position = c.committedOffset()
+	changeSets, err := c.Poll(ctx, max)
+	if err != nil {
+		return 0, err
+	}
+	if len(changeSets) == 0 {
+		return 0, nil
+	}
+
+	tx, err := c.repo.BeginTransaction(ctx, timeout)
+	if err != nil {
+		c.position = c.committedOffset()
+		return 0, err
+	}
+	for _, changeSet := range changeSets {
+		if err = handler(ctx, &tx, changeSet); err != nil {
+			err = fmt.Errorf("ADB-0070 failed to apply change set %s for consumer %s: %w", changeSet.Offset, c.Name, err)
+			break
+		}
+	}
+	var offset *ConsumerOffset
+	var etag *string
+	if err == nil {
+		offset, etag, err = c.writeOffset(ctx, &tx, c.position)
+	}
+	if err != nil {
+		c.repo.Rollback(ctx, &tx)
+		c.position = c.committedOffset()
+		return 0, err
+	}
+	if errs := c.repo.Commit(ctx, &tx); len(errs) > 0 {
+		c.position = c.committedOffset()
+		return 0, errs[0]
+	}
+	c.committed = offset
+	c.etag = etag
+	return len(changeSets), nil
+}
+
+// writes the given offset as the committed offset, optimistically locked against the last version that this consumer committed
+func (c *ChangeConsumer) writeOffset(ctx context.Context, tx *schema.Transaction, position string) (*ConsumerOffset, *string, error) {
+	offset := &ConsumerOffset{Id: c.Name, Offset: position}
+	var etag *string
+	var err error
+	if c.committed == nil {
+		etag, err = c.repo.InsertIntoTable(ctx, tx, T_CHANGE_LOG_CONSUMERS, offset)
+	} else {
+		etag, err = c.repo.UpdateTable(ctx, tx, T_CHANGE_LOG_CONSUMERS, offset, c.etag)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return offset, etag, nil
+}
+
+func (c *ChangeConsumer) committedOffset() string {
+	if c.committed == nil {
+		return ""
+	}
+	return c.committed.Offset
+}
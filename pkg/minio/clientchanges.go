@@ -0,0 +1,200 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the changes that a client made to a record, e.g. while it was offline, relative to the version that it last read
+type ClientChangeSet struct {
+	Id string `json:"id"`
+	// the ETag of the version which the changes were made to
+	BaseETag string `json:"baseEtag"`
+	// the new values of the fields which the client changed, by the names they have in the JSON of the record. null clears a field
+	Changes map[string]json.RawMessage `json:"changes"`
+}
+
+// a field of a change set which was not applied, since both the client and someone else changed it differently
+type FieldConflict struct {
+	Field string `json:"field"`
+	// the value in the version which the client changed, or nil if that version no longer exists
+	Base json.RawMessage `json:"base,omitempty"`
+	// the value in the version which the change set was applied to
+	Current json.RawMessage `json:"current"`
+	// the value that the client wrote
+	Client json.RawMessage `json:"client"`
+}
+
+// applies the change set to the current version of the record within the transaction, with a three-way merge against the version
+// that the client changed, so that clients which edit offline can sync their changes without losing those of others. each field
+// that the client changed is written, unless someone else changed it since the base version, and to a different value, in
+// which case it is a conflict, which is left as it is and returned, e.g. to be resolved by the user and sent again with the
+// ETag that is returned as its base. if the base version no longer exists, every field whose value differs is a conflict.
+// the other fields are written even if some conflict, and the caller rolls back the transaction if it wants all or none.
+// fails with a NoSuchKeyError if the record does not exist, with ADB-0153 if a field is not one of the record, and with an
+// UnsupportedCapabilityError if the bucket does not keep versions.
+// Returns: the record, its ETag, which is that of the current version if nothing was written, and the conflicts
+func ApplyClientChangeSet[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, table schema.Table, changeSet ClientChangeSet) (*T, *string, []FieldConflict, error) {
+	// the base version is read from the history of the record
+	if err := repo.RequireCapabilities(ctx, CAPABILITY_VERSIONING); err != nil {
+		return nil, nil, nil, err
+	}
+	entity := new(T)
+	etag, err := NewTypedQuery[T](repo, ctx, tx).SelectFromTable(table).WhereIdEquals(changeSet.Id).Find(entity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	known := knownFields(reflect.TypeOf(entity))
+	for field := range changeSet.Changes {
+		if !slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, field) }) {
+			return nil, nil, nil, fmt.Errorf("ADB-0153 the change set for %s changes the field %s, which the record does not have", table.Path(changeSet.Id), field)
+		}
+	}
+
+	current, err := jsonFields(entity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var base map[string]json.RawMessage
+	if etag != nil && *etag == changeSet.BaseETag {
+		base = current
+	} else if data, err := repo.readVersionWithETag(ctx, table.Path(changeSet.Id), changeSet.BaseETag); err != nil {
+		return nil, nil, nil, err
+	} else if data != nil {
+		if err := json.Unmarshal(data, &base); err != nil {
+			return nil, nil, nil, fmt.Errorf("ADB-0308 the base version of %s is not a JSON object: %w", table.Path(changeSet.Id), err)
+		}
+	}
+
+	fields := make([]string, 0, len(changeSet.Changes))
+	for field := range changeSet.Changes {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	conflicts := make([]FieldConflict, 0)
+	changed := false
+	for _, field := range fields {
+		client := changeSet.Changes[field]
+		key, currentValue := lookupField(current, field)
+		if equal, err := equalJSON(currentValue, client); err != nil {
+			return nil, nil, nil, fmt.Errorf("ADB-0309 invalid value of field %s in the change set for %s: %w", field, table.Path(changeSet.Id), err)
+		} else if equal {
+			// already the value that the client wants, e.g. because the client sent it before
+			continue
+		}
+		if base != nil {
+			_, baseValue := lookupField(base, field)
+			if unchanged, err := equalJSON(baseValue, currentValue); err != nil {
+				return nil, nil, nil, err
+			} else if unchanged {
+				current[key] = client
+				changed = true
+				continue
+			}
+			conflicts = append(conflicts, FieldConflict{Field: field, Base: baseValue, Current: currentValue, Client: client})
+		} else {
+			conflicts = append(conflicts, FieldConflict{Field: field, Current: currentValue, Client: client})
+		}
+	}
+	if !changed {
+		return entity, etag, conflicts, nil
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	merged := new(T)
+	if err := json.Unmarshal(data, merged); err != nil {
+		return nil, nil, nil, fmt.Errorf("ADB-0310 the change set for %s does not fit the record: %w", table.Path(changeSet.Id), err)
+	}
+	newETag, err := repo.UpdateTable(ctx, tx, table, merged, etag)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return merged, newETag, conflicts, nil
+}
+
+// returns the data of the version of the object that has the ETag, or nil if there is none, e.g. because it was pruned
+func (r *MinioRepository) readVersionWithETag(ctx context.Context, path string, etag string) ([]byte, error) {
+	if etag == "" {
+		return nil, nil
+	}
+	versionId := ""
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: path, WithVersions: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if object.Key == path && object.ETag == etag && !object.IsDeleteMarker && object.Size > 0 {
+			versionId = object.VersionID
+			break
+		}
+	}
+	if versionId == "" {
+		return nil, nil
+	}
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{VersionID: versionId})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return readObject(object)
+}
+
+// returns the fields of the entity, by the names they have in its JSON
+func jsonFields(entity any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("ADB-0311 the record is not a JSON object: %w", err)
+	}
+	return fields, nil
+}
+
+// returns the key of the field, which encoding/json matches case insensitively, and its value, which is null if it is omitted
+func lookupField(fields map[string]json.RawMessage, field string) (string, json.RawMessage) {
+	if value, ok := fields[field]; ok {
+		return field, value
+	}
+	for key, value := range fields {
+		if strings.EqualFold(key, field) {
+			return key, value
+		}
+	}
+	return field, json.RawMessage("null")
+}
+
+// true if the JSON values are equal, regardless of their formatting, and of the order of the fields of objects. numbers are
+// compared exactly, as they are written
+func equalJSON(a json.RawMessage, b json.RawMessage) (bool, error) {
+	decode := func(data json.RawMessage) (any, error) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, nil
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var value any
+		err := decoder.Decode(&value)
+		return value, err
+	}
+	x, err := decode(a)
+	if err != nil {
+		return false, err
+	}
+	y, err := decode(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(x, y), nil
+}
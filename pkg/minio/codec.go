@@ -0,0 +1,224 @@
+package minio
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// normalises the times in the entity as the codec of the table writes them, including those in nested structs, slices and maps,
+// so that the entity holds what is stored, and its index entries are computed from the same values. the entity must be a pointer
+// for its times to be changed, and is left as it is otherwise.
+func normalizeEntity(codec schema.TableCodec, entity any) {
+	if codec == (schema.TableCodec{}) {
+		return
+	}
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	normalizeValue(codec, v.Elem(), 0)
+}
+
+func normalizeValue(codec schema.TableCodec, v reflect.Value, depth int) {
+	if depth > 32 {
+		// self referencing data is not written by encoding/json either
+		return
+	}
+	switch {
+	case v.Type() == timeType:
+		if v.CanSet() {
+			v.Set(reflect.ValueOf(codec.NormalizeTime(v.Interface().(time.Time))))
+		}
+	case v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface:
+		if !v.IsNil() {
+			normalizeValue(codec, v.Elem(), depth+1)
+		}
+	case v.Kind() == reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				normalizeValue(codec, v.Field(i), depth+1)
+			}
+		}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := range v.Len() {
+			normalizeValue(codec, v.Index(i), depth+1)
+		}
+	case v.Kind() == reflect.Map:
+		if v.Type().Elem() != timeType {
+			// the values of maps are not addressable, so only times are replaced
+			return
+		}
+		for _, key := range v.MapKeys() {
+			v.SetMapIndex(key, reflect.ValueOf(codec.NormalizeTime(v.MapIndex(key).Interface().(time.Time))))
+		}
+	}
+}
+
+// returns a DecimalConstraintError if a decimal field of the entity has more digits than the table permits, see
+// schema.Table.WithDecimalField
+func checkDecimals(table schema.Table, entity any) error {
+	if len(table.Decimals) == 0 {
+		return nil
+	}
+	for _, constraint := range table.Decimals {
+		field, err := entityField(entity, constraint.Field)
+		if err != nil {
+			return err
+		}
+		value, err := decimalOf(field)
+		if err != nil {
+			return &DecimalConstraintErrorWithDetails{Details: fmt.Sprintf("ADB-0149 field %s is not a decimal: %s", constraint.Field, err), Constraint: constraint}
+		}
+		if value == nil || *value == "" {
+			continue
+		}
+		decimal, err := schema.NewDecimal(*value)
+		if err == nil {
+			err = constraint.Check(decimal)
+		}
+		if err != nil {
+			return &DecimalConstraintErrorWithDetails{Details: err.Error(), Constraint: constraint, Value: *value}
+		}
+	}
+	return nil
+}
+
+// returns an EnumConstraintError if an enum field of the entity has a value which the table does not permit, see
+// schema.Table.WithEnumField
+func checkEnums(table schema.Table, entity any) error {
+	if len(table.Enums) == 0 {
+		return nil
+	}
+	for _, enum := range table.Enums {
+		field, err := entityField(entity, enum.Field)
+		if err != nil {
+			return err
+		}
+		values, err := enumValuesOf(field)
+		if err != nil {
+			return &EnumConstraintErrorWithDetails{Details: fmt.Sprintf("ADB-0307 field %s is not an enum: %s", enum.Field, err), Enum: enum}
+		}
+		for _, value := range values {
+			if _, err := enum.Code(value); err != nil {
+				return &EnumConstraintErrorWithDetails{Details: err.Error(), Enum: enum, Value: value}
+			}
+		}
+	}
+	return nil
+}
+
+// returns the values that the field holds, i.e. none if it is null, one if it is a string, a type whose kind is string, or a
+// pointer to one, and those which are not null if it is a slice or array of them, e.g. of the values of a map, as encoding/json
+// decodes arrays into them
+func enumValuesOf(v reflect.Value) ([]string, error) {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if v.String() == "" {
+			return nil, nil
+		}
+		return []string{v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		values := make([]string, 0, v.Len())
+		for i := range v.Len() {
+			element := v.Index(i)
+			if element.Kind() == reflect.Slice || element.Kind() == reflect.Array {
+				return nil, fmt.Errorf("unsupported type %s", v.Type())
+			}
+			elementValues, err := enumValuesOf(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, elementValues...)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// returns the exact decimal that a decimal index uses for the given entity, encoded with schema.EncodeSortableDecimal, or nil
+// if it is null, i.e. a nil pointer or an empty string. computed values are parsed as decimals.
+func getDecimalIndexValue(index *schema.Index, entity any) (*string, error) {
+	var decimal string
+	if index.Compute != nil {
+		value, err := index.Compute(entity)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0037 failed to compute value of index %s: %w", index.Field, err)
+		}
+		if value == nil {
+			return nil, nil
+		}
+		decimal = *value
+	} else {
+		field, err := entityField(entity, index.Field)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decimalOf(field)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0350 field %s of the decimal index is not a decimal: %w", index.Field, err)
+		}
+		if value == nil {
+			return nil, nil
+		}
+		decimal = *value
+	}
+	if decimal == "" {
+		return nil, nil
+	}
+	encoded, err := schema.EncodeSortableDecimal(decimal)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0351 failed to index the value of %s: %w", index.Field, err)
+	}
+	return &encoded, nil
+}
+
+// returns the decimal that the value holds, or nil if it is a nil pointer. integers and floats are formatted exactly, and other
+// types which have a String method are assumed to return a decimal
+func decimalOf(v reflect.Value) (*string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if stringer, ok := v.Interface().(fmt.Stringer); ok {
+			decimal := stringer.String()
+			return &decimal, nil
+		}
+		v = v.Elem()
+	}
+	var decimal string
+	if stringer, ok := v.Interface().(fmt.Stringer); ok {
+		decimal = stringer.String()
+	} else {
+		switch {
+		case v.Kind() == reflect.String: // including json.Number
+			decimal = v.String()
+		case v.CanInt():
+			decimal = strconv.FormatInt(v.Int(), 10)
+		case v.CanUint():
+			decimal = strconv.FormatUint(v.Uint(), 10)
+		case v.CanFloat():
+			decimal = strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+		default:
+			return nil, fmt.Errorf("unsupported type %s", v.Type())
+		}
+	}
+	return &decimal, nil
+}
@@ -0,0 +1,50 @@
+package minio
+
+import (
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// what a commit wrote, so that callers can update their local caches or emit precise change events without reading the objects
+type CommitReport struct {
+	TransactionId string
+	CommitMicros  int64
+	// one per path, in the order that the paths were first written
+	Objects []CommittedObject
+}
+
+// the final state of a path written by a committed transaction
+type CommittedObject struct {
+	Path string
+	// the last step which wrote the path, e.g. STEP_DELETE_DATA if it was updated and then deleted
+	Type           schema.StepType
+	FinalETag      *string
+	FinalVersionId *string
+}
+
+func newCommitReport(tx *schema.Transaction, commitMicros int64) *CommitReport {
+	report := &CommitReport{TransactionId: tx.Id, CommitMicros: commitMicros, Objects: make([]CommittedObject, 0, len(tx.Steps))}
+	positions := make(map[string]int) // path to position in objects
+	for _, step := range tx.Steps {
+		if step.Skipped || !step.Executed || step.Type == schema.STEP_EPHEMERAL {
+			continue
+		}
+		object := CommittedObject{Path: step.Path, Type: step.Type, FinalETag: step.FinalETag, FinalVersionId: step.FinalVersionId}
+		if position, ok := positions[step.Path]; ok {
+			report.Objects[position] = object
+		} else {
+			positions[step.Path] = len(report.Objects)
+			report.Objects = append(report.Objects, object)
+		}
+	}
+	return report
+}
+
+// returns what was written to the path, if anything
+func (c *CommitReport) Get(path string) (CommittedObject, bool) {
+	for _, object := range c.Objects {
+		if object.Path == path {
+			return object, true
+		}
+	}
+	return CommittedObject{}, false
+}
@@ -0,0 +1,151 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// which changes to keep, per object, when compacting the change log. a change is kept if either rule keeps it.
+type CompactionPolicy struct {
+	// the number of latest changes to keep per object. at least the latest is always kept, unless it is an expired deletion.
+	KeepLatest int
+
+	// changes committed within this duration are kept
+	KeepWithin time.Duration
+
+	// once the latest change to an object is a deletion which is older than this, the object is removed from the log entirely.
+	// zero keeps deletions forever, so that consumers which replay the log always learn about them.
+	TombstoneRetention time.Duration
+}
+
+type CompactionResult struct {
+	ChangeSetsRewritten int
+	ChangeSetsRemoved   int
+	ChangesRemoved      int
+}
+
+// the position of a change in the change log
+type changePosition struct {
+	changeSet int
+	change    int
+}
+
+// compacts the change log per object, so that it does not grow unboundedly. consumers which are behind still receive the latest
+// state of every object, but not necessarily every change that led to it.
+// change sets from the last two settle windows are never touched, since a bootstrapping consumer reads them.
+func (r *MinioRepository) CompactChangeLog(ctx context.Context, policy CompactionPolicy) (*CompactionResult, error) {
+	now := time.Now().UnixMicro()
+	horizon := now - 2*CHANGE_LOG_SETTLE_MICROS
+	changeSets := make([]ChangeSet, 0, 100)
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:    CHANGE_LOG_ROOT,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		changeSet, err := r.readChangeSet(ctx, object.Key)
+		if err != nil {
+			return nil, err
+		}
+		if changeSet.CommitMicros >= horizon {
+			break
+		}
+		changeSets = append(changeSets, *changeSet)
+	}
+
+	// oldest first
+	history := make(map[string][]changePosition)
+	for i, changeSet := range changeSets {
+		for j, change := range changeSet.Changes {
+			key := change.Database + "/" + change.Table + "/" + change.Id
+			history[key] = append(history[key], changePosition{i, j})
+		}
+	}
+
+	keepLatest := max(policy.KeepLatest, 1)
+	remove := make(map[changePosition]bool)
+	for _, positions := range history {
+		latest := positions[len(positions)-1]
+		latestSet := changeSets[latest.changeSet]
+		expiredTombstone := policy.TombstoneRetention > 0 &&
+			latestSet.Changes[latest.change].Operation == CHANGE_DELETE &&
+			latestSet.CommitMicros < now-policy.TombstoneRetention.Microseconds()
+		for k, position := range positions {
+			if expiredTombstone {
+				remove[position] = true
+				continue
+			}
+			if k >= len(positions)-keepLatest {
+				continue
+			}
+			if policy.KeepWithin > 0 && changeSets[position.changeSet].CommitMicros >= now-policy.KeepWithin.Microseconds() {
+				continue
+			}
+			remove[position] = true
+		}
+	}
+
+	result := &CompactionResult{}
+	for i, changeSet := range changeSets {
+		changes := make([]Change, 0, len(changeSet.Changes))
+		for j, change := range changeSet.Changes {
+			if !remove[changePosition{i, j}] {
+				changes = append(changes, change)
+			}
+		}
+		removed := len(changeSet.Changes) - len(changes)
+		if removed == 0 {
+			continue
+		}
+		if len(changes) == 0 {
+			if err := r.removeVersionsExcept(ctx, changeSet.Offset, ""); err != nil {
+				return result, err
+			}
+			result.ChangeSetsRemoved++
+		} else {
+			// rewritten in place, so that its offset is unchanged
+			changeSet.Changes = changes
+			data, err := json.Marshal(changeSet)
+			if err != nil {
+				return result, err
+			}
+			uploadInfo, err := r.Client.PutObject(ctx, r.BucketName, changeSet.Offset, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+			if err != nil {
+				return result, fmt.Errorf("ADB-0086 failed to rewrite change set %s during compaction: %w", changeSet.Offset, err)
+			}
+			if err := r.removeVersionsExcept(ctx, changeSet.Offset, uploadInfo.VersionID); err != nil {
+				return result, err
+			}
+			result.ChangeSetsRewritten++
+		}
+		result.ChangesRemoved += removed
+	}
+	return result, nil
+}
+
+// removes the versions of the object, other than the given one, since the bucket is versioned and they would otherwise take up space.
+// Param: keepVersionId - the version to keep, or "" to remove the object entirely
+func (r *MinioRepository) removeVersionsExcept(ctx context.Context, path string, keepVersionId string) error {
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:       path,
+		WithVersions: true,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if object.Key != path || (keepVersionId != "" && object.VersionID == keepVersionId) {
+			continue
+		}
+		err := r.Client.RemoveObject(ctx, r.BucketName, path, minio.RemoveObjectOptions{VersionID: object.VersionID, GovernanceBypass: true})
+		if err != nil {
+			return fmt.Errorf("ADB-0086 failed to remove version %s of change set %s during compaction: %w", object.VersionID, path, err)
+		}
+	}
+	return nil
+}
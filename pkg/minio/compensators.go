@@ -0,0 +1,70 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// undoes a side effect outside of the store, e.g. refunds a payment, using the arguments that were registered with the compensation.
+// repo is the repository which rolls back or recovers the transaction. it may be called more than once for the same compensation,
+// if a process fails while rolling back, so it must be idempotent.
+type Compensator func(ctx context.Context, repo *MinioRepository, tx *schema.Transaction, args json.RawMessage) error
+
+var compensators = make(map[string]Compensator)
+var compensatorsMu sync.Mutex
+
+// registers the compensator under its name, replacing any that was registered before. every process which may roll back or
+// recover transactions must register the same compensators.
+func RegisterCompensator(name string, compensator Compensator) {
+	compensatorsMu.Lock()
+	defer compensatorsMu.Unlock()
+	compensators[name] = compensator
+}
+
+// registers a compensation on the transaction, like schema.Transaction.Compensate, and stores the transaction at once, so that the
+// compensation is executed even if this process fails before the transaction is stored again, by the process which recovers it.
+// it is called before the side effect is caused. if the transaction cannot be stored, the compensation is removed again and an
+// error is returned, in which case the side effect must not be caused.
+func (r *MinioRepository) Compensate(ctx context.Context, tx *schema.Transaction, compensator string, args any) error {
+	if err := tx.Compensate(compensator, args); err != nil {
+		return err
+	}
+	if err := r.updateTransaction(ctx, tx); err != nil {
+		tx.Compensations = tx.Compensations[:len(tx.Compensations)-1]
+		return err
+	}
+	return nil
+}
+
+// executes the compensations of the transaction which have not yet been executed, in reverse order, recording each one that
+// succeeds on the transaction record, so that they are not executed again when it is recovered.
+// called during rollback, and by processes which recover transactions whose rollback did not complete.
+func (r *MinioRepository) ExecuteCompensations(ctx context.Context, tx *schema.Transaction) []error {
+	errs := make([]error, 0)
+	for i := len(tx.Compensations) - 1; i >= 0; i-- {
+		compensation := tx.Compensations[i]
+		if compensation.Executed {
+			continue
+		}
+		compensatorsMu.Lock()
+		compensator, ok := compensators[compensation.Compensator]
+		compensatorsMu.Unlock()
+		if !ok {
+			errs = append(errs, fmt.Errorf("ADB-0110 no compensator named %s is registered, so tx %s cannot be compensated", compensation.Compensator, tx.GetPath()))
+			continue
+		}
+		if err := compensator(ctx, r, tx, compensation.Args); err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0111 compensator %s failed during rollback of tx %s, %w", compensation.Compensator, tx.GetPath(), err))
+			continue
+		}
+		compensation.Executed = true
+		if err := r.updateTransaction(ctx, tx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,196 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the number of records that CreateIndex indexes per batch, unless configured otherwise
+const CREATE_INDEX_BATCH_SIZE = 100
+
+// configures CreateIndex
+type CreateIndexOptions struct {
+	// the number of records indexed with the same snapshot, or zero for CREATE_INDEX_BATCH_SIZE
+	BatchSize int
+
+	// the timeout of the read only transaction of each batch, or zero for schema.DefaultTimeout(). a batch ends early if it
+	// times out, so that no snapshot is held for longer, and the rest is indexed in the next one.
+	BatchTimeout time.Duration
+
+	// if set, called after each batch, e.g. to log how far the backfill has got
+	Progress func(IndexBackfillProgress)
+}
+
+// how far CreateIndex has got with the records which existed before the index. it is stored as a checkpoint after each batch,
+// so that a backfill which fails or is cancelled continues where it left off when it is run again.
+type IndexBackfillProgress struct {
+	Field string `json:"field"`
+	// records are processed in the order of their paths, so all records up to and including this one have been processed
+	LastId  string `json:"lastId"`
+	Batches int    `json:"batches"`
+	Indexed int    `json:"indexed"`
+	// records which were being written by transactions in progress, or failed, so that they are tried again at the end
+	Retry []string `json:"retry"`
+	// the number of records which were listed, but not yet processed, in this run
+	Pending int `json:"-"`
+	// set once all records have been processed and the checkpoint has been removed
+	Done bool `json:"-"`
+}
+
+// adds an index on the field to the table, registers the resulting definition in the schema registry, and backfills entries for
+// the records which already exist, in batches, without blocking writers. progress is reported to the index health, and
+// to the options.
+// records written while it runs are only indexed if they are written with a table which has the index, e.g. by code declaring
+// it with `Table.WithIndex`, or which reloads it from the schema registry, so deploy that first if the table is being written.
+// records that are being written by a transaction in progress when their batch is processed are tried again at the end.
+// if that still fails, or the context is cancelled, run it again, and it continues from its checkpoint.
+// Returns: the table with the index, which is complete if there is no error
+func CreateIndex[T any](ctx context.Context, repo *MinioRepository, table schema.Table, field string, options CreateIndexOptions) (schema.Table, error) {
+	table = table.WithIndex(field)
+	index, err := table.GetIndex(field)
+	if err != nil {
+		return table, err
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = CREATE_INDEX_BATCH_SIZE
+	}
+	if options.BatchTimeout <= 0 {
+		options.BatchTimeout = schema.DefaultTimeout()
+	}
+	if err := repo.RegisterTable(ctx, table); err != nil {
+		return table, err
+	}
+
+	progress, err := repo.readBackfillProgress(ctx, table, field)
+	if err != nil {
+		return table, err
+	}
+	ids := make([]string, 0, 100)
+	for id, err := range repo.listIdsAfter(ctx, table, progress.LastId) {
+		if err != nil {
+			return table, err
+		}
+		ids = append(ids, id)
+	}
+	progress.Pending = len(ids) + len(progress.Retry)
+	repo.startIndexHealth(index, progress.Pending)
+
+	var lastError error
+	backfill := func(ids []string, advance bool) error {
+		for len(ids) > 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			snapshot := schema.NewReadOnlyTransaction(options.BatchTimeout)
+			snapshot.Tenant = table.Tenant
+			transactionsInProgress, err := repo.getOtherTransactionsInProgress(ctx, &snapshot)
+			if err != nil {
+				return err
+			}
+			processed := 0
+			for processed < min(options.BatchSize, len(ids)) && (processed == 0 || !snapshot.IsExpired()) {
+				id := ids[processed]
+				indexed, inProgress, err := backfillIndexEntry[T](ctx, repo, &snapshot, table, index, id, transactionsInProgress)
+				repo.updateIndexHealth(index, id, err)
+				if err != nil {
+					lastError = err
+				}
+				if err != nil || inProgress {
+					progress.Retry = append(progress.Retry, id)
+				} else if indexed {
+					progress.Indexed++
+				}
+				if advance {
+					progress.LastId = id
+				}
+				processed++
+			}
+			ids = ids[processed:]
+			progress.Pending -= processed
+			progress.Batches++
+			checkpoint := progress
+			if !advance {
+				// those still to be retried, so that they are not lost if this run stops
+				checkpoint.Retry = append(slices.Clone(progress.Retry), ids...)
+			}
+			if err := repo.writeBackfillProgress(ctx, table, checkpoint); err != nil {
+				return err
+			}
+			if options.Progress != nil {
+				options.Progress(progress)
+			}
+		}
+		return nil
+	}
+	if err := backfill(ids, true); err != nil {
+		return table, err
+	}
+	// records that could not be indexed before, including those from a previous run, now that their transactions have had time
+	// to complete
+	retry := progress.Retry
+	progress.Retry = []string{}
+	progress.Pending = len(retry)
+	if err := backfill(retry, false); err != nil {
+		return table, err
+	}
+	if len(progress.Retry) > 0 {
+		cause := "they were being written by transactions in progress"
+		if lastError != nil {
+			cause = lastError.Error()
+		}
+		return table, fmt.Errorf("ADB-0136 backfill of new index %s could not index %d records, since %s. Run it again.", field, len(progress.Retry), cause)
+	}
+
+	if err := repo.Client.RemoveObject(ctx, repo.BucketName, table.BackfillPath(field), minio.RemoveObjectOptions{}); err != nil {
+		return table, fmt.Errorf("ADB-0329 failed to remove backfill checkpoint %s: %w", table.BackfillPath(field), err)
+	}
+	progress.Done = true
+	if options.Progress != nil {
+		options.Progress(progress)
+	}
+	return table, nil
+}
+
+// returns the checkpoint of the backfill of the new index, or an empty one if it has not started yet
+func (r *MinioRepository) readBackfillProgress(ctx context.Context, table schema.Table, field string) (IndexBackfillProgress, error) {
+	progress := IndexBackfillProgress{Field: field, Retry: []string{}}
+	path := table.BackfillPath(field)
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return progress, fmt.Errorf("ADB-0330 failed to get backfill checkpoint %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return progress, nil
+		}
+		return progress, fmt.Errorf("ADB-0331 failed to get backfill checkpoint %s: %w", path, err)
+	}
+	if err := json.Unmarshal(b, &progress); err != nil {
+		return progress, err
+	}
+	return progress, nil
+}
+
+func (r *MinioRepository) writeBackfillProgress(ctx context.Context, table schema.Table, progress IndexBackfillProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	path := table.BackfillPath(progress.Field)
+	_, err = r.Client.PutObject(ctx, r.BucketName, path, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("ADB-0332 failed to put backfill checkpoint %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the number of records that ScanWhenIndexUnavailable reads at most, if its limit is not positive
+const DEFAULT_INDEX_SCAN_LIMIT = 1000
+
+// what a query does when the index that it uses is unavailable, i.e. it is being backfilled, its last backfill had errors, or
+// VerifyIndex found that its entries do not match the records. see IndexHealth.Available.
+// availability is only known for indices maintained or verified by this process.
+type IndexUnavailablePolicy struct {
+	mode      string
+	scanLimit int
+}
+
+var (
+	// fails queries with IndexUnavailableError, favouring correctness. this is the default.
+	FailWhenIndexUnavailable = IndexUnavailablePolicy{mode: "fail"}
+
+	// uses whatever entries the index has, favouring availability. the results, which may be missing entities, are returned along
+	// with an IndexUnavailableErrorWithDetails whose Partial is true, so that callers can decide whether to use them.
+	PartialResultsWhenIndexUnavailable = IndexUnavailablePolicy{mode: "partial"}
+)
+
+// reads all records of the table instead of using the index, favouring availability and correctness over cost, as long as the
+// table has at most maxRecords records, including deleted ones which have not been garbage collected. larger tables fail with
+// IndexUnavailableError.
+func ScanWhenIndexUnavailable(maxRecords int) IndexUnavailablePolicy {
+	if maxRecords <= 0 {
+		maxRecords = DEFAULT_INDEX_SCAN_LIMIT
+	}
+	return IndexUnavailablePolicy{mode: "scan", scanLimit: maxRecords}
+}
+
+// sets the policy of all queries which do not set their own with WhereContainer.WhenIndexUnavailable
+func (r *MinioRepository) SetIndexUnavailablePolicy(policy IndexUnavailablePolicy) {
+	r.indexUnavailablePolicy = policy
+}
+
+// sets the policy of the query, overriding the one of the repository. see SetIndexUnavailablePolicy
+func (w WhereContainer[T]) WhenIndexUnavailable(policy IndexUnavailablePolicy) WhereContainer[T] {
+	w.whenIndexUnavailable = policy
+	return w
+}
+
+// true unless the index is being backfilled, its last backfill had errors, or it was found to be inconsistent
+func (h IndexHealth) Available() bool {
+	return h.Pending == 0 && h.Errors == 0 && !h.Inconsistent
+}
+
+// finds the entities using the coordinates that lookup reads from the index, unless the index is unavailable, in which case the
+// policy of the query, or else of the repository, decides what happens
+func findUsingIndex[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, table schema.Table, index *schema.Index, policy IndexUnavailablePolicy, predicate func(*T) (bool, error), lookup func(*[]schema.DatabaseTableIdTuple) error, destination *[]*T) (*map[string]*string, error) {
+	if index.Filter != nil {
+		// entries can be stale, so the entities that are read are checked against the filter, as they are against the predicate
+		matches := predicate
+		predicate = func(t *T) (bool, error) {
+			if indexed, err := isIndexed(index, t); err != nil || !indexed {
+				return false, err
+			}
+			return matches(t)
+		}
+	}
+	coordinates := make([]schema.DatabaseTableIdTuple, 0, 10)
+	health, known := repo.GetIndexHealth(table, index.Field, index.Revision)
+	if !known || health.Available() {
+		if err := lookup(&coordinates); err != nil {
+			return nil, err
+		}
+		return find(ctx, repo, tx, table, predicate, coordinates, destination)
+	}
+
+	if policy == (IndexUnavailablePolicy{}) {
+		policy = repo.indexUnavailablePolicy
+	}
+	unavailable := &IndexUnavailableErrorWithDetails{
+		Details: fmt.Sprintf("ADB-0126 the index %s revision %d of table %s/%s is unavailable, with %d records pending, %d errors and inconsistent %t",
+			index.Field, index.Revision, table.Database, table.Name, health.Pending, health.Errors, health.Inconsistent),
+		Health: health,
+	}
+	switch policy.mode {
+	case "scan":
+		for id, err := range repo.listIds(ctx, table) {
+			if err != nil {
+				return nil, err
+			}
+			if len(coordinates) == policy.scanLimit {
+				unavailable.Details += fmt.Sprintf(", and the table has more than the %d records that may be scanned", policy.scanLimit)
+				return nil, unavailable
+			}
+			coordinates = append(coordinates, schema.DatabaseTableIdTuple{Database: string(table.Database), Table: table.Name, Id: id})
+		}
+		// the predicate selects the entities, as it does with the index
+		return find(ctx, repo, tx, table, predicate, coordinates, destination)
+	case "partial":
+		if err := lookup(&coordinates); err != nil {
+			return nil, err
+		}
+		etags, err := find(ctx, repo, tx, table, predicate, coordinates, destination)
+		if err != nil {
+			return nil, err
+		}
+		unavailable.Partial = true
+		return etags, unavailable
+	default:
+		return nil, unavailable
+	}
+}
@@ -0,0 +1,216 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the number of index entries that DropIndex removes per request, which is the most that the bucket accepts
+const DROP_INDEX_BATCH_SIZE = 1000
+
+// what DropIndex removed
+type DroppedIndex struct {
+	// the number of records whose reverse indices referred to the index, and were updated
+	Records int
+	// the number of entries and claims that were removed, including all of their versions
+	Entries int
+}
+
+// removes the index on the field from the table, including all of its revisions, registers the resulting definition in the
+// schema registry, removes the index from the reverse indices of the records, and finally deletes its entries, and the claims
+// if it is unique, in batches. deploy code which no longer declares the index first, since transactions using a table which
+// still has it keep writing entries. records being written by a transaction in progress keep the index in their reverse
+// indices, which is harmless, since the entries are removed when they are next updated, but run it again, once they have
+// completed, so that nothing is left behind.
+// Returns: the table without the index, and what was removed
+func (r *MinioRepository) DropIndex(ctx context.Context, table schema.Table, field string) (schema.Table, DroppedIndex, error) {
+	dropped := DroppedIndex{}
+	prefixes := make([]string, 0, 2)
+	indices := []schema.Index{{Table: table, Field: field}}
+	for _, index := range table.Indices {
+		if index.Field == field && index.Revision > 0 {
+			indices = append(indices, index)
+		}
+	}
+	for _, index := range indices {
+		prefixes = append(prefixes, index.PathPrefix()+"/", index.UniquePathPrefix()+"/")
+	}
+	table = table.WithoutIndex(field)
+	if err := r.RegisterTable(ctx, table); err != nil {
+		return table, dropped, err
+	}
+
+	transactionsInProgress, err := r.getOtherTransactionsInProgress(ctx, &schema.Transaction{Tenant: table.Tenant})
+	if err != nil {
+		return table, dropped, err
+	}
+	inProgress := 0
+	for id, err := range r.listIds(ctx, table) {
+		if err != nil {
+			return table, dropped, err
+		}
+		updated, err := r.removeFromReverseIndices(ctx, table, id, func(indexPath string) bool { return hasAnyPrefix(indexPath, prefixes) }, transactionsInProgress)
+		if err != nil {
+			if !errors.Is(err, StaleObjectError) {
+				return table, dropped, err
+			}
+			inProgress++
+		} else if updated {
+			dropped.Records++
+		}
+	}
+
+	for _, prefix := range prefixes {
+		count, err := r.removeAllVersionsInBatches(ctx, prefix, DROP_INDEX_BATCH_SIZE)
+		dropped.Entries += count
+		if err != nil {
+			return table, dropped, err
+		}
+	}
+	for _, path := range []string{table.ReindexPath(field), table.BackfillPath(field)} {
+		if err := r.Client.RemoveObject(ctx, r.BucketName, path, minio.RemoveObjectOptions{}); err != nil {
+			return table, dropped, fmt.Errorf("ADB-0140 failed to remove %s: %w", path, err)
+		}
+	}
+	if inProgress > 0 {
+		return table, dropped, fmt.Errorf("ADB-0140 the reverse indices of %d records still refer to index %s, since they were being written by transactions in progress. Run it again.", inProgress, field)
+	}
+	return table, dropped, nil
+}
+
+// removes the paths for which remove returns true from the reverse indices of the record. returns false if there were none, and a
+// StaleObjectError if the record is being written by a transaction in progress, or its reverse indices were modified concurrently
+func (r *MinioRepository) removeFromReverseIndices(ctx context.Context, table schema.Table, id string, remove func(indexPath string) bool, transactionsInProgress map[string]uint64) (bool, error) {
+	indicesPath := table.IndicesPath(id)
+	object, err := r.Client.GetObject(ctx, r.BucketName, indicesPath, minio.GetObjectOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer object.Close()
+	info, err := object.Stat()
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("ADB-0056 failed to read reverse indices %s: %w", indicesPath, err)
+	}
+	if _, ok := transactionsInProgress[info.UserMetadata[schema.TX_ID]]; ok {
+		return false, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("reverse indices %s are being written by tx %s", indicesPath, info.UserMetadata[schema.TX_ID])}
+	}
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return false, fmt.Errorf("ADB-0056 failed to read reverse indices %s: %w", indicesPath, err)
+	}
+	if len(b) == 0 {
+		// deleted
+		return false, nil
+	}
+	var existingIndicesAsString string
+	if err := json.Unmarshal(b, &existingIndicesAsString); err != nil {
+		return false, err
+	}
+	existingIndices := strings.Split(strings.TrimSpace(existingIndicesAsString), "\n")
+	remaining := make([]string, 0, len(existingIndices))
+	for _, indexPath := range existingIndices {
+		if !remove(indexPath) {
+			remaining = append(remaining, indexPath)
+		}
+	}
+	if len(remaining) == len(existingIndices) {
+		return false, nil
+	}
+
+	indicesData, err := json.Marshal(strings.Join(remaining, "\n"))
+	if err != nil {
+		return false, err
+	}
+	opts := minio.PutObjectOptions{ContentType: "text/plain", UserMetadata: map[string]string{
+		schema.TX_ID:              INDEX_MAINTENANCE_TX_ID,
+		schema.LAST_MODIFIED:      fmt.Sprintf("%d", schema.Now().UnixMicro()),
+		schema.FORMAT_VERSION_KEY: formatVersionStamp,
+	}}
+	opts.SetMatchETag(info.ETag)
+	_, err = r.Client.PutObject(ctx, r.BucketName, indicesPath, bytes.NewReader(indicesData), int64(len(indicesData)), opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+			return false, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("reverse indices %s were modified concurrently. Run again.", indicesPath)}
+		}
+		return false, fmt.Errorf("ADB-0058 failed to put reverse indices %s: %w", indicesPath, err)
+	}
+	return true, nil
+}
+
+// removes all versions of all objects under the prefix, listing and removing at most batchSize at a time, so that neither the
+// listing nor the removal is held in memory as a whole
+// Returns: the number of object versions that were removed
+func (r *MinioRepository) removeAllVersionsInBatches(ctx context.Context, prefix string, batchSize int) (int, error) {
+	return r.removeAllVersionsInBatchesWhere(ctx, prefix, batchSize, func(string) bool { return true })
+}
+
+// like removeAllVersionsInBatches, but only removes the versions of objects whose paths the filter returns true for
+func (r *MinioRepository) removeAllVersionsInBatchesWhere(ctx context.Context, prefix string, batchSize int, filter func(path string) bool) (int, error) {
+	return r.removeVersionsInBatches(ctx, prefix, batchSize, func(object minio.ObjectInfo) bool { return filter(object.Key) })
+}
+
+// like removeAllVersionsInBatches, but only removes the versions that the filter returns true for
+func (r *MinioRepository) removeVersionsInBatches(ctx context.Context, prefix string, batchSize int, filter func(object minio.ObjectInfo) bool) (int, error) {
+	count := 0
+	batch := make([]minio.ObjectInfo, 0, batchSize)
+	remove := func() error {
+		objects := make(chan minio.ObjectInfo, len(batch))
+		for _, object := range batch {
+			objects <- object
+		}
+		close(objects)
+		var err error
+		for e := range r.Client.RemoveObjects(ctx, r.BucketName, objects, minio.RemoveObjectsOptions{GovernanceBypass: true}) {
+			if err == nil {
+				err = fmt.Errorf("ADB-0140 failed to remove %s: %w", e.ObjectName, e.Err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithVersions: true}) {
+		if object.Err != nil {
+			return count, object.Err
+		}
+		if !filter(object) {
+			continue
+		}
+		batch = append(batch, object)
+		if len(batch) == batchSize {
+			if err := remove(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := remove(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
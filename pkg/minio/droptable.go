@@ -0,0 +1,113 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the number of objects that DropTable and TruncateTable remove per request, which is the most that the bucket accepts
+const DROP_TABLE_BATCH_SIZE = 1000
+
+// returns the token with which DropTable and TruncateTable confirm that they remove the table as it is now, i.e. the path of the
+// table and its generation, e.g. `bank/accounts@8c2f...`, so that a table is neither removed by mistake, because the token names
+// another, nor once it has been written since, e.g. by a service which was thought to no longer use it. the token stays valid
+// until the table is written, so an operation which failed part way is continued by running it again with the same token.
+func (r *MinioRepository) ConfirmationToken(ctx context.Context, table schema.Table) (string, error) {
+	generation, _, err := r.getTableGeneration(ctx, table)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(table.Folder(), "/") + "@" + generation, nil
+}
+
+// fails with an InvalidConfirmationTokenError if the token is not one for the table, and with a StaleObjectError if the table
+// was written since it was created
+func (r *MinioRepository) checkConfirmationToken(ctx context.Context, table schema.Table, token string) error {
+	name, tokenGeneration, found := strings.Cut(token, "@")
+	if !found || name != strings.TrimSuffix(table.Folder(), "/") {
+		return &InvalidConfirmationTokenErrorWithDetails{Details: fmt.Sprintf("ADB-0164 the token %s does not confirm table %s/%s, see ConfirmationToken", token, table.Database, table.Name), Token: token}
+	}
+	generation, _, err := r.getTableGeneration(ctx, table)
+	if err != nil {
+		return err
+	}
+	if generation != tokenGeneration {
+		return &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("table %s/%s was written since the token %s was created", table.Database, table.Name, token)}
+	}
+	return nil
+}
+
+// removes all records of the table, including all of their versions, the entries of its indices and the claims of its unique
+// indices, their reverse indices and attachments, in batches, and keeps its definition in the schema registry and its lease, so
+// that the table can be written again straight away. the generation of the table is written last, so that cached queries are
+// invalidated, and the token is no longer valid. run it while nothing writes to the table, since objects written by transactions
+// which are in progress are left behind. the records which the table has in other tables, e.g. its outbox or journal, are kept.
+// Returns: the number of object versions that were removed
+func (r *MinioRepository) TruncateTable(ctx context.Context, table schema.Table, token string) (int, error) {
+	if err := r.checkConfirmationToken(ctx, table, token); err != nil {
+		return 0, err
+	}
+	keep := []string{table.GenerationPath(), table.LeasePath()}
+	count, err := r.removeTable(ctx, table, func(path string) bool { return !hasAnyPrefix(path, keep) })
+	if err != nil {
+		return count, err
+	}
+	contents := []byte(fmt.Sprintf("truncated by %s", token))
+	if _, err := r.Client.PutObject(ctx, r.BucketName, table.GenerationPath(), bytes.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{ContentType: "text/plain"}); err != nil {
+		return count, fmt.Errorf("ADB-0038 Failed to put table generation at path %s, %w", table.GenerationPath(), err)
+	}
+	return count, nil
+}
+
+// removes everything that is stored about the table, like TruncateTable, together with its lease and generation, and finally all
+// versions of its definition in the schema registry, so that it is no longer listed or resolved. deploy code which no longer
+// uses the table first. aliases which point to it are kept, see ResolveTable. the definition of a table of a tenant is kept, since
+// it is registered once for all tenants, so that only the objects of the tenant are removed.
+// Returns: the number of object versions that were removed
+func (r *MinioRepository) DropTable(ctx context.Context, table schema.Table, token string) (int, error) {
+	if err := r.checkConfirmationToken(ctx, table, token); err != nil {
+		return 0, err
+	}
+	// the generation goes last, since the token is valid until it changes, so that a drop which failed can be run again
+	count, err := r.removeTable(ctx, table, func(path string) bool { return path != table.GenerationPath() })
+	if err != nil {
+		return count, err
+	}
+	prefixes := []string{table.GenerationPath()}
+	if table.Tenant == schema.DEFAULT_TENANT {
+		prefixes = append(prefixes, table.SchemaPath())
+	}
+	for _, prefix := range prefixes {
+		removed, err := r.removeAllVersionsInBatches(ctx, prefix, DROP_TABLE_BATCH_SIZE)
+		count += removed
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// removes all versions of the records of the table, and of the objects below its folder, see schema.Table.Folder, for which remove returns true,
+// in that order
+func (r *MinioRepository) removeTable(ctx context.Context, table schema.Table, remove func(path string) bool) (int, error) {
+	folder := table.Folder()
+	count := 0
+	if dataPrefix := table.DataPathPrefix(); !strings.HasPrefix(dataPrefix, folder) {
+		// the records of a table with a path template, which may share their folder with other objects
+		removed, err := r.removeAllVersionsInBatchesWhere(ctx, dataPrefix, DROP_TABLE_BATCH_SIZE, func(path string) bool {
+			_, ok := table.IdFromPath(path)
+			return ok
+		})
+		count += removed
+		if err != nil {
+			return count, err
+		}
+	}
+	removed, err := r.removeAllVersionsInBatchesWhere(ctx, folder, DROP_TABLE_BATCH_SIZE, remove)
+	return count + removed, err
+}
@@ -0,0 +1,64 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// temporary objects of a transaction are stored at `ephemeral/<txId>/<name>`
+const EPHEMERAL_ROOT = "ephemeral/"
+
+// writes a temporary object, e.g. a large intermediate artifact which is staged while the transaction prepares its changes.
+// it is removed when the transaction is committed or rolled back, including when a transaction that was abandoned is rolled
+// back during recovery, since it is recorded as a step. writing the same name again replaces it.
+// returns the path of the object.
+func (r *MinioRepository) PutEphemeral(ctx context.Context, tx *schema.Transaction, name string, contentType string, data []byte) (string, error) {
+	path := ephemeralPrefix(tx) + name
+	if err := tx.AddEphemeralStep(contentType, path, data); err != nil {
+		return "", err
+	}
+	// persisted first, so that the object is removed even if this process fails before the transaction is completed
+	if err := r.updateTransaction(ctx, tx); err != nil {
+		return "", err
+	}
+	if _, err := r.executeTransactionSteps(ctx, tx, "", -1); err != nil {
+		return "", err
+	}
+	if err := r.updateTransaction(ctx, tx); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// reads a temporary object written by the transaction with PutEphemeral
+func (r *MinioRepository) GetEphemeral(ctx context.Context, tx *schema.Transaction, name string) ([]byte, error) {
+	if err := tx.IsOk(); err != nil {
+		return nil, err
+	}
+	path := ephemeralPrefix(tx) + name
+	index := slices.IndexFunc(tx.Steps, func(step *schema.TransactionStep) bool {
+		return step.Type == schema.STEP_EPHEMERAL && step.Path == path && step.Executed
+	})
+	if index < 0 {
+		return nil, fmt.Errorf("ADB-0115 tx %s has no ephemeral object named %s", tx.Id, name)
+	}
+	return r.readVersion(ctx, path, nil)
+}
+
+func ephemeralPrefix(tx *schema.Transaction) string {
+	return EPHEMERAL_ROOT + tx.Id + "/"
+}
+
+// removes the temporary objects of the transaction, including all of their versions, once it has been committed or rolled back
+func (r *MinioRepository) releaseEphemerals(ctx context.Context, tx *schema.Transaction) error {
+	if !slices.ContainsFunc(tx.Steps, func(step *schema.TransactionStep) bool { return step.Type == schema.STEP_EPHEMERAL }) {
+		return nil
+	}
+	if err := r.DeleteFolder(ctx, ephemeralPrefix(tx), true, true); err != nil {
+		return fmt.Errorf("ADB-0116 failed to remove the ephemeral objects of tx %s: %w", tx.Id, err)
+	}
+	return nil
+}
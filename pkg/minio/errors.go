@@ -2,6 +2,8 @@ package minio
 
 import (
 	"fmt"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
 )
 
 // ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -76,6 +78,8 @@ type ObjectLockedErrorWithDetails[T any] struct {
 	Details string
 	Object  T
 	DueByMsEpoch   uint64
+	// the transaction which has written the object
+	TransactionId string
 }
 
 func (e *ObjectLockedErrorWithDetails[T]) Error() string {
@@ -90,3 +94,283 @@ func (e *ObjectLockedErrorWithDetails[T]) Unwrap() error {
 	return ObjectLockedError
 }
 
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Schema Incompatible Error - means that the table definitions in the code are incompatible with those in the schema
+// registry, e.g. because a different service has changed them.
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var SchemaIncompatibleError = fmt.Errorf("schema is incompatible")
+
+type SchemaIncompatibleErrorWithDetails struct {
+	Details string
+	Problems []string
+}
+
+func (e *SchemaIncompatibleErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *SchemaIncompatibleErrorWithDetails) Unwrap() error {
+	return SchemaIncompatibleError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Lease Not Held Error - means that the table may only be written to by a single process, and this process does not
+// hold the lease, either because it never acquired it, it expired, or another process holds it.
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var LeaseNotHeldError = fmt.Errorf("lease is not held")
+
+type LeaseNotHeldErrorWithDetails struct {
+	Details string
+	Owner   string
+	ExpiresMicros int64
+}
+
+func (e *LeaseNotHeldErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *LeaseNotHeldErrorWithDetails) Unwrap() error {
+	return LeaseNotHeldError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Unique Violation Error - means that a different entity already has the value of a unique index, or that a different
+// transaction which is still in progress is writing an entity with that value.
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var UniqueViolationError = fmt.Errorf("unique index violated")
+
+type UniqueViolationErrorWithDetails struct {
+	Details string
+	// of the index entry, or claim, of the value that already exists
+	Path string
+}
+
+func (e *UniqueViolationErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *UniqueViolationErrorWithDetails) Unwrap() error {
+	return UniqueViolationError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Index Unavailable Error - means that a query could not use an index, because it is being backfilled, its last backfill
+// had errors, or it was found to be inconsistent. see IndexUnavailablePolicy
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var IndexUnavailableError = fmt.Errorf("index unavailable")
+
+type IndexUnavailableErrorWithDetails struct {
+	Details string
+	Health  IndexHealth
+	// true if the results that were returned along with the error are those that the index has, and so may be incomplete
+	Partial bool
+}
+
+func (e *IndexUnavailableErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *IndexUnavailableErrorWithDetails) Unwrap() error {
+	return IndexUnavailableError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Upload Offset Mismatch Error - means that a chunk of an upload was sent for a different offset than the one that the upload
+// has reached, e.g. because an earlier attempt to send it succeeded after all. see UploadSession
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var UploadOffsetMismatchError = fmt.Errorf("upload offset mismatch")
+
+type UploadOffsetMismatchErrorWithDetails struct {
+	Details string
+	// the offset that the upload has reached, from which the client should continue
+	Offset int64
+}
+
+func (e *UploadOffsetMismatchErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *UploadOffsetMismatchErrorWithDetails) Unwrap() error {
+	return UploadOffsetMismatchError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Unsupported Capability Error - means that a feature relies on something that the backend does not support, e.g. S3 Select
+// or object lock. see Capabilities
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var UnsupportedCapabilityError = fmt.Errorf("capability is not supported")
+
+type UnsupportedCapabilityErrorWithDetails struct {
+	Details string
+	// e.g. CAPABILITY_SELECT
+	Capability string
+}
+
+func (e *UnsupportedCapabilityErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *UnsupportedCapabilityErrorWithDetails) Unwrap() error {
+	return UnsupportedCapabilityError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Format Too New Error - means that an object was written by a newer version of the library, in a format that this version
+// cannot read correctly, e.g. during a rolling upgrade. see schema.FORMAT_VERSION
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var FormatTooNewError = fmt.Errorf("format is too new")
+
+type FormatTooNewErrorWithDetails struct {
+	Details string
+	Path    string
+	// the version that the object was written in
+	FormatVersion int
+}
+
+func (e *FormatTooNewErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *FormatTooNewErrorWithDetails) Unwrap() error {
+	return FormatTooNewError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Decimal Constraint Error - means that an entity was not written, because a decimal field has more digits than its
+// precision or scale permit, or is not a decimal. see schema.Table.WithDecimalField
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var DecimalConstraintError = fmt.Errorf("decimal constraint violated")
+
+type DecimalConstraintErrorWithDetails struct {
+	Details    string
+	Constraint schema.DecimalField
+	// the value of the field, as it is formatted
+	Value string
+}
+
+func (e *DecimalConstraintErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *DecimalConstraintErrorWithDetails) Unwrap() error {
+	return DecimalConstraintError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Enum Constraint Error - means that an entity was not written, because an enum field has a value which it does not permit.
+// see schema.Table.WithEnumField
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var EnumConstraintError = fmt.Errorf("enum constraint violated")
+
+type EnumConstraintErrorWithDetails struct {
+	Details string
+	Enum    schema.EnumField
+	// the value of the field which is not permitted
+	Value string
+}
+
+func (e *EnumConstraintErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *EnumConstraintErrorWithDetails) Unwrap() error {
+	return EnumConstraintError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Invalid Sync Token Error - means that a replica pulled changes since a token which was not returned by PullChanges.
+// see SyncPull
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var InvalidSyncTokenError = fmt.Errorf("invalid sync token")
+
+type InvalidSyncTokenErrorWithDetails struct {
+	Details string
+	Token   string
+}
+
+func (e *InvalidSyncTokenErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *InvalidSyncTokenErrorWithDetails) Unwrap() error {
+	return InvalidSyncTokenError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Invalid Bundle Error - means that a bundle could not be read, because it was changed, cut short, or is not signed or
+// encrypted with the expected key. see VerifyBundle
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var InvalidBundleError = fmt.Errorf("invalid bundle")
+
+type InvalidBundleErrorWithDetails struct {
+	Details string
+}
+
+func (e *InvalidBundleErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *InvalidBundleErrorWithDetails) Unwrap() error {
+	return InvalidBundleError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Referenced Error - means that an entity could not be deleted, because the entities of another table reference it with
+// a foreign key whose action is schema.ON_DELETE_RESTRICT. see EnableForeignKeys
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var ReferencedError = fmt.Errorf("entity is referenced")
+
+type ReferencedErrorWithDetails struct {
+	Details string
+	// the table and field of the entities which reference the entity, and their ids
+	Table schema.Table
+	Field string
+	Ids   []string
+}
+
+func (e *ReferencedErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *ReferencedErrorWithDetails) Unwrap() error {
+	return ReferencedError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Invalid Confirmation Token Error - means that a table could not be dropped or truncated, because the token which
+// should confirm it was created for another table, or not at all. see ConfirmationToken
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var InvalidConfirmationTokenError = fmt.Errorf("invalid confirmation token")
+
+type InvalidConfirmationTokenErrorWithDetails struct {
+	Details string
+	Token   string
+}
+
+func (e *InvalidConfirmationTokenErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *InvalidConfirmationTokenErrorWithDetails) Unwrap() error {
+	return InvalidConfirmationTokenError
+}
+
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Pinned Error - means that a record could not be updated or deleted, because it is pinned, and the transaction does not
+// override pins. see Pin
+// ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+var PinnedError = fmt.Errorf("record is pinned")
+
+type PinnedErrorWithDetails struct {
+	Details string
+	Pin     Pin
+}
+
+func (e *PinnedErrorWithDetails) Error() string {
+	return e.Details
+}
+
+func (e *PinnedErrorWithDetails) Unwrap() error {
+	return PinnedError
+}
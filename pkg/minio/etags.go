@@ -0,0 +1,80 @@
+package minio
+
+import (
+	"fmt"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/internal/util"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// returns the ETags of the records which the value selects, by their ids, as they are in the snapshot of the transaction,
+// without reading the records, e.g. so that a client which holds copies of them only reads those which changed, with a
+// conditional GET. the ETags are those that the entries of the index were written with, which they are whenever their record
+// is written, if the index carries them, see schema.Table.WithRecordETags, and fails with ADB-0233 otherwise. it is nil for
+// records whose ETag the entries do not know, e.g. entries that were written before the ETags were, or by a backfill, and
+// records which the transaction itself wrote, which must be read to be sure.
+// like the entries, the ETags may be stale, so that a record whose ETag differs must still be read, and checked against the
+// value, as Find does.
+func (f FindByIndexedFieldEqualsContainer[T]) FindETags() (map[string]*string, error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return nil, err
+	}
+	if !index.RecordETags {
+		return nil, fmt.Errorf("ADB-0233 the entries of index %s do not carry the ETags of their records. see schema.Table.WithRecordETags", f.fieldName)
+	}
+	value, err := getIndexLookupValue(index, f.value)
+	if err != nil {
+		return nil, err
+	}
+	var paths *util.MutList[string]
+	var recordETags map[string]string
+	if f.value == "" {
+		if index.Sparse {
+			return nil, sparseIndexError(index)
+		}
+		// empty values are indexed as null
+		paths, recordETags, err = f.repo.selectNullIndexEntries(f.ctx, f.tx, index)
+	} else {
+		paths, recordETags, err = f.repo.selectIndexEntriesBetween(f.ctx, f.tx, index.PathNoId(value), "", "", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	etags := make(map[string]*string, paths.Len())
+	for _, path := range paths.Items() {
+		entry, err := index.EntryFromPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, written := f.tx.Cache[path]; written {
+			etags[entry.Id] = nil
+		} else if etag, ok := recordETags[path]; ok {
+			etags[entry.Id] = &etag
+		} else {
+			etags[entry.Id] = nil
+		}
+	}
+	return etags, nil
+}
+
+// returns the metadata of the step which writes an index entry, with the ETag of its record, i.e. that of the last step before
+// it which wrote the record, since the steps of an entity write it before its entries
+func withRecordETag(transaction *schema.Transaction, stepIndex int, metadata map[string]string) map[string]string {
+	for i := stepIndex - 1; i >= 0; i-- {
+		step := transaction.Steps[i]
+		if step.Type != schema.STEP_INSERT_DATA && step.Type != schema.STEP_UPDATE_DATA {
+			continue
+		}
+		if step.FinalETag == nil {
+			return metadata
+		}
+		withETag := make(map[string]string, len(metadata)+1)
+		for key, value := range metadata {
+			withETag[key] = value
+		}
+		withETag[schema.RECORD_ETAG] = *step.FinalETag
+		return withETag
+	}
+	return metadata
+}
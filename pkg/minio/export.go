@@ -0,0 +1,53 @@
+package minio
+
+import (
+	"context"
+	"iter"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the number of objects that ExportTable reads at a time
+const EXPORT_PAGE_SIZE = 100
+
+// iterates over all objects of the table which exist within the transaction, e.g. for exporting them, reading them in pages with
+// GetMany, so that they all come from the same snapshot. objects are added to the cache of the transaction like any others, so
+// large tables are exported with a read-only transaction whose cache is bypassed, see schema.Transaction.BypassCache, or with
+// CacheLimits, e.g. with spilling.
+// the order is that of the ids, as listed by the object store.
+func ExportTable[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, table schema.Table) iter.Seq2[GetManyResult[T], error] {
+	return func(yield func(GetManyResult[T], error) bool) {
+		page := make([]string, 0, EXPORT_PAGE_SIZE)
+		flush := func() bool {
+			results, err := GetMany[T](ctx, repo, tx, page...)
+			if err != nil {
+				yield(GetManyResult[T]{}, err)
+				return false
+			}
+			page = page[:0]
+			for _, result := range results {
+				if result.Object == nil {
+					// deleted, or written by a transaction in progress
+					continue
+				}
+				if !yield(result, nil) {
+					return false
+				}
+			}
+			return true
+		}
+		for id, err := range repo.listIds(ctx, table) {
+			if err != nil {
+				yield(GetManyResult[T]{}, err)
+				return
+			}
+			page = append(page, table.Path(id))
+			if len(page) == EXPORT_PAGE_SIZE && !flush() {
+				return
+			}
+		}
+		if len(page) > 0 {
+			flush()
+		}
+	}
+}
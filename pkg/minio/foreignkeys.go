@@ -0,0 +1,120 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// a foreign key of a table whose entities are of a type that is known, so that they can be read and written when an entity that
+// they reference is deleted
+type reference struct {
+	table      schema.Table
+	foreignKey schema.ForeignKey
+	// does what the foreign key says with the entities which reference the id, within the transaction
+	onDelete func(ctx context.Context, repo *MinioRepository, tx *schema.Transaction, id string) error
+}
+
+// enables the foreign keys of the table, whose entities are of type T, so that deleting an entity which they reference, with
+// DeleteFromTable, does what they say with the entities of the table which reference it, within the same transaction, i.e. fails
+// with a ReferencedError, deletes them too, or sets their field to null. see schema.Table.WithForeignKey. enabling the table
+// again replaces its foreign keys. all processes deleting from the referenced tables should enable them, since references are
+// only followed by repositories which know about them. panics if T is not a struct, e.g. a map, a field is missing from T, or a
+// field whose references are set to null is neither a string nor a pointer, since tables are declared by code.
+func EnableForeignKeys[T any](repo *MinioRepository, table schema.Table) {
+	entityType := reflect.TypeFor[T]()
+	if entityType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("ADB-0261 the foreign keys of table %s/%s cannot be enabled for entities of type %s, since it is not a struct", table.Database, table.Name, entityType))
+	}
+	for _, foreignKey := range table.ForeignKeys {
+		field, ok := entityType.FieldByName(foreignKey.Field)
+		if !ok {
+			panic(fmt.Sprintf("ADB-0235 the field %s of foreign key of table %s/%s does not exist in %s", foreignKey.Field, table.Database, table.Name, entityType))
+		}
+		if foreignKey.OnDelete == schema.ON_DELETE_SET_NULL && field.Type.Kind() != reflect.String && field.Type.Kind() != reflect.Ptr {
+			panic(fmt.Sprintf("ADB-0236 the field %s of table %s/%s cannot be set to null, since it is a %s", foreignKey.Field, table.Database, table.Name, field.Type))
+		}
+	}
+
+	repo.referencesMu.Lock()
+	defer repo.referencesMu.Unlock()
+	for key, references := range repo.references {
+		repo.references[key] = slices.DeleteFunc(references, func(r reference) bool {
+			return r.table.Database == table.Database && r.table.Name == table.Name
+		})
+	}
+	for _, foreignKey := range table.ForeignKeys {
+		key := string(foreignKey.Database) + "/" + foreignKey.Table
+		repo.references[key] = append(repo.references[key], reference{table, foreignKey, onDeleteReferenced[T](table, foreignKey)})
+	}
+}
+
+// returns the foreign keys which reference the table, and which are enabled
+func (r *MinioRepository) getReferences(table schema.Table) []reference {
+	r.referencesMu.Lock()
+	defer r.referencesMu.Unlock()
+	return slices.Clone(r.references[string(table.Database)+"/"+table.Name])
+}
+
+// does what the enabled foreign keys say with the entities which reference the entity of the table that is being deleted
+func (r *MinioRepository) deleteReferences(ctx context.Context, transaction *schema.Transaction, table schema.Table, id string) error {
+	for _, reference := range r.getReferences(table) {
+		if err := reference.onDelete(ctx, r, transaction, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func onDeleteReferenced[T any](table schema.Table, foreignKey schema.ForeignKey) func(ctx context.Context, repo *MinioRepository, tx *schema.Transaction, id string) error {
+	return func(ctx context.Context, repo *MinioRepository, tx *schema.Transaction, id string) error {
+		table := table
+		if table.Tenant != tx.Tenant && !table.IsAdopted() {
+			// the entities of a tenant only reference those of the same tenant
+			table = table.WithTenant(tx.Tenant)
+		}
+		var found []*T
+		etags, err := NewTypedQuery[T](repo, ctx, tx).SelectFromTable(table).WhereIndexedFieldEquals(foreignKey.Field, id).Find(&found)
+		if err != nil {
+			return err
+		}
+		// those which the transaction is already deleting, e.g. the entity itself, if it references itself, are skipped
+		referencing := make([]*T, 0, len(found))
+		ids := make([]string, 0, len(found))
+		for _, entity := range found {
+			entityId, err := entityId(table, entity)
+			if err != nil {
+				return err
+			}
+			if !tx.IsDeleting(table.Path(entityId)) {
+				referencing = append(referencing, entity)
+				ids = append(ids, entityId)
+			}
+		}
+		switch foreignKey.OnDelete {
+		case schema.ON_DELETE_RESTRICT:
+			if len(referencing) > 0 {
+				details := fmt.Sprintf("ADB-0237 the entity %s of table %s/%s cannot be deleted, since %d entities of table %s/%s reference it with field %s", id, foreignKey.Database, foreignKey.Table, len(ids), table.Database, table.Name, foreignKey.Field)
+				return &ReferencedErrorWithDetails{Details: details, Table: table, Field: foreignKey.Field, Ids: ids}
+			}
+		case schema.ON_DELETE_CASCADE:
+			for i, entity := range referencing {
+				if err := repo.DeleteFromTable(ctx, tx, table, entity, (*etags)[ids[i]]); err != nil {
+					return err
+				}
+			}
+		case schema.ON_DELETE_SET_NULL:
+			for i, entity := range referencing {
+				field := reflect.ValueOf(entity).Elem().FieldByName(foreignKey.Field)
+				field.Set(reflect.Zero(field.Type()))
+				if _, err := repo.UpdateTable(ctx, tx, table, entity, (*etags)[ids[i]]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
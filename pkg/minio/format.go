@@ -0,0 +1,51 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the stamp of the format that this version writes, see schema.OBJECT_FORMAT_VERSION
+var formatVersionStamp = strconv.Itoa(schema.OBJECT_FORMAT_VERSION)
+
+// returns a FormatTooNewError if the object at the path was written in a newer format than this version can read. unstamped
+// objects were written before formats were versioned, and are compatible
+func checkFormatVersion(path string, stamp string) error {
+	if stamp == "" {
+		return nil
+	}
+	version, err := strconv.Atoi(stamp)
+	if err != nil {
+		return fmt.Errorf("ADB-0146 invalid format version %s of %s", stamp, path)
+	}
+	return checkFormatVersionNumber(path, version)
+}
+
+func checkFormatVersionNumber(path string, version int) error {
+	if version > schema.FORMAT_VERSION {
+		return &FormatTooNewErrorWithDetails{
+			Details:       fmt.Sprintf("ADB-0146 %s was written in format version %d, but this version of the library only supports up to %d. Upgrade this node.", path, version, schema.FORMAT_VERSION),
+			Path:          path,
+			FormatVersion: version,
+		}
+	}
+	return nil
+}
+
+// returns a FormatTooNewError if the current version of the object at the path was written in a newer format, so that it is not
+// overwritten by a node which would lose what it cannot read. objects which do not exist may be written
+func (r *MinioRepository) checkFormatVersionOfObject(ctx context.Context, path string) error {
+	info, err := r.Client.StatObject(ctx, r.BucketName, path, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("ADB-0232 failed to check the format version of %s: %w", path, err)
+	}
+	return checkFormatVersion(path, info.UserMetadata[schema.FORMAT_VERSION_KEY])
+}
@@ -0,0 +1,219 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the kinds of inconsistencies that VerifyTable reports
+const (
+	// an entry or claim which no record requires, e.g. because the record no longer exists
+	INDEX_ISSUE_DANGLING_ENTRY = "dangling-entry"
+	// an entry or claim which a record requires, but which does not exist
+	INDEX_ISSUE_MISSING_ENTRY = "missing-entry"
+	// an entry or claim which a record requires, but which its reverse indices do not refer to, so that it is not removed once
+	// the record no longer requires it
+	INDEX_ISSUE_UNREFERENCED_ENTRY = "unreferenced-entry"
+	// a path in the reverse indices of a record which the record does not require
+	INDEX_ISSUE_STALE_REFERENCE = "stale-reference"
+	// an entry whose name is not that of a record of the table
+	INDEX_ISSUE_MISMATCHED_TUPLE = "mismatched-tuple"
+)
+
+// an inconsistency between the records of a table, their reverse indices and the entries of the indices
+type IndexIssue struct {
+	// one of the kinds, e.g. INDEX_ISSUE_DANGLING_ENTRY
+	Kind string
+	// the field of the index, if it is known
+	Field string
+	// of the entry or claim
+	Path string
+	// the id of the record, if it is known
+	Id string
+}
+
+// what VerifyTable found
+type TableVerification struct {
+	// the number of live records, and of entries and claims of all of the indices
+	Records int
+	Entries int
+	// records which were written while the table was being verified, and were not checked
+	Skipped int
+	Issues  []IndexIssue
+}
+
+// true if no inconsistencies were found
+func (v TableVerification) Ok() bool {
+	return len(v.Issues) == 0
+}
+
+// checks the records of the table, their reverse indices, and the entries and claims of all revisions of all indices against
+// each other, without changing anything, e.g. in order to find out whether RebuildIndex is needed. entries and claims which were
+// written while it runs, and records which were written while it runs, are not checked, so that what transactions in progress do
+// is not reported.
+func VerifyTable[T any](ctx context.Context, repo *MinioRepository, table schema.Table) (TableVerification, error) {
+	verification := TableVerification{Issues: []IndexIssue{}}
+	snapshot := schema.NewReadOnlyTransaction(schema.MaxTimeout())
+
+	// index of each entry and claim which exists
+	existing := make(map[string]*schema.Index)
+	for i := range table.Indices {
+		index := &table.Indices[i]
+		prefixes := []string{index.PathPrefix() + "/"}
+		if index.Unique {
+			prefixes = append(prefixes, index.UniquePathPrefix()+"/")
+		}
+		for _, prefix := range prefixes {
+			paths, err := repo.selectPathsFromTableWhereIndexedFieldMatches(ctx, &snapshot, prefix, nil)
+			if err != nil {
+				return verification, err
+			}
+			for _, path := range paths.Items() {
+				existing[path] = index
+			}
+		}
+	}
+	verification.Entries = len(existing)
+
+	required := make(map[string]bool, len(existing))
+	skipped := make(map[string]bool)
+	for id, err := range repo.listIds(ctx, table) {
+		if err != nil {
+			return verification, err
+		}
+		requiredByRecord, live, err := requiredIndexPaths[T](ctx, repo, &snapshot, table, id)
+		if err != nil {
+			return verification, err
+		}
+		if !live {
+			skipped[id] = true
+			verification.Skipped++
+			continue
+		}
+		if requiredByRecord != nil {
+			verification.Records++
+		}
+		references, err := readReverseIndices(ctx, repo, &snapshot, table, id)
+		if err != nil {
+			return verification, err
+		}
+		for path, field := range requiredByRecord {
+			required[path] = true
+			if _, ok := existing[path]; !ok {
+				verification.Issues = append(verification.Issues, IndexIssue{Kind: INDEX_ISSUE_MISSING_ENTRY, Field: field, Path: path, Id: id})
+			}
+			if !references[path] {
+				verification.Issues = append(verification.Issues, IndexIssue{Kind: INDEX_ISSUE_UNREFERENCED_ENTRY, Field: field, Path: path, Id: id})
+			}
+		}
+		for path := range references {
+			if _, ok := requiredByRecord[path]; !ok {
+				issue := IndexIssue{Kind: INDEX_ISSUE_STALE_REFERENCE, Path: path, Id: id}
+				if index, ok := existing[path]; ok {
+					issue.Field = index.Field
+				}
+				verification.Issues = append(verification.Issues, issue)
+			}
+		}
+	}
+
+	for path, index := range existing {
+		if schema.IsUniquePath(path) {
+			if !required[path] {
+				verification.Issues = append(verification.Issues, IndexIssue{Kind: INDEX_ISSUE_DANGLING_ENTRY, Field: index.Field, Path: path})
+			}
+			continue
+		}
+		entry, err := index.EntryFromPath(path)
+		if err != nil || entry.Database != string(table.Database) || entry.Table != table.Name {
+			verification.Issues = append(verification.Issues, IndexIssue{Kind: INDEX_ISSUE_MISMATCHED_TUPLE, Field: index.Field, Path: path})
+			continue
+		}
+		if !required[path] && !skipped[entry.Id] {
+			verification.Issues = append(verification.Issues, IndexIssue{Kind: INDEX_ISSUE_DANGLING_ENTRY, Field: index.Field, Path: path, Id: entry.Id})
+		}
+	}
+	return verification, nil
+}
+
+// returns the field of each entry and claim that the record requires, which are nil if it does not exist, and false if it has
+// been written since the snapshot was taken
+func requiredIndexPaths[T any](ctx context.Context, repo *MinioRepository, snapshot *schema.Transaction, table schema.Table, id string) (map[string]string, bool, error) {
+	data, etag, err := repo.readObjectVersionForTransaction(ctx, snapshot, table.Path(id))
+	if err != nil {
+		if errors.Is(err, NoSuchKeyError) {
+			return nil, true, nil
+		}
+		return nil, false, err
+	}
+	info, exists, err := repo.statObject(ctx, table.Path(id))
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists || etag == nil || info.ETag != *etag {
+		return nil, false, nil
+	}
+	if len(*data) == 0 {
+		return nil, true, nil
+	}
+	entity := new(T)
+	if err := json.Unmarshal(*data, entity); err != nil {
+		return nil, false, err
+	}
+	required := make(map[string]string)
+	for _, index := range table.Indices {
+		indexPaths, err := getIndexPaths(index, entity, id)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, indexPath := range indexPaths {
+			required[indexPath] = index.Field
+		}
+		if !index.Unique {
+			continue
+		}
+		if indexed, err := isIndexed(&index, entity); err != nil {
+			return nil, false, err
+		} else if !indexed {
+			continue
+		}
+		// entities without a value have no claims
+		values, err := getIndexValues(&index, entity)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, value := range values {
+			required[index.UniquePath(value)] = index.Field
+		}
+	}
+	return required, true, nil
+}
+
+// returns the paths that the reverse indices of the record refer to, as of the snapshot
+func readReverseIndices(ctx context.Context, repo *MinioRepository, snapshot *schema.Transaction, table schema.Table, id string) (map[string]bool, error) {
+	references := make(map[string]bool)
+	data, _, err := repo.readObjectVersionForTransaction(ctx, snapshot, table.IndicesPath(id))
+	if err != nil {
+		if errors.Is(err, NoSuchKeyError) {
+			return references, nil
+		}
+		return nil, err
+	}
+	if len(*data) == 0 {
+		return references, nil
+	}
+	var indicesAsString string
+	if err := json.Unmarshal(*data, &indicesAsString); err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Split(strings.TrimSpace(indicesAsString), "\n") {
+		if path != "" {
+			references[path] = true
+		}
+	}
+	return references, nil
+}
@@ -0,0 +1,132 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the number of objects that GetMany reads at the same time
+const GET_MANY_PARALLELISM = 8
+
+// the result of reading one of the paths passed to GetMany
+type GetManyResult[T any] struct {
+	Path string
+	// nil if the object does not exist within the transaction
+	Object *T
+	ETag   *string
+}
+
+// reads the objects at the given paths in parallel, all from the same snapshot, i.e. ignoring the same transactions that are in
+// progress, rather than determining them again for each read, during which time some may have committed.
+// objects that the transaction already read or wrote are taken from its cache, and the others are added to it, including those
+// which do not exist.
+// each path is read once, even if it is passed more than once. the results are in the order of the paths.
+// like transactions in general, this is not safe for use by multiple goroutines using the same transaction at the same time.
+func GetMany[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, paths ...string) ([]GetManyResult[T], error) {
+	if err := tx.IsOk(); err != nil {
+		return nil, err
+	}
+
+	// read what is not yet cached
+	toRead := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		_, cached, err := tx.GetCached(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if !cached {
+			toRead = append(toRead, path)
+		}
+	}
+
+	type read struct {
+		data *[]byte
+		etag *string
+		err  error
+	}
+	reads := make(map[string]*read, len(toRead))
+	if len(toRead) > 0 {
+		transactionsInProgress, err := repo.getOtherTransactionsInProgress(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		transactionIdsToIgnore := make([]string, 0, len(transactionsInProgress))
+		for id := range transactionsInProgress {
+			transactionIdsToIgnore = append(transactionIdsToIgnore, id)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		semaphore := make(chan struct{}, GET_MANY_PARALLELISM)
+		for _, path := range toRead {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(path string) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				data, etag, err := repo.readObjectVersionIgnoring(ctx, tx, path, transactionIdsToIgnore)
+				mu.Lock()
+				defer mu.Unlock()
+				reads[path] = &read{data, etag, err}
+			}(path)
+		}
+		wg.Wait()
+	}
+
+	// the cache is only written here, since it is not safe for concurrent use
+	found := make(map[string]GetManyResult[T], len(toRead))
+	for _, path := range toRead {
+		read := reads[path]
+		if read.err != nil && !errors.Is(read.err, NoSuchKeyError) {
+			return nil, read.err
+		}
+		if read.err != nil || len(*read.data) == 0 {
+			// it does not exist, or has been deleted in the version that was found, which is cached too, so that reading it
+			// again within the transaction costs no requests
+			if err := tx.CacheRead(ctx, path, nil, 0); err != nil {
+				return nil, err
+			}
+			found[path] = GetManyResult[T]{Path: path}
+			continue
+		}
+		destination := new(T)
+		if err := json.Unmarshal(*read.data, destination); err != nil {
+			return nil, err
+		}
+		var a any = destination
+		if err := tx.CacheRead(ctx, path, &schema.ObjectAndETag{Object: &a, ETag: read.etag}, int64(len(*read.data))); err != nil {
+			return nil, err
+		}
+		found[path] = GetManyResult[T]{Path: path, Object: destination, ETag: read.etag}
+	}
+
+	results := make([]GetManyResult[T], 0, len(paths))
+	for _, path := range paths {
+		if result, ok := found[path]; ok {
+			results = append(results, result)
+			continue
+		}
+		// cached
+		result := GetManyResult[T]{Path: path}
+		destination := new(T)
+		etag, exists, err := getByPath(ctx, repo, tx, path, destination)
+		if err != nil && !errors.Is(err, NoSuchKeyError) {
+			return nil, err
+		}
+		if exists && err == nil {
+			result.Object = destination
+			result.ETag = etag
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
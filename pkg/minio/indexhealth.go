@@ -0,0 +1,119 @@
+package minio
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the health of an index that is being maintained outside of transactions, e.g. a new revision being backfilled,
+// so that operators know when it is safe to rely on it
+type IndexHealth struct {
+	Database string
+	Table    string
+	Field    string
+	Revision int
+
+	// records which have been processed, and which are still to be processed, i.e. the lag
+	Applied int
+	Pending int
+
+	Errors    int
+	LastError string
+
+	// set by VerifyIndex if the entries of the index do not match the records, and cleared once they do again
+	Inconsistent bool
+
+	// the watermark: records are processed in the order of their ids, so all ids up to and including this one are applied
+	LastAppliedId     string
+	LastAppliedMicros int64
+}
+
+// returns the health of the given index revision, and false if it has never been maintained by this process
+func (r *MinioRepository) GetIndexHealth(table schema.Table, field string, revision int) (IndexHealth, bool) {
+	index := schema.Index{Table: table, Field: field, Revision: revision}
+	r.indexHealthMu.Lock()
+	defer r.indexHealthMu.Unlock()
+	health, ok := r.indexHealth[index.PathPrefix()]
+	if !ok {
+		return IndexHealth{}, false
+	}
+	return *health, true
+}
+
+// returns the health of all indices maintained by this process, sorted by database, table, field and revision
+func (r *MinioRepository) GetAllIndexHealth() []IndexHealth {
+	r.indexHealthMu.Lock()
+	all := make([]IndexHealth, 0, len(r.indexHealth))
+	for _, health := range r.indexHealth {
+		all = append(all, *health)
+	}
+	r.indexHealthMu.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		return fmt.Sprintf("%s/%s/%s/%09d", a.Database, a.Table, a.Field, a.Revision) < fmt.Sprintf("%s/%s/%s/%09d", b.Database, b.Table, b.Field, b.Revision)
+	})
+	return all
+}
+
+// resets the health of the index at the start of maintenance
+func (r *MinioRepository) startIndexHealth(index *schema.Index, pending int) {
+	health := &IndexHealth{
+		Database: string(index.Table.Database),
+		Table:    index.Table.Name,
+		Field:    index.Field,
+		Revision: index.Revision,
+		Pending:  pending,
+	}
+	r.indexHealthMu.Lock()
+	r.indexHealth[index.PathPrefix()] = health
+	r.indexHealthMu.Unlock()
+	notifyIndexHealth(*health)
+}
+
+// records that the record with the given id was processed, successfully if err is nil
+func (r *MinioRepository) updateIndexHealth(index *schema.Index, id string, err error) {
+	r.indexHealthMu.Lock()
+	health := r.indexHealth[index.PathPrefix()]
+	if health.Pending > 0 {
+		health.Pending--
+	}
+	if err != nil {
+		health.Errors++
+		health.LastError = err.Error()
+	} else {
+		health.Applied++
+		health.LastAppliedId = id
+		health.LastAppliedMicros = time.Now().UnixMicro()
+	}
+	latest := *health
+	r.indexHealthMu.Unlock()
+	notifyIndexHealth(latest)
+}
+
+// records whether VerifyIndex found the entries of the index to match the records
+func (r *MinioRepository) recordIndexConsistency(index *schema.Index, consistent bool) {
+	r.indexHealthMu.Lock()
+	health, ok := r.indexHealth[index.PathPrefix()]
+	if !ok {
+		health = &IndexHealth{
+			Database: string(index.Table.Database),
+			Table:    index.Table.Name,
+			Field:    index.Field,
+			Revision: index.Revision,
+		}
+		r.indexHealth[index.PathPrefix()] = health
+	}
+	health.Inconsistent = !consistent
+	latest := *health
+	r.indexHealthMu.Unlock()
+	notifyIndexHealth(latest)
+}
+
+func notifyIndexHealth(health IndexHealth) {
+	if callback, ok := theCallback.(IndexHealthCallback); ok {
+		callback.IndexHealthChanged(health)
+	}
+}
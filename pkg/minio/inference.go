@@ -0,0 +1,307 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the number of objects per table which are read in order to infer their fields
+const INFER_SCHEMA_SAMPLE_SIZE = 100
+
+// strings longer than this on average are assumed to be free text, which is not worth indexing
+const INFER_SCHEMA_MAX_INDEXED_LENGTH = 64
+
+// folders at the root of the bucket which contain what the repository stores about transactions, rather than data
+var internalRoots = []string{schema.TRANSACTIONS_ROOT, schema.TENANTS_ROOT, schema.SCHEMA_ROOT, schema.ALIASES_ROOT, GC_ROOT, EPHEMERAL_ROOT, CHANGE_LOG_ROOT,
+	JOURNAL_ROOT, PREEMPTIONS_ROOT, SPILL_ROOT, INTENTS_ROOT}
+
+// a table found by InferSchema
+type InferredTable struct {
+	// with the indices that already exist, if the table is laid out as the repository stores tables
+	Table schema.Table
+	// the folder containing the objects, e.g. `<database>/<table>/data/`
+	Source string
+	// false for plain JSON objects, which are not laid out as the repository stores tables, and so must be imported before they can
+	// be queried, e.g. with the bulk endpoints
+	Native bool
+	// the number of objects, excluding deleted ones, and the number of those sampled which are not JSON objects
+	Objects int
+	Invalid int
+	// the top level fields of the sampled objects, sorted by key
+	Fields []InferredField
+	// indices which do not exist, but which the values of the sampled objects suggest
+	Suggestions []IndexSuggestion
+}
+
+// a top level field of the objects of an inferred table
+type InferredField struct {
+	// the key in the JSON objects, and the name of the Go field that it is conventionally unmarshalled into, i.e. with an upper case
+	// first letter, which is what indices refer to
+	Key   string
+	Field string
+	// the JSON types of its values, i.e. string, number, boolean, object, array or null, sorted
+	Types []string
+	// the number of sampled objects which have it, and the number of distinct values among them
+	Present  int
+	Distinct int
+}
+
+// what is collected about a field while sampling
+type fieldSample struct {
+	field *InferredField
+	// the values encoded as JSON, so that they can be compared
+	values      []string
+	totalLength int
+	times       int
+}
+
+// an index that an application may want to declare, and why
+type IndexSuggestion struct {
+	Index  schema.Index
+	Reason string
+}
+
+// analyses the objects below the prefix, e.g. `""` for the whole bucket, or `<database>/`, and returns a definition of each table
+// that it finds, sorted by database and name, with the indices that exist plus those that their values suggest, so that
+// applications can adopt data which already exists.
+// folders laid out as the repository stores tables, i.e. `<database>/<table>/data/<id>.json`, are native tables. other folders
+// containing JSON objects are plain tables, named after the first and last folder of their path, e.g. `legacy/crm/customers/` is
+// the table `customers` of database `legacy`. a sample of the objects of each table is read, so that the result is a starting
+// point to be reviewed, rather than a definitive schema.
+func (r *MinioRepository) InferSchema(ctx context.Context, prefix string) ([]InferredTable, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	tables := make([]InferredTable, 0, 10)
+	if err := r.inferSchemaOfFolder(ctx, prefix, &tables); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(tables, func(a, b InferredTable) int {
+		return strings.Compare(string(a.Table.Database)+"/"+a.Table.Name, string(b.Table.Database)+"/"+b.Table.Name)
+	})
+	return tables, nil
+}
+
+func (r *MinioRepository) inferSchemaOfFolder(ctx context.Context, folder string, tables *[]InferredTable) error {
+	files, folders, err := r.listFolder(ctx, folder)
+	if err != nil {
+		return err
+	}
+	segments := strings.Split(strings.TrimSuffix(folder, "/"), "/")
+	if len(segments) == 2 && slices.Contains(folders, folder+"data/") {
+		table, err := r.inferNativeTable(ctx, schema.NewTable(schema.NewDatabase(segments[0]), segments[1], []string{}))
+		if err != nil {
+			return err
+		}
+		*tables = append(*tables, table)
+		// the rest of the folder is indices and the like
+		return nil
+	}
+
+	jsonFiles := slices.DeleteFunc(files, func(object minio.ObjectInfo) bool { return !strings.HasSuffix(object.Key, ".json") || object.Size == 0 })
+	if folder != "" && len(jsonFiles) > 0 {
+		table := InferredTable{
+			Table:   schema.NewTable(schema.NewDatabase(segments[0]), segments[len(segments)-1], []string{}),
+			Source:  folder,
+			Objects: len(jsonFiles),
+		}
+		if err := r.inferFields(ctx, &table, jsonFiles); err != nil {
+			return err
+		}
+		*tables = append(*tables, table)
+	}
+
+	for _, subfolder := range folders {
+		if folder == "" && slices.Contains(internalRoots, subfolder) {
+			continue
+		}
+		if err := r.inferSchemaOfFolder(ctx, subfolder, tables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MinioRepository) inferNativeTable(ctx context.Context, table schema.Table) (InferredTable, error) {
+	// existing indices are the folders of the index tree, where revisions have a suffix, e.g. `Name.r1`, and are ignored, since
+	// their definitions are only known to the code
+	_, indexFolders, err := r.listFolder(ctx, table.Folder()+"indices/")
+	if err != nil {
+		return InferredTable{}, err
+	}
+	fields := make([]string, 0, len(indexFolders))
+	for _, indexFolder := range indexFolders {
+		field := path.Base(indexFolder)
+		if i := strings.LastIndex(field, ".r"); i > 0 {
+			if _, err := strconv.Atoi(field[i+2:]); err == nil {
+				continue
+			}
+		}
+		fields = append(fields, field)
+	}
+	table = schema.NewTable(table.Database, table.Name, fields)
+	_, uniqueFolders, err := r.listFolder(ctx, table.Folder()+schema.UNIQUE_FOLDER+"/")
+	if err != nil {
+		return InferredTable{}, err
+	}
+	for _, uniqueFolder := range uniqueFolders {
+		if field := path.Base(uniqueFolder); slices.Contains(fields, field) {
+			table = table.WithUniqueIndex(field)
+		}
+	}
+
+	files, _, err := r.listFolder(ctx, table.DataPathPrefix())
+	if err != nil {
+		return InferredTable{}, err
+	}
+	// deleted objects are empty
+	files = slices.DeleteFunc(files, func(object minio.ObjectInfo) bool { return !strings.HasSuffix(object.Key, ".json") || object.Size == 0 })
+	inferred := InferredTable{Table: table, Source: table.DataPathPrefix(), Native: true, Objects: len(files)}
+	if err := r.inferFields(ctx, &inferred, files); err != nil {
+		return InferredTable{}, err
+	}
+	return inferred, nil
+}
+
+// reads a sample of the objects, and adds their fields and the indices that they suggest to the table
+func (r *MinioRepository) inferFields(ctx context.Context, table *InferredTable, files []minio.ObjectInfo) error {
+	samples := make(map[string]*fieldSample)
+	sampled := 0
+	for _, file := range files[:min(len(files), INFER_SCHEMA_SAMPLE_SIZE)] {
+		object, err := r.Client.GetObject(ctx, r.BucketName, file.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("ADB-0127 failed to read %s: %w", file.Key, err)
+		}
+		data, err := readObject(object)
+		object.Close()
+		if err != nil {
+			return fmt.Errorf("ADB-0127 failed to read %s: %w", file.Key, err)
+		}
+		var values map[string]any
+		if err := json.Unmarshal(data, &values); err != nil {
+			table.Invalid++
+			continue
+		}
+		sampled++
+		for key, value := range values {
+			sample, ok := samples[key]
+			if !ok {
+				sample = &fieldSample{field: &InferredField{Key: key, Field: goFieldName(key), Types: make([]string, 0, 1)}}
+				samples[key] = sample
+			}
+			sample.field.Present++
+			if t := jsonType(value); !slices.Contains(sample.field.Types, t) {
+				sample.field.Types = append(sample.field.Types, t)
+			}
+			encoded, _ := json.Marshal(value)
+			sample.values = append(sample.values, string(encoded))
+			if s, ok := value.(string); ok {
+				sample.totalLength += len(s)
+				if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					sample.times++
+				}
+			}
+		}
+	}
+
+	table.Fields = make([]InferredField, 0, len(samples))
+	for _, sample := range samples {
+		slices.Sort(sample.field.Types)
+		distinct := slices.Clone(sample.values)
+		slices.Sort(distinct)
+		sample.field.Distinct = len(slices.Compact(distinct))
+		if reason, index, ok := suggestIndex(table.Table, sample, sampled); ok {
+			table.Suggestions = append(table.Suggestions, IndexSuggestion{Index: index, Reason: reason})
+		}
+		table.Fields = append(table.Fields, *sample.field)
+	}
+	slices.SortFunc(table.Fields, func(a, b InferredField) int { return strings.Compare(a.Key, b.Key) })
+	slices.SortFunc(table.Suggestions, func(a, b IndexSuggestion) int { return strings.Compare(a.Index.Field, b.Index.Field) })
+	return nil
+}
+
+// suggests an index for fields which are in most objects and have a single type which indices support, i.e. strings, numbers and
+// times
+func suggestIndex(table schema.Table, sample *fieldSample, sampled int) (string, schema.Index, bool) {
+	field := sample.field
+	index := schema.Index{Table: table, Field: field.Field}
+	if strings.EqualFold(field.Key, "id") || len(field.Types) != 1 || sampled < 2 || field.Present*2 < sampled || slices.ContainsFunc(table.Indices, func(existing schema.Index) bool {
+		return existing.Field == field.Field
+	}) {
+		return "", index, false
+	}
+	switch field.Types[0] {
+	case "number":
+		index.Numeric = true
+		return "its values are numbers, which can be queried by range", index, true
+	case "string":
+		if sample.times == field.Present {
+			index.Time = true
+			return "its values are times, which can be queried by period and range", index, true
+		}
+		if sample.totalLength > field.Present*INFER_SCHEMA_MAX_INDEXED_LENGTH {
+			return "", index, false
+		}
+		if field.Distinct == field.Present && field.Present == sampled {
+			index.Unique = true
+			return "its values are all different, e.g. a natural key like an email address", index, true
+		}
+		if field.Distinct < field.Present {
+			return "its values repeat, e.g. a status or a foreign key", index, true
+		}
+	}
+	return "", index, false
+}
+
+// lists the objects directly in the folder, and its subfolders, which end with a slash
+func (r *MinioRepository) listFolder(ctx context.Context, folder string) ([]minio.ObjectInfo, []string, error) {
+	files := make([]minio.ObjectInfo, 0, 10)
+	folders := make([]string, 0, 10)
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: folder}) {
+		if object.Err != nil {
+			return nil, nil, object.Err
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			folders = append(folders, object.Key)
+		} else {
+			files = append(files, object)
+		}
+	}
+	return files, folders, nil
+}
+
+func goFieldName(key string) string {
+	if key == "" {
+		return key
+	}
+	first, size := utf8.DecodeRuneInString(key)
+	return string(unicode.ToUpper(first)) + key[size:]
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,149 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// write intents are named `intents/<path of object>/<txId>` and contain the path of the transaction which is writing the object,
+// and its timeout, on separate lines
+const INTENTS_ROOT = "intents/"
+
+// the transaction is in progress, so the versions that it wrote are not yet visible
+const INTENT_LIVE = "live"
+
+// the transaction has timed out, but has not been rolled back, e.g. because its process died. the versions that it wrote are
+// orphans, which are not visible, and will be removed when it is rolled back.
+const INTENT_ORPHANED = "orphaned"
+
+// the transaction has been committed or rolled back, and the intent is about to be removed
+const INTENT_FINISHED = "finished"
+
+type WriteIntent struct {
+	TransactionId   string
+	TransactionPath string
+	State           string
+}
+
+// writes an intent next to each object, before a transaction writes it, so that readers can find the transactions which have
+// written an object but not yet committed, without listing all transactions.
+// all processes using the bucket should enable it, since intents are only considered while it is enabled.
+func (r *MinioRepository) EnableWriteIntents() {
+	r.writeIntentsEnabled = true
+}
+
+func (r *MinioRepository) DisableWriteIntents() {
+	r.writeIntentsEnabled = false
+}
+
+func writeIntentPath(path string, txId string) string {
+	return INTENTS_ROOT + path + "/" + txId
+}
+
+func (r *MinioRepository) putWriteIntent(ctx context.Context, tx *schema.Transaction, path string) error {
+	contents := []byte(fmt.Sprintf("%s\n%d", tx.GetPath(), tx.TimeoutMicroseconds))
+	intentPath := writeIntentPath(path, tx.Id)
+	_, err := r.Client.PutObject(ctx, r.BucketName, intentPath, bytes.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{ContentType: "text/plain"})
+	if err != nil {
+		return fmt.Errorf("ADB-0094 failed to put write intent %s: %w", intentPath, err)
+	}
+	return nil
+}
+
+// removes the intents of the transaction, once it has been committed or rolled back
+func (r *MinioRepository) removeWriteIntents(ctx context.Context, tx *schema.Transaction) []error {
+	errs := make([]error, 0)
+	removed := make(map[string]bool)
+	for _, step := range tx.Steps {
+		if !step.Type.IsData() || step.Skipped || removed[step.Path] {
+			continue
+		}
+		removed[step.Path] = true
+		intentPath := writeIntentPath(step.Path, tx.Id)
+		if err := r.DeleteFolder(ctx, intentPath, true, true); err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0095 failed to remove write intent %s: %w", intentPath, err))
+		}
+	}
+	return errs
+}
+
+// returns the intents of the transactions which have written the object, and whether they are still in progress
+func (r *MinioRepository) GetWriteIntents(ctx context.Context, path string) ([]WriteIntent, error) {
+	intents := make([]WriteIntent, 0, 1)
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix: INTENTS_ROOT + path + "/",
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		intent, err := r.readWriteIntent(ctx, object.Key)
+		if err != nil {
+			return nil, err
+		}
+		if intent != nil {
+			intents = append(intents, *intent)
+		}
+	}
+	return intents, nil
+}
+
+// returns nil if the intent was removed in the mean time
+func (r *MinioRepository) readWriteIntent(ctx context.Context, intentPath string) (*WriteIntent, error) {
+	object, err := r.Client.GetObject(ctx, r.BucketName, intentPath, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0096 failed to get write intent %s: %w", intentPath, err)
+	}
+	defer object.Close()
+	contents, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ADB-0096 failed to get write intent %s: %w", intentPath, err)
+	}
+	transactionPath, timeout, _ := strings.Cut(string(contents), "\n")
+	timeoutMicros, err := strconv.ParseInt(timeout, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0096 invalid write intent %s: %w", intentPath, err)
+	}
+	intent := &WriteIntent{
+		TransactionId:   intentPath[strings.LastIndex(intentPath, "/")+1:],
+		TransactionPath: transactionPath,
+	}
+
+	// the timeout is known, so only the existence of the transaction needs checking
+	_, exists, err := r.statObject(ctx, intent.TransactionPath+"/"+TX_FILENAME)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		intent.State = INTENT_FINISHED
+	} else if schema.Now().UnixMicro() > timeoutMicros {
+		intent.State = INTENT_ORPHANED
+	} else {
+		intent.State = INTENT_LIVE
+	}
+	return intent, nil
+}
+
+// the transactions, other than the given one, whose versions of the object must be ignored, since they are not committed
+func (r *MinioRepository) getTransactionsToIgnoreFromWriteIntents(ctx context.Context, tx *schema.Transaction, path string) ([]string, error) {
+	intents, err := r.GetWriteIntents(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	transactionIdsToIgnore := make([]string, 0, len(intents))
+	for _, intent := range intents {
+		if intent.TransactionId != tx.Id && intent.State != INTENT_FINISHED {
+			transactionIdsToIgnore = append(transactionIdsToIgnore, intent.TransactionId)
+		}
+	}
+	return transactionIdsToIgnore, nil
+}
@@ -0,0 +1,207 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the commit journal contains one object per committed transaction and database, named `<database>/<sequence>.json`.
+// sequence numbers are claimed with conditional writes, so they give a total commit order per database, without gaps.
+const JOURNAL_ROOT = "journal/"
+
+// sequences are zero padded, so that listing returns them in order
+const JOURNAL_SEQUENCE_FORMAT = "%020d"
+
+// a committed transaction, limited to the steps which wrote to one database
+type JournalEntry struct {
+	Database      string        `json:"database"`
+	Sequence      uint64        `json:"sequence"`
+	TransactionId string        `json:"transactionId"`
+	CommitMicros  int64         `json:"commitMicros"`
+	Steps         []JournalStep `json:"steps"`
+	// the version of the format that the entry was written in, see schema.FORMAT_VERSION
+	FormatVersion int `json:"formatVersion,omitempty"`
+}
+
+type JournalStep struct {
+	Type           schema.StepType `json:"type"`
+	Path           string          `json:"path"`
+	FinalETag      *string         `json:"finalEtag"`
+	FinalVersionId *string         `json:"finalVersionId"`
+}
+
+// journals every committed transaction, so that downstream consumers, e.g. backups, can rely on a total commit order.
+// a transaction whose entries cannot be appended is committed anyway, and the failures are returned as CommitResult.Warnings
+func (r *MinioRepository) EnableCommitJournal() {
+	r.journalEnabled = true
+}
+
+func (r *MinioRepository) DisableCommitJournal() {
+	r.journalEnabled = false
+}
+
+func journalPath(database schema.Database, sequence uint64) string {
+	return fmt.Sprintf("%s%s/"+JOURNAL_SEQUENCE_FORMAT+".json", JOURNAL_ROOT, database, sequence)
+}
+
+// appends an entry for each database that the transaction wrote to
+func (r *MinioRepository) appendToJournal(ctx context.Context, tx *schema.Transaction, commitMicros int64) []error {
+	entries := make(map[schema.Database]*JournalEntry)
+	databases := make([]schema.Database, 0, 1) // in the order they were first written
+	for _, step := range tx.Steps {
+		if step.Skipped || step.Type == schema.STEP_EPHEMERAL {
+			continue
+		}
+		_, path := schema.TenantFromPath(step.Path)
+		database := schema.Database(strings.SplitN(path, "/", 2)[0])
+		if table, _, ok := schema.MappedTableFromPath(step.Path); ok {
+			database = table.Database
+		}
+		entry, ok := entries[database]
+		if !ok {
+			entry = &JournalEntry{Database: string(database), TransactionId: tx.Id, CommitMicros: commitMicros, FormatVersion: schema.OBJECT_FORMAT_VERSION}
+			entries[database] = entry
+			databases = append(databases, database)
+		}
+		entry.Steps = append(entry.Steps, JournalStep{Type: step.Type, Path: step.Path, FinalETag: step.FinalETag, FinalVersionId: step.FinalVersionId})
+	}
+
+	errs := make([]error, 0)
+	for _, database := range databases {
+		if err := r.appendJournalEntry(ctx, entries[database]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// claims the next sequence number of the database by writing the entry, as long as no entry with that number exists
+func (r *MinioRepository) appendJournalEntry(ctx context.Context, entry *JournalEntry) error {
+	database := schema.Database(entry.Database)
+	r.journalMu.Lock()
+	sequence, known := r.journalSequences[database]
+	r.journalMu.Unlock()
+	if !known {
+		last, err := r.lastJournalSequence(ctx, database, 0)
+		if err != nil {
+			return err
+		}
+		sequence = last + 1
+	}
+
+	for {
+		entry.Sequence = sequence
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		opts := minio.PutObjectOptions{ContentType: "application/json"}
+		opts.SetMatchETagExcept("*") // someone else may have claimed it
+		path := journalPath(database, sequence)
+		_, err = r.Client.PutObject(ctx, r.BucketName, path, bytes.NewReader(data), int64(len(data)), opts)
+		if err == nil {
+			break
+		}
+		if minio.ToErrorResponse(err).StatusCode != http.StatusPreconditionFailed {
+			return fmt.Errorf("ADB-0075 Failed to append tx %s to the journal at path %s, %w", entry.TransactionId, path, err)
+		}
+		// skip everything that other processes have appended in the mean time
+		last, err := r.lastJournalSequence(ctx, database, sequence)
+		if err != nil {
+			return err
+		}
+		sequence = last + 1
+	}
+
+	r.journalMu.Lock()
+	if r.journalSequences[database] < sequence+1 {
+		r.journalSequences[database] = sequence + 1
+	}
+	r.journalMu.Unlock()
+	return nil
+}
+
+// returns the last sequence number in the journal of the database, at least the given one, or 0 if it is empty
+func (r *MinioRepository) lastJournalSequence(ctx context.Context, database schema.Database, atLeast uint64) (uint64, error) {
+	last := atLeast
+	startAfter := ""
+	if atLeast > 0 {
+		startAfter = journalPath(database, atLeast)
+	}
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:     JOURNAL_ROOT + string(database) + "/",
+		StartAfter: startAfter,
+	}) {
+		if object.Err != nil {
+			return 0, object.Err
+		}
+		sequence, err := journalSequenceFromPath(object.Key)
+		if err != nil {
+			return 0, err
+		}
+		last = sequence
+	}
+	return last, nil
+}
+
+func journalSequenceFromPath(path string) (uint64, error) {
+	name := strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], ".json")
+	sequence, err := strconv.ParseUint(name, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ADB-0076 invalid journal path %s: %w", path, err)
+	}
+	return sequence, nil
+}
+
+// reads up to max entries of the journal of the database, which follow the given sequence number. 0 is the start of the journal.
+func (r *MinioRepository) ReadCommitJournal(ctx context.Context, database schema.Database, afterSequence uint64, max int) ([]JournalEntry, error) {
+	entries := make([]JournalEntry, 0, max)
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel() // stop listing once enough are read
+	for object := range r.Client.ListObjects(listCtx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:     JOURNAL_ROOT + string(database) + "/",
+		StartAfter: journalPath(database, afterSequence),
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if len(entries) >= max {
+			break
+		}
+		entry, err := r.readJournalEntry(ctx, object.Key)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+func (r *MinioRepository) readJournalEntry(ctx context.Context, path string) (*JournalEntry, error) {
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0077 failed to get journal entry %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0077 failed to get journal entry %s: %w", path, err)
+	}
+	var entry JournalEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, err
+	}
+	if err := checkFormatVersionNumber(path, entry.FormatVersion); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,49 @@
+package minio
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// returns the id of the entity, i.e. its field Id, or the encoding of its composite key if the table has one, see
+// schema.Table.WithCompositeKey
+func entityId(table schema.Table, entity any) (string, error) {
+	if len(table.Key) == 0 {
+		return getFieldValueAsString(entity, "Id")
+	}
+	values := make([]string, len(table.Key))
+	for i, fieldName := range table.Key {
+		field, err := entityField(entity, fieldName)
+		if err != nil {
+			return "", err
+		}
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return "", fmt.Errorf("ADB-0266 the field %s of the composite key of table %s/%s is null", fieldName, table.Database, table.Name)
+			}
+			field = field.Elem()
+		}
+		switch {
+		case field.Kind() == reflect.String:
+			values[i] = field.String()
+		case field.CanInt():
+			values[i] = strconv.FormatInt(field.Int(), 10)
+		case field.CanUint():
+			values[i] = strconv.FormatUint(field.Uint(), 10)
+		case field.CanFloat() && field.Float() == math.Trunc(field.Float()):
+			// e.g. in maps that were unmarshalled from JSON
+			values[i] = strconv.FormatFloat(field.Float(), 'f', -1, 64)
+		default:
+			return "", fmt.Errorf("ADB-0267 the field %s of the composite key of table %s/%s is neither a string nor an integer", fieldName, table.Database, table.Name)
+		}
+	}
+	id, err := schema.EncodeCompositeKey(values...)
+	if err != nil {
+		return "", fmt.Errorf("ADB-0268 the entity has no composite key for table %s/%s: %w", table.Database, table.Name, err)
+	}
+	return id, nil
+}
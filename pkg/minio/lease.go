@@ -0,0 +1,177 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// a lease which permits a single process to write to a table, until it expires
+type TableLease struct {
+	Path          string `json:"path"`
+	Owner         string `json:"owner"`
+	ExpiresMicros int64  `json:"expiresMicros"`
+	ETag          string `json:"-"`
+}
+
+func (l *TableLease) IsExpired() bool {
+	return time.Now().UnixMicro() > l.ExpiresMicros
+}
+
+// acquires the lease of the table, for the given duration, so that this process may write to it if it is a single writer table.
+// the lease is taken over if it exists but has expired. if it is held by this process, it is renewed.
+// If another process holds the lease, returns a LeaseNotHeldError.
+func (r *MinioRepository) AcquireTableLease(ctx context.Context, table schema.Table, duration time.Duration) (*TableLease, error) {
+	path := table.LeasePath()
+
+	r.leasesMu.Lock()
+	held := r.leases[path]
+	r.leasesMu.Unlock()
+
+	opts := minio.PutObjectOptions{ContentType: "application/json"}
+	lease := &TableLease{Path: path, Owner: uuid.New().String()}
+	if held != nil {
+		// renew, as long as no one else has taken it over in the mean time
+		lease.Owner = held.Owner
+		opts.SetMatchETag(held.ETag)
+	} else {
+		existing, err := r.readTableLease(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			opts.SetMatchETagExcept("*") // fail if someone beats us to it
+		} else if existing.IsExpired() {
+			opts.SetMatchETag(existing.ETag) // take it over, unless someone beats us to it
+		} else {
+			return nil, &LeaseNotHeldErrorWithDetails{Details: fmt.Sprintf("lease %s is held by %s until %d", path, existing.Owner, existing.ExpiresMicros), Owner: existing.Owner, ExpiresMicros: existing.ExpiresMicros}
+		}
+	}
+	lease.ExpiresMicros = time.Now().Add(duration).UnixMicro()
+
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return nil, err
+	}
+	uploadInfo, err := r.Client.PutObject(ctx, r.BucketName, path, bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		respErr := minio.ToErrorResponse(err)
+		if respErr.StatusCode == http.StatusPreconditionFailed {
+			r.leasesMu.Lock()
+			delete(r.leases, path)
+			r.leasesMu.Unlock()
+			return nil, &LeaseNotHeldErrorWithDetails{Details: fmt.Sprintf("lease %s was acquired by another process", path)}
+		}
+		return nil, fmt.Errorf("ADB-0052 failed to put lease %s: %w", path, err)
+	}
+	lease.ETag = uploadInfo.ETag
+
+	r.leasesMu.Lock()
+	r.leases[path] = lease
+	r.leasesMu.Unlock()
+	return lease, nil
+}
+
+// releases the lease of the table, if this process holds it, so that another process can acquire it without waiting for it to expire
+func (r *MinioRepository) ReleaseTableLease(ctx context.Context, table schema.Table) error {
+	path := table.LeasePath()
+	r.leasesMu.Lock()
+	held := r.leases[path]
+	delete(r.leases, path)
+	r.leasesMu.Unlock()
+	if held == nil {
+		return nil
+	}
+
+	existing, err := r.readTableLease(ctx, path)
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.ETag != held.ETag {
+		// it expired and was taken over by someone else
+		return nil
+	}
+	err = r.Client.RemoveObject(ctx, r.BucketName, path, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("ADB-0053 failed to remove lease %s: %w", path, err)
+	}
+	return nil
+}
+
+// returns a LeaseNotHeldError if the table is a single writer table and this process does not hold a valid lease for it.
+// the lease is remembered by the transaction, so that it is checked again when it commits, see checkLeasesOfTransaction
+func (r *MinioRepository) checkLease(transaction *schema.Transaction, table schema.Table) error {
+	if !table.SingleWriter {
+		return nil
+	}
+	path := table.LeasePath()
+	if err := r.checkLeaseAt(path); err != nil {
+		return err
+	}
+	if !slices.Contains(transaction.LeasePaths, path) {
+		transaction.LeasePaths = append(transaction.LeasePaths, path)
+	}
+	return nil
+}
+
+// returns a LeaseNotHeldError if a lease which the transaction wrote under has been released or has expired since, so that
+// a writer whose lease expired while the transaction was in progress does not commit, while another process may hold it
+func (r *MinioRepository) checkLeasesOfTransaction(transaction *schema.Transaction) error {
+	for _, path := range transaction.LeasePaths {
+		if err := r.checkLeaseAt(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns a LeaseNotHeldError if this process does not hold a valid lease at the given path
+func (r *MinioRepository) checkLeaseAt(path string) error {
+	r.leasesMu.Lock()
+	held := r.leases[path]
+	r.leasesMu.Unlock()
+	if held == nil {
+		return &LeaseNotHeldErrorWithDetails{Details: fmt.Sprintf("lease %s must be held to write to its table", path)}
+	}
+	if held.IsExpired() {
+		return &LeaseNotHeldErrorWithDetails{Details: fmt.Sprintf("lease %s expired at %d", path, held.ExpiresMicros), Owner: held.Owner, ExpiresMicros: held.ExpiresMicros}
+	}
+	return nil
+}
+
+// reads the lease at the given path, or returns nil if it does not exist
+func (r *MinioRepository) readTableLease(ctx context.Context, path string) (*TableLease, error) {
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0054 failed to get lease %s: %w", path, err)
+	}
+	defer object.Close()
+	// stat the same object that is read, so that the ETag matches the contents
+	info, err := object.Stat()
+	if err != nil {
+		respErr := minio.ToErrorResponse(err)
+		if respErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ADB-0054 failed to get lease %s: %w", path, err)
+	}
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0054 failed to get lease %s: %w", path, err)
+	}
+	var lease TableLease
+	if err := json.Unmarshal(b, &lease); err != nil {
+		return nil, err
+	}
+	lease.ETag = info.ETag
+	return &lease, nil
+}
@@ -0,0 +1,321 @@
+package minio
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the kinds of problems that VerifyLinks reports
+const (
+	// the object that the link points to does not exist
+	LINK_ISSUE_MISSING = "missing"
+	// the content of the object no longer has the checksum that the link is pinned to
+	LINK_ISSUE_DRIFTED = "drifted"
+	// the object could not be read, e.g. because the host is down or access is denied
+	LINK_ISSUE_UNREACHABLE = "unreachable"
+)
+
+// how long reading an external object at an http or https URL may take at most
+const EXTERNAL_LINK_TIMEOUT = 30 * time.Second
+
+// the client which reads external objects at http and https URLs. redirects are not followed, since they could lead to hosts
+// that are not allowed, so a redirected link is unreachable.
+var externalLinkClient = &http.Client{
+	Timeout: EXTERNAL_LINK_TIMEOUT,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// a problem with an external link of a record
+type LinkIssue struct {
+	// one of the kinds, e.g. LINK_ISSUE_DRIFTED
+	Kind string
+	// the record, and its field containing the link
+	Id    string
+	Field string
+	Link  schema.ExternalLink
+	// the checksum of the content, if it drifted
+	Actual string
+	// why it could not be read, if it is unreachable
+	Details string
+}
+
+// what VerifyLinks found
+type LinkVerification struct {
+	// the number of live records, and of the links in the field
+	Records int
+	Links   int
+	Issues  []LinkIssue
+}
+
+// allows external links to point to the origins, i.e. `<scheme>://<host>`, e.g. `https://cdn.example.com`,
+// `http://localhost:8080` or `s3://assets` for the objects in the bucket named assets. links to other origins are not read, so
+// that records cannot make the repository read from internal hosts or buckets. no origin is allowed unless it is added here.
+func (r *MinioRepository) AllowExternalLinkOrigins(origins ...string) {
+	r.externalLinkOriginsMu.Lock()
+	defer r.externalLinkOriginsMu.Unlock()
+	if r.externalLinkOrigins == nil {
+		r.externalLinkOrigins = make(map[string]bool)
+	}
+	for _, origin := range origins {
+		r.externalLinkOrigins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+}
+
+// fails unless the origin of the link was allowed with AllowExternalLinkOrigins
+func (r *MinioRepository) checkExternalLinkAllowed(link schema.ExternalLink) error {
+	u, err := url.Parse(link.URI)
+	if err != nil {
+		return fmt.Errorf("ADB-0216 invalid external link %s: %w", link.URI, err)
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	r.externalLinkOriginsMu.Lock()
+	defer r.externalLinkOriginsMu.Unlock()
+	if !r.externalLinkOrigins[origin] {
+		return fmt.Errorf("ADB-0217 external link %s may not be read, since its origin %s is not allowed", link.URI, origin)
+	}
+	return nil
+}
+
+// returns a link to the object, pinned to the checksum of its current content. fails unless the origin of the link is allowed,
+// see AllowExternalLinkOrigins
+func (r *MinioRepository) PinExternalLink(ctx context.Context, uri string) (schema.ExternalLink, error) {
+	link, err := schema.NewExternalLink(uri, "")
+	if err != nil {
+		return link, err
+	}
+	checksum, err := r.externalChecksum(ctx, link)
+	if err != nil {
+		return link, err
+	}
+	link.SHA256 = checksum
+	return link, nil
+}
+
+// checks that the objects which the links in the field of the records of the table point to exist and, if the links are pinned,
+// still have the content that they are pinned to. the field is a schema.ExternalLink, a pointer to one, or a slice of them.
+// the content of pinned links is read in full, so that its checksum can be calculated, whereas the others are only checked for
+// existence. nothing is changed, so re-pin links with PinExternalLink in a transaction if their drift is intended.
+// links whose origin is not allowed, see AllowExternalLinkOrigins, are reported as unreachable.
+// each issue is reported to the ExternalLinkCallback, if there is one.
+func VerifyLinks[T any](ctx context.Context, repo *MinioRepository, table schema.Table, field string) (LinkVerification, error) {
+	verification := LinkVerification{Issues: []LinkIssue{}}
+	snapshot := schema.NewReadOnlyTransaction(schema.MaxTimeout())
+	for id, err := range repo.listIds(ctx, table) {
+		if err != nil {
+			return verification, err
+		}
+		data, _, err := repo.readObjectVersionForTransaction(ctx, &snapshot, table.Path(id))
+		if err != nil {
+			if errors.Is(err, NoSuchKeyError) {
+				continue
+			}
+			return verification, err
+		}
+		if len(*data) == 0 {
+			// deleted
+			continue
+		}
+		entity := new(T)
+		if err := json.Unmarshal(*data, entity); err != nil {
+			return verification, err
+		}
+		links, err := getExternalLinks(entity, field)
+		if err != nil {
+			return verification, err
+		}
+		verification.Records++
+		for _, link := range links {
+			verification.Links++
+			issue := repo.verifyLink(ctx, link)
+			if issue == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return verification, ctx.Err()
+			}
+			issue.Id = id
+			issue.Field = field
+			verification.Issues = append(verification.Issues, *issue)
+			if callback, ok := theCallback.(ExternalLinkCallback); ok {
+				callback.ExternalLinkFailedVerification(table, *issue)
+			}
+		}
+	}
+	return verification, nil
+}
+
+// verifies the links every interval, until the context is done. errors are reported to the callback passed to Setup.
+// see VerifyLinks
+func StartVerifyingLinks[T any](ctx context.Context, repo *MinioRepository, table schema.Table, field string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := VerifyLinks[T](ctx, repo, table, field); err != nil && ctx.Err() == nil && theCallback != nil {
+				theCallback.ErrorDuringGc(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// returns nil if the link is fine
+func (r *MinioRepository) verifyLink(ctx context.Context, link schema.ExternalLink) *LinkIssue {
+	var err error
+	actual := ""
+	if link.Pinned() {
+		actual, err = r.externalChecksum(ctx, link)
+	} else {
+		err = r.statExternalObject(ctx, link)
+	}
+	if err != nil {
+		if errors.Is(err, NoSuchKeyError) {
+			return &LinkIssue{Kind: LINK_ISSUE_MISSING, Link: link}
+		}
+		return &LinkIssue{Kind: LINK_ISSUE_UNREACHABLE, Link: link, Details: err.Error()}
+	}
+	if link.Pinned() && actual != link.SHA256 {
+		return &LinkIssue{Kind: LINK_ISSUE_DRIFTED, Link: link, Actual: actual}
+	}
+	return nil
+}
+
+// returns the hex encoded SHA-256 checksum of the content of the object, or a NoSuchKeyError if it does not exist
+func (r *MinioRepository) externalChecksum(ctx context.Context, link schema.ExternalLink) (string, error) {
+	body, err := r.openExternalObject(ctx, link)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return "", &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("ADB-0218 no such external object %s", link.URI)}
+		}
+		return "", fmt.Errorf("ADB-0219 failed to read external object %s: %w", link.URI, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (r *MinioRepository) openExternalObject(ctx context.Context, link schema.ExternalLink) (io.ReadCloser, error) {
+	object, err := link.Object()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkExternalLinkAllowed(link); err != nil {
+		return nil, err
+	}
+	if object.URL == "" {
+		o, err := r.Client.GetObject(ctx, object.Bucket, object.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0220 failed to read external object %s: %w", link.URI, err)
+		}
+		return o, nil
+	}
+	response, err := requestExternalObject(ctx, http.MethodGet, link, object)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// returns a NoSuchKeyError if the object does not exist
+func (r *MinioRepository) statExternalObject(ctx context.Context, link schema.ExternalLink) error {
+	object, err := link.Object()
+	if err != nil {
+		return err
+	}
+	if err := r.checkExternalLinkAllowed(link); err != nil {
+		return err
+	}
+	if object.URL == "" {
+		if _, err := r.Client.StatObject(ctx, object.Bucket, object.Key, minio.StatObjectOptions{}); err != nil {
+			if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+				return &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("ADB-0221 no such external object %s", link.URI)}
+			}
+			return fmt.Errorf("ADB-0222 failed to read external object %s: %w", link.URI, err)
+		}
+		return nil
+	}
+	response, err := requestExternalObject(ctx, http.MethodHead, link, object)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// returns the response if its status is successful. redirects are not successful, see externalLinkClient
+func requestExternalObject(ctx context.Context, method string, link schema.ExternalLink, object schema.ExternalObject) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, object.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0223 invalid external link %s: %w", link.URI, err)
+	}
+	response, err := externalLinkClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0224 failed to read external object %s: %w", link.URI, err)
+	}
+	if response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone {
+		response.Body.Close()
+		return nil, &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("ADB-0225 no such external object %s", link.URI)}
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		response.Body.Close()
+		return nil, fmt.Errorf("ADB-0226 failed to read external object %s: %s", link.URI, response.Status)
+	}
+	return response, nil
+}
+
+// returns the links in the field, which is a schema.ExternalLink, a pointer to one, or a slice of them. links without a URI are
+// ignored
+func getExternalLinks(obj any, fieldName string) ([]schema.ExternalLink, error) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ADB-0020 expected a struct, got %s", v.Kind())
+	}
+	field := v.FieldByName(fieldName)
+	if !field.IsValid() {
+		return nil, fmt.Errorf("ADB-0021 no such field: %s", fieldName)
+	}
+	links := make([]schema.ExternalLink, 0)
+	switch value := field.Interface().(type) {
+	case schema.ExternalLink:
+		links = append(links, value)
+	case *schema.ExternalLink:
+		if value != nil {
+			links = append(links, *value)
+		}
+	case []schema.ExternalLink:
+		links = append(links, value...)
+	default:
+		return nil, fmt.Errorf("ADB-0227 field %s is not an external link, a pointer to one, or a slice of them", fieldName)
+	}
+	nonEmpty := links[:0]
+	for _, link := range links {
+		if link.URI != "" {
+			nonEmpty = append(nonEmpty, link)
+		}
+	}
+	return nonEmpty, nil
+}
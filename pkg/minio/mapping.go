@@ -0,0 +1,22 @@
+package minio
+
+import (
+	"context"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// true if the object with the id of a table with a path template or layout was written before the table was adopted, i.e. by
+// something other than the repository, so that it has no reverse indices. objects written by the repository carry the id of the
+// transaction that wrote them, so a missing reverse index of one of those is an error, like it is for other tables.
+func (r *MinioRepository) writtenBeforeAdoption(ctx context.Context, table schema.Table, id string) (bool, error) {
+	if !table.IsAdopted() {
+		return false, nil
+	}
+	info, exists, err := r.statObject(ctx, table.Path(id))
+	if err != nil || !exists {
+		return false, err
+	}
+	_, written := info.UserMetadata[schema.TX_ID]
+	return !written, nil
+}
@@ -0,0 +1,121 @@
+package minio
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the names of the metrics which are exported by a MetricsCallback
+const (
+	METRIC_GC_ERRORS                 = "abstrastore_gc_errors_total"
+	METRIC_INDEX_APPLIED             = "abstrastore_index_applied"
+	METRIC_INDEX_PENDING             = "abstrastore_index_pending"
+	METRIC_INDEX_ERRORS              = "abstrastore_index_errors"
+	METRIC_INDEX_INCONSISTENT        = "abstrastore_index_inconsistent"
+	METRIC_MULTIPART_UPLOADS_ABORTED = "abstrastore_multipart_uploads_aborted_total"
+	METRIC_STORAGE_RECLAIMED_BYTES   = "abstrastore_storage_reclaimed_bytes_total"
+	METRIC_EXTERNAL_LINK_FAILURES    = "abstrastore_external_link_failures_total"
+)
+
+// the names of the latency histograms which are exported to the metrics of the repository, see SetMetrics
+const (
+	METRIC_COMMIT_DURATION = "abstrastore_commit_duration_seconds"
+	METRIC_QUERY_DURATION  = "abstrastore_query_duration_seconds"
+	METRIC_SCAN_DURATION   = "abstrastore_scan_duration_seconds"
+)
+
+// a backend to which metrics are exported, e.g. statsd or OpenTelemetry, see NewStatsdMetrics and NewOpenTelemetryMetrics.
+// the labels of a metric are the same each time it is exported, and implementations must be safe for concurrent use.
+type Metrics interface {
+	// adds the delta to the counter with the labels
+	AddToCounter(name string, delta int64, labels map[string]string)
+	// sets the gauge with the labels to the value
+	SetGauge(name string, value float64, labels map[string]string)
+	// records the duration in the histogram with the labels. the context is that of the operation which took so long, so that
+	// backends which support exemplars attach the trace of the span that the context carries to the measurement, e.g. so that
+	// operators can go from a spike in latency straight to the traces of the transactions which caused it
+	RecordDuration(ctx context.Context, name string, duration time.Duration, labels map[string]string)
+}
+
+// exports the latencies of commits, queries and scans to the metrics, with the contexts that they are called with, see
+// Metrics.RecordDuration. nil stops exporting them
+func (r *MinioRepository) SetMetrics(metrics Metrics) {
+	r.metricsMu.Lock()
+	defer r.metricsMu.Unlock()
+	r.metrics = metrics
+}
+
+// records the time since start, if there are metrics
+func (r *MinioRepository) recordDuration(ctx context.Context, name string, start time.Time, labels map[string]string) {
+	r.metricsMu.RLock()
+	metrics := r.metrics
+	r.metricsMu.RUnlock()
+	if metrics != nil {
+		metrics.RecordDuration(ctx, name, schema.Now().Sub(start), labels)
+	}
+}
+
+// a callback which exports the events that are passed to the callbacks as metrics, and passes them on to the next callback, if it
+// implements the callback that they are passed to, so that it can be passed to Setup in place of the next callback
+type MetricsCallback struct {
+	metrics Metrics
+	next    Callback
+}
+
+// next is optional
+func NewMetricsCallback(metrics Metrics, next Callback) *MetricsCallback {
+	return &MetricsCallback{metrics: metrics, next: next}
+}
+
+func (c *MetricsCallback) ErrorDuringGc(err error) {
+	c.metrics.AddToCounter(METRIC_GC_ERRORS, 1, nil)
+	if c.next != nil {
+		c.next.ErrorDuringGc(err)
+	}
+}
+
+func (c *MetricsCallback) IndexHealthChanged(health IndexHealth) {
+	labels := map[string]string{"database": health.Database, "table": health.Table, "field": health.Field, "revision": strconv.Itoa(health.Revision)}
+	c.metrics.SetGauge(METRIC_INDEX_APPLIED, float64(health.Applied), labels)
+	c.metrics.SetGauge(METRIC_INDEX_PENDING, float64(health.Pending), labels)
+	c.metrics.SetGauge(METRIC_INDEX_ERRORS, float64(health.Errors), labels)
+	inconsistent := 0.0
+	if health.Inconsistent {
+		inconsistent = 1
+	}
+	c.metrics.SetGauge(METRIC_INDEX_INCONSISTENT, inconsistent, labels)
+	if next, ok := c.next.(IndexHealthCallback); ok {
+		next.IndexHealthChanged(health)
+	}
+}
+
+func (c *MetricsCallback) MultipartUploadAborted(path string, bytes int64) {
+	c.metrics.AddToCounter(METRIC_MULTIPART_UPLOADS_ABORTED, 1, nil)
+	c.metrics.AddToCounter(METRIC_STORAGE_RECLAIMED_BYTES, bytes, nil)
+	if next, ok := c.next.(StorageReclaimedCallback); ok {
+		next.MultipartUploadAborted(path, bytes)
+	}
+}
+
+func (c *MetricsCallback) ExternalLinkFailedVerification(table schema.Table, issue LinkIssue) {
+	c.metrics.AddToCounter(METRIC_EXTERNAL_LINK_FAILURES, 1, map[string]string{"database": string(table.Database), "table": table.Name, "kind": issue.Kind})
+	if next, ok := c.next.(ExternalLinkCallback); ok {
+		next.ExternalLinkFailedVerification(table, issue)
+	}
+}
+
+// the label of the duration of a commit, which is either committed, rolledBack, or failed, e.g. because the transaction had
+// already timed out
+func commitOutcome(result *CommitResult) string {
+	switch {
+	case result.Committed:
+		return "committed"
+	case result.RolledBack:
+		return "rolledBack"
+	default:
+		return "failed"
+	}
+}
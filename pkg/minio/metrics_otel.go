@@ -0,0 +1,88 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// exports metrics with the instruments of an OpenTelemetry meter, i.e. counters, gauges and histograms, which are created the
+// first time that they are used, with the labels as attributes. durations are recorded in seconds with the context of the
+// operation, so that an SDK which samples exemplars, as the OpenTelemetry SDK does by default, links them to the span that the
+// context carries. instruments which cannot be created are reported to the error handler.
+type OpenTelemetryMetrics struct {
+	meter      metric.Meter
+	onError    func(err error)
+	counters   map[string]metric.Int64Counter
+	gauges     map[string]metric.Float64Gauge
+	histograms map[string]metric.Float64Histogram
+	mu         sync.Mutex
+}
+
+// the meter is e.g. `otel.Meter("abstrastore")`. onError is optional
+func NewOpenTelemetryMetrics(meter metric.Meter, onError func(err error)) *OpenTelemetryMetrics {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	return &OpenTelemetryMetrics{meter: meter, onError: onError, counters: make(map[string]metric.Int64Counter), gauges: make(map[string]metric.Float64Gauge), histograms: make(map[string]metric.Float64Histogram)}
+}
+
+func (o *OpenTelemetryMetrics) AddToCounter(name string, delta int64, labels map[string]string) {
+	o.mu.Lock()
+	counter, ok := o.counters[name]
+	if !ok {
+		var err error
+		if counter, err = o.meter.Int64Counter(name); err != nil {
+			o.mu.Unlock()
+			o.onError(fmt.Errorf("ADB-0160 failed to create counter %s: %w", name, err))
+			return
+		}
+		o.counters[name] = counter
+	}
+	o.mu.Unlock()
+	counter.Add(context.Background(), delta, metric.WithAttributes(attributes(labels)...))
+}
+
+func (o *OpenTelemetryMetrics) SetGauge(name string, value float64, labels map[string]string) {
+	o.mu.Lock()
+	gauge, ok := o.gauges[name]
+	if !ok {
+		var err error
+		if gauge, err = o.meter.Float64Gauge(name); err != nil {
+			o.mu.Unlock()
+			o.onError(fmt.Errorf("ADB-0160 failed to create gauge %s: %w", name, err))
+			return
+		}
+		o.gauges[name] = gauge
+	}
+	o.mu.Unlock()
+	gauge.Record(context.Background(), value, metric.WithAttributes(attributes(labels)...))
+}
+
+func (o *OpenTelemetryMetrics) RecordDuration(ctx context.Context, name string, duration time.Duration, labels map[string]string) {
+	o.mu.Lock()
+	histogram, ok := o.histograms[name]
+	if !ok {
+		var err error
+		if histogram, err = o.meter.Float64Histogram(name, metric.WithUnit("s")); err != nil {
+			o.mu.Unlock()
+			o.onError(fmt.Errorf("ADB-0160 failed to create histogram %s: %w", name, err))
+			return
+		}
+		o.histograms[name] = histogram
+	}
+	o.mu.Unlock()
+	histogram.Record(ctx, duration.Seconds(), metric.WithAttributes(attributes(labels)...))
+}
+
+func attributes(labels map[string]string) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(labels))
+	for key, value := range labels {
+		kvs = append(kvs, attribute.String(key, value))
+	}
+	return kvs
+}
@@ -0,0 +1,60 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exports metrics to a statsd server, e.g. a statsd exporter or the Datadog agent, over UDP, with the labels as DogStatsD tags,
+// i.e. `name:1|c|#label:value`. durations are timings in milliseconds, without exemplars, which statsd does not support. like
+// statsd itself, metrics which cannot be sent are dropped.
+type StatsdMetrics struct {
+	conn   net.Conn
+	prefix string
+}
+
+// address is e.g. `127.0.0.1:8125`. prefix is prepended to the names of the metrics, e.g. `myservice.`, and may be empty
+func NewStatsdMetrics(address string, prefix string) (*StatsdMetrics, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0160 failed to connect to statsd at %s: %w", address, err)
+	}
+	return &StatsdMetrics{conn: conn, prefix: prefix}, nil
+}
+
+func (s *StatsdMetrics) AddToCounter(name string, delta int64, labels map[string]string) {
+	s.send(name, strconv.FormatInt(delta, 10), "c", labels)
+}
+
+func (s *StatsdMetrics) SetGauge(name string, value float64, labels map[string]string) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", labels)
+}
+
+func (s *StatsdMetrics) RecordDuration(ctx context.Context, name string, duration time.Duration, labels map[string]string) {
+	s.send(name, strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', -1, 64), "ms", labels)
+}
+
+func (s *StatsdMetrics) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsdMetrics) send(name string, value string, kind string, labels map[string]string) {
+	line := strings.Builder{}
+	line.WriteString(s.prefix + name + ":" + value + "|" + kind)
+	for i, label := range slices.Sorted(maps.Keys(labels)) {
+		if i == 0 {
+			line.WriteString("|#")
+		} else {
+			line.WriteString(",")
+		}
+		line.WriteString(label + ":" + labels[label])
+	}
+	// each metric is a datagram of its own, and UDP does not report whether it arrived
+	_, _ = s.conn.Write([]byte(line.String()))
+}
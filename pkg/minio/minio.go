@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"reflect"
@@ -15,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/abstratium-informatique-sarl/abstrastore/internal/util"
@@ -25,9 +27,11 @@ import (
 
 const MINIO_META_PREFIX = "X-Amz-Meta-"
 const TX_FILENAME = "tx.json"
-const TOMBSTONE_AND_EXISTS_UNTIL = "Tombstone-And-Exists-Until" // wow, minio doesn't support camel case
-const MAX_TX_TIMEOUT_MICROS = 10 * 60 * 1000 * 1000 // 10 minutes
+const TOMBSTONE_AND_EXISTS_UNTIL = schema.TOMBSTONE_AND_EXISTS_UNTIL
+// Deprecated: the maximum timeout is configurable, see schema.MaxTimeout, which is what transactions are limited to
+const MAX_TX_TIMEOUT_MICROS = 10 * 60 * 1000 * 1000 // 10 minutes, the default of schema.MaxTimeout()
 const GC_ROOT = "gc/"
+const COMMIT_PARALLELISM = 8 // the number of steps applied at the same time during a commit
 
 var repo *MinioRepository
 var theCallback Callback
@@ -36,6 +40,57 @@ type MinioRepository struct {
 	Client     *minio.Client
 	BucketName string
 
+	// nil unless enabled
+	queryCache *queryCache
+
+	// zero unless enabled. nanoseconds, since it is read by commits, which may run concurrently with enabling it
+	archiveRetention atomic.Int64
+
+	// the table leases held by this process, keyed by lease path
+	leases   map[string]*TableLease
+	leasesMu sync.Mutex
+
+	// false unless enabled
+	changeLogEnabled bool
+
+	// false unless enabled. the next sequence number to try for each database, so that the journal needn't be listed every time
+	journalEnabled   bool
+	journalSequences map[schema.Database]uint64
+	journalMu        sync.Mutex
+
+	// zero unless enabled. nanoseconds, since it is read by ExecutePreemptions, in the background
+	preemptionGrace atomic.Int64
+
+	// false unless enabled
+	writeIntentsEnabled bool
+
+	// progress of index maintenance, keyed by index path prefix
+	indexHealth   map[string]*IndexHealth
+	indexHealthMu sync.Mutex
+
+	// what queries do when an index is unavailable, unless they set their own. the zero value fails them
+	indexUnavailablePolicy IndexUnavailablePolicy
+
+	// nil unless set, see SetMetrics
+	metrics   Metrics
+	metricsMu sync.RWMutex
+
+	// the origins that external links may point to, see AllowExternalLinkOrigins
+	externalLinkOrigins   map[string]bool
+	externalLinkOriginsMu sync.Mutex
+
+	// nil until they are probed
+	capabilities   *Capabilities
+	capabilitiesMu sync.Mutex
+
+	// nil unless set, see SetOutboxRetryPolicy
+	outboxRetryPolicy *OutboxRetryPolicy
+	outboxMu          sync.Mutex
+
+	// the foreign keys which are enabled, keyed by the database and name of the table that they reference
+	references   map[string][]reference
+	referencesMu sync.Mutex
+
 	// no need for any locks - see https://github.com/minio/minio-go/issues/1125, which seems to have fixed any issues related to goroutine-safety
 }
 
@@ -75,6 +130,7 @@ func Setup(callback Callback) {
 	go func() {
 		for {
 			ExecuteGc()
+			ExecutePreemptions()
 			time.Sleep(10 * time.Second)
 		}
 	}()
@@ -98,7 +154,7 @@ func ExecuteGc() {
 				continue
 			}
 			
-			now := time.Now().UnixMicro()
+			now := schema.Now().UnixMicro()
 			if now > keepUntil {
 				// read the contents as a string which is the path of the file that actually needs deleting
 				object, err := repo.Client.GetObject(context.Background(), repo.BucketName, objectInfo.Key, minio.GetObjectOptions{
@@ -146,12 +202,20 @@ func ExecuteGc() {
 			}
 		}
 	}
+
+	if _, err := repo.removeExpiredSpills(context.Background()); err != nil {
+		theCallback.ErrorDuringGc(err)
+	}
 }
 
 func newMinioRepository(client *minio.Client, bucketName string) *MinioRepository {
 	return &MinioRepository{
 		Client:     client,
 		BucketName: bucketName,
+		leases:     make(map[string]*TableLease),
+		indexHealth: make(map[string]*IndexHealth),
+		journalSequences: make(map[schema.Database]uint64),
+		references: make(map[string][]reference),
 	}
 }
 
@@ -186,7 +250,7 @@ type ContextContainer[T any] struct {
 }
 
 func (c TypedQuery[T]) SelectFromTable(table schema.Table) WhereContainer[T] {
-	return WhereContainer[T]{c.ctx, c.repo, table, c.tx}
+	return WhereContainer[T]{c.ctx, c.repo, table, c.tx, IndexUnavailablePolicy{}}
 }
 
 type WhereContainer[T any] struct {
@@ -194,10 +258,11 @@ type WhereContainer[T any] struct {
 	repo     *MinioRepository
 	table    schema.Table
 	tx       *schema.Transaction
+	whenIndexUnavailable IndexUnavailablePolicy
 }
 
 func (w WhereContainer[T]) WhereIndexedFieldEquals(fieldName string, value string) FindByIndexedFieldEqualsContainer[T] {
-	return FindByIndexedFieldEqualsContainer[T]{w.ctx, w.repo, w.table, fieldName, value, w.tx}
+	return FindByIndexedFieldEqualsContainer[T]{w.ctx, w.repo, w.table, fieldName, value, w.tx, w.whenIndexUnavailable}
 }
 
 func (w WhereContainer[T]) WhereIndexedFieldMatches(fieldName string, regexString string) FindByIndexedFieldMatchesContainer[T] {
@@ -212,7 +277,7 @@ func (w WhereContainer[T]) WhereIndexedFieldMatches(fieldName string, regexStrin
 	// for checking the object
 	regexAsSpecifiedByUser := regexp.MustCompile(regexString)
 
-	return FindByIndexedFieldMatchesContainer[T]{w.ctx, w.repo, w.table, fieldName, regexCaseInsensitive, regexAsSpecifiedByUser, w.tx}
+	return FindByIndexedFieldMatchesContainer[T]{w.ctx, w.repo, w.table, fieldName, regexCaseInsensitive, regexAsSpecifiedByUser, w.tx, w.whenIndexUnavailable}
 }
 
 func (w WhereContainer[T]) WhereIdEquals(id string) FindByIdContainer[T] {
@@ -226,6 +291,7 @@ type FindByIndexedFieldEqualsContainer[T any] struct {
 	fieldName string
 	value     string
 	tx        *schema.Transaction
+	whenIndexUnavailable IndexUnavailablePolicy
 }
 
 type FindByIndexedFieldMatchesContainer[T any] struct {
@@ -236,31 +302,54 @@ type FindByIndexedFieldMatchesContainer[T any] struct {
 	regexCaseInsensitive   *regexp.Regexp
 	regexAsSpecifiedByUser *regexp.Regexp
 	tx        *schema.Transaction
+	whenIndexUnavailable IndexUnavailablePolicy
 }
 
 // sql: select * from table_name where column1 = value1 (column1 is in an index)
 // Param: destination - the address of a slice of T, where the results will be stored, i.e. a slice of entities where the foreign key matches
 // Returns: a map of entity ids to ETags, and an error if any occurred
 func (f FindByIndexedFieldEqualsContainer[T]) Find(destination *[]*T) (*map[string]*string, error) {
-	coordinates := make([]schema.DatabaseTableIdTuple, 0, 10)
-	if err := f.findIds(&coordinates); err != nil {
+	key := fmt.Sprintf("equals|%s|%s", f.fieldName, f.value)
+	return cachedFind(f.ctx, f.repo, f.tx, f.table, key, destination, func() (*map[string]*string, error) {
+		return f.find(destination)
+	})
+}
+
+func (f FindByIndexedFieldEqualsContainer[T]) find(destination *[]*T) (*map[string]*string, error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	predicate, err := f.predicate(index)
+	if err != nil {
+		return nil, err
+	}
+	return findUsingIndex(f.ctx, f.repo, f.tx, f.table, index, f.whenIndexUnavailable, predicate, f.findIds, destination)
+}
+
+// returns whether an entity has the value that is looked for
+func (f FindByIndexedFieldEqualsContainer[T]) predicate(index *schema.Index) (func(*T) (bool, error), error) {
+	value, err := getIndexLookupValue(index, f.value)
+	if err != nil {
 		return nil, err
 	}
 
-	predicate := func(t *T) (bool, error) { 
+	return func(t *T) (bool, error) { 
 
-		fieldValue, err := getFieldValueAsString(t, f.fieldName)
+		fieldValues, err := getIndexValues(index, t)
 		if err != nil {
 			return false, err
 		}
 
 		// TODO other predicates too like regex, <, >, etc.
-		if fieldValue == f.value {
-			return true, nil
+		if len(fieldValues) == 0 {
+			return f.value == "", nil
 		}
-		return false, nil
-	}
-	return find(f.ctx, f.repo, f.tx, f.table, predicate, coordinates, destination)
+		return slices.ContainsFunc(fieldValues, func(fieldValue string) bool {
+			return index.CollationKey(fieldValue) == index.CollationKey(value)
+		}), nil
+	}, nil
 }
 
 func find[T any](ctx context.Context, repo *MinioRepository, transaction *schema.Transaction, table schema.Table, predicate func(*T) (bool, error), coordinates []schema.DatabaseTableIdTuple, destination *[]*T) (*map[string]*string, error) {
@@ -338,17 +427,13 @@ func find[T any](ctx context.Context, repo *MinioRepository, transaction *schema
 // not public, because without checking metadata of actual files, against transactions in progress, it's not safe to use these.
 // we pass these up, but the caller must ensure that versions exist for this transaction by comparing to others that are in progress
 func (f FindByIndexedFieldEqualsContainer[T]) findIds(destination *[]schema.DatabaseTableIdTuple) error {
-	index, err := f.table.GetIndex(f.fieldName)
-	if err != nil {
-		return err
-	}
-	paths, err := f.repo.selectPathsFromTableWhereIndexedFieldMatches(f.ctx, f.tx, index.PathNoId(f.value), nil)
+	index, paths, err := f.findPaths()
 	if err != nil {
 		return err
 	}
 	*destination = make([]schema.DatabaseTableIdTuple, 0, paths.Len())
 	for _, path := range paths.Items() {
-		databaseTableIdTuple, err := schema.DatabaseTableIdTupleFromPath(path)
+		databaseTableIdTuple, err := index.EntryFromPath(path)
 		if err != nil {
 			return err
 		}
@@ -357,41 +442,318 @@ func (f FindByIndexedFieldEqualsContainer[T]) findIds(destination *[]schema.Data
 	return nil
 }
 
+// returns the index and the paths of its entries which match the value, with the same caveats as findIds
+func (f FindByIndexedFieldEqualsContainer[T]) findPaths() (*schema.Index, *util.MutList[string], error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := getIndexLookupValue(index, f.value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.value == "" {
+		if index.Sparse {
+			return nil, nil, sparseIndexError(index)
+		}
+		// empty values are indexed as null
+		paths, _, err := f.repo.selectNullIndexEntries(f.ctx, f.tx, index)
+		if err != nil {
+			return nil, nil, err
+		}
+		return index, paths, nil
+	}
+	paths, err := f.repo.selectPathsFromTableWhereIndexedFieldMatches(f.ctx, f.tx, index.PathNoId(value), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return index, paths, nil
+}
+
 // sql: select * from table_name where column1 matches(value1) (column1 is in an index)
 // Param: destination - the address of a slice of T, where the results will be stored, i.e. a slice of entities where the foreign key matches
 // Returns: a map of entity ids to ETags, and an error if any occurred.
 // The regular expression MUST ignore case for this to work (because index entries are stored in lower case, but field values might be mixed case)!
+// It is matched against the values of the entities, rather than their collation, see schema.IndexCollation.
 func (f FindByIndexedFieldMatchesContainer[T]) Find(destination *[]*T) (*map[string]*string, error) {
-	coordinates := make([]schema.DatabaseTableIdTuple, 0, 10)
-	if err := f.findIds(&coordinates); err != nil {
+	key := fmt.Sprintf("matches|%s|%s", f.fieldName, f.regexAsSpecifiedByUser.String())
+	return cachedFind(f.ctx, f.repo, f.tx, f.table, key, destination, func() (*map[string]*string, error) {
+		return f.find(destination)
+	})
+}
+
+func (f FindByIndexedFieldMatchesContainer[T]) find(destination *[]*T) (*map[string]*string, error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
 		return nil, err
 	}
 
 	predicate := func(t *T) (bool, error) {
-		fieldValue, err := getFieldValueAsString(t, f.fieldName)
+		fieldValues, err := getIndexValues(index, t)
 		if err != nil {
 			return false, err
 		}
-		return f.regexAsSpecifiedByUser.MatchString(fieldValue), nil
+		return slices.ContainsFunc(fieldValues, f.regexAsSpecifiedByUser.MatchString), nil
 	}
 
-	return find(f.ctx, f.repo, f.tx, f.table, predicate, coordinates, destination)
+	return findUsingIndex(f.ctx, f.repo, f.tx, f.table, index, f.whenIndexUnavailable, predicate, f.findIds, destination)
 }
 
 // not public, because without checking metadata of actual files, against transactions in progress, it's not safe to use these.
 // we pass these up, but the caller must ensure that versions exist for this transaction by comparing to others that are in progress
 func (f FindByIndexedFieldMatchesContainer[T]) findIds(destination *[]schema.DatabaseTableIdTuple) error {
-	index, err := f.table.GetIndex(f.fieldName)
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return err
+	}
+	regex := f.regexCaseInsensitive // case insensitive since indices are stored that way
+	if !index.PathsContainValues() {
+		// all entries are read, and the entities matched
+		regex = nil
+	}
+	paths, err := f.repo.selectPathsFromTableWhereIndexedFieldMatches(f.ctx, f.tx, index.PathPrefix()+"/", nil)
+	if err != nil {
+		return err
+	}
+	*destination = make([]schema.DatabaseTableIdTuple, 0, paths.Len())
+	for _, path := range paths.Items() {
+		// matched against the values as they were before they were escaped
+		if regex != nil && !regex.MatchString(index.UnescapedPath(path)) {
+			continue
+		}
+		databaseTableIdTuple, err := index.EntryFromPath(path)
+		if err != nil {
+			return err
+		}
+		*destination = append(*destination, *databaseTableIdTuple)
+	}
+	return nil
+}
+
+// for numeric indices, selects the entities whose value is at least from, and less than to, i.e. `from <= value < to`, listing
+// only the index entries in that range. use math.Inf(-1) or math.Inf(1) for ranges which are unbounded on one side.
+func (w WhereContainer[T]) WhereIndexedFieldInRange(fieldName string, from float64, to float64) FindByIndexedFieldInRangeContainer[T] {
+	return FindByIndexedFieldInRangeContainer[T]{w.ctx, w.repo, w.table, fieldName, from, to, w.tx, w.whenIndexUnavailable}
+}
+
+type FindByIndexedFieldInRangeContainer[T any] struct {
+	ctx       context.Context
+	repo      *MinioRepository
+	table     schema.Table
+	fieldName string
+	from      float64
+	to        float64
+	tx        *schema.Transaction
+	whenIndexUnavailable IndexUnavailablePolicy
+}
+
+// sql: select * from table_name where column1 >= value1 and column1 < value2 (column1 is in a numeric index)
+// Param: destination - the address of a slice of T, where the results will be stored
+// Returns: a map of entity ids to ETags, and an error if any occurred
+func (f FindByIndexedFieldInRangeContainer[T]) Find(destination *[]*T) (*map[string]*string, error) {
+	key := fmt.Sprintf("range|%s|%g|%g", f.fieldName, f.from, f.to)
+	return cachedFind(f.ctx, f.repo, f.tx, f.table, key, destination, func() (*map[string]*string, error) {
+		return f.find(destination)
+	})
+}
+
+func (f FindByIndexedFieldInRangeContainer[T]) find(destination *[]*T) (*map[string]*string, error) {
+	index, from, to, err := f.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return findInIndexRange(f.ctx, f.repo, f.tx, f.table, index, f.whenIndexUnavailable, from, to, destination)
+}
+
+// selects the entities whose encoded index value is at least from, and less than to, listing only the index entries in that range
+func findInIndexRange[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, table schema.Table, index *schema.Index, policy IndexUnavailablePolicy, from string, to string, destination *[]*T) (*map[string]*string, error) {
+	lookup := func(coordinates *[]schema.DatabaseTableIdTuple) error {
+		// the entries of a value are in the folder named after it, so the range starts after the folder of the lower bound, and
+		// ends at the folder of the upper bound
+		paths, err := repo.selectPathsFromTableWhereIndexEntryBetween(ctx, tx, index.PathPrefix()+"/", index.PathNoId(from), index.PathNoId(to), nil)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths.Items() {
+			databaseTableIdTuple, err := index.EntryFromPath(path)
+			if err != nil {
+				return err
+			}
+			*coordinates = append(*coordinates, *databaseTableIdTuple)
+		}
+		return nil
+	}
+
+	predicate := func(t *T) (bool, error) {
+		fieldValues, err := getIndexValues(index, t)
+		if err != nil {
+			return false, err
+		}
+		return slices.ContainsFunc(fieldValues, func(fieldValue string) bool { return fieldValue >= from && fieldValue < to }), nil
+	}
+	return findUsingIndex(ctx, repo, tx, table, index, policy, predicate, lookup, destination)
+}
+
+// returns the index, and the encoded bounds of the range
+func (f FindByIndexedFieldInRangeContainer[T]) resolve() (*schema.Index, string, string, error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if index.Decimal {
+		// the bounds are exact, as floats are formatted
+		from, err := schema.EncodeSortableDecimal(strconv.FormatFloat(f.from, 'f', -1, 64))
+		if err != nil {
+			return nil, "", "", err
+		}
+		to, err := schema.EncodeSortableDecimal(strconv.FormatFloat(f.to, 'f', -1, 64))
+		if err != nil {
+			return nil, "", "", err
+		}
+		return index, from, to, nil
+	}
+	if !index.Numeric {
+		return nil, "", "", fmt.Errorf("ADB-0123 the index %s cannot be queried by range, since it is not numeric", f.fieldName)
+	}
+	from, err := schema.EncodeSortableNumber(f.from)
+	if err != nil {
+		return nil, "", "", err
+	}
+	to, err := schema.EncodeSortableNumber(f.to)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return index, from, to, nil
+}
+
+// for time indices, selects the entities whose value is at least from, and before to, i.e. `from <= value < to`, listing only
+// the index entries in that range
+func (w WhereContainer[T]) WhereIndexedFieldInTimeRange(fieldName string, from time.Time, to time.Time) FindByIndexedFieldInTimeRangeContainer[T] {
+	return FindByIndexedFieldInTimeRangeContainer[T]{w.ctx, w.repo, w.table, fieldName, from, to, w.tx, w.whenIndexUnavailable, nil}
+}
+
+// for time indices, selects the entities whose value is in the period, which is a year, month or day in UTC, e.g. `2026/03` for
+// all of March 2026. see schema.ParsePeriod
+func (w WhereContainer[T]) WhereIndexedFieldInPeriod(fieldName string, period string) FindByIndexedFieldInTimeRangeContainer[T] {
+	// an invalid period is reported by Find
+	from, to, err := schema.ParsePeriod(period)
+	return FindByIndexedFieldInTimeRangeContainer[T]{w.ctx, w.repo, w.table, fieldName, from, to, w.tx, w.whenIndexUnavailable, err}
+}
+
+type FindByIndexedFieldInTimeRangeContainer[T any] struct {
+	ctx       context.Context
+	repo      *MinioRepository
+	table     schema.Table
+	fieldName string
+	from      time.Time
+	to        time.Time
+	tx        *schema.Transaction
+	whenIndexUnavailable IndexUnavailablePolicy
+	err       error
+}
+
+// sql: select * from table_name where column1 >= value1 and column1 < value2 (column1 is in a time index)
+// Param: destination - the address of a slice of T, where the results will be stored
+// Returns: a map of entity ids to ETags, and an error if any occurred
+func (f FindByIndexedFieldInTimeRangeContainer[T]) Find(destination *[]*T) (*map[string]*string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	key := fmt.Sprintf("timerange|%s|%s|%s", f.fieldName, f.from.Format(time.RFC3339Nano), f.to.Format(time.RFC3339Nano))
+	return cachedFind(f.ctx, f.repo, f.tx, f.table, key, destination, func() (*map[string]*string, error) {
+		return f.find(destination)
+	})
+}
+
+func (f FindByIndexedFieldInTimeRangeContainer[T]) find(destination *[]*T) (*map[string]*string, error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return nil, err
+	}
+	if !index.Time {
+		return nil, fmt.Errorf("ADB-0125 the index %s cannot be queried by time, since it is not a time index", f.fieldName)
+	}
+	from, err := schema.EncodeTimeIndexValue(f.from)
+	if err != nil {
+		return nil, err
+	}
+	to, err := schema.EncodeTimeIndexValue(f.to)
+	if err != nil {
+		return nil, err
+	}
+	return findInIndexRange(f.ctx, f.repo, f.tx, f.table, index, f.whenIndexUnavailable, from, to, destination)
+}
+
+func (w WhereContainer[T]) WhereIndexedFieldIsNull(fieldName string) FindByIndexedFieldIsNullContainer[T] {
+	return FindByIndexedFieldIsNullContainer[T]{w.ctx, w.repo, w.table, fieldName, true, w.tx, w.whenIndexUnavailable}
+}
+
+func (w WhereContainer[T]) WhereIndexedFieldIsNotNull(fieldName string) FindByIndexedFieldIsNullContainer[T] {
+	return FindByIndexedFieldIsNullContainer[T]{w.ctx, w.repo, w.table, fieldName, false, w.tx, w.whenIndexUnavailable}
+}
+
+type FindByIndexedFieldIsNullContainer[T any] struct {
+	ctx       context.Context
+	repo      *MinioRepository
+	table     schema.Table
+	fieldName string
+	isNull    bool
+	tx        *schema.Transaction
+	whenIndexUnavailable IndexUnavailablePolicy
+}
+
+// sql: select * from table_name where column1 is null (column1 is in an index), or "is not null" if constructed with WhereIndexedFieldIsNotNull.
+// A field is null if it is an empty string or a nil pointer to a string.
+// Param: destination - the address of a slice of T, where the results will be stored
+// Returns: a map of entity ids to ETags, and an error if any occurred
+func (f FindByIndexedFieldIsNullContainer[T]) Find(destination *[]*T) (*map[string]*string, error) {
+	key := fmt.Sprintf("isnull|%s|%t", f.fieldName, f.isNull)
+	return cachedFind(f.ctx, f.repo, f.tx, f.table, key, destination, func() (*map[string]*string, error) {
+		return f.find(destination)
+	})
+}
+
+func (f FindByIndexedFieldIsNullContainer[T]) find(destination *[]*T) (*map[string]*string, error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return nil, err
+	}
+	if index.Sparse && f.isNull {
+		return nil, sparseIndexError(index)
+	}
+
+	predicate := func(t *T) (bool, error) {
+		fieldValues, err := getIndexValues(index, t)
+		if err != nil {
+			return false, err
+		}
+		return (len(fieldValues) == 0) == f.isNull, nil
+	}
+	return findUsingIndex(f.ctx, f.repo, f.tx, f.table, index, f.whenIndexUnavailable, predicate, f.findIds, destination)
+}
+
+// not public, because without checking metadata of actual files, against transactions in progress, it's not safe to use these.
+// we pass these up, but the caller must ensure that versions exist for this transaction by comparing to others that are in progress
+func (f FindByIndexedFieldIsNullContainer[T]) findIds(destination *[]schema.DatabaseTableIdTuple) error {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
 	if err != nil {
 		return err
 	}
-	paths, err := f.repo.selectPathsFromTableWhereIndexedFieldMatches(f.ctx, f.tx, index.PathPrefix(), f.regexCaseInsensitive) // case insensitive since indices are stored that way
+	var paths *util.MutList[string]
+	if f.isNull {
+		paths, _, err = f.repo.selectNullIndexEntries(f.ctx, f.tx, index)
+	} else {
+		paths, err = f.repo.selectPathsFromTableWhereIndexedFieldMatches(f.ctx, f.tx, index.PathPrefix()+"/", nil)
+	}
 	if err != nil {
 		return err
 	}
 	*destination = make([]schema.DatabaseTableIdTuple, 0, paths.Len())
 	for _, path := range paths.Items() {
-		databaseTableIdTuple, err := schema.DatabaseTableIdTupleFromPath(path)
+		if !f.isNull && (strings.HasPrefix(path, index.NullPathNoId()+"/") || strings.HasPrefix(path, index.LegacyNullPathNoId()+"/")) {
+			continue
+		}
+		databaseTableIdTuple, err := index.EntryFromPath(path)
 		if err != nil {
 			return err
 		}
@@ -429,14 +791,27 @@ func getByPath[T any](ctx context.Context, repo *MinioRepository, transaction *s
 	if err := transaction.IsOk(); err != nil {
 		return nil, false, err
 	}
-	if cached, ok := transaction.Cache[path]; ok {
+	cached, ok, err := transaction.GetCached(ctx, path)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
 		if cached == nil {
 			return nil, false, nil
 		} else {
 			etag = cached.ETag
 			val := *cached.Object
-			var t *T = val.(*T)
-			*destination = *t
+			if raw, ok := val.(json.RawMessage); ok {
+				// the transaction was resumed, so the type is only known now
+				if err := json.Unmarshal(raw, destination); err != nil {
+					return nil, false, err
+				}
+				var a any = destination
+				cached.Object = &a
+			} else {
+				var t *T = val.(*T)
+				*destination = *t
+			}
 		}
 	} else {
 		var objectData *[]byte
@@ -448,7 +823,9 @@ func getByPath[T any](ctx context.Context, repo *MinioRepository, transaction *s
 		if objectData != nil {
 			if len(*objectData) == 0 {
 				// it has been deleted in the version that was found
-				transaction.Cache[path] = nil
+				if err := transaction.CacheRead(ctx, path, nil, 0); err != nil {
+					return nil, false, err
+				}
 				return nil, false, &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("object %s does not exist", path)}
 			}
 			if err := json.Unmarshal(*objectData, destination); err != nil {
@@ -456,7 +833,9 @@ func getByPath[T any](ctx context.Context, repo *MinioRepository, transaction *s
 			}
 			// cache the result in case it is read again
 			var a any = destination
-			transaction.Cache[path] = &schema.ObjectAndETag{Object: &a, ETag: etag}
+			if err := transaction.CacheRead(ctx, path, &schema.ObjectAndETag{Object: &a, ETag: etag}, int64(len(*objectData))); err != nil {
+				return nil, false, err
+			}
 		} else {
 			return nil, false, &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("object %s does not exist", path)}
 		}
@@ -473,6 +852,18 @@ func (r *MinioRepository) InsertIntoTable(ctx context.Context, transaction *sche
 	if err := transaction.IsOk(); err != nil {
 		return nil, err
 	}
+	if err := r.checkLease(transaction, table); err != nil {
+		return nil, err
+	}
+	if err := checkTenant(transaction, table); err != nil {
+		return nil, err
+	}
+	if err := schema.CheckMappedTableRegistered(table); err != nil {
+		return nil, err
+	}
+	if err := r.checkStorageCapabilities(ctx, table); err != nil {
+		return nil, err
+	}
 
 	var err error
 
@@ -480,14 +871,30 @@ func (r *MinioRepository) InsertIntoTable(ctx context.Context, transaction *sche
 	// handle object
 	// //////////////////////////////////////////////////
 
-	// use reflection to fetch the value of the Id
+	// use reflection to fetch the value of the Id, or of the composite key
 	var id string
-	id, err = getFieldValueAsString(entity, "Id")
+	id, err = entityId(table, entity)
 	if err != nil {
 		return nil, err
 	}
 
-	err = transaction.AddStep("insert-data", "application/json", table.Path(id), "*", &entity)
+	if err := checkDecimals(table, entity); err != nil {
+		return nil, err
+	}
+	if err := checkEnums(table, entity); err != nil {
+		return nil, err
+	}
+	// before the indices are computed, so that they agree with what is written
+	normalizeEntity(table.Codec, entity)
+	first := len(transaction.Steps)
+	// the steps are discarded if the operation fails before they are stored with the transaction, so that they are not committed
+	stored := false
+	defer func() {
+		if !stored {
+			transaction.DiscardSteps(first)
+		}
+	}()
+	err = transaction.AddStep(schema.STEP_INSERT_DATA, table.Storage.DataContentType(), table.Path(id), "*", &entity)
 	if err != nil {
 		return nil, err
 	}
@@ -498,18 +905,41 @@ func (r *MinioRepository) InsertIntoTable(ctx context.Context, transaction *sche
 	// use the path as a tree style index. that way, we simply walk down the tree until we find the key
 	var indexPathsBuilder strings.Builder
 	for _, index := range table.Indices {
-		// use reflection to fetch the value of the field that the index is based on
-		value, err := getFieldValueAsString(entity, index.Field)
+		// use reflection to fetch the value of the field that the index is based on.
+		// there are none if the entity is not in the partial index
+		indexPaths, err := getIndexPaths(index, entity, id)
+		if err != nil {
+			return nil, err
+		}
+		// covering indices contain a projection of the entity
+		projection, contentType, err := getProjection(index, entity)
 		if err != nil {
 			return nil, err
 		}
+		for _, indexPath := range indexPaths {
+			 // ETag: "*" - fail if the object already exists, since this is an insert not an upsert. if someone beat us to it, that would mean a conflict
+			err = transaction.AddStep(schema.STEP_INSERT_ADD_INDEX, contentType, indexPath, "*", projection)
+			if err != nil {
+				return nil, err
+			}
+			transaction.Steps[len(transaction.Steps)-1].RecordETag = index.RecordETags
+			indexPathsBuilder.WriteString(indexPath)
+			indexPathsBuilder.WriteByte('\n')
+		}
+	}
 
-		 // ETag: "*" - fail if the object already exists, since this is an insert not an upsert. if someone beat us to it, that would mean a conflict
-		err = transaction.AddStep("insert-add-index", "text/plain", index.Path(value, id), "*", nil)
+	// claims on the values of unique indices are maintained like index entries, but fail if they exist
+	claims, err := r.getUniqueClaims(ctx, table, entity, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, claim := range claims {
+		var claimedBy any = id
+		err = transaction.AddStep(schema.STEP_INSERT_ADD_INDEX, "text/plain", claim, "*", &claimedBy)
 		if err != nil {
 			return nil, err
 		}
-		indexPathsBuilder.WriteString(index.Path(value, id))
+		indexPathsBuilder.WriteString(claim)
 		indexPathsBuilder.WriteByte('\n')
 	}
 
@@ -519,21 +949,23 @@ func (r *MinioRepository) InsertIntoTable(ctx context.Context, transaction *sche
 	// //////////////////////////////////////////////////
 	indicesPath := table.IndicesPath(id)
 	var indicesAsString any = indexPathsBuilder.String()
-	err = transaction.AddStep("insert-reverse-indices", "text/plain", indicesPath, "*", &indicesAsString)
+	err = transaction.AddStep(schema.STEP_INSERT_REVERSE_INDICES, "text/plain", indicesPath, "*", &indicesAsString)
 	if err != nil {
 		return nil, err
 	}
+	transaction.SetStorage(first, table.Storage)
 
 	err = r.updateTransaction(ctx, transaction)
 	if err != nil {
 		return nil, err
 	}
+	stored = true
 
 	// //////////////////////////////////////////////////
 	// execute the transaction steps
 	// //////////////////////////////////////////////////
 	var etag *string
-	etag, err = r.executeTransactionSteps(ctx, transaction, id, 0)
+	etag, err = r.executeTransactionSteps(ctx, transaction, id, first)
 	if err != nil {
 		return nil, err
 	}
@@ -561,6 +993,18 @@ func (r *MinioRepository) UpdateTable(ctx context.Context, transaction *schema.T
 	if err := transaction.IsOk(); err != nil {
 		return nil, err
 	}
+	if err := r.checkLease(transaction, table); err != nil {
+		return nil, err
+	}
+	if err := checkTenant(transaction, table); err != nil {
+		return nil, err
+	}
+	if err := schema.CheckMappedTableRegistered(table); err != nil {
+		return nil, err
+	}
+	if err := r.checkStorageCapabilities(ctx, table); err != nil {
+		return nil, err
+	}
 
 	if *etag == "*" {
 		return nil, fmt.Errorf("ADB0031 ETag is '*', which is not allowed for update, use insert instead.")
@@ -572,14 +1016,42 @@ func (r *MinioRepository) UpdateTable(ctx context.Context, transaction *schema.T
 	// handle object
 	// //////////////////////////////////////////////////
 
-	// use reflection to fetch the value of the Id
+	// use reflection to fetch the value of the Id, or of the composite key
 	var id string
-	id, err = getFieldValueAsString(entity, "Id")
+	id, err = entityId(table, entity)
 	if err != nil {
 		return nil, err
 	}
 
-	err = transaction.AddStep("update-data", "application/json", table.Path(id), *etag, &entity)
+	if err := r.checkPin(ctx, transaction, table, id); err != nil {
+		return nil, err
+	}
+	if err := r.checkFormatVersionOfObject(ctx, table.Path(id)); err != nil {
+		return nil, err
+	}
+	if err := checkDecimals(table, entity); err != nil {
+		return nil, err
+	}
+	if err := checkEnums(table, entity); err != nil {
+		return nil, err
+	}
+	normalizeEntity(table.Codec, entity)
+	first := len(transaction.Steps)
+	// the steps are discarded if the operation fails before they are stored with the transaction, so that they are not committed
+	stored := false
+	defer func() {
+		if !stored {
+			transaction.DiscardSteps(first)
+		}
+	}()
+	var data *[]byte
+	if table.Codec.PreserveUnknownFields {
+		// merged before the step is added, so that validators check what is written
+		if data, err = r.preserveUnknownFields(ctx, transaction, table.Path(id), *etag, entity); err != nil {
+			return nil, err
+		}
+	}
+	err = transaction.AddStepWithData(schema.STEP_UPDATE_DATA, table.Storage.DataContentType(), table.Path(id), *etag, &entity, data)
 	if err != nil {
 		return nil, err
 	}
@@ -596,8 +1068,15 @@ func (r *MinioRepository) UpdateTable(ctx context.Context, transaction *schema.T
 	b, err := io.ReadAll(object)
 	if err != nil {
 		respErr := minio.ToErrorResponse(err)
-		if respErr.StatusCode == http.StatusNotFound && *etag == "" {
-			// OK - the user is trying to do an upsert, and the object doesn't exist, so it has no indices
+		adopted := false
+		if respErr.StatusCode == http.StatusNotFound && *etag != "" {
+			if adopted, err = r.writtenBeforeAdoption(ctx, table, id); err != nil {
+				return nil, err
+			}
+		}
+		if respErr.StatusCode == http.StatusNotFound && (*etag == "" || adopted) {
+			// OK - the user is trying to do an upsert, and the object doesn't exist, so it has no indices. objects of tables with
+			// a path template or layout which were written before the table was adopted have none either
 			b = []byte("\"\"") // empty json string
 		} else {
 			return nil, err
@@ -618,22 +1097,51 @@ func (r *MinioRepository) UpdateTable(ctx context.Context, transaction *schema.T
 	// //////////////////////////////////////////////////
 	allIndicesRequiredAfterCommit := make([]string, 0, len(table.Indices))
 	for _, index := range table.Indices {
-		// use reflection to fetch the value of the field that the index is based on
-		value, err := getFieldValueAsString(entity, index.Field)
+		// use reflection to fetch the value of the field that the index is based on.
+		// there are none if the entity is not in the partial index, so an existing entry is removed below
+		indexPaths, err := getIndexPaths(index, entity, id)
+		if err != nil {
+			return nil, err
+		}
+		projection, contentType, err := getProjection(index, entity)
 		if err != nil {
 			return nil, err
 		}
+		for _, indexPath := range indexPaths {
+			if !slices.Contains(existingIndices, indexPath) {
+				// ETag: "" - we need to overwrite
+				err = transaction.AddStep(schema.STEP_UPDATE_ADD_INDEX, contentType, indexPath, "", projection)
+				if err != nil {
+					return nil, err
+				}
+				transaction.Steps[len(transaction.Steps)-1].RecordETag = index.RecordETags
+			} else if len(index.Projection) > 0 || index.RecordETags {
+				// kept, but the projection or the ETag of the record changes
+				err = transaction.AddStep(schema.STEP_UPDATE_INDEX_PROJECTION, contentType, indexPath, "", projection)
+				if err != nil {
+					return nil, err
+				}
+				transaction.Steps[len(transaction.Steps)-1].RecordETag = index.RecordETags
+			} // else keep it
 
-		indexPath := index.Path(value, id)
-		if !slices.Contains(existingIndices, indexPath) {
-			// ETag: "" - we need to overwrite
-			err = transaction.AddStep("update-add-index", "text/plain", indexPath, "", nil)
+			allIndicesRequiredAfterCommit = append(allIndicesRequiredAfterCommit, indexPath)
+		}
+	}
+	claims, err := r.getUniqueClaims(ctx, table, entity, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, claim := range claims {
+		if !slices.Contains(existingIndices, claim) {
+			// ETag: "*" - unlike index entries, the value must not be claimed by a different entity
+			var claimedBy any = id
+			err = transaction.AddStep(schema.STEP_UPDATE_ADD_INDEX, "text/plain", claim, "*", &claimedBy)
 			if err != nil {
 				return nil, err
 			}
 		} // else keep it
 
-		allIndicesRequiredAfterCommit = append(allIndicesRequiredAfterCommit, indexPath)
+		allIndicesRequiredAfterCommit = append(allIndicesRequiredAfterCommit, claim)
 	}
 
 	// //////////////////////////////////////////////////
@@ -643,7 +1151,7 @@ func (r *MinioRepository) UpdateTable(ctx context.Context, transaction *schema.T
 		if !slices.Contains(allIndicesRequiredAfterCommit, existingIndex) {
 			if existingIndex != "" { // happens on upsert with no prior version (or maybe also when no fields are indexed?)
 				// ETag: "" - not relevant for deletion
-				err = transaction.AddStep("update-remove-index", "text/plain", existingIndex, "", nil)
+				err = transaction.AddStep(schema.STEP_UPDATE_REMOVE_INDEX, "text/plain", existingIndex, "", nil)
 				if err != nil {
 					return nil, err
 				}
@@ -659,21 +1167,23 @@ func (r *MinioRepository) UpdateTable(ctx context.Context, transaction *schema.T
 	// just like this algorithm calculates above.
 	indicesPath := table.IndicesPath(id)
 	var indicesData any = strings.Join(allIndicesRequiredAfterCommit, "\n")
-	err = transaction.AddStep("update-reverse-indices", "text/plain", indicesPath, "", &indicesData) // Etag: "" - we need to overwrite the file and create a new version
+	err = transaction.AddStep(schema.STEP_UPDATE_REVERSE_INDICES, "text/plain", indicesPath, "", &indicesData) // Etag: "" - we need to overwrite the file and create a new version
 	if err != nil {
 		return nil, err
 	}
+	transaction.SetStorage(first, table.Storage)
 
 	err = r.updateTransaction(ctx, transaction)
 	if err != nil {
 		return nil, err
 	}
+	stored = true
 
 	// //////////////////////////////////////////////////
 	// execute the transaction steps
 	// //////////////////////////////////////////////////
 	var newEtag *string
-	newEtag, err = r.executeTransactionSteps(ctx, transaction, id, 0)
+	newEtag, err = r.executeTransactionSteps(ctx, transaction, id, first)
 	if err != nil {
 		return nil, err
 	}
@@ -694,30 +1204,81 @@ func (r *MinioRepository) UpdateTable(ctx context.Context, transaction *schema.T
 // If the ETag is '*', an error is returned.
 // If the object doesn't exist this method does NOT return an error.
 // Only the Id field of the entity is relevant.
-func (r *MinioRepository) DeleteFromTable(ctx context.Context, transaction *schema.Transaction, table schema.Table, entity any, etag *string) error {
+func (r *MinioRepository) DeleteFromTable(ctx context.Context, transaction *schema.Transaction, table schema.Table, entity any, etag *string) (err error) {
 
 	if err := transaction.IsOk(); err != nil {
 		return err
 	}
-
-	if *etag == "*" {
-		return fmt.Errorf("ADB0032 ETag is '*', which is not allowed for delete.")
+	if err := r.checkLease(transaction, table); err != nil {
+		return err
+	}
+	if err := checkTenant(transaction, table); err != nil {
+		return err
+	}
+	if err := schema.CheckMappedTableRegistered(table); err != nil {
+		return err
+	}
+	if err := r.checkStorageCapabilities(ctx, table); err != nil {
+		return err
+	}
+
+	if *etag == "*" {
+		return fmt.Errorf("ADB0032 ETag is '*', which is not allowed for delete.")
 	}
 
-	var err error
-
 	// //////////////////////////////////////////////////
 	// handle object
 	// //////////////////////////////////////////////////
 
-	// use reflection to fetch the value of the Id
+	// use reflection to fetch the value of the Id, or of the composite key
 	var id string
-	id, err = getFieldValueAsString(entity, "Id")
+	id, err = entityId(table, entity)
 	if err != nil {
 		return err
 	}
 
-	err = transaction.AddStep("delete-data", "application/json", table.Path(id), *etag, nil) // nil entity, so that we create a tombstone
+	err = r.checkPin(ctx, transaction, table, id)
+	if err != nil {
+		return err
+	}
+	err = r.checkFormatVersionOfObject(ctx, table.Path(id))
+	if err != nil {
+		return err
+	}
+
+	// marked first, so that entities which reference it in a cycle do not delete it again, until the delete fails
+	marked := transaction.MarkDeleting(table.Path(id))
+	stored := false
+	defer func() {
+		if marked && !stored {
+			transaction.UnmarkDeleting(table.Path(id))
+		}
+	}()
+
+	// the steps are removed if the operation fails before those of this entity are stored with the transaction, so that they are
+	// not committed. those of the entities which the references deleted or changed were already executed, so they are rolled
+	// back, whereas those of this entity were not, so they are only discarded.
+	first := len(transaction.Steps)
+	own := first
+	defer func() {
+		if !stored {
+			transaction.DiscardSteps(own)
+			if own > first {
+				if errs := r.rollbackStepsFrom(ctx, transaction, first); len(errs) > 0 {
+					err = errors.Join(append([]error{err}, errs...)...)
+				}
+			}
+		}
+	}()
+
+	// the entities which reference it are handled first, so that a restricted reference fails the delete before the steps of this
+	// entity are added
+	err = r.deleteReferences(ctx, transaction, table, id)
+	own = len(transaction.Steps)
+	if err != nil {
+		return err
+	}
+	err = transaction.AddStep(schema.STEP_DELETE_DATA, table.Storage.DataContentType(), table.Path(id), *etag, nil) // nil entity, so that we create a tombstone
 	if err != nil {
 		return err
 	}
@@ -733,8 +1294,15 @@ func (r *MinioRepository) DeleteFromTable(ctx context.Context, transaction *sche
 	b, err := io.ReadAll(object)
 	if err != nil {
 		respErr := minio.ToErrorResponse(err)
-		if respErr.StatusCode == http.StatusNotFound && *etag == "" {
-			// OK - can happen if already deleted
+		adopted := false
+		if respErr.StatusCode == http.StatusNotFound && *etag != "" {
+			if adopted, err = r.writtenBeforeAdoption(ctx, table, id); err != nil {
+				return err
+			}
+		}
+		if respErr.StatusCode == http.StatusNotFound && (*etag == "" || adopted) {
+			// OK - can happen if already deleted, or if an object of a table with a path template or layout was written before the table was
+			// adopted
 			b = []byte("\"\"") // empty json string
 		} else {
 			return err
@@ -761,7 +1329,7 @@ func (r *MinioRepository) DeleteFromTable(ctx context.Context, transaction *sche
 		}
 
 		// ETag: "" - not relevant for deletion
-		err = transaction.AddStep("delete-remove-index", "text/plain", existingIndex, "", nil)
+		err = transaction.AddStep(schema.STEP_DELETE_REMOVE_INDEX, "text/plain", existingIndex, "", nil)
 		if err != nil {
 			return err
 		}
@@ -771,15 +1339,17 @@ func (r *MinioRepository) DeleteFromTable(ctx context.Context, transaction *sche
 	// handle reverse indices
 	// //////////////////////////////////////////////////
 	indicesPath := table.IndicesPath(id)
-	err = transaction.AddStep("delete-reverse-indices", "text/plain", indicesPath, "", nil) // Etag: "" - we need to overwrite the file and create a new version
+	err = transaction.AddStep(schema.STEP_DELETE_REVERSE_INDICES, "text/plain", indicesPath, "", nil) // Etag: "" - we need to overwrite the file and create a new version
 	if err != nil {
 		return err
 	}
+	transaction.SetStorage(first, table.Storage)
 
 	err = r.updateTransaction(ctx, transaction)
 	if err != nil {
 		return err
 	}
+	stored = true
 
 	// //////////////////////////////////////////////////
 	// execute the transaction steps
@@ -799,16 +1369,36 @@ func (r *MinioRepository) DeleteFromTable(ctx context.Context, transaction *sche
 	return nil
 }
 
-func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transaction *schema.Transaction, id string, indexOfStepForWhichToReturnETag int) (*string, error) {
-	var etag *string
-	var executedStepCount = -1
-	for _, step := range transaction.Steps {
-		if step.Executed {
+// executes the steps which have not yet been executed. returns the ETag written by the step with the given index, unless it is
+// waiting, e.g. for its condition or for a step that it depends on, or -1 for none
+func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transaction *schema.Transaction, id string, indexOfStepForWhichToReturnETag int) (etag *string, err error) {
+	// remember which step failed on the transaction, so that it is recorded and persisted if the caller rolls back
+	currentStepIndex := -1
+	defer func() {
+		if err != nil {
+			transaction.RememberStepFailure(currentStepIndex, err)
+			r.requestPreemption(ctx, transaction, err)
+		}
+	}()
+
+	pending := make([]int, 0, len(transaction.Steps))
+	for i, step := range transaction.Steps {
+		if step.Executed || step.Skipped || step.IsDeferred() {
+			// conditional steps are executed during the commit, once their predicate is met
 			continue
-		} else {
-			step.Executed = true
-			executedStepCount++
 		}
+		pending = append(pending, i)
+	}
+	// in the order of the declared dependencies, rather than that in which the steps were added, so that steps which were waiting
+	// for the ones added now are executed after them
+	for _, i := range transaction.StepOrder(pending) {
+		step := transaction.Steps[i]
+		if !transaction.DependenciesApplied(step) {
+			// waits until the steps writing the paths that it depends on are added and executed, see DeclareDependency
+			continue
+		}
+		currentStepIndex = i
+		step.Executed = true
 
 		opts := minio.PutObjectOptions{
 			ContentType: step.ContentType,
@@ -837,20 +1427,48 @@ func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transacti
 		TODO cannot remove with this request, can only put
 		*/
 	
-		if step.Type == "update-remove-index" ||
-			step.Type == "delete-remove-index" {
+		if step.Type == schema.STEP_UPDATE_REMOVE_INDEX ||
+			step.Type == schema.STEP_DELETE_REMOVE_INDEX {
 			// left for the time being, removed on commit.
 			// that way, other transactions can still find the object based on the old index entries.i.e. snapshot isolation.
-		} else if step.Type == "insert-data" || // create new object
-				  step.Type == "insert-add-index" || // create new object
-				  step.Type == "insert-reverse-indices" || // create new object
-				  step.Type == "update-data" || // create new version of object
-				  step.Type == "update-add-index" || // create new object
-				  step.Type == "update-reverse-indices" || // create new version of object
-				  step.Type == "delete-data" || // create new version of object which is empty
-				  step.Type == "delete-reverse-indices" { // create new version of object which is empty
-
-			uploadInfo, err := r.Client.PutObject(ctx, r.BucketName, step.Path, bytes.NewReader(*step.Data), int64(len(*step.Data)), opts)
+		} else if step.Type == schema.STEP_INSERT_DATA || // create new object
+				  step.Type == schema.STEP_INSERT_ADD_INDEX || // create new object
+				  step.Type == schema.STEP_INSERT_REVERSE_INDICES || // create new object
+				  step.Type == schema.STEP_UPDATE_DATA || // create new version of object
+				  step.Type == schema.STEP_UPDATE_ADD_INDEX || // create new object
+				  step.Type == schema.STEP_UPDATE_INDEX_PROJECTION || // create new version of object
+				  step.Type == schema.STEP_UPDATE_REVERSE_INDICES || // create new version of object
+				  step.Type == schema.STEP_DELETE_DATA || // create new version of object which is empty
+				  step.Type == schema.STEP_DELETE_REVERSE_INDICES || // create new version of object which is empty
+				  step.Type == schema.STEP_EPHEMERAL { // create new version of a temporary object
+
+			if r.writeIntentsEnabled && step.Type.IsData() {
+				// before the version, so that any reader that finds the version also finds the intent
+				if err := r.putWriteIntent(ctx, transaction, step.Path); err != nil {
+					return nil, err
+				}
+			}
+			if step.Type.IsDelete() {
+				if err := r.pinInitialVersion(ctx, step); err != nil {
+					return nil, err
+				}
+			}
+			if step.Type == schema.STEP_UPDATE_INDEX_PROJECTION {
+				if opts.UserMetadata, err = r.rewriteMetadata(ctx, step); err != nil {
+					return nil, err
+				}
+			}
+			if step.RecordETag {
+				opts.UserMetadata = withRecordETag(transaction, i, opts.UserMetadata)
+			}
+			data, err := transaction.StepData(step)
+			if err != nil {
+				return nil, err
+			}
+			if data, err = storeStep(step, &opts, data); err != nil {
+				return nil, err
+			}
+			uploadInfo, err := r.Client.PutObject(ctx, r.BucketName, step.Path, bytes.NewReader(data), int64(len(data)), opts)
 			if err != nil {
 				respErr := minio.ToErrorResponse(err)
 				if respErr.StatusCode == http.StatusPreconditionFailed {
@@ -877,7 +1495,7 @@ func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transacti
 							objectTxId := object.UserMetadata[MINIO_META_PREFIX+schema.TX_ID]
 							for id, timeoutMicros := range transactionsInProgress {
 								if id == objectTxId {
-									return nil, &ObjectLockedErrorWithDetails[any]{Details: fmt.Sprintf("Object %s has already been written by transaction %s, which is set to expire by %d. Reload and try again.", step.Path, objectTxId, timeoutMicros), Object: step.Entity, DueByMsEpoch: timeoutMicros}
+									return nil, &ObjectLockedErrorWithDetails[any]{Details: fmt.Sprintf("Object %s has already been written by transaction %s, which is set to expire by %d. Reload and try again.", step.Path, objectTxId, timeoutMicros), Object: step.Entity, DueByMsEpoch: timeoutMicros, TransactionId: objectTxId}
 								}
 							}
 						}
@@ -885,10 +1503,12 @@ func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transacti
 							// it has been deleted, but the tombstone has not yet been cleared away.
 							// try inserting again, this time with no etag restrictions, since the tombstone is not relevant for the insert
 							opts.SetMatchETagExcept("this-etag-never-exists")
-							uploadInfo, err = r.Client.PutObject(ctx, r.BucketName, step.Path, bytes.NewReader(*step.Data), int64(len(*step.Data)), opts)
+							uploadInfo, err = r.Client.PutObject(ctx, r.BucketName, step.Path, bytes.NewReader(data), int64(len(data)), opts)
 							if err != nil {
 								return nil, fmt.Errorf("ADB-0020 failed to put object with Id %s to path %s: %w", id, step.Path, err)
 							}
+						} else if schema.IsUniquePath(step.Path) {
+							return nil, &UniqueViolationErrorWithDetails{Details: fmt.Sprintf("the value claimed at %s already belongs to a different entity", step.Path), Path: step.Path}
 						} else {
 							return nil, &DuplicateKeyErrorWithDetails{Details: fmt.Sprintf("object %s already exists", step.Path)}
 						}
@@ -904,7 +1524,7 @@ func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transacti
 			step.FinalETag = &uploadInfo.ETag
 			step.FinalVersionId = &uploadInfo.VersionID
 
-			if executedStepCount == indexOfStepForWhichToReturnETag {
+			if i == indexOfStepForWhichToReturnETag {
 				etag = step.FinalETag
 			}
 		} else {
@@ -914,35 +1534,35 @@ func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transacti
 		// /////////////////////////////////////
 		// update cache
 		// /////////////////////////////////////
+		switch step.Type {
 		// insert and update data are added
-		if(step.Type == "insert-data") {
-			transaction.Cache[step.Path] = &schema.ObjectAndETag{Object: step.Entity, ETag: step.FinalETag}
-		} else if (step.Type == "update-data") {
-			transaction.Cache[step.Path] = &schema.ObjectAndETag{Object: step.Entity, ETag: step.FinalETag}
+		case schema.STEP_INSERT_DATA, schema.STEP_UPDATE_DATA:
+			if step.Type == schema.STEP_UPDATE_DATA {
+				if step.InitialETag != "" {
+					step.PreviousETag = &step.InitialETag
+				} else if previous, ok := transaction.Cache[step.Path]; ok && previous != nil {
+					step.PreviousETag = previous.ETag
+				}
+			}
+			transaction.CacheWrite(step.Path, &schema.ObjectAndETag{Object: step.Entity, ETag: step.FinalETag})
 
 		// deleted data are removed
-		} else if (step.Type == "delete-data") {
-			transaction.Cache[step.Path] = nil
+		case schema.STEP_DELETE_DATA:
+			transaction.CacheWrite(step.Path, nil)
 
 		// insert and new update indices are added (delete never adds indices)
 		// yes, indices are also cached, since we add from the cache when inspecting the index entries
-		} else if (step.Type == "insert-add-index") {
-			transaction.Cache[step.Path] = &schema.ObjectAndETag{Object: step.Entity, ETag: step.FinalETag}
-		} else if (step.Type == "update-add-index") {
-			transaction.Cache[step.Path] = &schema.ObjectAndETag{Object: step.Entity, ETag: step.FinalETag}
+		case schema.STEP_INSERT_ADD_INDEX, schema.STEP_UPDATE_ADD_INDEX, schema.STEP_UPDATE_INDEX_PROJECTION:
+			transaction.CacheWrite(step.Path, &schema.ObjectAndETag{Object: step.Entity, ETag: step.FinalETag})
 
 		// old update indices are removed, because we shouldn't find entries based on old indices, at least not within the current transaction that change the index
-		} else if (step.Type == "update-remove-index") {
-			transaction.Cache[step.Path] = nil
-		} else if (step.Type == "delete-remove-index") {
-			transaction.Cache[step.Path] = nil
+		case schema.STEP_UPDATE_REMOVE_INDEX, schema.STEP_DELETE_REMOVE_INDEX:
+			transaction.CacheWrite(step.Path, nil)
 
-		// reverse indices are not added
-		} else if (step.Type == "insert-reverse-indices") {
-		} else if (step.Type == "update-reverse-indices") {
-		} else if (step.Type == "delete-reverse-indices") {
+		// reverse indices and temporary objects are not added
+		case schema.STEP_INSERT_REVERSE_INDICES, schema.STEP_UPDATE_REVERSE_INDICES, schema.STEP_DELETE_REVERSE_INDICES, schema.STEP_EPHEMERAL:
 
-		} else {
+		default:
 			return nil, fmt.Errorf("ADB-0003 Unexpected transaction step type %s, please contact abstratrium", step.Type)
 		}
 
@@ -952,8 +1572,46 @@ func (r *MinioRepository) executeTransactionSteps(ctx context.Context, transacti
 }
 
 // sql: select * from table_name where column1 matches(value1) (column1 is in an index)
+// like selectIndexEntriesBetween, for the entries of the records whose field is null, including those in the folder in which
+// they were indexed before they were indexed as null, see schema.LEGACY_NULL_INDEX_FOLDER
+func (r *MinioRepository) selectNullIndexEntries(ctx context.Context, transaction *schema.Transaction, index *schema.Index) (*util.MutList[string], map[string]string, error) {
+	paths, recordETags, err := r.selectIndexEntriesBetween(ctx, transaction, index.NullPathNoId()+"/", "", "", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	legacyPaths, legacyETags, err := r.selectIndexEntriesBetween(ctx, transaction, index.LegacyNullPathNoId()+"/", "", "", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, path := range legacyPaths.Items() {
+		paths.Add(path)
+	}
+	maps.Copy(recordETags, legacyETags)
+	return paths, recordETags, nil
+}
+
 func (r *MinioRepository) selectPathsFromTableWhereIndexedFieldMatches(ctx context.Context, transaction *schema.Transaction, prefix string, regex *regexp.Regexp) (*util.MutList[string], error) {
+	return r.selectPathsFromTableWhereIndexEntryBetween(ctx, transaction, prefix, "", "", regex)
+}
+
+// like selectPathsFromTableWhereIndexedFieldMatches, but only for the entries after startAfter and before the end, which are
+// ignored if they are empty. since entries are listed in order, only those in the range are listed.
+func (r *MinioRepository) selectPathsFromTableWhereIndexEntryBetween(ctx context.Context, transaction *schema.Transaction, prefix string, startAfter string, end string, regex *regexp.Regexp) (*util.MutList[string], error) {
+	paths, _, err := r.selectIndexEntriesBetween(ctx, transaction, prefix, startAfter, end, regex)
+	return paths, err
+}
+
+// like selectPathsFromTableWhereIndexEntryBetween, but also returns the ETags of the records of the entries, as they are in the
+// snapshot of the transaction, for those entries whose ETag is known, see schema.RECORD_ETAG
+func (r *MinioRepository) selectIndexEntriesBetween(ctx context.Context, transaction *schema.Transaction, prefix string, startAfter string, end string, regex *regexp.Regexp) (*util.MutList[string], map[string]string, error) {
 	matchingPaths := util.NewMutList[string]()
+	recordETags := make(map[string]string)
+	inRange := func(key string) bool {
+		return key > startAfter && (end == "" || key < end)
+	}
+	// so that the listing stops once it passes the end
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// only need one per path. this is like a poor mans set.
 	// but there can be multiple version, so only select the one that is older than the transaction start time.
@@ -964,7 +1622,7 @@ func (r *MinioRepository) selectPathsFromTableWhereIndexedFieldMatches(ctx conte
 
 	otherTransactionsInProgress, err := r.getOtherTransactionsInProgress(ctx, transaction)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	transactionIdsToIgnore := make([]string, 0, 10)
 	for id := range otherTransactionsInProgress {
@@ -974,6 +1632,7 @@ func (r *MinioRepository) selectPathsFromTableWhereIndexedFieldMatches(ctx conte
 	// Goroutine to list objects and send them to the channel
 	listOpts := minio.ListObjectsOptions{
 		Prefix: prefix,
+		StartAfter: startAfter,
 		Recursive: true,
 		WithMetadata: true,
 		// versions are irrelevant on index entries because we store no data, just the path. so we use the metadata to know if it was created after the tx started (e.g. by a different transaction)
@@ -981,11 +1640,18 @@ func (r *MinioRepository) selectPathsFromTableWhereIndexedFieldMatches(ctx conte
 	for object := range r.Client.ListObjects(ctx, r.BucketName, listOpts) {
 		if object.Err != nil {
 			errors.Add(object.Err)
+		} else if !inRange(object.Key) {
+			break
 		} else {
 			// last modified is used to ignore index entries that are created after the transaction started,
 			// since snapshot isolation requires that we see the state of the database as it was at the start 
 			// of the transaction, not afterwards.
 			// note, and index entry is never modified only ever created or tombstoned/deleted, so we don't need to worry about versions
+			// entries written by newer nodes may not mean what this node thinks that they mean
+			if err := checkFormatVersion(object.Key, object.UserMetadata[MINIO_META_PREFIX+schema.FORMAT_VERSION_KEY]); err != nil {
+				errors.Add(err)
+				continue
+			}
 			lastModifiedFromMetadata := object.UserMetadata[MINIO_META_PREFIX+schema.LAST_MODIFIED]
 			lastModified, err := strconv.ParseInt(lastModifiedFromMetadata, 10, 64)
 			if err != nil {
@@ -1007,6 +1673,22 @@ func (r *MinioRepository) selectPathsFromTableWhereIndexedFieldMatches(ctx conte
 				}
 			}
 
+			// the ETag of the record is only that of the snapshot if the version of the entry is
+			if etag := object.UserMetadata[MINIO_META_PREFIX+schema.RECORD_ETAG]; etag != "" && lastModified < transaction.StartMicroseconds &&
+				!slices.Contains(transactionIdsToIgnore, object.UserMetadata[MINIO_META_PREFIX+schema.TX_ID]) {
+				recordETags[object.Key] = etag
+			}
+
+			// a new projection of a covering index does not change when the entry was created
+			if rewritten := object.UserMetadata[MINIO_META_PREFIX+schema.ENTRY_REWRITE]; rewritten != "" {
+				if lastModified, err := strconv.ParseInt(rewritten, 10, 64); err != nil {
+					errors.Add(err)
+				} else if lastModified < transaction.StartMicroseconds {
+					relevantPaths[object.Key] = true
+				}
+				continue
+			}
+
 			if lastModified < transaction.StartMicroseconds {
 				// ignore other transactions that are still in progress
 				if !slices.Contains(transactionIdsToIgnore, object.UserMetadata[MINIO_META_PREFIX+schema.TX_ID]) {
@@ -1019,7 +1701,7 @@ func (r *MinioRepository) selectPathsFromTableWhereIndexedFieldMatches(ctx conte
 	// add anything from the cache that matches the path, because those have a LastModified in Minio that
 	// is newer than the tx start, but they are still relevant
 	for key := range transaction.Cache {
-		if strings.HasPrefix(key, prefix) {
+		if strings.HasPrefix(key, prefix) && inRange(key) {
 			relevantPaths[key] = true
 		}
 	}
@@ -1036,40 +1718,443 @@ func (r *MinioRepository) selectPathsFromTableWhereIndexedFieldMatches(ctx conte
 	}
 
 	if errors.Len() > 0 {
-		return matchingPaths, errors.Items()[0]
+		return matchingPaths, recordETags, errors.Items()[0]
 	}
 
-	return matchingPaths, nil
+	return matchingPaths, recordETags, nil
 }
 
 func getFieldValueAsString(obj any, fieldName string) (string, error) {
-	v := reflect.ValueOf(obj)
+	value, err := getIndexedFieldValue(obj, fieldName)
+	if err != nil || value == nil {
+		return "", err
+	}
+	return *value, nil
+}
+
+// returns the field of the entity, which is a struct, or a map with string keys, e.g. because it is read by a tool which does not
+// know the type of the entities, or a pointer to either. the keys of maps are matched like encoding/json matches the names of
+// fields, i.e. exactly, or else ignoring case, so that e.g. the field Id is the key `id`. a key that a map does not have, or
+// whose value is null, is a nil *string, so that it is null.
+func entityField(entity any, fieldName string) (reflect.Value, error) {
+	v := reflect.ValueOf(entity)
 
 	// If it's a pointer, get the value it points to
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
 
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+		null := reflect.Zero(reflect.TypeFor[*string]())
+		value := v.MapIndex(reflect.ValueOf(fieldName).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			for _, key := range v.MapKeys() {
+				if strings.EqualFold(key.String(), fieldName) {
+					value = v.MapIndex(key)
+					break
+				}
+			}
+		}
+		if !value.IsValid() {
+			return null, nil
+		}
+		if value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				return null, nil
+			}
+			value = value.Elem()
+		}
+		return value, nil
+	}
+
 	// Make sure we're dealing with a struct
 	if v.Kind() != reflect.Struct {
-		return "", fmt.Errorf("ADB-0020 expected a struct, got %s", v.Kind())
+		return reflect.Value{}, fmt.Errorf("ADB-0020 expected a struct, got %s", v.Kind())
 	}
 
 	// Get the field by name
 	field := v.FieldByName(fieldName)
 	if !field.IsValid() {
-		return "", fmt.Errorf("ADB-0021 no such field: %s", fieldName)
+		return reflect.Value{}, fmt.Errorf("ADB-0021 no such field: %s", fieldName)
+	}
+	return field, nil
+}
+
+// returns the value of a field that is indexed, or nil if the field is null, i.e. it is an empty string or a nil pointer to a string
+func getIndexedFieldValue(obj any, fieldName string) (*string, error) {
+	field, err := entityField(obj, fieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.String {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
 	}
 
 	// check it is a string, otherwise create an error
 	if field.Kind() != reflect.String {
-		return "", fmt.Errorf("ADB-0022 field %s is not a string", fieldName)
+		return nil, fmt.Errorf("ADB-0022 field %s is not a string", fieldName)
+	}
+
+	value := field.String()
+	if value == "" {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+// returns the value that the index uses for the given entity, either computed or read from the field, or nil if it is null.
+// the values of numeric and time indices are encoded, so that they sort numerically or chronologically.
+func getIndexValue(index *schema.Index, entity any) (*string, error) {
+	if index.Time {
+		t, err := getTimeIndexValue(index, entity)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		encoded, err := schema.EncodeTimeIndexValue(*t)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0281 failed to index the value of %s: %w", index.Field, err)
+		}
+		return &encoded, nil
+	}
+	if index.Decimal {
+		return getDecimalIndexValue(index, entity)
+	}
+	if index.Numeric {
+		number, err := getNumericIndexValue(index, entity)
+		if err != nil || number == nil {
+			return nil, err
+		}
+		encoded, err := schema.EncodeSortableNumber(*number)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0122 failed to index the value of %s: %w", index.Field, err)
+		}
+		return &encoded, nil
+	}
+	if index.Compute != nil {
+		value, err := index.Compute(entity)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0037 failed to compute value of index %s: %w", index.Field, err)
+		}
+		if value != nil && *value == "" {
+			return nil, nil
+		}
+		return value, nil
+	}
+	return getIndexedFieldValue(entity, index.Field)
+}
+
+// returns the values that the index uses for the given entity, which are none if it is null. indices over a JSON path, or a
+// field which is a slice, have a value for each element, and others have at most one, see getIndexValue.
+func getIndexValues(index *schema.Index, entity any) ([]string, error) {
+	leaves, multiple, err := getIndexElements(index, entity)
+	if err != nil {
+		return nil, err
+	}
+	if !multiple {
+		value, err := getIndexValue(index, entity)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return []string{*value}, nil
+	}
+	values := make([]string, 0, len(leaves))
+	for _, leaf := range leaves {
+		value, err := encodeIndexElement(index, leaf)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil && !slices.Contains(values, *value) {
+			values = append(values, *value)
+		}
 	}
+	return values, nil
+}
 
-	return field.Interface().(string), nil
+// returns the elements of an index over a JSON path, or over a field which is a slice, as they are in JSON, i.e. strings,
+// float64, booleans or nil, and true, or false if the index has a single value
+func getIndexElements(index *schema.Index, entity any) ([]any, bool, error) {
+	if index.JsonPath {
+		leaves, err := getJsonPathIndexLeaves(index, entity)
+		return leaves, true, err
+	}
+	if index.Compute != nil {
+		return nil, false, nil
+	}
+	field, err := entityField(entity, index.Field)
+	if err != nil || field.Kind() != reflect.Slice || field.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false, nil
+	}
+	elements := make([]any, 0, field.Len())
+	for i := range field.Len() {
+		element := field.Index(i)
+		if element.Kind() == reflect.Ptr {
+			if element.IsNil() {
+				elements = append(elements, nil)
+				continue
+			}
+			element = element.Elem()
+		}
+		if t, ok := element.Interface().(time.Time); ok {
+			if t.IsZero() {
+				elements = append(elements, nil)
+			} else {
+				elements = append(elements, t.Format(time.RFC3339Nano))
+			}
+			continue
+		}
+		switch {
+		case element.Kind() == reflect.String:
+			elements = append(elements, element.String())
+		case element.Kind() == reflect.Bool:
+			elements = append(elements, element.Bool())
+		case element.CanInt():
+			elements = append(elements, float64(element.Int()))
+		case element.CanUint():
+			elements = append(elements, float64(element.Uint()))
+		case element.CanFloat():
+			elements = append(elements, element.Float())
+		default:
+			elements = append(elements, element.Interface())
+		}
+	}
+	return elements, true, nil
 }
 
-// returns a map of txId to timeoutMicros, excluding the given transaction
+// returns the values at the JSON path of the index, in the JSON that the entity is marshalled into
+func getJsonPathIndexLeaves(index *schema.Index, entity any) ([]any, error) {
+	segments, err := schema.ParseJsonPath(index.Field)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0134 failed to evaluate the JSON path of index %s: %w", index.Field, err)
+	}
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("ADB-0134 failed to evaluate the JSON path of index %s: %w", index.Field, err)
+	}
+	return schema.EvaluateJsonPath(segments, document), nil
+}
+
+// returns an element of an index with several values as it is indexed, i.e. encoded if the index is numeric or over time, or nil
+// if it is null
+func encodeIndexElement(index *schema.Index, leaf any) (*string, error) {
+	var value string
+	switch leaf := leaf.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		value = leaf
+	case float64:
+		value = strconv.FormatFloat(leaf, 'g', -1, 64)
+	case bool:
+		value = strconv.FormatBool(leaf)
+	default:
+		return nil, fmt.Errorf("ADB-0134 the values of index %s must be strings, numbers, booleans, times or null", index.Field)
+	}
+	if value == "" {
+		return nil, nil
+	}
+	switch {
+	case index.Time:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0282 the value %s of the time index %s is not an RFC 3339 time: %w", value, index.Field, err)
+		}
+		encoded, err := schema.EncodeTimeIndexValue(t)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0283 failed to index the value of %s: %w", index.Field, err)
+		}
+		return &encoded, nil
+	case index.Decimal:
+		encoded, err := schema.EncodeSortableDecimal(value)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0352 failed to index the value of %s: %w", index.Field, err)
+		}
+		return &encoded, nil
+	case index.Numeric:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0312 the value %s of the numeric index %s is not a number: %w", value, index.Field, err)
+		}
+		encoded, err := schema.EncodeSortableNumber(number)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0313 failed to index the value of %s: %w", index.Field, err)
+		}
+		return &encoded, nil
+	}
+	return &value, nil
+}
+
+// returns the number that a numeric index uses for the given entity, or nil if it is null, i.e. a nil pointer. computed values are
+// parsed as numbers.
+func getNumericIndexValue(index *schema.Index, entity any) (*float64, error) {
+	if index.Compute != nil {
+		value, err := index.Compute(entity)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0037 failed to compute value of index %s: %w", index.Field, err)
+		}
+		if value == nil || *value == "" {
+			return nil, nil
+		}
+		number, err := strconv.ParseFloat(*value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0314 the computed value %s of the numeric index %s is not a number: %w", *value, index.Field, err)
+		}
+		return &number, nil
+	}
+
+	field, err := entityField(entity, index.Field)
+	if err != nil {
+		return nil, err
+	}
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
+	}
+	var number float64
+	switch {
+	case field.CanInt():
+		number = float64(field.Int())
+	case field.CanUint():
+		number = float64(field.Uint())
+	case field.CanFloat():
+		number = field.Float()
+	default:
+		return nil, fmt.Errorf("ADB-0315 field %s of the numeric index is not a number", index.Field)
+	}
+	return &number, nil
+}
+
+// returns the time that a time index uses for the given entity, or nil if it is null, i.e. a nil pointer or the zero time.
+// strings, including computed values, are parsed as RFC 3339.
+func getTimeIndexValue(index *schema.Index, entity any) (*time.Time, error) {
+	var value string
+	if index.Compute != nil {
+		computed, err := index.Compute(entity)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0037 failed to compute value of index %s: %w", index.Field, err)
+		}
+		if computed == nil {
+			return nil, nil
+		}
+		value = *computed
+	} else {
+		field, err := entityField(entity, index.Field)
+		if err != nil {
+			return nil, err
+		}
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return nil, nil
+			}
+			field = field.Elem()
+		}
+		if t, ok := field.Interface().(time.Time); ok {
+			if t.IsZero() {
+				return nil, nil
+			}
+			return &t, nil
+		}
+		if field.Kind() != reflect.String {
+			return nil, fmt.Errorf("ADB-0284 field %s of the time index is neither a time nor a string", index.Field)
+		}
+		value = field.String()
+	}
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0285 the value %s of the time index %s is not an RFC 3339 time: %w", value, index.Field, err)
+	}
+	return &t, nil
+}
+
+// returns the value that index entries have for a value that is queried, i.e. encoded, if the index is numeric, or over time, in
+// which case the value is an RFC 3339 time
+func getIndexLookupValue(index *schema.Index, value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	if index.Time {
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return "", fmt.Errorf("ADB-0286 the value %s queried from the time index %s is not an RFC 3339 time: %w", value, index.Field, err)
+		}
+		// as it is written
+		return schema.EncodeTimeIndexValue(index.Table.Codec.NormalizeTime(t))
+	}
+	if index.Decimal {
+		encoded, err := schema.EncodeSortableDecimal(value)
+		if err != nil {
+			return "", fmt.Errorf("ADB-0353 the value %s queried from the decimal index %s is not a decimal: %w", value, index.Field, err)
+		}
+		return encoded, nil
+	}
+	if !index.Numeric {
+		return value, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", fmt.Errorf("ADB-0316 the value %s queried from the numeric index %s is not a number: %w", value, index.Field, err)
+	}
+	return schema.EncodeSortableNumber(number)
+}
+
+func sparseIndexError(index *schema.Index) error {
+	return fmt.Errorf("ADB-0151 the index %s cannot be queried for null, since it is sparse, see WithSparseIndex", index.Field)
+}
+
+// returns the paths of the index entries for the given entity, i.e. one, unless the index is over a JSON path with several values.
+// fields that are null are indexed in a dedicated folder, so that they can be found without a full table scan, unless the index
+// is sparse. returns no paths
+// if the entity has no entry, since it does not match the filter of a partial index.
+func getIndexPaths(index schema.Index, entity any, id string) ([]string, error) {
+	if indexed, err := isIndexed(&index, entity); err != nil || !indexed {
+		return nil, err
+	}
+	values, err := getIndexValues(&index, entity)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		if index.Sparse {
+			return nil, nil
+		}
+		return []string{index.NullPath(id)}, nil
+	}
+	paths := make([]string, 0, len(values))
+	for _, value := range values {
+		// values which are collated alike share an entry
+		if path := index.Path(value, id); !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// true if the entity has an entry in the index, i.e. the index is not partial, or the entity matches its filter
+func isIndexed(index *schema.Index, entity any) (bool, error) {
+	if index.Filter == nil {
+		return true, nil
+	}
+	indexed, err := index.Filter(entity)
+	if err != nil {
+		return false, fmt.Errorf("ADB-0128 failed to evaluate the filter of index %s: %w", index.Field, err)
+	}
+	return indexed, nil
+}
+
+// returns a map of txId to timeoutMicros, excluding the given transaction. only the transactions of the tenant of the transaction
+// are listed, since only they write the objects of its tenant.
 func (r *MinioRepository) getOtherTransactionsInProgress(ctx context.Context, tx *schema.Transaction) (map[string]uint64, error) {
 	transactionsInProgress := make(map[string]uint64, 10)
 	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
@@ -1079,6 +2164,10 @@ func (r *MinioRepository) getOtherTransactionsInProgress(ctx context.Context, tx
 		if object.Err != nil {
 			return nil, object.Err
 		}
+		if object.Key == tx.GetArchiveRootPath() {
+			// committed transactions
+			continue
+		}
 		id, timeoutMicros := tx.GetIdAndTimeoutMicrosFromPath(object.Key)
 		if id != tx.Id {
 			transactionsInProgress[id] = timeoutMicros
@@ -1091,8 +2180,15 @@ func (r *MinioRepository) getOtherTransactionsInProgress(ctx context.Context, tx
 // Ignores all versions from other transactions that are still in progress.
 func (r *MinioRepository) readObjectVersionForTransaction(ctx context.Context, tx *schema.Transaction, path string) (*[]byte, *string, error) {
 	// TODO move the following up a level and require that open transaction IDs are passed in, so that they aren't read multiple times?
+	if r.writeIntentsEnabled {
+		transactionIdsToIgnore, err := r.getTransactionsToIgnoreFromWriteIntents(ctx, tx, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r.readObjectVersionIgnoring(ctx, tx, path, transactionIdsToIgnore)
+	}
+
 	transactionIdsToIgnore := make([]string, 0, 10)
-	var etag *string
 	transactionsInProgress, err := r.getOtherTransactionsInProgress(ctx, tx)
 	if err != nil {
 		return nil, nil, err
@@ -1105,7 +2201,13 @@ func (r *MinioRepository) readObjectVersionForTransaction(ctx context.Context, t
 	for id := range transactionsInProgress {
 		transactionIdsToIgnore = append(transactionIdsToIgnore, id)
 	}
+	return r.readObjectVersionIgnoring(ctx, tx, path, transactionIdsToIgnore)
+}
 
+// like readObjectVersionForTransaction, but with the transactions that were in progress already known, so that several reads
+// can share the same snapshot
+func (r *MinioRepository) readObjectVersionIgnoring(ctx context.Context, tx *schema.Transaction, path string, transactionIdsToIgnore []string) (*[]byte, *string, error) {
+	var etag *string
 	versionToRead := ""
 	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
 		Prefix:       path, // full path of object we are reading
@@ -1121,6 +2223,9 @@ func (r *MinioRepository) readObjectVersionForTransaction(ctx context.Context, t
 		if objectLastModifiedMicros < tx.StartMicroseconds {
 			// ignore other transactions that are still in progress
 			if !slices.Contains(transactionIdsToIgnore, object.UserMetadata[MINIO_META_PREFIX+schema.TX_ID]) {
+				if err := checkFormatVersion(path, object.UserMetadata[MINIO_META_PREFIX+schema.FORMAT_VERSION_KEY]); err != nil {
+					return nil, nil, err
+				}
 				versionToRead = object.VersionID
 				etag = &object.ETag
 				break
@@ -1146,18 +2251,32 @@ func (r *MinioRepository) readObjectVersionForTransaction(ctx context.Context, t
 	}
 	defer objectData.Close()
 
-	b, err := io.ReadAll(objectData)
+	b, err := readObject(objectData)
 	if err != nil {
 		return nil, nil, err
 	}
 	return &b, etag, nil
 }
 
+// begins a transaction which times out after the given duration, or after schema.DefaultTimeout if it is zero. it may not be
+// longer than schema.MaxTimeout
 func (r *MinioRepository) BeginTransaction(ctx context.Context, timeout time.Duration) (schema.Transaction, error) {
-	if timeout.Microseconds() > MAX_TX_TIMEOUT_MICROS {
-		return schema.Transaction{}, fmt.Errorf("ADB-0024 timeout %d is too long, max is %d", timeout.Microseconds(), MAX_TX_TIMEOUT_MICROS)
+	return r.BeginTransactionForTenant(ctx, schema.DEFAULT_TENANT, timeout)
+}
+
+// begins a transaction of the tenant, which is stored below the prefix of the tenant, and may only write to its tables, see
+// schema.Table.WithTenant. it sees the changes of other transactions of the tenant as uncommitted while they are in progress,
+// so it should only read the tables of the tenant too. internal tables belong to the default tenant, except the outbox, of which
+// each tenant has its own, see MessageTemplate.Enqueue.
+func (r *MinioRepository) BeginTransactionForTenant(ctx context.Context, tenant schema.Tenant, timeout time.Duration) (schema.Transaction, error) {
+	if timeout == 0 {
+		timeout = schema.DefaultTimeout()
+	}
+	if timeout > schema.MaxTimeout() {
+		return schema.Transaction{}, fmt.Errorf("ADB-0024 timeout %d is too long, max is %d", timeout.Microseconds(), schema.MaxTimeout().Microseconds())
 	}
 	tx := schema.NewTransaction(timeout)
+	tx.Tenant = tenant
 	err := r.updateTransaction(ctx, &tx)
 	if err != nil {
 		respErr := minio.ToErrorResponse(err)
@@ -1170,13 +2289,42 @@ func (r *MinioRepository) BeginTransaction(ctx context.Context, timeout time.Dur
 	return tx, nil
 }
 
+// returns a read-only transaction, without writing anything to the bucket. it does not need to be committed. the timeout is
+// like that of BeginTransaction.
+func (r *MinioRepository) BeginReadOnlyTransaction(timeout time.Duration) (schema.Transaction, error) {
+	return r.BeginReadOnlyTransactionForTenant(schema.DEFAULT_TENANT, timeout)
+}
+
+// returns a read-only transaction which reads the tables of the tenant, ignoring the changes of the transactions of the tenant
+// which are in progress
+func (r *MinioRepository) BeginReadOnlyTransactionForTenant(tenant schema.Tenant, timeout time.Duration) (schema.Transaction, error) {
+	if timeout == 0 {
+		timeout = schema.DefaultTimeout()
+	}
+	if timeout > schema.MaxTimeout() {
+		return schema.Transaction{}, fmt.Errorf("ADB-0024 timeout %d is too long, max is %d", timeout.Microseconds(), schema.MaxTimeout().Microseconds())
+	}
+	tx := schema.NewReadOnlyTransaction(timeout)
+	tx.Tenant = tenant
+	return tx, nil
+}
+
 func (r *MinioRepository) updateTransaction(ctx context.Context, transaction *schema.Transaction) error {
+	if transaction.ReadOnly {
+		// never persisted, since there is nothing to recover
+		return nil
+	}
 	json, err := json.Marshal(transaction)
 	if err != nil {
 		return err
 	}
 	opts := minio.PutObjectOptions{
 		ContentType: "application/json",
+		// so that large transactions which are stuck can be found without downloading each one
+		UserMetadata: map[string]string{
+			schema.STEP_COUNT: strconv.Itoa(len(transaction.Steps)),
+			schema.APPROXIMATE_SIZE: strconv.FormatInt(transaction.ApproximateSize()+int64(len(json)), 10),
+		},
 	}
 	if transaction.Etag == "*" {
 		opts.SetMatchETagExcept(transaction.Etag)
@@ -1196,9 +2344,24 @@ func (r *MinioRepository) updateTransaction(ctx context.Context, transaction *sc
 	return nil
 }
 
+// returns the transactions of all tenants which are in progress
 func (r *MinioRepository) GetTransactionsInProgress(ctx context.Context, transactions *[]schema.Transaction) error {
+	tenants, err := r.allTenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := r.getTransactionsInProgressOfTenant(ctx, tenant, transactions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MinioRepository) getTransactionsInProgressOfTenant(ctx context.Context, tenant schema.Tenant, transactions *[]schema.Transaction) error {
 	// read all objects in the transactions folder
 	tx := schema.NewTransaction(0)
+	tx.Tenant = tenant
 	objectCh := r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
 		Prefix:    tx.GetRootPath(),
 		Recursive: false,
@@ -1207,6 +2370,10 @@ func (r *MinioRepository) GetTransactionsInProgress(ctx context.Context, transac
 		if object.Err != nil {
 			return object.Err
 		}
+		if object.Key == tx.GetArchiveRootPath() {
+			// committed transactions
+			continue
+		}
 
 		// read the actual tx
 		txData, err := r.Client.GetObject(ctx, r.BucketName, object.Key+TX_FILENAME, minio.GetObjectOptions{})
@@ -1224,61 +2391,341 @@ func (r *MinioRepository) GetTransactionsInProgress(ctx context.Context, transac
 		if err := json.Unmarshal(b, &transaction); err != nil {
 			return err
 		}
+		// the persisted ETag is that of the version before, so use the actual one, in order that the transaction can be updated
+		// when it is recovered
+		info, err := txData.Stat()
+		if err != nil {
+			return err
+		}
+		transaction.Etag = info.ETag
 		*transactions = append(*transactions, *transaction)
 	}
 	return nil
 }
 
+// the outcome of a commit
+type CommitResult struct {
+	// true once the changes are visible to other transactions, even if errors occurred afterwards, e.g. while archiving
+	Committed bool
+
+	// the index of the step which failed to be applied during the commit, or -1
+	FailedStepIndex int
+
+	// true if the transaction was rolled back, because it could not be committed, e.g. because a step failed to be applied
+	RolledBack bool
+
+	// the final ETag and version of every path that was written, once committed
+	Report *CommitReport
+
+	Errors []error
+
+	// failures of bookkeeping which do not affect the outcome, e.g. appending to the commit journal, or removing the objects spilled
+	// from the cache, once the transaction is committed
+	Warnings []error
+}
+
+// commits the transaction. returns the errors of CommitWithResult, but not its warnings
 func (r *MinioRepository) Commit(ctx context.Context, tx *schema.Transaction) []error {
+	return r.CommitWithResult(ctx, tx).Errors
+}
+
+// commits the transaction, like Commit. if a step fails to be applied, the steps that were already applied during the commit
+// are undone, and the transaction is rolled back, restoring the versions that existed before it, so that nothing is left
+// half committed.
+func (r *MinioRepository) CommitWithResult(ctx context.Context, tx *schema.Transaction) *CommitResult {
+	result := &CommitResult{FailedStepIndex: -1}
+	start := schema.Now()
+	defer func() {
+		r.recordDuration(ctx, METRIC_COMMIT_DURATION, start, map[string]string{"outcome": commitOutcome(result)})
+	}()
 	if err := tx.IsOk(); err != nil {
-		return []error{err} // do not wrap with fmt.Errorf...
+		result.Errors = []error{err} // do not wrap with fmt.Errorf...
+		return result
+	}
+	if tx.HasDeferredSteps() {
+		if err := r.executeConditionalSteps(ctx, tx); err != nil {
+			tx.RecordFailure(-1, err)
+			result.Errors = append([]error{err}, r.Rollback(ctx, tx)...)
+			result.RolledBack = true
+			return result
+		}
+	}
+
+	// steps still waiting for those that they depend on cannot be applied
+	if err := tx.CheckDependenciesApplied(); err != nil {
+		tx.RecordFailure(-1, err)
+		result.Errors = append([]error{err}, r.Rollback(ctx, tx)...)
+		result.RolledBack = true
+		return result
+	}
+
+	if err := tx.ValidateForCommit(); err != nil {
+		tx.RecordFailure(-1, err)
+		result.Errors = append([]error{err}, r.Rollback(ctx, tx)...)
+		result.RolledBack = true
+		return result
+	}
+
+	// ask all participants whether they can commit, before making the decision
+	for _, participant := range tx.Participants {
+		if err := participant.Prepare(ctx, tx); err != nil {
+			err = fmt.Errorf("ADB-0046 Participant failed to prepare tx %s, rolling back. %w", tx.GetPath(), err)
+			tx.RecordFailure(-1, err)
+			result.Errors = append([]error{err}, r.Rollback(ctx, tx)...)
+			result.RolledBack = true
+			return result
+		}
+	}
+
+	// the lease of a single writer table may have expired since the steps were added, so that another process may be writing to it
+	if err := r.checkLeasesOfTransaction(tx); err != nil {
+		tx.RecordFailure(-1, err)
+		result.Errors = append([]error{err}, r.Rollback(ctx, tx)...)
+		result.RolledBack = true
+		return result
 	}
+
 	errs := make([]error, 0, 10) // remove as much as possible
 	tx.State = "Committing"
 	err := r.updateTransaction(ctx, tx) // store in case this process fails and needs recovering
 	if err != nil {
 		errs = append(errs, fmt.Errorf("ADB-0004 Failed to update tx file %s during commit. %w", tx.GetPath(), err))
-		return errs // fail fast
+		tx.RecordFailure(-1, errs[0])
+		result.Errors = errs
+		return result // fail fast
 	}
+	failedStepIndex := -1
+	applied := make([]appliedCommitStep, 0, 10) // so that they can be undone, if a later one fails
 
-	// go through each transaction step in reverse order and delete exactly that version
+	// go through each transaction step in reverse order and delete exactly that version.
+	// independent steps are applied in parallel, and those that depend on others once those have been applied.
+	toApply := make([]int, 0, len(tx.Steps))
 	for i := len(tx.Steps) - 1; i >= 0; i-- {
 		step := tx.Steps[i]
+		if step.Skipped {
+			continue
+		}
+		// the entries of deleted objects are left in place, but claims on unique values are released
+		if step.Type == schema.STEP_UPDATE_REMOVE_INDEX || (step.Type == schema.STEP_DELETE_REMOVE_INDEX && schema.IsUniquePath(step.Path)) {
+			toApply = append(toApply, i)
+		} // else no others are touched during commit
+	}
+	for _, wave := range tx.StepWaves(toApply) {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		semaphore := make(chan struct{}, COMMIT_PARALLELISM)
+		for _, i := range wave {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				stepApplied, err := r.applyCommitStep(ctx, tx.Steps[i])
+				mu.Lock()
+				defer mu.Unlock()
+				applied = append(applied, stepApplied...)
+				if err != nil {
+					errs = append(errs, err)
+					if failedStepIndex < 0 {
+						failedStepIndex = i
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		if failedStepIndex >= 0 {
+			break
+		}
+	}
 
-		if step.Type == "update-remove-index" {
-			// turn it into a "tombstone" and mark it to be cleared up at a later date.
-			// it still needs to be around for any active transactions (potentially on different pods)
-			// so that we fulfil snapshot isolation, and they can find records as they were at the start
-			// of their transaction.
+	// taken before the changes become visible, so that anything which starts after it can see them
+	commitMicros := schema.Now().UnixMicro()
 
-			until := fmt.Sprintf("%d", time.Now().Add(MAX_TX_TIMEOUT_MICROS * time.Microsecond).UnixMicro())
+	// written before the changes become visible, rather than afterwards, so that no committed transaction is missing from the
+	// change log. if it cannot be written, the transaction is rolled back, like when a step fails to be applied
+	if failedStepIndex < 0 && r.changeLogEnabled && !tx.ReadOnly {
+		if err := r.appendToChangeLog(ctx, tx, commitMicros); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-			// first create a garbage collection entry for the index
-			contents := []byte(step.Path)
-			gcPath := GC_ROOT + until
-			_, err := r.Client.PutObject(ctx, r.BucketName, gcPath, bytes.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{})
-			if err != nil {
-				errs = append(errs, fmt.Errorf("ADB-0016 Failed to put gc entry at path %s, %w", gcPath, err))
-			}
+	if len(errs) > 0 {
+		// nothing is visible yet, so undo what was applied and roll back, rather than leaving the transaction half committed
+		result.FailedStepIndex = failedStepIndex
+		tx.RecordFailure(failedStepIndex, errs[0])
+		errs = append(errs, r.undoCommitSteps(ctx, tx, applied)...)
+		errs = append(errs, r.rollback(ctx, tx)...)
+		result.RolledBack = true
+		result.Errors = errs
+		return result
+	}
 
-			// then create the tombstone version of the index entry
-			step.UserMetadata[TOMBSTONE_AND_EXISTS_UNTIL] = until
-			opts := minio.PutObjectOptions{
-				ContentType: step.ContentType,
-				UserMetadata: step.UserMetadata,
-			}
-			_, err = r.Client.PutObject(ctx, r.BucketName, step.Path, bytes.NewReader([]byte("")), int64(0), opts)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("ADB-0005 Failed to put tombstone object at path %s, %w", step.Path, err))
-			}
-		} // else no others are touched during commit
+	// the decision was persisted above, so the participants must now commit too
+	for _, participant := range tx.Participants {
+		if err := participant.Commit(ctx, tx); err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0047 Participant failed to commit tx %s, %w", tx.GetPath(), err))
+		}
 	}
 
-	if len(errs) == 0 {
+	if len(errs) == 0 && !tx.ReadOnly {
+		// journalled before the changes become visible, so that a transaction which depends on them is journalled after it.
+		// the transaction is committed anyway, if that fails, so such failures are warnings, rather than errors
+		if r.journalEnabled {
+			result.Warnings = append(result.Warnings, r.appendToJournal(ctx, tx, commitMicros)...)
+		}
+
 		// delete the transaction
 		governanceBypass := true // transactions are not subject to governance
 		if err := r.DeleteFolder(ctx, tx.GetPath(), governanceBypass, true); err != nil {
 			errs = append(errs, fmt.Errorf("ADB-0006 Failed to remove tx during commit %s, %w", tx.GetPath(), err))
+		} else {
+			result.Committed = true
+			result.Report = newCommitReport(tx, commitMicros)
+			// the changes are now visible, so invalidate anything derived from the tables that were written
+			errs = append(errs, r.bumpTableGenerations(ctx, tx)...)
+			if r.writeIntentsEnabled {
+				errs = append(errs, r.removeWriteIntents(ctx, tx)...)
+			}
+			// left behind, they are removed by the garbage collection
+			if err := r.ReleaseCacheSpill(ctx, tx); err != nil {
+				result.Warnings = append(result.Warnings, err)
+			}
+			if err := r.releaseEphemerals(ctx, tx); err != nil {
+				errs = append(errs, err)
+			}
+			// loaded once, so that the transaction is archived with the retention that decided to archive it
+			if retention := time.Duration(r.archiveRetention.Load()); retention > 0 {
+				if err := r.archiveTransaction(ctx, tx, retention); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	} else {
+		// the transaction file is left in place, so record why, for post-mortem debugging
+		tx.RecordFailure(failedStepIndex, errs[0])
+		if err := r.updateTransaction(ctx, tx); err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0036 Failed to record the failure on tx file %s during commit. %w", tx.GetPath(), err))
+		}
+	}
+	result.Errors = errs
+	return result
+}
+
+// an object version which was written during a commit
+type appliedCommitStep struct {
+	path      string
+	versionId string
+}
+
+// evaluates the predicates of the conditional steps, and executes those which are met, before the commit decision is made
+func (r *MinioRepository) executeConditionalSteps(ctx context.Context, tx *schema.Transaction) error {
+	if !tx.EvaluateConditions() {
+		return r.updateTransaction(ctx, tx) // which steps were skipped
+	}
+	if err := r.updateTransaction(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := r.executeTransactionSteps(ctx, tx, "", -1); err != nil {
+		return err
+	}
+	return r.updateTransaction(ctx, tx)
+}
+
+// applies a step which removes an index entry, during the commit. it is turned into a "tombstone" and marked to be cleared up at a
+// later date. it still needs to be around for any active transactions (potentially on different pods) so that we fulfil snapshot
+// isolation, and they can find records as they were at the start of their transaction.
+// returns the versions that were written, so that they can be undone if the commit fails.
+func (r *MinioRepository) applyCommitStep(ctx context.Context, step *schema.TransactionStep) ([]appliedCommitStep, error) {
+	until := fmt.Sprintf("%d", schema.Now().Add(schema.MaxTimeout()).UnixMicro())
+
+	applied := make([]appliedCommitStep, 0, 2)
+	if !schema.IsUniquePath(step.Path) {
+		// first create a garbage collection entry for the index.
+		// claims on unique values are not collected, since the value may since have been claimed again, and their empty
+		// version is enough for it to be claimed.
+		contents := []byte(step.Path)
+		gcPath := GC_ROOT + until
+		gcInfo, err := r.Client.PutObject(ctx, r.BucketName, gcPath, bytes.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0016 Failed to put gc entry at path %s, %w", gcPath, err)
+		}
+		applied = append(applied, appliedCommitStep{path: gcPath, versionId: gcInfo.VersionID})
+	}
+
+	// then create the tombstone version of the index entry
+	step.UserMetadata[TOMBSTONE_AND_EXISTS_UNTIL] = until
+	opts := minio.PutObjectOptions{
+		ContentType: step.ContentType,
+		UserMetadata: step.UserMetadata,
+	}
+	if _, err := storeStep(step, &opts, nil); err != nil {
+		return applied, err
+	}
+	tombstoneInfo, err := r.Client.PutObject(ctx, r.BucketName, step.Path, bytes.NewReader([]byte("")), int64(0), opts)
+	if err != nil {
+		return applied, fmt.Errorf("ADB-0005 Failed to put tombstone object at path %s, %w", step.Path, err)
+	}
+	applied = append(applied, appliedCommitStep{path: step.Path, versionId: tombstoneInfo.VersionID})
+	step.SetFinalETagAndVersionId(&tombstoneInfo.ETag, &tombstoneInfo.VersionID)
+	return applied, nil
+}
+
+// records the version that a delete step replaces with a tombstone, so that exactly that version can be restored on rollback.
+// if the step requires a particular ETag, the version is only pinned if it has that ETag, since the put will fail otherwise.
+func (r *MinioRepository) pinInitialVersion(ctx context.Context, step *schema.TransactionStep) error {
+	info, exists, err := r.statObject(ctx, step.Path)
+	if err != nil {
+		return err
+	}
+	if exists && info.Size > 0 && (step.InitialETag == "" || info.ETag == step.InitialETag) {
+		step.InitialVersionId = info.VersionID
+	}
+	return nil
+}
+
+// makes the version that a delete step replaced the latest one again, after the versions written by the transaction have been
+// removed. normally removing the tombstone suffices, but if it could not be identified, or the pinned version is no longer the
+// latest, it is copied, so that the object is not left deleted.
+func (r *MinioRepository) restorePinnedVersion(ctx context.Context, tx *schema.Transaction, step *schema.TransactionStep) error {
+	info, exists, err := r.statObject(ctx, step.Path)
+	if err != nil {
+		return err
+	}
+	if exists && info.VersionID == step.InitialVersionId {
+		return nil
+	}
+	if exists && info.UserMetadata[schema.TX_ID] != tx.Id && info.Size > 0 {
+		// another transaction has since written the object, so restoring would overwrite its version
+		return nil
+	}
+	dest := minio.CopyDestOptions{
+		Bucket: r.BucketName,
+		Object: step.Path,
+	}
+	if err := storeCopy(step.Storage, &dest); err != nil {
+		return err
+	}
+	_, err = r.Client.CopyObject(ctx, dest, minio.CopySrcOptions{
+		Bucket:    r.BucketName,
+		Object:    step.Path,
+		VersionID: step.InitialVersionId,
+	})
+	if err != nil {
+		return fmt.Errorf("ADB-0112 Failed to restore version %s of path %s during rollback of tx %s, %w", step.InitialVersionId, step.Path, tx.GetPath(), err)
+	}
+	return nil
+}
+
+// removes the versions written during the commit, in reverse order, so that the versions before them are the latest again
+func (r *MinioRepository) undoCommitSteps(ctx context.Context, tx *schema.Transaction, applied []appliedCommitStep) []error {
+	errs := make([]error, 0)
+	for i := len(applied) - 1; i >= 0; i-- {
+		err := r.Client.RemoveObject(ctx, r.BucketName, applied[i].path, minio.RemoveObjectOptions{
+			VersionID:        applied[i].versionId,
+			GovernanceBypass: true,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0079 Failed to undo the version %s of path %s written during the commit of tx %s, %w", applied[i].versionId, applied[i].path, tx.GetPath(), err))
 		}
 	}
 	return errs
@@ -1293,8 +2740,22 @@ func (r *MinioRepository) Rollback(ctx context.Context, tx *schema.Transaction)
 		}
 	}
 
+	if stepIndex, err := tx.StepFailure(); err != nil {
+		// usually the reason that the caller rolls back
+		tx.RecordFailure(stepIndex, err)
+	}
+	if tx.IsExpired() {
+		tx.RecordFailure(-1, schema.TransactionTimedOutError)
+	} else {
+		tx.RecordFailure(-1, schema.TransactionRolledBackByCallerError) // unless a step failed beforehand
+	}
+	return r.rollback(ctx, tx)
+}
+
+// removes exactly the versions written by the steps of the transaction, and then the transaction itself
+func (r *MinioRepository) rollback(ctx context.Context, tx *schema.Transaction) []error {
 	tx.State = "RollingBack"
-	err := r.updateTransaction(ctx, tx) // store in case this process fails and needs recovering
+	err := r.updateTransaction(ctx, tx) // store in case this process fails and needs recovering, including the abort reason
 	if err != nil {
 		return []error{err}
 	}
@@ -1302,86 +2763,156 @@ func (r *MinioRepository) Rollback(ctx context.Context, tx *schema.Transaction)
 	errs := make([]error, 0, 10) // remove as much as possible
 	// go through each transaction step in reverse order and delete exactly that version
 	for i := len(tx.Steps) - 1; i >= 0; i-- {
-		step := tx.Steps[i]
+		errs = append(errs, r.rollbackStep(ctx, tx, tx.Steps[i])...)
+	}
 
-		if step.Type == "insert-data" || // remove the newly inserted version of the object
-		   step.Type == "insert-reverse-indices" || // exists for the object key, containing the current list of index files - remove version that was added
-		   step.Type == "update-data" || // remove the version that was updated
-		   step.Type == "update-reverse-indices" || // exists for the object key, containing the current list of index files - remove version that was added
-		   step.Type == "delete-data" || // remove the version that was deleted (the tombstone)
-		   step.Type == "delete-reverse-indices" { // was emptied upon delete - remove that version
-			
-			// ok, there really should only ever be one version, but let's be paranoid in the case that we were unable to
-			// update the transaction after putting objects. or a better example: two updates in a transaction where the
-			// second time we failed to update the tx file. then we could find multiple reverse indice file versions that
-			// need cleaning up.
-			versionIds := make([]string, 0, 10)
-			if step.FinalVersionId != nil {
-				versionIds = append(versionIds, *step.FinalVersionId)
+	for _, participant := range tx.Participants {
+		if err := participant.Rollback(ctx, tx); err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0048 Participant failed to rollback tx %s, %w", tx.GetPath(), err))
+		}
+	}
+
+	// the transaction is only removed once they have all succeeded, so that recovery can execute those that failed
+	errs = append(errs, r.ExecuteCompensations(ctx, tx)...)
+
+	if len(errs) == 0 && !tx.ReadOnly {
+		governanceBypass := true // transactions are not subject to governance
+		err := r.DeleteFolder(ctx, tx.GetPath(), governanceBypass, true)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0010 Failed to remove tx during rollback %s, %w", tx.GetPath(), err))
+		} else {
+			if r.writeIntentsEnabled {
+				errs = append(errs, r.removeWriteIntents(ctx, tx)...)
 			}
-	
-			if len(versionIds) == 0 {
-				// we were unable to update the transaction file, but, we can search for anything with the transactionId in the metadata and delete that, because that metadata was added by before we knew the version number
-				for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
-					Prefix: step.Path,
-					WithVersions: true,
-					WithMetadata: true,
-				}) {
-					if object.Err != nil {
-						errs = append(errs, fmt.Errorf("ADB-0007 Error listing objects on path %s during rollback of tx %s, %w", step.Path, tx.GetPath(), object.Err))
-					} else {
-						// delete it, if the metadata matches
-						// not working: var metaDataTxId string = object.UserMetadata[schema.TX_ID]
-						var metaDataTxId string = object.UserMetadata[MINIO_META_PREFIX+schema.TX_ID]
-						if metaDataTxId == step.UserMetadata[MINIO_META_PREFIX+schema.TX_ID] {
-							versionIds = append(versionIds, object.VersionID)
-						}
-					}
-				}
+			if err := r.ReleaseCacheSpill(ctx, tx); err != nil {
+				errs = append(errs, err)
 			}
-	
-			var wg sync.WaitGroup
-			wg.Add(len(versionIds))
-			var mu sync.Mutex
-			for _, versionId := range versionIds { // yeah, normally there is one. but just in case we ever had more...
-				go func(versionId string) {
-					defer wg.Done()
-					err := r.Client.RemoveObject(ctx, r.BucketName, step.Path, minio.RemoveObjectOptions{
-						VersionID: versionId,
-					})
-					if err != nil {
-						mu.Lock()
-						defer mu.Unlock()
-						errs = append(errs, fmt.Errorf("ADB-0008 Failed to remove object at path %s during rollback of tx %s, %w", step.Path, tx.GetPath(), err))
-					}
-				}(versionId)
+			if err := r.releaseEphemerals(ctx, tx); err != nil {
+				errs = append(errs, err)
 			}
-			wg.Wait()
-		} else if step.Type == "insert-add-index" || // index files either exist, or they don't. they have no versioned content.
-		          step.Type == "update-add-index" { // index files either exist, or they don't. they have no versioned content.
+		}
+	}
 
-			err := r.Client.RemoveObject(ctx, r.BucketName, step.Path, minio.RemoveObjectOptions{
-				ForceDelete: true,
-				GovernanceBypass: true,
-			})
-			if err != nil {
-				errs = append(errs, fmt.Errorf("ADB-0009 Failed to remove object at path %s during rollback of tx %s, %w", step.Path, tx.GetPath(), err))
+	return errs
+}
+
+// removes exactly the versions written by the step, if it was executed
+func (r *MinioRepository) rollbackStep(ctx context.Context, tx *schema.Transaction, step *schema.TransactionStep) []error {
+	errs := make([]error, 0)
+	if step.Skipped || step.IsDeferred() {
+		// nothing was written for it
+		return nil
+	}
+
+	switch step.Type {
+	case schema.STEP_INSERT_DATA, // remove the newly inserted version of the object
+	     schema.STEP_INSERT_REVERSE_INDICES, // exists for the object key, containing the current list of index files - remove version that was added
+	     schema.STEP_UPDATE_DATA, // remove the version that was updated
+	     schema.STEP_UPDATE_REVERSE_INDICES, // exists for the object key, containing the current list of index files - remove version that was added
+	     schema.STEP_DELETE_DATA, // remove the version that was deleted (the tombstone)
+	     schema.STEP_DELETE_REVERSE_INDICES, // was emptied upon delete - remove that version
+	     schema.STEP_UPDATE_INDEX_PROJECTION: // the entry existed before - remove the version with the new projection
+		
+		errs = append(errs, r.removeVersionsWrittenByStep(ctx, tx, step)...)
+
+		if step.Type.IsDelete() && step.InitialVersionId != "" {
+			if err := r.restorePinnedVersion(ctx, tx, step); err != nil {
+				errs = append(errs, err)
 			}
-		} else if step.Type == "update-remove-index" {
-			// not used during rollback
-		} else {
-			errs = append(errs, fmt.Errorf("ADB-0002 Unexpected transaction step type %s, please contact abstratium", step.Type))
 		}
-	}
+	case schema.STEP_INSERT_ADD_INDEX, // index files either exist, or they don't. they have no versioned content.
+	     schema.STEP_UPDATE_ADD_INDEX: // index files either exist, or they don't. they have no versioned content.
 
-	if len(errs) == 0 {
-		governanceBypass := true // transactions are not subject to governance
-		err := r.DeleteFolder(ctx, tx.GetPath(), governanceBypass, true)
+		if schema.IsUniquePath(step.Path) {
+			// claims are versioned, and the one before may belong to a different entity, e.g. if the claim failed
+			return append(errs, r.removeVersionsWrittenByStep(ctx, tx, step)...)
+		}
+		err := r.Client.RemoveObject(ctx, r.BucketName, step.Path, minio.RemoveObjectOptions{
+			ForceDelete: true,
+			GovernanceBypass: true,
+		})
 		if err != nil {
-			errs = append(errs, fmt.Errorf("ADB-0010 Failed to remove tx during rollback %s, %w", tx.GetPath(), err))
+			errs = append(errs, fmt.Errorf("ADB-0009 Failed to remove object at path %s during rollback of tx %s, %w", step.Path, tx.GetPath(), err))
+		}
+	case schema.STEP_UPDATE_REMOVE_INDEX, schema.STEP_DELETE_REMOVE_INDEX:
+		// not used during rollback, since they are only removed on commit
+	case schema.STEP_EPHEMERAL:
+		// removed along with all their versions, once the transaction is removed
+	default:
+		errs = append(errs, fmt.Errorf("ADB-0002 Unexpected transaction step type %s, please contact abstratium", step.Type))
+	}
+	return errs
+}
+
+// rolls back the steps from the first one on, and removes them from the transaction, so that an operation which failed after
+// some of its steps were executed, e.g. those of the entities that foreign keys deleted, leaves nothing to be committed. the
+// steps are kept if they cannot all be rolled back, so that rolling back the transaction removes what remains.
+func (r *MinioRepository) rollbackStepsFrom(ctx context.Context, tx *schema.Transaction, first int) []error {
+	errs := make([]error, 0)
+	for i := len(tx.Steps) - 1; i >= first; i-- {
+		errs = append(errs, r.rollbackStep(ctx, tx, tx.Steps[i])...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	tx.DiscardSteps(first)
+	if err := r.updateTransaction(ctx, tx); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// removes exactly the versions of the object written by the step, so that the version before them is the latest again
+func (r *MinioRepository) removeVersionsWrittenByStep(ctx context.Context, tx *schema.Transaction, step *schema.TransactionStep) []error {
+	errs := make([]error, 0)
+	// ok, there really should only ever be one version, but let's be paranoid in the case that we were unable to
+	// update the transaction after putting objects. or a better example: two updates in a transaction where the
+	// second time we failed to update the tx file. then we could find multiple reverse indice file versions that
+	// need cleaning up.
+	versionIds := make([]string, 0, 10)
+	if step.FinalVersionId != nil {
+		versionIds = append(versionIds, *step.FinalVersionId)
+	}
+
+	if len(versionIds) == 0 {
+		// we were unable to update the transaction file, but, we can search for anything with the transactionId in the metadata and delete that, because that metadata was added by before we knew the version number
+		for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+			Prefix: step.Path,
+			WithVersions: true,
+			WithMetadata: true,
+		}) {
+			if object.Err != nil {
+				errs = append(errs, fmt.Errorf("ADB-0007 Error listing objects on path %s during rollback of tx %s, %w", step.Path, tx.GetPath(), object.Err))
+			} else {
+				// delete it, if the metadata matches
+				// not working: var metaDataTxId string = object.UserMetadata[schema.TX_ID]
+				var metaDataTxId string = object.UserMetadata[MINIO_META_PREFIX+schema.TX_ID]
+				// compared with the id of the transaction, since the metadata of the step has no prefix, see AddStep, so comparing
+				// with it matched the versions which were not written by any transaction, rather than those written by this one
+				if metaDataTxId == tx.Id {
+					versionIds = append(versionIds, object.VersionID)
+				}
+			}
 		}
 	}
 
+	var wg sync.WaitGroup
+	wg.Add(len(versionIds))
+	var mu sync.Mutex
+	for _, versionId := range versionIds { // yeah, normally there is one. but just in case we ever had more...
+		go func(versionId string) {
+			defer wg.Done()
+			err := r.Client.RemoveObject(ctx, r.BucketName, step.Path, minio.RemoveObjectOptions{
+				VersionID: versionId,
+			})
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, fmt.Errorf("ADB-0008 Failed to remove object at path %s during rollback of tx %s, %w", step.Path, tx.GetPath(), err))
+			}
+		}(versionId)
+	}
+	wg.Wait()
 	return errs
 }
 
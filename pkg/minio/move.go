@@ -0,0 +1,33 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// moves the record with the id from one table to another within the transaction, e.g. to promote a draft into the published
+// table, by inserting it into the destination, which maintains its indices there, and deleting it from the source, which removes
+// its entries there. since both are steps of the same transaction, the record is found in exactly one of the tables, even if the
+// process fails part way through committing, in which case the transaction is recovered like any other.
+// fails with a NoSuchKeyError if the record does not exist in the source, and a DuplicateKeyError if it exists in the destination.
+// Returns: the record, and its ETag in the destination, so that it can be updated further within the transaction
+func Move[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, from schema.Table, to schema.Table, id string) (*T, *string, error) {
+	if from.Path(id) == to.Path(id) {
+		return nil, nil, fmt.Errorf("ADB-0141 cannot move %s to where it already is", from.Path(id))
+	}
+	entity := new(T)
+	etag, err := NewTypedQuery[T](repo, ctx, tx).SelectFromTable(from).WhereIdEquals(id).Find(entity)
+	if err != nil {
+		return nil, nil, err
+	}
+	newETag, err := repo.InsertIntoTable(ctx, tx, to, entity)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := repo.DeleteFromTable(ctx, tx, from, entity, etag); err != nil {
+		return nil, nil, err
+	}
+	return entity, newETag, nil
+}
@@ -0,0 +1,112 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// what CleanStaleMultipartUploads reclaimed
+type MultipartCleanupReport struct {
+	// the number of incomplete multipart uploads that were aborted, and the bytes that their parts occupied
+	Aborted int
+	Bytes   int64
+	// stale uploads which were kept, since their upload session is still alive
+	Kept int
+}
+
+// aborts the incomplete multipart uploads of attachments which were started more than olderThan ago, and whose upload session
+// has expired or no longer exists, e.g. because the process which created it crashed, or the session was removed without the
+// upload being aborted. the bucket still stores and bills their parts, although no listing of objects shows them.
+// each one that is aborted is reported to the StorageReclaimedCallback, if there is one.
+func (r *MinioRepository) CleanStaleMultipartUploads(ctx context.Context, olderThan time.Duration) (MultipartCleanupReport, error) {
+	report := MultipartCleanupReport{}
+	threshold := schema.Now().Add(-olderThan)
+	core := minio.Core{Client: r.Client}
+	var errs []error
+	for upload := range r.Client.ListIncompleteUploads(ctx, r.BucketName, "", true) {
+		if upload.Err != nil {
+			return report, fmt.Errorf("ADB-0139 failed to list incomplete multipart uploads: %w", upload.Err)
+		}
+		if !schema.IsAttachmentPath(upload.Key) || !upload.Initiated.Before(threshold) {
+			continue
+		}
+		id := path.Base(upload.Key)
+		if _, err := r.GetUpload(ctx, id); err == nil {
+			report.Kept++
+			continue
+		} else if !errors.Is(err, NoSuchKeyError) {
+			errs = append(errs, err)
+			continue
+		}
+		size, err := r.multipartUploadSize(ctx, upload.Key, upload.UploadID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := core.AbortMultipartUpload(ctx, r.BucketName, upload.Key, upload.UploadID); err != nil && minio.ToErrorResponse(err).Code != "NoSuchUpload" {
+			errs = append(errs, fmt.Errorf("ADB-0325 failed to abort multipart upload of %s: %w", upload.Key, err))
+			continue
+		}
+		// the expired session, if any, can no longer be continued
+		if err := r.Client.RemoveObject(ctx, r.BucketName, uploadSessionPath(id), minio.RemoveObjectOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0326 failed to remove upload %s: %w", id, err))
+		}
+		report.Aborted++
+		report.Bytes += size
+		if callback, ok := theCallback.(StorageReclaimedCallback); ok {
+			callback.MultipartUploadAborted(upload.Key, size)
+		}
+	}
+	if len(errs) > 0 {
+		return report, fmt.Errorf("ADB-0327 failed to clean %d stale multipart uploads: %w", len(errs), errors.Join(errs...))
+	}
+	return report, nil
+}
+
+// cleans stale multipart uploads every interval, until the context is done. errors are reported to the callback passed to Setup.
+// see CleanStaleMultipartUploads
+func (r *MinioRepository) StartCleaningStaleMultipartUploads(ctx context.Context, interval time.Duration, olderThan time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := r.CleanStaleMultipartUploads(ctx, olderThan); err != nil && ctx.Err() == nil && theCallback != nil {
+				theCallback.ErrorDuringGc(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// the total size of the parts which have been uploaded
+func (r *MinioRepository) multipartUploadSize(ctx context.Context, key string, uploadId string) (int64, error) {
+	core := minio.Core{Client: r.Client}
+	size := int64(0)
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, r.BucketName, key, uploadId, marker, 1000)
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+				return size, nil
+			}
+			return 0, fmt.Errorf("ADB-0328 failed to list the parts of the multipart upload of %s: %w", key, err)
+		}
+		for _, part := range result.ObjectParts {
+			size += part.Size
+		}
+		if !result.IsTruncated {
+			return size, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
@@ -0,0 +1,377 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/google/uuid"
+)
+
+// the system table in which messages wait to be sent, once the transaction which enqueued them has committed. each tenant has an
+// outbox of its own, i.e. the table with its tenant, see schema.Table.WithTenant, since only transactions of the tenant see that
+// its transactions are in progress, so that the messages of one are not sent before it commits
+var T_OUTBOX = schema.NewTable(schema.SYSTEM_DATABASE, "outbox", []string{})
+
+// the system table to which messages are moved, once they have failed to be sent too often, see OutboxRetryPolicy. each tenant has
+// its own, like it does T_OUTBOX
+var T_OUTBOX_DEAD_LETTERS = schema.NewTable(schema.SYSTEM_DATABASE, "outbox_dead_letters", []string{})
+
+// how long a dispatcher may take to send a message, before other dispatchers consider it to have failed, e.g. because the process
+// ended while sending it
+const OUTBOX_SEND_TIMEOUT = 30 * time.Second
+
+// how often messages which fail to be sent are retried, and how long dispatchers wait before retrying them
+type OutboxRetryPolicy struct {
+	// the number of failed attempts after which a message is moved to T_OUTBOX_DEAD_LETTERS, rather than being retried, or zero
+	// to retry it until it is sent
+	MaxAttempts int
+	// the time to wait after the first failed attempt, which doubles after each further one
+	InitialDelay time.Duration
+	// the longest time to wait between attempts, or zero for no limit
+	MaxDelay time.Duration
+}
+
+// used unless the repository has a policy of its own, see SetOutboxRetryPolicy
+var DEFAULT_OUTBOX_RETRY_POLICY = OutboxRetryPolicy{MaxAttempts: 10, InitialDelay: time.Second, MaxDelay: time.Hour}
+
+// sets how messages which fail to be sent are retried
+func (r *MinioRepository) SetOutboxRetryPolicy(policy OutboxRetryPolicy) {
+	r.outboxMu.Lock()
+	defer r.outboxMu.Unlock()
+	r.outboxRetryPolicy = &policy
+}
+
+func (r *MinioRepository) getOutboxRetryPolicy() OutboxRetryPolicy {
+	r.outboxMu.Lock()
+	defer r.outboxMu.Unlock()
+	if r.outboxRetryPolicy == nil {
+		return DEFAULT_OUTBOX_RETRY_POLICY
+	}
+	return *r.outboxRetryPolicy
+}
+
+// true if a message which failed the given number of times is not retried
+func (p OutboxRetryPolicy) exhausted(attempts int) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// returns how long to wait after the given number of failed attempts
+func (p OutboxRetryPolicy) delay(attempts int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempts && (p.MaxDelay == 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// a message which is sent once the transaction that enqueued it commits, e.g. a confirmation email
+type OutboxMessage struct {
+	Id string `json:"id"`
+	// selects the sender, e.g. "email" or "webhook"
+	Channel       string   `json:"channel"`
+	Template      string   `json:"template"`
+	To            []string `json:"to"`
+	Subject       string   `json:"subject"`
+	Body          string   `json:"body"`
+	CreatedMicros int64    `json:"createdMicros"`
+	// the number of attempts to send the message which failed
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError,omitempty"`
+	// the message is not sent before this time, after an attempt failed
+	NextAttemptMicros int64 `json:"nextAttemptMicros,omitempty"`
+	// set while a dispatcher is sending the message, so that others do not send it too. if it is set once it has passed,
+	// the dispatcher failed to record the outcome, e.g. because its process ended
+	ClaimedUntilMicros int64 `json:"claimedUntilMicros,omitempty"`
+}
+
+// sends messages of a channel, e.g. via SMTP, SES or a webhook
+type MessageSender interface {
+	Send(ctx context.Context, message *OutboxMessage) error
+}
+
+var senders = make(map[string]MessageSender)
+var sendersMu sync.Mutex
+
+// registers the sender which sends the messages of the channel, replacing any that was registered before
+func RegisterMessageSender(channel string, sender MessageSender) {
+	sendersMu.Lock()
+	defer sendersMu.Unlock()
+	senders[channel] = sender
+}
+
+// a typed message, whose subject and body are rendered from the payload using text/template
+type MessageTemplate[T any] struct {
+	Name    string
+	Channel string
+	subject *template.Template
+	body    *template.Template
+	// optional, returns an error if the payload is invalid, so that nothing is enqueued
+	validate func(payload T) error
+}
+
+// parses the templates, so that errors in them are found at startup, rather than when a message is enqueued.
+// Param: validate - optional, validates the payload before it is rendered
+func NewMessageTemplate[T any](name string, channel string, subject string, body string, validate func(payload T) error) (*MessageTemplate[T], error) {
+	subjectTemplate, err := template.New(name + "-subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0080 invalid subject of message template %s: %w", name, err)
+	}
+	bodyTemplate, err := template.New(name + "-body").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0173 invalid body of message template %s: %w", name, err)
+	}
+	return &MessageTemplate[T]{Name: name, Channel: channel, subject: subjectTemplate, body: bodyTemplate, validate: validate}, nil
+}
+
+// validates the payload and renders the message
+func (m *MessageTemplate[T]) Render(to []string, payload T) (*OutboxMessage, error) {
+	if len(to) == 0 {
+		return nil, fmt.Errorf("ADB-0174 message %s has no recipients", m.Name)
+	}
+	if m.validate != nil {
+		if err := m.validate(payload); err != nil {
+			return nil, fmt.Errorf("ADB-0081 invalid payload for message %s: %w", m.Name, err)
+		}
+	}
+	var subject, body strings.Builder
+	if err := m.subject.Execute(&subject, payload); err != nil {
+		return nil, fmt.Errorf("ADB-0175 failed to render the subject of message %s: %w", m.Name, err)
+	}
+	if err := m.body.Execute(&body, payload); err != nil {
+		return nil, fmt.Errorf("ADB-0176 failed to render the body of message %s: %w", m.Name, err)
+	}
+	return &OutboxMessage{
+		Id:            uuid.New().String(),
+		Channel:       m.Channel,
+		Template:      m.Name,
+		To:            to,
+		Subject:       subject.String(),
+		Body:          body.String(),
+		CreatedMicros: time.Now().UnixMicro(),
+	}, nil
+}
+
+// renders the message and adds it to the outbox of the tenant of the transaction within it, so that it is only sent if the
+// transaction commits
+func (m *MessageTemplate[T]) Enqueue(ctx context.Context, repo *MinioRepository, tx *schema.Transaction, to []string, payload T) (*OutboxMessage, error) {
+	message, err := m.Render(to, payload)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.InsertIntoTable(ctx, tx, T_OUTBOX.WithTenant(tx.Tenant), message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// sends up to max messages from the outboxes of all tenants, removing each one once it has been sent. a message is claimed before it is sent, so
+// that other processes dispatching the outbox at the same time do not send it too, and removed afterwards, so it is sent at least
+// once. messages which fail to be sent are kept, along with the error, and retried once the delay of the retry policy has passed,
+// until they have failed too often, when they are moved to T_OUTBOX_DEAD_LETTERS. messages which are waiting to be retried, or are
+// being sent by another process, are skipped.
+// returns the number of messages that were sent, and the errors of those that were not.
+func (r *MinioRepository) DispatchOutbox(ctx context.Context, max int) (int, []error) {
+	policy := r.getOutboxRetryPolicy()
+	sent := 0
+	errs := make([]error, 0)
+	tenants, err := r.allTenants(ctx)
+	if err != nil {
+		return sent, append(errs, err)
+	}
+	for _, tenant := range tenants {
+		for id, err := range r.listIds(ctx, T_OUTBOX.WithTenant(tenant)) {
+			if err != nil {
+				return sent, append(errs, err)
+			}
+			if sent >= max {
+				return sent, errs
+			}
+			message, etag, err := r.claimMessage(ctx, tenant, id, policy)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if message == nil {
+				continue // skipped
+			}
+			if err := r.sendMessage(ctx, tenant, message, etag, policy); err != nil {
+				errs = append(errs, err)
+			} else {
+				sent++
+			}
+		}
+	}
+	return sent, errs
+}
+
+// marks the message as being sent by this process, unless it is waiting to be retried, or another process is sending it.
+// a message whose previous claim expired counts as having failed, and is moved to the dead letters if it has failed too often.
+// Returns: the claimed message and its ETag, or nil if it was skipped
+func (r *MinioRepository) claimMessage(ctx context.Context, tenant schema.Tenant, id string, policy OutboxRetryPolicy) (*OutboxMessage, *string, error) {
+	outbox := T_OUTBOX.WithTenant(tenant)
+	tx, err := r.BeginTransactionForTenant(ctx, tenant, 10*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := &OutboxMessage{}
+	etag, err := NewTypedQuery[OutboxMessage](r, ctx, &tx).SelectFromTable(outbox).WhereIdEquals(id).Find(message)
+	if err != nil {
+		r.Rollback(ctx, &tx)
+		if errors.Is(err, NoSuchKeyError) {
+			return nil, nil, nil // sent by another process in the mean time
+		}
+		return nil, nil, err
+	}
+	now := schema.Now().UnixMicro()
+	if message.ClaimedUntilMicros > now || message.NextAttemptMicros > now {
+		r.Rollback(ctx, &tx)
+		return nil, nil, nil
+	}
+	if message.ClaimedUntilMicros != 0 {
+		message.Attempts++
+		message.LastError = fmt.Sprintf("ADB-0177 message %s was not sent before its claim expired", id)
+		message.ClaimedUntilMicros = 0
+		if policy.exhausted(message.Attempts) {
+			if err := r.moveToDeadLetters(ctx, &tx, message, etag); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("ADB-0180 message %s was moved to the dead letters after %d attempts: %s", id, message.Attempts, message.LastError)
+		}
+	}
+	message.ClaimedUntilMicros = schema.Now().Add(OUTBOX_SEND_TIMEOUT).UnixMicro()
+	etag, err = r.UpdateTable(ctx, &tx, outbox, message, etag)
+	if err != nil {
+		r.Rollback(ctx, &tx)
+		if errors.Is(err, StaleObjectError) || errors.Is(err, ObjectLockedError) {
+			return nil, nil, nil // claimed by another process
+		}
+		return nil, nil, err
+	}
+	if errs := r.Commit(ctx, &tx); len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+	return message, etag, nil
+}
+
+// sends the claimed message, and removes it once it has been sent, or records why it failed
+func (r *MinioRepository) sendMessage(ctx context.Context, tenant schema.Tenant, message *OutboxMessage, etag *string, policy OutboxRetryPolicy) error {
+	outbox := T_OUTBOX.WithTenant(tenant)
+	sendersMu.Lock()
+	sender := senders[message.Channel]
+	sendersMu.Unlock()
+	var err error
+	if sender == nil {
+		err = fmt.Errorf("ADB-0082 no sender is registered for channel %s of message %s", message.Channel, message.Id)
+	} else {
+		// so that it is sent before the claim expires, and another process sends it too
+		sendCtx, cancel := context.WithTimeout(ctx, OUTBOX_SEND_TIMEOUT)
+		err = sender.Send(sendCtx, message)
+		cancel()
+	}
+
+	tx, txErr := r.BeginTransactionForTenant(ctx, tenant, 10*time.Second)
+	if txErr != nil {
+		return errors.Join(err, txErr)
+	}
+	if err == nil {
+		if err := r.DeleteFromTable(ctx, &tx, outbox, message, etag); err != nil {
+			r.Rollback(ctx, &tx)
+			return fmt.Errorf("ADB-0178 message %s was sent, but could not be removed from the outbox, so it will be sent again: %w", message.Id, err)
+		}
+		if errs := r.Commit(ctx, &tx); len(errs) > 0 {
+			return fmt.Errorf("ADB-0178 message %s was sent, but could not be removed from the outbox, so it will be sent again: %w", message.Id, errs[0])
+		}
+		return nil
+	}
+
+	cause := fmt.Errorf("ADB-0083 failed to send message %s: %w", message.Id, err)
+	message.Attempts++
+	message.LastError = cause.Error()
+	message.ClaimedUntilMicros = 0
+	if policy.exhausted(message.Attempts) {
+		if err := r.moveToDeadLetters(ctx, &tx, message, etag); err != nil {
+			return errors.Join(cause, err)
+		}
+		return fmt.Errorf("ADB-0179 message %s was moved to the dead letters after %d attempts: %w", message.Id, message.Attempts, cause)
+	}
+	message.NextAttemptMicros = schema.Now().Add(policy.delay(message.Attempts)).UnixMicro()
+	if _, err := r.UpdateTable(ctx, &tx, outbox, message, etag); err != nil {
+		r.Rollback(ctx, &tx)
+		return errors.Join(cause, err)
+	}
+	if errs := r.Commit(ctx, &tx); len(errs) > 0 {
+		return errors.Join(cause, errs[0])
+	}
+	return cause
+}
+
+// moves the message from the outbox to the dead letters of the tenant of the transaction, and commits the transaction
+func (r *MinioRepository) moveToDeadLetters(ctx context.Context, tx *schema.Transaction, message *OutboxMessage, etag *string) error {
+	if err := r.DeleteFromTable(ctx, tx, T_OUTBOX.WithTenant(tx.Tenant), message, etag); err != nil {
+		r.Rollback(ctx, tx)
+		return err
+	}
+	if _, err := r.InsertIntoTable(ctx, tx, T_OUTBOX_DEAD_LETTERS.WithTenant(tx.Tenant), message); err != nil {
+		r.Rollback(ctx, tx)
+		return err
+	}
+	if errs := r.Commit(ctx, tx); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// moves a message from the dead letters back to the outbox, so that it is sent again, e.g. once the cause of its failures has
+// been fixed. its attempts are reset, so that it is retried as often as a new message.
+func (r *MinioRepository) RequeueDeadLetter(ctx context.Context, id string) error {
+	return r.RequeueDeadLetterOfTenant(ctx, schema.DEFAULT_TENANT, id)
+}
+
+// like RequeueDeadLetter, for a message that a transaction of the tenant enqueued
+func (r *MinioRepository) RequeueDeadLetterOfTenant(ctx context.Context, tenant schema.Tenant, id string) error {
+	deadLetters := T_OUTBOX_DEAD_LETTERS.WithTenant(tenant)
+	tx, err := r.BeginTransactionForTenant(ctx, tenant, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	message := &OutboxMessage{}
+	etag, err := NewTypedQuery[OutboxMessage](r, ctx, &tx).SelectFromTable(deadLetters).WhereIdEquals(id).Find(message)
+	if err == nil {
+		err = r.DeleteFromTable(ctx, &tx, deadLetters, message, etag)
+	}
+	if err == nil {
+		message.Attempts = 0
+		message.NextAttemptMicros = 0
+		_, err = r.InsertIntoTable(ctx, &tx, T_OUTBOX.WithTenant(tenant), message)
+	}
+	if err != nil {
+		r.Rollback(ctx, &tx)
+		return err
+	}
+	if errs := r.Commit(ctx, &tx); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// renders a message as an email, for senders which send emails
+func (m *OutboxMessage) asEmail(from string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Message-Id: <%s@abstrastore>\r\n", m.Id)
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(m.Body)
+	return b.Bytes()
+}
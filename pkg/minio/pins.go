@@ -0,0 +1,94 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// a record which is protected from being updated or deleted, see Pin
+type Pin struct {
+	Database     string `json:"database"`
+	Table        string `json:"table"`
+	Id           string `json:"id"`
+	Reason       string `json:"reason"`
+	PinnedMicros int64  `json:"pinnedMicros"`
+}
+
+// pins the record with the given id, so that transactions fail with a PinnedError when they update or delete it, unless they
+// override pins, see schema.Transaction.OverridePins. pinning is not transactional, i.e. it takes effect straight away, for
+// transactions which add steps afterwards. a pin which exists is replaced, e.g. to change its reason. the record need not exist,
+// so that it is protected from the moment that it is inserted. fails with ADB-0165 if the table is not pinnable, see
+// schema.Table.WithPins, or with ADB-0287 if the reason is empty, since others need to know why they may not touch the record.
+func (r *MinioRepository) Pin(ctx context.Context, table schema.Table, id string, reason string) error {
+	if !table.Pinnable {
+		return fmt.Errorf("ADB-0165 the records of table %s/%s cannot be pinned, see WithPins", table.Database, table.Name)
+	}
+	if reason == "" {
+		return fmt.Errorf("ADB-0287 the record %s of table %s/%s cannot be pinned without a reason", id, table.Database, table.Name)
+	}
+	pin := Pin{Database: string(table.Database), Table: table.Name, Id: id, Reason: reason, PinnedMicros: time.Now().UnixMicro()}
+	data, err := json.Marshal(pin)
+	if err != nil {
+		return err
+	}
+	path := table.PinPath(id)
+	if _, err := r.Client.PutObject(ctx, r.BucketName, path, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"}); err != nil {
+		return fmt.Errorf("ADB-0288 failed to put pin %s: %w", path, err)
+	}
+	return nil
+}
+
+// removes the pin of the record with the given id, if it has one
+func (r *MinioRepository) Unpin(ctx context.Context, table schema.Table, id string) error {
+	path := table.PinPath(id)
+	if err := r.Client.RemoveObject(ctx, r.BucketName, path, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("ADB-0289 failed to remove pin %s: %w", path, err)
+	}
+	return nil
+}
+
+// returns the pin of the record with the given id, or nil if it is not pinned
+func (r *MinioRepository) GetPin(ctx context.Context, table schema.Table, id string) (*Pin, error) {
+	path := table.PinPath(id)
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0290 failed to get pin %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ADB-0291 failed to get pin %s: %w", path, err)
+	}
+	var pin Pin
+	if err := json.Unmarshal(b, &pin); err != nil {
+		return nil, err
+	}
+	return &pin, nil
+}
+
+// fails with a PinnedError if the record is pinned and the transaction does not override pins. tables which are not pinnable
+// cost nothing.
+func (r *MinioRepository) checkPin(ctx context.Context, transaction *schema.Transaction, table schema.Table, id string) error {
+	if !table.Pinnable || transaction.OverridePins {
+		return nil
+	}
+	pin, err := r.GetPin(ctx, table, id)
+	if err != nil {
+		return err
+	}
+	if pin != nil {
+		return &PinnedErrorWithDetails{Details: fmt.Sprintf("the record %s of table %s/%s is pinned, because %s. override the pins of the transaction, or unpin it", id, table.Database, table.Name, pin.Reason), Pin: *pin}
+	}
+	return nil
+}
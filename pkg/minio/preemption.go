@@ -0,0 +1,179 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// requests to preempt transactions, named after the transaction to preempt
+const PREEMPTIONS_ROOT = "preemptions/"
+
+// written when a transaction is blocked by one with a lower priority
+type PreemptionRequest struct {
+	TransactionId   string `json:"transactionId"`
+	RequestedBy     string `json:"requestedBy"`
+	Priority        int    `json:"priority"`
+	RequestedMicros int64  `json:"requestedMicros"`
+}
+
+// rolls back transactions which block a transaction with a higher priority, once they have been running for longer than the grace
+// period, so that the blocked transaction succeeds when it is retried. the transaction which is rolled back fails the next time
+// that it is used.
+// preemption is requested by any process whose transactions have a priority, but only processes where it is enabled preempt.
+func (r *MinioRepository) EnablePreemption(grace time.Duration) {
+	r.preemptionGrace.Store(int64(grace))
+}
+
+func (r *MinioRepository) DisablePreemption() {
+	r.preemptionGrace.Store(0)
+}
+
+// requests that the transaction which blocks this one is preempted, if this one has a priority
+func (r *MinioRepository) requestPreemption(ctx context.Context, tx *schema.Transaction, err error) {
+	var locked *ObjectLockedErrorWithDetails[any]
+	if tx.Priority <= 0 || !errors.As(err, &locked) || locked.TransactionId == "" {
+		return
+	}
+	request := PreemptionRequest{TransactionId: locked.TransactionId, RequestedBy: tx.Id, Priority: tx.Priority, RequestedMicros: time.Now().UnixMicro()}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+	path := PREEMPTIONS_ROOT + locked.TransactionId
+	existing, err := r.readPreemptionRequest(ctx, path)
+	if err == nil && existing != nil && existing.Priority >= request.Priority {
+		return // already requested
+	}
+	// best effort, since the caller is already failing, and will retry
+	r.Client.PutObject(ctx, r.BucketName, path, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+}
+
+// preempts the transactions which have been requested if preemption is enabled on the repository, reporting errors to the callback
+func ExecutePreemptions() {
+	grace := time.Duration(repo.preemptionGrace.Load())
+	if grace <= 0 {
+		return
+	}
+	for _, err := range repo.Preempt(context.Background(), grace) {
+		theCallback.ErrorDuringGc(err)
+	}
+}
+
+// rolls back the transactions that have been requested to be preempted, whose priority is lower than that of the requester,
+// and which have been running for longer than the grace period. requests are removed once they are handled, or if the transaction
+// has already finished.
+func (r *MinioRepository) Preempt(ctx context.Context, grace time.Duration) []error {
+	errs := make([]error, 0)
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix: PREEMPTIONS_ROOT,
+	}) {
+		if object.Err != nil {
+			return append(errs, object.Err)
+		}
+		request, err := r.readPreemptionRequest(ctx, object.Key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if request == nil {
+			continue // handled by another process
+		}
+		victim, err := r.readTransactionByIdWithETag(ctx, request.TransactionId)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if victim != nil {
+			if victim.State != "InProgress" || victim.Priority >= request.Priority {
+				// finishing, or not preemptable by the requester
+			} else if schema.Now().UnixMicro()-victim.StartMicroseconds < grace.Microseconds() {
+				continue // ask again later
+			} else {
+				victim.RecordFailure(-1, fmt.Errorf("ADB-0091 %w by transaction %s with priority %d", schema.TransactionPreemptedError, request.RequestedBy, request.Priority))
+				// the state is updated conditionally, so this fails if the transaction has made progress in the mean time
+				if rollbackErrs := r.rollback(ctx, victim); len(rollbackErrs) > 0 {
+					errs = append(errs, rollbackErrs...)
+					continue
+				}
+			}
+		}
+		if err := r.Client.RemoveObject(ctx, r.BucketName, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0092 failed to remove preemption request %s: %w", object.Key, err))
+		}
+	}
+	return errs
+}
+
+func (r *MinioRepository) readPreemptionRequest(ctx context.Context, path string) (*PreemptionRequest, error) {
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0093 failed to get preemption request %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ADB-0093 failed to get preemption request %s: %w", path, err)
+	}
+	var request PreemptionRequest
+	if err := json.Unmarshal(b, &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// like readTransactionById, but including the ETag, so that the transaction can be updated conditionally
+func (r *MinioRepository) readTransactionByIdWithETag(ctx context.Context, id string) (*schema.Transaction, error) {
+	roots, err := r.transactionRoots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+			Prefix: root,
+		}) {
+			if object.Err != nil {
+				return nil, object.Err
+			}
+			if !strings.HasSuffix(strings.TrimSuffix(object.Key, "/"), schema.TIMESTAMP_ID_SEPARATOR+id) {
+				continue
+			}
+			txData, err := r.Client.GetObject(ctx, r.BucketName, object.Key+TX_FILENAME, minio.GetObjectOptions{})
+			if err != nil {
+				return nil, err
+			}
+			defer txData.Close()
+			info, err := txData.Stat()
+			if err != nil {
+				if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+					return nil, nil // removed between listing and reading
+				}
+				return nil, err
+			}
+			b, err := io.ReadAll(txData)
+			if err != nil {
+				return nil, err
+			}
+			var transaction schema.Transaction
+			if err := json.Unmarshal(b, &transaction); err != nil {
+				return nil, err
+			}
+			transaction.Etag = info.ETag
+			transaction.Cache = make(map[string]*schema.ObjectAndETag)
+			return &transaction, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,188 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// like Find, but the results are built from the projections in the entries of the index, rather than by reading each entity, e.g.
+// so that a list can be shown with one request per page of the listing, rather than one per result as well. only the fields of
+// the projection are set, see schema.Table.WithProjection. since no entities are read, no ETags are returned, and the results
+// must not be used to update the entities. entries without a projection, e.g. those which were written before the index was
+// covering, are completed by reading their entities. the matching is checked against the projection if it contains the indexed
+// field, and the index has no filter. fails with ADB-0147 if the index is not covering.
+func (f FindByIndexedFieldEqualsContainer[T]) FindProjections(destination *[]*T) error {
+	index, paths, err := f.findPaths()
+	if err != nil {
+		return err
+	}
+	if !index.Covering() {
+		return fmt.Errorf("ADB-0147 the index %s of table %s/%s is not covering, see WithProjection", index.Field, f.table.Database, f.table.Name)
+	}
+	predicate, err := f.predicate(index)
+	if err != nil {
+		return err
+	}
+	if index.Filter != nil {
+		// entities that are read are checked against the filter, as they are by Find
+		matches := predicate
+		predicate = func(t *T) (bool, error) {
+			if indexed, err := isIndexed(index, t); err != nil || !indexed {
+				return false, err
+			}
+			return matches(t)
+		}
+	}
+	return findProjections(f.ctx, f.repo, f.tx, f.table, index, predicate, paths.Items(), destination)
+}
+
+func findProjections[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, table schema.Table, index *schema.Index, predicate func(*T) (bool, error), paths []string, destination *[]*T) error {
+	if err := tx.IsOk(); err != nil {
+		return err
+	}
+	transactionsInProgress, err := repo.getOtherTransactionsInProgress(ctx, tx)
+	if err != nil {
+		return err
+	}
+	transactionIdsToIgnore := make([]string, 0, len(transactionsInProgress))
+	for id := range transactionsInProgress {
+		transactionIdsToIgnore = append(transactionIdsToIgnore, id)
+	}
+
+	// nil if the entry does not exist within the transaction, and empty if it has no projection
+	bodies := make([]*[]byte, len(paths))
+	errs := make([]error, len(paths))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, GET_MANY_PARALLELISM)
+	for i, path := range paths {
+		// entries that the transaction wrote are cached, with their projections
+		cached, ok, err := tx.GetCached(ctx, path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if cached != nil {
+				body := []byte{}
+				if cached.Object != nil {
+					if body, err = json.Marshal(*cached.Object); err != nil {
+						return err
+					}
+				}
+				bodies[i] = &body
+			}
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			// not cached, so that entries which others rewrite do not make the transaction stale
+			bodies[i], _, errs[i] = repo.readObjectVersionIgnoring(ctx, tx, path, transactionIdsToIgnore)
+		}(i, path)
+	}
+	wg.Wait()
+
+	checkProjection := index.Filter == nil && slices.Contains(index.Projection, index.Field)
+	results := make([]*T, 0, len(paths))
+	incomplete := make([]schema.DatabaseTableIdTuple, 0)
+	for i, path := range paths {
+		var noSuchKey *NoSuchKeyErrorWithDetails
+		if errors.As(errs[i], &noSuchKey) {
+			// removed since it was listed, e.g. because the transaction that wrote it rolled back
+			continue
+		} else if errs[i] != nil {
+			return errs[i]
+		}
+		if bodies[i] == nil {
+			continue
+		}
+		if len(*bodies[i]) == 0 || string(*bodies[i]) == "null" {
+			coordinate, err := index.EntryFromPath(path)
+			if err != nil {
+				return err
+			}
+			incomplete = append(incomplete, *coordinate)
+			continue
+		}
+		result := new(T)
+		if err := json.Unmarshal(*bodies[i], result); err != nil {
+			return fmt.Errorf("ADB-0322 failed to read the projection in entry %s: %w", path, err)
+		}
+		if checkProjection {
+			if ok, err := predicate(result); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+		}
+		results = append(results, result)
+	}
+
+	if len(incomplete) > 0 {
+		entities := make([]*T, 0, len(incomplete))
+		if _, err := find(ctx, repo, tx, table, predicate, incomplete, &entities); err != nil {
+			return err
+		}
+		results = append(results, entities...)
+	}
+	*destination = results
+	return nil
+}
+
+// returns the projection of the entity, which the entries of a covering index contain, and the content type of the entries, or
+// nil if the index is not covering. the fields are named as they are in the JSON of the entity.
+func getProjection(index schema.Index, entity any) (*any, string, error) {
+	if !index.Covering() {
+		return nil, "text/plain", nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	if v.Kind() != reflect.Struct {
+		return nil, "", fmt.Errorf("ADB-0323 the entity is not a struct, so it has no projection for index %s", index.Field)
+	}
+	projection := make(map[string]any, len(index.Projection))
+	for _, fieldName := range index.Projection {
+		field, ok := v.Type().FieldByName(fieldName)
+		if !ok {
+			return nil, "", fmt.Errorf("ADB-0324 the field %s of the projection of index %s does not exist", fieldName, index.Field)
+		}
+		name := fieldName
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag != "" && tag != "-" {
+			name = tag
+		}
+		projection[name] = v.FieldByIndex(field.Index).Interface()
+	}
+	var a any = projection
+	return &a, "application/json", nil
+}
+
+// returns the metadata of a new version of an entry which only replaces its projection and the ETag of its record, marked with
+// the time that the entry was created, so that transactions which could see it before can still see it
+func (r *MinioRepository) rewriteMetadata(ctx context.Context, step *schema.TransactionStep) (map[string]string, error) {
+	info, exists, err := r.statObject(ctx, step.Path)
+	if err != nil || !exists {
+		// it is written like a new entry
+		return step.UserMetadata, err
+	}
+	created := info.UserMetadata[schema.ENTRY_REWRITE]
+	if created == "" {
+		created = info.UserMetadata[schema.LAST_MODIFIED]
+	}
+	if created == "" {
+		return step.UserMetadata, nil
+	}
+	metadata := make(map[string]string, len(step.UserMetadata)+1)
+	for key, value := range step.UserMetadata {
+		metadata[key] = value
+	}
+	metadata[schema.ENTRY_REWRITE] = created
+	return metadata, nil
+}
@@ -0,0 +1,298 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the name of the manifest of a published table, in the folder that it is published to
+const PUBLISHED_MANIFEST = "index.json"
+
+// the number of change sets that a publisher applies at a time
+const PUBLISH_BATCH_SIZE = 100
+
+// configures a Publisher
+type PublishOptions struct {
+	// only these fields of the objects are published, e.g. to leave out internal ones. empty means all fields. indexed fields are
+	// always published, since the manifest refers to them.
+	Fields []string
+
+	// the Cache-Control header of the published files, e.g. `public, max-age=60`, for serving them from a CDN. empty sets none.
+	CacheControl string
+}
+
+// the manifest of a published table, so that static clients, e.g. a product catalog served from a CDN, can list and look up its
+// objects without a server
+type PublishedManifest struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// the commit time of the last change that is published
+	UpdatedMicros int64 `json:"updatedMicros"`
+	// the ids of all published objects, sorted. each is published as `<id>.json`, next to the manifest
+	Ids []string `json:"ids"`
+	// for each index of the table, the sorted ids of the objects with each value. numbers and times are formatted like in JSON.
+	Indices map[string]map[string][]string `json:"indices"`
+}
+
+// renders a table into static JSON files in a folder of the bucket, i.e. one per object, plus a manifest, which can be served
+// directly from the bucket or a CDN. the first time that it publishes, it bootstraps from a snapshot of the table, and then
+// it applies the changes from the change log, which must be enabled, so that only what changed is rewritten.
+// the folder should be reserved for the publisher, since it removes the files of objects that are deleted.
+type Publisher[T any] struct {
+	repo     *MinioRepository
+	table    schema.Table
+	folder   string
+	options  PublishOptions
+	consumer *ChangeConsumer
+
+	// nil until it is read or bootstrapped
+	manifest *PublishedManifest
+}
+
+// returns a publisher of the table into the folder, e.g. `public/catalog/`, which consumes the change log under a name derived
+// from the folder, so that it continues where it left off, even in a different process
+func NewPublisher[T any](ctx context.Context, repo *MinioRepository, table schema.Table, folder string, options PublishOptions) (*Publisher[T], error) {
+	if !strings.HasSuffix(folder, "/") {
+		folder += "/"
+	}
+	consumer, err := repo.NewChangeConsumer(ctx, "publisher:"+folder)
+	if err != nil {
+		return nil, err
+	}
+	filter := &ChangeFilter{Tables: []schema.Table{table}}
+	if len(options.Fields) > 0 {
+		filter.Fields = slices.Clone(options.Fields)
+		for _, index := range table.Indices {
+			if index.Compute == nil && !slices.Contains(filter.Fields, index.Field) {
+				filter.Fields = append(filter.Fields, index.Field)
+			}
+		}
+	}
+	if err := consumer.SetFilter(filter); err != nil {
+		return nil, err
+	}
+	return &Publisher[T]{repo: repo, table: table, folder: folder, options: options, consumer: consumer}, nil
+}
+
+// path to the manifest of the published table
+func (p *Publisher[T]) ManifestPath() string {
+	return p.folder + PUBLISHED_MANIFEST
+}
+
+// publishes the changes which were committed since the last time, or the whole table, the first time, which blocks until the
+// changes around its snapshot have settled. the files of the objects are written before the manifest, and the position in the
+// change log is committed last, so that if it fails, it can be run again, and clients never find an object in the manifest
+// whose file does not exist.
+// Returns: the number of change sets that were published
+func (p *Publisher[T]) Publish(ctx context.Context) (int, error) {
+	if p.consumer.committed == nil {
+		p.manifest = &PublishedManifest{Database: string(p.table.Database), Table: p.table.Name, Ids: []string{}, Indices: p.emptyIndices()}
+		count := 0
+		err := p.consumer.Bootstrap(ctx, p.table, func(ctx context.Context, changeSet ChangeSet) error {
+			if err := p.apply(ctx, changeSet); err != nil {
+				return err
+			}
+			count++
+			return p.writeManifest(ctx)
+		})
+		if err != nil {
+			p.manifest = nil
+			return 0, err
+		}
+		return count, nil
+	}
+
+	if p.manifest == nil {
+		if err := p.readManifest(ctx); err != nil {
+			return 0, err
+		}
+	}
+	count := 0
+	for {
+		changeSets, err := p.consumer.Poll(ctx, PUBLISH_BATCH_SIZE)
+		if err != nil {
+			return count, err
+		}
+		if len(changeSets) == 0 {
+			return count, nil
+		}
+		for _, changeSet := range changeSets {
+			if err := p.apply(ctx, changeSet); err != nil {
+				p.consumer.Seek(p.consumer.committedOffset())
+				p.manifest = nil
+				return count, err
+			}
+		}
+		if err := p.writeManifest(ctx); err != nil {
+			p.consumer.Seek(p.consumer.committedOffset())
+			p.manifest = nil
+			return count, err
+		}
+		if err := p.consumer.Commit(ctx); err != nil {
+			p.consumer.Seek(p.consumer.committedOffset())
+			p.manifest = nil
+			return count, err
+		}
+		count += len(changeSets)
+	}
+}
+
+// writes or removes the files of the changed objects, and updates the manifest in memory
+func (p *Publisher[T]) apply(ctx context.Context, changeSet ChangeSet) error {
+	for _, change := range changeSet.Changes {
+		path := p.folder + change.Id + ".json"
+		p.unpublish(change.Id)
+		if change.Operation == CHANGE_DELETE {
+			if err := p.repo.Client.RemoveObject(ctx, p.repo.BucketName, path, minio.RemoveObjectOptions{}); err != nil {
+				return fmt.Errorf("ADB-0133 failed to remove published object %s: %w", path, err)
+			}
+			continue
+		}
+		entity := new(T)
+		if err := json.Unmarshal(change.Data, entity); err != nil {
+			return fmt.Errorf("ADB-0333 failed to publish object %s, since it cannot be unmarshalled: %w", change.Id, err)
+		}
+		if err := p.putObject(ctx, path, change.Data); err != nil {
+			return err
+		}
+		i, _ := slices.BinarySearch(p.manifest.Ids, change.Id)
+		p.manifest.Ids = slices.Insert(p.manifest.Ids, i, change.Id)
+		for field, values := range p.manifest.Indices {
+			index, err := p.table.GetIndex(field)
+			if err != nil {
+				return err
+			}
+			indexValues, err := publishedIndexValues(index, entity)
+			if err != nil {
+				return err
+			}
+			for _, value := range indexValues {
+				ids := values[value]
+				if i, found := slices.BinarySearch(ids, change.Id); !found {
+					values[value] = slices.Insert(ids, i, change.Id)
+				}
+			}
+		}
+	}
+	p.manifest.UpdatedMicros = max(p.manifest.UpdatedMicros, changeSet.CommitMicros)
+	return nil
+}
+
+// removes the object from the manifest in memory
+func (p *Publisher[T]) unpublish(id string) {
+	if i, found := slices.BinarySearch(p.manifest.Ids, id); found {
+		p.manifest.Ids = slices.Delete(p.manifest.Ids, i, i+1)
+	}
+	for _, values := range p.manifest.Indices {
+		for value, ids := range values {
+			if i, found := slices.BinarySearch(ids, id); found {
+				if ids = slices.Delete(ids, i, i+1); len(ids) == 0 {
+					delete(values, value)
+				} else {
+					values[value] = ids
+				}
+			}
+		}
+	}
+}
+
+func (p *Publisher[T]) emptyIndices() map[string]map[string][]string {
+	indices := make(map[string]map[string][]string)
+	for _, index := range p.table.Indices {
+		indices[index.Field] = make(map[string][]string)
+	}
+	return indices
+}
+
+func (p *Publisher[T]) readManifest(ctx context.Context) error {
+	object, err := p.repo.Client.GetObject(ctx, p.repo.BucketName, p.ManifestPath(), minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("ADB-0334 failed to get the manifest %s, which the publisher has published before: %w", p.ManifestPath(), err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return fmt.Errorf("ADB-0335 failed to get the manifest %s, which the publisher has published before: %w", p.ManifestPath(), err)
+	}
+	var manifest PublishedManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return err
+	}
+	// indices which were added since the manifest was written are empty until the table is published again from scratch
+	for field, values := range p.emptyIndices() {
+		if _, ok := manifest.Indices[field]; !ok {
+			manifest.Indices[field] = values
+		}
+	}
+	p.manifest = &manifest
+	return nil
+}
+
+func (p *Publisher[T]) writeManifest(ctx context.Context) error {
+	data, err := json.Marshal(p.manifest)
+	if err != nil {
+		return err
+	}
+	return p.putObject(ctx, p.ManifestPath(), data)
+}
+
+func (p *Publisher[T]) putObject(ctx context.Context, path string, data []byte) error {
+	_, err := p.repo.Client.PutObject(ctx, p.repo.BucketName, path, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  "application/json",
+		CacheControl: p.options.CacheControl,
+	})
+	if err != nil {
+		return fmt.Errorf("ADB-0336 failed to publish %s: %w", path, err)
+	}
+	return nil
+}
+
+// returns the values of the index of the entity as they appear in the manifest, i.e. not encoded
+func publishedIndexValues(index *schema.Index, entity any) ([]string, error) {
+	if indexed, err := isIndexed(index, entity); err != nil || !indexed {
+		return nil, err
+	}
+	leaves, multiple, err := getIndexElements(index, entity)
+	if err != nil {
+		return nil, err
+	}
+	if multiple {
+		values := make([]string, 0, len(leaves))
+		for _, leaf := range leaves {
+			if leaf == nil || leaf == "" {
+				continue
+			}
+			if number, ok := leaf.(float64); ok {
+				values = append(values, strconv.FormatFloat(number, 'g', -1, 64))
+			} else {
+				values = append(values, fmt.Sprint(leaf))
+			}
+		}
+		return values, nil
+	}
+	if index.Time {
+		t, err := getTimeIndexValue(index, entity)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		return []string{t.UTC().Format(time.RFC3339Nano)}, nil
+	}
+	if index.Numeric {
+		number, err := getNumericIndexValue(index, entity)
+		if err != nil || number == nil {
+			return nil, err
+		}
+		return []string{strconv.FormatFloat(*number, 'g', -1, 64)}, nil
+	}
+	return getIndexValues(index, entity)
+}
@@ -0,0 +1,145 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// caches the results of whole queries, keyed by the normalised query and its parameters.
+// entries are only valid for as long as the generation token of the table they were read from is unchanged,
+// which it is until a transaction that wrote to the table commits (on any pod).
+type queryCache struct {
+	mu         sync.Mutex
+	entries    map[string]*cachedQueryResult
+	maxEntries int
+}
+
+type cachedQueryResult struct {
+	generation string
+	results    []byte
+	etags      map[string]*string
+}
+
+// enables caching of query results, which is useful for repeated queries (e.g. dashboards) on slowly changing data.
+// each cached query costs one HEAD request, rather than reading the index and every object.
+// Param: maxEntries - the maximum number of queries to cache; once reached, an arbitrary entry is evicted
+func (r *MinioRepository) EnableQueryCache(maxEntries int) {
+	r.queryCache = &queryCache{
+		entries:    make(map[string]*cachedQueryResult, maxEntries),
+		maxEntries: maxEntries,
+	}
+}
+
+func (r *MinioRepository) DisableQueryCache() {
+	r.queryCache = nil
+}
+
+// returns the cached results of the query, if they are still valid; otherwise executes the query and caches its results.
+// the cache is bypassed if the transaction has written anything, since its own changes must be visible to it.
+func cachedFind[T any](ctx context.Context, repo *MinioRepository, transaction *schema.Transaction, table schema.Table, key string, destination *[]*T, doFind func() (*map[string]*string, error)) (*map[string]*string, error) {
+	kind, field, _ := strings.Cut(key, "|")
+	field, _, _ = strings.Cut(field, "|")
+	defer repo.recordDuration(ctx, METRIC_QUERY_DURATION, schema.Now(), map[string]string{"database": string(table.Database), "table": table.Name, "field": field, "kind": kind})
+	cache := repo.queryCache
+	if cache == nil || len(transaction.Steps) > 0 {
+		return doFind()
+	}
+	if err := transaction.IsOk(); err != nil {
+		return nil, err
+	}
+
+	key = fmt.Sprintf("%s/%s|%s", table.Database, table.Name, key)
+	generation, writtenMicros, err := repo.getTableGeneration(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if transaction.StartMicroseconds <= writtenMicros+time.Second.Microseconds() {
+		// the snapshot of this transaction might not contain the last commit to the table, so the results of other transactions
+		// are not necessarily the same as its own. last modified only has a precision of seconds, hence the margin.
+		return doFind()
+	}
+
+	cache.mu.Lock()
+	cached, ok := cache.entries[key]
+	cache.mu.Unlock()
+	if ok && cached.generation == generation {
+		// unmarshal a fresh copy, so that callers cannot modify the cached results
+		if err := json.Unmarshal(cached.results, destination); err != nil {
+			return nil, err
+		}
+		etags := make(map[string]*string, len(cached.etags))
+		for id, etag := range cached.etags {
+			etags[id] = etag
+		}
+		return &etags, nil
+	}
+
+	etags, err := doFind()
+	if err != nil {
+		// e.g. partial results. see PartialResultsWhenIndexUnavailable
+		return etags, err
+	}
+	results, err := json.Marshal(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if _, exists := cache.entries[key]; !exists && len(cache.entries) >= cache.maxEntries {
+		for k := range cache.entries {
+			delete(cache.entries, k)
+			break
+		}
+	}
+	// the generation was read before the query was executed, so if a commit happened in between, the entry is simply invalidated next time
+	cache.entries[key] = &cachedQueryResult{generation: generation, results: results, etags: *etags}
+	return etags, nil
+}
+
+// returns the current generation token of the table and when it was written, or an empty string if nothing has ever been committed to it
+func (r *MinioRepository) getTableGeneration(ctx context.Context, table schema.Table) (string, int64, error) {
+	info, exists, err := r.statObject(ctx, table.GenerationPath())
+	if err != nil {
+		return "", 0, err
+	}
+	if !exists {
+		return "", 0, nil
+	}
+	return info.ETag, info.LastModified.UnixMicro(), nil
+}
+
+// writes a new generation token for every table that the transaction wrote to.
+// must be called after the transaction is removed, i.e. once its changes are visible to other transactions, otherwise
+// a query could cache results that do not contain those changes, under the new generation.
+func (r *MinioRepository) bumpTableGenerations(ctx context.Context, tx *schema.Transaction) []error {
+	errs := make([]error, 0)
+	generationPaths := make(map[string]bool) // effectively a set
+	for _, step := range tx.Steps {
+		if step.Skipped || (step.Type != schema.STEP_INSERT_DATA && step.Type != schema.STEP_UPDATE_DATA && step.Type != schema.STEP_DELETE_DATA) {
+			continue
+		}
+		generationPath, err := schema.GenerationPathFromPath(step.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		generationPaths[generationPath] = true
+	}
+	for generationPath := range generationPaths {
+		contents := []byte(tx.Id)
+		_, err := r.Client.PutObject(ctx, r.BucketName, generationPath, bytes.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{ContentType: "text/plain"})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ADB-0038 Failed to put table generation at path %s, %w", generationPath, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,171 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// what RebuildIndex repaired
+type IndexRebuild struct {
+	// the number of live records whose entries were derived
+	Records int
+	// entries which were missing, and were added
+	Added int
+	// entries which no record requires, e.g. of records which no longer exist, and were removed
+	Removed int
+	// records which were written while the index was being rebuilt, by transactions which maintain their entries themselves
+	Skipped int
+}
+
+// re-derives the entries of the index on the field from the records of the table, adding those that are missing and removing
+// orphans, which no record requires, along with the references to them in the reverse indices of the records, e.g. in order to
+// recover after a bug or after objects in the bucket were edited manually. the revision that queries use is rebuilt.
+// records which are written while it runs are skipped, since their transactions maintain their entries. the claims of unique
+// indices are not rebuilt.
+// it is safe to run it multiple times.
+func RebuildIndex[T any](ctx context.Context, repo *MinioRepository, table schema.Table, field string) (IndexRebuild, error) {
+	rebuild := IndexRebuild{}
+	index, err := repo.resolveIndex(ctx, table, field)
+	if err != nil {
+		return rebuild, err
+	}
+	snapshot := schema.NewReadOnlyTransaction(schema.MaxTimeout())
+	snapshot.Tenant = table.Tenant
+	transactionsInProgress, err := repo.getOtherTransactionsInProgress(ctx, &snapshot)
+	if err != nil {
+		return rebuild, err
+	}
+
+	// the live entries at the start, so that those which are added by transactions in the meantime are not mistaken for orphans
+	paths, err := repo.selectPathsFromTableWhereIndexedFieldMatches(ctx, &snapshot, index.PathPrefix()+"/", nil)
+	if err != nil {
+		return rebuild, err
+	}
+	existing := make(map[string]bool, paths.Len())
+	for _, path := range paths.Items() {
+		existing[path] = true
+	}
+	required := make(map[string]bool, len(existing))
+	skipped := make(map[string]bool)
+	for id, err := range repo.listIds(ctx, table) {
+		if err != nil {
+			return rebuild, err
+		}
+		indexPaths, live, err := rebuildIndexEntries[T](ctx, repo, &snapshot, table, index, id)
+		if err != nil {
+			return rebuild, err
+		}
+		if !live {
+			skipped[id] = true
+			rebuild.Skipped++
+			continue
+		}
+		if indexPaths == nil {
+			// deleted
+			continue
+		}
+		rebuild.Records++
+		for _, indexPath := range indexPaths {
+			required[indexPath] = true
+			// even if the entry exists, so that the reverse indices refer to it
+			ok, err := repo.addIndexEntry(ctx, table, id, indexPath, transactionsInProgress)
+			if err != nil {
+				return rebuild, err
+			}
+			if ok && !existing[indexPath] {
+				rebuild.Added++
+			} else if !ok && !skipped[id] {
+				skipped[id] = true
+				rebuild.Skipped++
+			}
+		}
+	}
+
+	for _, indexPath := range paths.Items() {
+		if required[indexPath] {
+			continue
+		}
+		// unless the name of the entry is not even valid, the reference is removed first, so that the record never refers to an entry
+		// which does not exist
+		if entry, err := index.EntryFromPath(indexPath); err == nil {
+			if skipped[entry.Id] {
+				continue
+			}
+			if _, err := repo.removeFromReverseIndices(ctx, table, entry.Id, func(path string) bool { return path == indexPath }, transactionsInProgress); err != nil {
+				if errors.Is(err, StaleObjectError) {
+					rebuild.Skipped++
+					continue
+				}
+				return rebuild, err
+			}
+		}
+		if err := repo.Client.RemoveObject(ctx, repo.BucketName, indexPath, minio.RemoveObjectOptions{}); err != nil {
+			return rebuild, fmt.Errorf("ADB-0142 failed to remove orphaned index entry %s: %w", indexPath, err)
+		}
+		rebuild.Removed++
+	}
+	return rebuild, nil
+}
+
+// moves the entries of the indices of the table, which has been declared with schema.Table.WithEscapedPaths, from the paths
+// where they were stored before, which were not escaped, to the escaped ones, so that ids and values containing any characters
+// are found. entries of values and ids which are unchanged by escaping, e.g. UUIDs, are kept. the table is registered first, so
+// that nodes which cannot read escaped paths refuse to use it, see schema.ESCAPED_PATHS_FORMAT_VERSION, so upgrade all nodes to a
+// version which supports them, and then deploy the table with escaped paths everywhere, before calling it. queries for values
+// which are changed by escaping do not find them until their entries are moved. claims of unique indices at the former paths
+// are left behind, since the index entries are checked too, see getUniqueClaims. it is safe to run it multiple times.
+// Returns: what was repaired, per index, in the order of the indices of the table
+func MigrateToEscapedPaths[T any](ctx context.Context, repo *MinioRepository, table schema.Table) ([]IndexRebuild, error) {
+	if !table.EscapedPaths {
+		return nil, fmt.Errorf("ADB-0228 the paths of table %s/%s cannot be migrated, since it does not escape them. declare it with WithEscapedPaths", table.Database, table.Name)
+	}
+	if err := repo.RegisterTable(ctx, table); err != nil {
+		return nil, err
+	}
+	rebuilds := make([]IndexRebuild, 0, len(table.Indices))
+	for _, index := range table.Indices {
+		rebuild, err := RebuildIndex[T](ctx, repo, table, index.Field)
+		if err != nil {
+			return rebuilds, err
+		}
+		rebuilds = append(rebuilds, rebuild)
+	}
+	return rebuilds, nil
+}
+
+// returns the entries that the record requires, which are nil if it does not exist, and false if it has been written since the
+// snapshot was taken
+func rebuildIndexEntries[T any](ctx context.Context, repo *MinioRepository, snapshot *schema.Transaction, table schema.Table, index *schema.Index, id string) ([]string, bool, error) {
+	data, etag, err := repo.readObjectVersionForTransaction(ctx, snapshot, table.Path(id))
+	if err != nil {
+		if errors.Is(err, NoSuchKeyError) {
+			return nil, true, nil
+		}
+		return nil, false, err
+	}
+	info, exists, err := repo.statObject(ctx, table.Path(id))
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists || etag == nil || info.ETag != *etag {
+		return nil, false, nil
+	}
+	if len(*data) == 0 {
+		return nil, true, nil
+	}
+	entity := new(T)
+	if err := json.Unmarshal(*data, entity); err != nil {
+		return nil, false, err
+	}
+	indexPaths, err := getIndexPaths(*index, entity, id)
+	if err != nil {
+		return nil, false, err
+	}
+	// not nil, since the record exists, even if it is not in a partial index
+	return append(make([]string, 0, len(indexPaths)), indexPaths...), true, nil
+}
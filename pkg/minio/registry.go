@@ -0,0 +1,272 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+const SCHEMA_CHANGE_CREATED = "Created"
+const SCHEMA_CHANGE_UPDATED = "Updated"
+const SCHEMA_CHANGE_DELETED = "Deleted"
+
+// emitted by WatchSchema when a table definition in the schema registry changes
+type SchemaChangeEvent struct {
+	// Created, Updated or Deleted
+	Type string
+
+	// path of the table definition in the registry
+	Path string
+
+	// the new definition, or nil if it was deleted
+	Definition *schema.TableDefinition
+
+	// set if the registry could not be read; the watch continues regardless
+	Err error
+}
+
+// stores the definition of the table in the schema registry, so that other services can see what tables exist, and be
+// notified if they change. nothing is written if the definition is unchanged. definitions which were written in a newer format
+// are not overwritten, see FormatTooNewError.
+func (r *MinioRepository) RegisterTable(ctx context.Context, table schema.Table) error {
+	definition := table.Definition()
+	existing, err := r.GetTableDefinition(ctx, table.SchemaPath())
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if err := checkFormatVersionNumber(table.SchemaPath(), existing.FormatVersion); err != nil {
+			return err
+		}
+		if reflect.DeepEqual(*existing, definition) {
+			return nil
+		}
+	}
+
+	data, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
+	_, err = r.Client.PutObject(ctx, r.BucketName, table.SchemaPath(), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("ADB-0040 failed to put table definition %s: %w", table.SchemaPath(), err)
+	}
+	return nil
+}
+
+// compares the given tables, as declared in the code, against the schema registry, and returns a SchemaIncompatibleError
+// containing a diff if any of them have drifted incompatibly, or a FormatTooNewError if any of them were registered by a newer
+// version of the library. call it at startup, in order to refuse to start. tables which are not yet registered are compatible.
+func (r *MinioRepository) CheckCompatibility(ctx context.Context, tables []schema.Table) error {
+	problems := make([]string, 0)
+	for _, table := range tables {
+		registered, err := r.GetTableDefinition(ctx, table.SchemaPath())
+		if err != nil {
+			return err
+		}
+		if registered == nil {
+			continue
+		}
+		if err := checkFormatVersionNumber(table.SchemaPath(), registered.FormatVersion); err != nil {
+			return err
+		}
+		tableProblems, err := table.Definition().IncompatibilitiesWith(*registered)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, tableProblems...)
+	}
+	if len(problems) > 0 {
+		return &SchemaIncompatibleErrorWithDetails{
+			Details: fmt.Sprintf("ADB-0045 the schema in the code is incompatible with the schema registry:\n%s", strings.Join(problems, "\n")),
+			Problems: problems,
+		}
+	}
+	return nil
+}
+
+// reads the table definition at the given path in the schema registry. returns nil if it does not exist.
+func (r *MinioRepository) GetTableDefinition(ctx context.Context, path string) (*schema.TableDefinition, error) {
+	_, exists, err := r.statObject(ctx, path)
+	if err != nil || !exists {
+		return nil, err
+	}
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0041 failed to get table definition %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0343 failed to get table definition %s: %w", path, err)
+	}
+	var definition schema.TableDefinition
+	if err := json.Unmarshal(b, &definition); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// polls the schema registry and emits an event each time that a table definition is created, updated or deleted, so that
+// long-running services can reload indices without restarting, or fail fast if the schema is no longer what they expect.
+// definitions which exist when the watch starts do not cause events.
+// the channel is closed when the context is done.
+func (r *MinioRepository) WatchSchema(ctx context.Context, interval time.Duration) <-chan SchemaChangeEvent {
+	events := make(chan SchemaChangeEvent, 10)
+	go func() {
+		defer close(events)
+		// the consumer may stop reading once the context is done, so that nothing must be sent after that
+		send := func(event SchemaChangeEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		known, err := r.listSchemaETags(ctx)
+		if err != nil {
+			if !send(SchemaChangeEvent{Err: err}) {
+				return
+			}
+			known = make(map[string]string)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := r.listSchemaETags(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !send(SchemaChangeEvent{Err: err}) {
+					return
+				}
+				continue
+			}
+			for path, etag := range current {
+				knownETag, exists := known[path]
+				if exists && knownETag == etag {
+					continue
+				}
+				event := SchemaChangeEvent{Type: SCHEMA_CHANGE_CREATED, Path: path}
+				if exists {
+					event.Type = SCHEMA_CHANGE_UPDATED
+				}
+				event.Definition, event.Err = r.GetTableDefinition(ctx, path)
+				if !send(event) {
+					return
+				}
+			}
+			for path := range known {
+				if _, exists := current[path]; !exists {
+					if !send(SchemaChangeEvent{Type: SCHEMA_CHANGE_DELETED, Path: path}) {
+						return
+					}
+				}
+			}
+			known = current
+		}
+	}()
+	return events
+}
+
+// returns a map of path to ETag, of all table definitions in the schema registry
+func (r *MinioRepository) listSchemaETags(ctx context.Context) (map[string]string, error) {
+	etags := make(map[string]string, 10)
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:    schema.SCHEMA_ROOT,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		etags[object.Key] = object.ETag
+	}
+	return etags, nil
+}
+
+// returns the definitions of all tables in the schema registry, ordered by database and name, e.g. so that tools can list the
+// tables that they can resolve with LoadTable
+func (r *MinioRepository) ListTableDefinitions(ctx context.Context) ([]schema.TableDefinition, error) {
+	etags, err := r.listSchemaETags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	definitions := make([]schema.TableDefinition, 0, len(etags))
+	for _, path := range slices.Sorted(maps.Keys(etags)) {
+		definition, err := r.GetTableDefinition(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if definition != nil {
+			definitions = append(definitions, *definition)
+		}
+	}
+	return definitions, nil
+}
+
+// returns the table as it is registered in the schema registry, so that instances of an application resolve the same table at
+// runtime, rather than each declaring it by code, e.g. tools which operate on tables that they were not built with. fails with
+// a NoSuchKeyError if the table is not registered, and with ADB-0154 if it cannot be resolved, e.g. because it has a computed
+// index, see schema.TableDefinition.Table.
+func (r *MinioRepository) LoadTable(ctx context.Context, database schema.Database, name string) (schema.Table, error) {
+	path := (&schema.Table{Database: database, Name: name}).SchemaPath()
+	definition, err := r.GetTableDefinition(ctx, path)
+	if err != nil {
+		return schema.Table{}, err
+	}
+	if definition == nil {
+		return schema.Table{}, &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("the table %s/%s is not registered", database, name)}
+	}
+	if err := checkFormatVersionNumber(path, definition.FormatVersion); err != nil {
+		return schema.Table{}, err
+	}
+	return definition.Table()
+}
+
+// returns every definition that was registered for the table at the given path in the schema registry, the latest first, e.g.
+// to see when indices were added, or to resolve an older version with schema.TableDefinition.Table. versions which were
+// removed from the store, e.g. by a lifecycle rule, are missing.
+func (r *MinioRepository) GetTableDefinitionVersions(ctx context.Context, path string) ([]schema.TableDefinition, error) {
+	definitions := make([]schema.TableDefinition, 0)
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: path, WithVersions: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if object.Key != path || object.IsDeleteMarker || object.Size == 0 {
+			continue
+		}
+		data, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{VersionID: object.VersionID})
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0344 failed to get table definition %s: %w", path, err)
+		}
+		b, err := io.ReadAll(data)
+		data.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0345 failed to get table definition %s: %w", path, err)
+		}
+		var definition schema.TableDefinition
+		if err := json.Unmarshal(b, &definition); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
@@ -0,0 +1,372 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the transaction id recorded in the metadata of objects written by index maintenance, rather than by a transaction
+const INDEX_MAINTENANCE_TX_ID = "index-maintenance"
+
+// reindexing an index whose definition changes, without downtime, works like this:
+//  1. deploy code declaring the new revision with `Table.WithIndexRevision`, so that all writes maintain both revisions (dual-write)
+//  2. call `BackfillIndex` to add entries to the new revision for all records that were written before that
+//  3. call `CutoverIndex`, which verifies the counts and atomically switches all queries over to the new revision
+//  4. deploy code declaring only the new revision, and call `DropIndexRevision` to remove the old tree
+
+// the number of live records in a table compared to the number of entries in one revision of an index
+type IndexCounts struct {
+	Records int
+	// the number of records which have entries, rather than of entries, since multi-value indices, e.g. over JSON paths with
+	// arrays, have an entry per value
+	Entries int
+	// true for partial indices, whose entries are only for some of the records. see schema.Table.WithPartialIndex
+	Partial bool
+	// true for sparse indices, which have no entries for the records whose value is null. see schema.Table.WithSparseIndex
+	Sparse bool
+}
+
+// true if there is an entry per record, or, since the records are not read, at most one per record, if the index is partial
+// or sparse
+func (c IndexCounts) Matches() bool {
+	return c.Records == c.Entries || ((c.Partial || c.Sparse) && c.Entries <= c.Records)
+}
+
+// records which revision of an index queries use
+type indexCutover struct {
+	Field    string `json:"field"`
+	Revision int    `json:"revision"`
+}
+
+// adds index entries to the given revision of the index for all records in the table which do not yet have one.
+// records currently being written by transactions in progress are skipped, since those transactions write the entries themselves.
+// failures of individual records are counted in the index health, and do not stop the backfill.
+// it is safe to run it multiple times, e.g. if it fails part way through.
+// Returns: the number of records that were indexed
+func BackfillIndex[T any](ctx context.Context, repo *MinioRepository, table schema.Table, field string, revision int) (int, error) {
+	index, err := table.GetIndexRevision(field, revision)
+	if err != nil {
+		return 0, err
+	}
+	snapshot := schema.NewReadOnlyTransaction(schema.MaxTimeout())
+	snapshot.Tenant = table.Tenant
+	transactionsInProgress, err := repo.getOtherTransactionsInProgress(ctx, &snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	// list first, so that the lag is known
+	ids := make([]string, 0, 100)
+	for id, err := range repo.listIds(ctx, table) {
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	repo.startIndexHealth(index, len(ids))
+
+	count := 0
+	for _, id := range ids {
+		indexed, _, err := backfillIndexEntry[T](ctx, repo, &snapshot, table, index, id, transactionsInProgress)
+		repo.updateIndexHealth(index, id, err)
+		if indexed {
+			count++
+		}
+	}
+	if health, _ := repo.GetIndexHealth(table, field, revision); health.Errors > 0 {
+		return count, fmt.Errorf("ADB-0063 backfill of index %s revision %d had %d errors, the last being: %s. Run it again.", field, revision, health.Errors, health.LastError)
+	}
+	return count, nil
+}
+
+// returns true if the record was indexed, and false if it does not exist or is being written by a transaction in progress,
+// in which case inProgress is true too
+func backfillIndexEntry[T any](ctx context.Context, repo *MinioRepository, snapshot *schema.Transaction, table schema.Table, index *schema.Index, id string, transactionsInProgress map[string]uint64) (indexed bool, inProgress bool, err error) {
+	data, _, err := repo.readObjectVersionForTransaction(ctx, snapshot, table.Path(id))
+	if err != nil {
+		if errors.Is(err, NoSuchKeyError) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	if len(*data) == 0 {
+		// deleted
+		return false, false, nil
+	}
+	entity := new(T)
+	if err := json.Unmarshal(*data, entity); err != nil {
+		return false, false, err
+	}
+	// there are none if the entity is not in the partial index
+	indexPaths, err := getIndexPaths(*index, entity, id)
+	if err != nil {
+		return false, false, err
+	}
+	for _, indexPath := range indexPaths {
+		ok, err := repo.addIndexEntry(ctx, table, id, indexPath, transactionsInProgress)
+		if err != nil {
+			return false, false, err
+		}
+		if !ok {
+			return false, true, nil
+		}
+		indexed = true
+	}
+	return indexed, false, nil
+}
+
+// writes the index entry, and adds it to the reverse indices of the record, so that it is maintained by later updates and deletes.
+// returns false if the record is being written by a transaction in progress, in which case nothing is done.
+func (r *MinioRepository) addIndexEntry(ctx context.Context, table schema.Table, id string, indexPath string, transactionsInProgress map[string]uint64) (bool, error) {
+	indicesPath := table.IndicesPath(id)
+	object, err := r.Client.GetObject(ctx, r.BucketName, indicesPath, minio.GetObjectOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer object.Close()
+	var b []byte
+	info, err := object.Stat()
+	if err != nil {
+		if !table.IsAdopted() || minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+			return false, fmt.Errorf("ADB-0056 failed to read reverse indices %s: %w", indicesPath, err)
+		}
+		// an object of a table with a path template or layout which was written before the table was adopted
+	} else {
+		if _, inProgress := transactionsInProgress[info.UserMetadata[schema.TX_ID]]; inProgress {
+			return false, nil
+		}
+		if b, err = io.ReadAll(object); err != nil {
+			return false, fmt.Errorf("ADB-0056 failed to read reverse indices %s: %w", indicesPath, err)
+		}
+	}
+	var existingIndicesAsString string
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &existingIndicesAsString); err != nil {
+			return false, err
+		}
+	}
+
+	userMetadata := map[string]string{
+		schema.TX_ID: INDEX_MAINTENANCE_TX_ID,
+		// visible to all transactions, since the record it refers to was already committed
+		schema.LAST_MODIFIED: "0",
+		schema.FORMAT_VERSION_KEY: formatVersionStamp,
+	}
+	opts := minio.PutObjectOptions{ContentType: "text/plain", UserMetadata: userMetadata}
+	opts.SetMatchETagExcept("*")
+	_, err = r.Client.PutObject(ctx, r.BucketName, indexPath, bytes.NewReader([]byte{}), 0, opts)
+	if err != nil && minio.ToErrorResponse(err).StatusCode != http.StatusPreconditionFailed { // else it already exists
+		return false, fmt.Errorf("ADB-0057 failed to put index entry %s: %w", indexPath, err)
+	}
+
+	existingIndices := strings.Split(strings.TrimSpace(existingIndicesAsString), "\n")
+	if slices.Contains(existingIndices, indexPath) {
+		return true, nil
+	}
+	indicesData, err := json.Marshal(strings.TrimSpace(existingIndicesAsString + "\n" + indexPath))
+	if err != nil {
+		return false, err
+	}
+	opts = minio.PutObjectOptions{ContentType: "text/plain", UserMetadata: map[string]string{
+		schema.TX_ID: INDEX_MAINTENANCE_TX_ID,
+		schema.LAST_MODIFIED: fmt.Sprintf("%d", schema.Now().UnixMicro()),
+		schema.FORMAT_VERSION_KEY: formatVersionStamp,
+	}}
+	if info.ETag == "" {
+		opts.SetMatchETagExcept("*")
+	} else {
+		opts.SetMatchETag(info.ETag)
+	}
+	_, err = r.Client.PutObject(ctx, r.BucketName, indicesPath, bytes.NewReader(indicesData), int64(len(indicesData)), opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+			return false, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("reverse indices %s were modified concurrently. Run again.", indicesPath)}
+		}
+		return false, fmt.Errorf("ADB-0058 failed to put reverse indices %s: %w", indicesPath, err)
+	}
+	return true, nil
+}
+
+// counts the live records in the table and the live entries in the given revision of the index, so that an operator knows
+// whether the revision is complete. if they differ, the revision is unavailable to queries until they match again. see
+// IndexUnavailablePolicy
+func (r *MinioRepository) VerifyIndex(ctx context.Context, table schema.Table, field string, revision int) (IndexCounts, error) {
+	index := schema.Index{Table: table, Field: field, Revision: revision}
+	if declared, err := table.GetIndexRevision(field, revision); err == nil {
+		index = *declared
+	}
+	counts := IndexCounts{Partial: index.Filter != nil, Sparse: index.Sparse}
+	snapshot := schema.NewReadOnlyTransaction(schema.MaxTimeout())
+
+	for id, err := range r.listIds(ctx, table) {
+		if err != nil {
+			return counts, err
+		}
+		data, _, err := r.readObjectVersionForTransaction(ctx, &snapshot, table.Path(id))
+		if err != nil {
+			if errors.Is(err, NoSuchKeyError) {
+				continue
+			}
+			return counts, err
+		}
+		if len(*data) > 0 {
+			counts.Records++
+		}
+	}
+
+	paths, err := r.selectPathsFromTableWhereIndexedFieldMatches(ctx, &snapshot, index.PathPrefix()+"/", nil)
+	if err != nil {
+		return counts, err
+	}
+	ids := make(map[string]bool, paths.Len())
+	for _, path := range paths.Items() {
+		entry, err := index.EntryFromPath(path)
+		if err != nil {
+			return counts, err
+		}
+		ids[entry.Id] = true
+	}
+	counts.Entries = len(ids)
+	r.recordIndexConsistency(&index, counts.Matches())
+	return counts, nil
+}
+
+// verifies that the given revision of the index is complete, and if so, atomically switches all queries to it.
+func (r *MinioRepository) CutoverIndex(ctx context.Context, table schema.Table, field string, revision int) error {
+	counts, err := r.VerifyIndex(ctx, table, field, revision)
+	if err != nil {
+		return err
+	}
+	if !counts.Matches() {
+		return fmt.Errorf("ADB-0059 refusing to cut over to revision %d of index %s, since it has %d entries for %d records", revision, field, counts.Entries, counts.Records)
+	}
+	data, err := json.Marshal(indexCutover{Field: field, Revision: revision})
+	if err != nil {
+		return err
+	}
+	_, err = r.Client.PutObject(ctx, r.BucketName, table.ReindexPath(field), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("ADB-0060 failed to put index cutover %s: %w", table.ReindexPath(field), err)
+	}
+	return nil
+}
+
+// removes the given revision of the index from the reverse indices of the records, and then its whole tree. refuses to remove the
+// revision that queries use. like DropIndex, records being written by a transaction in progress keep the revision in their
+// reverse indices, so run it again once they have completed, so that nothing is left behind.
+func (r *MinioRepository) DropIndexRevision(ctx context.Context, table schema.Table, field string, revision int) error {
+	active, err := r.readIndexCutover(ctx, table, field)
+	if err != nil {
+		return err
+	}
+	if (active == nil && revision == 0) || (active != nil && active.Revision == revision) {
+		return fmt.Errorf("ADB-0061 refusing to drop revision %d of index %s, since queries use it", revision, field)
+	}
+	index := schema.Index{Table: table, Field: field, Revision: revision}
+	prefix := index.PathPrefix() + "/"
+
+	transactionsInProgress, err := r.getOtherTransactionsInProgress(ctx, &schema.Transaction{Tenant: table.Tenant})
+	if err != nil {
+		return err
+	}
+	inProgress := 0
+	for id, err := range r.listIds(ctx, table) {
+		if err != nil {
+			return err
+		}
+		_, err := r.removeFromReverseIndices(ctx, table, id, func(indexPath string) bool { return strings.HasPrefix(indexPath, prefix) }, transactionsInProgress)
+		if err != nil {
+			if !errors.Is(err, StaleObjectError) {
+				return err
+			}
+			inProgress++
+		}
+	}
+
+	if err := r.DeleteFolder(ctx, index.PathPrefix(), true, true); err != nil {
+		return err
+	}
+	if inProgress > 0 {
+		return fmt.Errorf("ADB-0172 the reverse indices of %d records still refer to revision %d of index %s, since they were being written by transactions in progress. Run it again.", inProgress, revision, field)
+	}
+	return nil
+}
+
+// returns the index that queries should use for the given field, which is the cut over revision while reindexing
+func (r *MinioRepository) resolveIndex(ctx context.Context, table schema.Table, field string) (*schema.Index, error) {
+	if table.CountIndexRevisions(field) <= 1 {
+		return table.GetIndex(field)
+	}
+	active, err := r.readIndexCutover(ctx, table, field)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		// not yet cut over, so use the one that was declared first
+		return table.GetIndex(field)
+	}
+	return table.GetIndexRevision(field, active.Revision)
+}
+
+func (r *MinioRepository) readIndexCutover(ctx context.Context, table schema.Table, field string) (*indexCutover, error) {
+	object, err := r.Client.GetObject(ctx, r.BucketName, table.ReindexPath(field), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ADB-0062 failed to get index cutover %s: %w", table.ReindexPath(field), err)
+	}
+	var cutover indexCutover
+	if err := json.Unmarshal(b, &cutover); err != nil {
+		return nil, err
+	}
+	return &cutover, nil
+}
+
+// iterates over the ids of all objects in the table, including deleted ones whose tombstones have not yet been removed
+func (r *MinioRepository) listIds(ctx context.Context, table schema.Table) func(yield func(string, error) bool) {
+	return r.listIdsAfter(ctx, table, "")
+}
+
+// like listIds, but only the ids of objects whose paths sort after the path of the object with the given id, if it is set
+func (r *MinioRepository) listIdsAfter(ctx context.Context, table schema.Table, after string) func(yield func(string, error) bool) {
+	startAfter := ""
+	if after != "" {
+		startAfter = table.Path(after)
+	}
+	return func(yield func(string, error) bool) {
+		for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+			Prefix:     table.DataPathPrefix(),
+			Recursive:  true,
+			StartAfter: startAfter,
+		}) {
+			if object.Err != nil {
+				yield("", object.Err)
+				return
+			}
+			id, ok := table.IdFromPath(object.Key)
+			if !ok {
+				// e.g. reverse indices
+				continue
+			}
+			if !yield(id, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// renames the table, by registering the renamed table in the schema registry, copying the latest versions of its objects below
+// `<database>/<newName>/` on the server, and finally removing the table like DropTable does. the entries of its indices are named
+// after the table, see schema.PathLayout, so they are renamed as they are copied, and so are the paths in the reverse indices of
+// its records. the token confirms the table as it is, see ConfirmationToken, so that nothing is written to it while it is
+// renamed, and a rename which failed part way is continued by running it again with the same token. older versions of the
+// objects are not copied. deploy code which uses the new name, or an alias of the old one, see SetTableAlias, since transactions
+// using the old name write to a table that no longer exists. foreign keys of other tables which reference it are not changed.
+// fails with ADB-0293 if the table has a path template or layout, since its objects are stored where those say rather than
+// below its name, with ADB-0292 if it belongs to a tenant other than the default one, since it is registered for all of them, or
+// with ADB-0294 if another table with the new name is registered.
+// Returns: the renamed table, and the number of objects that were copied
+func (r *MinioRepository) RenameTable(ctx context.Context, table schema.Table, newName string, token string) (schema.Table, int, error) {
+	renamed := table.WithName(newName)
+	if newName == table.Name || newName == "" || strings.Contains(newName, "/") {
+		return renamed, 0, fmt.Errorf("ADB-0166 table %s/%s cannot be renamed to %q", table.Database, table.Name, newName)
+	}
+	if table.Tenant != schema.DEFAULT_TENANT {
+		return renamed, 0, fmt.Errorf("ADB-0292 table %s/%s of tenant %s cannot be renamed, since it is registered for all tenants", table.Database, table.Name, table.Tenant)
+	}
+	if table.IsAdopted() {
+		return renamed, 0, fmt.Errorf("ADB-0293 table %s/%s cannot be renamed, since its objects are stored where its path template or layout says", table.Database, table.Name)
+	}
+	if err := r.checkConfirmationToken(ctx, table, token); err != nil {
+		return renamed, 0, err
+	}
+	existing, err := r.GetTableDefinition(ctx, renamed.SchemaPath())
+	if err != nil {
+		return renamed, 0, err
+	}
+	if existing != nil && !reflect.DeepEqual(*existing, renamed.Definition()) {
+		// unless it was registered by a rename which failed part way
+		return renamed, 0, fmt.Errorf("ADB-0294 table %s/%s cannot be renamed to %s, since a table with that name is registered", table.Database, table.Name, newName)
+	}
+	if err := r.RegisterTable(ctx, renamed); err != nil {
+		return renamed, 0, err
+	}
+
+	count := 0
+	folder := table.Folder()
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: folder, Recursive: true}) {
+		if object.Err != nil {
+			return renamed, count, fmt.Errorf("ADB-0295 failed to list the objects of table %s/%s: %w", table.Database, table.Name, object.Err)
+		}
+		path, ok := renamedPath(table, renamed, object.Key)
+		if !ok || object.Key == table.LeasePath() {
+			// leases are acquired again by the writers of the renamed table
+			continue
+		}
+		switch {
+		case strings.HasSuffix(object.Key, ".indices") && strings.HasPrefix(object.Key, folder+"data/"):
+			err = r.copyRewritten(ctx, object.Key, path, &renamed.Storage, func(b []byte) ([]byte, error) {
+				var indicesAsString string
+				if len(b) == 0 {
+					return b, nil
+				}
+				if err := json.Unmarshal(b, &indicesAsString); err != nil {
+					return nil, err
+				}
+				indices := make([]string, 0)
+				for _, indexPath := range strings.Split(strings.TrimSpace(indicesAsString), "\n") {
+					if renamedIndexPath, ok := renamedPath(table, renamed, indexPath); ok {
+						indices = append(indices, renamedIndexPath)
+					}
+				}
+				return json.Marshal(strings.Join(indices, "\n"))
+			})
+		case strings.HasPrefix(object.Key, folder+schema.PINS_FOLDER+"/"):
+			err = r.copyRewritten(ctx, object.Key, path, nil, func(b []byte) ([]byte, error) {
+				var pin Pin
+				if err := json.Unmarshal(b, &pin); err != nil {
+					return nil, err
+				}
+				pin.Table = newName
+				return json.Marshal(pin)
+			})
+		default:
+			// compressed objects keep their content encoding, since their metadata is copied
+			dest := minio.CopyDestOptions{Bucket: r.BucketName, Object: path}
+			if err = storeCopy(&renamed.Storage, &dest); err == nil {
+				_, err = r.Client.CopyObject(ctx, dest, minio.CopySrcOptions{Bucket: r.BucketName, Object: object.Key})
+			}
+		}
+		if err != nil {
+			return renamed, count, fmt.Errorf("ADB-0296 failed to copy %s to %s: %w", object.Key, path, err)
+		}
+		count++
+	}
+
+	if _, err := r.removeTable(ctx, table, func(path string) bool { return true }); err != nil {
+		return renamed, count, err
+	}
+	if _, err := r.removeAllVersionsInBatches(ctx, table.SchemaPath(), DROP_TABLE_BATCH_SIZE); err != nil {
+		return renamed, count, err
+	}
+	return renamed, count, nil
+}
+
+// returns the path that the object at the path of the table has in the renamed table, and false if it is not copied, i.e. it
+// is not below the folder of the table, or it is an entry of an index which the table no longer has
+func renamedPath(table schema.Table, renamed schema.Table, path string) (string, bool) {
+	folder := table.Folder()
+	rest, found := strings.CutPrefix(path, folder)
+	if !found {
+		return "", false
+	}
+	newFolder := renamed.Folder()
+	if !strings.HasPrefix(rest, "indices/") {
+		return newFolder + rest, true
+	}
+	for i := range table.Indices {
+		index := &table.Indices[i]
+		if !strings.HasPrefix(path, index.PathPrefix()+"/") {
+			continue
+		}
+		entry, err := index.EntryFromPath(path)
+		if err != nil {
+			return "", false
+		}
+		renamedIndex := *index
+		renamedIndex.Table = renamed
+		valueFolder := rest[:strings.LastIndex(rest, "/")]
+		return newFolder + valueFolder + "/" + (schema.DefaultPathLayout{}).IndexEntryName(&renamedIndex, entry.Id), true
+	}
+	return "", false
+}
+
+// copies the object to the path, with its contents as rewrite returns them, and its metadata, encrypted and retained as the
+// storage options say, if there are any
+func (r *MinioRepository) copyRewritten(ctx context.Context, from string, to string, storage *schema.TableStorage, rewrite func([]byte) ([]byte, error)) error {
+	object, err := r.Client.GetObject(ctx, r.BucketName, from, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+	info, err := object.Stat()
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return err
+	}
+	if b, err = rewrite(b); err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{ContentType: info.ContentType, UserMetadata: info.UserMetadata}
+	if storage != nil {
+		if opts.ServerSideEncryption, opts.Mode, opts.RetainUntilDate, err = protection(*storage); err != nil {
+			return err
+		}
+	}
+	_, err = r.Client.PutObject(ctx, r.BucketName, to, bytes.NewReader(b), int64(len(b)), opts)
+	return err
+}
@@ -0,0 +1,97 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// continues the transaction that the token was created for, e.g. in a backend worker that a frontend service handed it off to.
+// fails if the transaction has changed since the token was created, since that means another service is still using it,
+// or if it has timed out or is no longer in progress.
+// objects that the transaction wrote are read again, so that it continues to see its own changes. objects that it only read are
+// not, so they are read again if needed.
+func (r *MinioRepository) ResumeFromToken(ctx context.Context, token string) (*schema.Transaction, error) {
+	parsed, err := schema.ParseTransactionToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Now().UnixMicro() > parsed.TimeoutMicroseconds {
+		return nil, schema.TransactionTimedOutError
+	}
+
+	path := parsed.GetPath() + "/" + TX_FILENAME
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0089 failed to get transaction %s: %w", path, err)
+	}
+	defer object.Close()
+	info, err := object.Stat()
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("ADB-0089 transaction %s no longer exists, since it was committed or rolled back", parsed.Id)
+		}
+		return nil, fmt.Errorf("ADB-0089 failed to get transaction %s: %w", path, err)
+	}
+	if info.ETag != parsed.Etag {
+		return nil, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("transaction %s has changed since the token was created", parsed.Id)}
+	}
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0089 failed to get transaction %s: %w", path, err)
+	}
+	var tx schema.Transaction
+	if err := json.Unmarshal(b, &tx); err != nil {
+		return nil, err
+	}
+	tx.Etag = info.ETag
+	tx.Cache = make(map[string]*schema.ObjectAndETag)
+	if err := tx.IsOk(); err != nil {
+		return nil, err
+	}
+
+	// rebuild the cache, in the order that the steps were executed, so that the transaction sees its own changes
+	for _, step := range tx.Steps {
+		if !step.Executed {
+			continue
+		}
+		switch step.Type {
+		case schema.STEP_INSERT_DATA, schema.STEP_UPDATE_DATA:
+			data, err := r.readVersion(ctx, step.Path, step.FinalVersionId)
+			if err != nil {
+				return nil, err
+			}
+			step.Data = &data // e.g. for the change log
+			// unmarshalled into the type that the caller reads it as
+			var raw any = json.RawMessage(data)
+			tx.CacheWrite(step.Path, &schema.ObjectAndETag{Object: &raw, ETag: step.FinalETag})
+		case schema.STEP_INSERT_ADD_INDEX, schema.STEP_UPDATE_ADD_INDEX, schema.STEP_UPDATE_INDEX_PROJECTION:
+			tx.CacheWrite(step.Path, &schema.ObjectAndETag{ETag: step.FinalETag})
+		case schema.STEP_DELETE_DATA, schema.STEP_UPDATE_REMOVE_INDEX, schema.STEP_DELETE_REMOVE_INDEX:
+			tx.CacheWrite(step.Path, nil)
+		}
+	}
+	return &tx, nil
+}
+
+func (r *MinioRepository) readVersion(ctx context.Context, path string, versionId *string) ([]byte, error) {
+	opts := minio.GetObjectOptions{}
+	if versionId != nil {
+		opts.VersionID = *versionId
+	}
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0090 failed to get version of object with Path %s: %w", path, err)
+	}
+	defer object.Close()
+	b, err := readObject(object)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0090 failed to get version of object with Path %s: %w", path, err)
+	}
+	return b, nil
+}
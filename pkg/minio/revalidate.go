@@ -0,0 +1,51 @@
+package minio
+
+import (
+	"context"
+	"slices"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// returns the ETag of the latest version of the object, if it was written by a transaction which has committed, with a HEAD
+// request rather than by reading the object, so that clients can cheaply revalidate what they read before.
+// returns nil if the object does not exist, or its latest version is not yet committed, in which case it must be read as usual
+// to find the version that is visible.
+func (r *MinioRepository) GetCommittedETag(ctx context.Context, path string) (*string, error) {
+	info, exists, err := r.statObject(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || info.Size == 0 {
+		// missing, or a tombstone
+		return nil, nil
+	}
+	objectTxId := info.UserMetadata[schema.TX_ID]
+	tenant, _ := schema.TenantFromPath(path)
+	reader := &schema.Transaction{Tenant: tenant}
+	var inProgress []string
+	if r.writeIntentsEnabled {
+		if inProgress, err = r.getTransactionsToIgnoreFromWriteIntents(ctx, reader, path); err != nil {
+			return nil, err
+		}
+	} else {
+		transactionsInProgress, err := r.getOtherTransactionsInProgress(ctx, reader)
+		if err != nil {
+			return nil, err
+		}
+		for id := range transactionsInProgress {
+			inProgress = append(inProgress, id)
+		}
+	}
+	if slices.Contains(inProgress, objectTxId) {
+		return nil, nil
+	}
+	return &info.ETag, nil
+}
+
+// returns a token which changes whenever a transaction that wrote to the table commits, e.g. for use as the ETag of query
+// results, or an empty string if nothing has ever been committed to it. it costs one HEAD request.
+func (r *MinioRepository) GetTableETag(ctx context.Context, table schema.Table) (string, error) {
+	generation, _, err := r.getTableGeneration(ctx, table)
+	return generation, err
+}
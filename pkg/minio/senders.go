@@ -0,0 +1,250 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sends messages as emails via SMTP. services such as SES can also be used via their SMTP interface, see SesSender for their API.
+type SmtpSender struct {
+	// host:port
+	Address string
+	// optional, e.g. smtp.PlainAuth
+	Auth smtp.Auth
+	From string
+}
+
+func (s *SmtpSender) Send(ctx context.Context, message *OutboxMessage) error {
+	if err := s.sendMail(ctx, message); err != nil {
+		return fmt.Errorf("ADB-0084 failed to send message %s via SMTP: %w", message.Id, err)
+	}
+	return nil
+}
+
+// like smtp.SendMail, but the connection is closed once the context is done, so that a server which does not respond does not
+// block the dispatcher
+func (s *SmtpSender) sendMail(ctx context.Context, message *OutboxMessage) error {
+	host, _, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return errors.Join(err, ctx.Err())
+	}
+	defer client.Close()
+	send := func() error {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return err
+			}
+		}
+		if s.Auth != nil {
+			if ok, _ := client.Extension("AUTH"); !ok {
+				return errors.New("the server does not support AUTH")
+			}
+			if err := client.Auth(s.Auth); err != nil {
+				return err
+			}
+		}
+		if err := client.Mail(s.From); err != nil {
+			return err
+		}
+		for _, to := range message.To {
+			if err := client.Rcpt(to); err != nil {
+				return err
+			}
+		}
+		writer, err := client.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(message.asEmail(s.From)); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		return client.Quit()
+	}
+	if err := send(); err != nil {
+		return errors.Join(err, ctx.Err())
+	}
+	return nil
+}
+
+// sends messages as emails via the API of Amazon SES (version 2), signing the requests with the given credentials
+type SesSender struct {
+	// e.g. eu-central-1
+	Region          string
+	AccessKeyId     string
+	SecretAccessKey string
+	// optional, for temporary credentials
+	SessionToken string
+	From         string
+	// optional, defaults to https://email.<region>.amazonaws.com
+	Endpoint string
+	// optional, defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// the request body of the SendEmail action of the SES API
+type sesSendEmailRequest struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Simple struct {
+			Subject sesContent `json:"Subject"`
+			Body    struct {
+				Text sesContent `json:"Text"`
+			} `json:"Body"`
+		} `json:"Simple"`
+	} `json:"Content"`
+}
+
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+func (s *SesSender) Send(ctx context.Context, message *OutboxMessage) error {
+	body := sesSendEmailRequest{FromEmailAddress: s.From}
+	body.Destination.ToAddresses = message.To
+	body.Content.Simple.Subject = sesContent{Data: message.Subject, Charset: "UTF-8"}
+	body.Content.Simple.Body.Text = sesContent{Data: message.Body, Charset: "UTF-8"}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://email.%s.amazonaws.com", s.Region)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/v2/email/outbound-emails", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("ADB-0181 failed to create the request to send message %s via SES: %w", message.Id, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	signAwsV4(request, data, s.Region, "ses", s.AccessKeyId, s.SecretAccessKey, s.SessionToken, time.Now())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("ADB-0182 failed to send message %s via SES: %w", message.Id, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("ADB-0183 failed to send message %s via SES: status %d", message.Id, response.StatusCode)
+	}
+	return nil
+}
+
+// signs the request with AWS signature version 4, see https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+func signAwsV4(request *http.Request, body []byte, region string, service string, accessKeyId string, secretAccessKey string, sessionToken string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", sessionToken)
+		signed = append(signed, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := request.Header.Get(name)
+		if name == "host" {
+			value = request.URL.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(value))
+	}
+	signedHeaders := strings.Join(signed, ";")
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{request.Method, path, request.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := hmacSha256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, service)
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyId, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// posts messages as JSON to a URL. any status other than 2xx is an error.
+type WebhookSender struct {
+	Url string
+	// optional, defaults to http.DefaultClient
+	Client *http.Client
+	// optional, e.g. for authorization
+	Headers map[string]string
+}
+
+func (s *WebhookSender) Send(ctx context.Context, message *OutboxMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("ADB-0085 failed to create the request to post message %s to webhook %s: %w", message.Id, s.Url, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	// so that the receiver can deduplicate, since messages are sent at least once
+	request.Header.Set("Idempotency-Key", message.Id)
+	for key, value := range s.Headers {
+		request.Header.Set(key, value)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("ADB-0184 failed to post message %s to webhook %s: %w", message.Id, s.Url, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("ADB-0185 failed to post message %s to webhook %s: status %d", message.Id, s.Url, response.StatusCode)
+	}
+	return nil
+}
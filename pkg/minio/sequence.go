@@ -0,0 +1,120 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// the number of times that a Sequence tries to allocate a block, when other processes allocate blocks at the same time
+const SEQUENCE_MAX_ATTEMPTS = 10
+
+// generates numeric ids for the entities of a table, e.g. invoice numbers, starting at 1. the last value that was allocated is
+// stored in the object at schema.Table.SequencePath, which is replaced conditionally on its ETag, so that several processes
+// never allocate the same value. values are allocated in blocks, so that most calls to Next cost no request. values of a block
+// which are not used before the process ends are never used, so the ids have gaps, and are only ordered within a process.
+// a sequence is safe for concurrent use.
+type Sequence struct {
+	repo      *MinioRepository
+	path      string
+	blockSize int64
+
+	mu    sync.Mutex
+	next  int64 // the next value of the block that was allocated
+	limit int64 // the first value after the block
+}
+
+// the contents of the object of a sequence
+type sequenceState struct {
+	Last int64 `json:"last"`
+}
+
+// returns a sequence for the table, which allocates blockSize values at a time, e.g. 1 if there must be as few gaps as possible,
+// at the cost of a request per value, or 100 for tables that are written often. panics if the block size is less than one,
+// since sequences are declared by code.
+func NewSequence(repo *MinioRepository, table schema.Table, blockSize int64) *Sequence {
+	if blockSize < 1 {
+		panic(fmt.Sprintf("ADB-0171 invalid block size %d of the sequence of table %s/%s", blockSize, table.Database, table.Name))
+	}
+	return &Sequence{repo: repo, path: table.SequencePath(), blockSize: blockSize}
+}
+
+// returns the next value of the sequence, allocating a block if the values of the last one are used up.
+// If other processes keep allocating blocks at the same time, so that no block could be allocated, returns a StaleObjectError.
+func (s *Sequence) Next(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == s.limit {
+		first, err := s.allocate(ctx)
+		if err != nil {
+			return 0, err
+		}
+		s.next, s.limit = first, first+s.blockSize
+	}
+	value := s.next
+	s.next++
+	return value, nil
+}
+
+// allocates a block, retrying if another process allocates one at the same time
+// Returns: the first value of the block
+func (s *Sequence) allocate(ctx context.Context) (int64, error) {
+	for attempt := 0; attempt < SEQUENCE_MAX_ATTEMPTS; attempt++ {
+		state, etag, err := s.read(ctx)
+		if err != nil {
+			return 0, err
+		}
+		opts := minio.PutObjectOptions{ContentType: "application/json"}
+		if etag == nil {
+			opts.SetMatchETagExcept("*") // fail if another process creates it first
+		} else {
+			opts.SetMatchETag(*etag) // fail if another process allocates a block first
+		}
+		first := state.Last + 1
+		data, err := json.Marshal(sequenceState{Last: state.Last + s.blockSize})
+		if err != nil {
+			return 0, err
+		}
+		_, err = s.repo.Client.PutObject(ctx, s.repo.BucketName, s.path, bytes.NewReader(data), int64(len(data)), opts)
+		if err == nil {
+			return first, nil
+		}
+		if minio.ToErrorResponse(err).StatusCode != http.StatusPreconditionFailed {
+			return 0, fmt.Errorf("ADB-0255 failed to put sequence %s: %w", s.path, err)
+		}
+	}
+	return 0, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("ADB-0256 no block of sequence %s could be allocated after %d attempts, since other processes allocated blocks at the same time", s.path, SEQUENCE_MAX_ATTEMPTS)}
+}
+
+// reads the state of the sequence, and its ETag, or nil if the sequence has not allocated a block yet
+func (s *Sequence) read(ctx context.Context) (sequenceState, *string, error) {
+	var state sequenceState
+	object, err := s.repo.Client.GetObject(ctx, s.repo.BucketName, s.path, minio.GetObjectOptions{})
+	if err != nil {
+		return state, nil, fmt.Errorf("ADB-0257 failed to get sequence %s: %w", s.path, err)
+	}
+	defer object.Close()
+	// stat the same object that is read, so that the ETag matches the contents
+	info, err := object.Stat()
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return state, nil, nil
+		}
+		return state, nil, fmt.Errorf("ADB-0258 failed to get sequence %s: %w", s.path, err)
+	}
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return state, nil, fmt.Errorf("ADB-0259 failed to get sequence %s: %w", s.path, err)
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, nil, fmt.Errorf("ADB-0260 invalid sequence %s: %w", s.path, err)
+	}
+	return state, &info.ETag, nil
+}
@@ -0,0 +1,137 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// returns the serialised entity with the fields of the version which an update of the object at the path replaces, which the
+// type of the entity does not declare, so that they survive being read into a struct without them and written back, or nil if
+// there are none, so that the entity is serialised as usual. only UpdateTable calls it, for updates and upserts alike, since
+// inserts replace no version. see schema.Table.WithSoftSchema
+func (r *MinioRepository) preserveUnknownFields(ctx context.Context, transaction *schema.Transaction, path string, etag string, entity any) (*[]byte, error) {
+	known := knownFields(reflect.TypeOf(entity))
+	if known == nil {
+		// not a struct, so all of its fields are written
+		return nil, nil
+	}
+	stored, err := r.readReplacedVersion(ctx, transaction, path, etag)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	var storedFields map[string]json.RawMessage
+	if err := json.Unmarshal(stored, &storedFields); err != nil {
+		// not an object, so it has no fields
+		return nil, nil
+	}
+	unknown := make([]string, 0)
+	for name := range storedFields {
+		if !slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, name) }) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil, nil
+	}
+	slices.Sort(unknown)
+
+	data, err := transaction.StepData(&schema.TransactionStep{Path: path, Entity: &entity})
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' || data[len(data)-1] != '}' {
+		return nil, fmt.Errorf("ADB-0152 the entity at %s cannot keep its unknown fields, since it is not written as a JSON object", path)
+	}
+	// appended, so that the declared fields keep their order
+	merged := bytes.NewBuffer(make([]byte, 0, len(data)+len(stored)))
+	merged.Write(data[:len(data)-1])
+	empty := len(bytes.TrimSpace(data[1:len(data)-1])) == 0
+	for _, name := range unknown {
+		if !empty {
+			merged.WriteByte(',')
+		}
+		empty = false
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		merged.Write(key)
+		merged.WriteByte(':')
+		merged.Write(storedFields[name])
+	}
+	merged.WriteByte('}')
+	b := merged.Bytes()
+	return &b, nil
+}
+
+// returns the data of the version that an update of the object at the path replaces, i.e. that with the ETag, or that which the
+// transaction sees, for upserts, whose ETag is empty. nil if there is none.
+func (r *MinioRepository) readReplacedVersion(ctx context.Context, transaction *schema.Transaction, path string, etag string) ([]byte, error) {
+	if etag == "" {
+		data, _, err := r.readObjectVersionForTransaction(ctx, transaction, path)
+		if err != nil || data == nil {
+			return nil, err
+		}
+		return *data, nil
+	}
+	opts := minio.GetObjectOptions{}
+	opts.SetMatchETag(etag)
+	object, err := r.Client.GetObject(ctx, r.BucketName, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	b, err := readObject(object)
+	if err != nil {
+		respErr := minio.ToErrorResponse(err)
+		if respErr.StatusCode == http.StatusNotFound || respErr.StatusCode == http.StatusPreconditionFailed {
+			// the update fails as stale when it is written, or writes a new object
+			return nil, nil
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// returns the names of the fields of the struct type as they are in its JSON, including those of embedded structs, or nil if
+// it is not a struct
+func knownFields(t reflect.Type) []string {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	known := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			if embedded := knownFields(field.Type); embedded != nil {
+				known = append(known, embedded...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		known = append(known, tag)
+	}
+	return known
+}
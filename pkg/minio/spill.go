@@ -0,0 +1,77 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// objects evicted from a transaction cache are spilled to `spill/<txId>/<path of object>`
+const SPILL_ROOT = "spill/"
+
+// spills objects evicted from the cache of one transaction to temporary objects in the bucket
+type objectCacheSpill struct {
+	repo   *MinioRepository
+	prefix string
+}
+
+// sets the cache limits of the transaction, spilling objects that are evicted to temporary objects in the bucket, rather than
+// dropping them, so that reads remain repeatable even though the cache is limited.
+// the temporary objects are removed when the transaction is committed or rolled back. read-only transactions, which need not be
+// committed, must call ReleaseCacheSpill instead. those left behind, e.g. because the process ended, are removed by the garbage
+// collection, once the transaction must have ended.
+func (r *MinioRepository) SpillCacheToBucket(tx *schema.Transaction, limits schema.CacheLimits) {
+	limits.Spill = &objectCacheSpill{repo: r, prefix: SPILL_ROOT + tx.Id + "/"}
+	tx.CacheLimits = limits
+}
+
+func (s *objectCacheSpill) Spill(ctx context.Context, path string, data []byte) error {
+	_, err := s.repo.Client.PutObject(ctx, s.repo.BucketName, s.prefix+path, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("ADB-0100 failed to put spilled object %s: %w", s.prefix+path, err)
+	}
+	return nil
+}
+
+func (s *objectCacheSpill) Restore(ctx context.Context, path string) ([]byte, bool, error) {
+	object, err := s.repo.Client.GetObject(ctx, s.repo.BucketName, s.prefix+path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, false, fmt.Errorf("ADB-0101 failed to get spilled object %s: %w", s.prefix+path, err)
+	}
+	defer object.Close()
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("ADB-0101 failed to read spilled object %s: %w", s.prefix+path, err)
+	}
+	return data, true, nil
+}
+
+// removes the objects that the transaction spilled from its cache, if it spills to the bucket
+func (r *MinioRepository) ReleaseCacheSpill(ctx context.Context, tx *schema.Transaction) error {
+	spill, ok := tx.CacheLimits.Spill.(*objectCacheSpill)
+	if !ok {
+		return nil
+	}
+	if err := r.DeleteFolder(ctx, spill.prefix, true, true); err != nil {
+		return fmt.Errorf("ADB-0102 failed to remove the objects spilled by tx %s: %w", tx.Id, err)
+	}
+	return nil
+}
+
+// removes the versions of spilled objects which are older than the longest timeout of transactions, since the transactions
+// which spilled them must have ended, without removing them, e.g. because their process ended
+// Returns: the number of versions that were removed
+func (r *MinioRepository) removeExpiredSpills(ctx context.Context) (int, error) {
+	expiredBefore := schema.Now().Add(-schema.MaxTimeout())
+	return r.removeVersionsInBatches(ctx, SPILL_ROOT, DROP_INDEX_BATCH_SIZE, func(object minio.ObjectInfo) bool {
+		return object.LastModified.Before(expiredBefore)
+	})
+}
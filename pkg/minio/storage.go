@@ -0,0 +1,95 @@
+package minio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// applies the storage options of the step, if it has any, to the options with which it is put, and returns the data as it is put,
+// i.e. compressed if the options say so. the data of the step are left uncompressed, since they are what the transaction holds.
+func storeStep(step *schema.TransactionStep, opts *minio.PutObjectOptions, data []byte) ([]byte, error) {
+	if step.Storage == nil {
+		return data, nil
+	}
+	var err error
+	if opts.ServerSideEncryption, opts.Mode, opts.RetainUntilDate, err = protection(*step.Storage); err != nil {
+		return nil, err
+	}
+	if step.Storage.Compression == schema.STORAGE_COMPRESSION_GZIP && len(data) > 0 {
+		// tombstones stay empty, since they are recognised by their size
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("ADB-0273 failed to compress %s: %w", step.Path, err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("ADB-0274 failed to compress %s: %w", step.Path, err)
+		}
+		opts.ContentEncoding = schema.STORAGE_COMPRESSION_GZIP
+		data = compressed.Bytes()
+	}
+	return data, nil
+}
+
+// applies the encryption and retention of the storage options, which copies honour too, to the options of the copy
+func storeCopy(storage *schema.TableStorage, opts *minio.CopyDestOptions) error {
+	if storage == nil {
+		return nil
+	}
+	var err error
+	opts.Encryption, opts.Mode, opts.RetainUntilDate, err = protection(*storage)
+	return err
+}
+
+// returns the encryption and retention of the version that is written with the storage options, i.e. no encryption and no mode
+// if they leave them to the bucket
+func protection(storage schema.TableStorage) (encrypt.ServerSide, minio.RetentionMode, time.Time, error) {
+	var sse encrypt.ServerSide
+	switch storage.Encryption {
+	case schema.STORAGE_ENCRYPTION_SSE_S3:
+		sse = encrypt.NewSSE()
+	case schema.STORAGE_ENCRYPTION_SSE_KMS:
+		var err error
+		if sse, err = encrypt.NewSSEKMS(storage.EncryptionKeyId, nil); err != nil {
+			return nil, "", time.Time{}, fmt.Errorf("ADB-0275 invalid encryption key %s: %w", storage.EncryptionKeyId, err)
+		}
+	}
+	if storage.VersionRetention == 0 {
+		return sse, "", time.Time{}, nil
+	}
+	return sse, minio.Governance, time.Now().Add(storage.VersionRetention), nil
+}
+
+// reads the contents of the object, which are decompressed if they were compressed when they were written, see
+// schema.TableStorage
+func readObject(object *minio.Object) ([]byte, error) {
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return nil, err
+	}
+	// known once the object is read, so it costs no request
+	info, err := object.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Metadata.Get("Content-Encoding") != schema.STORAGE_COMPRESSION_GZIP || len(b) == 0 {
+		return b, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0276 failed to decompress %s: %w", info.Key, err)
+	}
+	defer reader.Close()
+	b, err = io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0277 failed to decompress %s: %w", info.Key, err)
+	}
+	return b, nil
+}
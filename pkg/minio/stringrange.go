@@ -0,0 +1,117 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// for string indices, selects the entities whose value is at least from, and before to, i.e. `from <= value < to`, in the order
+// of the collation of the index, e.g. of its locale, so that e.g. `WhereIndexedFieldInStringRange("Name", "a", "b")` finds the
+// names starting with an a, and in swedish, `Ö` is after `Z`, see schema.IndexCollation. only the index entries in the range are
+// listed, and the results are in the order of the index. either bound may be empty, for ranges which are unbounded on that side.
+func (w WhereContainer[T]) WhereIndexedFieldInStringRange(fieldName string, from string, to string) FindByIndexedFieldInStringRangeContainer[T] {
+	return FindByIndexedFieldInStringRangeContainer[T]{w.ctx, w.repo, w.table, fieldName, from, to, w.tx, w.whenIndexUnavailable}
+}
+
+type FindByIndexedFieldInStringRangeContainer[T any] struct {
+	ctx                  context.Context
+	repo                 *MinioRepository
+	table                schema.Table
+	fieldName            string
+	from                 string
+	to                   string
+	tx                   *schema.Transaction
+	whenIndexUnavailable IndexUnavailablePolicy
+}
+
+// sql: select * from table_name where column1 >= value1 and column1 < value2 order by column1 (column1 is in a string index)
+// Param: destination - the address of a slice of T, where the results will be stored, in the order of the index
+// Returns: a map of entity ids to ETags, and an error if any occurred
+func (f FindByIndexedFieldInStringRangeContainer[T]) Find(destination *[]*T) (*map[string]*string, error) {
+	key := fmt.Sprintf("stringrange|%s|%q|%q", f.fieldName, f.from, f.to)
+	return cachedFind(f.ctx, f.repo, f.tx, f.table, key, destination, func() (*map[string]*string, error) {
+		return f.find(destination)
+	})
+}
+
+func (f FindByIndexedFieldInStringRangeContainer[T]) find(destination *[]*T) (*map[string]*string, error) {
+	index, err := f.repo.resolveIndex(f.ctx, f.table, f.fieldName)
+	if err != nil {
+		return nil, err
+	}
+	if index.Numeric || index.Time || index.Decimal || index.Table.EnumField(index.Field) != nil {
+		return nil, fmt.Errorf("ADB-0150 the index %s cannot be queried by a range of strings, since its values are encoded", f.fieldName)
+	}
+	from, to := index.SortKey(f.from), index.SortKey(f.to)
+	inRange := func(value string) bool {
+		key := index.SortKey(value)
+		return (f.from == "" || key >= from) && (f.to == "" || key < to)
+	}
+
+	lookup := func(coordinates *[]schema.DatabaseTableIdTuple) error {
+		// the entries of a value are in the folder named after it, so the range starts after the folder of the lower bound, and
+		// ends at the folder of the upper bound
+		startAfter := index.PathPrefix() + "/"
+		if f.from != "" {
+			startAfter = index.PathNoId(f.from)
+		}
+		end := ""
+		if f.to != "" {
+			end = index.PathNoId(f.to)
+		}
+		paths, err := f.repo.selectPathsFromTableWhereIndexEntryBetween(f.ctx, f.tx, index.PathPrefix()+"/", startAfter, end, nil)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths.Items() {
+			if strings.HasPrefix(path, index.NullPathNoId()+"/") || strings.HasPrefix(path, index.LegacyNullPathNoId()+"/") {
+				// null is in no range
+				continue
+			}
+			databaseTableIdTuple, err := index.EntryFromPath(path)
+			if err != nil {
+				return err
+			}
+			*coordinates = append(*coordinates, *databaseTableIdTuple)
+		}
+		return nil
+	}
+
+	predicate := func(t *T) (bool, error) {
+		values, err := getIndexValues(index, t)
+		if err != nil {
+			return false, err
+		}
+		return slices.ContainsFunc(values, inRange), nil
+	}
+	etags, err := findUsingIndex(f.ctx, f.repo, f.tx, f.table, index, f.whenIndexUnavailable, predicate, lookup, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	// entities with several values are ordered by the first of them in the range
+	sortKeys := make(map[*T]string, len(*destination))
+	for _, t := range *destination {
+		values, err := getIndexValues(index, t)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(values))
+		for _, value := range values {
+			if inRange(value) {
+				keys = append(keys, index.SortKey(value))
+			}
+		}
+		if len(keys) > 0 {
+			sortKeys[t] = slices.Min(keys)
+		}
+	}
+	slices.SortStableFunc(*destination, func(a, b *T) int {
+		return strings.Compare(sortKeys[a], sortKeys[b])
+	})
+	return etags, nil
+}
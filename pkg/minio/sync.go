@@ -0,0 +1,113 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the number of change sets that a pull returns at most, unless it asks for fewer
+const SYNC_PULL_MAX = 100
+
+// the changes that a replica pulls, e.g. an edge device holding part of a table
+type SyncPull struct {
+	// the net changes to the objects, in commit order, i.e. later changes to an object replace earlier ones
+	Changes []Change `json:"changes"`
+	// the token to pull the changes that follow these since, which the replica stores along with them
+	Since string `json:"since"`
+	// true if there may be more changes already, so that the replica pulls again straight away
+	More bool `json:"more"`
+}
+
+// returns the changes to the table which were committed since the token, so that a replica can hold a copy of the table, or of
+// the part of it which the filter selects, and keep it up to date over a connection that is only sometimes available, without
+// the store holding any state for it. an empty token pulls the snapshot of the table, which blocks until the change log around
+// it settles, see ChangeConsumer.Bootstrap, and returns the token that the changes following it are pulled since. replicas hold
+// the whole of their part of the table, so the snapshot is not paged. otherwise up to max change sets are read, which may
+// contain fewer changes, since the filter applies. the change log must be enabled, see EnableChangeLog, and the tables of the
+// filter are replaced by the table. like the filter of a consumer, it does not tell the replica about objects which stop matching
+// it, which it finds out about when it next pulls the snapshot. fails with an InvalidSyncTokenError if the token was not returned
+// by a pull.
+func (r *MinioRepository) PullChanges(ctx context.Context, table schema.Table, since string, max int, filter ChangeFilter) (*SyncPull, error) {
+	filter.Tables = []schema.Table{table}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	if max <= 0 || max > SYNC_PULL_MAX {
+		max = SYNC_PULL_MAX
+	}
+	pull := &SyncPull{Changes: make([]Change, 0)}
+	if since == "" {
+		position, err := r.bootstrap(ctx, table, &filter, "replica of "+table.Name, func(ctx context.Context, changeSet ChangeSet) error {
+			pull.Changes = append(pull.Changes, changeSet.Changes...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		pull.Since = position
+		return pull, nil
+	}
+	if !strings.HasPrefix(since, CHANGE_LOG_ROOT) {
+		return nil, &InvalidSyncTokenErrorWithDetails{Details: fmt.Sprintf("ADB-0156 %q is not a token returned by a pull", since), Token: since}
+	}
+
+	changeSets, err := r.readChangeLog(ctx, since, max)
+	if err != nil {
+		return nil, err
+	}
+	for _, changeSet := range changeSets {
+		pull.Changes = append(pull.Changes, filter.apply(changeSet).Changes...)
+	}
+	pull.Since = since
+	if len(changeSets) > 0 {
+		pull.Since = changeSets[len(changeSets)-1].Offset
+	}
+	pull.More = len(changeSets) == max
+	return pull, nil
+}
+
+// a change that a replica made to an object, which it pushes once it is connected
+type SyncPush struct {
+	ClientChangeSet
+	// if set, the object is deleted, provided that it is still the version with the base ETag, and the changes are ignored
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// applies the change that a replica pushes within the transaction. objects that the replica created, i.e. which have no base
+// ETag, are inserted, with the changes as their fields, which must include the id. objects that it changed are merged with the
+// current version, see ApplyClientChangeSet, whose conflicts are returned, and objects that it deleted are deleted, unless they
+// were changed since, in which case it fails with a StaleObjectError. pushing a change again, e.g. because the response was lost,
+// fails with a DuplicateKeyError for an insert, and has no effect for an update, unless someone else changed the fields since.
+// Returns: the ETag of the object, which is nil if it was deleted, and the conflicts
+func PushChange[T any](ctx context.Context, repo *MinioRepository, tx *schema.Transaction, table schema.Table, push SyncPush) (*string, []FieldConflict, error) {
+	if push.Deleted {
+		entity := new(T)
+		if _, err := NewTypedQuery[T](repo, ctx, tx).SelectFromTable(table).WhereIdEquals(push.Id).Find(entity); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, repo.DeleteFromTable(ctx, tx, table, entity, &push.BaseETag)
+	}
+	if push.BaseETag == "" {
+		data, err := json.Marshal(push.Changes)
+		if err != nil {
+			return nil, nil, err
+		}
+		entity := new(T)
+		if err := json.Unmarshal(data, entity); err != nil {
+			return nil, nil, fmt.Errorf("ADB-0156 the object %s that was pushed does not fit the table: %w", push.Id, err)
+		}
+		if id, err := entityId(table, entity); err != nil {
+			return nil, nil, err
+		} else if id != push.Id {
+			return nil, nil, fmt.Errorf("ADB-0156 the object %s that was pushed has the id %s", push.Id, id)
+		}
+		etag, err := repo.InsertIntoTable(ctx, tx, table, entity)
+		return etag, nil, err
+	}
+	_, etag, conflicts, err := ApplyClientChangeSet[T](ctx, repo, tx, table, push.ClientChangeSet)
+	return etag, conflicts, err
+}
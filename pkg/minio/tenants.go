@@ -0,0 +1,74 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// returns the tenants which have objects in the bucket, other than the default one, in the order of their prefixes
+func (r *MinioRepository) ListTenants(ctx context.Context) ([]schema.Tenant, error) {
+	tenants := make([]schema.Tenant, 0, 10)
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: schema.TENANTS_ROOT}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("ADB-0251 failed to list the tenants: %w", object.Err)
+		}
+		if tenant, _ := schema.TenantFromPath(object.Key); tenant != schema.DEFAULT_TENANT {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants, nil
+}
+
+// returns the default tenant, followed by those which have objects in the bucket
+func (r *MinioRepository) allTenants(ctx context.Context) ([]schema.Tenant, error) {
+	tenants, err := r.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]schema.Tenant{schema.DEFAULT_TENANT}, tenants...), nil
+}
+
+// returns the folders containing the transactions of all tenants, see schema.Transaction.GetRootPath
+func (r *MinioRepository) transactionRoots(ctx context.Context) ([]string, error) {
+	tenants, err := r.allTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]string, len(tenants))
+	for i, tenant := range tenants {
+		roots[i] = tenant.Prefix() + schema.TRANSACTIONS_ROOT
+	}
+	return roots, nil
+}
+
+// removes all versions of all objects of the tenant, i.e. the objects of its tables, the entries of their indices, and its
+// transactions, e.g. once a customer has left. the tables remain registered, since they are registered once for all tenants.
+// entries of the change log and journal, which are shared by all tenants, are not removed, while the messages of its outbox are.
+// fails with ADB-0252 if the tenant is the default one, whose objects are not below a prefix, or ADB-0253 if transactions of the
+// tenant are in progress, since they would write objects again once they commit or roll back. a removal which failed part way is continued by running it again.
+// Returns: the number of object versions that were removed
+func (r *MinioRepository) DeleteTenant(ctx context.Context, tenant schema.Tenant) (int, error) {
+	if tenant == schema.DEFAULT_TENANT {
+		return 0, fmt.Errorf("ADB-0252 the default tenant cannot be deleted")
+	}
+	var transactions []schema.Transaction
+	if err := r.getTransactionsInProgressOfTenant(ctx, tenant, &transactions); err != nil {
+		return 0, err
+	}
+	if len(transactions) > 0 {
+		return 0, fmt.Errorf("ADB-0253 tenant %s cannot be deleted, since %d of its transactions are in progress, e.g. %s", tenant, len(transactions), transactions[0].Id)
+	}
+	return r.removeAllVersionsInBatches(ctx, tenant.Prefix(), DROP_TABLE_BATCH_SIZE)
+}
+
+// fails if the transaction belongs to a tenant other than that of the table, since the transactions of a tenant are only
+// considered when reading the objects of its tables, see getOtherTransactionsInProgress
+func checkTenant(tx *schema.Transaction, table schema.Table) error {
+	if tx.Tenant != table.Tenant {
+		return fmt.Errorf("ADB-0170 transaction %s of tenant %q may not write to table %s/%s of tenant %q", tx.Id, tx.Tenant, table.Database, table.Name, table.Tenant)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// deletes the entities of the table which have expired according to the TTL index of the field, each in its own transaction,
+// which also removes their index entries. entities which are updated concurrently, e.g. a session that is used again, are
+// skipped, since the update may have extended their life; they are deleted by a later sweep if they have still expired.
+// Returns: the number of entities that were deleted
+func SweepExpired[T any](ctx context.Context, repo *MinioRepository, table schema.Table, field string) (int, error) {
+	index, err := table.GetIndex(field)
+	if err != nil {
+		return 0, err
+	}
+	if !index.Time {
+		return 0, fmt.Errorf("ADB-0130 the entities of %s/%s cannot expire by %s, since it is not a time index", table.Database, table.Name, field)
+	}
+	snapshot := schema.NewReadOnlyTransaction(schema.MaxTimeout())
+	expired := make([]*T, 0)
+	etags, err := NewTypedQuery[T](repo, ctx, &snapshot).
+		SelectFromTable(table).
+		WhereIndexedFieldInTimeRange(field, time.Time{}, index.ExpiredBefore(schema.Now())).
+		Find(&expired)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	errs := make([]error, 0)
+	for _, entity := range expired {
+		id, err := entityId(table, entity)
+		if err != nil {
+			return count, err
+		}
+		etag := (*etags)[id]
+		if etag == nil {
+			continue
+		}
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			return count, err
+		}
+		if err := repo.DeleteFromTable(ctx, &tx, table, entity, etag); err != nil {
+			repo.Rollback(ctx, &tx)
+			if !errors.Is(err, StaleObjectError) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if commitErrs := repo.Commit(ctx, &tx); len(commitErrs) > 0 {
+			errs = append(errs, commitErrs...)
+			continue
+		}
+		count++
+	}
+	if len(errs) > 0 {
+		return count, fmt.Errorf("ADB-0131 sweep of expired entities of %s/%s had %d errors, the last being: %w. Run it again.", table.Database, table.Name, len(errs), errs[len(errs)-1])
+	}
+	return count, nil
+}
+
+// runs SweepExpired at the given interval until the context is done. errors are passed to the callback given to Setup.
+func StartSweepingExpired[T any](ctx context.Context, repo *MinioRepository, table schema.Table, field string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := SweepExpired[T](ctx, repo, table, field); err != nil && ctx.Err() == nil && theCallback != nil {
+				theCallback.ErrorDuringGc(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,75 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// what is known about a persisted transaction from the metadata of its record, without downloading it
+type TransactionSummary struct {
+	Id                string
+	Path              string
+	StartMicroseconds uint64
+	StepCount         int
+	// the bytes written by its steps so far, plus the size of the record itself
+	ApproximateSize int64
+}
+
+// returns summaries of the transactions of all tenants that are persisted and not yet committed or rolled back, largest first, so
+// that cleanup of large transactions which are stuck can be prioritised. transactions persisted by older versions have no
+// telemetry, so their step count and size are zero.
+func (r *MinioRepository) GetTransactionSummaries(ctx context.Context) ([]TransactionSummary, error) {
+	tenants, err := r.allTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]TransactionSummary, 0, 10)
+	for _, tenant := range tenants {
+		tx := schema.NewTransaction(0)
+		tx.Tenant = tenant
+		for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+			Prefix:       tx.GetRootPath(),
+			Recursive:    true,
+			WithMetadata: true,
+		}) {
+			if object.Err != nil {
+				return nil, object.Err
+			}
+			if strings.HasPrefix(object.Key, tx.GetArchiveRootPath()) || !strings.HasSuffix(object.Key, "/"+TX_FILENAME) {
+				// committed transactions, or other objects stored along with the transaction
+				continue
+			}
+			path := strings.TrimSuffix(object.Key, "/"+TX_FILENAME)
+			id, startMicros := tx.GetIdAndTimeoutMicrosFromPath(path)
+			summary := TransactionSummary{Id: id, Path: path, StartMicroseconds: startMicros}
+			var err error
+			if value, ok := object.UserMetadata[MINIO_META_PREFIX+schema.STEP_COUNT]; ok {
+				if summary.StepCount, err = strconv.Atoi(value); err != nil {
+					return nil, fmt.Errorf("ADB-0108 invalid step count %s on transaction %s: %w", value, path, err)
+				}
+			}
+			if value, ok := object.UserMetadata[MINIO_META_PREFIX+schema.APPROXIMATE_SIZE]; ok {
+				if summary.ApproximateSize, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return nil, fmt.Errorf("ADB-0108 invalid approximate size %s on transaction %s: %w", value, path, err)
+				}
+			}
+			summaries = append(summaries, summary)
+		}
+	}
+	slices.SortStableFunc(summaries, func(a, b TransactionSummary) int {
+		if a.ApproximateSize != b.ApproximateSize {
+			if a.ApproximateSize > b.ApproximateSize {
+				return -1
+			}
+			return 1
+		}
+		return b.StepCount - a.StepCount
+	})
+	return summaries, nil
+}
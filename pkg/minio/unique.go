@@ -0,0 +1,79 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// returns the paths of the claims on the values of the unique indices of the entity, having checked that no other entity is
+// indexed with any of them. the caller writes the claims with if-none-match semantics, which fail if a different transaction
+// claims a value at the same time. a value which the transaction itself releases, by updating or deleting a different entity,
+// can only be claimed once it has committed.
+func (r *MinioRepository) getUniqueClaims(ctx context.Context, table schema.Table, entity any, id string) ([]string, error) {
+	claims := make([]string, 0)
+	for _, index := range table.Indices {
+		if !index.Unique {
+			continue
+		}
+		if indexed, err := isIndexed(&index, entity); err != nil {
+			return nil, err
+		} else if !indexed {
+			// unique partial indices only constrain the entities that they contain
+			continue
+		}
+		// entities without a value are not constrained
+		values, err := getIndexValues(&index, entity)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			claim := index.UniquePath(value)
+			if slices.Contains(claims, claim) {
+				// values of the entity which are collated alike
+				continue
+			}
+			if err := r.checkUniqueValue(ctx, &index, value, id); err != nil {
+				return nil, err
+			}
+			claims = append(claims, claim)
+		}
+	}
+	return claims, nil
+}
+
+// checks the index entries of the value, which also covers entities that were written before the index was unique, and so have
+// no claim. entities which are being written by transactions in progress count as having the value.
+func (r *MinioRepository) checkUniqueValue(ctx context.Context, index *schema.Index, value string, id string) error {
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+		Prefix:       index.PathNoId(value) + "/",
+		WithMetadata: true,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if object.UserMetadata[MINIO_META_PREFIX+TOMBSTONE_AND_EXISTS_UNTIL] != "" {
+			// removed by an update or delete, which has been committed
+			continue
+		}
+		coordinates, err := index.EntryFromPath(object.Key)
+		if err != nil {
+			return err
+		}
+		if coordinates.Id == id {
+			continue
+		}
+		// the index entries of deleted entities are left in place
+		info, exists, err := r.statObject(ctx, index.Table.Path(coordinates.Id))
+		if err != nil {
+			return err
+		}
+		if exists && info.Size > 0 {
+			return &UniqueViolationErrorWithDetails{Details: fmt.Sprintf("the value %s of the unique index %s already belongs to %s", value, index.Field, coordinates.Id), Path: object.Key}
+		}
+	}
+	return nil
+}
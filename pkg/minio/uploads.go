@@ -0,0 +1,348 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// the folder containing the upload sessions which are in progress
+const UPLOADS_ROOT = "uploads/"
+
+// the smallest chunk that can be uploaded, except the last one, since each chunk is a part of a multipart upload
+const UPLOAD_MIN_CHUNK_SIZE = 5 * 1024 * 1024
+
+// how long an upload session lives after it was last written, until SweepExpiredUploads removes it
+const UPLOAD_EXPIRY = 24 * time.Hour
+
+// the name of the compensator which removes an attachment, if the transaction that it was attached in is rolled back
+const ATTACHMENT_COMPENSATOR = "abstrastore-remove-attachment"
+
+func init() {
+	RegisterCompensator(ATTACHMENT_COMPENSATOR, func(ctx context.Context, repo *MinioRepository, tx *schema.Transaction, args json.RawMessage) error {
+		var session UploadSession
+		if err := json.Unmarshal(args, &session); err != nil {
+			return err
+		}
+		return repo.removeAttachment(ctx, &session)
+	})
+}
+
+// a resumable upload of a large object, e.g. a file that an entity refers to, which is stored as a multipart upload, so that a
+// client with a flaky connection can continue sending it where it left off, rather than starting again. once complete, it is
+// attached to the entity within a transaction, and only exists if the transaction commits. see CreateUpload
+type UploadSession struct {
+	Id       string `json:"id"`
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// where the object is stored, once it is attached
+	Path     string `json:"path"`
+	UploadId string `json:"uploadId"`
+	// the size of the whole object, and how much of it has been uploaded, in bytes
+	Length      int64        `json:"length"`
+	Offset      int64        `json:"offset"`
+	ContentType string       `json:"contentType,omitempty"`
+	Parts       []UploadPart `json:"parts"`
+	// after which the session is removed, unless more is uploaded
+	ExpiresMicros int64 `json:"expiresMicros"`
+
+	ETag string `json:"-"`
+}
+
+// a chunk of an upload, i.e. a part of its multipart upload
+type UploadPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// an object that was uploaded and attached to an entity, which the entity should contain, in order to refer to it
+type Attachment struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+func uploadSessionPath(id string) string {
+	return UPLOADS_ROOT + id + ".json"
+}
+
+// starts a session for uploading an object of the given length, which will be an attachment of an entity of the table. the
+// object is uploaded in chunks using UploadChunk, and attached to the entity using AttachUpload.
+func (r *MinioRepository) CreateUpload(ctx context.Context, table schema.Table, length int64, contentType string) (*UploadSession, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("ADB-0137 invalid upload length %d", length)
+	}
+	id := uuid.New().String()
+	session := &UploadSession{
+		Id:            id,
+		Database:      string(table.Database),
+		Table:         table.Name,
+		Path:          table.AttachmentPath(id),
+		Length:        length,
+		ContentType:   contentType,
+		Parts:         []UploadPart{},
+		ExpiresMicros: schema.Now().Add(UPLOAD_EXPIRY).UnixMicro(),
+	}
+	if length > 0 {
+		uploadId, err := minio.Core{Client: r.Client}.NewMultipartUpload(ctx, r.BucketName, session.Path, minio.PutObjectOptions{ContentType: contentType})
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0189 failed to start upload %s: %w", session.Path, err)
+		}
+		session.UploadId = uploadId
+	}
+	if err := r.writeUploadSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// returns the upload session, or a NoSuchKeyError if it does not exist, e.g. because it was attached, aborted or has expired
+func (r *MinioRepository) GetUpload(ctx context.Context, id string) (*UploadSession, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("ADB-0190 no such upload %s", id)}
+	}
+	object, err := r.Client.GetObject(ctx, r.BucketName, uploadSessionPath(id), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0191 failed to get upload %s: %w", id, err)
+	}
+	defer object.Close()
+	info, err := object.Stat()
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("ADB-0192 no such upload %s", id)}
+		}
+		return nil, fmt.Errorf("ADB-0193 failed to get upload %s: %w", id, err)
+	}
+	b, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0194 failed to get upload %s: %w", id, err)
+	}
+	var session UploadSession
+	if err := json.Unmarshal(b, &session); err != nil {
+		return nil, err
+	}
+	if schema.Now().UnixMicro() > session.ExpiresMicros {
+		return nil, &NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("ADB-0195 upload %s has expired", id)}
+	}
+	session.ETag = info.ETag
+	return &session, nil
+}
+
+// uploads the next chunk of the object, which must start at the offset that the upload has reached, otherwise it fails with an
+// UploadOffsetMismatchError, containing the offset to continue from. a chunk which fails part way through is discarded, and
+// has to be sent again. chunks must be at least UPLOAD_MIN_CHUNK_SIZE, except the last one.
+func (r *MinioRepository) UploadChunk(ctx context.Context, id string, offset int64, data io.Reader, size int64) (*UploadSession, error) {
+	session, err := r.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != session.Offset {
+		return nil, &UploadOffsetMismatchErrorWithDetails{
+			Details: fmt.Sprintf("ADB-0196 upload %s is at offset %d, not %d", id, session.Offset, offset),
+			Offset:  session.Offset,
+		}
+	}
+	if size < 0 || offset+size > session.Length {
+		return nil, fmt.Errorf("ADB-0197 a chunk of %d bytes at offset %d exceeds the length %d of upload %s", size, offset, session.Length, id)
+	}
+	if size < UPLOAD_MIN_CHUNK_SIZE && offset+size < session.Length {
+		return nil, fmt.Errorf("ADB-0198 the chunk of %d bytes is smaller than %d bytes, but not the last one of upload %s", size, UPLOAD_MIN_CHUNK_SIZE, id)
+	}
+	if size == 0 {
+		return session, nil
+	}
+	number := len(session.Parts) + 1
+	part, err := minio.Core{Client: r.Client}.PutObjectPart(ctx, r.BucketName, session.Path, session.UploadId, number, data, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0199 failed to upload chunk %d of upload %s: %w", number, id, err)
+	}
+	session.Parts = append(session.Parts, UploadPart{Number: number, ETag: part.ETag, Size: size})
+	session.Offset += size
+	session.ExpiresMicros = schema.Now().Add(UPLOAD_EXPIRY).UnixMicro()
+	if err := r.writeUploadSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// discards the upload and what has been uploaded so far
+func (r *MinioRepository) AbortUpload(ctx context.Context, id string) error {
+	session, err := r.GetUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.abortUpload(ctx, session)
+}
+
+// attaches the completely uploaded object to the transaction, so that the object exists if and only if the transaction commits.
+// the transaction must also write the entity which refers to the returned attachment, e.g. by inserting it, since the object is
+// not referred to otherwise. the upload session is removed once the transaction commits, and kept if it is rolled back before
+// the object was assembled, so that it can be attached again.
+func (r *MinioRepository) AttachUpload(ctx context.Context, tx *schema.Transaction, id string) (*Attachment, error) {
+	session, err := r.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Offset != session.Length {
+		return nil, fmt.Errorf("ADB-0200 upload %s cannot be attached, since only %d of %d bytes have been uploaded", id, session.Offset, session.Length)
+	}
+	if err := tx.Compensate(ATTACHMENT_COMPENSATOR, session); err != nil {
+		return nil, err
+	}
+	if err := tx.Enlist(&uploadParticipant{repo: r, session: session}); err != nil {
+		return nil, err
+	}
+	// so that the object is removed if the transaction is recovered by a different process
+	if err := r.updateTransaction(ctx, tx); err != nil {
+		return nil, err
+	}
+	return &Attachment{Path: session.Path, Size: session.Length, ContentType: session.ContentType}, nil
+}
+
+// aborts the upload sessions which have expired, so that the chunks of clients which never finished are not kept.
+// objects which were attached are unaffected.
+// Returns: the number of sessions which were removed
+func (r *MinioRepository) SweepExpiredUploads(ctx context.Context) (int, error) {
+	count := 0
+	var errs []error
+	for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{Prefix: UPLOADS_ROOT}) {
+		if object.Err != nil {
+			return count, object.Err
+		}
+		data, err := r.Client.GetObject(ctx, r.BucketName, object.Key, minio.GetObjectOptions{})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b, err := io.ReadAll(data)
+		data.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var session UploadSession
+		if err := json.Unmarshal(b, &session); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if schema.Now().UnixMicro() <= session.ExpiresMicros {
+			continue
+		}
+		if err := r.abortUpload(ctx, &session); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		count++
+	}
+	if len(errs) > 0 {
+		return count, fmt.Errorf("ADB-0201 failed to sweep %d expired uploads: %w", len(errs), errors.Join(errs...))
+	}
+	return count, nil
+}
+
+func (r *MinioRepository) writeUploadSession(ctx context.Context, session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{ContentType: "application/json"}
+	if session.ETag == "" {
+		opts.SetMatchETagExcept("*")
+	} else {
+		opts.SetMatchETag(session.ETag)
+	}
+	info, err := r.Client.PutObject(ctx, r.BucketName, uploadSessionPath(session.Id), bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+			return &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("ADB-0202 upload %s was modified concurrently", session.Id)}
+		}
+		return fmt.Errorf("ADB-0203 failed to put upload %s: %w", session.Id, err)
+	}
+	session.ETag = info.ETag
+	return nil
+}
+
+func (r *MinioRepository) abortUpload(ctx context.Context, session *UploadSession) error {
+	if session.UploadId != "" {
+		err := minio.Core{Client: r.Client}.AbortMultipartUpload(ctx, r.BucketName, session.Path, session.UploadId)
+		// e.g. because it was completed by a transaction which was then recovered
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchUpload" {
+			return fmt.Errorf("ADB-0204 failed to abort upload %s: %w", session.Id, err)
+		}
+	}
+	if err := r.Client.RemoveObject(ctx, r.BucketName, uploadSessionPath(session.Id), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("ADB-0205 failed to remove upload %s: %w", session.Id, err)
+	}
+	return nil
+}
+
+// removes the attachment, and its session, if the object was assembled, since the session can then no longer be attached
+func (r *MinioRepository) removeAttachment(ctx context.Context, session *UploadSession) error {
+	if _, err := r.Client.StatObject(ctx, r.BucketName, session.Path, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("ADB-0206 failed to stat attachment %s: %w", session.Path, err)
+	}
+	if err := r.Client.RemoveObject(ctx, r.BucketName, session.Path, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("ADB-0207 failed to remove attachment %s: %w", session.Path, err)
+	}
+	if err := r.Client.RemoveObject(ctx, r.BucketName, uploadSessionPath(session.Id), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("ADB-0208 failed to remove upload %s: %w", session.Id, err)
+	}
+	return nil
+}
+
+// assembles the object when the transaction that it is attached to is prepared, so that the transaction only commits if the
+// object exists. if the transaction is rolled back, the object is removed by its compensation.
+type uploadParticipant struct {
+	repo    *MinioRepository
+	session *UploadSession
+}
+
+func (p *uploadParticipant) Prepare(ctx context.Context, tx *schema.Transaction) error {
+	session := p.session
+	if session.UploadId == "" {
+		_, err := p.repo.Client.PutObject(ctx, p.repo.BucketName, session.Path, bytes.NewReader([]byte{}), 0, minio.PutObjectOptions{ContentType: session.ContentType})
+		if err != nil {
+			return fmt.Errorf("ADB-0209 failed to put attachment %s: %w", session.Path, err)
+		}
+		return nil
+	}
+	parts := make([]minio.CompletePart, len(session.Parts))
+	for i, part := range session.Parts {
+		parts[i] = minio.CompletePart{PartNumber: part.Number, ETag: part.ETag}
+	}
+	_, err := minio.Core{Client: p.repo.Client}.CompleteMultipartUpload(ctx, p.repo.BucketName, session.Path, session.UploadId, parts, minio.PutObjectOptions{ContentType: session.ContentType})
+	if err != nil {
+		// it may have been completed by an earlier attempt to commit, which failed afterwards
+		if info, statErr := p.repo.Client.StatObject(ctx, p.repo.BucketName, session.Path, minio.StatObjectOptions{}); statErr == nil && info.Size == session.Length {
+			return nil
+		}
+		return fmt.Errorf("ADB-0210 failed to assemble attachment %s: %w", session.Path, err)
+	}
+	return nil
+}
+
+func (p *uploadParticipant) Commit(ctx context.Context, tx *schema.Transaction) error {
+	// the entity now refers to the object, so the session is no longer needed
+	if err := p.repo.Client.RemoveObject(ctx, p.repo.BucketName, uploadSessionPath(p.session.Id), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("ADB-0211 failed to remove upload %s: %w", p.session.Id, err)
+	}
+	return nil
+}
+
+func (p *uploadParticipant) Rollback(ctx context.Context, tx *schema.Transaction) error {
+	// see removeAttachment, which the compensation executes
+	return nil
+}
@@ -0,0 +1,124 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// Performs the ETag precondition checks of the transaction using HEAD requests, without writing anything.
+// Objects that the transaction has read are checked to ensure that no other transaction has since written a newer version,
+// and steps that have not yet been executed are checked against their initial ETag.
+// That way, batch jobs can detect conflicts and stale assumptions before doing expensive work.
+// Returns all conflicts that were found, as StaleObjectErrors, DuplicateKeyErrors or ObjectLockedErrors.
+func (r *MinioRepository) Validate(ctx context.Context, transaction *schema.Transaction) []error {
+	if err := transaction.IsOk(); err != nil {
+		return []error{err} // do not wrap with fmt.Errorf...
+	}
+
+	transactionsInProgress, err := r.getOtherTransactionsInProgress(ctx, transaction)
+	if err != nil {
+		return []error{err}
+	}
+	return r.validateAgainst(ctx, transaction, transactionsInProgress)
+}
+
+// Param: transactionsInProgress - the ids and timeouts of the other transactions that are in progress
+func (r *MinioRepository) validateAgainst(ctx context.Context, transaction *schema.Transaction, transactionsInProgress map[string]uint64) []error {
+	errs := make([]error, 0, 10)
+
+	// //////////////////////////////////////////////////
+	// objects read or written by this transaction
+	// //////////////////////////////////////////////////
+	validateETag := func(path string, etag string, object *any) {
+		info, exists, err := r.statObject(ctx, path)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !exists {
+			errs = append(errs, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("object %s no longer exists. Reload and try again.", path), Object: object})
+			return
+		}
+		if info.ETag == etag {
+			return
+		}
+		objectTxId := info.UserMetadata[schema.TX_ID]
+		if objectTxId == transaction.Id {
+			// a newer version written by this transaction
+			return
+		}
+		if timeoutMicros, ok := transactionsInProgress[objectTxId]; ok {
+			errs = append(errs, &ObjectLockedErrorWithDetails[any]{Details: fmt.Sprintf("Object %s has already been written by transaction %s, which is set to expire by %d. Reload and try again.", path, objectTxId, timeoutMicros), Object: object, DueByMsEpoch: timeoutMicros, TransactionId: objectTxId})
+		} else {
+			errs = append(errs, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("object %s is stale. Reload and try again.", path), Object: object})
+		}
+	}
+	for path, cached := range transaction.Cache {
+		if cached == nil || cached.ETag == nil {
+			// deleted within this transaction, so there is nothing to compare
+			continue
+		}
+		validateETag(path, *cached.ETag, cached.Object)
+	}
+	// spilled from the cache, rather than evicted, so that they are checked too, without restoring them
+	for path, etag := range transaction.SpilledETags() {
+		if _, cached := transaction.Cache[path]; !cached {
+			validateETag(path, etag, nil)
+		}
+	}
+
+	// //////////////////////////////////////////////////
+	// steps which have not yet been executed
+	// //////////////////////////////////////////////////
+	for _, step := range transaction.Steps {
+		if step.Executed || step.InitialETag == "" {
+			// either already checked by minio when it was written, or the caller wants to overwrite in all cases
+			continue
+		}
+		if step.Type == schema.STEP_UPDATE_REMOVE_INDEX || step.Type == schema.STEP_DELETE_REMOVE_INDEX {
+			// nothing is written until commit
+			continue
+		}
+
+		info, exists, err := r.statObject(ctx, step.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if step.InitialETag == "*" { // "must not exist", i.e. insert
+			if !exists || info.Size == 0 {
+				// missing, or a tombstone which the insert may overwrite
+				continue
+			}
+			objectTxId := info.UserMetadata[schema.TX_ID]
+			if timeoutMicros, ok := transactionsInProgress[objectTxId]; ok {
+				errs = append(errs, &ObjectLockedErrorWithDetails[any]{Details: fmt.Sprintf("Object %s has already been written by transaction %s, which is set to expire by %d. Reload and try again.", step.Path, objectTxId, timeoutMicros), Object: step.Entity, DueByMsEpoch: timeoutMicros, TransactionId: objectTxId})
+			} else {
+				errs = append(errs, &DuplicateKeyErrorWithDetails{Details: fmt.Sprintf("object %s already exists", step.Path)})
+			}
+		} else if !exists || info.ETag != step.InitialETag { // must match, i.e. an update or delete
+			errs = append(errs, &StaleObjectErrorWithDetails[any]{Details: fmt.Sprintf("object %s is stale. Reload and try again. Note, a different transaction that is also in progress may be writing to this object.", step.Path), Object: step.Entity})
+		}
+	}
+
+	return errs
+}
+
+// HEADs the latest version of the object at the given path.
+// Returns the object info, whether the object exists, and an error if anything other than "not found" went wrong.
+func (r *MinioRepository) statObject(ctx context.Context, path string) (minio.ObjectInfo, bool, error) {
+	info, err := r.Client.StatObject(ctx, r.BucketName, path, minio.StatObjectOptions{})
+	if err != nil {
+		respErr := minio.ToErrorResponse(err)
+		if respErr.StatusCode == http.StatusNotFound {
+			return info, false, nil
+		}
+		return info, false, fmt.Errorf("ADB-0035 failed to stat object at path %s: %w", path, err)
+	}
+	return info, true, nil
+}
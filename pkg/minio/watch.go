@@ -0,0 +1,143 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/minio/minio-go/v7"
+)
+
+// states which are only ever emitted by WatchTransaction, once the transaction no longer exists
+const TX_STATE_COMMITTED = "Committed"
+const TX_STATE_ROLLED_BACK = "RolledBack"
+const TX_STATE_COMPLETED = "Completed" // committed or rolled back, but it is unknown which
+
+// emitted by WatchTransaction each time that the state of the transaction changes
+type TxEvent struct {
+	TransactionId string
+
+	// InProgress, Committing, RollingBack, or one of the final states Committed, RolledBack, Completed
+	State string
+
+	// the transaction as last read, or nil if it no longer exists
+	Transaction *schema.Transaction
+
+	// set if the transaction could not be read; the watch continues regardless
+	Err error
+}
+
+// polls the transaction with the given id, so that a caller that handed a transaction to another worker can await its
+// commit or rollback. an event is emitted each time that the state changes. once the transaction no longer exists, a final
+// event is emitted and the channel is closed. the channel is also closed when the context is done.
+// if the transaction disappears between polls without its final state having been seen, the final state is Committed if the
+// transaction is in the archive, or otherwise Completed.
+func (r *MinioRepository) WatchTransaction(ctx context.Context, id string, interval time.Duration) <-chan TxEvent {
+	events := make(chan TxEvent, 10)
+	go func() {
+		defer close(events)
+		// the consumer may stop reading once the context is done, so that nothing must be sent after that
+		send := func(event TxEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		lastState := ""
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			tx, err := r.readTransactionById(ctx, id)
+			if err != nil {
+				if ctx.Err() != nil || !send(TxEvent{TransactionId: id, Err: err}) {
+					return
+				}
+			} else if tx == nil {
+				send(TxEvent{TransactionId: id, State: r.finalState(ctx, id, lastState)})
+				return
+			} else if tx.State != lastState {
+				lastState = tx.State
+				if !send(TxEvent{TransactionId: id, State: tx.State, Transaction: tx}) {
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return events
+}
+
+func (r *MinioRepository) finalState(ctx context.Context, id string, lastState string) string {
+	if lastState == "Committing" {
+		return TX_STATE_COMMITTED
+	} else if lastState == "RollingBack" {
+		return TX_STATE_ROLLED_BACK
+	}
+	tenants, err := r.allTenants(ctx)
+	if err != nil {
+		return TX_STATE_COMPLETED
+	}
+	for _, tenant := range tenants {
+		tx := schema.Transaction{Tenant: tenant}
+		for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+			Prefix:    tx.GetArchiveRootPath(),
+			Recursive: false,
+		}) {
+			if object.Err == nil && strings.HasSuffix(object.Key, schema.TIMESTAMP_ID_SEPARATOR+id+".json") {
+				return TX_STATE_COMMITTED
+			}
+		}
+	}
+	return TX_STATE_COMPLETED
+}
+
+// reads the transaction with the given id, or returns nil if it is not in progress
+func (r *MinioRepository) readTransactionById(ctx context.Context, id string) (*schema.Transaction, error) {
+	roots, err := r.transactionRoots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		for object := range r.Client.ListObjects(ctx, r.BucketName, minio.ListObjectsOptions{
+			Prefix:    root,
+			Recursive: false,
+		}) {
+			if object.Err != nil {
+				return nil, object.Err
+			}
+			if !strings.HasSuffix(strings.TrimSuffix(object.Key, "/"), schema.TIMESTAMP_ID_SEPARATOR+id) {
+				continue
+			}
+			txData, err := r.Client.GetObject(ctx, r.BucketName, object.Key+TX_FILENAME, minio.GetObjectOptions{})
+			if err != nil {
+				return nil, err
+			}
+			defer txData.Close()
+			b, err := io.ReadAll(txData)
+			if err != nil {
+				respErr := minio.ToErrorResponse(err)
+				if respErr.Code == "NoSuchKey" {
+					// removed between listing and reading
+					return nil, nil
+				}
+				return nil, err
+			}
+			var transaction schema.Transaction
+			if err := json.Unmarshal(b, &transaction); err != nil {
+				return nil, err
+			}
+			return &transaction, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// the source of the time used for starting transactions, checking whether they have expired, and stamping the versions they write
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// guards the clock and the timeouts, which are read by every transaction, and may be configured while they are in progress
+var clockMu sync.RWMutex
+
+var clock Clock = systemClock{}
+
+// replaces the clock used by transactions, e.g. so that tests can simulate timeouts deterministically. nil restores the system clock.
+// it applies to all transactions in the process, so it should be set before any are started.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	clock = c
+}
+
+// the current time according to the clock used by transactions
+func Now() time.Time {
+	clockMu.RLock()
+	c := clock
+	clockMu.RUnlock()
+	return c.Now()
+}
+
+// a clock which only moves when it is told to
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var defaultTimeout = 30 * time.Second
+var maxTimeout = 10 * time.Minute
+
+// the timeout to use for transactions when the caller has no particular requirement, 30 seconds unless configured otherwise
+func DefaultTimeout() time.Duration {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return defaultTimeout
+}
+
+// the longest timeout that transactions may be started with, 10 minutes unless configured otherwise.
+// it also determines how long tombstones are kept, so that transactions which started before a delete can still read the object.
+func MaxTimeout() time.Duration {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return maxTimeout
+}
+
+// configures the default and maximum timeouts of transactions for the whole process.
+// the maximum should be the same in all processes using a bucket, since tombstones are kept for that long.
+func SetTimeouts(newDefault time.Duration, newMax time.Duration) error {
+	if newMax <= 0 {
+		return fmt.Errorf("ADB-0103 the maximum timeout %s must be positive", newMax)
+	}
+	if newDefault <= 0 || newDefault > newMax {
+		return fmt.Errorf("ADB-0186 the default timeout %s must be positive and no longer than the maximum timeout %s", newDefault, newMax)
+	}
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	defaultTimeout = newDefault
+	maxTimeout = newMax
+	return nil
+}
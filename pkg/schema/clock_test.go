@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock_ManualClockDrivesExpiryAndLastModified(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	SetClock(clock)
+	defer SetClock(nil)
+
+	tx := NewTransaction(10 * time.Second)
+	assert.Equal(start.UnixMicro(), tx.StartMicroseconds)
+	assert.False(tx.IsExpired())
+
+	var entity any = "a"
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "a", "*", &entity))
+	lastModified, err := strconv.ParseInt(tx.Steps[0].UserMetadata[LAST_MODIFIED], 10, 64)
+	assert.NoError(err)
+	assert.Equal(start.UnixMicro(), lastModified)
+
+	clock.Advance(11 * time.Second)
+	assert.True(tx.IsExpired())
+	assert.ErrorIs(tx.IsOk(), TransactionTimedOutError)
+}
+
+func TestClock_SetTimeouts(t *testing.T) {
+	assert := assert.New(t)
+	defer SetTimeouts(DefaultTimeout(), MaxTimeout())
+
+	assert.Error(SetTimeouts(time.Minute, 0))
+	assert.Error(SetTimeouts(0, time.Minute))
+	assert.Error(SetTimeouts(2*time.Minute, time.Minute))
+
+	assert.NoError(SetTimeouts(5*time.Second, time.Minute))
+	assert.Equal(5*time.Second, DefaultTimeout())
+	assert.Equal(time.Minute, MaxTimeout())
+}
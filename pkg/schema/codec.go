@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+)
+
+// how a table writes the values of types which JSON does not represent as Go does. the zero value writes them as encoding/json
+// does, i.e. times with nanoseconds and the offset of their zone. see WithCodec
+type TableCodec struct {
+	// times are truncated to this precision when they are written, e.g. time.Millisecond for data shared with clients which only
+	// keep milliseconds, or zero to keep nanoseconds
+	TimePrecision time.Duration `json:"timePrecision"`
+	// times are converted to this zone when they are written, e.g. "UTC", or empty to keep the zone of each time. JSON only keeps
+	// the offset of a zone, so times read back are only equal to those written if they are written in a fixed zone.
+	TimeZone string `json:"timeZone"`
+	// fields of stored entities which their type does not declare are kept when they are updated, see WithSoftSchema
+	PreserveUnknownFields bool `json:"preserveUnknownFields"`
+}
+
+// returns a copy of the table whose entities have their times normalised by the codec when they are written, so that they
+// round-trip exactly, and the entries of indices over them agree with what is stored. values queried from its time indices
+// are normalised alike. the entities that are written are changed too, so that callers hold what was stored.
+// panics if the codec is invalid, since tables are declared by code.
+func (t Table) WithCodec(codec TableCodec) Table {
+	if codec.TimePrecision < 0 {
+		panic(fmt.Sprintf("ADB-0148 invalid time precision %s of table %s", codec.TimePrecision, t.Name))
+	}
+	if _, err := time.LoadLocation(codec.TimeZone); err != nil {
+		panic(fmt.Sprintf("ADB-0346 invalid time zone %s of table %s: %s", codec.TimeZone, t.Name, err))
+	}
+	t.Codec = codec
+	indices := make([]Index, len(t.Indices))
+	for i, index := range t.Indices {
+		index.Table.Codec = codec
+		indices[i] = index
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns a copy of the table whose entities keep the fields which their type does not declare when they are updated, e.g. those
+// that a newer version of an application added, rather than losing them because an older version read the entity into a
+// struct without them and wrote it back, so that several versions of an application can share a table. only fields of the
+// entity itself are kept, not those of the structs nested in it, and only by MinioRepository.UpdateTable, including upserts,
+// since the version which an update replaces has to be read for them. inserts write the entity as it is. validators see the
+// fields which are kept.
+func (t Table) WithSoftSchema() Table {
+	codec := t.Codec
+	codec.PreserveUnknownFields = true
+	return t.WithCodec(codec)
+}
+
+// returns the time as the codec writes it. the zero time is left as it is, since it means that there is none
+func (c TableCodec) NormalizeTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	if c.TimePrecision > 0 {
+		t = t.Truncate(c.TimePrecision)
+	}
+	if c.TimeZone != "" {
+		// validated by WithCodec
+		if location, err := time.LoadLocation(c.TimeZone); err == nil {
+			t = t.In(location)
+		}
+	}
+	// without the monotonic reading, which is not written
+	return t.Round(0)
+}
@@ -0,0 +1,38 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableCodec_NormalizeTime(t *testing.T) {
+	assert := assert.New(t)
+	zurich, _ := time.LoadLocation("Europe/Zurich")
+	at := time.Date(2026, 3, 14, 15, 30, 0, 123456789, zurich)
+
+	assert.Equal(at, TableCodec{}.NormalizeTime(at))
+	normalized := TableCodec{TimePrecision: time.Millisecond, TimeZone: "UTC"}.NormalizeTime(at)
+	assert.Equal(time.Date(2026, 3, 14, 14, 30, 0, 123000000, time.UTC), normalized)
+	assert.Equal(time.UTC, normalized.Location())
+	assert.True(TableCodec{TimeZone: "UTC"}.NormalizeTime(time.Time{}).IsZero())
+}
+
+func TestTable_WithCodec(t *testing.T) {
+	assert := assert.New(t)
+	codec := TableCodec{TimePrecision: time.Microsecond, TimeZone: "UTC"}
+	table := NewTable("db", "event", []string{"At"}).WithCodec(codec)
+	assert.Equal(codec, table.Codec)
+	assert.Equal(codec, table.Indices[0].Table.Codec)
+
+	assert.Panics(func() { table.WithCodec(TableCodec{TimePrecision: -time.Second}) })
+	assert.Panics(func() { table.WithCodec(TableCodec{TimeZone: "Nowhere/Atlantis"}) })
+}
+
+func TestTable_WithSoftSchema(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "event", []string{"At"}).WithCodec(TableCodec{TimeZone: "UTC"}).WithSoftSchema()
+	assert.Equal(TableCodec{TimeZone: "UTC", PreserveUnknownFields: true}, table.Codec)
+	assert.True(table.Indices[0].Table.Codec.PreserveUnknownFields)
+}
@@ -0,0 +1,119 @@
+package schema
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// how the values of a string index are compared, i.e. which values are equal, and the order that their entries are listed in.
+// the zero value is how indices have always worked, see CASE_LOWERCASE_PATHS. see WithCollation
+type IndexCollation struct {
+	Case IndexCase `json:"case"`
+
+	// optional; the unicode normalization form that values are put into before they are compared, i.e. NFC, NFD, NFKC or NFKD, so
+	// that e.g. a precomposed `é` equals an `e` followed by a combining accent, or with NFKC and NFKD, `ﬁ` equals `fi`
+	Normalization string `json:"normalization"`
+
+	// optional; a BCP 47 language tag, e.g. `de` or `sv`, whose collation compares values, so that values which the language
+	// considers to be equal have the same entries, and entries are listed in the order of the language. paths then contain collation
+	// keys rather than values, and so regular expressions are only matched against the entities.
+	Locale string `json:"locale"`
+}
+
+// whether the values of an index are compared with or without their case
+type IndexCase int
+
+const (
+	// the default: values are lower cased in the paths of their entries, but queries only find exactly the value that is queried,
+	// and values of a unique index conflict if they only differ by case
+	CASE_LOWERCASE_PATHS IndexCase = iota
+	// values are stored and compared exactly, so that values of a unique index which only differ by case do not conflict
+	CASE_SENSITIVE
+	// values are case folded, so that e.g. `Alice` equals `ALICE`, both in queries and in unique indices
+	CASE_INSENSITIVE
+)
+
+var normalizationForms = map[string]norm.Form{"NFC": norm.NFC, "NFD": norm.NFD, "NFKC": norm.NFKC, "NFKD": norm.NFKD}
+
+// returns a copy of the table in which the values of the index of the field are compared according to the collation, adding the
+// index if the field is not yet indexed. it applies to all revisions of the index. the collation does not apply to numeric,
+// decimal and time indices, whose values are encoded. changing the collation of an index which has entries requires a new revision, since
+// the paths of its entries change. panics if the collation is invalid, since tables are declared by code.
+func (t Table) WithCollation(field string, collation IndexCollation) Table {
+	if _, ok := normalizationForms[collation.Normalization]; collation.Normalization != "" && !ok {
+		panic(fmt.Sprintf("ADB-0132 invalid normalization form %s, which must be one of NFC, NFD, NFKC or NFKD", collation.Normalization))
+	}
+	if collation.Locale != "" {
+		if _, err := language.Parse(collation.Locale); err != nil {
+			panic(fmt.Sprintf("ADB-0132 invalid locale %s: %s", collation.Locale, err))
+		}
+	}
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Collation = collation
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Collation: collation})
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns what is compared and stored in place of the value, according to the collation of the index, i.e. the value, normalized
+// and case folded if the index does so, or, if it compares values in a language, their hex encoded collation key, which sorts
+// like the values. the values of enum fields are replaced by their codes, see WithEnumField.
+func (i *Index) CollationKey(value string) string {
+	if i.Numeric || i.Time || i.Decimal || value == "" {
+		return value
+	}
+	if enum := i.Table.EnumField(i.Field); enum != nil {
+		return enum.key(value)
+	}
+	if form, ok := normalizationForms[i.Collation.Normalization]; ok {
+		value = form.String(value)
+	}
+	if i.Collation.Locale != "" {
+		options := make([]collate.Option, 0, 1)
+		if i.Collation.Case == CASE_INSENSITIVE {
+			options = append(options, collate.IgnoreCase)
+		}
+		// collators are not safe for concurrent use
+		collator := collate.New(language.Make(i.Collation.Locale), options...)
+		return hex.EncodeToString(collator.KeyFromString(&collate.Buffer{}, value))
+	}
+	if i.Collation.Case == CASE_INSENSITIVE {
+		return cases.Fold().String(value)
+	}
+	return value
+}
+
+// true if the values of the index can be recognised in the paths of its entries, i.e. at most their case differs, so that
+// regular expressions which ignore case can be matched against the paths. the paths of enum fields contain codes.
+func (i *Index) PathsContainValues() bool {
+	return i.Collation.Locale == "" && i.Collation.Normalization == "" && i.Table.EnumField(i.Field) == nil
+}
+
+// returns the key that the entries of the value are listed by, i.e. its collation key, lower cased if the paths of the index are,
+// so that values can be compared in the order of the index, e.g. of its locale. see WhereIndexedFieldInStringRange
+func (i *Index) SortKey(value string) string {
+	return i.pathValue(i.CollationKey(value))
+}
+
+// lower cases the value for the path of its entries, if the index does so
+func (i *Index) pathValue(value string) string {
+	if i.Collation.Case == CASE_LOWERCASE_PATHS {
+		return strings.ToLower(value)
+	}
+	return value
+}
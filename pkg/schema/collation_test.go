@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexCollation_DefaultLowerCasesPathsButComparesExactly(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Email"})
+	index := table.Indices[0]
+
+	assert.Equal("Alice", index.CollationKey("Alice"))
+	assert.Equal("db/account/indices/Email/al/alice", index.PathNoId("Alice"))
+	assert.Equal(index.PathNoId("ALICE"), index.PathNoId("Alice"))
+}
+
+func TestIndexCollation_CaseSensitive(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Email"}).WithCollation("Email", IndexCollation{Case: CASE_SENSITIVE})
+	index := table.Indices[0]
+
+	assert.Equal("db/account/indices/Email/Al/Alice", index.PathNoId("Alice"))
+	assert.NotEqual(index.UniquePath("ALICE"), index.UniquePath("Alice"))
+}
+
+func TestIndexCollation_CaseInsensitive(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{}).WithCollation("Name", IndexCollation{Case: CASE_INSENSITIVE})
+	assert.Len(table.Indices, 1)
+	index := table.Indices[0]
+
+	assert.Equal(index.CollationKey("alice"), index.CollationKey("ALICE"))
+	assert.Equal(index.CollationKey("strasse"), index.CollationKey("STRAßE"))
+	assert.Equal(index.UniquePath("ALICE"), index.UniquePath("Alice"))
+	assert.True(index.PathsContainValues())
+}
+
+func TestIndexCollation_Normalization(t *testing.T) {
+	assert := assert.New(t)
+	precomposed, decomposed := "café", "café"
+
+	index := NewTable("db", "place", []string{"Name"}).Indices[0]
+	assert.NotEqual(index.CollationKey(precomposed), index.CollationKey(decomposed))
+
+	index = NewTable("db", "place", []string{"Name"}).WithCollation("Name", IndexCollation{Normalization: "NFC"}).Indices[0]
+	assert.Equal(precomposed, index.CollationKey(decomposed))
+	assert.Equal(index.PathNoId(precomposed), index.PathNoId(decomposed))
+	assert.False(index.PathsContainValues())
+
+	index = NewTable("db", "place", []string{"Name"}).WithCollation("Name", IndexCollation{Normalization: "NFKD"}).Indices[0]
+	assert.Equal(index.CollationKey("fi"), index.CollationKey("ﬁ"))
+
+	assert.PanicsWithValue("ADB-0132 invalid normalization form NFX, which must be one of NFC, NFD, NFKC or NFKD", func() {
+		NewTable("db", "place", []string{"Name"}).WithCollation("Name", IndexCollation{Normalization: "NFX"})
+	})
+}
+
+func TestIndexCollation_Locale(t *testing.T) {
+	assert := assert.New(t)
+	index := NewTable("db", "person", []string{"Name"}).WithCollation("Name", IndexCollation{Locale: "sv"}).Indices[0]
+
+	// in swedish, ö sorts after z
+	assert.Less(index.CollationKey("zebra"), index.CollationKey("öl"))
+	assert.NotEqual(index.CollationKey("Anna"), index.CollationKey("anna"))
+
+	index = NewTable("db", "person", []string{"Name"}).WithCollation("Name", IndexCollation{Locale: "de", Case: CASE_INSENSITIVE}).Indices[0]
+	assert.Equal(index.CollationKey("Anna"), index.CollationKey("anna"))
+	assert.Less(index.CollationKey("öl"), index.CollationKey("zebra"))
+	assert.False(index.PathsContainValues())
+
+	// numeric and time indices are unaffected
+	numeric := NewTable("db", "person", []string{}).WithNumericIndex("Age").WithCollation("Age", IndexCollation{Locale: "de"}).Indices[0]
+	assert.Equal("42", numeric.CollationKey("42"))
+	decimal := NewTable("db", "person", []string{}).WithDecimalIndex("Salary").WithCollation("Salary", IndexCollation{Case: CASE_INSENSITIVE}).Indices[0]
+	assert.Equal("20005", decimal.CollationKey("20005"))
+
+	assert.Panics(func() {
+		NewTable("db", "person", []string{"Name"}).WithCollation("Name", IndexCollation{Locale: "not a locale!"})
+	})
+}
+
+func TestIndexCollation_SortKey(t *testing.T) {
+	assert := assert.New(t)
+	index := NewTable("db", "person", []string{"Name"}).Indices[0]
+	assert.Equal("zoë", index.SortKey("Zoë"))
+
+	index = NewTable("db", "person", []string{"Name"}).WithCollation("Name", IndexCollation{Locale: "sv", Case: CASE_INSENSITIVE}).Indices[0]
+	names := []string{"Örjan", "adam", "Zacke", "Åsa", "Ärla", "Bertil"}
+	slices.SortFunc(names, func(a, b string) int { return strings.Compare(index.SortKey(a), index.SortKey(b)) })
+	assert.Equal([]string{"adam", "Bertil", "Zacke", "Åsa", "Ärla", "Örjan"}, names)
+}
@@ -0,0 +1,35 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// an action which undoes a side effect outside of the store, e.g. refunding a payment, if the transaction is rolled back.
+// it is persisted with the transaction, naming the compensator which executes it, so that a process which recovers the
+// transaction can execute it, too.
+type Compensation struct {
+	Compensator string          `json:"compensator"`
+	Args        json.RawMessage `json:"args,omitempty"`
+	Executed    bool            `json:"executed,omitempty"`
+}
+
+// registers a compensation, which executes the named compensator with the given arguments if the transaction is rolled back.
+// compensations are executed in the reverse order that they were registered, like the steps.
+// the arguments are serialised as JSON, since they are persisted with the transaction. the compensation is only persisted when the
+// transaction is next stored, e.g. when a step is added, so MinioRepository.Compensate, which stores it at once, is used before
+// side effects that must be compensated even if the process fails before then.
+func (t *Transaction) Compensate(compensator string, args any) error {
+	if err := t.IsOk(); err != nil {
+		return err
+	}
+	if t.ReadOnly {
+		return TransactionIsReadOnlyError
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("ADB-0109 failed to serialise the arguments of the compensation %s: %w", compensator, err)
+	}
+	t.Compensations = append(t.Compensations, &Compensation{Compensator: compensator, Args: data})
+	return nil
+}
@@ -0,0 +1,27 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompensation_PersistedWithTransaction(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	assert.NoError(tx.Compensate("refund", map[string]int{"amount": 5}))
+
+	data, err := json.Marshal(tx)
+	assert.NoError(err)
+	recovered := Transaction{}
+	assert.NoError(json.Unmarshal(data, &recovered))
+	assert.Equal(1, len(recovered.Compensations))
+	assert.Equal("refund", recovered.Compensations[0].Compensator)
+	assert.JSONEq(`{"amount":5}`, string(recovered.Compensations[0].Args))
+	assert.False(recovered.Compensations[0].Executed)
+
+	readOnly := NewReadOnlyTransaction(10 * time.Second)
+	assert.ErrorIs(readOnly.Compensate("refund", nil), TransactionIsReadOnlyError)
+}
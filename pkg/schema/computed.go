@@ -0,0 +1,30 @@
+package schema
+
+import "fmt"
+
+// returns the function of a computed index over the entities of type T, which returns the value that is indexed, e.g. the lower
+// case domain of an email address, or the year of a date, so that the value needn't be a field of the entity in order to query by
+// it. empty values are null, so that they are indexed like missing fields. the entity may be a T or a pointer to one, and the
+// function fails with ADB-0161 if it is neither, e.g. because the index is declared on a table of another type. see
+// Table.WithComputedIndex
+func Computed[T any](compute func(entity *T) string) IndexValueFunc {
+	return func(entity any) (*string, error) {
+		var t *T
+		switch e := entity.(type) {
+		case *T:
+			t = e
+		case T:
+			t = &e
+		default:
+			return nil, fmt.Errorf("ADB-0161 the computed index expects a %T, but the entity is a %T", t, entity)
+		}
+		if t == nil {
+			return nil, nil
+		}
+		value := compute(t)
+		if value == "" {
+			return nil, nil
+		}
+		return &value, nil
+	}
+}
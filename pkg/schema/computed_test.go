@@ -0,0 +1,39 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type computedUser struct {
+	Email string
+}
+
+func TestComputed_IndexesTheValueOfTheFunction(t *testing.T) {
+	assert := assert.New(t)
+	domain := Computed(func(u *computedUser) string {
+		_, domain, _ := strings.Cut(u.Email, "@")
+		return strings.ToLower(domain)
+	})
+
+	value, err := domain(&computedUser{Email: "John@Example.COM"})
+	assert.NoError(err)
+	assert.Equal("example.com", *value)
+
+	value, err = domain(computedUser{Email: "jane@example.org"})
+	assert.NoError(err)
+	assert.Equal("example.org", *value)
+
+	// empty values are null
+	value, err = domain(&computedUser{Email: "nobody"})
+	assert.NoError(err)
+	assert.Nil(value)
+	value, err = domain((*computedUser)(nil))
+	assert.NoError(err)
+	assert.Nil(value)
+
+	_, err = domain("not a user")
+	assert.ErrorContains(err, "ADB-0161")
+}
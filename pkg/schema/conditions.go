@@ -0,0 +1,69 @@
+package schema
+
+// decides at commit time whether conditional steps are applied, e.g. based on what the steps before them changed
+type StepPredicate func(tx *Transaction) bool
+
+// makes the steps added by addSteps conditional, e.g. the steps added by an insert of an audit record. they are not applied when
+// they are added, but when the transaction is committed, and only if the predicate is then true, otherwise they are skipped, so
+// that no-op writes and the index churn that they cause are avoided.
+// predicates are not persisted, so the conditional steps of a transaction that is recovered or resumed are skipped.
+func (t *Transaction) When(predicate StepPredicate, addSteps func() error) error {
+	if err := t.IsOk(); err != nil {
+		return err
+	}
+	previous := t.condition
+	t.condition = predicate
+	defer func() { t.condition = previous }()
+	return addSteps()
+}
+
+// a predicate which is true if the transaction changed the content of the object at the path, i.e. it wrote a version whose ETag,
+// which is a checksum of the content, differs from the ETag of the version before it. inserts and deletes always change it.
+// an upsert, i.e. an update without an ETag, is compared with the version that the transaction read, and changes it if the
+// transaction did not read it.
+func Changed(path string) StepPredicate {
+	return func(tx *Transaction) bool {
+		for _, step := range tx.Steps {
+			if step.Path != path || !step.Type.IsData() || !step.Executed || step.Conditional {
+				continue
+			}
+			if step.Type != STEP_UPDATE_DATA || step.PreviousETag == nil || step.FinalETag == nil || *step.FinalETag != *step.PreviousETag {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// true if a conditional step must not yet be executed, since its predicate has not been evaluated
+func (step *TransactionStep) IsDeferred() bool {
+	return step.Conditional && !step.ConditionMet && !step.Skipped
+}
+
+// evaluates the predicates of the deferred steps, in the order that they were added, marking each as met or skipped.
+// returns true if any are met, and so need to be executed.
+func (t *Transaction) EvaluateConditions() bool {
+	anyMet := false
+	for _, step := range t.Steps {
+		if !step.IsDeferred() {
+			continue
+		}
+		if step.condition != nil && step.condition(t) {
+			step.ConditionMet = true
+			anyMet = true
+		} else {
+			step.Skipped = true
+		}
+	}
+	return anyMet
+}
+
+// true if any steps are waiting for their predicates to be evaluated
+func (t *Transaction) HasDeferredSteps() bool {
+	for _, step := range t.Steps {
+		if step.IsDeferred() {
+			return true
+		}
+	}
+	return false
+}
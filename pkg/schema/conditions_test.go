@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditions_StepsAddedWithinWhenAreDeferred(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	var entity any = "x"
+	assert.NoError(tx.AddStep(STEP_UPDATE_DATA, "application/json", "db/account/data/1.json", "etag-1", &entity))
+	err := tx.When(Changed("db/account/data/1.json"), func() error {
+		return tx.AddStep(STEP_INSERT_DATA, "application/json", "db/audit/data/1.json", "*", &entity)
+	})
+	assert.NoError(err)
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/account/data/2.json", "*", &entity))
+
+	assert.False(tx.Steps[0].Conditional)
+	assert.True(tx.Steps[1].IsDeferred())
+	assert.False(tx.Steps[2].Conditional) // the condition only applies within When
+	assert.True(tx.HasDeferredSteps())
+}
+
+func TestConditions_Changed(t *testing.T) {
+	assert := assert.New(t)
+	path := "db/account/data/1.json"
+	same := "etag-1"
+	different := "etag-2"
+
+	for _, test := range []struct {
+		name     string
+		step     TransactionStep
+		expected bool
+	}{
+		{"unchanged update", TransactionStep{Type: STEP_UPDATE_DATA, PreviousETag: &same, FinalETag: &same}, false},
+		{"changed update", TransactionStep{Type: STEP_UPDATE_DATA, PreviousETag: &same, FinalETag: &different}, true},
+		{"upsert of an unread object", TransactionStep{Type: STEP_UPDATE_DATA, FinalETag: &same}, true},
+		{"insert", TransactionStep{Type: STEP_INSERT_DATA, FinalETag: &same}, true},
+		{"delete", TransactionStep{Type: STEP_DELETE_DATA, FinalETag: &same}, true},
+	} {
+		tx := NewTransaction(10 * time.Second)
+		step := test.step
+		step.Path = path
+		step.Executed = true
+		tx.Steps = append(tx.Steps, &step)
+		assert.Equal(test.expected, Changed(path)(&tx), test.name)
+	}
+
+	tx := NewTransaction(10 * time.Second)
+	assert.False(Changed(path)(&tx))
+}
+
+func TestConditions_EvaluateConditions(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	var entity any = "x"
+	yes := func(tx *Transaction) bool { return true }
+	no := func(tx *Transaction) bool { return false }
+	assert.NoError(tx.When(yes, func() error { return tx.AddStep(STEP_INSERT_DATA, "application/json", "a", "*", &entity) }))
+	assert.NoError(tx.When(no, func() error { return tx.AddStep(STEP_INSERT_DATA, "application/json", "b", "*", &entity) }))
+
+	assert.True(tx.EvaluateConditions())
+	assert.True(tx.Steps[0].ConditionMet)
+	assert.False(tx.Steps[0].IsDeferred())
+	assert.True(tx.Steps[1].Skipped)
+	assert.False(tx.HasDeferredSteps())
+}
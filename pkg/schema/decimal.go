@@ -0,0 +1,284 @@
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the offset of the exponents of encoded decimals, which have four digits, so that decimals with up to about 5000 digits before
+// or after the point can be indexed
+const decimalExponentOffset = 5000
+
+// encodes an exact decimal, e.g. `-12.50` or `1e3`, so that the lexicographic order of encodings is the numeric order, like
+// EncodeSortableNumber, but without rounding it to a float64. decimals which are equal, e.g. `12.5` and `12.50`, are encoded
+// alike. the encoding starts with `0` for negative decimals, `1` for zero and `2` for positive ones, followed by the exponent and
+// the significant digits, both of which are complemented for negative decimals, which are terminated by `~`.
+func EncodeSortableDecimal(decimal string) (string, error) {
+	negative, digits, exponent, err := parseDecimal(decimal)
+	if err != nil {
+		return "", err
+	}
+	if digits == "" {
+		return "1", nil
+	}
+	if exponent+decimalExponentOffset < 0 || exponent+decimalExponentOffset > 9999 {
+		return "", fmt.Errorf("ADB-0347 the decimal %s cannot be indexed, since its exponent is too large", decimal)
+	}
+	if !negative {
+		return fmt.Sprintf("2%04d%s", exponent+decimalExponentOffset, digits), nil
+	}
+	complemented := []byte(digits)
+	for i, digit := range complemented {
+		complemented[i] = '9' - digit + '0'
+	}
+	return fmt.Sprintf("0%04d%s~", 9999-(exponent+decimalExponentOffset), complemented), nil
+}
+
+// the inverse of EncodeSortableDecimal, returning the decimal in canonical form, see NormalizeDecimal
+func DecodeSortableDecimal(encoded string) (string, error) {
+	invalid := fmt.Errorf("ADB-0348 invalid sortable decimal %s", encoded)
+	if encoded == "1" {
+		return "0", nil
+	}
+	if len(encoded) < 6 {
+		return "", invalid
+	}
+	exponent, err := strconv.Atoi(encoded[1:5])
+	if err != nil {
+		return "", invalid
+	}
+	digits := []byte(encoded[5:])
+	switch encoded[0] {
+	case '2':
+		exponent -= decimalExponentOffset
+	case '0':
+		if digits[len(digits)-1] != '~' {
+			return "", invalid
+		}
+		digits = digits[:len(digits)-1]
+		for i, digit := range digits {
+			digits[i] = '9' - digit + '0'
+		}
+		exponent = 9999 - exponent - decimalExponentOffset
+	default:
+		return "", invalid
+	}
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return "", invalid
+		}
+	}
+	return formatDecimal(encoded[0] == '0', string(digits), exponent), nil
+}
+
+// returns the decimal in canonical form, i.e. without an exponent, leading or trailing zeros, or a plus sign, e.g. `12.5` for
+// `+012.50`, so that decimals which are equal have the same form
+func NormalizeDecimal(decimal string) (string, error) {
+	negative, digits, exponent, err := parseDecimal(decimal)
+	if err != nil {
+		return "", err
+	}
+	return formatDecimal(negative, digits, exponent), nil
+}
+
+// returns a copy of the table in which the index of the field is over exact decimals, adding the index if the field is not yet
+// indexed. the field is a string, e.g. `"12.50"`, a json.Number, a number, or a type whose String method returns a decimal. its
+// values are encoded with EncodeSortableDecimal, so that they can be queried by range without being rounded, as they would be by
+// a numeric index, e.g. amounts of money.
+func (t Table) WithDecimalIndex(field string) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Decimal = true
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Decimal: true})
+	}
+	t.Indices = indices
+	return t
+}
+
+// parses a decimal into its sign, its significant digits, without leading or trailing zeros, and the exponent, such that the
+// decimal is `0.<digits> * 10^exponent`. zero has no digits.
+func parseDecimal(decimal string) (bool, string, int, error) {
+	invalid := fmt.Errorf("ADB-0349 %q is not a decimal", decimal)
+	s := decimal
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	exponent := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || e < -decimalExponentOffset || e > decimalExponentOffset {
+			return false, "", 0, invalid
+		}
+		exponent = e
+		s = s[:i]
+	}
+	integer, fraction, _ := strings.Cut(s, ".")
+	if integer == "" && fraction == "" {
+		return false, "", 0, invalid
+	}
+	for _, c := range integer + fraction {
+		if c < '0' || c > '9' {
+			return false, "", 0, invalid
+		}
+	}
+	digits := integer + fraction
+	exponent += len(integer)
+	trimmed := strings.TrimLeft(digits, "0")
+	exponent -= len(digits) - len(trimmed)
+	digits = strings.TrimRight(trimmed, "0")
+	if digits == "" {
+		return false, "", 0, nil
+	}
+	return negative, digits, exponent, nil
+}
+
+func formatDecimal(negative bool, digits string, exponent int) string {
+	if digits == "" {
+		return "0"
+	}
+	var s string
+	switch {
+	case exponent <= 0:
+		s = "0." + strings.Repeat("0", -exponent) + digits
+	case exponent >= len(digits):
+		s = digits + strings.Repeat("0", exponent-len(digits))
+	default:
+		s = digits[:exponent] + "." + digits[exponent:]
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s
+}
+
+// an exact decimal, e.g. an amount of money, which, unlike a float64, is neither rounded when it is written or read, nor when it
+// is indexed, see WithDecimalIndex. it is written to JSON as a string, e.g. `"12.5"`, so that clients do not parse it as a
+// float either, and can be read from a string or a number. it is held in canonical form, see NormalizeDecimal, so decimals
+// which are equal compare equal with ==. the zero value is zero.
+type Decimal struct {
+	value string
+}
+
+// returns the decimal, e.g. `-12.50` or `1e3`, or an error if it is not one
+func NewDecimal(decimal string) (Decimal, error) {
+	normalized, err := NormalizeDecimal(decimal)
+	if err != nil {
+		return Decimal{}, err
+	}
+	if normalized == "0" {
+		// so that it equals the zero value
+		normalized = ""
+	}
+	return Decimal{normalized}, nil
+}
+
+// like NewDecimal, but panics if it is not a decimal, e.g. for constants
+func MustDecimal(decimal string) Decimal {
+	d, err := NewDecimal(decimal)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// the decimal in canonical form, e.g. `12.5`
+func (d Decimal) String() string {
+	if d.value == "" {
+		return "0"
+	}
+	return d.value
+}
+
+func (d Decimal) IsZero() bool {
+	return d.value == ""
+}
+
+// returns -1 if the decimal is less than the other, 0 if they are equal, and +1 if it is greater
+func (d Decimal) Cmp(other Decimal) int {
+	a, _ := EncodeSortableDecimal(d.String())
+	b, _ := EncodeSortableDecimal(other.String())
+	return strings.Compare(a, b)
+}
+
+// the number of digits before the point, and the number of digits after it, e.g. 2 and 1 for `12.5`, and 0 and 3 for `0.025`
+func (d Decimal) Digits() (int, int) {
+	_, digits, exponent, _ := parseDecimal(d.String())
+	return max(exponent, 0), max(len(digits)-exponent, 0)
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalText(text []byte) error {
+	decimal, err := NewDecimal(string(text))
+	if err != nil {
+		return err
+	}
+	*d = decimal
+	return nil
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// accepts strings, and numbers, which are read exactly, as they are written
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	return d.UnmarshalText([]byte(text))
+}
+
+// the constraint that the values of a decimal field are checked against when they are written, like those of SQL, i.e. at most
+// Precision digits, of which at most Scale are after the point, e.g. 10 and 2 for amounts of money up to 99'999'999.99
+type DecimalField struct {
+	Field     string `json:"field"`
+	Precision int    `json:"precision"`
+	Scale     int    `json:"scale"`
+}
+
+// returns a copy of the table in which the values of the field must be decimals with at most the given precision and scale
+// when they are written, i.e. a Decimal, a string or json.Number holding a decimal, or a number which is checked as it is
+// formatted. values which are null, i.e. nil pointers or empty strings, are not checked. panics if the constraint is invalid,
+// since tables are declared by code.
+func (t Table) WithDecimalField(field string, precision int, scale int) Table {
+	if precision < 1 || scale < 0 || scale > precision {
+		panic(fmt.Sprintf("ADB-0149 invalid precision %d and scale %d of decimal field %s", precision, scale, field))
+	}
+	decimals := make([]DecimalField, 0, len(t.Decimals)+1)
+	for _, d := range t.Decimals {
+		if d.Field != field {
+			decimals = append(decimals, d)
+		}
+	}
+	t.Decimals = append(decimals, DecimalField{Field: field, Precision: precision, Scale: scale})
+	return t
+}
+
+// returns an error if the decimal has more digits than the constraint permits
+func (f DecimalField) Check(d Decimal) error {
+	integer, fraction := d.Digits()
+	if fraction > f.Scale {
+		return fmt.Errorf("ADB-0149 the decimal %s of field %s has %d digits after the point, but at most %d are permitted", d, f.Field, fraction, f.Scale)
+	}
+	if integer > f.Precision-f.Scale {
+		return fmt.Errorf("ADB-0149 the decimal %s of field %s has %d digits before the point, but at most %d are permitted", d, f.Field, integer, f.Precision-f.Scale)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeSortableDecimal_PreservesNumericOrder(t *testing.T) {
+	assert := assert.New(t)
+	decimals := []string{"-1e300", "-1000", "-999.99", "-10.5", "-10.05", "-10", "-0.1", "-0.0999", "0", "0.000001", "0.1", "0.10000000000000000001", "1", "9.99", "10", "10.01", "100", "12345678901234567890.12", "1e300"}
+	encoded := make([]string, len(decimals))
+	for i, d := range decimals {
+		var err error
+		encoded[i], err = EncodeSortableDecimal(d)
+		assert.NoError(err, d)
+		decoded, err := DecodeSortableDecimal(encoded[i])
+		assert.NoError(err)
+		normalized, _ := NormalizeDecimal(d)
+		assert.Equal(normalized, decoded)
+	}
+	assert.True(slices.IsSorted(encoded), encoded)
+
+	equal, _ := EncodeSortableDecimal("+012.50")
+	assert.Equal(encoded[slices.Index(decimals, "10")], must(EncodeSortableDecimal("1e1")))
+	assert.Equal(must(EncodeSortableDecimal("12.5")), equal)
+	assert.Equal("1", must(EncodeSortableDecimal("-0.00")))
+
+	for _, invalid := range []string{"", "-", ".", "1.2.3", "1e", "abc", "1,5", "NaN"} {
+		_, err := EncodeSortableDecimal(invalid)
+		assert.ErrorContains(err, "ADB-0349", invalid)
+	}
+	_, err := DecodeSortableDecimal("3xyz")
+	assert.ErrorContains(err, "ADB-0348")
+}
+
+func TestNormalizeDecimal(t *testing.T) {
+	assert := assert.New(t)
+	for decimal, expected := range map[string]string{"+012.50": "12.5", "-0.0": "0", ".5": "0.5", "5.": "5", "1.5e3": "1500", "-25e-3": "-0.025", "100": "100"} {
+		normalized, err := NormalizeDecimal(decimal)
+		assert.NoError(err)
+		assert.Equal(expected, normalized, decimal)
+	}
+}
+
+func TestTable_WithDecimalIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "invoice", []string{"Amount"}).WithDecimalIndex("Amount").WithDecimalIndex("Tax")
+	assert.Len(table.Indices, 2)
+	assert.True(table.Indices[0].Decimal)
+	assert.True(table.Indices[1].Decimal)
+	assert.False(table.Indices[0].Numeric)
+}
+
+func must(s string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestDecimal(t *testing.T) {
+	assert := assert.New(t)
+	amount, err := NewDecimal("012.50")
+	assert.NoError(err)
+	assert.Equal(MustDecimal("12.5"), amount)
+	assert.Equal("12.5", amount.String())
+	assert.Equal(Decimal{}, MustDecimal("-0.00"))
+	assert.Equal("0", Decimal{}.String())
+	assert.Equal(-1, MustDecimal("-3").Cmp(MustDecimal("0.1")))
+	assert.Equal(1, MustDecimal("0.10000000000000000001").Cmp(MustDecimal("0.1")))
+	integer, fraction := amount.Digits()
+	assert.Equal(2, integer)
+	assert.Equal(1, fraction)
+	_, err = NewDecimal("twelve")
+	assert.ErrorContains(err, "ADB-0349")
+
+	type invoice struct {
+		Amount Decimal  `json:"amount"`
+		Tax    *Decimal `json:"tax"`
+	}
+	data, err := json.Marshal(invoice{Amount: amount})
+	assert.NoError(err)
+	assert.Equal(`{"amount":"12.5","tax":null}`, string(data))
+	var read invoice
+	assert.NoError(json.Unmarshal([]byte(`{"amount":0.10000000000000000001,"tax":"1.25"}`), &read))
+	assert.Equal("0.10000000000000000001", read.Amount.String())
+	assert.Equal(MustDecimal("1.25"), *read.Tax)
+	assert.Error(json.Unmarshal([]byte(`{"amount":"abc"}`), &read))
+}
+
+func TestTable_WithDecimalField(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "invoice", nil).WithDecimalField("Amount", 5, 2).WithDecimalField("Amount", 10, 2)
+	assert.Equal([]DecimalField{{Field: "Amount", Precision: 10, Scale: 2}}, table.Decimals)
+
+	field := DecimalField{Field: "Amount", Precision: 5, Scale: 2}
+	assert.NoError(field.Check(MustDecimal("999.99")))
+	assert.NoError(field.Check(MustDecimal("-0.5")))
+	assert.ErrorContains(field.Check(MustDecimal("1.005")), "ADB-0149")
+	assert.ErrorContains(field.Check(MustDecimal("1000")), "ADB-0149")
+
+	assert.Panics(func() { table.WithDecimalField("Amount", 2, 3) })
+	assert.Panics(func() { table.WithDecimalField("Amount", 0, 0) })
+}
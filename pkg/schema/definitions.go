@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+)
+
+// the options of an index, as stored in the schema registry, i.e. those which are not functions. see TableDefinition
+type IndexDefinition struct {
+	Field       string         `json:"field"`
+	Revision    int            `json:"revision,omitempty"`
+	Unique      bool           `json:"unique,omitempty"`
+	Numeric     bool           `json:"numeric,omitempty"`
+	Decimal     bool           `json:"decimal,omitempty"`
+	Time        bool           `json:"time,omitempty"`
+	TTL         time.Duration  `json:"ttl,omitempty"`
+	Collation   IndexCollation `json:"collation"`
+	JsonPath    bool           `json:"jsonPath,omitempty"`
+	FanOut      IndexFanOut    `json:"fanOut"`
+	Sparse      bool           `json:"sparse,omitempty"`
+	Projection  []string       `json:"projection"`
+	RecordETags bool           `json:"recordETags,omitempty"`
+	// set if the index has a function, i.e. it is computed or partial, which cannot be stored, so that it is declared by code
+	Computed bool `json:"computed,omitempty"`
+	Partial  bool `json:"partial,omitempty"`
+}
+
+// returns the definition of the index, as stored in the schema registry
+func (index Index) Definition() IndexDefinition {
+	return IndexDefinition{
+		Field:       index.Field,
+		Revision:    index.Revision,
+		Unique:      index.Unique,
+		Numeric:     index.Numeric,
+		Decimal:     index.Decimal,
+		Time:        index.Time,
+		TTL:         index.TTL,
+		Collation:   index.Collation,
+		JsonPath:    index.JsonPath,
+		FanOut:      index.FanOut,
+		Sparse:      index.Sparse,
+		Projection:  index.Projection,
+		RecordETags: index.RecordETags,
+		Computed:    index.Compute != nil,
+		Partial:     index.Filter != nil,
+	}
+}
+
+// true if entries of the index are written to the same paths under both definitions, so that one can read those of the other
+func (d IndexDefinition) storedLike(other IndexDefinition) bool {
+	return d.Unique == other.Unique && d.Numeric == other.Numeric && d.Decimal == other.Decimal && d.Time == other.Time &&
+		d.Collation == other.Collation && d.JsonPath == other.JsonPath && d.FanOut == other.FanOut &&
+		d.Computed == other.Computed && d.Partial == other.Partial
+}
+
+// returns the table that the definition declares, e.g. as registered by another instance of the application, so that it need
+// not be declared by code. fails with ADB-0154 if an index is computed or partial, since their functions are not registered,
+// or if the definition was registered before the options of its indices were, so that tables with such indices are declared
+// by code. layouts are not registered either, so tables with a layout other than the default are declared by code too.
+func (d TableDefinition) Table() (Table, error) {
+	name := fmt.Sprintf("%s/%s", d.Database, d.Name)
+	if d.IndexOptions == nil && len(d.Indices) > 0 {
+		return Table{}, fmt.Errorf("ADB-0154 the table %s cannot be resolved, since its definition has no index options. register it again", name)
+	}
+	t := Table{
+		Database:     Database(d.Database),
+		Name:         d.Name,
+		Key:          d.Key,
+		SingleWriter: d.SingleWriter,
+		Pinnable:     d.Pinnable,
+		Version:      d.Version,
+		Codec:        d.Codec,
+		Storage:      d.Storage,
+		Decimals:     d.Decimals,
+		Enums:        d.Enums,
+		ForeignKeys:  d.ForeignKeys,
+		EscapedPaths: d.EscapedPaths,
+	}
+	indices := make([]Index, len(d.IndexOptions))
+	for i, options := range d.IndexOptions {
+		if options.Computed || options.Partial {
+			return Table{}, fmt.Errorf("ADB-0154 the table %s cannot be resolved, since its index %s has a function, which is declared by code", name, options.Field)
+		}
+		indices[i] = Index{
+			Table:       t,
+			Field:       options.Field,
+			Revision:    options.Revision,
+			Unique:      options.Unique,
+			Numeric:     options.Numeric,
+			Decimal:     options.Decimal,
+			Time:        options.Time,
+			TTL:         options.TTL,
+			Collation:   options.Collation,
+			JsonPath:    options.JsonPath,
+			FanOut:      options.FanOut,
+			Sparse:      options.Sparse,
+			Projection:  options.Projection,
+			RecordETags: options.RecordETags,
+		}
+	}
+	t.Indices = indices
+	if d.PathTemplate != "" {
+		// it is not registered, see RegisterMappedTable
+		t = t.WithPathTemplate(d.PathTemplate)
+	}
+	return t, nil
+}
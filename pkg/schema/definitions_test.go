@@ -0,0 +1,83 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableDefinition_Table(t *testing.T) {
+	assert := assert.New(t)
+	declared := NewTable("db", "account", []string{"Name"}).
+		WithUniqueIndex("Email").
+		WithNumericIndex("Age").
+		WithCollation("Name", IndexCollation{Case: CASE_INSENSITIVE}).
+		WithProjection("Name", "Email").
+		WithCodec(TableCodec{TimePrecision: time.Millisecond}).
+		WithDecimalField("Balance", 10, 2).
+		WithVersion("1.2.0")
+
+	// as it is read from the registry
+	data, err := json.Marshal(declared.Definition())
+	assert.NoError(err)
+	var definition TableDefinition
+	assert.NoError(json.Unmarshal(data, &definition))
+	assert.Equal(declared.Definition(), definition)
+
+	resolved, err := definition.Table()
+	assert.NoError(err)
+	assert.Equal(declared.Definition(), resolved.Definition())
+	email, err := resolved.GetIndex("Email")
+	assert.NoError(err)
+	assert.True(email.Unique)
+	assert.Equal(declared.Codec, email.Table.Codec)
+	assert.Equal(declared.Indices[0].Path("John", "1"), resolved.Indices[0].Path("John", "1"))
+
+	computed := declared.WithComputedIndex("lower", func(entity any) (*string, error) { return nil, nil })
+	_, err = computed.Definition().Table()
+	assert.ErrorContains(err, "ADB-0154")
+
+	definition.IndexOptions = nil
+	_, err = definition.Table()
+	assert.ErrorContains(err, "ADB-0154")
+}
+
+func TestIncompatibilitiesWith_IndicesStoredDifferently(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "t", []string{"Age"}).WithVersion("1.1.0")
+	registered := table.Definition()
+
+	numeric := table.WithoutIndex("Age").WithNumericIndex("Age").WithVersion("1.2.0")
+	problems, err := numeric.Definition().IncompatibilitiesWith(registered)
+	assert.NoError(err)
+	assert.Len(problems, 1)
+
+	// a new revision is built alongside the old one
+	revised := table.WithIndexRevision("Age", 1, nil).WithVersion("1.2.0")
+	revised.Indices[1].Numeric = true
+	problems, err = revised.Definition().IncompatibilitiesWith(registered)
+	assert.NoError(err)
+	assert.Empty(problems)
+}
+
+func TestIncompatibilitiesWith_PathsEscapedDifferently(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "t", []string{"Name"})
+	registered := table.Definition()
+	assert.Equal(OBJECT_FORMAT_VERSION, registered.FormatVersion)
+
+	escaped := table.WithEscapedPaths()
+	assert.Equal(ESCAPED_PATHS_FORMAT_VERSION, escaped.Definition().FormatVersion)
+	problems, err := escaped.Definition().IncompatibilitiesWith(registered)
+	assert.NoError(err)
+	assert.Equal([]string{"db/t: ~ paths are escaped in code but not in registry"}, problems)
+	problems, err = table.Definition().IncompatibilitiesWith(escaped.Definition())
+	assert.NoError(err)
+	assert.Equal([]string{"db/t: ~ paths are escaped in registry but not in code"}, problems)
+
+	resolved, err := escaped.Definition().Table()
+	assert.NoError(err)
+	assert.True(resolved.Indices[0].Table.EscapedPaths)
+}
@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+)
+
+var StepDependencyNotAppliedError = fmt.Errorf("Step depends on a step which has not been applied")
+
+// declares that the steps writing the object at path must only be applied after those writing the object at dependsOn succeeded,
+// e.g. so that a child record is only created once its parent exists. this holds whatever the order in which the steps are added:
+// steps which are added before those that they depend on wait, and are applied once those have been, so an insert of a child that
+// is added before the insert of its parent returns no ETag, like a conditional one. the transaction cannot be committed while steps
+// are waiting, i.e. if the object that they depend on is never written, but fails with a StepDependencyNotAppliedError.
+// the steps which are applied during the commit are applied in parallel, except where they depend on each other.
+func (t *Transaction) DeclareDependency(path string, dependsOn string) error {
+	if err := t.IsOk(); err != nil {
+		return err
+	}
+	if path == dependsOn {
+		return fmt.Errorf("ADB-0106 the path %s cannot depend on itself", path)
+	}
+	if t.dependsOn(dependsOn, path, make(map[string]bool)) {
+		return fmt.Errorf("ADB-0106 the path %s cannot depend on %s, since %s already depends on %s", path, dependsOn, dependsOn, path)
+	}
+	if t.Dependencies == nil {
+		t.Dependencies = make(map[string][]string)
+	}
+	if !slices.Contains(t.Dependencies[path], dependsOn) {
+		t.Dependencies[path] = append(t.Dependencies[path], dependsOn)
+	}
+	return nil
+}
+
+// true if path depends on other, directly or transitively
+func (t *Transaction) dependsOn(path string, other string, visited map[string]bool) bool {
+	if visited[path] {
+		return false
+	}
+	visited[path] = true
+	for _, dependency := range t.Dependencies[path] {
+		if dependency == other || t.dependsOn(dependency, other, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// true if the paths that the step depends on have been written, i.e. if steps writing them were added, and they have all been
+// executed, so that the step may be executed
+func (t *Transaction) DependenciesApplied(step *TransactionStep) bool {
+	for _, dependency := range t.Dependencies[step.Path] {
+		if !t.pathWritten(dependency) {
+			return false
+		}
+	}
+	return true
+}
+
+// true if steps writing the path were added, and the ones which are not skipped have been executed
+func (t *Transaction) pathWritten(path string) bool {
+	written := false
+	for _, s := range t.Steps {
+		if s.Path != path || s.Skipped {
+			continue
+		}
+		if !s.Executed {
+			return false
+		}
+		written = true
+	}
+	return written
+}
+
+// returns an error wrapping a StepDependencyNotAppliedError, if any step is still waiting for the paths that it depends on to be
+// written, e.g. because no step writing them was ever added. called before the transaction is committed.
+func (t *Transaction) CheckDependenciesApplied() error {
+	for _, step := range t.Steps {
+		if step.Executed || step.Skipped || step.IsDeferred() {
+			continue
+		}
+		for _, dependency := range t.Dependencies[step.Path] {
+			if !t.pathWritten(dependency) {
+				return fmt.Errorf("ADB-0107 the step for path %s depends on %s: %w", step.Path, dependency, StepDependencyNotAppliedError)
+			}
+		}
+	}
+	return nil
+}
+
+// returns the indices of the given steps in an order in which they can be applied one after the other, i.e. those of StepWaves
+// one wave after the other
+func (t *Transaction) StepOrder(indices []int) []int {
+	order := make([]int, 0, len(indices))
+	for _, wave := range t.StepWaves(indices) {
+		order = append(order, wave...)
+	}
+	return order
+}
+
+// groups the steps with the given indices into waves, which must be applied one after the other, although the steps within a wave
+// may be applied in parallel. a step is in a later wave than the steps writing the paths that it depends on, directly or
+// transitively, and than the steps before it in the given order which write the same path.
+func (t *Transaction) StepWaves(indices []int) [][]int {
+	ranks := make(map[string]int)
+	occurrences := make(map[string]int)
+	type position struct{ rank, occurrence int }
+	positions := make([]position, len(indices))
+	for i, index := range indices {
+		path := t.Steps[index].Path
+		positions[i] = position{t.rank(path, ranks), occurrences[path]}
+		occurrences[path]++
+	}
+
+	// order by rank, then by occurrence within the rank. the rank of dependent paths is always higher, so it comes first.
+	keys := make([]position, 0, len(positions))
+	for _, p := range positions {
+		if !slices.Contains(keys, p) {
+			keys = append(keys, p)
+		}
+	}
+	slices.SortFunc(keys, func(a, b position) int {
+		if a.rank != b.rank {
+			return a.rank - b.rank
+		}
+		return a.occurrence - b.occurrence
+	})
+	waves := make([][]int, len(keys))
+	for i, index := range indices {
+		wave := slices.Index(keys, positions[i])
+		waves[wave] = append(waves[wave], index)
+	}
+	return waves
+}
+
+// the length of the longest chain of dependencies starting at the path
+func (t *Transaction) rank(path string, ranks map[string]int) int {
+	if rank, ok := ranks[path]; ok {
+		return rank
+	}
+	rank := 0
+	for _, dependency := range t.Dependencies[path] {
+		rank = max(rank, t.rank(dependency, ranks)+1)
+	}
+	ranks[path] = rank
+	return rank
+}
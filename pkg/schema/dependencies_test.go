@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencies_DeclareDependency_RejectsCycles(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+
+	assert.NoError(tx.DeclareDependency("child", "parent"))
+	assert.NoError(tx.DeclareDependency("grandchild", "child"))
+	assert.NoError(tx.DeclareDependency("grandchild", "child")) // declared once only
+	assert.Equal([]string{"child"}, tx.Dependencies["grandchild"])
+
+	assert.Error(tx.DeclareDependency("parent", "parent"))
+	assert.Error(tx.DeclareDependency("parent", "grandchild"))
+}
+
+func TestDependencies_CheckDependenciesApplied(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	assert.NoError(tx.DeclareDependency("child", "parent"))
+	var entity any = "x"
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "parent", "*", &entity))
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "child", "*", &entity))
+
+	assert.False(tx.DependenciesApplied(tx.Steps[1]))
+	assert.ErrorIs(tx.CheckDependenciesApplied(), StepDependencyNotAppliedError)
+	tx.Steps[0].Executed = true
+	assert.True(tx.DependenciesApplied(tx.Steps[1]))
+	assert.NoError(tx.CheckDependenciesApplied()) // the child can be executed
+}
+
+func TestDependencies_ChildAddedBeforeItsParent(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	assert.NoError(tx.DeclareDependency("child", "parent"))
+	var entity any = "x"
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "child", "*", &entity))
+	assert.False(tx.DependenciesApplied(tx.Steps[0])) // no step writes the parent yet
+	assert.ErrorIs(tx.CheckDependenciesApplied(), StepDependencyNotAppliedError)
+
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "parent", "*", &entity))
+	assert.NoError(tx.AddStep(STEP_INSERT_ADD_INDEX, "text/plain", "entry", "*", &entity))
+	assert.Equal([]int{1, 2, 0}, tx.StepOrder([]int{0, 1, 2}))
+}
+
+func TestDependencies_StepWaves(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	assert.NoError(tx.DeclareDependency("c", "b"))
+	assert.NoError(tx.DeclareDependency("b", "a"))
+	var entity any = "x"
+	for _, path := range []string{"c", "x", "a", "a", "y"} {
+		assert.NoError(tx.AddStep(STEP_UPDATE_REMOVE_INDEX, "application/json", path, "", &entity))
+	}
+
+	waves := tx.StepWaves([]int{0, 1, 2, 3, 4})
+	assert.Equal([][]int{{1, 2, 4}, {3}, {0}}, waves)
+
+	assert.Empty(tx.StepWaves([]int{}))
+}
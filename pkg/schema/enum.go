@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// the codes of enum values are short, and need neither escaping nor lower casing in the paths of index entries
+var enumCodePattern = regexp.MustCompile(`^[a-z0-9_-]{1,16}$`)
+
+// a value that an enum field permits, e.g. `"AWAITING_PAYMENT"`, and its code, e.g. `"ap"`, which the paths of the entries of
+// its index contain in place of the value. the code is stable, i.e. it is never changed once records have the value, so that
+// the value can be renamed without rebuilding the index, by keeping its code.
+type EnumValue struct {
+	Value string `json:"value"`
+	Code  string `json:"code"`
+}
+
+// a field whose values are checked against the values that it permits when they are written. see WithEnumField
+type EnumField struct {
+	Field  string      `json:"field"`
+	Values []EnumValue `json:"values"`
+}
+
+// returns a copy of the table in which the values of the field must be one of the given values when they are written, i.e. a
+// string, a type whose kind is string, a pointer to one, or a slice of them. values which are null, i.e. nil pointers or empty
+// strings, are not checked. if the field is indexed, the paths of its entries contain the codes of the values, so that they are
+// short, need no escaping, and are listed in the order of the codes. queries name the values, which are translated to their
+// codes. panics if a value or code is empty or declared twice, or a code is not at most 16 lower case letters, digits, `_` or
+// `-`, since tables are declared by code.
+func (t Table) WithEnumField(field string, values ...EnumValue) Table {
+	if len(values) == 0 {
+		panic(fmt.Sprintf("ADB-0168 the enum field %s of table %s has no values", field, t.Name))
+	}
+	seenValues := make(map[string]bool, len(values))
+	seenCodes := make(map[string]bool, len(values))
+	for _, value := range values {
+		if value.Value == "" || seenValues[value.Value] {
+			panic(fmt.Sprintf("ADB-0303 the value %q of enum field %s of table %s is empty or declared twice", value.Value, field, t.Name))
+		}
+		if !enumCodePattern.MatchString(value.Code) || seenCodes[value.Code] {
+			panic(fmt.Sprintf("ADB-0304 the code %q of value %s of enum field %s of table %s is invalid or declared twice", value.Code, value.Value, field, t.Name))
+		}
+		seenValues[value.Value] = true
+		seenCodes[value.Code] = true
+	}
+	enums := make([]EnumField, 0, len(t.Enums)+1)
+	for _, e := range t.Enums {
+		if e.Field != field {
+			enums = append(enums, e)
+		}
+	}
+	t.Enums = append(enums, EnumField{Field: field, Values: values})
+	indices := make([]Index, len(t.Indices))
+	for i, index := range t.Indices {
+		index.Table.Enums = t.Enums
+		indices[i] = index
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns the enum field of the table with the given name, or nil if the field is not an enum
+func (t *Table) EnumField(field string) *EnumField {
+	for i := range t.Enums {
+		if t.Enums[i].Field == field {
+			return &t.Enums[i]
+		}
+	}
+	return nil
+}
+
+// returns the code of the value, or an error if the field does not permit it
+func (f EnumField) Code(value string) (string, error) {
+	for _, v := range f.Values {
+		if v.Value == value {
+			return v.Code, nil
+		}
+	}
+	return "", fmt.Errorf("ADB-0305 %q is not a value of enum field %s", value, f.Field)
+}
+
+// returns the value of the code, e.g. of the folder of an index entry, or an error if the field has no value with the code
+func (f EnumField) Value(code string) (string, error) {
+	for _, v := range f.Values {
+		if v.Code == code {
+			return v.Value, nil
+		}
+	}
+	return "", fmt.Errorf("ADB-0306 %q is not a code of enum field %s", code, f.Field)
+}
+
+// returns the code of the value, which the paths of the entries of its index contain in place of it. values that the field
+// does not permit, which are never written, but may be queried, are marked, so that they never equal a code.
+func (f EnumField) key(value string) string {
+	code, err := f.Code(value)
+	if err != nil {
+		return "~" + value
+	}
+	return code
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable_WithEnumField(t *testing.T) {
+	assert := assert.New(t)
+	open := EnumValue{Value: "Open", Code: "o"}
+	closed := EnumValue{Value: "Closed", Code: "c"}
+	table := NewTable("db", "ticket", []string{"Status", "Title"}).WithEnumField("Status", open).WithEnumField("Status", open, closed)
+	assert.Equal([]EnumField{{Field: "Status", Values: []EnumValue{open, closed}}}, table.Enums)
+	assert.Nil(table.EnumField("Title"))
+
+	code, err := table.EnumField("Status").Code("Closed")
+	assert.NoError(err)
+	assert.Equal("c", code)
+	value, err := table.EnumField("Status").Value("o")
+	assert.NoError(err)
+	assert.Equal("Open", value)
+	_, err = table.EnumField("Status").Code("Lost")
+	assert.ErrorContains(err, "ADB-0305")
+	_, err = table.EnumField("Status").Value("x")
+	assert.ErrorContains(err, "ADB-0306")
+
+	// the paths of the index contain the codes, and values which are not permitted never equal a code
+	status := table.Indices[0]
+	assert.Equal("db/ticket/indices/Status/_c/_c/db___ticket___1", status.Path("Closed", "1"))
+	assert.NotEqual(status.PathNoId("o"), status.PathNoId("Open"))
+	assert.False(status.PathsContainValues())
+	assert.True(table.Indices[1].PathsContainValues())
+	resolved, err := table.Definition().Table()
+	assert.NoError(err)
+	assert.Equal(status.Path("Closed", "1"), resolved.Indices[0].Path("Closed", "1"))
+
+	assert.Panics(func() { table.WithEnumField("Priority") })
+	assert.Panics(func() { table.WithEnumField("Priority", EnumValue{Value: "High", Code: "h"}, EnumValue{Value: "Highest", Code: "h"}) })
+	assert.Panics(func() { table.WithEnumField("Priority", EnumValue{Value: "High", Code: "H"}) })
+	assert.Panics(func() { table.WithEnumField("Priority", EnumValue{Value: "", Code: "n"}) })
+}
@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// returns a copy of the table whose index entries are stored at escaped paths, so that ids and values can contain any
+// characters, see EscapePathSegment and EscapePathValue. paths of tables without it are not escaped, as they were before
+// escaping was introduced, so that their existing entries are still found. the definitions of tables with escaped paths have
+// format version ESCAPED_PATHS_FORMAT_VERSION, so that nodes which cannot read them refuse to use them. switching a table which
+// has records requires their entries to be moved, see minio.MigrateToEscapedPaths.
+func (t Table) WithEscapedPaths() Table {
+	t.EscapedPaths = true
+	return t.withIndicesOfItself()
+}
+
+// escapes the collated value for the folder of its entries, if the table escapes paths
+func (i *Index) escapeValue(value string) string {
+	if !i.Table.EscapedPaths {
+		return value
+	}
+	return EscapePathValue(value)
+}
+
+// returns the path of the entry of the index with the values and the id unescaped, e.g. for matching regular expressions
+// against the values
+func (i *Index) UnescapedPath(path string) string {
+	rest, found := strings.CutPrefix(path, i.PathPrefix()+"/")
+	if !i.Table.EscapedPaths || !found {
+		return path
+	}
+	segments := strings.Split(rest, "/")
+	for j, segment := range segments[:len(segments)-1] {
+		segments[j] = UnescapePathValue(segment)
+	}
+	segments[len(segments)-1] = UnescapePathSegment(segments[len(segments)-1])
+	return i.PathPrefix() + "/" + strings.Join(segments, "/")
+}
+
+// escapes the value for the folder of its index entries, so that it is a single segment of the path, which sorts like the value.
+// `/` is encoded as `.~` and `.` as `..`, and a leading `_`, which could be mistaken for the padding of short values when they
+// are fanned out, as `^~` and a leading `^` as `^^`. since each escape starts with the character just before the one that it
+// replaces, and no other character sorts between them, the escaped values sort like the values, so that ranges of values can be
+// listed. all other characters are unchanged.
+func EscapePathValue(s string) string {
+	if !strings.ContainsAny(s, "./") && !strings.HasPrefix(s, "_") && !strings.HasPrefix(s, "^") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.':
+			b.WriteString("..")
+		case c == '/':
+			b.WriteString(".~")
+		case i == 0 && c == '^':
+			b.WriteString("^^")
+		case i == 0 && c == '_':
+			b.WriteString("^~")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// reverses EscapePathValue. sequences which are not an escape are left as they are
+func UnescapePathValue(s string) string {
+	if !strings.Contains(s, ".") && !strings.HasPrefix(s, "^") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case i+1 < len(s) && s[i] == '.' && s[i+1] == '.':
+			b.WriteByte('.')
+			i++
+		case i+1 < len(s) && s[i] == '.' && s[i+1] == '~':
+			b.WriteByte('/')
+			i++
+		case i == 0 && len(s) > 1 && s[0] == '^' && s[1] == '^':
+			b.WriteByte('^')
+			i++
+		case i == 0 && len(s) > 1 && s[0] == '^' && s[1] == '~':
+			b.WriteByte('_')
+			i++
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// escapes the characters of the string which would otherwise corrupt the name of an index entry, or another segment of a path
+// which need not sort like the string: `%`, `/`, which separates the segments of paths, and underscores which could be mistaken
+// for the separator `___` between the database, table and id in the names of entries, i.e. those which are next to another one,
+// or at the start or end of the string. they are encoded like `%2F`, as in URLs, so that all other strings, e.g. UUIDs, are
+// unchanged.
+func EscapePathSegment(s string) string {
+	if !strings.ContainsAny(s, "%/_") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' || c == '/':
+			fmt.Fprintf(&b, "%%%02X", c)
+		case c == '_' && (i == 0 || i == len(s)-1 || s[i-1] == '_' || s[i+1] == '_'):
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// reverses EscapePathSegment. sequences which are not an escape are left as they are
+func UnescapePathSegment(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapePathSegment(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("4f1c2d3e-0000-4000-8000-000000000000", EscapePathSegment("4f1c2d3e-0000-4000-8000-000000000000"))
+	assert.Equal("first_last", EscapePathSegment("first_last"))
+	assert.Equal("a%5F%5F%5Fb", EscapePathSegment("a___b"))
+	assert.Equal("%5Fa%5F", EscapePathSegment("_a_"))
+	assert.Equal("a%2Fb%25c", EscapePathSegment("a/b%c"))
+
+	for _, s := range []string{"", "_", "__", "a___b", "_a_", "a/b", "100%", "%2F", "über/straße___", "a____b_c"} {
+		escaped := EscapePathSegment(s)
+		assert.NotContains(escaped, "/", s)
+		assert.NotContains(escaped, "__", s)
+		assert.Equal(s, UnescapePathSegment(escaped), s)
+	}
+	assert.Equal("100%", UnescapePathSegment("100%"))
+}
+
+func TestEscapePathValue_PreservesTheOrder(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("john@example..com", EscapePathValue("john@example.com"))
+	assert.Equal("a.~b", EscapePathValue("a/b"))
+	assert.Equal("^~a_b", EscapePathValue("_a_b"))
+	assert.Equal("^^a^", EscapePathValue("^a^"))
+	assert.Equal("100%", EscapePathValue("100%"))
+
+	values := []string{"", "-", ".", "..", "./", "/", "/.", "0", "A", "Z", "[", "^", "^~", "_", "__", "_a", "`", "a", "a&", "a.", "a.b",
+		"a/", "a/b", "a0", "a_", "a__b", "ab", "~", "~null", "über/straße"}
+	for _, s := range values {
+		escaped := EscapePathValue(s)
+		assert.NotContains(escaped, "/", s)
+		assert.False(strings.HasPrefix(escaped, "_"), s)
+		assert.Equal(s, UnescapePathValue(escaped), s)
+		for _, other := range values {
+			assert.Equal(strings.Compare(s, other), strings.Compare(escaped, EscapePathValue(other)), "%s and %s", s, other)
+		}
+	}
+}
+
+func TestIndex_PathIsNotEscapedUnlessTheTableEscapesPaths(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("shop", "orders", []string{"Name"})
+	index := table.Indices[0]
+	assert.Equal("shop/orders/indices/Name/a./a.b/shop___orders___x_", index.Path("a.b", "x_"))
+	entry, err := index.EntryFromPath("shop/orders/indices/Name/50/50%25/shop___orders___50%25")
+	assert.NoError(err)
+	assert.Equal("50%25", entry.Id)
+
+	escapedTable := table.WithEscapedPaths()
+	escaped, _ := escapedTable.GetIndex("Name")
+	assert.Equal("shop/orders/indices/Name/a./a..b/shop___orders___x%5F", escaped.Path("a.b", "x_"))
+	assert.Equal("shop/orders/indices/Name/a./a/b/shop___orders___x_", escaped.UnescapedPath(escaped.Path("a/b", "x_")))
+}
+
+func TestIndex_PathRoundTripsSeparatorCharacters(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("shop", "orders", []string{"Name"}).WithEscapedPaths()
+	index := table.Indices[0]
+
+	for _, id := range []string{"a___b", "a/b", "_a_", "50%"} {
+		path := index.Path("x/y___z", id)
+		assert.Len(strings.Split(path, "/"), 7, path)
+		entry, err := index.EntryFromPath(path)
+		assert.NoError(err)
+		assert.Equal(DatabaseTableIdTuple{Database: "shop", Table: "orders", Id: id}, *entry)
+	}
+	assert.NotEqual(index.PathNoId("a/b"), index.PathNoId("a.~b"))
+	assert.NotEqual(index.PathNoId("a"), index.PathNoId("_a"))
+}
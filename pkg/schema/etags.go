@@ -0,0 +1,23 @@
+package schema
+
+// returns a copy of the table in which the entries of the index of the field carry the ETag of their record, see RECORD_ETAG,
+// adding the index if the field is not yet indexed, so that the ETags of the records which a value selects can be found without
+// reading them, see minio.FindByIndexedFieldEqualsContainer.FindETags. it costs a request per entry whenever a record is updated,
+// since entries which are kept are rewritten with the new ETag. it applies to all revisions of the index. entries which exist
+// when it is enabled carry no ETag, or a stale one, until their records are next written, or the index is rebuilt.
+func (t Table) WithRecordETags(field string) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].RecordETags = true
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, RecordETags: true})
+	}
+	t.Indices = indices
+	return t
+}
@@ -0,0 +1,22 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable_WithRecordETags(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Email"})
+	withETags := table.WithRecordETags("Email").WithRecordETags("Phone")
+	assert.False(table.Indices[0].RecordETags, "the original table is unchanged")
+	assert.Len(withETags.Indices, 2)
+	assert.True(withETags.Indices[0].RecordETags)
+	assert.True(withETags.Indices[1].RecordETags)
+	assert.Equal("Phone", withETags.Indices[1].Field)
+
+	resolved, err := withETags.Definition().Table()
+	assert.NoError(err)
+	assert.True(resolved.Indices[0].RecordETags)
+}
@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the number of leading characters of values that the folders of their entries are fanned out by, unless the index says otherwise
+const DEFAULT_FAN_OUT_LENGTH = 2
+
+// the character that values which are shorter than the fan out are padded with, unless the index says otherwise
+const DEFAULT_FAN_OUT_PADDING = "_"
+
+// the length of the fan out of indices whose entries are not fanned out at all
+const NO_FAN_OUT = -1
+
+// how the folders of the values of an index are sharded by the default layout, i.e. `<prefix>/<value>`, where the prefix is the
+// first Length characters of the value, e.g. `jo/john`, so that a bucket which spreads its load by prefix spreads that of the
+// index too. the zero value is how indices have always been fanned out. see WithFanOut
+type IndexFanOut struct {
+	// the number of leading characters of the value in the prefix, zero for DEFAULT_FAN_OUT_LENGTH, or NO_FAN_OUT, in which case
+	// the folders of values are directly in the folder of the index
+	Length int `json:"length"`
+	// the character that values which are shorter than Length are padded with at the front, or empty for DEFAULT_FAN_OUT_PADDING
+	Padding string `json:"padding"`
+}
+
+// returns a copy of the table in which the entries of the index of the field are fanned out as given, adding the index if the
+// field is not yet indexed, e.g. by more characters for fields with many distinct values, or not at all for those with only a
+// few. it applies to all revisions of the index. changing the fan out of an index which has entries requires a new revision,
+// since the paths of its entries change. time indices are not fanned out, and layouts other than the default may ignore it.
+// panics if the fan out is invalid, since tables are declared by code.
+func (t Table) WithFanOut(field string, fanOut IndexFanOut) Table {
+	if fanOut.Length < NO_FAN_OUT {
+		panic(fmt.Sprintf("ADB-0145 invalid length %d of the fan out of index %s", fanOut.Length, field))
+	}
+	if fanOut.Padding != "" && (len(fanOut.Padding) != 1 || strings.ContainsAny(fanOut.Padding, "/%") || fanOut.Padding[0] < ' ' || fanOut.Padding[0] > '~') {
+		panic(fmt.Sprintf("ADB-0145 invalid padding %q of the fan out of index %s, which must be a single printable ASCII character other than / and %%", fanOut.Padding, field))
+	}
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].FanOut = fanOut
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, FanOut: fanOut})
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns the folder of the value, laid out according to the fan out
+func (f IndexFanOut) folder(value string) string {
+	length := f.Length
+	if length == NO_FAN_OUT {
+		return value
+	}
+	if length == 0 {
+		length = DEFAULT_FAN_OUT_LENGTH
+	}
+	padding := f.Padding
+	if padding == "" {
+		padding = DEFAULT_FAN_OUT_PADDING
+	}
+	if len(value) < length {
+		value = strings.Repeat(padding, length-len(value)) + value
+	}
+	return fmt.Sprintf("%s/%s", value[:length], value)
+}
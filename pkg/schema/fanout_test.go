@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexFanOut_DefaultIsTwoCharacters(t *testing.T) {
+	assert := assert.New(t)
+	index := NewTable("db", "account", []string{"Email"}).Indices[0]
+
+	assert.Equal("db/account/indices/Email/jo/john", index.PathNoId("john"))
+	assert.Equal("db/account/indices/Email/_j/_j", index.PathNoId("j"))
+}
+
+func TestIndexFanOut_Configurable(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Email", "Status"}).
+		WithFanOut("Email", IndexFanOut{Length: 4, Padding: "-"}).
+		WithFanOut("Status", IndexFanOut{Length: NO_FAN_OUT}).
+		WithFanOut("Country", IndexFanOut{Length: 1})
+	assert.Len(table.Indices, 3)
+	email, _ := table.GetIndex("Email")
+	status, _ := table.GetIndex("Status")
+	country, _ := table.GetIndex("Country")
+
+	assert.Equal("db/account/indices/Email/john/johnny", email.PathNoId("johnny"))
+	assert.Equal("db/account/indices/Email/--jo/--jo", email.PathNoId("jo"))
+	assert.Equal("db/account/indices/Status/active", status.PathNoId("active"))
+	assert.Equal("db/account/indices/Status/a", status.PathNoId("a"))
+	assert.Equal("db/account/indices/Country/c/ch", country.PathNoId("CH"))
+
+	entry, err := email.EntryFromPath(email.Path("johnny", "1"))
+	assert.NoError(err)
+	assert.Equal("1", entry.Id)
+}
+
+func TestIndexFanOut_InvalidPanics(t *testing.T) {
+	table := NewTable("db", "account", []string{"Email"})
+	assert.Panics(t, func() { table.WithFanOut("Email", IndexFanOut{Length: -2}) })
+	assert.Panics(t, func() { table.WithFanOut("Email", IndexFanOut{Padding: "/"}) })
+	assert.Panics(t, func() { table.WithFanOut("Email", IndexFanOut{Padding: "ab"}) })
+}
@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+)
+
+// what happens to the entities which reference an entity that is deleted, see Table.WithForeignKey
+type OnDelete string
+
+const (
+	// the delete fails with a ReferencedError, while any entity references the entity
+	ON_DELETE_RESTRICT OnDelete = "restrict"
+	// the entities which reference the entity are deleted along with it, as are those which reference them in turn
+	ON_DELETE_CASCADE OnDelete = "cascade"
+	// the field of the entities which reference the entity is set to null, i.e. an empty string or a nil pointer
+	ON_DELETE_SET_NULL OnDelete = "setNull"
+)
+
+// declares that a field of the entities of a table holds the id of an entity in another table, e.g. that the CustomerId of an
+// order is that of a customer
+type ForeignKey struct {
+	Field string `json:"field"`
+	// the table which is referenced
+	Database Database `json:"database"`
+	Table    string   `json:"table"`
+	OnDelete OnDelete `json:"onDelete"`
+}
+
+// true if the foreign key references the table
+func (f ForeignKey) References(table Table) bool {
+	return f.Database == table.Database && f.Table == table.Name
+}
+
+// returns a copy of the table in which the field references the ids of the entities of the other table, so that deleting one of
+// those entities does what onDelete says with the entities of this table which reference it, within the same transaction. the
+// field is indexed, adding the index if it is not yet, since the entities which reference an entity are found with it. the
+// references are only checked when entities are deleted, not when entities of this table are written, and only by repositories
+// which know about the foreign key, see minio.EnableForeignKeys. panics if onDelete is not one of the ON_DELETE constants, or
+// the field already references a table, since tables are declared by code.
+func (t Table) WithForeignKey(field string, references Table, onDelete OnDelete) Table {
+	if !slices.Contains([]OnDelete{ON_DELETE_RESTRICT, ON_DELETE_CASCADE, ON_DELETE_SET_NULL}, onDelete) {
+		panic(fmt.Sprintf("ADB-0159 invalid action %q when entities referenced by field %s are deleted", onDelete, field))
+	}
+	if slices.ContainsFunc(t.ForeignKeys, func(f ForeignKey) bool { return f.Field == field }) {
+		panic(fmt.Sprintf("ADB-0234 the field %s of table %s/%s already references a table", field, t.Database, t.Name))
+	}
+	foreignKey := ForeignKey{Field: field, Database: references.Database, Table: references.Name, OnDelete: onDelete}
+	t.ForeignKeys = append(slices.Clone(t.ForeignKeys), foreignKey)
+	if !slices.ContainsFunc(t.Indices, func(index Index) bool { return index.Field == field }) {
+		indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+		copy(indices, t.Indices)
+		t.Indices = append(indices, Index{Table: t, Field: field})
+	}
+	return t
+}
+
+// marks the object at the path as deleted by the transaction, before the entities which reference it are handled, so that those
+// which reference it in turn, e.g. in a cycle of foreign keys, or by two paths, are not deleted or updated again when foreign keys
+// cascade. Returns: false if it already was
+func (t *Transaction) MarkDeleting(path string) bool {
+	if t.deleting[path] {
+		return false
+	}
+	if t.deleting == nil {
+		t.deleting = make(map[string]bool)
+	}
+	t.deleting[path] = true
+	return true
+}
+
+// removes the mark of MarkDeleting, e.g. if the delete failed before its steps were added
+func (t *Transaction) UnmarkDeleting(path string) {
+	delete(t.deleting, path)
+}
+
+// true if the transaction deletes, or is deleting, the object at the path. see MarkDeleting
+func (t *Transaction) IsDeleting(path string) bool {
+	return t.deleting[path]
+}
@@ -0,0 +1,57 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithForeignKey_IndexesTheField(t *testing.T) {
+	assert := assert.New(t)
+	customers := NewTable(NewDatabase("shop"), "customers", []string{"Name"})
+	orders := NewTable(NewDatabase("shop"), "orders", []string{"Number"})
+
+	referencing := orders.WithForeignKey("CustomerId", customers, ON_DELETE_CASCADE)
+	assert.Equal([]ForeignKey{{Field: "CustomerId", Database: "shop", Table: "customers", OnDelete: ON_DELETE_CASCADE}}, referencing.ForeignKeys)
+	assert.True(referencing.ForeignKeys[0].References(customers))
+	assert.False(referencing.ForeignKeys[0].References(orders))
+	if assert.Len(referencing.Indices, 2) {
+		assert.Equal("CustomerId", referencing.Indices[1].Field)
+	}
+	assert.Empty(orders.ForeignKeys)
+	assert.Len(orders.Indices, 1)
+
+	// an index that exists is kept
+	indexed := NewTable(NewDatabase("shop"), "orders", []string{"CustomerId"}).WithForeignKey("CustomerId", customers, ON_DELETE_SET_NULL)
+	assert.Len(indexed.Indices, 1)
+
+	definition := referencing.Definition()
+	assert.Equal(referencing.ForeignKeys, definition.ForeignKeys)
+	resolved, err := definition.Table()
+	assert.NoError(err)
+	assert.Equal(referencing.ForeignKeys, resolved.ForeignKeys)
+}
+
+func TestWithForeignKey_PanicsIfInvalid(t *testing.T) {
+	customers := NewTable(NewDatabase("shop"), "customers", []string{"Name"})
+	orders := NewTable(NewDatabase("shop"), "orders", []string{"Number"})
+	assert.PanicsWithValue(t, `ADB-0159 invalid action "ignore" when entities referenced by field CustomerId are deleted`, func() {
+		orders.WithForeignKey("CustomerId", customers, "ignore")
+	})
+	assert.Panics(t, func() {
+		orders.WithForeignKey("CustomerId", customers, ON_DELETE_RESTRICT).WithForeignKey("CustomerId", customers, ON_DELETE_CASCADE)
+	})
+}
+
+func TestTransaction_MarkDeleting(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	assert.False(tx.IsDeleting("db/issue/data/1.json"))
+	assert.True(tx.MarkDeleting("db/issue/data/1.json"))
+	assert.False(tx.MarkDeleting("db/issue/data/1.json"))
+	assert.True(tx.IsDeleting("db/issue/data/1.json"))
+	assert.False(tx.IsDeleting("db/issue/data/2.json"))
+	tx.UnmarkDeleting("db/issue/data/1.json")
+	assert.False(tx.IsDeleting("db/issue/data/1.json"))
+}
@@ -0,0 +1,20 @@
+package schema
+
+// the newest version of the format of the objects that this version of the library reads and writes, i.e. data, index entries,
+// reverse indices, journal entries and table definitions. it is incremented whenever a change to the format cannot be read
+// correctly by older versions, so that during a rolling upgrade, nodes which are not yet upgraded refuse to use objects written
+// by those that are, rather than silently misreading or overwriting them. objects are stamped with the oldest version which can
+// read them, so that changes which only affect some tables do not lock older nodes out of the others. objects written before
+// formats were versioned have version 0, which is compatible with version 1.
+const FORMAT_VERSION = ESCAPED_PATHS_FORMAT_VERSION
+
+// the version of the format of the contents of objects, which they are stamped with
+const OBJECT_FORMAT_VERSION = 1
+
+// the version of the format of the definitions of tables whose index entries are stored at escaped paths, see
+// Table.WithEscapedPaths, since older versions would look for their entries at unescaped paths
+const ESCAPED_PATHS_FORMAT_VERSION = 2
+
+// the user metadata of objects and index entries which contains the version of the format that they were written in.
+// minio doesn't support camel case
+const FORMAT_VERSION_KEY = "Format-Version"
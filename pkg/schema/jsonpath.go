@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the suffix of a segment of a JSON path whose value is an array, each element of which is evaluated further
+const JSON_PATH_EACH = "[]"
+
+// a segment of a JSON path, e.g. `tags[]` in `tags[].name`
+type JsonPathSegment struct {
+	// the key in the JSON object
+	Key string
+	// if set, the value is an array, and the rest of the path is evaluated for each of its elements
+	Each bool
+}
+
+// parses a path into the JSON of an entity, whose segments are keys separated by dots, e.g. `address.city`. keys whose value is an
+// array end with `[]`, e.g. `tags[].name`
+func ParseJsonPath(path string) ([]JsonPathSegment, error) {
+	segments := make([]JsonPathSegment, 0, 2)
+	for _, key := range strings.Split(path, ".") {
+		key, each := strings.CutSuffix(key, JSON_PATH_EACH)
+		if key == "" || strings.ContainsAny(key, "[]") {
+			return nil, fmt.Errorf("ADB-0134 invalid JSON path %s, whose segments must be keys, optionally followed by %s", path, JSON_PATH_EACH)
+		}
+		segments = append(segments, JsonPathSegment{Key: key, Each: each})
+	}
+	return segments, nil
+}
+
+// returns the values at the path in the document, i.e. JSON which is unmarshalled into `any`, in document order. keys which are
+// missing, and values which are not objects where the path continues, or not arrays where it has `[]`, have no values.
+func EvaluateJsonPath(segments []JsonPathSegment, document any) []any {
+	values := []any{document}
+	for _, segment := range segments {
+		next := make([]any, 0, len(values))
+		for _, value := range values {
+			object, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			value, ok := object[segment.Key]
+			if !ok {
+				continue
+			}
+			if !segment.Each {
+				next = append(next, value)
+			} else if elements, ok := value.([]any); ok {
+				next = append(next, elements...)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// returns a copy of the table with an index over the values at the JSON path in its entities, e.g. `address.city`, or `tags[].name`,
+// which has an entry for each of the values, rather than over a field of the struct, adding the index if it does not exist yet.
+// the keys are those of the JSON that entities are marshalled into. the values must be strings, numbers, booleans or null,
+// and can be indexed as numbers or times too, e.g. with WithNumericIndex(path). query the index using the path, just like a field
+// name. panics if the path is invalid, since tables are declared by code.
+func (t Table) WithJsonPathIndex(path string) Table {
+	if _, err := ParseJsonPath(path); err != nil {
+		panic(err.Error())
+	}
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == path {
+			indices[i].JsonPath = true
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: path, JsonPath: true})
+	}
+	t.Indices = indices
+	return t
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJsonPath(t *testing.T) {
+	assert := assert.New(t)
+	segments, err := ParseJsonPath("tags[].name")
+	assert.NoError(err)
+	assert.Equal([]JsonPathSegment{{Key: "tags", Each: true}, {Key: "name"}}, segments)
+
+	for _, invalid := range []string{"", "address.", ".city", "tags[0].name", "[]"} {
+		_, err = ParseJsonPath(invalid)
+		assert.ErrorContains(err, "ADB-0134", invalid)
+	}
+}
+
+func TestEvaluateJsonPath(t *testing.T) {
+	assert := assert.New(t)
+	var document any
+	assert.NoError(json.Unmarshal([]byte(`{
+		"address": {"city": "Bern", "zip": 3000},
+		"tags": [{"name": "a"}, {"name": "b"}, {"other": "c"}, "d"],
+		"notAnArray": {"name": "e"}
+	}`), &document))
+
+	evaluate := func(path string) []any {
+		segments, err := ParseJsonPath(path)
+		assert.NoError(err)
+		return EvaluateJsonPath(segments, document)
+	}
+	assert.Equal([]any{"Bern"}, evaluate("address.city"))
+	assert.Equal([]any{float64(3000)}, evaluate("address.zip"))
+	assert.Equal([]any{"a", "b"}, evaluate("tags[].name"))
+	assert.Empty(evaluate("address.street"))
+	assert.Empty(evaluate("address.city.name"))
+	assert.Empty(evaluate("notAnArray[].name"))
+}
+
+func TestTable_WithJsonPathIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "person", []string{}).WithJsonPathIndex("address.zip").WithNumericIndex("address.zip")
+	assert.Len(table.Indices, 1)
+	assert.True(table.Indices[0].JsonPath)
+	assert.True(table.Indices[0].Numeric)
+	assert.Equal("db/person/indices/tags[].name/ab/abc/db___person___1", table.WithJsonPathIndex("tags[].name").Indices[1].Path("abc", "1"))
+
+	assert.Panics(func() { table.WithJsonPathIndex("tags[0]") })
+}
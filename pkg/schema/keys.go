@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// separates the parts of a composite key in the id that encodes it, see EncodeCompositeKey
+const COMPOSITE_KEY_SEPARATOR = ":"
+
+// returns a copy of the table whose entities are identified by the values of the fields, in that order, e.g. `TenantId` and
+// `OrderId`, rather than by their field Id, which they then need not have. the id of an entity, which Path, the entries of its
+// indices and queries by id use, is the canonical encoding of the values, see EncodeCompositeKey, so that the objects of a
+// tenant are listed together. the fields are strings, types whose kind is string, or integers, and none of them may be empty.
+// declare the key before the projections of indices, which contain the key. panics if there are fewer than two fields, or a
+// field is empty or declared twice, since tables are declared by code.
+func (t Table) WithCompositeKey(fields ...string) Table {
+	if len(fields) < 2 {
+		panic(fmt.Sprintf("ADB-0169 the composite key of table %s needs at least two fields", t.Name))
+	}
+	for i, field := range fields {
+		if field == "" || slices.Contains(fields[:i], field) {
+			panic(fmt.Sprintf("ADB-0262 the field %q of the composite key of table %s is empty or declared twice", field, t.Name))
+		}
+	}
+	for _, index := range t.Indices {
+		if index.Covering() {
+			panic(fmt.Sprintf("ADB-0263 the composite key of table %s is declared after the projection of index %s, which contains the key", t.Name, index.Field))
+		}
+	}
+	t.Key = fields
+	indices := make([]Index, len(t.Indices))
+	for i, index := range t.Indices {
+		index.Table.Key = fields
+		indices[i] = index
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns the fields which identify the entities of the table, i.e. those of its composite key, or Id
+func (t *Table) KeyFields() []string {
+	if len(t.Key) > 0 {
+		return t.Key
+	}
+	return []string{"Id"}
+}
+
+// returns the id of the entity of a table with a composite key whose fields have the values, in the order of the key, e.g.
+// `acme:42`. the characters `%`, `/` and `:` of the values are escaped like EscapePathSegment does, so that the id can be
+// decoded, and is a valid name of an object. fails with ADB-0264 if a value is empty.
+func EncodeCompositeKey(values ...string) (string, error) {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		if value == "" {
+			return "", fmt.Errorf("ADB-0264 the value %d of the composite key is empty", i)
+		}
+		var b strings.Builder
+		for j := 0; j < len(value); j++ {
+			if c := value[j]; c == '%' || c == '/' || c == COMPOSITE_KEY_SEPARATOR[0] {
+				fmt.Fprintf(&b, "%%%02X", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+		escaped[i] = b.String()
+	}
+	return strings.Join(escaped, COMPOSITE_KEY_SEPARATOR), nil
+}
+
+// the inverse of EncodeCompositeKey, returning the values of the key that the id encodes
+func DecodeCompositeKey(id string) ([]string, error) {
+	values := strings.Split(id, COMPOSITE_KEY_SEPARATOR)
+	for i, value := range values {
+		if value == "" {
+			return nil, fmt.Errorf("ADB-0265 %q is not a composite key, since its value %d is empty", id, i)
+		}
+		values[i] = UnescapePathSegment(value)
+	}
+	return values, nil
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeCompositeKey_RoundTrips(t *testing.T) {
+	assert := assert.New(t)
+	for _, values := range [][]string{{"acme", "42"}, {"a:b", "c/d", "100%"}, {"x___y", "_"}} {
+		id, err := EncodeCompositeKey(values...)
+		assert.NoError(err)
+		assert.NotContains(id, "/")
+		decoded, err := DecodeCompositeKey(id)
+		assert.NoError(err)
+		assert.Equal(values, decoded)
+	}
+	id, _ := EncodeCompositeKey("acme", "42")
+	assert.Equal("acme:42", id)
+	escaped, _ := EncodeCompositeKey("a:b", "c")
+	assert.Equal("a%3Ab:c", escaped)
+
+	_, err := EncodeCompositeKey("acme", "")
+	assert.ErrorContains(err, "ADB-0264")
+	_, err = DecodeCompositeKey("acme::42")
+	assert.ErrorContains(err, "ADB-0265")
+}
+
+func TestTable_WithCompositeKey(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "order", []string{"Status"}).WithCompositeKey("TenantId", "OrderId")
+	assert.Equal([]string{"TenantId", "OrderId"}, table.KeyFields())
+	assert.Equal([]string{"TenantId", "OrderId"}, table.Indices[0].Table.Key)
+	account := NewTable("db", "account", nil)
+	assert.Equal([]string{"Id"}, account.KeyFields())
+	assert.Equal("db/order/data/acme:42.json", table.Path("acme:42"))
+	assert.Equal([]string{"TenantId", "OrderId", "Total"}, table.WithProjection("Status", "Total").Indices[0].Projection)
+
+	// the id survives the name of an index entry
+	index := table.Indices[0]
+	entry, err := index.EntryFromPath(index.Path("open", "a%3Ab:42"))
+	assert.NoError(err)
+	assert.Equal("a%3Ab:42", entry.Id)
+
+	resolved, err := table.Definition().Table()
+	assert.NoError(err)
+	assert.Equal(table.Key, resolved.Key)
+
+	assert.Panics(func() { NewTable("db", "order", nil).WithCompositeKey("TenantId") })
+	assert.Panics(func() { NewTable("db", "order", nil).WithCompositeKey("TenantId", "TenantId") })
+	assert.Panics(func() { NewTable("db", "order", nil).WithProjection("Status").WithCompositeKey("TenantId", "OrderId") })
+}
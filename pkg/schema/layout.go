@@ -0,0 +1,106 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// decides the paths of the objects of a table and of the entries of its indices, so that deployments with existing naming
+// conventions, or limits on the length of keys, can adapt them. everything else that the repository stores about a table, e.g.
+// the reverse indices of its objects, the claims of its unique indices and its generation, stays below `<database>/<table>/`.
+// implementations can embed DefaultPathLayout and only override what differs. see WithPathLayout
+type PathLayout interface {
+	// full path to the object with the given id
+	DataPath(table *Table, id string) string
+
+	// path to the folder containing all objects of the table, with a trailing slash
+	DataPathPrefix(table *Table) string
+
+	// returns the id of the object at the path, if it is the path of an object of the table
+	IdFromDataPath(table *Table, path string) (string, bool)
+
+	// path to the folder containing the entries of a value, relative to the folder of the index, e.g. `jo/john`. the value has been
+	// collated and escaped already, if the table escapes paths, see EscapePathValue. the folders must sort like the values, since ranges are listed in order. time indices are
+	// not laid out, since their folders are their periods.
+	IndexValueFolder(index *Index, value string) string
+
+	// the name of the entry of the entity with the given id, in the folder of its value
+	IndexEntryName(index *Index, id string) string
+
+	// parses the name of an entry
+	ParseIndexEntryName(index *Index, name string) (*DatabaseTableIdTuple, error)
+}
+
+// the layout of tables which have none, i.e. objects are stored as `<database>/<table>/data/<id>.json`, or where their path
+// template says, and the entries of indices are fanned out by the first characters of their values, see IndexFanOut, and named
+// after the database, table and id of the entity, separated by "___", so that a caller doesn't need to read the contents in
+// order to identify them. each of them is escaped if the table escapes paths, see EscapePathSegment, so that they can contain
+// any characters.
+type DefaultPathLayout struct{}
+
+func (DefaultPathLayout) DataPath(table *Table, id string) string {
+	if table.PathTemplate != "" {
+		return strings.Replace(table.PathTemplate, PATH_TEMPLATE_ID, id, 1)
+	}
+	return fmt.Sprintf("%s/%s.json", table.pathPrefix(), id)
+}
+
+func (DefaultPathLayout) DataPathPrefix(table *Table) string {
+	if table.PathTemplate != "" {
+		prefix, _, _ := strings.Cut(table.PathTemplate, PATH_TEMPLATE_ID)
+		return prefix
+	}
+	return table.pathPrefix() + "/"
+}
+
+func (l DefaultPathLayout) IdFromDataPath(table *Table, path string) (string, bool) {
+	suffix := ".json"
+	if table.PathTemplate != "" {
+		_, suffix, _ = strings.Cut(table.PathTemplate, PATH_TEMPLATE_ID)
+	}
+	id, found := strings.CutPrefix(path, l.DataPathPrefix(table))
+	if !found {
+		return "", false
+	}
+	id, found = strings.CutSuffix(id, suffix)
+	return id, found && id != "" && !strings.Contains(id, "/")
+}
+
+func (DefaultPathLayout) IndexValueFolder(index *Index, value string) string {
+	return index.FanOut.folder(value)
+}
+
+func (DefaultPathLayout) IndexEntryName(index *Index, id string) string {
+	if !index.Table.EscapedPaths {
+		return fmt.Sprintf("%s___%s___%s", index.Table.Database, index.Table.Name, id)
+	}
+	return fmt.Sprintf("%s___%s___%s", EscapePathSegment(string(index.Table.Database)), EscapePathSegment(index.Table.Name), EscapePathSegment(id))
+}
+
+func (DefaultPathLayout) ParseIndexEntryName(index *Index, name string) (*DatabaseTableIdTuple, error) {
+	tuple, err := DatabaseTableIdTupleFromPath(name)
+	if err != nil || !index.Table.EscapedPaths {
+		return tuple, err
+	}
+	return &DatabaseTableIdTuple{Database: UnescapePathSegment(tuple.Database), Table: UnescapePathSegment(tuple.Table), Id: UnescapePathSegment(tuple.Id)}, nil
+}
+
+// returns a copy of the table whose objects and index entries are stored where the layout says. like tables with a path template,
+// the table must be registered with RegisterMappedTable, so that the paths of its objects can be attributed to it. changing the
+// layout of a table which has objects requires them to be moved, and its indices to be rebuilt.
+func (t Table) WithPathLayout(layout PathLayout) Table {
+	t.Layout = layout
+	return t.withIndicesOfItself()
+}
+
+func (t *Table) layout() PathLayout {
+	if t.Layout != nil {
+		return t.Layout
+	}
+	return DefaultPathLayout{}
+}
+
+// returns the database, table and id of the entity that the index entry at the path belongs to
+func (i *Index) EntryFromPath(path string) (*DatabaseTableIdTuple, error) {
+	return i.Table.layout().ParseIndexEntryName(i, path[strings.LastIndex(path, "/")+1:])
+}
@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stores objects as `<database>-<table>/<id>`, and names index entries after the id only, fanned out by one character, so that keys
+// are short
+type shortPathLayout struct {
+	DefaultPathLayout
+}
+
+func (shortPathLayout) DataPath(table *Table, id string) string {
+	return fmt.Sprintf("%s-%s/%s", table.Database, table.Name, id)
+}
+
+func (l shortPathLayout) DataPathPrefix(table *Table) string {
+	return fmt.Sprintf("%s-%s/", table.Database, table.Name)
+}
+
+func (l shortPathLayout) IdFromDataPath(table *Table, path string) (string, bool) {
+	id, found := strings.CutPrefix(path, l.DataPathPrefix(table))
+	return id, found && id != "" && !strings.Contains(id, "/")
+}
+
+func (shortPathLayout) IndexValueFolder(index *Index, value string) string {
+	return fmt.Sprintf("%s/%s", value[:1], value)
+}
+
+func (shortPathLayout) IndexEntryName(index *Index, id string) string {
+	return id
+}
+
+func (shortPathLayout) ParseIndexEntryName(index *Index, name string) (*DatabaseTableIdTuple, error) {
+	return &DatabaseTableIdTuple{Database: string(index.Table.Database), Table: index.Table.Name, Id: name}, nil
+}
+
+func TestTable_WithPathLayout(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("shop", "orders", []string{"Status"}).WithPathLayout(shortPathLayout{})
+	index := table.Indices[0]
+	assert.ErrorContains(CheckMappedTableRegistered(table), "ADB-0188")
+	defer RegisterMappedTable(table)()
+	assert.NoError(CheckMappedTableRegistered(table))
+
+	assert.Equal("shop-orders/42", table.Path("42"))
+	assert.Equal("shop-orders/", table.DataPathPrefix())
+	// what the repository stores about the table stays in the usual place
+	assert.Equal("shop/orders/data/42.indices", table.IndicesPath("42"))
+	assert.Equal("shop/orders/generation", table.GenerationPath())
+	assert.True(table.IsAdopted())
+
+	assert.Equal("shop/orders/indices/Status/o/open/42", index.Path("Open", "42"))
+	assert.Equal("shop/orders/indices/Status/~null/42", index.NullPath("42"))
+	assert.Equal("shop/orders/unique/Status/o/open", index.UniquePath("Open"))
+	coordinates, err := index.EntryFromPath(index.Path("Open", "42"))
+	assert.NoError(err)
+	assert.Equal(DatabaseTableIdTuple{Database: "shop", Table: "orders", Id: "42"}, *coordinates)
+
+	coordinates, err = DatabaseTableIdTupleFromDataPath("shop-orders/42")
+	assert.NoError(err)
+	assert.Equal(DatabaseTableIdTuple{Database: "shop", Table: "orders", Id: "42"}, *coordinates)
+	generationPath, err := GenerationPathFromPath("shop-orders/42")
+	assert.NoError(err)
+	assert.Equal("shop/orders/generation", generationPath)
+
+	// indices added later use the layout too
+	table = table.WithUniqueIndex("Number")
+	assert.Equal("shop/orders/indices/Number/1/123/42", table.Indices[1].Path("123", "42"))
+}
+
+func TestDefaultPathLayout_IsUnchanged(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name"})
+	assert.False(table.IsAdopted())
+	assert.Equal("db/account/data/1.json", table.Path("1"))
+	assert.Equal("db/account/indices/Name/_j/_j/db___account___1", table.Indices[0].Path("j", "1"))
+	coordinates, err := table.Indices[0].EntryFromPath("db/account/indices/Name/jo/john/db___account___1")
+	assert.NoError(err)
+	assert.Equal(DatabaseTableIdTuple{Database: "db", Table: "account", Id: "1"}, *coordinates)
+}
@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// the scheme of links to objects in buckets of the object store, i.e. `s3://<bucket>/<key>`
+const S3_SCHEME = "s3"
+
+var sha256Pattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// a reference from a record to an object which the store does not own, e.g. in another bucket or at a public URL, so that
+// it can be catalogued. if SHA256 is set, the link is pinned to that content, so that changes to the object are detected
+// as drift when the links are verified.
+type ExternalLink struct {
+	// either `s3://<bucket>/<key>`, or an http or https URL
+	URI string `json:"uri"`
+	// the lower case hex encoded SHA-256 checksum of the content, or empty if it is not pinned
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// where an external link points to
+type ExternalObject struct {
+	// set if it is an object in a bucket
+	Bucket string
+	Key    string
+	// set if it is at an http or https URL
+	URL string
+}
+
+// returns a link to the URI, pinned to the checksum unless it is empty
+func NewExternalLink(uri string, sha256 string) (ExternalLink, error) {
+	link := ExternalLink{URI: uri, SHA256: strings.ToLower(sha256)}
+	if _, err := link.Object(); err != nil {
+		return link, err
+	}
+	if link.SHA256 != "" && !sha256Pattern.MatchString(link.SHA256) {
+		return link, fmt.Errorf("ADB-0143 the checksum of %s is not a hex encoded SHA-256 checksum: %s", uri, sha256)
+	}
+	return link, nil
+}
+
+// true if the link is pinned to a checksum
+func (l ExternalLink) Pinned() bool {
+	return l.SHA256 != ""
+}
+
+// returns where the link points to
+func (l ExternalLink) Object() (ExternalObject, error) {
+	u, err := url.Parse(l.URI)
+	if err != nil {
+		return ExternalObject{}, fmt.Errorf("ADB-0212 invalid external link %s: %w", l.URI, err)
+	}
+	switch u.Scheme {
+	case S3_SCHEME:
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return ExternalObject{}, fmt.Errorf("ADB-0213 invalid external link %s, which must be s3://<bucket>/<key>", l.URI)
+		}
+		return ExternalObject{Bucket: u.Host, Key: key}, nil
+	case "http", "https":
+		if u.Host == "" {
+			return ExternalObject{}, fmt.Errorf("ADB-0214 invalid external link %s, which has no host", l.URI)
+		}
+		return ExternalObject{URL: l.URI}, nil
+	default:
+		return ExternalObject{}, fmt.Errorf("ADB-0215 unsupported scheme of external link %s, which must be s3, http or https", l.URI)
+	}
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternalLink_Object(t *testing.T) {
+	assert := assert.New(t)
+
+	object, err := ExternalLink{URI: "s3://assets/images/logo.png"}.Object()
+	assert.NoError(err)
+	assert.Equal(ExternalObject{Bucket: "assets", Key: "images/logo.png"}, object)
+
+	object, err = ExternalLink{URI: "https://example.com/logo.png?v=2"}.Object()
+	assert.NoError(err)
+	assert.Equal(ExternalObject{URL: "https://example.com/logo.png?v=2"}, object)
+
+	for _, uri := range []string{"s3://assets", "s3:///logo.png", "ftp://example.com/logo.png", "https:///logo.png", "logo.png"} {
+		_, err := ExternalLink{URI: uri}.Object()
+		assert.Error(err, uri)
+	}
+}
+
+func TestExternalLink_NewExternalLink(t *testing.T) {
+	assert := assert.New(t)
+	checksum := strings.Repeat("AB", 32)
+
+	link, err := NewExternalLink("s3://assets/logo.png", checksum)
+	assert.NoError(err)
+	assert.True(link.Pinned())
+	assert.Equal(strings.ToLower(checksum), link.SHA256)
+
+	link, err = NewExternalLink("s3://assets/logo.png", "")
+	assert.NoError(err)
+	assert.False(link.Pinned())
+
+	_, err = NewExternalLink("s3://assets/logo.png", "abc")
+	assert.Error(err)
+	_, err = NewExternalLink("file:///logo.png", "")
+	assert.Error(err)
+}
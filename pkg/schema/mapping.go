@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// the placeholder for the id of an object in a path template. see WithPathTemplate
+const PATH_TEMPLATE_ID = "{id}"
+
+var (
+	mappedTablesMu sync.Mutex
+	// tables whose objects are stored in a foreign layout, so that the table that an object belongs to can be found from its path
+	mappedTables []Table
+)
+
+// returns a copy of the table whose objects are stored at the paths given by the template, rather than in the usual `data`
+// folder, so that an existing layout can be managed without moving its objects, e.g. `crm/customers/{id}.json`.
+// the template contains the folder of the objects, then the id, which cannot contain a slash, and optionally more, e.g.
+// `{id}/profile.json`. everything else that the repository stores about the table, e.g. its indices, is stored in the usual place.
+// objects which exist already have no index entries, until BackfillIndex is run for each index.
+// the table must be registered with RegisterMappedTable before it is written to, so that the paths of its objects can be attributed
+// to it, e.g. in change logs. panics if the template is invalid, since tables are declared by code.
+func (t Table) WithPathTemplate(template string) Table {
+	prefix, suffix, found := strings.Cut(template, PATH_TEMPLATE_ID)
+	if !found || strings.Contains(suffix, PATH_TEMPLATE_ID) || (prefix != "" && !strings.HasSuffix(prefix, "/")) {
+		panic(fmt.Sprintf("ADB-0129 invalid path template %s, which must contain %s exactly once, directly after a slash", template, PATH_TEMPLATE_ID))
+	}
+	t.PathTemplate = template
+	return t.withIndicesOfItself()
+}
+
+// updates the indices to refer to the table, so that their paths are those of its layout
+func (t Table) withIndicesOfItself() Table {
+	indices := make([]Index, len(t.Indices))
+	for i, index := range t.Indices {
+		index.Table = t
+		indices[i] = index
+	}
+	t.Indices = indices
+	return t
+}
+
+// registers the table with a path template or layout, so that the paths of its objects can be attributed to it, e.g. in change
+// logs, journals and when the generation of the table is bumped. a table registered before with the same database and name is
+// replaced. returns a function which unregisters it. panics if the table has neither, since tables are declared by code.
+func RegisterMappedTable(table Table) func() {
+	if !table.IsAdopted() {
+		panic(fmt.Sprintf("ADB-0187 table %s/%s cannot be registered as a mapped table, since it has neither a path template nor a layout", table.Database, table.Name))
+	}
+	mappedTablesMu.Lock()
+	defer mappedTablesMu.Unlock()
+	replaced := false
+	for i, mapped := range mappedTables {
+		if mapped.Database == table.Database && mapped.Name == table.Name {
+			mappedTables[i] = table
+			replaced = true
+		}
+	}
+	if !replaced {
+		mappedTables = append(mappedTables, table)
+	}
+	return func() {
+		mappedTablesMu.Lock()
+		defer mappedTablesMu.Unlock()
+		mappedTables = slices.DeleteFunc(mappedTables, func(mapped Table) bool {
+			return mapped.Database == table.Database && mapped.Name == table.Name
+		})
+	}
+}
+
+// returns an error if the table has a path template or layout, but was not registered with it, see RegisterMappedTable, since
+// the paths of the objects that it writes could not be attributed to it
+func CheckMappedTableRegistered(table Table) error {
+	if !table.IsAdopted() {
+		return nil
+	}
+	mappedTablesMu.Lock()
+	defer mappedTablesMu.Unlock()
+	for _, mapped := range mappedTables {
+		if mapped.Database == table.Database && mapped.Name == table.Name && mapped.PathTemplate == table.PathTemplate && reflect.DeepEqual(mapped.Layout, table.Layout) {
+			return nil
+		}
+	}
+	return fmt.Errorf("ADB-0188 table %s/%s has a path template or layout, and must be registered with RegisterMappedTable before it is written to", table.Database, table.Name)
+}
+
+// true if the table has a path template or layout, and so may contain objects which were written before the repository managed
+// it, which have no reverse indices
+func (t *Table) IsAdopted() bool {
+	return t.PathTemplate != "" || t.Layout != nil
+}
+
+// returns the id of the object at the path, if the path is that of an object of the table
+func (t *Table) IdFromPath(path string) (string, bool) {
+	return t.layout().IdFromDataPath(t, path)
+}
+
+// returns the table with a path template or layout that the object at the path belongs to, and its id. see WithPathTemplate and WithPathLayout
+func MappedTableFromPath(path string) (*Table, string, bool) {
+	mappedTablesMu.Lock()
+	defer mappedTablesMu.Unlock()
+	for _, table := range mappedTables {
+		if id, ok := table.IdFromPath(path); ok {
+			return &table, id, true
+		}
+	}
+	return nil, "", false
+}
@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable_WithPathTemplate(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("legacy", "customers", []string{"Email"}).WithPathTemplate("crm/customers/{id}/profile.json")
+	_, err := DatabaseTableIdTupleFromDataPath("crm/customers/42/profile.json")
+	assert.Error(err) // not yet registered
+	unregister := RegisterMappedTable(table)
+	defer unregister()
+
+	assert.Equal("crm/customers/42/profile.json", table.Path("42"))
+	assert.Equal("crm/customers/", table.DataPathPrefix())
+	assert.Equal("legacy/customers/data/42.indices", table.IndicesPath("42"))
+	assert.Equal("crm/customers/{id}/profile.json", table.Indices[0].Table.PathTemplate)
+
+	id, ok := table.IdFromPath("crm/customers/42/profile.json")
+	assert.True(ok)
+	assert.Equal("42", id)
+	_, ok = table.IdFromPath("crm/customers/42/avatar.png")
+	assert.False(ok)
+	_, ok = table.IdFromPath("crm/customers/a/b/profile.json")
+	assert.False(ok)
+
+	coordinates, err := DatabaseTableIdTupleFromDataPath("crm/customers/42/profile.json")
+	assert.NoError(err)
+	assert.Equal(DatabaseTableIdTuple{Database: "legacy", Table: "customers", Id: "42"}, *coordinates)
+	generationPath, err := GenerationPathFromPath("crm/customers/42/profile.json")
+	assert.NoError(err)
+	assert.Equal("legacy/customers/generation", generationPath)
+
+	// native tables are unaffected
+	native := NewTable("db", "account", []string{})
+	id, ok = native.IdFromPath("db/account/data/1.json")
+	assert.True(ok)
+	assert.Equal("1", id)
+	_, ok = native.IdFromPath("db/account/data/1.indices")
+	assert.False(ok)
+	coordinates, err = DatabaseTableIdTupleFromDataPath("db/account/data/1.json")
+	assert.NoError(err)
+	assert.Equal("account", coordinates.Table)
+
+	assert.NoError(CheckMappedTableRegistered(native))
+	assert.PanicsWithValue("ADB-0187 table db/account cannot be registered as a mapped table, since it has neither a path template nor a layout", func() { RegisterMappedTable(native) })
+
+	// a table registered with a different template is not registered with this one
+	assert.NoError(CheckMappedTableRegistered(table))
+	assert.ErrorContains(CheckMappedTableRegistered(NewTable("legacy", "customers", []string{"Email"}).WithPathTemplate("crm/{id}.json")), "ADB-0188")
+	unregister()
+	_, _, ok = MappedTableFromPath("crm/customers/42/profile.json")
+	assert.False(ok)
+
+	assert.Panics(func() { native.WithPathTemplate("crm/customers.json") })
+	assert.Panics(func() { native.WithPathTemplate("crm/c{id}.json") })
+	assert.Panics(func() { native.WithPathTemplate("crm/{id}/{id}.json") })
+}
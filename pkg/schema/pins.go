@@ -0,0 +1,19 @@
+package schema
+
+import "fmt"
+
+// the folder under a table, containing the pins of its records
+const PINS_FOLDER = "pins"
+
+// returns a copy of the table whose records can be pinned, so that they are only updated or deleted by transactions which
+// override the pins, e.g. rows of configuration which bulk operations should never touch. updates and deletes of records of
+// such tables cost a request more, to find out whether the record is pinned. see Transaction.OverridePins
+func (t Table) WithPins() Table {
+	t.Pinnable = true
+	return t
+}
+
+// full path to the pin of the record with the given id
+func (t *Table) PinPath(id string) string {
+	return fmt.Sprintf("%s%s/%s.json", t.Folder(), PINS_FOLDER, EscapePathSegment(id))
+}
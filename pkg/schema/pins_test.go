@@ -0,0 +1,23 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPins_IsRegistered(t *testing.T) {
+	assert := assert.New(t)
+	settings := NewTable(NewDatabase("app"), "settings", []string{"Name"})
+	pinnable := settings.WithPins()
+
+	assert.False(settings.Pinnable)
+	assert.True(pinnable.Pinnable)
+	assert.Equal("app/settings/pins/a1.json", pinnable.PinPath("a1"))
+
+	definition := pinnable.Definition()
+	assert.True(definition.Pinnable)
+	resolved, err := definition.Table()
+	assert.NoError(err)
+	assert.True(resolved.Pinnable)
+}
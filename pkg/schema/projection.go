@@ -0,0 +1,36 @@
+package schema
+
+import "slices"
+
+// returns a copy of the table in which the index of the field is covering, adding the index if the field is not yet indexed,
+// i.e. its entries contain the given fields of the entity as JSON, along with its Id, or its composite key, so that e.g. lists can be shown from
+// the entries alone, rather than by reading each entity. the fields are names of fields of the struct. keep the projection
+// small, since it is written to each entry of the entity whenever the entity is updated. it applies to all revisions of the
+// index. entries which were written before, e.g. by a backfill, have no projection until their entity is updated.
+func (t Table) WithProjection(field string, fields ...string) Table {
+	projection := make([]string, 0, len(fields)+1)
+	for _, f := range append(slices.Clone(t.KeyFields()), fields...) {
+		if !slices.Contains(projection, f) {
+			projection = append(projection, f)
+		}
+	}
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Projection = projection
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Projection: projection})
+	}
+	t.Indices = indices
+	return t
+}
+
+// true if the entries of the index contain a projection of their entity. see WithProjection
+func (i *Index) Covering() bool {
+	return len(i.Projection) > 0
+}
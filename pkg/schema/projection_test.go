@@ -0,0 +1,22 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexProjection_WithProjection(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Email"})
+	assert.False(table.Indices[0].Covering())
+
+	covered := table.WithProjection("Email", "Name", "Email", "Name").WithProjection("Status", "Name")
+	assert.False(table.Indices[0].Covering(), "the original table is unchanged")
+	assert.Len(covered.Indices, 2)
+	email, _ := covered.GetIndex("Email")
+	status, _ := covered.GetIndex("Status")
+	assert.True(email.Covering())
+	assert.Equal([]string{"Id", "Name", "Email"}, email.Projection)
+	assert.Equal([]string{"Id", "Name"}, status.Projection)
+}
@@ -3,8 +3,28 @@ package schema
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
+// the folder under an index, in which records are indexed if the field is missing or empty
+const NULL_INDEX_FOLDER = "~null"
+
+// the folder under an index, in which records whose field was empty were indexed before they were indexed as null, i.e. the
+// folder of the empty value, padded to the fan out. values of tables with escaped paths cannot have it, see EscapePathValue.
+const LEGACY_NULL_INDEX_FOLDER = "__/__"
+
+// the folder under a table, containing the claims on the values of its unique indices
+const UNIQUE_FOLDER = "unique"
+
+// the folder containing the schema registry, i.e. the definitions of all tables
+const SCHEMA_ROOT = "schema/"
+
+// the folder containing pointers from logical table names to physical ones
+const ALIASES_ROOT = "aliases/"
+
+// the database containing tables used internally, e.g. for change log consumer offsets
+const SYSTEM_DATABASE Database = "_system"
+
 type Database string
 
 func NewDatabase(name string) Database {
@@ -15,22 +35,105 @@ type Table struct {
 	Database Database `json:"database"`
 	Name string `json:"name"`
 	Indices []Index `json:"indices"`
+
+	// optional; the tenant whose objects the table stores, or the default tenant. it is not registered. see WithTenant
+	Tenant Tenant `json:"tenant,omitempty"`
+
+	// optional; the fields whose values identify the entities, rather than their field Id. see WithCompositeKey
+	Key []string `json:"key"`
+
+	// if true, writes are only permitted by the process holding the table's lease, which serialises writers and so
+	// eliminates ETag conflicts, for workloads that prefer that over optimistic retries
+	SingleWriter bool `json:"singleWriter"`
+
+	// if true, records can be pinned, so that they are protected from being updated or deleted by mistake. see WithPins
+	Pinnable bool `json:"pinnable"`
+
+	// semantic version of the table definition, e.g. "1.2.0". empty means DEFAULT_SCHEMA_VERSION.
+	// bump the minor version when adding indices and the major version when removing them.
+	Version string `json:"version"`
+
+	// optional; where the objects of a table with a foreign layout are stored. see WithPathTemplate
+	PathTemplate string `json:"pathTemplate"`
+
+	// optional; where the objects and index entries of the table are stored, if not in the default layout. see WithPathLayout
+	Layout PathLayout `json:"-"`
+
+	// how times are written, see WithCodec
+	Codec TableCodec `json:"codec"`
+
+	// how the objects are written to the bucket, see WithStorage
+	Storage TableStorage `json:"storage"`
+
+	// the precision and scale that decimal fields are checked against when they are written. see WithDecimalField
+	Decimals []DecimalField `json:"decimals"`
+
+	// the values that enum fields are checked against when they are written, and their codes. see WithEnumField
+	Enums []EnumField `json:"enums"`
+
+	// the fields which reference the entities of other tables. see WithForeignKey
+	ForeignKeys []ForeignKey `json:"foreignKeys"`
+
+	// if true, the ids and values in the paths of the index entries are escaped. see WithEscapedPaths
+	EscapedPaths bool `json:"escapedPaths"`
+}
+
+// returns a copy of the table which may only be written to by the process holding its lease
+func (t Table) WithSingleWriterLease() Table {
+	t.SingleWriter = true
+	return t
+}
+
+// full path to the object representing the lease which permits a single process to write to the table
+func (t *Table) LeasePath() string {
+	return t.Folder() + "lease"
+}
+
+// full path to the object holding the last value that a sequence of the table allocated, see minio.Sequence
+func (t *Table) SequencePath() string {
+	return t.Folder() + "sequence"
+}
+
+// returns a copy of the table with the given semantic version
+func (t Table) WithVersion(version string) Table {
+	t.Version = version
+	return t
 }
 
 func (t *Table) pathPrefix() string {
-	return fmt.Sprintf("%s/%s/data", t.Database, t.Name)
+	return t.Folder() + "data"
 }
 
 // full path to the object with the given id
 func (t *Table) Path(id string) string {
-	return fmt.Sprintf("%s/%s.json", t.pathPrefix(), id)
+	return t.layout().DataPath(t, id)
 }
 
-// full path to place where we store the indices, for the given table, so that they can be managed during update and delete
+// full path to place where we store the indices, for the given table, so that they can be managed during update and delete.
+// for tables with a path template, they are stored in the usual place, rather than next to the object.
 func (t *Table) IndicesPath(id string) string {
 	return fmt.Sprintf("%s/%s.indices", t.pathPrefix(), id)
 }
 
+// full path to the object whose ETag is the generation token of the table. it is rewritten whenever a transaction that
+// wrote to the table commits, so that anything derived from the table's contents, e.g. cached query results, can be invalidated.
+func (t *Table) GenerationPath() string {
+	return t.Folder() + "generation"
+}
+
+// returns the generation path of the table that the given object or index entry path belongs to
+func GenerationPathFromPath(path string) (string, error) {
+	if table, _, ok := MappedTableFromPath(path); ok {
+		return table.GenerationPath(), nil
+	}
+	tenant, rest := TenantFromPath(path)
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("ADB-0039 invalid path since it does not start with a database and table: %s", path)
+	}
+	return fmt.Sprintf("%s%s/%s/generation", tenant.Prefix(), parts[0], parts[1]), nil
+}
+
 // return the index object for the given field name
 func (t *Table) GetIndex(field string) (*Index, error) {
 	for _, index := range t.Indices {
@@ -46,7 +149,7 @@ func (t *Table) PathFromIndex(databaseTableIdTuple *DatabaseTableIdTuple) (strin
 		return "", fmt.Errorf("ADB-0032 no such database or table, are you using the right table for the given index entry? %s", *databaseTableIdTuple)
 	}
 
-	return fmt.Sprintf("%s/%s.json", t.pathPrefix(), databaseTableIdTuple.Id), nil
+	return t.Path(databaseTableIdTuple.Id), nil
 }
 
 func DatabaseTableIdTupleFromPath(path string) (*DatabaseTableIdTuple, error) {
@@ -65,6 +168,88 @@ func DatabaseTableIdTupleFromPath(path string) (*DatabaseTableIdTuple, error) {
 	return &DatabaseTableIdTuple{Database: database, Table: table, Id: id}, nil
 }
 
+// the definition of a table, as stored in the schema registry. unlike Table, it contains no cycles, so it can be serialised.
+type TableDefinition struct {
+	Database string `json:"database"`
+	Name string `json:"name"`
+	Indices []string `json:"indices"`
+	Version string `json:"version"`
+	// the version of the format that the definition was written in, see FORMAT_VERSION
+	FormatVersion int `json:"formatVersion,omitempty"`
+	// the options of the indices, in the same order, so that the table can be resolved from the registry. see Table.
+	// nil in definitions which were registered before they were stored.
+	IndexOptions []IndexDefinition `json:"indexOptions"`
+	Key []string `json:"key,omitempty"`
+	SingleWriter bool `json:"singleWriter,omitempty"`
+	Pinnable bool `json:"pinnable,omitempty"`
+	PathTemplate string `json:"pathTemplate,omitempty"`
+	Codec TableCodec `json:"codec"`
+	Storage TableStorage `json:"storage"`
+	Decimals []DecimalField `json:"decimals"`
+	Enums []EnumField `json:"enums,omitempty"`
+	ForeignKeys []ForeignKey `json:"foreignKeys,omitempty"`
+	EscapedPaths bool `json:"escapedPaths,omitempty"`
+}
+
+// full path to the table definition in the schema registry
+func (t *Table) SchemaPath() string {
+	return fmt.Sprintf("%s%s/%s.json", SCHEMA_ROOT, t.Database, t.Name)
+}
+
+// returns the definition of the table, as stored in the schema registry
+func (t *Table) Definition() TableDefinition {
+	indices := make([]string, len(t.Indices))
+	options := make([]IndexDefinition, len(t.Indices))
+	for i, index := range t.Indices {
+		indices[i] = index.Field
+		options[i] = index.Definition()
+	}
+	version := t.Version
+	if version == "" {
+		version = DEFAULT_SCHEMA_VERSION
+	}
+	return TableDefinition{
+		Database: string(t.Database),
+		Name: t.Name,
+		Indices: indices,
+		Version: version,
+		FormatVersion: t.formatVersion(),
+		IndexOptions: options,
+		Key: t.Key,
+		SingleWriter: t.SingleWriter,
+		Pinnable: t.Pinnable,
+		PathTemplate: t.PathTemplate,
+		Codec: t.Codec,
+		Storage: t.Storage,
+		Decimals: t.Decimals,
+		Enums: t.Enums,
+		ForeignKeys: t.ForeignKeys,
+		EscapedPaths: t.EscapedPaths,
+	}
+}
+
+// the oldest version of the format which can read the objects of the table
+func (t *Table) formatVersion() int {
+	if t.EscapedPaths {
+		return ESCAPED_PATHS_FORMAT_VERSION
+	}
+	return OBJECT_FORMAT_VERSION
+}
+
+// parses the path of a data object, i.e. `<database>/<table>/data/<id>.json`, optionally below the prefix of a tenant, or the path of an object of a table with a path
+// template
+func DatabaseTableIdTupleFromDataPath(path string) (*DatabaseTableIdTuple, error) {
+	if table, id, ok := MappedTableFromPath(path); ok {
+		return &DatabaseTableIdTuple{Database: string(table.Database), Table: table.Name, Id: id}, nil
+	}
+	tenant, rest := TenantFromPath(path)
+	parts := strings.Split(rest, "/")
+	if len(parts) != 4 || parts[2] != "data" || !strings.HasSuffix(parts[3], ".json") {
+		return nil, fmt.Errorf("ADB-0066 invalid path since it is not the path of a data object: %s", path)
+	}
+	return &DatabaseTableIdTuple{Database: parts[0], Table: parts[1], Id: strings.TrimSuffix(parts[3], ".json"), Tenant: tenant}, nil
+}
+
 func NewTable(database Database, name string, indices []string) Table {
 	t := Table{
 		Database: database,
@@ -77,34 +262,293 @@ func NewTable(database Database, name string, indices []string) Table {
 	return t
 }
 
+// returns a copy of the table with a different name, e.g. the physical name that a logical name is an alias of.
+// the indices (including computed ones) are kept, but refer to the renamed table.
+func (t Table) WithName(name string) Table {
+	t.Name = name
+	indices := make([]Index, len(t.Indices))
+	for i, index := range t.Indices {
+		index.Table = t
+		indices[i] = index
+	}
+	t.Indices = indices
+	return t
+}
+
+// the pointer from a logical table name to the physical one, where the data is actually stored
+type TableAlias struct {
+	Database string `json:"database"`
+	LogicalName string `json:"logicalName"`
+	PhysicalName string `json:"physicalName"`
+}
+
+// full path to the pointer object for the given logical table name
+func AliasPath(database Database, logicalName string) string {
+	return fmt.Sprintf("%s%s/%s.json", ALIASES_ROOT, database, logicalName)
+}
+
+// computes the value that is indexed for the given entity, e.g. `lower(email)` or `year(createdAt)`.
+// the entity is a pointer to the struct being written or read.
+// return nil if the value is null, so that it is indexed like a missing field.
+type IndexValueFunc func(entity any) (*string, error)
+
+// decides whether the given entity has an entry in a partial index, e.g. only those whose status is active.
+// the entity is a pointer to the struct being written or read.
+type IndexFilterFunc func(entity any) (bool, error)
+
 type Index struct {
 	Table Table `json:"table"`
+	// the name of the field of the struct. if it is a slice, the entity has an entry for each of its elements
 	Field string `json:"field"`
+
+	// optional; if set, the index is over the computed value rather than the field itself, and Field is just the name of the index
+	Compute IndexValueFunc `json:"-"`
+
+	// the revision of the index definition. each revision is stored in its own tree, so that a new definition can be
+	// built in parallel to the old one, and queries cut over once it is complete. zero is the original definition.
+	Revision int `json:"revision"`
+
+	// if set, at most one entity may have each value. entities without a value are not constrained. see UniquePath
+	Unique bool `json:"unique"`
+
+	// if set, the values are numbers, which are encoded so that entries are in numeric order. see WithNumericIndex
+	Numeric bool `json:"numeric"`
+
+	// if set, the values are exact decimals, e.g. amounts of money, which are encoded so that entries are in numeric order.
+	// see WithDecimalIndex
+	Decimal bool `json:"decimal"`
+
+	// optional; if set, the index is partial, i.e. only entities for which it returns true have an entry, so that queries of the
+	// index only find those. see WithPartialIndex
+	Filter IndexFilterFunc `json:"-"`
+
+	// if set, the values are timestamps, which are encoded as `YYYY/MM/DD/...`, so that entries are in chronological order and
+	// grouped by period. see WithTimeIndex
+	Time bool `json:"time"`
+
+	// if set, the index is over time, and entities expire this long after its value, e.g. the time a session was last used.
+	// see WithTTLIndex
+	TTL time.Duration `json:"ttl"`
+
+	// how string values are compared, e.g. ignoring case. see WithCollation
+	Collation IndexCollation `json:"collation"`
+
+	// if set, Field is a path into the JSON of the entity, e.g. `address.city` or `tags[].name`, rather than the name of a field of
+	// its struct, and the entity has an entry for each value at the path. see WithJsonPathIndex
+	JsonPath bool `json:"jsonPath"`
+
+	// how the folders of its values are sharded. see WithFanOut
+	FanOut IndexFanOut `json:"fanOut"`
+
+	// if set, entities whose value is null have no entry, so that they are not found by IsNull. see WithSparseIndex
+	Sparse bool `json:"sparse"`
+
+	// if set, the entries carry the ETag of their record. see WithRecordETags
+	RecordETags bool `json:"recordETags"`
+
+	// optional; if set, the index is covering, i.e. its entries contain these fields of the entity, so that they can be read
+	// without reading the entity. see WithProjection
+	Projection []string `json:"projection"`
+}
+
+// returns a copy of the table in which the index of the field is unique, adding the index if the field is not yet indexed.
+// all revisions of the index are unique.
+func (t Table) WithUniqueIndex(field string) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Unique = true
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Unique: true})
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns a copy of the table in which the index of the field is partial, adding the index if the field is not yet indexed.
+// entities for which the filter returns false have no entry in the index, so that it stays small, and writing them costs nothing
+// for the index. queries of the index only find entities for which it returns true, and a unique partial index only constrains
+// those. changing the filter requires a new revision, like changing a computed index.
+func (t Table) WithPartialIndex(field string, filter IndexFilterFunc) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Filter = filter
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Filter: filter})
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns a copy of the table with a new revision of an existing index, e.g. because its computed expression changes.
+// until the new revision is cut over to, queries use the existing one while writes maintain both (dual-write).
+func (t Table) WithIndexRevision(field string, revision int, compute IndexValueFunc) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	t.Indices = append(indices, Index{Table: t, Field: field, Compute: compute, Revision: revision})
+	return t
+}
+
+// returns a copy of the table with an index on the field, unless it already has one. see minio.CreateIndex, which also adds entries
+// for the existing entities
+func (t Table) WithIndex(field string) Table {
+	if _, err := t.GetIndex(field); err == nil {
+		return t
+	}
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	t.Indices = append(indices, Index{Table: t, Field: field})
+	return t
+}
+
+// returns a copy of the table without the index on the field, including all of its revisions. see minio.DropIndex, which also
+// removes its entries
+func (t Table) WithoutIndex(field string) Table {
+	indices := make([]Index, 0, len(t.Indices))
+	for _, index := range t.Indices {
+		if index.Field != field {
+			indices = append(indices, index)
+		}
+	}
+	t.Indices = indices
+	return t
+}
+
+// return the index object for the given field name and revision
+func (t *Table) GetIndexRevision(field string, revision int) (*Index, error) {
+	for _, index := range t.Indices {
+		if index.Field == field && index.Revision == revision {
+			return &index, nil
+		}
+	}
+	return nil, fmt.Errorf("ADB-0055 no such index revision: %s revision %d", field, revision)
+}
+
+// returns the number of revisions of the index for the given field name, which is more than one while reindexing
+func (t *Table) CountIndexRevisions(field string) int {
+	count := 0
+	for _, index := range t.Indices {
+		if index.Field == field {
+			count++
+		}
+	}
+	return count
+}
+
+// full path to the object recording which revision of the index on the given field queries use
+func (t *Table) ReindexPath(field string) string {
+	return fmt.Sprintf("%sreindex/%s.json", t.Folder(), field)
+}
+
+// full path to an attachment of an entity of the table, e.g. a file uploaded in an upload session, with the given id
+func (t *Table) AttachmentPath(id string) string {
+	return fmt.Sprintf("%sattachments/%s", t.Folder(), id)
+}
+
+// true if the path is that of an attachment, i.e. `<database>/<table>/attachments/<id>`, optionally below the prefix of a tenant
+func IsAttachmentPath(path string) bool {
+	_, rest := TenantFromPath(path)
+	parts := strings.Split(rest, "/")
+	return len(parts) == 4 && parts[2] == "attachments" && parts[3] != ""
+}
+
+// full path to the checkpoint of the backfill of a new index on the given field, while it is being created
+func (t *Table) BackfillPath(field string) string {
+	return fmt.Sprintf("%sreindex/%s.backfill.json", t.Folder(), field)
+}
+
+// path to the folder containing all data objects of the table, which, for tables with a path template, is the part before the id
+func (t *Table) DataPathPrefix() string {
+	return t.layout().DataPathPrefix(t)
+}
+
+// returns a copy of the table with an additional index over a computed expression, which is maintained transactionally like
+// any other index. query it using the name, just like a field name.
+// the name should not clash with a field name, e.g. `EmailLower` rather than `Email`. see Computed, for functions over the type
+// of the entities.
+func (t Table) WithComputedIndex(name string, compute IndexValueFunc) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	t.Indices = append(indices, Index{Table: t, Field: name, Compute: compute})
+	return t
 }
 
 func (i *Index) PathPrefix() string {
-	return fmt.Sprintf("%s/%s/indices/%s", i.Table.Database, i.Table.Name, i.Field)
+	if i.Revision > 0 {
+		return fmt.Sprintf("%sindices/%s.r%d", i.Table.Folder(), i.Field, i.Revision)
+	}
+	return fmt.Sprintf("%sindices/%s", i.Table.Folder(), i.Field)
 }
 
-// path to the folder containing all index entries for a given field value
+// path to the folder containing all index entries for a given field value, which is collated, see CollationKey, escaped if the
+// table escapes paths, see WithEscapedPaths, and laid out by the layout of the table, see PathLayout. the values of time indices are not fanned out,
+// since they are already grouped by period.
 func (i *Index) PathNoId(fieldValue string) string {
-	for len(fieldValue) < 2 {
-		fieldValue = "_" + fieldValue
+	if i.Time {
+		return fmt.Sprintf("%s/%s", i.PathPrefix(), fieldValue)
 	}
-	fieldValue = strings.ToLower(fieldValue)
-	return fmt.Sprintf("%s/%s/%s", i.PathPrefix(), fieldValue[:2], fieldValue)
+	return fmt.Sprintf("%s/%s", i.PathPrefix(), i.Table.layout().IndexValueFolder(i, i.escapeValue(i.pathValue(i.CollationKey(fieldValue)))))
 }
 
-// path to the index entry, i.e. the path to the actual record.
-// the filename is a combination of the database, table, and entity id, separated by "___", so that a caller
-// doesn't need to read the contents in order to identify the database, table, and entity id.
+// path to the index entry, i.e. the path to the actual record. the filename identifies the database, table, and entity id, so
+// that a caller doesn't need to read the contents in order to identify them. see PathLayout
 func (i *Index) Path(fieldValue string, entityId string) string {
-	database_table_id := fmt.Sprintf("%s___%s___%s", i.Table.Database, i.Table.Name, entityId)
-	return fmt.Sprintf("%s/%s", i.PathNoId(fieldValue), database_table_id)
+	return fmt.Sprintf("%s/%s", i.PathNoId(fieldValue), i.Table.layout().IndexEntryName(i, entityId))
+}
+
+// path to the folder containing all index entries for records where the field is missing or empty.
+// the folder name is longer than the two characters used to fan out real values, so that it can never clash with them.
+func (i *Index) NullPathNoId() string {
+	return fmt.Sprintf("%s/%s", i.PathPrefix(), NULL_INDEX_FOLDER)
+}
+
+// path to the folder containing the index entries which records where the field is empty were given before they were indexed as
+// null, so that they are still found until the records are updated, which replaces them. see LEGACY_NULL_INDEX_FOLDER
+func (i *Index) LegacyNullPathNoId() string {
+	return fmt.Sprintf("%s/%s", i.PathPrefix(), LEGACY_NULL_INDEX_FOLDER)
+}
+
+// path to the index entry of a record where the field is missing or empty
+func (i *Index) NullPath(entityId string) string {
+	return fmt.Sprintf("%s/%s", i.NullPathNoId(), i.Table.layout().IndexEntryName(i, entityId))
+}
+
+// path to the claim on a value of a unique index, which contains the id of the entity that has the value. claims are written with
+// if-none-match semantics, so that only one transaction can claim a value, even if several write it at the same time.
+// unlike index entries, they are outside of the index, so that they are never found by queries.
+func (i *Index) UniquePath(fieldValue string) string {
+	indicesPrefix := i.Table.Folder() + "indices/"
+	return fmt.Sprintf("%s%s/%s", i.Table.Folder(), UNIQUE_FOLDER, strings.TrimPrefix(i.PathNoId(fieldValue), indicesPrefix))
+}
+
+// path to the folder containing all claims on values of the unique index
+func (i *Index) UniquePathPrefix() string {
+	indicesPrefix := i.Table.Folder() + "indices/"
+	return fmt.Sprintf("%s%s/%s", i.Table.Folder(), UNIQUE_FOLDER, strings.TrimPrefix(i.PathPrefix(), indicesPrefix))
+}
+
+// true if the path is that of a claim on a value of a unique index
+func IsUniquePath(path string) bool {
+	_, rest := TenantFromPath(path)
+	parts := strings.SplitN(rest, "/", 4)
+	return len(parts) == 4 && parts[2] == UNIQUE_FOLDER
 }
 
 type DatabaseTableIdTuple struct {
 	Database string
 	Table    string
 	Id       string
+	// the tenant of the path of a data object that the tuple was parsed from, since the names of index entries do not contain it
+	Tenant   Tenant
 }
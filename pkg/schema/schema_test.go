@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable_WithName(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name"})
+	renamed := table.WithName("account_v2")
+
+	assert.Equal("account_v2", renamed.Name)
+	assert.Equal("db/account_v2/data/1.json", renamed.Path("1"))
+	assert.Equal("db/account_v2/indices/Name/jo/john/db___account_v2___1", renamed.Indices[0].Path("John", "1"))
+
+	// the original is untouched
+	assert.Equal("db/account/indices/Name/jo/john/db___account___1", table.Indices[0].Path("John", "1"))
+}
+
+func TestDatabaseTableIdTupleFromDataPath(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name"})
+
+	tuple, err := DatabaseTableIdTupleFromDataPath(table.Path("1"))
+	assert.NoError(err)
+	assert.Equal(DatabaseTableIdTuple{Database: "db", Table: "account", Id: "1"}, *tuple)
+
+	_, err = DatabaseTableIdTupleFromDataPath(table.Indices[0].Path("John", "1"))
+	assert.Error(err)
+}
+
+func TestTable_WithUniqueIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name"})
+	unique := table.WithUniqueIndex("Name").WithUniqueIndex("Email")
+
+	assert.True(unique.Indices[0].Unique)
+	assert.Equal("Email", unique.Indices[1].Field)
+	assert.True(unique.Indices[1].Unique)
+	assert.False(table.Indices[0].Unique) // the original is untouched
+
+	path := unique.Indices[1].UniquePath("John@example.com")
+	assert.Equal("db/account/unique/Email/jo/john@example.com", path)
+	assert.True(IsUniquePath(path))
+	assert.False(IsUniquePath(unique.Indices[1].Path("John@example.com", "1")))
+}
+
+func TestTable_WithIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name"}).WithUniqueIndex("Email")
+	indexed := table.WithIndex("Age").WithIndex("Email")
+
+	assert.Len(indexed.Indices, 3)
+	assert.Equal("Age", indexed.Indices[2].Field)
+	assert.True(indexed.Indices[1].Unique) // existing indices are kept as they are
+	assert.Len(table.Indices, 2)           // the original is untouched
+	assert.Equal("db/account/reindex/Age.backfill.json", indexed.BackfillPath("Age"))
+}
+
+func TestTable_WithoutIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name", "Email"}).WithUniqueIndex("Email").WithIndexRevision("Email", 1, nil)
+	dropped := table.WithoutIndex("Email")
+
+	assert.Len(dropped.Indices, 1)
+	assert.Equal("Name", dropped.Indices[0].Field)
+	assert.Len(table.Indices, 3) // the original is untouched
+	assert.Equal("db/account/unique/Email.r1", table.Indices[2].UniquePathPrefix())
+	assert.True(strings.HasPrefix(table.Indices[1].UniquePath("john@example.com"), table.Indices[1].UniquePathPrefix()+"/"))
+}
+
+func TestTable_WithPartialIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name"})
+	active := func(entity any) (bool, error) { return true, nil }
+	partial := table.WithPartialIndex("Name", active).WithPartialIndex("Email", active).WithUniqueIndex("Email")
+
+	assert.NotNil(partial.Indices[0].Filter)
+	assert.Equal("Email", partial.Indices[1].Field)
+	assert.NotNil(partial.Indices[1].Filter)
+	assert.True(partial.Indices[1].Unique)
+	assert.Nil(table.Indices[0].Filter) // the original is untouched
+}
+
+func TestIsAttachmentPath(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "document", []string{})
+
+	assert.True(IsAttachmentPath(table.AttachmentPath("1")))
+	assert.False(IsAttachmentPath(table.Path("1")))
+	assert.False(IsAttachmentPath("db/document/attachments/"))
+}
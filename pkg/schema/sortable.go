@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// encodes a number so that the lexicographic order of encodings is the numeric order, which is what listing index entries with a
+// prefix or a start key relies on. the bits of the float64 are written as 16 hex digits in offset binary, i.e. with the sign bit
+// flipped for positive numbers, and all bits flipped for negative ones.
+// integers are exact up to 2^53.
+func EncodeSortableNumber(n float64) (string, error) {
+	if math.IsNaN(n) {
+		return "", fmt.Errorf("ADB-0121 NaN cannot be indexed, since it has no order")
+	}
+	if n == 0 {
+		n = 0 // so that -0 and 0 are equal
+	}
+	bits := math.Float64bits(n)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return fmt.Sprintf("%016x", bits), nil
+}
+
+// the inverse of EncodeSortableNumber
+func DecodeSortableNumber(encoded string) (float64, error) {
+	bits, err := strconv.ParseUint(encoded, 16, 64)
+	if err != nil || len(encoded) != 16 {
+		return 0, fmt.Errorf("ADB-0121 invalid sortable number %s", encoded)
+	}
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), nil
+}
+
+// returns a copy of the table in which the index of the field is numeric, adding the index if the field is not yet indexed.
+// the values of numeric indices are encoded with EncodeSortableNumber, so that they can be queried by range.
+func (t Table) WithNumericIndex(field string) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Numeric = true
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Numeric: true})
+	}
+	t.Indices = indices
+	return t
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeSortableNumber_PreservesNumericOrder(t *testing.T) {
+	assert := assert.New(t)
+	numbers := []float64{math.Inf(-1), -1e300, -65, -18.5, -1, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1, 9, 10, 18, 64.999, 65, 1 << 53, math.Inf(1)}
+	encoded := make([]string, len(numbers))
+	for i, n := range numbers {
+		var err error
+		encoded[i], err = EncodeSortableNumber(n)
+		assert.NoError(err)
+		assert.Len(encoded[i], 16)
+		decoded, err := DecodeSortableNumber(encoded[i])
+		assert.NoError(err)
+		assert.Equal(n, decoded)
+	}
+	assert.True(slices.IsSorted(encoded))
+
+	negativeZero, _ := EncodeSortableNumber(math.Copysign(0, -1))
+	zero, _ := EncodeSortableNumber(0)
+	assert.Equal(zero, negativeZero)
+
+	_, err := EncodeSortableNumber(math.NaN())
+	assert.ErrorContains(err, "ADB-0121")
+	_, err = DecodeSortableNumber("xyz")
+	assert.ErrorContains(err, "ADB-0121")
+}
+
+func TestTable_WithNumericIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "person", []string{"Name"}).WithNumericIndex("Age")
+	assert.False(table.Indices[0].Numeric)
+	assert.Equal("Age", table.Indices[1].Field)
+	assert.True(table.Indices[1].Numeric)
+}
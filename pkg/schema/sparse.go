@@ -0,0 +1,23 @@
+package schema
+
+// returns a copy of the table in which the index of the field is sparse, adding the index if the field is not yet indexed, i.e.
+// entities whose value is null, e.g. an empty string or a nil pointer, have no entry, rather than one in the folder of nulls,
+// which otherwise holds an entry for every such entity, e.g. for an optional field which is rarely set. the index can then not
+// be queried for null, i.e. with WhereIndexedFieldIsNull, or for the empty value. it applies to all revisions of the index.
+// entries of nulls which exist when an index becomes sparse are removed when their entities are next written, or by a rebuild.
+func (t Table) WithSparseIndex(field string) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Sparse = true
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Sparse: true})
+	}
+	t.Indices = indices
+	return t
+}
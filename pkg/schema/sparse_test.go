@@ -0,0 +1,18 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable_WithSparseIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Email"})
+	sparse := table.WithSparseIndex("Email").WithSparseIndex("Phone")
+	assert.False(table.Indices[0].Sparse, "the original table is unchanged")
+	assert.Len(sparse.Indices, 2)
+	assert.True(sparse.Indices[0].Sparse)
+	assert.True(sparse.Indices[1].Sparse)
+	assert.Equal("Phone", sparse.Indices[1].Field)
+}
@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	STORAGE_COMPRESSION_NONE = ""
+	STORAGE_COMPRESSION_GZIP = "gzip"
+
+	STORAGE_ENCRYPTION_NONE    = ""
+	STORAGE_ENCRYPTION_SSE_S3  = "SSE-S3"
+	STORAGE_ENCRYPTION_SSE_KMS = "SSE-KMS"
+)
+
+// how the objects of a table are written to the bucket. the zero value writes them as the bucket does by default, i.e. as
+// uncompressed JSON, with the encryption and retention that the bucket has. see WithStorage
+type TableStorage struct {
+	// the content type of the objects of the table, e.g. "application/vnd.acme.account+json", or empty for "application/json".
+	// entities are written as JSON regardless, so it only tells other readers of the bucket what they are.
+	ContentType string `json:"contentType,omitempty"`
+
+	// the codec with which the objects of the table are compressed, i.e. STORAGE_COMPRESSION_GZIP, or none. the content
+	// encoding of compressed objects says so, and they are decompressed when they are read, so that tables can be compressed
+	// once records exist. entries of indices are not compressed, since they are small.
+	Compression string `json:"compression,omitempty"`
+
+	// how the server encrypts the objects of the table and the entries of its indices, i.e. STORAGE_ENCRYPTION_SSE_S3 with
+	// keys that it manages, STORAGE_ENCRYPTION_SSE_KMS with the key of EncryptionKeyId, or none, i.e. as the bucket does
+	Encryption string `json:"encryption,omitempty"`
+
+	// the id of the key in the KMS of the server, with which STORAGE_ENCRYPTION_SSE_KMS encrypts
+	EncryptionKeyId string `json:"encryptionKeyId,omitempty"`
+
+	// each version that is written of the objects of the table and the entries of its indices is retained in governance mode
+	// for this long, so that it can only be removed by clients which may bypass governance, e.g. abstrastore itself when it
+	// rolls back or collects garbage, or zero to retain versions as the bucket does. the bucket needs object locking.
+	VersionRetention time.Duration `json:"versionRetention,omitempty"`
+}
+
+// returns a copy of the table whose objects are written with the storage options, rather than as the bucket does by default.
+// objects that were written before keep the options with which they were written, and are read as they are.
+// panics if the options are invalid, since tables are declared by code.
+func (t Table) WithStorage(storage TableStorage) Table {
+	if storage.Compression != STORAGE_COMPRESSION_NONE && storage.Compression != STORAGE_COMPRESSION_GZIP {
+		panic(fmt.Sprintf("ADB-0167 unknown compression %s of table %s", storage.Compression, t.Name))
+	}
+	switch storage.Encryption {
+	case STORAGE_ENCRYPTION_NONE, STORAGE_ENCRYPTION_SSE_S3:
+		if storage.EncryptionKeyId != "" {
+			panic(fmt.Sprintf("ADB-0269 the encryption key of table %s is only used by %s", t.Name, STORAGE_ENCRYPTION_SSE_KMS))
+		}
+	case STORAGE_ENCRYPTION_SSE_KMS:
+		if storage.EncryptionKeyId == "" {
+			panic(fmt.Sprintf("ADB-0270 the encryption %s of table %s needs a key", storage.Encryption, t.Name))
+		}
+	default:
+		panic(fmt.Sprintf("ADB-0271 unknown encryption %s of table %s", storage.Encryption, t.Name))
+	}
+	if storage.VersionRetention < 0 {
+		panic(fmt.Sprintf("ADB-0272 invalid version retention %s of table %s", storage.VersionRetention, t.Name))
+	}
+	t.Storage = storage
+	indices := make([]Index, len(t.Indices))
+	for i, index := range t.Indices {
+		index.Table.Storage = storage
+		indices[i] = index
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns the content type of the objects of the table
+func (s TableStorage) DataContentType() string {
+	if s.ContentType == "" {
+		return "application/json"
+	}
+	return s.ContentType
+}
+
+// sets the storage options on the steps of the transaction from the first one on, which were added for a record of a table
+// with them, so that they are honoured when the steps are executed, also by another process which resumes the transaction.
+// steps of tables without storage options are left as they are.
+func (t *Transaction) SetStorage(first int, storage TableStorage) {
+	if storage == (TableStorage{}) {
+		return
+	}
+	for i := first; i < len(t.Steps); i++ {
+		step := t.Steps[i]
+		s := storage
+		step.Storage = &s
+		if !step.Type.IsData() {
+			// entries of indices are not compressed
+			step.Storage.Compression = STORAGE_COMPRESSION_NONE
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTable_WithStorage(t *testing.T) {
+	assert := assert.New(t)
+	storage := TableStorage{ContentType: "application/vnd.acme.event+json", Compression: STORAGE_COMPRESSION_GZIP, Encryption: STORAGE_ENCRYPTION_SSE_KMS, EncryptionKeyId: "events", VersionRetention: 24 * time.Hour}
+	table := NewTable("db", "event", []string{"At"}).WithStorage(storage)
+	assert.Equal(storage, table.Storage)
+	assert.Equal(storage, table.Indices[0].Table.Storage)
+	assert.Equal("application/vnd.acme.event+json", table.Storage.DataContentType())
+	assert.Equal("application/json", TableStorage{}.DataContentType())
+	resolved, err := table.Definition().Table()
+	assert.NoError(err)
+	assert.Equal(storage, resolved.Storage)
+
+	assert.Panics(func() { table.WithStorage(TableStorage{Compression: "zstd"}) })
+	assert.Panics(func() { table.WithStorage(TableStorage{Encryption: STORAGE_ENCRYPTION_SSE_KMS}) })
+	assert.Panics(func() { table.WithStorage(TableStorage{Encryption: STORAGE_ENCRYPTION_SSE_S3, EncryptionKeyId: "events"}) })
+	assert.Panics(func() { table.WithStorage(TableStorage{VersionRetention: -time.Hour}) })
+}
+
+func TestTransaction_SetStorage(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(time.Minute)
+	var entity any = "x"
+	var indices any = "db/event/indices/At/x/1.json"
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/other/data/1.json", "*", &entity))
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/event/data/1.json", "*", &entity))
+	assert.NoError(tx.AddStep(STEP_INSERT_REVERSE_INDICES, "text/plain", "db/event/data/1.json.indices", "*", &indices))
+
+	tx.SetStorage(1, TableStorage{})
+	assert.Nil(tx.Steps[1].Storage)
+	tx.SetStorage(1, TableStorage{Compression: STORAGE_COMPRESSION_GZIP, Encryption: STORAGE_ENCRYPTION_SSE_S3})
+	assert.Nil(tx.Steps[0].Storage)
+	assert.Equal(&TableStorage{Compression: STORAGE_COMPRESSION_GZIP, Encryption: STORAGE_ENCRYPTION_SSE_S3}, tx.Steps[1].Storage)
+	assert.Equal(&TableStorage{Encryption: STORAGE_ENCRYPTION_SSE_S3}, tx.Steps[2].Storage)
+}
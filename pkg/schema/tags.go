@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// the struct tag from which TableFor derives the indices of a table
+const TABLE_TAG = "abstrastore"
+
+// implemented by entities whose table is not named after their type, see TableFor
+type TableNamer interface {
+	TableName() string
+}
+
+// returns the table of the entities of type T, which must be a struct, so that its name and indices are declared once, with the
+// type, rather than repeated as strings. the table is named after the type in kebab case, e.g. `payment-invoice` for a
+// PaymentInvoice, unless the type implements TableNamer. its fields are indexed according to their `abstrastore` tags, e.g.
+// `abstrastore:"index"`, which are comma separated options:
+//   - `index` indexes the field
+//   - `unique` indexes it uniquely, see WithUniqueIndex
+//   - `numeric`, `decimal` and `time` index its values as numbers, decimals or times, see WithNumericIndex, WithDecimalIndex and
+//     WithTimeIndex
+//   - `sparse` leaves out its null values, see WithSparseIndex
+//   - `ttl=<duration>`, e.g. `ttl=24h`, expires entities once the time has passed since the value, see WithTTLIndex
+//
+// the fields of embedded structs are indexed too. indices are in the order of the fields, and can be refined with the other
+// methods of Table, e.g. WithCollation. panics if a tag is invalid, since tables are declared by code.
+func TableFor[T any](db Database) Table {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("ADB-0155 cannot derive a table from %s, which is not a struct", t))
+	}
+	name := kebabCase(t.Name())
+	var entity any = new(T)
+	if namer, ok := entity.(TableNamer); ok {
+		name = namer.TableName()
+	}
+	table := NewTable(db, name, []string{})
+	return withTaggedIndices(table, t)
+}
+
+func withTaggedIndices(table Table, t reflect.Type) Table {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, tagged := field.Tag.Lookup(TABLE_TAG)
+		if field.Anonymous && !tagged {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				table = withTaggedIndices(table, embedded)
+			}
+			continue
+		}
+		if !tagged || tag == "-" {
+			continue
+		}
+		if !field.IsExported() {
+			panic(fmt.Sprintf("ADB-0340 the field %s of %s cannot be indexed, since it is not exported", field.Name, t))
+		}
+		for _, option := range strings.Split(tag, ",") {
+			option, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+			switch option {
+			case "index":
+				table = table.WithIndex(field.Name)
+			case "unique":
+				table = table.WithUniqueIndex(field.Name)
+			case "numeric":
+				table = table.WithNumericIndex(field.Name)
+			case "decimal":
+				table = table.WithDecimalIndex(field.Name)
+			case "time":
+				table = table.WithTimeIndex(field.Name)
+			case "sparse":
+				table = table.WithSparseIndex(field.Name)
+			case "ttl":
+				ttl, err := time.ParseDuration(value)
+				if err != nil || ttl < 0 {
+					panic(fmt.Sprintf("ADB-0341 invalid ttl %q of field %s of %s", value, field.Name, t))
+				}
+				table = table.WithTTLIndex(field.Name, ttl)
+			default:
+				panic(fmt.Sprintf("ADB-0342 unknown option %q in the %s tag of field %s of %s", option, TABLE_TAG, field.Name, t))
+			}
+		}
+	}
+	return table
+}
+
+// e.g. `payment-invoice` for `PaymentInvoice`, and `http-request` for `HTTPRequest`
+func kebabCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				b.WriteRune('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
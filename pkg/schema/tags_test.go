@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type taggedAudit struct {
+	CreatedAt time.Time `abstrastore:"time"`
+}
+
+type PaymentInvoice struct {
+	Id      string `json:"id"`
+	Email   string `json:"email" abstrastore:"unique,sparse"`
+	Status  string `abstrastore:"index"`
+	Amount  string `abstrastore:"decimal"`
+	Notes   string
+	Ignored string `abstrastore:"-"`
+	taggedAudit
+}
+
+type taggedSession struct {
+	LastUsed time.Time `abstrastore:"ttl=24h"`
+}
+
+func (taggedSession) TableName() string {
+	return "sessions"
+}
+
+func TestTableFor(t *testing.T) {
+	assert := assert.New(t)
+	table := TableFor[PaymentInvoice]("db")
+	assert.Equal("payment-invoice", table.Name)
+	assert.Equal(Database("db"), table.Database)
+	fields := make([]string, len(table.Indices))
+	for i, index := range table.Indices {
+		fields[i] = index.Field
+		assert.Equal("payment-invoice", index.Table.Name)
+	}
+	assert.Equal([]string{"Email", "Status", "Amount", "CreatedAt"}, fields)
+	assert.True(table.Indices[0].Unique)
+	assert.True(table.Indices[0].Sparse)
+	assert.True(table.Indices[2].Decimal)
+	assert.True(table.Indices[3].Time)
+
+	sessions := TableFor[taggedSession]("db")
+	assert.Equal("sessions", sessions.Name)
+	assert.Equal(24*time.Hour, sessions.Indices[0].TTL)
+
+	type invalid struct {
+		Name string `abstrastore:"indexed"`
+	}
+	assert.Panics(func() { TableFor[invalid]("db") })
+	assert.Panics(func() { TableFor[string]("db") })
+}
+
+func TestKebabCase(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("account", kebabCase("Account"))
+	assert.Equal("payment-invoice", kebabCase("PaymentInvoice"))
+	assert.Equal("http-request", kebabCase("HTTPRequest"))
+	assert.Equal("order2-line", kebabCase("Order2Line"))
+}
@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the folder below which the objects of the tenants other than the default one are stored, i.e. `tenants/<tenant>/`, followed by
+// the paths that the default tenant uses, e.g. `tenants/acme/bank/accounts/data/42.json` and `tenants/acme/transactions/...`
+const TENANTS_ROOT = "tenants/"
+
+// a tenant whose objects and transactions are stored in a folder of their own, so that several tenants can share a bucket without
+// seeing each other's data, and a tenant can be removed as a whole, see MinioRepository.DeleteTenant. the empty tenant is the
+// default one, whose objects are stored at the root of the bucket, as they are without tenants. tables are registered once for
+// all tenants.
+type Tenant string
+
+// the tenant whose objects are stored at the root of the bucket
+const DEFAULT_TENANT Tenant = ""
+
+func NewTenant(name string) Tenant {
+	return Tenant(name)
+}
+
+// returns the folder which the paths of the tenant start with, i.e. `tenants/<tenant>/`, with the name escaped like
+// EscapePathSegment does, or nothing for the default tenant
+func (t Tenant) Prefix() string {
+	if t == DEFAULT_TENANT {
+		return ""
+	}
+	return TENANTS_ROOT + EscapePathSegment(string(t)) + "/"
+}
+
+// returns the tenant that the path belongs to, and the path as the default tenant has it, i.e. without the prefix of the tenant
+func TenantFromPath(path string) (Tenant, string) {
+	rest, found := strings.CutPrefix(path, TENANTS_ROOT)
+	if !found {
+		return DEFAULT_TENANT, path
+	}
+	name, rest, found := strings.Cut(rest, "/")
+	if !found || name == "" {
+		return DEFAULT_TENANT, path
+	}
+	return Tenant(UnescapePathSegment(name)), rest
+}
+
+// returns a copy of the table whose objects, index entries, leases and other objects are those of the tenant, i.e. stored below
+// its prefix. the table is registered once for all tenants, so the tenant is not part of its definition. tables with a path
+// template or layout are stored where those say, so they cannot belong to a tenant. panics if the table has one, since tables
+// are declared by code.
+func (t Table) WithTenant(tenant Tenant) Table {
+	if t.IsAdopted() && tenant != DEFAULT_TENANT {
+		panic(fmt.Sprintf("ADB-0254 table %s/%s cannot belong to tenant %s, since its objects are stored where its path template or layout says", t.Database, t.Name, tenant))
+	}
+	t.Tenant = tenant
+	indices := make([]Index, len(t.Indices))
+	for i, index := range t.Indices {
+		index.Table.Tenant = tenant
+		indices[i] = index
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns the folder containing the objects of the table, i.e. `<tenant prefix><database>/<table>/`
+func (t *Table) Folder() string {
+	return fmt.Sprintf("%s%s/%s/", t.Tenant.Prefix(), t.Database, t.Name)
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenant_PrefixAndTenantFromPath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", DEFAULT_TENANT.Prefix())
+	assert.Equal("tenants/acme/", NewTenant("acme").Prefix())
+	assert.Equal("tenants/a%2Fb/", NewTenant("a/b").Prefix())
+
+	tenant, rest := TenantFromPath("tenants/a%2Fb/db/account/data/42.json")
+	assert.Equal(NewTenant("a/b"), tenant)
+	assert.Equal("db/account/data/42.json", rest)
+	tenant, rest = TenantFromPath("db/account/data/42.json")
+	assert.Equal(DEFAULT_TENANT, tenant)
+	assert.Equal("db/account/data/42.json", rest)
+}
+
+func TestTable_WithTenant(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "account", []string{"Name"}).WithUniqueIndex("Email").WithTenant("acme")
+	assert.Equal("tenants/acme/db/account/", table.Folder())
+	assert.Equal("tenants/acme/db/account/data/42.json", table.Path("42"))
+	assert.Equal("tenants/acme/db/account/lease", table.LeasePath())
+	assert.Equal("tenants/acme/db/account/generation", table.GenerationPath())
+	assert.Equal("tenants/acme/db/account/sequence", table.SequencePath())
+	assert.Equal("schema/db/account.json", table.SchemaPath())
+	shared := NewTable("db", "account", []string{"Name"}).WithUniqueIndex("Email")
+	assert.Equal(shared.Definition(), table.Definition())
+
+	index, err := table.GetIndex("Email")
+	assert.NoError(err)
+	assert.Equal("tenants/acme/db/account/indices/Email", index.PathPrefix())
+	assert.Equal("tenants/acme/db/account/unique/Email", index.UniquePathPrefix())
+	assert.True(IsUniquePath(index.UniquePath("john@example.com")))
+
+	generation, err := GenerationPathFromPath(index.Path("john@example.com", "42"))
+	assert.NoError(err)
+	assert.Equal(table.GenerationPath(), generation)
+	tuple, err := DatabaseTableIdTupleFromDataPath(table.Path("42"))
+	assert.NoError(err)
+	assert.Equal(DatabaseTableIdTuple{Database: "db", Table: "account", Id: "42", Tenant: "acme"}, *tuple)
+
+	assert.PanicsWithValue("ADB-0254 table db/account cannot belong to tenant acme, since its objects are stored where its path template or layout says", func() {
+		NewTable("db", "account", nil).WithPathTemplate("legacy/{id}.json").WithTenant("acme")
+	})
+}
+
+func TestTransaction_Tenant(t *testing.T) {
+	assert := assert.New(t)
+	SetTransactionTokenKey([]byte("secret"))
+	defer SetTransactionTokenKey(nil)
+
+	tx := NewTransaction(10 * time.Second)
+	tx.Tenant = "acme"
+	tx.Etag = "abc123"
+	assert.Equal("tenants/acme/transactions/", tx.GetRootPath())
+	assert.Equal("tenants/acme/transactions/archive/", tx.GetArchiveRootPath())
+	id, start := tx.GetIdAndTimeoutMicrosFromPath(tx.GetPath() + "/")
+	assert.Equal(tx.Id, id)
+	assert.Equal(uint64(tx.StartMicroseconds), start)
+
+	token, err := tx.Token()
+	assert.NoError(err)
+	parsed, err := ParseTransactionToken(token)
+	assert.NoError(err)
+	assert.Equal(TransactionToken{Id: tx.Id, StartMicroseconds: tx.StartMicroseconds, TimeoutMicroseconds: tx.TimeoutMicroseconds, Etag: "abc123", Tenant: "acme"}, *parsed)
+	assert.Equal(tx.GetPath(), parsed.GetPath())
+}
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the layout of the values of time indices, in UTC, so that the lexicographic order of values is their chronological order, and
+// the entries of a year, month or day share a prefix. see PeriodPathPrefix
+const TIME_INDEX_LAYOUT = "2006/01/02/150405.000000000"
+
+// encodes a timestamp as the value of a time index, e.g. `2026/03/14/153000.000000000`. years before 0 or after 9999 cannot be
+// encoded, since they would not sort correctly.
+func EncodeTimeIndexValue(t time.Time) (string, error) {
+	t = t.UTC()
+	if t.Year() < 0 || t.Year() > 9999 {
+		return "", fmt.Errorf("ADB-0124 the time %s cannot be indexed, since its year is outside 0 to 9999", t)
+	}
+	return t.Format(TIME_INDEX_LAYOUT), nil
+}
+
+// the inverse of EncodeTimeIndexValue
+func DecodeTimeIndexValue(encoded string) (time.Time, error) {
+	t, err := time.ParseInLocation(TIME_INDEX_LAYOUT, encoded, time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ADB-0278 invalid time index value %s: %w", encoded, err)
+	}
+	return t, nil
+}
+
+// returns the start and end, i.e. the start of the next one, of a period of the form `YYYY`, `YYYY/MM` or `YYYY/MM/DD`, in UTC
+func ParsePeriod(period string) (time.Time, time.Time, error) {
+	layouts := []string{"2006", "2006/01", "2006/01/02"}
+	segments := strings.Count(period, "/")
+	if segments >= len(layouts) {
+		return time.Time{}, time.Time{}, fmt.Errorf("ADB-0279 invalid period %s, which must be a year, month or day, e.g. 2026/03", period)
+	}
+	start, err := time.ParseInLocation(layouts[segments], period, time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("ADB-0280 invalid period %s, which must be a year, month or day, e.g. 2026/03: %w", period, err)
+	}
+	switch segments {
+	case 0:
+		return start, start.AddDate(1, 0, 0), nil
+	case 1:
+		return start, start.AddDate(0, 1, 0), nil
+	default:
+		return start, start.AddDate(0, 0, 1), nil
+	}
+}
+
+// returns a copy of the table in which the index of the field is over time, adding the index if the field is not yet indexed.
+// the values of time indices are encoded with EncodeTimeIndexValue, so that they can be queried by range or period, and so that
+// the entries of old periods can be pruned by a lifecycle rule on their prefix. see PeriodPathPrefix
+func (t Table) WithTimeIndex(field string) Table {
+	indices := make([]Index, len(t.Indices), len(t.Indices)+1)
+	copy(indices, t.Indices)
+	found := false
+	for i := range indices {
+		if indices[i].Field == field {
+			indices[i].Time = true
+			found = true
+		}
+	}
+	if !found {
+		indices = append(indices, Index{Table: t, Field: field, Time: true})
+	}
+	t.Indices = indices
+	return t
+}
+
+// returns a copy of the table in which the index of the field is over time, and entities expire once the ttl has passed since
+// their value, adding the index if the field is not yet indexed. a ttl of zero means that the value is the time of expiry itself.
+// expired entities are deleted by SweepExpired, until which they can still be read.
+func (t Table) WithTTLIndex(field string, ttl time.Duration) Table {
+	t = t.WithTimeIndex(field)
+	for i := range t.Indices {
+		if t.Indices[i].Field == field {
+			t.Indices[i].TTL = ttl
+		}
+	}
+	return t
+}
+
+// the values of a TTL index before which entities have expired at the given time
+func (i *Index) ExpiredBefore(now time.Time) time.Time {
+	return now.Add(-i.TTL)
+}
+
+// path to the folder containing the entries of a time index for a period, e.g. `2026/03`, with a trailing slash, which can be used
+// as the prefix of a lifecycle rule that expires old entries. entries which have expired are no longer found by queries on the
+// index, but the data that they point to is unaffected.
+func (i *Index) PeriodPathPrefix(period string) (string, error) {
+	if !i.Time {
+		return "", fmt.Errorf("ADB-0125 the index %s has no periods, since it is not a time index", i.Field)
+	}
+	if _, _, err := ParsePeriod(period); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/", i.PathPrefix(), period), nil
+}
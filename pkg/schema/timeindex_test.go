@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeTimeIndexValue_PreservesChronologicalOrder(t *testing.T) {
+	assert := assert.New(t)
+	times := []time.Time{
+		{},
+		time.Date(999, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2026, 2, 28, 23, 59, 59, 999999999, time.UTC),
+		time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 1, 0, 0, 0, 1, time.UTC),
+		time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+	}
+	encoded := make([]string, len(times))
+	for i, tm := range times {
+		var err error
+		encoded[i], err = EncodeTimeIndexValue(tm)
+		assert.NoError(err)
+		decoded, err := DecodeTimeIndexValue(encoded[i])
+		assert.NoError(err)
+		assert.True(tm.Equal(decoded))
+	}
+	assert.True(slices.IsSorted(encoded))
+	assert.Equal("2026/03/10/090000.000000000", encoded[5])
+
+	// in UTC
+	encodedInZurich, err := EncodeTimeIndexValue(time.Date(2026, 3, 10, 10, 0, 0, 0, time.FixedZone("CET", 3600)))
+	assert.NoError(err)
+	assert.Equal(encoded[5], encodedInZurich)
+
+	_, err = EncodeTimeIndexValue(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.ErrorContains(err, "ADB-0124")
+	_, err = DecodeTimeIndexValue("2026-03-10")
+	assert.ErrorContains(err, "ADB-0278")
+}
+
+func TestParsePeriod(t *testing.T) {
+	assert := assert.New(t)
+	from, to, err := ParsePeriod("2026/02")
+	assert.NoError(err)
+	assert.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = ParsePeriod("2026")
+	assert.NoError(err)
+	assert.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = ParsePeriod("2026/12/31")
+	assert.NoError(err)
+	assert.Equal(time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), to)
+
+	for _, invalid := range []string{"", "March", "2026/13", "2026-03"} {
+		_, _, err = ParsePeriod(invalid)
+		assert.ErrorContains(err, "ADB-0280", invalid)
+	}
+	_, _, err = ParsePeriod("2026/03/14/10")
+	assert.ErrorContains(err, "ADB-0279")
+}
+
+func TestTable_WithTimeIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable("db", "event", []string{"Name"}).WithTimeIndex("OccurredAt")
+	assert.False(table.Indices[0].Time)
+	index := table.Indices[1]
+	assert.True(index.Time)
+	assert.Equal("db/event/indices/OccurredAt/2026/03/10/090000.000000000/db___event___1", index.Path("2026/03/10/090000.000000000", "1"))
+
+	prefix, err := index.PeriodPathPrefix("2026/03")
+	assert.NoError(err)
+	assert.Equal("db/event/indices/OccurredAt/2026/03/", prefix)
+	_, err = table.Indices[0].PeriodPathPrefix("2026/03")
+	assert.ErrorContains(err, "ADB-0125")
+}
+
+func TestWithTTLIndex(t *testing.T) {
+	assert := assert.New(t)
+	table := NewTable(NewDatabase("db"), "sessions", []string{"LastUsed"}).WithTTLIndex("LastUsed", time.Hour)
+	assert.Len(table.Indices, 1)
+	assert.True(table.Indices[0].Time)
+	assert.Equal(time.Hour, table.Indices[0].TTL)
+
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	assert.Equal(time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC), table.Indices[0].ExpiredBefore(now))
+
+	// the value is the time of expiry
+	table = table.WithTTLIndex("ExpiresAt", 0)
+	assert.Len(table.Indices, 2)
+	assert.Equal(now, table.Indices[1].ExpiredBefore(now))
+}
@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var tokenSigningKey []byte
+
+// sets the key with which transaction tokens are signed and verified. every service which hands off transactions must use the same key.
+func SetTransactionTokenKey(key []byte) {
+	tokenSigningKey = key
+}
+
+var InvalidTransactionTokenError = fmt.Errorf("Transaction token is invalid")
+
+// returned when creating or parsing a token before the key has been set
+var TransactionTokenKeyNotSetError = fmt.Errorf("ADB-0087 no transaction token key has been set, see SetTransactionTokenKey")
+
+// the contents of a transaction token
+type TransactionToken struct {
+	Id                  string
+	StartMicroseconds   int64
+	TimeoutMicroseconds int64
+	Etag                string
+	Tenant              Tenant
+}
+
+// returns a compact signed string, which identifies the transaction in its current state, so that it can be handed off to
+// another service, which continues it with ResumeFromToken. the transaction should no longer be used by this service.
+// returns a TransactionTokenKeyNotSetError if no key has been set.
+func (t *Transaction) Token() (string, error) {
+	if len(tokenSigningKey) == 0 {
+		return "", TransactionTokenKeyNotSetError
+	}
+	id := t.Id
+	if t.Tenant != DEFAULT_TENANT {
+		// ids contain no slashes, and the encoded tenant contains neither slashes nor dots
+		id = base64.RawURLEncoding.EncodeToString([]byte(t.Tenant)) + "/" + id
+	}
+	payload := strings.Join([]string{
+		id,
+		strconv.FormatInt(t.StartMicroseconds, 36),
+		strconv.FormatInt(t.TimeoutMicroseconds, 36),
+		t.Etag,
+	}, ".")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signToken(encoded)), nil
+}
+
+// verifies the signature of the token and returns its contents. returns a TransactionTokenKeyNotSetError if no key has been set.
+func ParseTransactionToken(token string) (*TransactionToken, error) {
+	if len(tokenSigningKey) == 0 {
+		return nil, TransactionTokenKeyNotSetError
+	}
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, fmt.Errorf("ADB-0088 %w, since it is malformed", InvalidTransactionTokenError)
+	}
+	actual, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(actual, signToken(encoded)) {
+		return nil, fmt.Errorf("ADB-0317 %w, since its signature is wrong", InvalidTransactionTokenError)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("ADB-0318 %w, since it is malformed", InvalidTransactionTokenError)
+	}
+	parts := strings.SplitN(string(payload), ".", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("ADB-0319 %w, since it is malformed", InvalidTransactionTokenError)
+	}
+	start, err1 := strconv.ParseInt(parts[1], 36, 64)
+	timeout, err2 := strconv.ParseInt(parts[2], 36, 64)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("ADB-0320 %w, since it is malformed", InvalidTransactionTokenError)
+	}
+	parsed := &TransactionToken{Id: parts[0], StartMicroseconds: start, TimeoutMicroseconds: timeout, Etag: parts[3]}
+	if encodedTenant, id, found := strings.Cut(parts[0], "/"); found {
+		tenant, err := base64.RawURLEncoding.DecodeString(encodedTenant)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0321 %w, since it is malformed", InvalidTransactionTokenError)
+		}
+		parsed.Id, parsed.Tenant = id, Tenant(tenant)
+	}
+	return parsed, nil
+}
+
+func signToken(encoded string) []byte {
+	mac := hmac.New(sha256.New, tokenSigningKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// the path of the transaction that the token refers to
+func (t *TransactionToken) GetPath() string {
+	return fmt.Sprintf("%s%s%d%s%s", t.Tenant.Prefix(), TRANSACTIONS_ROOT, t.StartMicroseconds, TIMESTAMP_ID_SEPARATOR, t.Id)
+}
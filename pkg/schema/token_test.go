@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_Token_RoundTripsAndIsVerified(t *testing.T) {
+	assert := assert.New(t)
+	SetTransactionTokenKey([]byte("secret"))
+	defer SetTransactionTokenKey(nil)
+
+	tx := NewTransaction(10 * time.Second)
+	tx.Etag = "abc123"
+	token, err := tx.Token()
+	assert.NoError(err)
+
+	parsed, err := ParseTransactionToken(token)
+	assert.NoError(err)
+	assert.Equal(TransactionToken{Id: tx.Id, StartMicroseconds: tx.StartMicroseconds, TimeoutMicroseconds: tx.TimeoutMicroseconds, Etag: "abc123"}, *parsed)
+	assert.Equal(tx.GetPath(), parsed.GetPath())
+
+	// tampered with
+	other := NewTransaction(time.Hour)
+	other.Etag = "abc123"
+	otherToken, err := other.Token()
+	assert.NoError(err)
+	otherPayload, _, _ := strings.Cut(otherToken, ".")
+	_, signature, _ := strings.Cut(token, ".")
+	_, err = ParseTransactionToken(otherPayload + "." + signature)
+	assert.True(errors.Is(err, InvalidTransactionTokenError))
+
+	// signed with a different key
+	SetTransactionTokenKey([]byte("another secret"))
+	_, err = ParseTransactionToken(token)
+	assert.True(errors.Is(err, InvalidTransactionTokenError))
+}
+
+func TestTransaction_Token_FailsWithoutAKey(t *testing.T) {
+	assert := assert.New(t)
+	SetTransactionTokenKey(nil)
+
+	tx := NewTransaction(10 * time.Second)
+	_, err := tx.Token()
+	assert.True(errors.Is(err, TransactionTokenKeyNotSetError))
+	_, err = ParseTransactionToken("abc.def")
+	assert.True(errors.Is(err, TransactionTokenKeyNotSetError))
+}
@@ -1,8 +1,12 @@
 package schema
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -12,8 +16,14 @@ import (
 
 const TX_ID = "Tx-Id" // minio doesn't support camel case. the transaction id that wrote this version. used to check if the version needs to be ignored, if the transaction is still in progress.
 const LAST_MODIFIED = "Last-Modified" // minio doesn't support camel case
+const TOMBSTONE_AND_EXISTS_UNTIL = "Tombstone-And-Exists-Until" // wow, minio doesn't support camel case
+const ENTRY_REWRITE = "Entry-Rewrite" // the LAST_MODIFIED of the entry which a version that only replaces its projection or record ETag rewrites, so that the entry is not hidden while it is rewritten
+const RECORD_ETAG = "Record-Etag" // the ETag of the record that an index entry belongs to, as it was when the entry was written
 const TIMESTAMP_ID_SEPARATOR = "___"
 const TRANSACTIONS_ROOT = "transactions/"
+const TRANSACTIONS_ARCHIVE_ROOT = TRANSACTIONS_ROOT + "archive/" // committed transactions, if archiving is enabled
+const STEP_COUNT = "Step-Count" // metadata of the persisted transaction, so that it can be assessed without being downloaded
+const APPROXIMATE_SIZE = "Approximate-Size" // metadata of the persisted transaction, in bytes
 
 type Transaction struct {
 	Id string `json:"id"`
@@ -21,16 +31,93 @@ type Transaction struct {
 	StartMicroseconds int64 `json:"startMicros"`
 	TimeoutMicroseconds int64 `json:"timeoutMicros"`
 	Steps []*TransactionStep `json:"steps"`
+
+	// the tenant that the transaction belongs to, which is stored below its prefix, or the default tenant. see Tenant
+	Tenant Tenant `json:"tenant,omitempty"`
 	
 	// key is path to object; allows the transaction to avoid reading things that it wrote or already read (enabling repeatable reads)
 	Cache map[string]*ObjectAndETag `json:"-"`
 
+	// serialises the entities of steps when they are executed. defaults to json.Marshal
+	Marshaller Marshaller `json:"-"`
+
+	// limits the objects cached from reads, which are otherwise kept until the transaction ends
+	CacheLimits CacheLimits `json:"-"`
+	reads *readCache
+
+	// if true, the objects that a read-only transaction reads are not cached, e.g. when a whole table is streamed in a single pass,
+	// so that memory does not grow with the size of the table. objects which are read again are read from the store again.
+	// ignored by transactions which are not read-only, since they validate what they read when they commit.
+	BypassCache bool `json:"-"`
+
 	// InProgress, Committing, RollingBack
 	State string `json:"state"`
+
+	// undo side effects outside of the store, if the transaction is rolled back. see Compensate
+	Compensations []*Compensation `json:"compensations,omitempty"`
+
+	// external resources which take part in the commit decision. they are not persisted.
+	Participants []Participant `json:"-"`
+
+	// custom user metadata added to every object version written by this transaction, e.g. an actor or request id, for provenance
+	UserMetadata map[string]string `json:"userMetadata,omitempty"`
+
+	// a transaction which is blocked by one with a lower priority may have it preempted, i.e. rolled back. zero by default.
+	Priority int `json:"priority,omitempty"`
+
+	// if true, the transaction may update and delete records which are pinned. false by default, see Table.WithPins
+	OverridePins bool `json:"overridePins,omitempty"`
+
+	// key is the path of an object, value is the paths whose steps must be applied before its steps. see DeclareDependency
+	Dependencies map[string][]string `json:"dependencies,omitempty"`
+
+	// the leases of single writer tables that steps were added under, which must still be held when committing. they are not persisted.
+	LeasePaths []string `json:"-"`
+
+	// the predicate of the steps being added, while within When
+	condition StepPredicate
+
+	// the paths of the objects which the transaction deletes, or is deleting. see MarkDeleting
+	deleting map[string]bool
+
+	// read-only transactions may read into the cache, but may not add steps. they are never persisted, and need not be committed.
+	ReadOnly bool `json:"readOnly"`
+
+	// populated when a commit fails, or a rollback happens, e.g. after a step failed, so that post-mortem debugging doesn't require
+	// correlating logs
+	AbortReason string `json:"abortReason,omitempty"`
+	FailedStepIndex *int `json:"failedStepIndex,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+
+	// the last step which failed, which only becomes the abort reason if the transaction is rolled back. see RememberStepFailure
+	stepFailure      error
+	stepFailureIndex int
+}
+
+// an external resource, e.g. another datastore or a message broker, which takes part in the commit decision alongside the
+// steps that write to the object store, XA-style.
+type Participant interface {
+	// called before the transaction is committed. if any participant returns an error, the whole transaction is rolled back.
+	Prepare(ctx context.Context, tx *Transaction) error
+
+	// called once the commit decision has been made and persisted
+	Commit(ctx context.Context, tx *Transaction) error
+
+	// called when the transaction is rolled back, including when another participant fails to prepare
+	Rollback(ctx context.Context, tx *Transaction) error
+}
+
+// registers the participant, so that it is prepared and committed, or rolled back, along with the transaction
+func (t *Transaction) Enlist(participant Participant) error {
+	if err := t.IsOk(); err != nil {
+		return err
+	}
+	t.Participants = append(t.Participants, participant)
+	return nil
 }
 
 func NewTransaction(timeout time.Duration) Transaction {
-	now := time.Now()
+	now := Now()
 	return Transaction{
 		Id: uuid.New().String(), 
 		Etag: "*",
@@ -42,14 +129,55 @@ func NewTransaction(timeout time.Duration) Transaction {
 	}
 }
 
+// creates a transaction which can only be used for reading, with repeatable reads thanks to the cache.
+// it is not persisted, so it saves writing and deleting the transaction object, and needs no commit.
+func NewReadOnlyTransaction(timeout time.Duration) Transaction {
+	t := NewTransaction(timeout)
+	t.ReadOnly = true
+	return t
+}
+
 func (t *Transaction) IsExpired() bool {
-	return time.Now().UnixMicro() > t.TimeoutMicroseconds
+	return Now().UnixMicro() > t.TimeoutMicroseconds
 }
 
 var TransactionAlreadyCommittedError = fmt.Errorf("Transaction is already committed")
 var TransactionAlreadyRolledBackError = fmt.Errorf("Transaction is already rolled back")
 var TransactionTimedOutError = fmt.Errorf("Transaction has timed out")
 
+var TransactionIsReadOnlyError = fmt.Errorf("Transaction is read-only")
+var TransactionRolledBackByCallerError = fmt.Errorf("Transaction was rolled back by the caller")
+var TransactionPreemptedError = fmt.Errorf("Transaction was preempted")
+
+var errorCodeRegex = regexp.MustCompile(`ADB-?[0-9]{4}`)
+
+// records why the transaction is being aborted. only the first failure is recorded, since later ones are usually a consequence of it.
+// Param: stepIndex - the index of the step that failed, or -1 if no particular step failed
+// Param: err - the error that caused the abort; its "ADB-xxxx" code is extracted if it has one
+func (t *Transaction) RecordFailure(stepIndex int, err error) {
+	if t.AbortReason != "" {
+		return
+	}
+	t.AbortReason = err.Error()
+	t.ErrorCode = errorCodeRegex.FindString(t.AbortReason)
+	if stepIndex >= 0 {
+		t.FailedStepIndex = &stepIndex
+	}
+}
+
+// remembers that a step failed, so that it is recorded as the abort reason if the transaction is rolled back, see StepFailure,
+// rather than straight away, since the caller may recover from the failure, e.g. by updating a record whose insert failed, and
+// commit the transaction.
+func (t *Transaction) RememberStepFailure(stepIndex int, err error) {
+	t.stepFailure = err
+	t.stepFailureIndex = stepIndex
+}
+
+// returns the index and error of the last step which failed, or nil if none did. see RememberStepFailure
+func (t *Transaction) StepFailure() (int, error) {
+	return t.stepFailureIndex, t.stepFailure
+}
+
 func (t *Transaction) IsOk() error {
 	if t.State == "Committing" {
 		return TransactionAlreadyCommittedError
@@ -67,10 +195,11 @@ func (t *Transaction) IsOk() error {
 }
 
 func (t *Transaction) GetPath() string {
-	return fmt.Sprintf("%s%d%s%s", TRANSACTIONS_ROOT, t.StartMicroseconds, TIMESTAMP_ID_SEPARATOR, t.Id)
+	return fmt.Sprintf("%s%d%s%s", t.GetRootPath(), t.StartMicroseconds, TIMESTAMP_ID_SEPARATOR, t.Id)
 }
 
 func (t *Transaction) GetIdAndTimeoutMicrosFromPath(path string) (string, uint64) {
+	_, path = TenantFromPath(path)
 	filename := path[len(TRANSACTIONS_ROOT):]
 	// trim any leading or trailing / characters
 	filename = strings.Trim(filename, "/")
@@ -87,8 +216,44 @@ func (t *Transaction) GetIdAndTimeoutMicrosFromPath(path string) (string, uint64
 	return id, timeout
 }
 
+// path of the transaction in the archive, once it has been committed
+func (t *Transaction) GetArchivePath() string {
+	return fmt.Sprintf("%s%d%s%s.json", t.GetArchiveRootPath(), t.StartMicroseconds, TIMESTAMP_ID_SEPARATOR, t.Id)
+}
+
+// path of the folder containing the transactions of the tenant of the transaction
 func (t *Transaction) GetRootPath() string {
-	return TRANSACTIONS_ROOT
+	return t.Tenant.Prefix() + TRANSACTIONS_ROOT
+}
+
+// path of the folder containing the committed transactions of the tenant of the transaction, if archiving is enabled
+func (t *Transaction) GetArchiveRootPath() string {
+	return t.Tenant.Prefix() + TRANSACTIONS_ARCHIVE_ROOT
+}
+
+// sets custom user metadata which is added to every object version written by this transaction, so that they carry
+// provenance without a separate audit write.
+// the key must be in canonical header form, e.g. "Actor-Id", since minio doesn't support camel case, and may not be one
+// of the keys used internally.
+func (t *Transaction) SetUserMetadata(key string, value string) error {
+	if err := validateUserMetadataKey(key); err != nil {
+		return err
+	}
+	if t.UserMetadata == nil {
+		t.UserMetadata = make(map[string]string)
+	}
+	t.UserMetadata[key] = value
+	return nil
+}
+
+func validateUserMetadataKey(key string) error {
+	if key == "" || key != http.CanonicalHeaderKey(key) {
+		return fmt.Errorf("ADB-0064 user metadata key %s must be in canonical form, i.e. %s", key, http.CanonicalHeaderKey(key))
+	}
+	if key == TX_ID || key == LAST_MODIFIED || key == TOMBSTONE_AND_EXISTS_UNTIL || key == FORMAT_VERSION_KEY || key == ENTRY_REWRITE || key == RECORD_ETAG {
+		return fmt.Errorf("ADB-0065 user metadata key %s is reserved", key)
+	}
+	return nil
 }
 
 // Param: Type - the type of the step
@@ -96,26 +261,54 @@ func (t *Transaction) GetRootPath() string {
 // Param: Path - the path of the object
 // Param: InitialETag - the initial ETag of the object, if "" then none is set and a change will always be successful
 // Param: Entity - the object itself
-// Returns: an error if the transaction is not InProgress or has timed out
-func (t *Transaction) AddStep(Type string, ContentType string, Path string, InitialETag string, Entity *any) error {
+// Returns: an error if the transaction is not InProgress, has timed out or is read-only
+func (t *Transaction) AddStep(Type StepType, ContentType string, Path string, InitialETag string, Entity *any) error {
+	return t.AddStepWithMetadata(Type, ContentType, Path, InitialETag, Entity, nil)
+}
+
+// like AddStep, but with extra user metadata for this step only, which is merged with that of the transaction.
+// Param: Metadata - extra user metadata, whose keys must be in canonical form, e.g. "Request-Id"
+func (t *Transaction) AddStepWithMetadata(Type StepType, ContentType string, Path string, InitialETag string, Entity *any, Metadata map[string]string) error {
+	return t.addStep(Type, ContentType, Path, InitialETag, Entity, nil, Metadata)
+}
+
+// like AddStep, but with the data that is written instead of the serialised entity, so that validators check what is written.
+// Param: Data - the data to write, or nil to serialise the entity
+func (t *Transaction) AddStepWithData(Type StepType, ContentType string, Path string, InitialETag string, Entity *any, Data *[]byte) error {
+	return t.addStep(Type, ContentType, Path, InitialETag, Entity, Data, nil)
+}
+
+// adds a step which writes a temporary object, whose content is already serialised. it is visible only to this transaction, and
+// removed when the transaction is committed or rolled back.
+func (t *Transaction) AddEphemeralStep(ContentType string, Path string, Data []byte) error {
+	return t.addStep(STEP_EPHEMERAL, ContentType, Path, "", nil, &Data, nil)
+}
+
+func (t *Transaction) addStep(Type StepType, ContentType string, Path string, InitialETag string, Entity *any, Data *[]byte, Metadata map[string]string) error {
 	if err := t.IsOk(); err != nil {
 		return err
 	}
-
-	userMetadata := map[string]string{
-		// don't add amz prefix here, since minio does it automatically
-		TX_ID: t.Id,
-		LAST_MODIFIED: fmt.Sprintf("%d", time.Now().UnixMicro()),
+	if t.ReadOnly {
+		return TransactionIsReadOnlyError
+	}
+	if !Type.IsValid() {
+		return fmt.Errorf("ADB-0074 unknown transaction step type %s", Type)
 	}
 
-	data := []byte{}
-	if Entity != nil {
-		var err error
-		data, err = json.Marshal(Entity)
-		if err != nil {
+	userMetadata := make(map[string]string, 3+len(t.UserMetadata)+len(Metadata))
+	for key, value := range t.UserMetadata {
+		userMetadata[key] = value
+	}
+	for key, value := range Metadata {
+		if err := validateUserMetadataKey(key); err != nil {
 			return err
 		}
+		userMetadata[key] = value
 	}
+	// don't add amz prefix here, since minio does it automatically
+	userMetadata[TX_ID] = t.Id
+	userMetadata[LAST_MODIFIED] = fmt.Sprintf("%d", Now().UnixMicro())
+	userMetadata[FORMAT_VERSION_KEY] = strconv.Itoa(OBJECT_FORMAT_VERSION)
 
 	step := TransactionStep{
 		Type: Type,
@@ -124,30 +317,157 @@ func (t *Transaction) AddStep(Type string, ContentType string, Path string, Init
 		InitialETag: InitialETag,
 		InitialVersionId: "",
 		UserMetadata: userMetadata,
-		Data: &data,
+		Data: Data,
 		Entity: Entity,
 		Executed: false,
+		Conditional: t.condition != nil,
+		condition: t.condition,
+	}
+	if err := t.validateStep(&step); err != nil {
+		return err
 	}
 	t.Steps = append(t.Steps, &step)
 
 	return nil
 }
 
+// removes the steps from the first one on, which were added by an operation that failed before they were stored with the
+// transaction, so that committing the transaction does not apply part of the operation
+func (t *Transaction) DiscardSteps(first int) {
+	if first < len(t.Steps) {
+		t.Steps = t.Steps[:first]
+	}
+}
+
+// the kind of a transaction step. the values are persisted with transactions, so that they can be rolled back, and must not change.
+type StepType string
+
+const (
+	// the object itself
+	STEP_INSERT_DATA StepType = "insert-data"
+	STEP_UPDATE_DATA StepType = "update-data"
+	STEP_DELETE_DATA StepType = "delete-data" // writes a tombstone
+
+	// index entries which are put
+	STEP_INSERT_ADD_INDEX StepType = "insert-add-index"
+	STEP_UPDATE_ADD_INDEX StepType = "update-add-index"
+	// a new version of an index entry which already exists, containing the new projection of a covering index, and the new ETag
+	// of the record
+	STEP_UPDATE_INDEX_PROJECTION StepType = "update-index-projection"
+
+	// index entries which are deleted on commit
+	STEP_UPDATE_REMOVE_INDEX StepType = "update-remove-index"
+	STEP_DELETE_REMOVE_INDEX StepType = "delete-remove-index"
+
+	// the list of index entries of an object, used to find the entries to remove when it is updated or deleted
+	STEP_INSERT_REVERSE_INDICES StepType = "insert-reverse-indices"
+	STEP_UPDATE_REVERSE_INDICES StepType = "update-reverse-indices"
+	STEP_DELETE_REVERSE_INDICES StepType = "delete-reverse-indices"
+
+	// a temporary object, which is removed when the transaction is committed or rolled back
+	STEP_EPHEMERAL StepType = "ephemeral"
+)
+
+var ALL_STEP_TYPES = []StepType{
+	STEP_INSERT_DATA, STEP_UPDATE_DATA, STEP_DELETE_DATA,
+	STEP_INSERT_ADD_INDEX, STEP_UPDATE_ADD_INDEX, STEP_UPDATE_INDEX_PROJECTION,
+	STEP_UPDATE_REMOVE_INDEX, STEP_DELETE_REMOVE_INDEX,
+	STEP_INSERT_REVERSE_INDICES, STEP_UPDATE_REVERSE_INDICES, STEP_DELETE_REVERSE_INDICES,
+	STEP_EPHEMERAL,
+}
+
+func (s StepType) IsValid() bool {
+	return slices.Contains(ALL_STEP_TYPES, s)
+}
+
+// true if the step writes the object itself, rather than index entries
+func (s StepType) IsData() bool {
+	return s == STEP_INSERT_DATA || s == STEP_UPDATE_DATA || s == STEP_DELETE_DATA
+}
+
+// true if the step replaces a versioned object with an empty version, i.e. the object itself or its list of index entries
+func (s StepType) IsDelete() bool {
+	return s == STEP_DELETE_DATA || s == STEP_DELETE_REVERSE_INDICES
+}
+
+// true if the step puts an index entry
+func (s StepType) IsIndexPut() bool {
+	return s == STEP_INSERT_ADD_INDEX || s == STEP_UPDATE_ADD_INDEX || s == STEP_UPDATE_INDEX_PROJECTION
+}
+
+// true if the step deletes an index entry
+func (s StepType) IsIndexDelete() bool {
+	return s == STEP_UPDATE_REMOVE_INDEX || s == STEP_DELETE_REMOVE_INDEX
+}
+
+// serialises an entity so that it can be written to the store
+type Marshaller func(entity any) ([]byte, error)
+
+// returns the serialised entity of the step, which is empty if it has none, e.g. for deletions.
+// entities are serialised lazily, so that steps which are never executed, because the transaction fails first, cost nothing.
+// the result is kept, so that the step is serialised at most once.
+func (t *Transaction) StepData(step *TransactionStep) ([]byte, error) {
+	if step.Data != nil {
+		return *step.Data, nil
+	}
+	data := []byte{}
+	if step.Entity != nil {
+		marshal := t.Marshaller
+		if marshal == nil {
+			marshal = json.Marshal
+		}
+		var err error
+		data, err = marshal(*step.Entity)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0071 failed to serialise the entity for path %s: %w", step.Path, err)
+		}
+	}
+	step.Data = &data
+	return data, nil
+}
+
+// the approximate number of bytes that the transaction has written, i.e. the serialised entities of the steps executed so far
+func (t *Transaction) ApproximateSize() int64 {
+	size := int64(0)
+	for _, step := range t.Steps {
+		if step.Data != nil {
+			size += int64(len(*step.Data))
+		}
+	}
+	return size
+}
+
 // information that is required in order to rollback a transaction
 type TransactionStep struct {
-	Type string `json:"type"`
+	Type StepType `json:"type"`
 	ContentType string `json:"contentType"`
 	Path string `json:"path"`
 	InitialETag string `json:"initialEtag"`
-	// used for deletion
+	// used for deletion, the version that was replaced by the tombstone, so that it can be restored on rollback
 	InitialVersionId string `json:"initialVersionId"`
 	UserMetadata map[string]string `json:"userMetadata"`
+	// the serialised entity, which is only set once the step is executed. see StepData
 	Data *[]byte `json:"-"`
 	Entity *any `json:"-"`
 	Executed bool `json:"executed"`
 
+	// how the object is written, if its table has storage options. see TableStorage
+	Storage *TableStorage `json:"storage,omitempty"`
+
 	FinalETag *string `json:"finalEtag"`
 	FinalVersionId *string `json:"finalVersionId"`
+
+	// the ETag of the version that an update replaced, if it is known. see Changed
+	PreviousETag *string `json:"previousEtag,omitempty"`
+
+	// if set, the step writes an index entry which carries the ETag of its record. see Index.RecordETags
+	RecordETag bool `json:"recordEtag,omitempty"`
+
+	// conditional steps are applied on commit, if their predicate is met, otherwise they are skipped. see When
+	Conditional bool `json:"conditional,omitempty"`
+	ConditionMet bool `json:"conditionMet,omitempty"`
+	Skipped bool `json:"skipped,omitempty"`
+	condition StepPredicate
 }
 
 func (step *TransactionStep) SetFinalETagAndVersionId(finalETag *string, finalVersionId *string) {
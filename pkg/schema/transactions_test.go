@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_StepData_IsSerialisedLazilyAndOnce(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	calls := 0
+	tx.Marshaller = func(entity any) ([]byte, error) {
+		calls++
+		return []byte("custom"), nil
+	}
+
+	var entity any = map[string]string{"id": "1"}
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/account/data/1.json", "*", &entity))
+	assert.NoError(tx.AddStep(STEP_DELETE_DATA, "application/json", "db/account/data/2.json", "etag", nil))
+	assert.Equal(0, calls)
+	assert.Nil(tx.Steps[0].Data)
+
+	data, err := tx.StepData(tx.Steps[0])
+	assert.NoError(err)
+	assert.Equal("custom", string(data))
+	_, err = tx.StepData(tx.Steps[0])
+	assert.NoError(err)
+	assert.Equal(1, calls)
+
+	// deletions have no entity, so they are written as empty objects
+	data, err = tx.StepData(tx.Steps[1])
+	assert.NoError(err)
+	assert.Empty(data)
+	assert.Equal(1, calls)
+}
+
+func TestTransaction_AddStep_RejectsUnknownStepTypes(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+
+	err := tx.AddStep(StepType("upsert-data"), "application/json", "db/account/data/1.json", "*", nil)
+	assert.ErrorContains(err, "ADB-0074")
+	assert.Empty(tx.Steps)
+
+	for _, stepType := range ALL_STEP_TYPES {
+		assert.NoError(tx.AddStep(stepType, "application/json", "db/account/data/1.json", "*", nil))
+	}
+	assert.True(STEP_DELETE_DATA.IsData())
+	assert.True(STEP_UPDATE_ADD_INDEX.IsIndexPut())
+	assert.True(STEP_DELETE_REMOVE_INDEX.IsIndexDelete())
+	assert.False(STEP_DELETE_REVERSE_INDICES.IsIndexDelete())
+	assert.True(STEP_DELETE_REVERSE_INDICES.IsDelete())
+	assert.False(STEP_DELETE_REMOVE_INDEX.IsDelete())
+}
+
+func TestTransaction_ApproximateSize_CountsSerialisedSteps(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	var entity any = "abc"
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/account/data/1.json", "*", &entity))
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/account/data/2.json", "*", &entity))
+	assert.Equal(int64(0), tx.ApproximateSize()) // nothing is serialised yet
+
+	_, err := tx.StepData(tx.Steps[0])
+	assert.NoError(err)
+	assert.Equal(int64(len(`"abc"`)), tx.ApproximateSize())
+}
+
+func TestTransaction_AddEphemeralStep_KeepsTheContentAsIs(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	var seen []byte
+	unregister := RegisterStepValidator(func(tx *Transaction, step *TransactionStep, data []byte) error {
+		seen = data
+		return nil
+	})
+	defer unregister()
+
+	assert.NoError(tx.AddEphemeralStep("text/csv", "ephemeral/1/staging.csv", []byte("a,b\n1,2\n")))
+	assert.Equal(STEP_EPHEMERAL, tx.Steps[0].Type)
+	assert.Equal("", tx.Steps[0].InitialETag)
+	assert.Equal([]byte("a,b\n1,2\n"), seen)
+	data, err := tx.StepData(tx.Steps[0])
+	assert.NoError(err)
+	assert.Equal([]byte("a,b\n1,2\n"), data)
+	assert.False(STEP_EPHEMERAL.IsData())
+}
+
+func TestTransaction_AddStep_StampsTheFormatVersion(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+
+	var entity any = map[string]string{"id": "1"}
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/account/data/1.json", "*", &entity))
+	assert.Equal("1", tx.Steps[0].UserMetadata[FORMAT_VERSION_KEY])
+
+	assert.Error(tx.AddStepWithMetadata(STEP_INSERT_DATA, "application/json", "db/account/data/2.json", "*", &entity, map[string]string{FORMAT_VERSION_KEY: "99"}))
+	assert.Error(tx.SetUserMetadata(FORMAT_VERSION_KEY, "99"))
+}
+
+func TestTransaction_MetadataOfIndexEntriesIsReserved(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+
+	for _, key := range []string{RECORD_ETAG, ENTRY_REWRITE} {
+		assert.Error(tx.AddStepWithMetadata(STEP_INSERT_ADD_INDEX, "text/plain", "db/account/indices/Name/jo/john/db___account___1", "*", nil, map[string]string{key: "x"}), key)
+		assert.Error(tx.SetUserMetadata(key, "x"), key)
+	}
+	assert.True(STEP_UPDATE_INDEX_PROJECTION.IsIndexPut())
+}
+
+func TestTransaction_DiscardSteps(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	var entity any = "x"
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/t/data/1.json", "*", &entity))
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "db/t/data/2.json", "*", &entity))
+	tx.DiscardSteps(1)
+	assert.Equal(1, len(tx.Steps))
+	assert.Equal("db/t/data/1.json", tx.Steps[0].Path)
+	tx.DiscardSteps(5)
+	assert.Equal(1, len(tx.Steps))
+}
+
+func TestTransaction_RememberStepFailure_DoesNotRecordTheAbortReason(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	_, err := tx.StepFailure()
+	assert.NoError(err)
+
+	tx.RememberStepFailure(0, fmt.Errorf("ADB-0001 first"))
+	tx.RememberStepFailure(2, fmt.Errorf("ADB-0002 second"))
+	assert.Empty(tx.AbortReason)
+	index, err := tx.StepFailure()
+	assert.Equal(2, index)
+	assert.EqualError(err, "ADB-0002 second")
+}
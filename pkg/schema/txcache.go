@@ -0,0 +1,205 @@
+package schema
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// limits the objects that a transaction caches from reads. zero values mean unlimited.
+// objects that the transaction itself writes or deletes are never evicted, since the transaction relies on them to see its own
+// changes, so they do not count towards the limits.
+type CacheLimits struct {
+	MaxEntries int
+	MaxBytes   int64
+
+	// evicting an object means that it is read again from the store if it is needed again, and a version written by a transaction
+	// which was still in progress the first time, and has since committed, might be read. set this to fail instead of evicting,
+	// when repeatable reads are more important than memory.
+	// note that objects which are evicted, rather than spilled, are also no longer checked by Validate.
+	// ignored if Spill is set, since spilled objects are restored rather than read again.
+	FailInsteadOfEvict bool
+
+	// if set, evicted objects are spilled, and restored from there when they are needed again, so that reads remain repeatable
+	Spill CacheSpill
+}
+
+// stores objects that are evicted from a transaction cache, for the lifetime of the transaction
+type CacheSpill interface {
+	Spill(ctx context.Context, path string, data []byte) error
+
+	// returns false if nothing was spilled for the path
+	Restore(ctx context.Context, path string) ([]byte, bool, error)
+}
+
+// what is spilled for an evicted object
+type spilledObject struct {
+	ETag   *string         `json:"etag,omitempty"`
+	Exists bool            `json:"exists"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+var TransactionCacheFullError = fmt.Errorf("Transaction cache is full")
+
+// an object that was cached because it was read
+type cachedRead struct {
+	path string
+	size int64
+}
+
+// tracks the objects cached from reads, least recently used at the front
+type readCache struct {
+	lru      *list.List
+	elements map[string]*list.Element
+	bytes    int64
+	// the ETag of each object that was spilled, or nil if it does not exist within the transaction
+	spilled map[string]*string
+}
+
+// returns the cached object, if there is one, and marks it as recently used. objects that were spilled are restored.
+// a nil object with true means that the object does not exist within the transaction.
+// restored objects contain a json.RawMessage, since the type of the entity is unknown here.
+func (t *Transaction) GetCached(ctx context.Context, path string) (*ObjectAndETag, bool, error) {
+	cached, ok := t.Cache[path]
+	if ok && t.reads != nil {
+		if element, tracked := t.reads.elements[path]; tracked {
+			t.reads.lru.MoveToBack(element)
+		}
+	}
+	if !ok && t.reads != nil {
+		if _, spilled := t.reads.spilled[path]; spilled {
+			return t.restore(ctx, path)
+		}
+	}
+	return cached, ok, nil
+}
+
+// caches an object that was read, evicting the least recently read objects if the limits are exceeded.
+// Param: size - the number of bytes that the object was read from
+// returns a TransactionCacheFullError if the limits would be exceeded and the transaction fails instead of evicting.
+func (t *Transaction) CacheRead(ctx context.Context, path string, object *ObjectAndETag, size int64) error {
+	if t.ReadOnly && t.BypassCache {
+		return nil
+	}
+	if t.reads == nil {
+		t.reads = &readCache{lru: list.New(), elements: make(map[string]*list.Element), spilled: make(map[string]*string)}
+	}
+	if t.CacheLimits.FailInsteadOfEvict && t.CacheLimits.Spill == nil {
+		additionalEntries, additionalBytes := 1, size
+		if element, ok := t.reads.elements[path]; ok {
+			// replaced rather than added
+			additionalEntries, additionalBytes = 0, size-element.Value.(*cachedRead).size
+		}
+		if t.exceedsCacheLimits(additionalEntries, additionalBytes) {
+			return fmt.Errorf("ADB-0069 unable to cache %s without evicting objects that were read, since the limits %+v are reached: %w", path, t.CacheLimits, TransactionCacheFullError)
+		}
+	}
+	t.untrackRead(path)
+	for t.reads.lru.Len() > 0 && t.exceedsCacheLimits(1, size) {
+		evicted := t.reads.lru.Front().Value.(*cachedRead)
+		if t.CacheLimits.Spill != nil {
+			if err := t.spill(ctx, evicted.path); err != nil {
+				return err
+			}
+		}
+		t.untrackRead(evicted.path)
+		delete(t.Cache, evicted.path)
+	}
+	t.Cache[path] = object
+	t.reads.elements[path] = t.reads.lru.PushBack(&cachedRead{path: path, size: size})
+	t.reads.bytes += size
+	return nil
+}
+
+// caches an object that the transaction wrote, or nil if it deleted it.
+// it is never evicted.
+func (t *Transaction) CacheWrite(path string, object *ObjectAndETag) {
+	t.untrackRead(path)
+	if t.reads != nil {
+		// anything spilled is older than what was written
+		delete(t.reads.spilled, path)
+	}
+	t.Cache[path] = object
+}
+
+// returns the ETags of the objects which exist within the transaction and were spilled from its cache, keyed by path, so that
+// Validate can check them without restoring them
+func (t *Transaction) SpilledETags() map[string]string {
+	etags := make(map[string]string)
+	if t.reads == nil {
+		return etags
+	}
+	for path, etag := range t.reads.spilled {
+		if etag != nil {
+			etags[path] = *etag
+		}
+	}
+	return etags
+}
+
+func (t *Transaction) spill(ctx context.Context, path string) error {
+	toSpill := spilledObject{}
+	cached := t.Cache[path]
+	if cached != nil {
+		data, err := json.Marshal(*cached.Object)
+		if err != nil {
+			return fmt.Errorf("ADB-0097 unable to marshal %s in order to spill it from the transaction cache: %w", path, err)
+		}
+		toSpill = spilledObject{ETag: cached.ETag, Exists: true, Data: data}
+	}
+	data, err := json.Marshal(toSpill)
+	if err != nil {
+		return fmt.Errorf("ADB-0097 unable to marshal %s in order to spill it from the transaction cache: %w", path, err)
+	}
+	if err := t.CacheLimits.Spill.Spill(ctx, path, data); err != nil {
+		return fmt.Errorf("ADB-0098 unable to spill %s from the transaction cache: %w", path, err)
+	}
+	t.reads.spilled[path] = nil
+	if cached != nil {
+		t.reads.spilled[path] = cached.ETag
+	}
+	return nil
+}
+
+func (t *Transaction) restore(ctx context.Context, path string) (*ObjectAndETag, bool, error) {
+	data, found, err := t.CacheLimits.Spill.Restore(ctx, path)
+	if err != nil {
+		return nil, false, fmt.Errorf("ADB-0099 unable to restore %s to the transaction cache: %w", path, err)
+	}
+	if !found {
+		return nil, false, fmt.Errorf("ADB-0099 unable to restore %s to the transaction cache, since it is missing from the spill", path)
+	}
+	restored := spilledObject{}
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return nil, false, fmt.Errorf("ADB-0099 unable to unmarshal %s restored to the transaction cache: %w", path, err)
+	}
+	var object *ObjectAndETag
+	if restored.Exists {
+		var a any = restored.Data
+		object = &ObjectAndETag{Object: &a, ETag: restored.ETag}
+	}
+	if err := t.CacheRead(ctx, path, object, int64(len(restored.Data))); err != nil {
+		return nil, false, err
+	}
+	return object, true, nil
+}
+
+func (t *Transaction) exceedsCacheLimits(additionalEntries int, additionalBytes int64) bool {
+	limits := t.CacheLimits
+	if limits.MaxEntries > 0 && t.reads.lru.Len()+additionalEntries > limits.MaxEntries {
+		return true
+	}
+	return limits.MaxBytes > 0 && t.reads.bytes+additionalBytes > limits.MaxBytes
+}
+
+func (t *Transaction) untrackRead(path string) {
+	if t.reads == nil {
+		return
+	}
+	if element, ok := t.reads.elements[path]; ok {
+		t.reads.bytes -= element.Value.(*cachedRead).size
+		t.reads.lru.Remove(element)
+		delete(t.reads.elements, path)
+	}
+}
@@ -0,0 +1,138 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func cached(etag string) *ObjectAndETag {
+	return &ObjectAndETag{ETag: &etag}
+}
+
+func TestTransaction_CacheRead_EvictsLeastRecentlyUsed(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	tx.CacheLimits = CacheLimits{MaxEntries: 2}
+
+	assert.NoError(tx.CacheRead(context.Background(), "a", cached("1"), 10))
+	assert.NoError(tx.CacheRead(context.Background(), "b", cached("2"), 10))
+	_, ok, _ := tx.GetCached(context.Background(), "a") // so that b is now the least recently used
+	assert.True(ok)
+	assert.NoError(tx.CacheRead(context.Background(), "c", cached("3"), 10))
+
+	_, ok, _ = tx.GetCached(context.Background(), "b")
+	assert.False(ok)
+	_, ok, _ = tx.GetCached(context.Background(), "a")
+	assert.True(ok)
+	_, ok, _ = tx.GetCached(context.Background(), "c")
+	assert.True(ok)
+}
+
+func TestTransaction_CacheRead_BypassedByReadOnlyTransactions(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewReadOnlyTransaction(10 * time.Second)
+	tx.BypassCache = true
+	assert.NoError(tx.CacheRead(context.Background(), "a", cached("1"), 10))
+	_, ok, _ := tx.GetCached(context.Background(), "a")
+	assert.False(ok)
+
+	writable := NewTransaction(10 * time.Second)
+	writable.BypassCache = true
+	assert.NoError(writable.CacheRead(context.Background(), "a", cached("1"), 10))
+	_, ok, _ = writable.GetCached(context.Background(), "a")
+	assert.True(ok)
+}
+
+func TestTransaction_CacheRead_EvictsByBytesButNeverWrites(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	tx.CacheLimits = CacheLimits{MaxBytes: 100}
+
+	tx.CacheWrite("written", cached("0"))
+	assert.NoError(tx.CacheRead(context.Background(), "a", cached("1"), 60))
+	assert.NoError(tx.CacheRead(context.Background(), "b", cached("2"), 60))
+
+	_, ok, _ := tx.GetCached(context.Background(), "a")
+	assert.False(ok)
+	_, ok, _ = tx.GetCached(context.Background(), "b")
+	assert.True(ok)
+	_, ok, _ = tx.GetCached(context.Background(), "written")
+	assert.True(ok)
+
+	// writing an object that was read pins it
+	tx.CacheWrite("b", nil)
+	assert.NoError(tx.CacheRead(context.Background(), "c", cached("3"), 100))
+	object, ok, _ := tx.GetCached(context.Background(), "b")
+	assert.True(ok)
+	assert.Nil(object)
+}
+
+func TestTransaction_CacheRead_FailsInsteadOfEvicting(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	tx.CacheLimits = CacheLimits{MaxEntries: 1, FailInsteadOfEvict: true}
+
+	assert.NoError(tx.CacheRead(context.Background(), "a", cached("1"), 10))
+	// reading the same object again replaces it, rather than adding to it
+	assert.NoError(tx.CacheRead(context.Background(), "a", cached("1"), 10))
+	err := tx.CacheRead(context.Background(), "b", cached("2"), 10)
+	assert.True(errors.Is(err, TransactionCacheFullError))
+
+	_, ok, _ := tx.GetCached(context.Background(), "a")
+	assert.True(ok)
+	_, ok, _ = tx.GetCached(context.Background(), "b")
+	assert.False(ok)
+}
+
+type memorySpill map[string][]byte
+
+func (m memorySpill) Spill(ctx context.Context, path string, data []byte) error {
+	m[path] = data
+	return nil
+}
+
+func (m memorySpill) Restore(ctx context.Context, path string) ([]byte, bool, error) {
+	data, ok := m[path]
+	return data, ok, nil
+}
+
+func TestTransaction_CacheRead_SpillsAndRestores(t *testing.T) {
+	assert := assert.New(t)
+	tx := NewTransaction(10 * time.Second)
+	spill := memorySpill{}
+	tx.CacheLimits = CacheLimits{MaxEntries: 1, FailInsteadOfEvict: true, Spill: spill}
+
+	var a any = map[string]string{"name": "John"}
+	etag := "1"
+	assert.NoError(tx.CacheRead(context.Background(), "a", &ObjectAndETag{Object: &a, ETag: &etag}, 10))
+	assert.NoError(tx.CacheRead(context.Background(), "b", nil, 0)) // spills a, rather than failing
+	assert.Contains(spill, "a")
+
+	object, ok, err := tx.GetCached(context.Background(), "a") // spills b
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal("1", *object.ETag)
+	assert.JSONEq(`{"name":"John"}`, string((*object.Object).(json.RawMessage)))
+	assert.Contains(spill, "b")
+
+	object, ok, err = tx.GetCached(context.Background(), "b")
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Nil(object)
+
+	// so that Validate can check them
+	assert.Equal(map[string]string{"a": "1"}, tx.SpilledETags())
+
+	// written objects are not restored from the spill
+	tx.CacheWrite("a", cached("2"))
+	tx.CacheWrite("b", cached("3"))
+	object, ok, err = tx.GetCached(context.Background(), "a")
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal("2", *object.ETag)
+}
@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// checks a step before it is added to a transaction. the step has not yet been added, so the steps of the transaction are the ones
+// that precede it. data is the serialised entity, which is empty if it has none, e.g. for deletions.
+// validators must not add steps to the transaction themselves.
+type StepValidator func(tx *Transaction, step *TransactionStep, data []byte) error
+
+// checks the transaction as a whole, before it is committed, e.g. that the debits and credits of its steps balance
+type CommitValidator func(tx *Transaction) error
+
+var StepRejectedError = fmt.Errorf("Step was rejected by a validator")
+var CommitRejectedError = fmt.Errorf("Commit was rejected by a validator")
+
+type registeredStepValidator struct {
+	id int
+	// "" for all tables, otherwise `<database>/<table>/`
+	prefix    string
+	validator StepValidator
+}
+
+type registeredCommitValidator struct {
+	id        int
+	validator CommitValidator
+}
+
+// in the order that they were registered, which is the order that they are called in
+var validatorsMu sync.RWMutex
+var stepValidators = make([]registeredStepValidator, 0)
+var commitValidators = make([]registeredCommitValidator, 0)
+var nextValidatorId = 0
+
+// registers a validator which is called for every step added to any transaction.
+// returns a function which unregisters it.
+func RegisterStepValidator(validator StepValidator) func() {
+	return registerStepValidator("", validator)
+}
+
+// registers a validator which is called for the steps which write the objects of the given table. it is not called for the steps
+// which write the entries of its indices or its reverse indices, whose data is not an entity of the table.
+// returns a function which unregisters it.
+func RegisterTableStepValidator(table Table, validator StepValidator) func() {
+	return registerStepValidator(table.Folder(), validator)
+}
+
+func registerStepValidator(prefix string, validator StepValidator) func() {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	id := nextValidatorId
+	nextValidatorId++
+	stepValidators = append(stepValidators, registeredStepValidator{id: id, prefix: prefix, validator: validator})
+	return func() {
+		validatorsMu.Lock()
+		defer validatorsMu.Unlock()
+		stepValidators = slices.DeleteFunc(stepValidators, func(r registeredStepValidator) bool { return r.id == id })
+	}
+}
+
+// registers a validator which is called whenever a transaction is about to be committed.
+// returns a function which unregisters it.
+func RegisterCommitValidator(validator CommitValidator) func() {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	id := nextValidatorId
+	nextValidatorId++
+	commitValidators = append(commitValidators, registeredCommitValidator{id: id, validator: validator})
+	return func() {
+		validatorsMu.Lock()
+		defer validatorsMu.Unlock()
+		commitValidators = slices.DeleteFunc(commitValidators, func(r registeredCommitValidator) bool { return r.id == id })
+	}
+}
+
+func (t *Transaction) validateStep(step *TransactionStep) error {
+	validatorsMu.RLock()
+	applicable := make([]StepValidator, 0, len(stepValidators))
+	for _, registered := range stepValidators {
+		// validators of a table only see the objects of the table, not the entries of its indices
+		if registered.prefix == "" || (step.Type.IsData() && strings.HasPrefix(step.Path, registered.prefix)) {
+			applicable = append(applicable, registered.validator)
+		}
+	}
+	validatorsMu.RUnlock()
+	if len(applicable) == 0 {
+		// so that the entity is not serialised before it needs to be
+		return nil
+	}
+
+	data, err := t.StepData(step)
+	if err != nil {
+		return err
+	}
+	for _, validator := range applicable {
+		if err := validator(t, step, data); err != nil {
+			return fmt.Errorf("ADB-0104 %s step for path %s was rejected: %w: %w", step.Type, step.Path, StepRejectedError, err)
+		}
+	}
+	return nil
+}
+
+// calls the registered commit validators, returning the first error, which wraps a CommitRejectedError
+func (t *Transaction) ValidateForCommit() error {
+	validatorsMu.RLock()
+	applicable := make([]CommitValidator, 0, len(commitValidators))
+	for _, registered := range commitValidators {
+		applicable = append(applicable, registered.validator)
+	}
+	validatorsMu.RUnlock()
+
+	for _, validator := range applicable {
+		if err := validator(t); err != nil {
+			return fmt.Errorf("ADB-0105 commit of tx %s was rejected: %w: %w", t.Id, CommitRejectedError, err)
+		}
+	}
+	return nil
+}
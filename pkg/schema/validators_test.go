@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type posting struct {
+	Amount int `json:"amount"`
+}
+
+func TestValidators_TableStepValidatorOnlyAppliesToItsTable(t *testing.T) {
+	assert := assert.New(t)
+	database := NewDatabase("validators")
+	ledger := NewTable(database, "ledger", []string{})
+	other := NewTable(database, "other", []string{})
+
+	paths := []string{}
+	unregister := RegisterTableStepValidator(ledger, func(tx *Transaction, step *TransactionStep, data []byte) error {
+		paths = append(paths, step.Path)
+		p := posting{}
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		if p.Amount == 0 {
+			return errors.New("zero amount")
+		}
+		return nil
+	})
+	defer unregister()
+
+	tx := NewTransaction(10 * time.Second)
+	var valid any = posting{Amount: 1}
+	var invalid any = posting{}
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", ledger.Path("1"), "*", &valid))
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", other.Path("1"), "*", &invalid))
+	err := tx.AddStep(STEP_INSERT_DATA, "application/json", ledger.Path("2"), "*", &invalid)
+	assert.ErrorIs(err, StepRejectedError)
+	assert.Equal(2, len(tx.Steps))
+	assert.Equal([]string{ledger.Path("1"), ledger.Path("2")}, paths)
+
+	unregister()
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", ledger.Path("2"), "*", &invalid))
+}
+
+func TestValidators_CommitValidatorSeesAllSteps(t *testing.T) {
+	assert := assert.New(t)
+	defer RegisterCommitValidator(func(tx *Transaction) error {
+		total := 0
+		for _, step := range tx.Steps {
+			data, err := tx.StepData(step)
+			if err != nil {
+				return err
+			}
+			p := posting{}
+			if err := json.Unmarshal(data, &p); err != nil {
+				return err
+			}
+			total += p.Amount
+		}
+		if total != 0 {
+			return errors.New("debits and credits do not balance")
+		}
+		return nil
+	})()
+
+	tx := NewTransaction(10 * time.Second)
+	var debit any = posting{Amount: -5}
+	var credit any = posting{Amount: 5}
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "a", "*", &debit))
+	assert.ErrorIs(tx.ValidateForCommit(), CommitRejectedError)
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", "b", "*", &credit))
+	assert.NoError(tx.ValidateForCommit())
+}
+
+func TestValidators_TableStepValidatorIsNotCalledForIndexSteps(t *testing.T) {
+	assert := assert.New(t)
+	ledger := NewTable(NewDatabase("validators"), "ledger-indexed", []string{"Amount"})
+	index, err := ledger.GetIndex("Amount")
+	assert.NoError(err)
+
+	paths := []string{}
+	unregister := RegisterTableStepValidator(ledger, func(tx *Transaction, step *TransactionStep, data []byte) error {
+		paths = append(paths, step.Path)
+		return nil
+	})
+	defer unregister()
+
+	tx := NewTransaction(10 * time.Second)
+	var entity any = posting{Amount: 1}
+	var entry any = ""
+	assert.NoError(tx.AddStep(STEP_INSERT_DATA, "application/json", ledger.Path("1"), "*", &entity))
+	assert.NoError(tx.AddStep(STEP_INSERT_ADD_INDEX, "text/plain", index.Path("1", "1"), "*", &entry))
+	assert.NoError(tx.AddStep(STEP_INSERT_REVERSE_INDICES, "text/plain", ledger.IndicesPath("1"), "*", &entry))
+	assert.Equal([]string{ledger.Path("1")}, paths)
+}
+
+func TestValidators_SeeTheDataOfStepsWhichAreAddedWithIt(t *testing.T) {
+	assert := assert.New(t)
+	seen := [][]byte{}
+	unregister := RegisterStepValidator(func(tx *Transaction, step *TransactionStep, data []byte) error {
+		seen = append(seen, data)
+		return nil
+	})
+	defer unregister()
+
+	tx := NewTransaction(10 * time.Second)
+	var entity any = posting{Amount: 1}
+	data := []byte(`{"amount":1,"extra":true}`)
+	assert.NoError(tx.AddStepWithData(STEP_UPDATE_DATA, "application/json", "db/ledger/data/1.json", "", &entity, &data))
+	assert.NoError(tx.AddStepWithData(STEP_UPDATE_DATA, "application/json", "db/ledger/data/2.json", "", &entity, nil))
+	if assert.Len(seen, 2) {
+		assert.Equal(data, seen[0])
+		assert.NotContains(string(seen[1]), "extra")
+	}
+	assert.Equal(&data, tx.Steps[0].Data)
+}
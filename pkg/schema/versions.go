@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// the version of tables that do not declare one
+const DEFAULT_SCHEMA_VERSION = "1.0.0"
+
+// major, minor and patch
+type SemanticVersion [3]int
+
+// parses a version like "1.2.3". an empty string is treated as DEFAULT_SCHEMA_VERSION, e.g. for definitions that were
+// registered before versions existed.
+func ParseSemanticVersion(version string) (SemanticVersion, error) {
+	if version == "" {
+		version = DEFAULT_SCHEMA_VERSION
+	}
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return SemanticVersion{}, fmt.Errorf("ADB-0044 invalid semantic version %s, expected major.minor.patch", version)
+	}
+	var v SemanticVersion
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return SemanticVersion{}, fmt.Errorf("ADB-0044 invalid semantic version %s, expected major.minor.patch", version)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// returns -1, 0 or 1 if v is less than, equal to, or greater than other
+func (v SemanticVersion) Compare(other SemanticVersion) int {
+	return slices.Compare(v[:], other[:])
+}
+
+// compares the definition expected by the code with the one in the registry, and returns a description of each
+// incompatibility, i.e. an empty slice if the code may run against the registered definition.
+// the code is compatible if the major versions are the same, and either the versions and definitions are identical, or the
+// code is newer and still has all the registered indices (it may add ones, but not drop them, since other services rely on them).
+// indices which both have must be stored alike, e.g. both numeric, unless the code declares a new revision of them.
+func (expected TableDefinition) IncompatibilitiesWith(registered TableDefinition) ([]string, error) {
+	expectedVersion, err := ParseSemanticVersion(expected.Version)
+	if err != nil {
+		return nil, err
+	}
+	registeredVersion, err := ParseSemanticVersion(registered.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s/%s", expected.Database, expected.Name)
+	problems := make([]string, 0)
+	if expectedVersion[0] != registeredVersion[0] {
+		problems = append(problems, fmt.Sprintf("%s: major version %s in code differs from %s in registry", name, expected.Version, registered.Version))
+	} else if expectedVersion.Compare(registeredVersion) < 0 {
+		problems = append(problems, fmt.Sprintf("%s: version %s in code is older than %s in registry", name, expected.Version, registered.Version))
+	}
+
+	for _, index := range registered.Indices {
+		if !slices.Contains(expected.Indices, index) {
+			problems = append(problems, fmt.Sprintf("%s: - index %s is in registry but not in code", name, index))
+		}
+	}
+	// entries at escaped paths cannot be found by the other, see WithEscapedPaths
+	if expected.EscapedPaths && !registered.EscapedPaths {
+		problems = append(problems, fmt.Sprintf("%s: ~ paths are escaped in code but not in registry", name))
+	} else if !expected.EscapedPaths && registered.EscapedPaths {
+		problems = append(problems, fmt.Sprintf("%s: ~ paths are escaped in registry but not in code", name))
+	}
+	// entries of indices which are stored differently cannot be read by the other, unless they are a new revision
+	for _, registeredOptions := range registered.IndexOptions {
+		for _, expectedOptions := range expected.IndexOptions {
+			if expectedOptions.Field == registeredOptions.Field && expectedOptions.Revision == registeredOptions.Revision && !expectedOptions.storedLike(registeredOptions) {
+				problems = append(problems, fmt.Sprintf("%s: ~ index %s revision %d is stored differently in code than in registry", name, expectedOptions.Field, expectedOptions.Revision))
+			}
+		}
+	}
+	if expectedVersion.Compare(registeredVersion) == 0 {
+		for _, index := range expected.Indices {
+			if !slices.Contains(registered.Indices, index) {
+				problems = append(problems, fmt.Sprintf("%s: + index %s is in code but not in registry, yet the version %s is the same", name, index, expected.Version))
+			}
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSemanticVersion(t *testing.T) {
+	assert := assert.New(t)
+	v, err := ParseSemanticVersion("1.2.3")
+	assert.Nil(err)
+	assert.Equal(SemanticVersion{1, 2, 3}, v)
+
+	v, err = ParseSemanticVersion("")
+	assert.Nil(err)
+	assert.Equal(SemanticVersion{1, 0, 0}, v)
+
+	_, err = ParseSemanticVersion("1.2")
+	assert.NotNil(err)
+	_, err = ParseSemanticVersion("1.x.3")
+	assert.NotNil(err)
+}
+
+func TestIncompatibilitiesWith(t *testing.T) {
+	assert := assert.New(t)
+	registered := TableDefinition{Database: "db", Name: "t", Indices: []string{"Name"}, Version: "1.1.0"}
+
+	// identical
+	problems, err := registered.IncompatibilitiesWith(registered)
+	assert.Nil(err)
+	assert.Empty(problems)
+
+	// newer minor version adding an index
+	problems, err = TableDefinition{Database: "db", Name: "t", Indices: []string{"Name", "Email"}, Version: "1.2.0"}.IncompatibilitiesWith(registered)
+	assert.Nil(err)
+	assert.Empty(problems)
+
+	// same version adding an index
+	problems, err = TableDefinition{Database: "db", Name: "t", Indices: []string{"Name", "Email"}, Version: "1.1.0"}.IncompatibilitiesWith(registered)
+	assert.Nil(err)
+	assert.Equal(1, len(problems))
+
+	// dropping an index
+	problems, err = TableDefinition{Database: "db", Name: "t", Indices: []string{}, Version: "1.2.0"}.IncompatibilitiesWith(registered)
+	assert.Nil(err)
+	assert.Equal(1, len(problems))
+
+	// older
+	problems, err = TableDefinition{Database: "db", Name: "t", Indices: []string{"Name"}, Version: "1.0.0"}.IncompatibilitiesWith(registered)
+	assert.Nil(err)
+	assert.Equal(1, len(problems))
+
+	// different major
+	problems, err = TableDefinition{Database: "db", Name: "t", Indices: []string{"Name"}, Version: "2.0.0"}.IncompatibilitiesWith(registered)
+	assert.Nil(err)
+	assert.Equal(1, len(problems))
+}
@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"slices"
+	"strings"
+)
+
+// returns the candidates for the word at the end of the line, i.e. keywords at the start of a statement, databases after USE and
+// SHOW TABLES FROM, tables after FROM, INTO, UPDATE and DESCRIBE, and the id and indexed fields of the table of the statement after
+// WHERE and AND. keywords are completed in upper case, if the word is. the tables are those that were read by Refresh.
+func (s *Shell) Complete(line string) []string {
+	words := strings.Fields(line)
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	previous := ""
+	if len(words) > 0 {
+		previous = strings.ToUpper(words[len(words)-1])
+	}
+
+	var candidates []string
+	switch {
+	case len(words) == 0:
+		candidates = KEYWORDS
+		if word != "" && word == strings.ToLower(word) {
+			candidates = make([]string, len(KEYWORDS))
+			for i, keyword := range KEYWORDS {
+				candidates[i] = strings.ToLower(keyword)
+			}
+		}
+	case previous == "USE" || (previous == "FROM" || previous == "IN") && len(words) >= 2 && strings.EqualFold(words[len(words)-2], "TABLES"):
+		candidates = s.databases()
+	case previous == "SHOW":
+		candidates = []string{"DATABASES", "TABLES"}
+	case previous == "FROM" || previous == "INTO" || previous == "UPDATE" || previous == "DESCRIBE" || previous == "DESC":
+		candidates = s.tableNames()
+	case previous == "WHERE" || previous == "AND":
+		candidates = s.fields(words)
+	}
+
+	completions := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(word)) {
+			completions = append(completions, candidate)
+		}
+	}
+	return completions
+}
+
+// the qualified names of all tables, and the names of those in the database that is in use
+func (s *Shell) tableNames() []string {
+	names := make([]string, 0, len(s.definitions))
+	for _, definition := range s.definitions {
+		if definition.Database == string(s.database) {
+			names = append(names, definition.Name)
+		}
+	}
+	for _, definition := range s.definitions {
+		names = append(names, definition.Database+"."+definition.Name)
+	}
+	return names
+}
+
+// the id and the indexed fields of the table after FROM, UPDATE or INTO in the words
+func (s *Shell) fields(words []string) []string {
+	for i, word := range words[:len(words)-1] {
+		if !slices.Contains([]string{"FROM", "INTO", "UPDATE"}, strings.ToUpper(word)) {
+			continue
+		}
+		database, name, qualified := strings.Cut(words[i+1], ".")
+		if !qualified {
+			database, name = string(s.database), words[i+1]
+		}
+		for _, definition := range s.definitions {
+			if definition.Database == database && definition.Name == name {
+				return append([]string{"id"}, definition.Indices...)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCompletingShell() *Shell {
+	s := NewShell(nil, nil, 0)
+	s.definitions = []schema.TableDefinition{
+		{Database: "bank", Name: "accounts", Indices: []string{"name", "owner"}},
+		{Database: "bank", Name: "orders", Indices: []string{"total"}},
+		{Database: "crm", Name: "contacts", Indices: []string{"email"}},
+	}
+	return s
+}
+
+func TestComplete_Keywords(t *testing.T) {
+	assert := assert.New(t)
+	s := newCompletingShell()
+
+	assert.Equal([]string{"SELECT", "SHOW"}, s.Complete("S"))
+	assert.Equal([]string{"select", "show"}, s.Complete("s"))
+	assert.Equal(KEYWORDS, s.Complete(""))
+	assert.Equal([]string{"DATABASES", "TABLES"}, s.Complete("SHOW "))
+}
+
+func TestComplete_DatabasesAndTables(t *testing.T) {
+	assert := assert.New(t)
+	s := newCompletingShell()
+
+	assert.Equal([]string{"bank", "crm"}, s.Complete("USE "))
+	assert.Equal([]string{"crm"}, s.Complete("SHOW TABLES FROM c"))
+
+	// only qualified names without a database in use
+	assert.Equal([]string{"bank.accounts", "bank.orders"}, s.Complete("SELECT * FROM bank"))
+	assert.Empty(s.Complete("SELECT * FROM acc"))
+
+	s.database = "bank"
+	assert.Equal([]string{"accounts"}, s.Complete("SELECT * FROM a"))
+	assert.Equal([]string{"accounts", "orders", "bank.accounts", "bank.orders", "crm.contacts"}, s.Complete("SELECT * FROM "))
+	assert.Equal([]string{"orders"}, s.Complete("INSERT INTO o"))
+	assert.Equal([]string{"crm.contacts"}, s.Complete("describe crm.c"))
+}
+
+func TestComplete_Fields(t *testing.T) {
+	assert := assert.New(t)
+	s := newCompletingShell()
+
+	assert.Equal([]string{"id", "name", "owner"}, s.Complete("SELECT * FROM bank.accounts WHERE "))
+	assert.Equal([]string{"owner"}, s.Complete("SELECT * FROM bank.accounts WHERE o"))
+	assert.Empty(s.Complete("SELECT * FROM bank.unknown WHERE "))
+
+	s.database = "crm"
+	assert.Equal([]string{"email"}, s.Complete("select * from contacts where e"))
+}
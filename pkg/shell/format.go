@@ -0,0 +1,148 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// the formats in which the shell writes results, see Shell.SetOutput
+const (
+	// aligned columns, for people
+	OUTPUT_TABLE = "table"
+	// a Result per statement, on a line of its own
+	OUTPUT_JSON = "json"
+	// each of the rows of the results on a line of its own, e.g. to pipe selected entities to other tools
+	OUTPUT_NDJSON = "ndjson"
+)
+
+var OUTPUTS = []string{OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_NDJSON}
+
+// the result of a statement, as it is written in the JSON output. the rows of each kind of statement are
+//
+//	SELECT                      the entities, as they are stored
+//	INSERT, UPDATE and DELETE   {"id": "<id>"}
+//	SHOW DATABASES              {"database": "<database>"}
+//	SHOW TABLES                 {"database": "<database>", "table": "<table>", "version": "<version>", "indices": ["<field>", ...]}
+//	DESCRIBE                    the minio.TableDescription of the table
+//
+// and there are none for the other statements. HELP writes its text in every format.
+type Result struct {
+	// one of the STATEMENT constants
+	Statement string `json:"statement"`
+	// never null
+	Rows []any `json:"rows"`
+}
+
+// writes the result of a statement in the output format of the shell, i.e. as JSON, or else with the function, if it is not nil,
+// which writes it as a table
+func (s *Shell) writeResult(kind string, rows []any, table func()) error {
+	if rows == nil {
+		rows = make([]any, 0)
+	}
+	switch s.output {
+	case OUTPUT_JSON:
+		return json.NewEncoder(s.out).Encode(Result{Statement: kind, Rows: rows})
+	case OUTPUT_NDJSON:
+		encoder := json.NewEncoder(s.out)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+	default:
+		if table != nil {
+			table()
+		}
+	}
+	return nil
+}
+
+// the longest value that is shown in a column. longer ones are cut short with an ellipsis
+const MAX_COLUMN_WIDTH = 60
+
+// writes the documents as a table, whose columns are the id, followed by the other keys of all documents in alphabetical order,
+// and the number of rows. strings are shown as they are, and other values as JSON
+func writeDocuments(out io.Writer, documents []*map[string]any) {
+	columns := make([]string, 0)
+	for _, document := range documents {
+		for key := range *document {
+			if !slices.Contains(columns, key) {
+				columns = append(columns, key)
+			}
+		}
+	}
+	slices.SortFunc(columns, func(a, b string) int {
+		// the id comes first
+		if strings.EqualFold(a, "id") != strings.EqualFold(b, "id") {
+			if strings.EqualFold(a, "id") {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	rows := make([][]string, len(documents))
+	for i, document := range documents {
+		rows[i] = make([]string, len(columns))
+		for j, column := range columns {
+			value, ok := (*document)[column]
+			switch {
+			case !ok:
+			case value == nil:
+				rows[i][j] = "null"
+			default:
+				if s, isString := value.(string); isString {
+					rows[i][j] = s
+				} else {
+					b, _ := json.Marshal(value)
+					rows[i][j] = string(b)
+				}
+			}
+		}
+	}
+	writeTable(out, columns, rows)
+}
+
+// writes the rows with their columns aligned, under a header, followed by the number of rows
+func writeTable(out io.Writer, columns []string, rows [][]string) {
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.ReplaceAll(row[i], "\n", " ")
+			if utf8.RuneCountInString(row[i]) > MAX_COLUMN_WIDTH {
+				row[i] = string([]rune(row[i])[:MAX_COLUMN_WIDTH-1]) + "…"
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(row[i]))
+		}
+	}
+	line := func(cells []string) {
+		padded := make([]string, len(cells))
+		for i, cell := range cells {
+			padded[i] = cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		}
+		fmt.Fprintln(out, strings.TrimRight(strings.Join(padded, " | "), " "))
+	}
+	if len(columns) > 0 {
+		line(columns)
+		separators := make([]string, len(columns))
+		for i, width := range widths {
+			separators[i] = strings.Repeat("-", width)
+		}
+		fmt.Fprintln(out, strings.Join(separators, "-+-"))
+		for _, row := range rows {
+			line(row)
+		}
+	}
+	if len(rows) == 1 {
+		fmt.Fprintln(out, "(1 row)")
+	} else {
+		fmt.Fprintf(out, "(%d rows)\n", len(rows))
+	}
+}
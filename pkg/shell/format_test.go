@@ -0,0 +1,91 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDocuments_TheIdComesFirst(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+
+	writeDocuments(out, []*map[string]any{
+		{"name": "John", "id": "a1", "age": float64(42)},
+		{"id": "a2", "name": nil, "tags": []any{"x"}},
+	})
+
+	assert.Equal(`id | age | name | tags
+---+-----+------+------
+a1 | 42  | John |
+a2 |     | null | ["x"]
+(2 rows)
+`, out.String())
+}
+
+func TestWriteTable_CutsLongValuesShort(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+
+	writeTable(out, []string{"body"}, [][]string{{strings.Repeat("é", MAX_COLUMN_WIDTH+1)}})
+
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(strings.Repeat("é", MAX_COLUMN_WIDTH-1)+"…", lines[2])
+	assert.Equal("(1 row)", lines[3])
+}
+
+func TestWriteTable_Empty(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+
+	writeTable(out, nil, nil)
+
+	assert.Equal("(0 rows)\n", out.String())
+}
+
+func TestWriteResult_InEachOutput(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+	s := NewShell(nil, out, 0)
+	rows := []any{map[string]any{"id": "a1"}, map[string]any{"id": "a2"}}
+
+	assert.NoError(s.SetOutput(OUTPUT_JSON))
+	assert.NoError(s.writeResult(STATEMENT_SELECT, rows, func() { t.Fatal("not a table") }))
+	assert.NoError(s.Execute(context.Background(), "USE bank"))
+	assert.Equal(`{"statement":"select","rows":[{"id":"a1"},{"id":"a2"}]}
+{"statement":"use","rows":[]}
+`, out.String())
+
+	out.Reset()
+	assert.NoError(s.SetOutput(OUTPUT_NDJSON))
+	assert.NoError(s.writeResult(STATEMENT_SELECT, rows, nil))
+	assert.NoError(s.Execute(context.Background(), "USE bank"))
+	assert.Equal(`{"id":"a1"}
+{"id":"a2"}
+`, out.String())
+
+	out.Reset()
+	assert.NoError(s.SetOutput(OUTPUT_TABLE))
+	assert.NoError(s.writeResult(STATEMENT_BEGIN, nil, func() { out.WriteString("BEGIN\n") }))
+	assert.Equal("BEGIN\n", out.String())
+
+	assert.Error(s.SetOutput("xml"))
+}
+
+func TestRun_StopsAtTheFirstStatementThatFails(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+	s := NewShell(nil, out, 0)
+	assert.NoError(s.SetOutput(OUTPUT_JSON))
+
+	err := s.Run(context.Background(), strings.NewReader("USE bank\n\nCOMMIT\nUSE crm\n"))
+
+	if assert.Error(err) {
+		assert.True(strings.HasPrefix(err.Error(), "line 3: ADB-0240"), err)
+	}
+	assert.Equal("{\"statement\":\"use\",\"rows\":[]}\n", out.String())
+	assert.Equal("abstrastore:bank> ", s.Prompt())
+}
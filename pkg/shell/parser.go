@@ -0,0 +1,480 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the kinds of statements of the language of the shell, see Parse
+const (
+	STATEMENT_SELECT         = "select"
+	STATEMENT_INSERT         = "insert"
+	STATEMENT_UPDATE         = "update"
+	STATEMENT_DELETE         = "delete"
+	STATEMENT_BEGIN          = "begin"
+	STATEMENT_COMMIT         = "commit"
+	STATEMENT_ROLLBACK       = "rollback"
+	STATEMENT_USE            = "use"
+	STATEMENT_SHOW_DATABASES = "showDatabases"
+	STATEMENT_SHOW_TABLES    = "showTables"
+	STATEMENT_DESCRIBE       = "describe"
+	STATEMENT_HELP           = "help"
+	STATEMENT_EXIT           = "exit"
+)
+
+// the operators of conditions
+const (
+	CONDITION_EQUALS      = "="
+	CONDITION_MATCHES     = "matches"
+	CONDITION_IS_NULL     = "isNull"
+	CONDITION_IS_NOT_NULL = "isNotNull"
+	// `from <= value < to`, either of which may be missing
+	CONDITION_RANGE = "range"
+)
+
+// the keywords of the language, which are completed at the start of a statement
+var KEYWORDS = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "BEGIN", "COMMIT", "ROLLBACK", "USE", "SHOW", "DESCRIBE", "HELP", "EXIT"}
+
+// a parsed statement, of which only the fields that its kind uses are set
+type Statement struct {
+	// one of the STATEMENT constants
+	Kind string
+	// empty if the table is not qualified, in which case it is in the database that is in use
+	Database string
+	Table    string
+	Where    *Condition
+	// zero if the results are not limited
+	Limit int
+	// of inserts and updates
+	Document map[string]any
+}
+
+// a condition over an indexed field, or the id
+type Condition struct {
+	Field string
+	// one of the CONDITION constants
+	Operator string
+	// a number is its text
+	Value string
+	// of ranges
+	From *string
+	To   *string
+}
+
+// true if the condition is over the id of the entities, rather than an indexed field
+func (c Condition) IsId() bool {
+	return strings.EqualFold(c.Field, "id")
+}
+
+// parses a statement of the language of the shell, which is a subset of SQL over the indices of tables, i.e.
+//
+//	SELECT * FROM [<database>.]<table> [WHERE <condition>] [LIMIT <n>]
+//	INSERT INTO [<database>.]<table> <json object>
+//	UPDATE [<database>.]<table> SET <json object>
+//	DELETE FROM [<database>.]<table> WHERE id = '<id>'
+//	BEGIN | COMMIT | ROLLBACK
+//	USE <database>
+//	SHOW DATABASES | SHOW TABLES [FROM <database>]
+//	DESCRIBE [<database>.]<table>
+//	HELP | EXIT
+//
+// where a condition is `<field> = <value>`, `<field> IS [NOT] NULL`, `<field> MATCHES '<regex>'`, or a range, i.e.
+// `<field> >= <value> [AND <field> < <value>]` or `<field> < <value>`. values are 'quoted strings', in which quotes are doubled,
+// or numbers. keywords are not case sensitive, and a statement may end with a semicolon. fails with ADB-0162 if it is not a
+// statement.
+func Parse(line string) (*Statement, error) {
+	p := &parser{}
+	if err := p.tokenize(line); err != nil {
+		return nil, err
+	}
+	statement, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind == tokenSymbol && p.peek().text == ";" {
+		p.next()
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %s", p.peek().text)
+	}
+	return statement, nil
+}
+
+const (
+	tokenWord   = "word"
+	tokenString = "string"
+	tokenNumber = "number"
+	tokenSymbol = "symbol"
+	tokenJson   = "json"
+	tokenEnd    = "end"
+)
+
+type token struct {
+	kind string
+	text string
+}
+
+type parser struct {
+	tokens   []token
+	position int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("ADB-0162 syntax error: "+format, args...)
+}
+
+// splits the line into tokens. a json object is a single token, which runs until the end of the object
+func (p *parser) tokenize(line string) error {
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '{':
+			decoder := json.NewDecoder(strings.NewReader(line[i:]))
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return p.errorf("invalid JSON: %s", err)
+			}
+			p.tokens = append(p.tokens, token{tokenJson, string(raw)})
+			i += int(decoder.InputOffset())
+		case c == '\'':
+			value := strings.Builder{}
+			j := i + 1
+			for ; ; j++ {
+				if j >= len(line) {
+					return p.errorf("unterminated string")
+				}
+				if line[j] == '\'' {
+					if j+1 < len(line) && line[j+1] == '\'' {
+						value.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				value.WriteByte(line[j])
+			}
+			p.tokens = append(p.tokens, token{tokenString, value.String()})
+			i = j + 1
+		case c == '>' || c == '<':
+			if i+1 < len(line) && line[i+1] == '=' {
+				p.tokens = append(p.tokens, token{tokenSymbol, line[i : i+2]})
+				i += 2
+			} else {
+				p.tokens = append(p.tokens, token{tokenSymbol, line[i : i+1]})
+				i++
+			}
+		case c == '=' || c == '*' || c == ';' || c == ',':
+			p.tokens = append(p.tokens, token{tokenSymbol, line[i : i+1]})
+			i++
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(line) && strings.IndexByte("0123456789.eE+-", line[j]) >= 0 {
+				j++
+			}
+			if _, err := strconv.ParseFloat(line[i:j], 64); err != nil {
+				return p.errorf("invalid number %s", line[i:j])
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, line[i:j]})
+			i = j
+		case isWordCharacter(c):
+			j := i + 1
+			for j < len(line) && (isWordCharacter(line[j]) || line[j] == '-' || line[j] == '.' || (line[j] >= '0' && line[j] <= '9')) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokenWord, line[i:j]})
+			i = j
+		default:
+			return p.errorf("unexpected character %q", c)
+		}
+	}
+	return nil
+}
+
+func isWordCharacter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{tokenEnd, "the end of the statement"}
+	}
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if !p.done() {
+		p.position++
+	}
+	return t
+}
+
+func (p *parser) done() bool {
+	return p.position >= len(p.tokens)
+}
+
+// true, and consumes it, if the next token is the keyword
+func (p *parser) accept(keyword string) bool {
+	if t := p.peek(); t.kind == tokenWord && strings.EqualFold(t.text, keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(keywords ...string) error {
+	for _, keyword := range keywords {
+		if !p.accept(keyword) {
+			return p.errorf("expected %s, but got %s", keyword, p.peek().text)
+		}
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if t := p.next(); t.kind != tokenSymbol || t.text != symbol {
+		return p.errorf("expected %s, but got %s", symbol, t.text)
+	}
+	return nil
+}
+
+func (p *parser) word(what string) (string, error) {
+	t := p.next()
+	if t.kind != tokenWord {
+		return "", p.errorf("expected %s, but got %s", what, t.text)
+	}
+	return t.text, nil
+}
+
+func (p *parser) value() (string, error) {
+	t := p.next()
+	if t.kind != tokenString && t.kind != tokenNumber {
+		return "", p.errorf("expected a value, but got %s", t.text)
+	}
+	return t.text, nil
+}
+
+// a table, which may be qualified by its database, i.e. `<database>.<table>`. the names of databases do not contain dots
+func (p *parser) table(statement *Statement) error {
+	name, err := p.word("a table")
+	if err != nil {
+		return err
+	}
+	if database, table, ok := strings.Cut(name, "."); ok {
+		statement.Database, statement.Table = database, table
+	} else {
+		statement.Table = name
+	}
+	if statement.Table == "" {
+		return p.errorf("expected a table, but got %s", name)
+	}
+	return nil
+}
+
+func (p *parser) document() (map[string]any, error) {
+	t := p.next()
+	if t.kind != tokenJson {
+		return nil, p.errorf("expected a JSON object, but got %s", t.text)
+	}
+	var document map[string]any
+	if err := json.Unmarshal([]byte(t.text), &document); err != nil {
+		return nil, p.errorf("invalid JSON: %s", err)
+	}
+	return document, nil
+}
+
+func (p *parser) statement() (*Statement, error) {
+	start := p.next()
+	if start.kind != tokenWord {
+		return nil, p.errorf("expected a statement, but got %s", start.text)
+	}
+	statement := &Statement{}
+	switch strings.ToUpper(start.text) {
+	case "SELECT":
+		statement.Kind = STATEMENT_SELECT
+		if err := p.expectSymbol("*"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("FROM"); err != nil {
+			return nil, err
+		}
+		if err := p.table(statement); err != nil {
+			return nil, err
+		}
+		if p.accept("WHERE") {
+			condition, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+			statement.Where = condition
+		}
+		if p.accept("LIMIT") {
+			t := p.next()
+			limit, err := strconv.Atoi(t.text)
+			if t.kind != tokenNumber || err != nil || limit < 1 {
+				return nil, p.errorf("expected a positive limit, but got %s", t.text)
+			}
+			statement.Limit = limit
+		}
+	case "INSERT":
+		statement.Kind = STATEMENT_INSERT
+		if err := p.expect("INTO"); err != nil {
+			return nil, err
+		}
+		if err := p.table(statement); err != nil {
+			return nil, err
+		}
+		document, err := p.document()
+		if err != nil {
+			return nil, err
+		}
+		statement.Document = document
+	case "UPDATE":
+		statement.Kind = STATEMENT_UPDATE
+		if err := p.table(statement); err != nil {
+			return nil, err
+		}
+		if err := p.expect("SET"); err != nil {
+			return nil, err
+		}
+		document, err := p.document()
+		if err != nil {
+			return nil, err
+		}
+		statement.Document = document
+	case "DELETE":
+		statement.Kind = STATEMENT_DELETE
+		if err := p.expect("FROM"); err != nil {
+			return nil, err
+		}
+		if err := p.table(statement); err != nil {
+			return nil, err
+		}
+		if err := p.expect("WHERE"); err != nil {
+			return nil, err
+		}
+		condition, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		if !condition.IsId() || condition.Operator != CONDITION_EQUALS {
+			return nil, p.errorf("entities are deleted by their id, i.e. WHERE id = '<id>'")
+		}
+		statement.Where = condition
+	case "BEGIN":
+		statement.Kind = STATEMENT_BEGIN
+	case "COMMIT":
+		statement.Kind = STATEMENT_COMMIT
+	case "ROLLBACK":
+		statement.Kind = STATEMENT_ROLLBACK
+	case "USE":
+		statement.Kind = STATEMENT_USE
+		database, err := p.word("a database")
+		if err != nil {
+			return nil, err
+		}
+		statement.Database = database
+	case "SHOW":
+		switch {
+		case p.accept("DATABASES"):
+			statement.Kind = STATEMENT_SHOW_DATABASES
+		case p.accept("TABLES"):
+			statement.Kind = STATEMENT_SHOW_TABLES
+			if p.accept("FROM") || p.accept("IN") {
+				database, err := p.word("a database")
+				if err != nil {
+					return nil, err
+				}
+				statement.Database = database
+			}
+		default:
+			return nil, p.errorf("expected DATABASES or TABLES, but got %s", p.peek().text)
+		}
+	case "DESCRIBE", "DESC":
+		statement.Kind = STATEMENT_DESCRIBE
+		if err := p.table(statement); err != nil {
+			return nil, err
+		}
+	case "HELP":
+		statement.Kind = STATEMENT_HELP
+	case "EXIT", "QUIT":
+		statement.Kind = STATEMENT_EXIT
+	default:
+		return nil, p.errorf("unknown statement %s", start.text)
+	}
+	return statement, nil
+}
+
+func (p *parser) condition() (*Condition, error) {
+	field, err := p.word("a field")
+	if err != nil {
+		return nil, err
+	}
+	condition := &Condition{Field: field}
+	switch t := p.peek(); {
+	case t.kind == tokenSymbol && t.text == "=":
+		p.next()
+		condition.Operator = CONDITION_EQUALS
+		if condition.Value, err = p.value(); err != nil {
+			return nil, err
+		}
+	case p.accept("IS"):
+		condition.Operator = CONDITION_IS_NULL
+		if p.accept("NOT") {
+			condition.Operator = CONDITION_IS_NOT_NULL
+		}
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+	case p.accept("MATCHES"):
+		condition.Operator = CONDITION_MATCHES
+		t := p.next()
+		if t.kind != tokenString {
+			return nil, p.errorf("expected a regular expression, but got %s", t.text)
+		}
+		condition.Value = t.text
+	case t.kind == tokenSymbol && t.text == ">=":
+		p.next()
+		condition.Operator = CONDITION_RANGE
+		from, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		condition.From = &from
+		if p.accept("AND") {
+			other, err := p.word("a field")
+			if err != nil {
+				return nil, err
+			}
+			if other != field {
+				return nil, p.errorf("a range is over a single field, but %s is not %s", other, field)
+			}
+			if err := p.expectSymbol("<"); err != nil {
+				return nil, err
+			}
+			to, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			condition.To = &to
+		}
+	case t.kind == tokenSymbol && t.text == "<":
+		p.next()
+		condition.Operator = CONDITION_RANGE
+		to, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		condition.To = &to
+	default:
+		return nil, p.errorf("expected =, IS, MATCHES, >= or <, but got %s", t.text)
+	}
+	if condition.IsId() && condition.Operator != CONDITION_EQUALS {
+		return nil, p.errorf("the id can only be compared with =")
+	}
+	return condition, nil
+}
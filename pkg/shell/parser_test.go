@@ -0,0 +1,123 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse_Select(t *testing.T) {
+	assert := assert.New(t)
+
+	statement, err := Parse("select * from accounts;")
+	assert.NoError(err)
+	assert.Equal(&Statement{Kind: STATEMENT_SELECT, Table: "accounts"}, statement)
+
+	statement, err = Parse("SELECT * FROM bank.accounts WHERE name = 'O''Brien' LIMIT 10")
+	assert.NoError(err)
+	assert.Equal("bank", statement.Database)
+	assert.Equal("accounts", statement.Table)
+	assert.Equal(&Condition{Field: "name", Operator: CONDITION_EQUALS, Value: "O'Brien"}, statement.Where)
+	assert.Equal(10, statement.Limit)
+
+	statement, err = Parse("SELECT * FROM accounts WHERE id = 'a1'")
+	assert.NoError(err)
+	assert.True(statement.Where.IsId())
+
+	statement, err = Parse("SELECT * FROM accounts WHERE name IS NOT NULL")
+	assert.NoError(err)
+	assert.Equal(CONDITION_IS_NOT_NULL, statement.Where.Operator)
+
+	statement, err = Parse("SELECT * FROM accounts WHERE name MATCHES '^J.*'")
+	assert.NoError(err)
+	assert.Equal(CONDITION_MATCHES, statement.Where.Operator)
+	assert.Equal("^J.*", statement.Where.Value)
+}
+
+func TestParse_Ranges(t *testing.T) {
+	assert := assert.New(t)
+
+	statement, err := Parse("SELECT * FROM orders WHERE total >= 10 AND total < 20.5")
+	assert.NoError(err)
+	assert.Equal(CONDITION_RANGE, statement.Where.Operator)
+	assert.Equal("10", *statement.Where.From)
+	assert.Equal("20.5", *statement.Where.To)
+
+	statement, err = Parse("SELECT * FROM orders WHERE total < 20")
+	assert.NoError(err)
+	assert.Nil(statement.Where.From)
+	assert.Equal("20", *statement.Where.To)
+
+	_, err = Parse("SELECT * FROM orders WHERE total >= 10 AND count < 20")
+	assert.Error(err)
+}
+
+func TestParse_Writes(t *testing.T) {
+	assert := assert.New(t)
+
+	statement, err := Parse(`INSERT INTO accounts {"id": "a1", "name": "John", "age": 42}`)
+	assert.NoError(err)
+	assert.Equal(STATEMENT_INSERT, statement.Kind)
+	assert.Equal(map[string]any{"id": "a1", "name": "John", "age": float64(42)}, statement.Document)
+
+	statement, err = Parse(`update bank.accounts set {"id": "a1", "name": "Jane"}`)
+	assert.NoError(err)
+	assert.Equal(STATEMENT_UPDATE, statement.Kind)
+	assert.Equal("bank", statement.Database)
+	assert.Equal("Jane", statement.Document["name"])
+
+	statement, err = Parse("DELETE FROM accounts WHERE id = 'a1'")
+	assert.NoError(err)
+	assert.Equal(STATEMENT_DELETE, statement.Kind)
+	assert.Equal("a1", statement.Where.Value)
+
+	// only by id
+	_, err = Parse("DELETE FROM accounts WHERE name = 'John'")
+	assert.Error(err)
+}
+
+func TestParse_Others(t *testing.T) {
+	assert := assert.New(t)
+
+	for line, kind := range map[string]string{
+		"BEGIN":          STATEMENT_BEGIN,
+		"commit;":        STATEMENT_COMMIT,
+		"Rollback":       STATEMENT_ROLLBACK,
+		"USE bank":       STATEMENT_USE,
+		"SHOW DATABASES": STATEMENT_SHOW_DATABASES,
+		"SHOW TABLES":    STATEMENT_SHOW_TABLES,
+		"DESC accounts":  STATEMENT_DESCRIBE,
+		"describe a.b":   STATEMENT_DESCRIBE,
+		"help":           STATEMENT_HELP,
+		"quit":           STATEMENT_EXIT,
+	} {
+		statement, err := Parse(line)
+		assert.NoError(err, line)
+		assert.Equal(kind, statement.Kind, line)
+	}
+
+	statement, err := Parse("SHOW TABLES IN bank")
+	assert.NoError(err)
+	assert.Equal("bank", statement.Database)
+}
+
+func TestParse_SyntaxErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, line := range []string{
+		"",
+		"DROP TABLE accounts",
+		"SELECT name FROM accounts",
+		"SELECT * FROM accounts LIMIT 0",
+		"SELECT * FROM accounts WHERE name = 'unterminated",
+		"INSERT INTO accounts [1, 2]",
+		"SHOW INDICES",
+		"COMMIT now",
+	} {
+		_, err := Parse(line)
+		if assert.Error(err, line) {
+			assert.True(strings.HasPrefix(err.Error(), "ADB-0162"), line)
+		}
+	}
+}
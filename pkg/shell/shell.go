@@ -0,0 +1,486 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// returned by Execute for EXIT
+var ErrExit = errors.New("exit")
+
+const HELP = `statements, whose keywords are not case sensitive:
+  SELECT * FROM [<database>.]<table> [WHERE <condition>] [LIMIT <n>]
+  INSERT INTO [<database>.]<table> <json object>
+  UPDATE [<database>.]<table> SET <json object>     the entity must have been selected first
+  DELETE FROM [<database>.]<table> WHERE id = '<id>' the entity must have been selected first
+  BEGIN | COMMIT | ROLLBACK                         statements outside a transaction commit on their own, and a write
+                                                    which fails within one rolls it back
+  USE <database>
+  SHOW DATABASES | SHOW TABLES [FROM <database>]
+  DESCRIBE [<database>.]<table>
+  HELP | EXIT
+conditions, over the id or an indexed field:
+  <field> = <value> | <field> IS [NOT] NULL | <field> MATCHES '<regex>'
+  <field> >= <value> [AND <field> < <value>] | <field> < <value>
+`
+
+// an interactive shell over the tables in the schema registry, e.g. for poking at data while operating a service. the entities
+// are read and written as JSON objects, since the shell does not know their types, so tables whose indices are computed, and
+// so cannot be resolved from the registry, cannot be used. see Parse for the language.
+type Shell struct {
+	repo *minio.MinioRepository
+	out  io.Writer
+	// the timeout of the transactions that the shell begins
+	timeout time.Duration
+
+	// empty unless one is in use
+	database schema.Database
+	// nil unless a transaction was begun
+	tx *schema.Transaction
+	// the ETags of the entities that were read, keyed by path, with which they are updated and deleted
+	etags map[string]string
+	// the tables in the registry, which are completed. nil until they are read, see Refresh
+	definitions []schema.TableDefinition
+	// one of the OUTPUT constants
+	output string
+}
+
+func NewShell(repo *minio.MinioRepository, out io.Writer, timeout time.Duration) *Shell {
+	return &Shell{repo: repo, out: out, timeout: timeout, etags: make(map[string]string), output: OUTPUT_TABLE}
+}
+
+// sets the format in which results are written, which is one of the OUTPUT constants, see Result. fails with ADB-0238 if it is
+// not one of them.
+func (s *Shell) SetOutput(output string) error {
+	if !slices.Contains(OUTPUTS, output) {
+		return fmt.Errorf("ADB-0238 unknown output %s, rather than one of %s", output, strings.Join(OUTPUTS, ", "))
+	}
+	s.output = output
+	return nil
+}
+
+// the prompt, which shows the database in use, and whether a transaction is in progress
+func (s *Shell) Prompt() string {
+	prompt := "abstrastore"
+	if s.database != "" {
+		prompt += ":" + string(s.database)
+	}
+	if s.tx != nil {
+		prompt += "*"
+	}
+	return prompt + "> "
+}
+
+// reads the tables in the schema registry again, which are completed
+func (s *Shell) Refresh(ctx context.Context) error {
+	definitions, err := s.repo.ListTableDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+	s.definitions = definitions
+	return nil
+}
+
+// executes statements, one per line, until the input ends, or EXIT. stops at the first statement that fails, and returns its
+// error with its line number, so that scripts do not carry on after a failed write. a transaction which is still in progress
+// at the end is rolled back.
+func (s *Shell) Run(ctx context.Context, in io.Reader) error {
+	defer s.rollback(ctx)
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		if err := s.Execute(ctx, scanner.Text()); errors.Is(err, ErrExit) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// parses and executes the statement, and writes its result in the output format of the shell. empty lines are ignored. returns
+// ErrExit for EXIT
+func (s *Shell) Execute(ctx context.Context, line string) error {
+	if strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), ";")) == "" {
+		return nil
+	}
+	statement, err := Parse(line)
+	if err != nil {
+		return err
+	}
+	switch statement.Kind {
+	case STATEMENT_EXIT:
+		return ErrExit
+	case STATEMENT_HELP:
+		_, err := io.WriteString(s.out, HELP)
+		return err
+	case STATEMENT_USE:
+		s.database = schema.Database(statement.Database)
+		return s.writeResult(STATEMENT_USE, nil, nil)
+	case STATEMENT_SHOW_DATABASES:
+		return s.showDatabases(ctx)
+	case STATEMENT_SHOW_TABLES:
+		return s.showTables(ctx, statement)
+	case STATEMENT_BEGIN:
+		if s.tx != nil {
+			return fmt.Errorf("ADB-0239 a transaction is already in progress")
+		}
+		tx, err := s.repo.BeginTransaction(ctx, s.timeout)
+		if err != nil {
+			return err
+		}
+		s.tx = &tx
+		return s.writeResult(STATEMENT_BEGIN, nil, func() { fmt.Fprintln(s.out, "BEGIN") })
+	case STATEMENT_COMMIT:
+		if s.tx == nil {
+			return fmt.Errorf("ADB-0240 no transaction is in progress")
+		}
+		tx := s.tx
+		s.tx = nil
+		if errs := s.repo.Commit(ctx, tx); len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+		return s.writeResult(STATEMENT_COMMIT, nil, func() { fmt.Fprintln(s.out, "COMMIT") })
+	case STATEMENT_ROLLBACK:
+		if s.tx == nil {
+			return fmt.Errorf("ADB-0241 no transaction is in progress")
+		}
+		if errs := s.rollback(ctx); len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+		return s.writeResult(STATEMENT_ROLLBACK, nil, func() { fmt.Fprintln(s.out, "ROLLBACK") })
+	}
+
+	table, err := s.table(ctx, statement)
+	if err != nil {
+		return err
+	}
+	switch statement.Kind {
+	case STATEMENT_DESCRIBE:
+		return s.describe(ctx, table)
+	case STATEMENT_SELECT:
+		return s.read(ctx, func(tx *schema.Transaction) error {
+			return s.selectFrom(ctx, tx, table, statement)
+		})
+	default:
+		return s.write(ctx, func(tx *schema.Transaction) error {
+			return s.modify(ctx, tx, table, statement)
+		})
+	}
+}
+
+func (s *Shell) rollback(ctx context.Context) []error {
+	if s.tx == nil {
+		return nil
+	}
+	tx := s.tx
+	s.tx = nil
+	return s.repo.Rollback(ctx, tx)
+}
+
+// resolves the table of the statement from the schema registry
+func (s *Shell) table(ctx context.Context, statement *Statement) (schema.Table, error) {
+	database := schema.Database(statement.Database)
+	if database == "" {
+		database = s.database
+	}
+	if database == "" {
+		return schema.Table{}, fmt.Errorf("ADB-0242 the table %s has no database, so qualify it, e.g. <database>.%s, or USE one", statement.Table, statement.Table)
+	}
+	return s.repo.LoadTable(ctx, database, statement.Table)
+}
+
+// reads within the transaction in progress, or else a read only one
+func (s *Shell) read(ctx context.Context, read func(tx *schema.Transaction) error) error {
+	if s.tx != nil {
+		return read(s.tx)
+	}
+	tx := schema.NewReadOnlyTransaction(s.timeout)
+	return read(&tx)
+}
+
+// writes within the transaction in progress, or else in one of its own, which is committed if the write succeeds. if the write
+// fails within the transaction in progress, it is rolled back, since the write may have added some of its steps, e.g. those
+// which were executed before one failed, or those of the entities that foreign keys deleted, which must not be committed.
+func (s *Shell) write(ctx context.Context, write func(tx *schema.Transaction) error) error {
+	if s.tx != nil {
+		if err := write(s.tx); err != nil {
+			rolledBack := fmt.Errorf("ADB-0250 the transaction was rolled back, since a write within it failed")
+			return errors.Join(append([]error{err, rolledBack}, s.rollback(ctx)...)...)
+		}
+		return nil
+	}
+	tx, err := s.repo.BeginTransaction(ctx, s.timeout)
+	if err != nil {
+		return err
+	}
+	if err := write(&tx); err != nil {
+		return errors.Join(append([]error{err}, s.repo.Rollback(ctx, &tx)...)...)
+	}
+	if errs := s.repo.Commit(ctx, &tx); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (s *Shell) selectFrom(ctx context.Context, tx *schema.Transaction, table schema.Table, statement *Statement) error {
+	documents := make([]*map[string]any, 0)
+	etags := map[string]*string{}
+	query := minio.NewTypedQuery[map[string]any](s.repo, ctx, tx).SelectFromTable(table)
+	condition := statement.Where
+	var found *map[string]*string
+	var err error
+	switch {
+	case condition == nil:
+		for result, err := range minio.ExportTable[map[string]any](ctx, s.repo, tx, table) {
+			if err != nil {
+				return err
+			}
+			documents = append(documents, result.Object)
+			id, _ := table.IdFromPath(result.Path)
+			etags[id] = result.ETag
+			if statement.Limit > 0 && len(documents) == statement.Limit {
+				break
+			}
+		}
+		found = &etags
+	case condition.IsId():
+		document := map[string]any{}
+		etag, err := query.WhereIdEquals(condition.Value).Find(&document)
+		var noSuchKey *minio.NoSuchKeyErrorWithDetails
+		if errors.As(err, &noSuchKey) {
+			break
+		} else if err != nil {
+			return err
+		}
+		documents = append(documents, &document)
+		etags[condition.Value] = etag
+		found = &etags
+	case condition.Operator == CONDITION_EQUALS:
+		found, err = query.WhereIndexedFieldEquals(condition.Field, condition.Value).Find(&documents)
+	case condition.Operator == CONDITION_MATCHES:
+		found, err = query.WhereIndexedFieldMatches(condition.Field, condition.Value).Find(&documents)
+	case condition.Operator == CONDITION_IS_NULL:
+		found, err = query.WhereIndexedFieldIsNull(condition.Field).Find(&documents)
+	case condition.Operator == CONDITION_IS_NOT_NULL:
+		found, err = query.WhereIndexedFieldIsNotNull(condition.Field).Find(&documents)
+	case condition.Operator == CONDITION_RANGE:
+		found, err = findInRange(query, table, condition, &documents)
+	}
+	if err != nil {
+		return err
+	}
+	if statement.Limit > 0 && len(documents) > statement.Limit {
+		documents = documents[:statement.Limit]
+	}
+	if found != nil {
+		for id, etag := range *found {
+			if etag != nil {
+				s.etags[table.Path(id)] = *etag
+			}
+		}
+	}
+	rows := make([]any, len(documents))
+	for i, document := range documents {
+		rows[i] = document
+	}
+	return s.writeResult(STATEMENT_SELECT, rows, func() { writeDocuments(s.out, documents) })
+}
+
+// finds the entities whose field is in the range, which is numeric, over time or over strings, as the index is
+func findInRange(query minio.WhereContainer[map[string]any], table schema.Table, condition *Condition, documents *[]*map[string]any) (*map[string]*string, error) {
+	index := slices.IndexFunc(table.Indices, func(index schema.Index) bool { return index.Field == condition.Field })
+	if index < 0 {
+		return nil, fmt.Errorf("ADB-0243 the field %s of table %s/%s is not indexed", condition.Field, table.Database, table.Name)
+	}
+	switch {
+	case table.Indices[index].Numeric:
+		from, to := math.Inf(-1), math.Inf(1)
+		for bound, value := range map[*float64]*string{&from: condition.From, &to: condition.To} {
+			if value == nil {
+				continue
+			}
+			number, err := strconv.ParseFloat(*value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("ADB-0244 the numeric index %s is queried with %s, which is not a number", condition.Field, *value)
+			}
+			*bound = number
+		}
+		return query.WhereIndexedFieldInRange(condition.Field, from, to).Find(documents)
+	case table.Indices[index].Time:
+		// the earliest and latest times that can be indexed
+		from, to := time.Unix(0, 0).UTC(), time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+		for bound, value := range map[*time.Time]*string{&from: condition.From, &to: condition.To} {
+			if value == nil {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, *value)
+			if err != nil {
+				return nil, fmt.Errorf("ADB-0245 the time index %s is queried with %s, which is not an RFC 3339 time", condition.Field, *value)
+			}
+			*bound = t
+		}
+		return query.WhereIndexedFieldInTimeRange(condition.Field, from, to).Find(documents)
+	default:
+		from, to := "", ""
+		if condition.From != nil {
+			from = *condition.From
+		}
+		if condition.To != nil {
+			to = *condition.To
+		}
+		return query.WhereIndexedFieldInStringRange(condition.Field, from, to).Find(documents)
+	}
+}
+
+func (s *Shell) modify(ctx context.Context, tx *schema.Transaction, table schema.Table, statement *Statement) error {
+	var id string
+	if statement.Kind == STATEMENT_DELETE {
+		id = statement.Where.Value
+	} else if len(table.Key) > 0 {
+		values := make([]string, len(table.Key))
+		for i, field := range table.Key {
+			for key, value := range statement.Document {
+				if strings.EqualFold(key, field) && value != nil {
+					values[i] = fmt.Sprint(value)
+				}
+			}
+		}
+		var err error
+		if id, err = schema.EncodeCompositeKey(values...); err != nil {
+			return fmt.Errorf("ADB-0246 the entity has no composite key %s: %w", strings.Join(table.Key, ", "), err)
+		}
+	} else {
+		for key, value := range statement.Document {
+			if strings.EqualFold(key, "id") {
+				id, _ = value.(string)
+			}
+		}
+		if id == "" {
+			return fmt.Errorf("ADB-0247 the entity has no id")
+		}
+	}
+	path := table.Path(id)
+	etag, read := s.etags[path]
+	if statement.Kind != STATEMENT_INSERT && !read {
+		return fmt.Errorf("ADB-0248 the entity %s has not been selected, so it cannot be written with its ETag. SELECT it first", path)
+	}
+
+	switch statement.Kind {
+	case STATEMENT_INSERT:
+		newETag, err := s.repo.InsertIntoTable(ctx, tx, table, &statement.Document)
+		if err != nil {
+			return err
+		}
+		s.etags[path] = *newETag
+	case STATEMENT_UPDATE:
+		newETag, err := s.repo.UpdateTable(ctx, tx, table, &statement.Document, &etag)
+		if err != nil {
+			return err
+		}
+		s.etags[path] = *newETag
+	case STATEMENT_DELETE:
+		key := map[string]any{"id": id}
+		if len(table.Key) > 0 {
+			values, err := schema.DecodeCompositeKey(id)
+			if err != nil || len(values) != len(table.Key) {
+				return fmt.Errorf("ADB-0249 %s is not a composite key %s of table %s", id, strings.Join(table.Key, ", "), table.Name)
+			}
+			for i, field := range table.Key {
+				key[field] = values[i]
+			}
+		}
+		if err := s.repo.DeleteFromTable(ctx, tx, table, &key, &etag); err != nil {
+			return err
+		}
+		delete(s.etags, path)
+	}
+	return s.writeResult(statement.Kind, []any{map[string]any{"id": id}}, func() {
+		fmt.Fprintf(s.out, "%s %s\n", strings.ToUpper(statement.Kind), id)
+	})
+}
+
+func (s *Shell) showDatabases(ctx context.Context) error {
+	if err := s.Refresh(ctx); err != nil {
+		return err
+	}
+	rows := make([]any, 0)
+	cells := make([][]string, 0)
+	for _, database := range s.databases() {
+		rows = append(rows, map[string]any{"database": database})
+		cells = append(cells, []string{database})
+	}
+	return s.writeResult(STATEMENT_SHOW_DATABASES, rows, func() { writeTable(s.out, []string{"database"}, cells) })
+}
+
+func (s *Shell) showTables(ctx context.Context, statement *Statement) error {
+	if err := s.Refresh(ctx); err != nil {
+		return err
+	}
+	database := statement.Database
+	if database == "" {
+		database = string(s.database)
+	}
+	rows := make([]any, 0)
+	cells := make([][]string, 0)
+	for _, definition := range s.definitions {
+		if database == "" || definition.Database == database {
+			rows = append(rows, map[string]any{"database": definition.Database, "table": definition.Name, "version": definition.Version, "indices": definition.Indices})
+			cells = append(cells, []string{definition.Database, definition.Name, definition.Version, strings.Join(definition.Indices, ", ")})
+		}
+	}
+	return s.writeResult(STATEMENT_SHOW_TABLES, rows, func() {
+		writeTable(s.out, []string{"database", "table", "version", "indices"}, cells)
+	})
+}
+
+// writes the indices of the table, with the number of their entries, followed by the number of records and the size of the table
+func (s *Shell) describe(ctx context.Context, table schema.Table) error {
+	description, err := s.repo.DescribeTable(ctx, table)
+	if err != nil {
+		return err
+	}
+	cells := make([][]string, 0, len(description.IndexDescriptions))
+	for _, index := range description.IndexDescriptions {
+		kind := "string"
+		switch {
+		case index.Numeric:
+			kind = "numeric"
+		case index.Time:
+			kind = "time"
+		case index.Decimal:
+			kind = "decimal"
+		case index.JsonPath:
+			kind = "json path"
+		case index.Computed:
+			kind = "computed"
+		}
+		cells = append(cells, []string{index.Field, kind, strconv.FormatBool(index.Unique), strconv.FormatBool(index.Sparse), strconv.Itoa(index.Entries)})
+	}
+	return s.writeResult(STATEMENT_DESCRIBE, []any{description}, func() {
+		writeTable(s.out, []string{"field", "kind", "unique", "sparse", "entries"}, cells)
+		fmt.Fprintf(s.out, "approximately %d records in %d bytes\n", description.Records, description.Size)
+	})
+}
+
+// the databases of the tables in the registry, sorted
+func (s *Shell) databases() []string {
+	databases := make([]string, 0)
+	for _, definition := range s.definitions {
+		if !slices.Contains(databases, definition.Database) {
+			databases = append(databases, definition.Database)
+		}
+	}
+	slices.Sort(databases)
+	return databases
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the outcomes of requests in the access log
+const (
+	OUTCOME_SUCCESS      = "success"
+	OUTCOME_CLIENT_ERROR = "client-error"
+	// rejected by a rate limit. see RateLimitHandler
+	OUTCOME_RATE_LIMITED = "rate-limited"
+	OUTCOME_SERVER_ERROR = "server-error"
+	// the handler aborted the response, e.g. because an export failed part way through
+	OUTCOME_ABORTED = "aborted"
+)
+
+// configures AccessLogHandler
+type AccessLogOptions struct {
+	// identifies who made the request, e.g. the subject of its token, but never the token itself. nil logs no principal.
+	Principal func(r *http.Request) string
+	// the fraction of successful requests which are logged, e.g. 0.01 for one in a hundred. zero logs all of them.
+	// requests which do not succeed are always logged.
+	SuccessSampling float64
+}
+
+type accessLogKey struct{}
+
+// what handlers add to the entry of the request
+type accessLogEntry struct {
+	table string
+}
+
+// wraps the handler so that each request is logged as one structured record, with its method, route, table, principal, status,
+// outcome, latency and the size of the response. successes are logged at info level, client errors at warn level, and server
+// errors at error level.
+func AccessLogHandler(next http.Handler, logger *slog.Logger, options AccessLogOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := schema.Now()
+		entry := &accessLogEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry))
+		recorder := &accessLogRecorder{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			outcome, level := accessLogOutcome(recorder.status(), recovered != nil)
+			if outcome != OUTCOME_SUCCESS || options.SuccessSampling <= 0 || rand.Float64() < options.SuccessSampling {
+				attributes := []slog.Attr{
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("route", r.Pattern), // set by a ServeMux which the handler routes to
+					slog.Int("status", recorder.status()),
+					slog.String("outcome", outcome),
+					slog.Duration("latency", schema.Now().Sub(start)),
+					slog.Int64("requestBytes", r.ContentLength),
+					slog.Int64("responseBytes", recorder.bytes),
+				}
+				if entry.table != "" {
+					attributes = append(attributes, slog.String("table", entry.table))
+				}
+				if options.Principal != nil {
+					attributes = append(attributes, slog.String("principal", options.Principal(r)))
+				}
+				if recovered != nil {
+					attributes = append(attributes, slog.String("error", fmt.Sprint(recovered)))
+				}
+				logger.LogAttrs(r.Context(), level, "request", attributes...)
+			}
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// records the table that the request addresses in its access log entry, if it is being logged
+func LogTable(r *http.Request, table schema.Table) {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry); ok {
+		entry.table = fmt.Sprintf("%s/%s", table.Database, table.Name)
+	}
+}
+
+func accessLogOutcome(status int, aborted bool) (string, slog.Level) {
+	switch {
+	case aborted:
+		return OUTCOME_ABORTED, slog.LevelError
+	case status == http.StatusTooManyRequests:
+		return OUTCOME_RATE_LIMITED, slog.LevelWarn
+	case status >= 500:
+		return OUTCOME_SERVER_ERROR, slog.LevelError
+	case status >= 400:
+		return OUTCOME_CLIENT_ERROR, slog.LevelWarn
+	default:
+		return OUTCOME_SUCCESS, slog.LevelInfo
+	}
+}
+
+// records the status and size of the response
+type accessLogRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+}
+
+func (a *accessLogRecorder) WriteHeader(statusCode int) {
+	if a.statusCode == 0 {
+		a.statusCode = statusCode
+	}
+	a.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (a *accessLogRecorder) Write(b []byte) (int, error) {
+	if a.statusCode == 0 {
+		a.statusCode = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(b)
+	a.bytes += int64(n)
+	return n, err
+}
+
+// so that http.ResponseController can flush, and enable full duplex, on the underlying writer
+func (a *accessLogRecorder) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+func (a *accessLogRecorder) status() int {
+	if a.statusCode == 0 {
+		return http.StatusOK
+	}
+	return a.statusCode
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogHandler_LogsOneRecordPerRequest(t *testing.T) {
+	assert := assert.New(t)
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, nil))
+	table := schema.NewTable(schema.NewDatabase("db"), "accounts", []string{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /accounts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("GET /missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not here", http.StatusNotFound)
+	})
+	handler := AccessLogHandler(mux, logger, AccessLogOptions{Principal: Tenant})
+
+	r := httptest.NewRequest(http.MethodGet, "/accounts/1", nil)
+	r.Header.Set(HEADER_TENANT, "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(lines, 2)
+	var record map[string]any
+	assert.NoError(json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal("INFO", record["level"])
+	assert.Equal("GET", record["method"])
+	assert.Equal("/accounts/1", record["path"])
+	assert.Equal("GET /accounts/{id}", record["route"])
+	assert.Equal("db/accounts", record["table"])
+	assert.Equal("acme", record["principal"])
+	assert.Equal(float64(http.StatusOK), record["status"])
+	assert.Equal(OUTCOME_SUCCESS, record["outcome"])
+	assert.Equal(float64(5), record["responseBytes"])
+	assert.Contains(record, "latency")
+
+	record = nil
+	assert.NoError(json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal("WARN", record["level"])
+	assert.Equal(OUTCOME_CLIENT_ERROR, record["outcome"])
+	assert.Equal("", record["principal"])
+	assert.NotContains(record, "table")
+}
+
+func TestAccessLogHandler_SamplesSuccessesButLogsAllFailures(t *testing.T) {
+	assert := assert.New(t)
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, nil))
+	status := http.StatusOK
+	handler := AccessLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}), logger, AccessLogOptions{SuccessSampling: 1e-9})
+
+	for range 100 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.Empty(buffer.String())
+
+	status = http.StatusTooManyRequests
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	status = http.StatusInternalServerError
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(lines, 2)
+	assert.Contains(lines[0], `"outcome":"rate-limited"`)
+	assert.Contains(lines[1], `"level":"ERROR"`)
+	assert.Contains(lines[1], `"outcome":"server-error"`)
+}
+
+func TestAccessLogHandler_LogsAbortedResponses(t *testing.T) {
+	assert := assert.New(t)
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, nil))
+	handler := AccessLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic(http.ErrAbortHandler)
+	}), logger, AccessLogOptions{})
+
+	assert.PanicsWithValue(http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.Contains(buffer.String(), `"outcome":"aborted"`)
+	assert.Contains(buffer.String(), `"responseBytes":7`)
+}
@@ -0,0 +1,232 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the content type of bulk requests and responses, i.e. one JSON document per line
+const CONTENT_TYPE_NDJSON = "application/x-ndjson"
+
+// the number of lines of a bulk request which are written before their statuses are sent and the next lines are read. the
+// request body is only read as fast as the lines can be written, so that a client sending faster than that is slowed down by the
+// flow control of the connection, rather than the lines being buffered in memory.
+const BULK_BATCH_SIZE = 32
+
+// the longest line accepted in a bulk request
+const MAX_BULK_LINE_SIZE = 16 * 1024 * 1024
+
+// the status of one line of a bulk request, which are sent in the order of the lines
+type BulkStatus struct {
+	// starting at 1. empty lines are counted, but have no status
+	Line int `json:"line"`
+	// the HTTP status code that writing the line alone would have responded with
+	Status int    `json:"status"`
+	Path   string `json:"path,omitempty"`
+	ETag   string `json:"etag,omitempty"`
+	// the commit token of the transaction that wrote the line. see CommitToken
+	CommitToken string `json:"commitToken,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// the operation applied to each line of a bulk request, within the line's own transaction
+type bulkWrite[T any] func(ctx context.Context, repo *minio.MinioRepository, tx *schema.Transaction, table schema.Table, entity *T) error
+
+// registers the bulk endpoints of the table on the mux, at `/bulk/<database>/<table>/`:
+//   - `POST import` inserts each line, failing lines for entities which already exist
+//   - `POST upsert` inserts or overwrites each line
+//   - `GET export` responds with all entities of the table, one per line, in a form which can be imported again
+//
+// each line of an import or upsert is written in its own transaction, so that the failure of one does not affect the others, and
+// the response contains a BulkStatus per line.
+func RegisterBulkEndpoints[T any](mux *http.ServeMux, repo *minio.MinioRepository, table schema.Table, timeout time.Duration) {
+	prefix := fmt.Sprintf("/bulk/%s/%s/", table.Database, table.Name)
+	mux.HandleFunc("POST "+prefix+"import", BulkImport[T](repo, table, timeout))
+	mux.HandleFunc("POST "+prefix+"upsert", BulkUpsert[T](repo, table, timeout))
+	mux.HandleFunc("GET "+prefix+"export", BulkExport[T](repo, table))
+}
+
+// handles an NDJSON stream of entities to insert into the table. see RegisterBulkEndpoints
+func BulkImport[T any](repo *minio.MinioRepository, table schema.Table, timeout time.Duration) http.HandlerFunc {
+	return bulkHandler(repo, table, timeout, http.StatusCreated, func(ctx context.Context, repo *minio.MinioRepository, tx *schema.Transaction, table schema.Table, entity *T) error {
+		_, err := repo.InsertIntoTable(ctx, tx, table, entity)
+		return err
+	})
+}
+
+// handles an NDJSON stream of entities to insert into the table, or to overwrite if they exist. see RegisterBulkEndpoints
+func BulkUpsert[T any](repo *minio.MinioRepository, table schema.Table, timeout time.Duration) http.HandlerFunc {
+	return bulkHandler(repo, table, timeout, http.StatusOK, func(ctx context.Context, repo *minio.MinioRepository, tx *schema.Transaction, table schema.Table, entity *T) error {
+		overwrite := ""
+		_, err := repo.UpdateTable(ctx, tx, table, entity, &overwrite)
+		return err
+	})
+}
+
+func bulkHandler[T any](repo *minio.MinioRepository, table schema.Table, timeout time.Duration, successStatus int, write bulkWrite[T]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		// statuses are sent while the request is still being read
+		_ = http.NewResponseController(w).EnableFullDuplex()
+		w.Header().Set("Content-Type", CONTENT_TYPE_NDJSON)
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), MAX_BULK_LINE_SIZE)
+		lineNumber := 0
+		for {
+			lines := make(map[int][]byte, BULK_BATCH_SIZE)
+			order := make([]int, 0, BULK_BATCH_SIZE)
+			for len(order) < BULK_BATCH_SIZE && scanner.Scan() {
+				lineNumber++
+				if len(scanner.Bytes()) == 0 {
+					continue
+				}
+				lines[lineNumber] = append([]byte(nil), scanner.Bytes()...)
+				order = append(order, lineNumber)
+			}
+			statuses := writeBulkLines(r.Context(), repo, table, timeout, successStatus, write, order, lines)
+			for _, status := range statuses {
+				if err := encoder.Encode(status); err != nil {
+					return // the client has gone
+				}
+			}
+			if len(order) < BULK_BATCH_SIZE {
+				break
+			}
+			flush(w)
+		}
+		if err := scanner.Err(); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, bufio.ErrTooLong) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			_ = encoder.Encode(BulkStatus{Line: lineNumber + 1, Status: status, Error: fmt.Sprintf("ADB-0117 failed to read line: %s", err)})
+		}
+		flush(w)
+	}
+}
+
+// writes each line in its own transaction, in parallel, committing them together, and returns their statuses in order
+func writeBulkLines[T any](ctx context.Context, repo *minio.MinioRepository, table schema.Table, timeout time.Duration, successStatus int, write bulkWrite[T], order []int, lines map[int][]byte) []BulkStatus {
+	statuses := make([]BulkStatus, len(order))
+	transactions := make([]*schema.Transaction, 0, len(order))
+	positions := make([]int, 0, len(order)) // of the transactions in statuses
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, lineNumber := range order {
+		statuses[i].Line = lineNumber
+		entity := new(T)
+		if err := json.Unmarshal(lines[lineNumber], entity); err != nil {
+			statuses[i].Status = http.StatusBadRequest
+			statuses[i].Error = fmt.Sprintf("ADB-0118 line is not a valid entity: %s", err)
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tx, err := repo.BeginTransaction(ctx, timeout)
+			if err == nil {
+				if err = write(ctx, repo, &tx, table, entity); err != nil {
+					repo.Rollback(ctx, &tx)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				statuses[i].setError(err)
+				return
+			}
+			transactions = append(transactions, &tx)
+			positions = append(positions, i)
+		}(i)
+	}
+	wg.Wait()
+
+	for j, result := range repo.CommitBatch(ctx, transactions) {
+		status := &statuses[positions[j]]
+		if !result.Committed {
+			if !result.RolledBack {
+				// failed validation, which leaves it to the caller
+				repo.Rollback(ctx, transactions[j])
+			}
+			if len(result.Errors) > 0 {
+				status.setError(result.Errors[0])
+			} else {
+				status.setError(fmt.Errorf("ADB-0119 tx %s was not committed", transactions[j].Id))
+			}
+			continue
+		}
+		status.Status = successStatus
+		status.CommitToken = CommitToken(result.Report)
+		for _, object := range result.Report.Objects {
+			if object.Type.IsData() {
+				status.Path = object.Path
+				if object.FinalETag != nil {
+					status.ETag = *object.FinalETag
+				}
+				break
+			}
+		}
+	}
+	return statuses
+}
+
+func (s *BulkStatus) setError(err error) {
+	s.Status = StatusCode(err)
+	s.Error = err.Error()
+}
+
+// responds with all entities of the table which exist at the start of the request, one per line. see RegisterBulkEndpoints.
+// if reading fails part way through, the connection is aborted, so that the client cannot mistake the export for a complete one.
+func BulkExport[T any](repo *minio.MinioRepository, table schema.Table) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		tx, err := BeginReadOnlyTransaction(r, repo, schema.MaxTimeout())
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		// each object is read once, so caching them would only make memory grow with the size of the table
+		tx.BypassCache = true
+		w.Header().Set("Content-Type", CONTENT_TYPE_NDJSON)
+		encoder := json.NewEncoder(w)
+		count := 0
+		for result, err := range minio.ExportTable[T](r.Context(), repo, &tx, table) {
+			if err != nil {
+				if count == 0 {
+					WriteError(w, err)
+					return
+				}
+				panic(http.ErrAbortHandler)
+			}
+			if err := encoder.Encode(result.Object); err != nil {
+				return // the client has gone
+			}
+			count++
+			if count%minio.EXPORT_PAGE_SIZE == 0 {
+				// so that the client can start processing, and memory is bounded by the page size
+				flush(w)
+			}
+		}
+		if count == 0 {
+			w.WriteHeader(http.StatusOK)
+		}
+		flush(w)
+	}
+}
+
+// sends what has been written to the client so far, if the response writer supports it
+func flush(w http.ResponseWriter) {
+	_ = http.NewResponseController(w).Flush()
+}
@@ -0,0 +1,47 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+type bulkAccount struct {
+	Id   string
+	Name string
+}
+
+func TestBulkImport_ReportsInvalidLines(t *testing.T) {
+	assert := assert.New(t)
+	table := schema.NewTable(schema.NewDatabase("bulk-tests"), "account", []string{"Name"})
+	// no lines are valid, so nothing is written, and no repository is needed
+	handler := BulkImport[bulkAccount](nil, table, time.Second)
+
+	r := httptest.NewRequest(http.MethodPost, "/bulk/bulk-tests/account/import", strings.NewReader("garbage\n\n{\"Id\":"))
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(CONTENT_TYPE_NDJSON, w.Header().Get("Content-Type"))
+	statuses := make([]BulkStatus, 0)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var status BulkStatus
+		assert.NoError(json.Unmarshal(scanner.Bytes(), &status))
+		statuses = append(statuses, status)
+	}
+	if assert.Len(statuses, 2) {
+		assert.Equal(1, statuses[0].Line)
+		assert.Equal(http.StatusBadRequest, statuses[0].Status)
+		assert.Contains(statuses[0].Error, "ADB-0118")
+		assert.Equal(3, statuses[1].Line) // the empty line is counted
+		assert.Equal(http.StatusBadRequest, statuses[1].Status)
+	}
+}
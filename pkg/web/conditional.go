@@ -0,0 +1,70 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// true if the request has an If-None-Match header which matches the ETag
+func MatchesIfNoneMatch(r *http.Request, etag string) bool {
+	header := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if unquote(strings.TrimSpace(candidate)) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// responds with 304 Not Modified, if the request has an If-None-Match header which matches the ETag. returns true if it did, in
+// which case the handler must not write a body.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	if !MatchesIfNoneMatch(r, etag) {
+		return false
+	}
+	w.Header().Set("ETag", quote(etag))
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// for a GET of the object at the path, responds with 304 Not Modified if the client already has its latest committed version,
+// using a HEAD request rather than reading it. returns true if it did; otherwise the handler reads the object as usual, and sets
+// its ETag with WriteETag.
+func ConditionalGetObject(w http.ResponseWriter, r *http.Request, repo *minio.MinioRepository, path string) (bool, error) {
+	if r.Header.Get("If-None-Match") == "" {
+		return false, nil
+	}
+	etag, err := repo.GetCommittedETag(r.Context(), path)
+	if err != nil || etag == nil {
+		return false, err
+	}
+	return NotModified(w, r, *etag), nil
+}
+
+// for a GET of query results from the table, responds with 304 Not Modified if nothing has been committed to the table since the
+// client last read them, which costs one HEAD request. returns true if it did. otherwise it sets the ETag of the response to the
+// generation of the table, which was read before the query is executed, so that a commit in between is detected next time.
+func ConditionalGetTable(w http.ResponseWriter, r *http.Request, repo *minio.MinioRepository, table schema.Table) (bool, error) {
+	etag, err := repo.GetTableETag(r.Context(), table)
+	if err != nil {
+		return false, err
+	}
+	if etag == "" {
+		// nothing has ever been committed, so there is no token which would change with the next commit
+		return false, nil
+	}
+	if NotModified(w, r, etag) {
+		return true, nil
+	}
+	w.Header().Set("ETag", quote(etag))
+	return false, nil
+}
@@ -0,0 +1,26 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotModified(t *testing.T) {
+	assert := assert.New(t)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	assert.False(NotModified(w, r, "abc"))
+
+	r.Header.Set("If-None-Match", `"def", "abc"`)
+	assert.True(NotModified(w, r, "abc"))
+	assert.Equal(http.StatusNotModified, w.Code)
+	assert.Equal(`"abc"`, w.Header().Get("ETag"))
+	assert.Empty(w.Body.String())
+
+	r.Header.Set("If-None-Match", `W/"xyz"`)
+	assert.False(MatchesIfNoneMatch(r, "abc"))
+	assert.True(MatchesIfNoneMatch(r, "xyz"))
+}
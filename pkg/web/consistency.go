@@ -0,0 +1,152 @@
+// helpers for HTTP handlers, which carry the concurrency and read-your-writes guarantees of the store through to clients, e.g.
+// browsers. writes respond with the ETag of the object and a commit token, updates and deletes accept If-Match, and reads accept
+// If-Match and a minimum commit token, so that a client reads at least what it wrote, even from a different pod.
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the header of responses to writes, containing the commit token
+const HEADER_COMMIT_TOKEN = "X-Commit-Token"
+
+// the header of reads, containing the commit token of the client's last write, which the read must see
+const HEADER_MIN_COMMIT_TOKEN = "X-Min-Commit-Token"
+
+// how long a read waits for the local clock to pass a commit token, which may be ahead because of clock skew between pods
+const MAX_COMMIT_TOKEN_WAIT = 2 * time.Second
+
+var CommitTokenAheadError = fmt.Errorf("commit token is too far in the future")
+
+// returns the commit token of a committed transaction. a transaction which starts after it sees what was committed.
+func CommitToken(report *minio.CommitReport) string {
+	return strconv.FormatInt(report.CommitMicros, 10)
+}
+
+// sets the ETag of the object at the path, if the transaction wrote it, and the commit token, on the response to a write
+func WriteCommitHeaders(w http.ResponseWriter, report *minio.CommitReport, path string) {
+	if object, ok := report.Get(path); ok && object.FinalETag != nil {
+		w.Header().Set("ETag", quote(*object.FinalETag))
+	}
+	w.Header().Set(HEADER_COMMIT_TOKEN, CommitToken(report))
+}
+
+// sets the ETag of an object that was read
+func WriteETag(w http.ResponseWriter, etag *string) {
+	if etag != nil {
+		w.Header().Set("ETag", quote(*etag))
+	}
+}
+
+// returns the ETag of the If-Match header, for passing to an update or delete, or nil if there is none.
+// `*`, i.e. any version, is returned as "", which overwrites in all cases.
+func IfMatch(r *http.Request) *string {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return nil
+	}
+	etag := ""
+	if header != "*" {
+		etag = unquote(header)
+	}
+	return &etag
+}
+
+// true unless the request has an If-Match header which does not match the ETag of the object that was read, in which case the
+// handler should respond with 412 Precondition Failed
+func MatchesIfMatch(r *http.Request, etag *string) bool {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" && etag != nil {
+		return true
+	}
+	if etag == nil {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if unquote(strings.TrimSpace(candidate)) == *etag {
+			return true
+		}
+	}
+	return false
+}
+
+// begins a read-only transaction which sees at least what was committed up to the minimum commit token of the request, if it has
+// one. if the token is ahead of the local clock, e.g. because it was issued by a different pod, it waits until the clock passes it,
+// for up to MAX_COMMIT_TOKEN_WAIT.
+func BeginReadOnlyTransaction(r *http.Request, repo *minio.MinioRepository, timeout time.Duration) (schema.Transaction, error) {
+	header := strings.TrimSpace(r.Header.Get(HEADER_MIN_COMMIT_TOKEN))
+	if header != "" {
+		minCommitMicros, err := strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			return schema.Transaction{}, fmt.Errorf("ADB-0113 invalid commit token %s: %w", header, err)
+		}
+		if err := waitUntilAfter(r.Context(), minCommitMicros); err != nil {
+			return schema.Transaction{}, err
+		}
+	}
+	return repo.BeginReadOnlyTransaction(timeout)
+}
+
+func waitUntilAfter(ctx context.Context, micros int64) error {
+	wait := time.Duration(micros-schema.Now().UnixMicro()+1) * time.Microsecond
+	if wait <= 0 {
+		return nil
+	}
+	if wait > MAX_COMMIT_TOKEN_WAIT {
+		return fmt.Errorf("ADB-0114 commit token %d is %s ahead of the local clock: %w", micros, wait, CommitTokenAheadError)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// returns the status code that corresponds to an error returned by the store
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, minio.NoSuchKeyError):
+		return http.StatusNotFound
+	case errors.Is(err, minio.StaleObjectError):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, minio.DuplicateKeyError), errors.Is(err, minio.ObjectLockedError), errors.Is(err, minio.UniqueViolationError), errors.Is(err, minio.UploadOffsetMismatchError), errors.Is(err, minio.ReferencedError), errors.Is(err, minio.PinnedError):
+		return http.StatusConflict
+	case errors.Is(err, CommitTokenAheadError), errors.Is(err, minio.IndexUnavailableError):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, RateLimitExceededError):
+		return http.StatusTooManyRequests
+	case errors.Is(err, schema.TransactionTimedOutError):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, minio.UnsupportedCapabilityError):
+		return http.StatusNotImplemented
+	case errors.Is(err, minio.DecimalConstraintError), errors.Is(err, minio.EnumConstraintError):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, minio.InvalidSyncTokenError), errors.Is(err, minio.InvalidConfirmationTokenError):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// responds with the status code that corresponds to the error, and its message
+func WriteError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), StatusCode(err))
+}
+
+func quote(etag string) string {
+	return `"` + etag + `"`
+}
+
+func unquote(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCommitHeaders(t *testing.T) {
+	assert := assert.New(t)
+	etag := "abc"
+	report := &minio.CommitReport{CommitMicros: 123, Objects: []minio.CommittedObject{{Path: "db/t/data/1.json", FinalETag: &etag}}}
+
+	w := httptest.NewRecorder()
+	WriteCommitHeaders(w, report, "db/t/data/1.json")
+	assert.Equal(`"abc"`, w.Header().Get("ETag"))
+	assert.Equal("123", w.Header().Get(HEADER_COMMIT_TOKEN))
+
+	w = httptest.NewRecorder()
+	WriteCommitHeaders(w, report, "db/t/data/2.json")
+	assert.Empty(w.Header().Get("ETag"))
+}
+
+func TestIfMatch(t *testing.T) {
+	assert := assert.New(t)
+	r := httptest.NewRequest(http.MethodPut, "/", nil)
+	assert.Nil(IfMatch(r))
+
+	r.Header.Set("If-Match", `"abc"`)
+	assert.Equal("abc", *IfMatch(r))
+	r.Header.Set("If-Match", "*")
+	assert.Equal("", *IfMatch(r))
+
+	etag := "abc"
+	other := "def"
+	r.Header.Set("If-Match", `"def", W/"abc"`)
+	assert.True(MatchesIfMatch(r, &etag))
+	r.Header.Set("If-Match", `"xyz"`)
+	assert.False(MatchesIfMatch(r, &other))
+	r.Header.Set("If-Match", "*")
+	assert.False(MatchesIfMatch(r, nil))
+	r.Header.Del("If-Match")
+	assert.True(MatchesIfMatch(r, nil))
+}
+
+func TestBeginReadOnlyTransaction_WaitsForCommitToken(t *testing.T) {
+	assert := assert.New(t)
+	repo := &minio.MinioRepository{}
+	now := schema.Now().UnixMicro()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HEADER_MIN_COMMIT_TOKEN, fmt.Sprintf("%d", now+50*1000)) // 50ms ahead, e.g. due to skew
+	tx, err := BeginReadOnlyTransaction(r, repo, 10*time.Second)
+	assert.NoError(err)
+	assert.Greater(tx.StartMicroseconds, now+50*1000)
+
+	r.Header.Set(HEADER_MIN_COMMIT_TOKEN, fmt.Sprintf("%d", now+time.Minute.Microseconds()))
+	_, err = BeginReadOnlyTransaction(r, repo, 10*time.Second)
+	assert.ErrorIs(err, CommitTokenAheadError)
+	assert.Equal(http.StatusServiceUnavailable, StatusCode(err))
+
+	r.Header.Set(HEADER_MIN_COMMIT_TOKEN, "not-a-token")
+	_, err = BeginReadOnlyTransaction(r, repo, 10*time.Second)
+	assert.ErrorContains(err, "ADB-0113")
+}
+
+func TestStatusCode(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(http.StatusNotFound, StatusCode(&minio.NoSuchKeyErrorWithDetails{}))
+	assert.Equal(http.StatusPreconditionFailed, StatusCode(&minio.StaleObjectErrorWithDetails[any]{}))
+	assert.Equal(http.StatusConflict, StatusCode(&minio.DuplicateKeyErrorWithDetails{}))
+	assert.Equal(http.StatusConflict, StatusCode(&minio.UniqueViolationErrorWithDetails{}))
+	assert.Equal(http.StatusConflict, StatusCode(&minio.ReferencedErrorWithDetails{}))
+	assert.Equal(http.StatusConflict, StatusCode(&minio.PinnedErrorWithDetails{}))
+	assert.Equal(http.StatusServiceUnavailable, StatusCode(&minio.IndexUnavailableErrorWithDetails{}))
+	assert.Equal(http.StatusNotImplemented, StatusCode(&minio.UnsupportedCapabilityErrorWithDetails{}))
+	assert.Equal(http.StatusUnprocessableEntity, StatusCode(fmt.Errorf("ADB-0104 rejected: %w", &minio.DecimalConstraintErrorWithDetails{})))
+	assert.Equal(http.StatusUnprocessableEntity, StatusCode(&minio.EnumConstraintErrorWithDetails{}))
+	assert.Equal(http.StatusBadRequest, StatusCode(&minio.InvalidSyncTokenErrorWithDetails{}))
+	assert.Equal(http.StatusBadRequest, StatusCode(&minio.InvalidConfirmationTokenErrorWithDetails{}))
+	assert.Equal(http.StatusInternalServerError, StatusCode(errors.New("boom")))
+}
@@ -0,0 +1,286 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the header identifying the tenant of a request, for limiting tenants which share a deployment
+const HEADER_TENANT = "X-Tenant-Id"
+
+// clients which have not made a request for this long are forgotten, including their metrics, so that the limiter does not grow
+// without bounds, e.g. with tokens which have expired
+const RATE_LIMIT_IDLE_EXPIRY = 10 * time.Minute
+
+// the rates that one client, e.g. a token or a tenant, may use. zero means unlimited.
+type RateLimit struct {
+	RequestsPerSecond float64
+	// of request bodies
+	BytesPerSecond float64
+	// how many requests, or bytes, may be used at once by a client which has been idle. zero means one second's worth
+	RequestBurst float64
+	ByteBurst    float64
+}
+
+var RateLimitExceededError = fmt.Errorf("Rate limit exceeded")
+
+// what a limiter has done for one client since it was first seen, or last forgotten
+type RateLimitMetrics struct {
+	Limiter string
+	// the key of the client, e.g. the fingerprint of its token, see BearerToken
+	Key string
+	// requests which were passed on, and which were rejected with 429 Too Many Requests
+	Allowed  int64
+	Rejected int64
+	// request bytes which were read
+	Bytes int64
+}
+
+// limits the rate of requests and request bytes per client, where a client is identified by a key taken from the request, e.g. its
+// bearer token or tenant. it is safe for concurrent use. see RateLimitHandler
+type RateLimiter struct {
+	name         string
+	key          func(r *http.Request) string
+	defaultLimit RateLimit
+
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	clients map[string]*rateLimitedClient
+	pruned  time.Time
+}
+
+// the token buckets of a client, which may go negative, i.e. into debt, when a request is larger than what is left, so that large
+// requests are possible, but delay the next ones
+type rateLimitedClient struct {
+	requests float64
+	bytes    float64
+	updated  time.Time
+	metrics  RateLimitMetrics
+}
+
+// creates a limiter, which applies the default limit to each client, unless SetLimit overrides it.
+// name is used in responses and metrics, e.g. "token" or "tenant". requests for which key returns "" are not limited by it.
+func NewRateLimiter(name string, key func(r *http.Request) string, defaultLimit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		name:         name,
+		key:          key,
+		defaultLimit: defaultLimit,
+		limits:       make(map[string]RateLimit),
+		clients:      make(map[string]*rateLimitedClient),
+		pruned:       schema.Now(),
+	}
+}
+
+// a key function which identifies clients by the bearer token of the Authorization header. the key is the fingerprint of the
+// token, see TokenFingerprint, so that tokens are neither kept by the limiter nor exposed by its metrics.
+func BearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ""
+	}
+	return TokenFingerprint(token)
+}
+
+// returns the key that BearerToken returns for the token, e.g. for setting the limit of a token with SetLimit: the first 16
+// hexadecimal digits of its SHA-256 hash, which identify it without revealing it
+func TokenFingerprint(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:8])
+}
+
+// a key function which identifies clients by the tenant header. see HEADER_TENANT
+func Tenant(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(HEADER_TENANT))
+}
+
+// overrides the default limit for the client with the key, e.g. for a tenant that pays for more
+func (l *RateLimiter) SetLimit(key string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[key] = limit
+}
+
+// returns the metrics of all the clients that are currently known, sorted by key
+func (l *RateLimiter) Metrics() []RateLimitMetrics {
+	l.mu.Lock()
+	all := make([]RateLimitMetrics, 0, len(l.clients))
+	for _, client := range l.clients {
+		all = append(all, client.metrics)
+	}
+	l.mu.Unlock()
+	slices.SortFunc(all, func(a, b RateLimitMetrics) int { return strings.Compare(a.Key, b.Key) })
+	return all
+}
+
+// wraps the handler so that requests are rejected with 429 Too Many Requests, once a client exceeds the limits of any of the
+// limiters, e.g. one per token and one per tenant. the response says which limit was exceeded and, in the Retry-After header,
+// when to retry. bodies of unknown length are counted as they are read, so that they delay the next request.
+func RateLimitHandler(next http.Handler, limiters ...*RateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := make([]string, len(limiters))
+		for i, limiter := range limiters {
+			keys[i] = limiter.key(r)
+		}
+		if retryAfter, err := AdmitRequest(limiters, keys, r.ContentLength); err != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		for i, limiter := range limiters {
+			if keys[i] != "" && r.ContentLength < 0 && r.Body != nil {
+				r.Body = &rateLimitedBody{ReadCloser: r.Body, limiter: limiter, key: keys[i]}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// admits a request against the limiters, like RateLimitHandler does, e.g. for an interceptor of a server which does not serve
+// HTTP, such as a gRPC one. keys are those of the client, one per limiter in the same order, e.g. taken from the metadata of the
+// request with TokenFingerprint, or "" where a limiter does not apply. size is the number of bytes of the request, or -1 if it
+// is not known, in which case the bytes are not counted. returns how long to wait, and an error wrapping RateLimitExceededError,
+// if a limit is exceeded, in which case the request counts against none of the other limiters.
+func AdmitRequest(limiters []*RateLimiter, keys []string, size int64) (time.Duration, error) {
+	for i, limiter := range limiters {
+		if keys[i] == "" {
+			continue
+		}
+		if retryAfter, exceeded := limiter.admit(keys[i], size); exceeded != "" {
+			// so that the request only counts against the limit which rejected it
+			for j, admitted := range limiters[:i] {
+				if keys[j] != "" {
+					admitted.refund(keys[j], size)
+				}
+			}
+			return retryAfter, fmt.Errorf("ADB-0120 the %s limit of %s was exceeded, retry after %s: %w", limiter.name, exceeded, retryAfter.Round(time.Millisecond), RateLimitExceededError)
+		}
+	}
+	return 0, nil
+}
+
+// takes a request, and the bytes of its body if they are known, from the buckets of the client. returns how long to wait and the
+// limit that was exceeded, if the request is rejected.
+func (l *RateLimiter) admit(key string, contentLength int64) (time.Duration, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, client := l.refill(key)
+	if limit.RequestsPerSecond > 0 && client.requests < 1 {
+		client.metrics.Rejected++
+		return waitFor(1-client.requests, limit.RequestsPerSecond), fmt.Sprintf("%g requests per second", limit.RequestsPerSecond)
+	}
+	if limit.BytesPerSecond > 0 && client.bytes < 0 {
+		client.metrics.Rejected++
+		return waitFor(-client.bytes, limit.BytesPerSecond), fmt.Sprintf("%g bytes per second", limit.BytesPerSecond)
+	}
+	if limit.RequestsPerSecond > 0 {
+		client.requests--
+	}
+	if contentLength > 0 {
+		if limit.BytesPerSecond > 0 {
+			client.bytes -= float64(contentLength)
+		}
+		client.metrics.Bytes += contentLength
+	}
+	client.metrics.Allowed++
+	return 0, ""
+}
+
+// gives back what admit took for a request which was then rejected by another limiter
+func (l *RateLimiter) refund(key string, contentLength int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, client := l.refill(key)
+	if limit.RequestsPerSecond > 0 {
+		client.requests++
+	}
+	if contentLength > 0 {
+		if limit.BytesPerSecond > 0 {
+			client.bytes += float64(contentLength)
+		}
+		client.metrics.Bytes -= contentLength
+	}
+	client.metrics.Allowed--
+}
+
+// takes bytes which were read from the buckets of the client
+func (l *RateLimiter) consume(key string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, client := l.refill(key)
+	if limit.BytesPerSecond > 0 {
+		client.bytes -= float64(n)
+	}
+	client.metrics.Bytes += int64(n)
+}
+
+// returns the limit and the client with the key, adding to its buckets what has accrued since it was last updated
+func (l *RateLimiter) refill(key string) (RateLimit, *rateLimitedClient) {
+	now := schema.Now()
+	if now.Sub(l.pruned) > RATE_LIMIT_IDLE_EXPIRY {
+		for k, client := range l.clients {
+			if now.Sub(client.updated) > RATE_LIMIT_IDLE_EXPIRY {
+				delete(l.clients, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	limit, ok := l.limits[key]
+	if !ok {
+		limit = l.defaultLimit
+	}
+	requestBurst := burst(limit.RequestBurst, limit.RequestsPerSecond)
+	byteBurst := burst(limit.ByteBurst, limit.BytesPerSecond)
+	client, ok := l.clients[key]
+	if !ok {
+		client = &rateLimitedClient{requests: requestBurst, bytes: byteBurst, updated: now, metrics: RateLimitMetrics{Limiter: l.name, Key: key}}
+		l.clients[key] = client
+		return limit, client
+	}
+	elapsed := now.Sub(client.updated).Seconds()
+	client.requests = min(requestBurst, client.requests+elapsed*limit.RequestsPerSecond)
+	client.bytes = min(byteBurst, client.bytes+elapsed*limit.BytesPerSecond)
+	client.updated = now
+	return limit, client
+}
+
+func burst(configured float64, perSecond float64) float64 {
+	if configured > 0 {
+		return configured
+	}
+	return max(perSecond, 1)
+}
+
+func waitFor(amount float64, perSecond float64) time.Duration {
+	return time.Duration(amount / perSecond * float64(time.Second))
+}
+
+// counts the bytes of a body of unknown length against the limiter, as they are read
+type rateLimitedBody struct {
+	io.ReadCloser
+	limiter *RateLimiter
+	key     string
+}
+
+func (b *rateLimitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.limiter.consume(b.key, n)
+	}
+	return n, err
+}
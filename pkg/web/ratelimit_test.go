@@ -0,0 +1,115 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitHandler_RejectsRequestsOverTheLimitPerKey(t *testing.T) {
+	assert := assert.New(t)
+	clock := schema.NewManualClock(time.Now())
+	schema.SetClock(clock)
+	defer schema.SetClock(nil)
+
+	tokens := NewRateLimiter("token", BearerToken, RateLimit{RequestsPerSecond: 2})
+	tenants := NewRateLimiter("tenant", Tenant, RateLimit{RequestsPerSecond: 100})
+	tenants.SetLimit("small", RateLimit{RequestsPerSecond: 1})
+	handler := RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tokens, tenants)
+	request := func(token string, tenant string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set(HEADER_TENANT, tenant)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(http.StatusOK, request("a", "big").Code)
+	assert.Equal(http.StatusOK, request("a", "big").Code)
+	w := request("a", "big")
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+	assert.Contains(w.Body.String(), "the token limit of 2 requests per second")
+	assert.Equal(http.StatusOK, request("b", "big").Code) // other tokens are unaffected
+
+	assert.Equal(http.StatusOK, request("c", "small").Code)
+	w = request("d", "small")
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Contains(w.Body.String(), "tenant")
+
+	clock.Advance(time.Second)
+	assert.Equal(http.StatusOK, request("a", "small").Code)
+
+	metrics := tokens.Metrics()
+	if assert.Len(metrics, 4) {
+		// the tokens are not exposed, only their fingerprints
+		byKey := make(map[string]RateLimitMetrics)
+		for _, m := range metrics {
+			assert.NotContains([]string{"a", "b", "c", "d"}, m.Key)
+			byKey[m.Key] = m
+		}
+		assert.Equal(RateLimitMetrics{Limiter: "token", Key: TokenFingerprint("a"), Allowed: 3, Rejected: 1}, byKey[TokenFingerprint("a")])
+		assert.Equal(RateLimitMetrics{Limiter: "token", Key: TokenFingerprint("d")}, byKey[TokenFingerprint("d")]) // only counted by the tenant limit, which rejected it
+	}
+	assert.Equal(int64(1), tenants.Metrics()[1].Rejected)
+}
+
+func TestAdmitRequest_RefundsTheLimitersWhichAdmittedARejectedRequest(t *testing.T) {
+	assert := assert.New(t)
+	clock := schema.NewManualClock(time.Now())
+	schema.SetClock(clock)
+	defer schema.SetClock(nil)
+
+	tokens := NewRateLimiter("token", BearerToken, RateLimit{RequestsPerSecond: 10})
+	tenants := NewRateLimiter("tenant", Tenant, RateLimit{RequestsPerSecond: 1})
+	limiters := []*RateLimiter{tokens, tenants}
+	key := TokenFingerprint("secret")
+
+	_, err := AdmitRequest(limiters, []string{key, "acme"}, 10)
+	assert.NoError(err)
+	retryAfter, err := AdmitRequest(limiters, []string{key, "acme"}, 10)
+	assert.ErrorIs(err, RateLimitExceededError)
+	assert.ErrorContains(err, "the tenant limit of 1 requests per second")
+	assert.Equal(time.Second, retryAfter)
+	assert.Equal(http.StatusTooManyRequests, StatusCode(err))
+	_, err = AdmitRequest(limiters, []string{key, ""}, -1) // not limited by tenant
+	assert.NoError(err)
+
+	assert.Equal(RateLimitMetrics{Limiter: "token", Key: key, Allowed: 2, Bytes: 10}, tokens.Metrics()[0])
+	assert.Equal(RateLimitMetrics{Limiter: "tenant", Key: "acme", Allowed: 1, Rejected: 1, Bytes: 10}, tenants.Metrics()[0])
+}
+
+func TestRateLimitHandler_CountsBytesOfBodiesOfUnknownLength(t *testing.T) {
+	assert := assert.New(t)
+	clock := schema.NewManualClock(time.Now())
+	schema.SetClock(clock)
+	defer schema.SetClock(nil)
+
+	tenants := NewRateLimiter("tenant", Tenant, RateLimit{BytesPerSecond: 10})
+	handler := RateLimitHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+	}), tenants)
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("0123456789012345678901234567890123456789"))
+		r.ContentLength = -1 // e.g. a chunked stream
+		r.Header.Set(HEADER_TENANT, "t")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(http.StatusOK, request().Code)
+	w := request()
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("3", w.Header().Get("Retry-After")) // 30 bytes in debt
+	clock.Advance(3 * time.Second)
+	assert.Equal(http.StatusOK, request().Code)
+	assert.Equal(int64(80), tenants.Metrics()[0].Bytes)
+}
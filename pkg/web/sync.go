@@ -0,0 +1,166 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the largest body of a push
+const MAX_SYNC_PUSH_SIZE = 16 * 1024 * 1024
+
+// the prefix of the query parameters of a pull which filter the objects by an indexed field, e.g. `where.Owner=john`
+const SYNC_FILTER_PREFIX = "where."
+
+// the outcome of one change of a push, which are sent in the order of the changes
+type SyncPushStatus struct {
+	Id string `json:"id"`
+	// the HTTP status code that pushing the change alone would have responded with. 409 if some fields conflict, in which case
+	// the others are written
+	Status int `json:"status"`
+	// of the object after the change, which the replica uses as the base of its next change to it
+	ETag      string                `json:"etag,omitempty"`
+	Conflicts []minio.FieldConflict `json:"conflicts,omitempty"`
+	// the commit token of the transaction that wrote the change. see CommitToken
+	CommitToken string `json:"commitToken,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// registers the sync endpoints of the table on the mux, at `/sync/<database>/<table>/`, with which replicas, e.g. on mobile or
+// edge devices, hold a copy of the table, or of part of it, and synchronise it whenever they are connected:
+//   - `GET pull?since=<token>` responds with a minio.SyncPull of the changes since the token, or with the snapshot if there is
+//     none. `max` limits the number of transactions whose changes are returned, `fields` the comma separated fields of the
+//     objects, and parameters like `where.<field>=<value>` select the objects, by fields which are indexed
+//   - `POST push` applies a JSON array of minio.SyncPush, and responds with a SyncPushStatus for each
+//
+// each change of a push is written in its own transaction, so that a push which is interrupted can be sent again. see
+// minio.PullChanges and minio.PushChange
+func RegisterSyncEndpoints[T any](mux *http.ServeMux, repo *minio.MinioRepository, table schema.Table, timeout time.Duration) {
+	prefix := fmt.Sprintf("/sync/%s/%s/", table.Database, table.Name)
+	mux.HandleFunc("GET "+prefix+"pull", SyncPull(repo, table))
+	mux.HandleFunc("POST "+prefix+"push", SyncPush[T](repo, table, timeout))
+}
+
+// responds with the changes to the table since the token in the query. see RegisterSyncEndpoints
+func SyncPull(repo *minio.MinioRepository, table schema.Table) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		query := r.URL.Query()
+		max := 0
+		if value := query.Get("max"); value != "" {
+			var err error
+			if max, err = strconv.Atoi(value); err != nil || max < 1 {
+				http.Error(w, "ADB-0157 max must be a positive number of transactions", http.StatusBadRequest)
+				return
+			}
+		}
+		filter, err := syncFilter(query, table)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pull, err := repo.PullChanges(r.Context(), table, query.Get("since"), max, filter)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pull)
+	}
+}
+
+// returns the filter of a pull, whose fields must be indexed
+func syncFilter(query map[string][]string, table schema.Table) (minio.ChangeFilter, error) {
+	filter := minio.ChangeFilter{IndexedFieldEquals: make(map[string]string)}
+	for key, values := range query {
+		field, ok := strings.CutPrefix(key, SYNC_FILTER_PREFIX)
+		if !ok {
+			continue
+		}
+		if _, err := table.GetIndex(field); err != nil {
+			return filter, fmt.Errorf("ADB-0337 the replica cannot be filtered by %s, since it is not indexed", field)
+		}
+		if len(values) != 1 {
+			return filter, fmt.Errorf("ADB-0338 the replica can only be filtered by one value of %s", field)
+		}
+		filter.IndexedFieldEquals[field] = values[0]
+	}
+	if fields := query["fields"]; len(fields) > 0 {
+		for _, field := range strings.Split(strings.Join(fields, ","), ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				filter.Fields = append(filter.Fields, field)
+			}
+		}
+	}
+	return filter, nil
+}
+
+// applies the changes in the body, each in its own transaction. see RegisterSyncEndpoints
+func SyncPush[T any](repo *minio.MinioRepository, table schema.Table, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		pushes := make([]minio.SyncPush, 0)
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_SYNC_PUSH_SIZE)).Decode(&pushes); err != nil {
+			http.Error(w, fmt.Sprintf("ADB-0339 the body is not an array of changes: %s", err), http.StatusBadRequest)
+			return
+		}
+		statuses := make([]SyncPushStatus, len(pushes))
+		for i, push := range pushes {
+			statuses[i] = pushChange[T](r, repo, table, timeout, push)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(statuses)
+	}
+}
+
+func pushChange[T any](r *http.Request, repo *minio.MinioRepository, table schema.Table, timeout time.Duration, push minio.SyncPush) SyncPushStatus {
+	status := SyncPushStatus{Id: push.Id}
+	tx, err := repo.BeginTransaction(r.Context(), timeout)
+	if err != nil {
+		status.setError(err)
+		return status
+	}
+	etag, conflicts, err := minio.PushChange[T](r.Context(), repo, &tx, table, push)
+	if err != nil {
+		repo.Rollback(r.Context(), &tx)
+		status.setError(err)
+		return status
+	}
+	result := repo.CommitWithResult(r.Context(), &tx)
+	if !result.Committed {
+		if !result.RolledBack {
+			repo.Rollback(r.Context(), &tx)
+		}
+		if len(result.Errors) > 0 {
+			status.setError(result.Errors[0])
+		} else {
+			status.setError(fmt.Errorf("ADB-0119 tx %s was not committed", tx.Id))
+		}
+		return status
+	}
+	switch {
+	case len(conflicts) > 0:
+		status.Status = http.StatusConflict
+	case push.BaseETag == "" && !push.Deleted:
+		status.Status = http.StatusCreated
+	default:
+		status.Status = http.StatusOK
+	}
+	if etag != nil {
+		status.ETag = *etag
+	}
+	status.Conflicts = conflicts
+	status.CommitToken = CommitToken(result.Report)
+	return status
+}
+
+func (s *SyncPushStatus) setError(err error) {
+	s.Status = StatusCode(err)
+	s.Error = err.Error()
+}
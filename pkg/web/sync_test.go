@@ -0,0 +1,50 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncPull_RejectsInvalidQueries(t *testing.T) {
+	assert := assert.New(t)
+	table := schema.NewTable(schema.NewDatabase("sync-tests"), "account", []string{"Name"})
+	// the queries are invalid, so no repository is needed
+	handler := SyncPull(nil, table)
+
+	for query, code := range map[string]string{"max=0": "ADB-0157", "max=many": "ADB-0157", "where.Email=john@example.com": "ADB-0337", "where.Name=john&where.Name=jane": "ADB-0338"} {
+		r := httptest.NewRequest(http.MethodGet, "/sync/sync-tests/account/pull?"+query, nil)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		assert.Equal(http.StatusBadRequest, w.Code, query)
+		assert.Contains(w.Body.String(), code, query)
+	}
+}
+
+func TestSyncPush_RejectsInvalidBodies(t *testing.T) {
+	assert := assert.New(t)
+	table := schema.NewTable(schema.NewDatabase("sync-tests"), "account", []string{"Name"})
+	handler := SyncPush[bulkAccount](nil, table, time.Second)
+
+	r := httptest.NewRequest(http.MethodPost, "/sync/sync-tests/account/push", strings.NewReader(`{"id":"1"}`))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "ADB-0339")
+}
+
+func TestSyncFilter(t *testing.T) {
+	assert := assert.New(t)
+	table := schema.NewTable(schema.NewDatabase("sync-tests"), "account", []string{"Owner"})
+	query, _ := url.ParseQuery("since=cdc/1&where.Owner=john&fields=id,%20name&fields=owner")
+	filter, err := syncFilter(query, table)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"Owner": "john"}, filter.IndexedFieldEquals)
+	assert.Equal([]string{"id", "name", "owner"}, filter.Fields)
+}
@@ -0,0 +1,191 @@
+package web
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// the version of the tus resumable upload protocol that the upload endpoints implement. see https://tus.io/protocols/resumable-upload
+const TUS_VERSION = "1.0.0"
+
+// the content type of the chunks of an upload
+const CONTENT_TYPE_OFFSET_OCTET_STREAM = "application/offset+octet-stream"
+
+// registers the endpoints of resumable uploads of attachments of the table on the mux, at `/uploads/<database>/<table>/`,
+// following the tus protocol with its creation, termination and expiration extensions:
+//   - `POST` creates an upload of `Upload-Length` bytes, responding with its `Location`
+//   - `HEAD <id>` responds with the `Upload-Offset` that the client should continue from, e.g. after its connection failed
+//   - `PATCH <id>` appends the body at `Upload-Offset`
+//   - `DELETE <id>` discards the upload
+//
+// uploads which are complete are attached to the entity that refers to them by calling `MinioRepository.AttachUpload` in the
+// transaction that writes the entity, e.g. in the handler which the client calls with the id of the upload, once it is done.
+// maxSize limits the length of uploads, in bytes.
+func RegisterUploadEndpoints(mux *http.ServeMux, repo *minio.MinioRepository, table schema.Table, maxSize int64) {
+	prefix := fmt.Sprintf("/uploads/%s/%s/", table.Database, table.Name)
+	mux.HandleFunc("OPTIONS "+prefix, UploadOptions(maxSize))
+	mux.HandleFunc("POST "+prefix, CreateUpload(repo, table, maxSize))
+	mux.HandleFunc("HEAD "+prefix+"{id}", UploadOffset(repo, table))
+	mux.HandleFunc("PATCH "+prefix+"{id}", UploadChunk(repo, table))
+	mux.HandleFunc("DELETE "+prefix+"{id}", TerminateUpload(repo, table))
+}
+
+// responds with the capabilities of the upload endpoints. see RegisterUploadEndpoints
+func UploadOptions(maxSize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", TUS_VERSION)
+		w.Header().Set("Tus-Version", TUS_VERSION)
+		w.Header().Set("Tus-Extension", "creation,termination,expiration")
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// creates an upload, whose content type is taken from the `filetype` or `contentType` of its `Upload-Metadata`.
+// see RegisterUploadEndpoints
+func CreateUpload(repo *minio.MinioRepository, table schema.Table, maxSize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		w.Header().Set("Tus-Resumable", TUS_VERSION)
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || length < 0 {
+			http.Error(w, "ADB-0138 the Upload-Length header must be the length of the upload in bytes", http.StatusBadRequest)
+			return
+		}
+		if length > maxSize {
+			http.Error(w, fmt.Sprintf("ADB-0297 the upload is longer than the maximum of %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		contentType := metadata["contentType"]
+		if contentType == "" {
+			contentType = metadata["filetype"]
+		}
+		session, err := repo.CreateUpload(r.Context(), table, length, contentType)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.Header().Set("Location", r.URL.Path+session.Id)
+		writeUploadHeaders(w, session)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// responds with the offset and length of the upload. see RegisterUploadEndpoints
+func UploadOffset(repo *minio.MinioRepository, table schema.Table) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		w.Header().Set("Tus-Resumable", TUS_VERSION)
+		session, err := getUpload(r, repo, table)
+		if err != nil {
+			w.WriteHeader(StatusCode(err))
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeUploadHeaders(w, session)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// appends the body of the request to the upload, responding with the new offset. a request which fails part way through
+// uploads nothing, so the client continues from the offset that HEAD responds with. see RegisterUploadEndpoints
+func UploadChunk(repo *minio.MinioRepository, table schema.Table) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		w.Header().Set("Tus-Resumable", TUS_VERSION)
+		if r.Header.Get("Content-Type") != CONTENT_TYPE_OFFSET_OCTET_STREAM {
+			http.Error(w, fmt.Sprintf("ADB-0298 the Content-Type of a chunk must be %s", CONTENT_TYPE_OFFSET_OCTET_STREAM), http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "ADB-0299 the Upload-Offset header must be the offset of the chunk in bytes", http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength < 0 {
+			http.Error(w, "ADB-0300 the Content-Length of a chunk is required", http.StatusLengthRequired)
+			return
+		}
+		if _, err := getUpload(r, repo, table); err != nil {
+			WriteError(w, err)
+			return
+		}
+		session, err := repo.UploadChunk(r.Context(), r.PathValue("id"), offset, r.Body, r.ContentLength)
+		if err != nil {
+			var mismatch *minio.UploadOffsetMismatchErrorWithDetails
+			if errors.As(err, &mismatch) {
+				w.Header().Set("Upload-Offset", strconv.FormatInt(mismatch.Offset, 10))
+			}
+			WriteError(w, err)
+			return
+		}
+		writeUploadHeaders(w, session)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// discards the upload. see RegisterUploadEndpoints
+func TerminateUpload(repo *minio.MinioRepository, table schema.Table) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		LogTable(r, table)
+		w.Header().Set("Tus-Resumable", TUS_VERSION)
+		if _, err := getUpload(r, repo, table); err != nil {
+			WriteError(w, err)
+			return
+		}
+		if err := repo.AbortUpload(r.Context(), r.PathValue("id")); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// returns the upload with the id in the path, which must be one of the table
+func getUpload(r *http.Request, repo *minio.MinioRepository, table schema.Table) (*minio.UploadSession, error) {
+	session, err := repo.GetUpload(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	if session.Database != string(table.Database) || session.Table != table.Name {
+		return nil, &minio.NoSuchKeyErrorWithDetails{Details: fmt.Sprintf("ADB-0301 no such upload %s", session.Id)}
+	}
+	return session, nil
+}
+
+func writeUploadHeaders(w http.ResponseWriter, session *minio.UploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	w.Header().Set("Upload-Expires", time.UnixMicro(session.ExpiresMicros).UTC().Format(http.TimeFormat))
+}
+
+// parses the `Upload-Metadata` header, i.e. comma separated keys, each followed by a space and its value encoded as base64
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("ADB-0302 the value of %s in the Upload-Metadata header is not base64: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
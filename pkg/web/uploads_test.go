@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadOptions(t *testing.T) {
+	assert := assert.New(t)
+	w := httptest.NewRecorder()
+	UploadOptions(1024)(w, httptest.NewRequest(http.MethodOptions, "/uploads/upload-tests/document/", nil))
+
+	assert.Equal(http.StatusNoContent, w.Code)
+	assert.Equal(TUS_VERSION, w.Header().Get("Tus-Version"))
+	assert.Equal("1024", w.Header().Get("Tus-Max-Size"))
+	assert.Contains(w.Header().Get("Tus-Extension"), "creation")
+}
+
+func TestUploads_RejectInvalidRequestsWithoutTouchingTheRepository(t *testing.T) {
+	assert := assert.New(t)
+	table := schema.NewTable(schema.NewDatabase("upload-tests"), "document", []string{})
+
+	send := func(handler http.HandlerFunc, method string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/uploads/upload-tests/document/", strings.NewReader("chunk"))
+		for key, value := range headers {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		assert.Equal(TUS_VERSION, w.Header().Get("Tus-Resumable"))
+		return w
+	}
+	assert.Equal(http.StatusBadRequest, send(CreateUpload(nil, table, 1024), http.MethodPost, nil).Code)
+	assert.Equal(http.StatusRequestEntityTooLarge, send(CreateUpload(nil, table, 1024), http.MethodPost, map[string]string{"Upload-Length": "1025"}).Code)
+	assert.Equal(http.StatusBadRequest, send(CreateUpload(nil, table, 1024), http.MethodPost, map[string]string{"Upload-Length": "10", "Upload-Metadata": "filetype !!"}).Code)
+
+	assert.Equal(http.StatusUnsupportedMediaType, send(UploadChunk(nil, table), http.MethodPatch, map[string]string{"Upload-Offset": "0"}).Code)
+	assert.Equal(http.StatusBadRequest, send(UploadChunk(nil, table), http.MethodPatch, map[string]string{"Content-Type": CONTENT_TYPE_OFFSET_OCTET_STREAM}).Code)
+}
+
+func TestParseUploadMetadata(t *testing.T) {
+	assert := assert.New(t)
+	metadata, err := parseUploadMetadata("filename d29ybGRfZG9taW5hdGlvbl9wbGFuLnBkZg==, filetype YXBwbGljYXRpb24vcGRm,is_confidential")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"filename": "world_domination_plan.pdf", "filetype": "application/pdf", "is_confidential": ""}, metadata)
+}
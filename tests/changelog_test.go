@@ -0,0 +1,588 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	m "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// returns the changes to the given table, from all change sets that can be polled
+func pollChangesToTable(t *testing.T, consumer *min.ChangeConsumer, table schema.Table) []min.Change {
+	changes := []min.Change{}
+	for {
+		changeSets, err := consumer.Poll(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changeSets) == 0 {
+			return changes
+		}
+		for _, changeSet := range changeSets {
+			for _, change := range changeSet.Changes {
+				if change.Table == table.Name {
+					changes = append(changes, change)
+				}
+			}
+		}
+	}
+}
+
+func TestChangeLog_ConsumersTailIndependentlyAndReplay(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableChangeLog()
+	defer repo.DisableChangeLog()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("changelog-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{})
+
+	consumerA, err := repo.NewChangeConsumer(ctx, "a-"+uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumerB, err := repo.NewChangeConsumer(ctx, "b-"+uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// insert, then update and insert in a second transaction, then delete in a third
+	account1 := &Account{Id: uuid.New().String(), Name: "John"}
+	account2 := &Account{Id: uuid.New().String(), Name: "Jane"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag1, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account1.Name = "Johnny"
+	etag1, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, account1, etag1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inserted and deleted within the same transaction, so never visible and not recorded
+	etag2, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.DeleteFromTable(ctx, &tx, T_ACCOUNT, account2, etag2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.DeleteFromTable(ctx, &tx, T_ACCOUNT, account1, etag1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// nothing is returned until the entries have settled
+	assert.Empty(pollChangesToTable(t, consumerA, T_ACCOUNT))
+	time.Sleep(time.Duration(min.CHANGE_LOG_SETTLE_MICROS)*time.Microsecond + time.Second)
+
+	changes := pollChangesToTable(t, consumerA, T_ACCOUNT)
+	assert.Equal(3, len(changes))
+	assert.Equal(min.CHANGE_INSERT, changes[0].Operation)
+	assert.Equal(account1.Id, changes[0].Id)
+	assert.JSONEq(`{"id":"`+account1.Id+`","name":"John"}`, string(changes[0].Data))
+	assert.Equal(min.CHANGE_UPDATE, changes[1].Operation)
+	assert.JSONEq(`{"id":"`+account1.Id+`","name":"Johnny"}`, string(changes[1].Data))
+	assert.Equal(min.CHANGE_DELETE, changes[2].Operation)
+	assert.Nil(changes[2].Data)
+	assert.NoError(consumerA.Commit(ctx))
+
+	// a consumer with the same name continues from the committed offset
+	consumerA2, err := repo.NewChangeConsumer(ctx, consumerA.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(consumerA.Position(), consumerA2.Position())
+	assert.Empty(pollChangesToTable(t, consumerA2, T_ACCOUNT))
+
+	// consumer b has its own offset, and so still sees everything
+	assert.Equal(3, len(pollChangesToTable(t, consumerB, T_ACCOUNT)))
+
+	// replay from the start
+	consumerA2.Seek("")
+	assert.Equal(3, len(pollChangesToTable(t, consumerA2, T_ACCOUNT)))
+}
+
+func TestChangeLog_ApplyWritesDerivedDataExactlyOnce(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableChangeLog()
+	defer repo.DisableChangeLog()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("changelog-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{})
+	T_COPY := schema.NewTable(DATABASE, "copy-"+uuid.New().String(), []string{})
+
+	name := "copier-" + uuid.New().String()
+	consumer, err := repo.NewChangeConsumer(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second instance of the same consumer, which is about to process the same changes
+	competitor, err := repo.NewChangeConsumer(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+	time.Sleep(time.Duration(min.CHANGE_LOG_SETTLE_MICROS)*time.Microsecond + time.Second)
+
+	copyInserts := func(ctx context.Context, tx *schema.Transaction, changeSet min.ChangeSet) error {
+		for _, change := range changeSet.Changes {
+			if change.Table == T_ACCOUNT.Name && change.Operation == min.CHANGE_INSERT {
+				if _, err := repo.InsertIntoTable(ctx, tx, T_COPY, &Account{Id: change.Id, Name: account.Name}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	applied, err := consumer.Apply(ctx, 1000, 10*time.Second, copyInserts)
+	assert.NoError(err)
+	assert.Greater(applied, 0)
+
+	// the competitor is unable to advance the offset, so its copy is not written either
+	_, err = competitor.Apply(ctx, 1000, 10*time.Second, copyInserts)
+	assert.Error(err)
+	assert.Equal("", competitor.Position())
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	copied := &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_COPY).WhereIdEquals(account.Id).Find(copied)
+	assert.NoError(err)
+	assert.Equal("John", copied.Name)
+
+	// nothing is left to apply
+	applied, err = consumer.Apply(ctx, 1000, 10*time.Second, copyInserts)
+	assert.NoError(err)
+	assert.Equal(0, applied)
+}
+
+func TestChangeLog_BootstrapStreamsSnapshotThenChangesWithoutDuplicates(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableChangeLog()
+	defer repo.DisableChangeLog()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("changelog-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{})
+
+	// committed just before the bootstrap, so it is both in the snapshot and in the change log around it
+	account1 := &Account{Id: uuid.New().String(), Name: "John"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	consumer, err := repo.NewChangeConsumer(ctx, "bootstrap-"+uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := []min.Change{}
+	err = consumer.Bootstrap(ctx, T_ACCOUNT, func(ctx context.Context, changeSet min.ChangeSet) error {
+		for _, change := range changeSet.Changes {
+			if change.Table == T_ACCOUNT.Name {
+				received = append(received, change)
+			}
+		}
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(1, len(received))
+	assert.Equal(account1.Id, received[0].Id)
+	assert.JSONEq(`{"id":"`+account1.Id+`","name":"John"}`, string(received[0].Data))
+
+	// bootstrapping again is not possible, since the position has been committed
+	assert.Error(consumer.Bootstrap(ctx, T_ACCOUNT, func(ctx context.Context, changeSet min.ChangeSet) error { return nil }))
+
+	// the live stream follows on
+	account2 := &Account{Id: uuid.New().String(), Name: "Jane"}
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+	time.Sleep(time.Duration(min.CHANGE_LOG_SETTLE_MICROS)*time.Microsecond + time.Second)
+
+	changes := pollChangesToTable(t, consumer, T_ACCOUNT)
+	assert.Equal(1, len(changes))
+	assert.Equal(account2.Id, changes[0].Id)
+}
+
+func TestChangeLog_FilterByTableAndIndexedFieldWithProjection(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableChangeLog()
+	defer repo.DisableChangeLog()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("changelog-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	T_OTHER := schema.NewTable(DATABASE, "other-"+uuid.New().String(), []string{"Name"})
+
+	consumer, err := repo.NewChangeConsumer(ctx, "filtered-"+uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the field must be indexed
+	assert.Error(consumer.SetFilter(&min.ChangeFilter{Tables: []schema.Table{T_ACCOUNT}, IndexedFieldEquals: map[string]string{"Id": "1"}}))
+	assert.NoError(consumer.SetFilter(&min.ChangeFilter{
+		Tables:             []schema.Table{T_ACCOUNT},
+		IndexedFieldEquals: map[string]string{"Name": "john"},
+		Fields:             []string{"Name"},
+	}))
+
+	john := &Account{Id: uuid.New().String(), Name: "John"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, insert := range []struct {
+		table   schema.Table
+		account *Account
+	}{{T_ACCOUNT, john}, {T_ACCOUNT, &Account{Id: uuid.New().String(), Name: "Jane"}}, {T_OTHER, &Account{Id: uuid.New().String(), Name: "John"}}} {
+		if _, err := repo.InsertIntoTable(ctx, &tx, insert.table, insert.account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+	time.Sleep(time.Duration(min.CHANGE_LOG_SETTLE_MICROS)*time.Microsecond + time.Second)
+
+	changes := []min.Change{}
+	for {
+		changeSets, err := consumer.Poll(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changeSets) == 0 {
+			break
+		}
+		for _, changeSet := range changeSets {
+			changes = append(changes, changeSet.Changes...)
+		}
+	}
+	assert.Equal(1, len(changes))
+	assert.Equal(john.Id, changes[0].Id)
+	assert.JSONEq(`{"name":"John"}`, string(changes[0].Data))
+}
+
+func TestChangeLog_CompactionKeepsTheLatestChangePerObject(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableChangeLog()
+	defer repo.DisableChangeLog()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("changelog-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{})
+
+	// one account is updated twice, the other is deleted
+	account1 := &Account{Id: uuid.New().String(), Name: "John"}
+	account2 := &Account{Id: uuid.New().String(), Name: "Jane"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag1, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag2, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+	for _, name := range []string{"Johnny", "Jonathan"} {
+		tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account1.Name = name
+		etag1, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, account1, etag1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(repo.Commit(ctx, &tx))
+	}
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_ACCOUNT, account2, etag2))
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// only change sets older than two settle windows are compacted
+	time.Sleep(2*time.Duration(min.CHANGE_LOG_SETTLE_MICROS)*time.Microsecond + time.Second)
+	result, err := repo.CompactChangeLog(ctx, min.CompactionPolicy{KeepLatest: 1, TombstoneRetention: time.Millisecond})
+	assert.NoError(err)
+	assert.GreaterOrEqual(result.ChangesRemoved, 4)
+
+	consumer, err := repo.NewChangeConsumer(ctx, "compacted-"+uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := pollChangesToTable(t, consumer, T_ACCOUNT)
+	assert.Equal(1, len(changes))
+	assert.Equal(account1.Id, changes[0].Id)
+	assert.Equal(min.CHANGE_UPDATE, changes[0].Operation)
+	assert.JSONEq(`{"id":"`+account1.Id+`","name":"Jonathan"}`, string(changes[0].Data))
+}
+
+func TestPublisher_PublishesSnapshotThenChangesIncrementally(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableChangeLog()
+	defer repo.DisableChangeLog()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("changelog-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	folder := "public/" + uuid.New().String() + "/"
+
+	write := func(write func(tx *schema.Transaction) error) {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(write(&tx))
+		assert.Empty(repo.Commit(ctx, &tx))
+	}
+	john := &Account{Id: uuid.New().String(), Name: "John"}
+	jane := &Account{Id: uuid.New().String(), Name: "Jane"}
+	write(func(tx *schema.Transaction) error {
+		if _, err := repo.InsertIntoTable(ctx, tx, T_ACCOUNT, john); err != nil {
+			return err
+		}
+		_, err := repo.InsertIntoTable(ctx, tx, T_ACCOUNT, jane)
+		return err
+	})
+
+	readManifest := func() min.PublishedManifest {
+		object, err := repo.Client.GetObject(ctx, repo.BucketName, folder+min.PUBLISHED_MANIFEST, m.GetObjectOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer object.Close()
+		var manifest min.PublishedManifest
+		assert.NoError(json.NewDecoder(object).Decode(&manifest))
+		return manifest
+	}
+	sorted := func(ids ...string) []string {
+		slices.Sort(ids)
+		return ids
+	}
+
+	publisher, err := min.NewPublisher[Account](ctx, repo, T_ACCOUNT, folder, min.PublishOptions{CacheControl: "public, max-age=60"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = publisher.Publish(ctx)
+	assert.NoError(err)
+	manifest := readManifest()
+	assert.Equal(sorted(john.Id, jane.Id), manifest.Ids)
+	assert.Equal(map[string][]string{"John": {john.Id}, "Jane": {jane.Id}}, manifest.Indices["Name"])
+	info, err := repo.Client.StatObject(ctx, repo.BucketName, folder+john.Id+".json", m.StatObjectOptions{})
+	assert.NoError(err)
+	assert.Equal("application/json", info.ContentType)
+	assert.Equal("public, max-age=60", info.Metadata.Get("Cache-Control"))
+
+	// only the changes are published, in a new process too
+	rename := *john
+	rename.Name = "Johnny"
+	write(func(tx *schema.Transaction) error {
+		snapshot := []*Account{}
+		etags, err := min.NewTypedQuery[Account](repo, ctx, tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").Find(&snapshot)
+		if err != nil {
+			return err
+		}
+		_, err = repo.UpdateTable(ctx, tx, T_ACCOUNT, &rename, (*etags)[john.Id])
+		return err
+	})
+	write(func(tx *schema.Transaction) error {
+		snapshot := []*Account{}
+		etags, err := min.NewTypedQuery[Account](repo, ctx, tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "Jane").Find(&snapshot)
+		if err != nil {
+			return err
+		}
+		return repo.DeleteFromTable(ctx, tx, T_ACCOUNT, jane, (*etags)[jane.Id])
+	})
+	time.Sleep(time.Duration(min.CHANGE_LOG_SETTLE_MICROS)*time.Microsecond + time.Second)
+
+	publisher, err = min.NewPublisher[Account](ctx, repo, T_ACCOUNT, folder, min.PublishOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := publisher.Publish(ctx)
+	assert.NoError(err)
+	assert.Equal(2, count)
+	manifest = readManifest()
+	assert.Equal([]string{john.Id}, manifest.Ids)
+	assert.Equal(map[string][]string{"Johnny": {john.Id}}, manifest.Indices["Name"])
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, folder+jane.Id+".json", m.StatObjectOptions{})
+	assert.Equal("NoSuchKey", m.ToErrorResponse(err).Code)
+
+	// nothing new to publish
+	count, err = publisher.Publish(ctx)
+	assert.NoError(err)
+	assert.Equal(0, count)
+}
+
+func TestChangeLog_ReplicasPullTheirPartOfATableAndPushTheirChanges(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableChangeLog()
+	defer repo.DisableChangeLog()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("changelog-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "issue-"+uuid.New().String(), []string{"CreatedBy"})
+
+	insert := func(issue *Issue) *string {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		etag, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(repo.Commit(ctx, &tx))
+		return etag
+	}
+	mine := &Issue{Id: uuid.New().String(), Title: "mine", CreatedBy: "john"}
+	etag := insert(mine)
+	insert(&Issue{Id: uuid.New().String(), Title: "theirs", CreatedBy: "jane"})
+
+	// the replica only holds the issues of john
+	filter := min.ChangeFilter{IndexedFieldEquals: map[string]string{"CreatedBy": "john"}}
+	pull, err := repo.PullChanges(ctx, T_ISSUE, "", 0, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(pull.Changes, 1) {
+		assert.Equal(mine.Id, pull.Changes[0].Id)
+		assert.Equal(*etag, pull.Changes[0].ETag)
+	}
+	assert.False(pull.More)
+
+	// while it is offline, john changes the title elsewhere, and the replica changes it too, as well as the body
+	other := *mine
+	other.Title = "changed elsewhere"
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.UpdateTable(ctx, &tx, T_ISSUE, &other, etag); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	push := min.SyncPush{ClientChangeSet: min.ClientChangeSet{Id: mine.Id, BaseETag: *etag, Changes: map[string]json.RawMessage{
+		"title": json.RawMessage(`"changed offline"`),
+		"body":  json.RawMessage(`"written offline"`),
+	}}}
+	_, conflicts, err := min.PushChange[Issue](ctx, repo, &tx, T_ISSUE, push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+	if assert.Len(conflicts, 1) {
+		assert.Equal("title", conflicts[0].Field)
+	}
+
+	// the replica created an issue too
+	created := min.SyncPush{ClientChangeSet: min.ClientChangeSet{Id: uuid.New().String(), Changes: map[string]json.RawMessage{
+		"title":     json.RawMessage(`"created offline"`),
+		"createdBy": json.RawMessage(`"john"`),
+	}}}
+	created.Changes["id"] = json.RawMessage(`"` + created.Id + `"`)
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := min.PushChange[Issue](ctx, repo, &tx, T_ISSUE, created); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// once the changes settle, the replica pulls them, including its own
+	time.Sleep(time.Duration(min.CHANGE_LOG_SETTLE_MICROS)*time.Microsecond + time.Second)
+	pull, err = repo.PullChanges(ctx, T_ISSUE, pull.Since, 0, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(pull.Changes, 3) {
+		assert.Equal(mine.Id, pull.Changes[0].Id)
+		assert.Equal(mine.Id, pull.Changes[1].Id)
+		assert.JSONEq(`{"id":"`+mine.Id+`","title":"changed elsewhere","body":"written offline","createdBy":"john"}`, string(pull.Changes[1].Data))
+		assert.Equal(created.Id, pull.Changes[2].Id)
+	}
+
+	_, err = repo.PullChanges(ctx, T_ISSUE, "garbage", 0, filter)
+	assert.ErrorIs(err, min.InvalidSyncTokenError)
+}
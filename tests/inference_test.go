@@ -0,0 +1,174 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	m "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+func TestInferSchema_NativeAndPlainTables(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("inference-" + uuid.New().String())
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: name})
+		assert.NoError(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// plain objects, written by something else
+	for i, customer := range []string{
+		`{"email": "a@example.com", "status": "active", "age": 30, "createdAt": "2026-03-01T10:00:00Z", "bio": null}`,
+		`{"email": "b@example.com", "status": "active", "age": 41, "createdAt": "2026-03-02T10:00:00Z"}`,
+		`{"email": "c@example.com", "status": "closed", "age": 25, "createdAt": "2026-03-03T10:00:00Z"}`,
+		`not json`,
+	} {
+		key := fmt.Sprintf("%s/crm/customers/%d.json", DATABASE, i)
+		_, err := repo.Client.PutObject(ctx, repo.BucketName, key, bytes.NewReader([]byte(customer)), int64(len(customer)), m.PutObjectOptions{ContentType: "application/json"})
+		assert.NoError(err)
+	}
+
+	tables, err := repo.InferSchema(ctx, string(DATABASE))
+	assert.NoError(err)
+	if !assert.Len(tables, 2) {
+		return
+	}
+
+	account := tables[0]
+	assert.Equal("account", account.Table.Name)
+	assert.True(account.Native)
+	assert.Equal(T_ACCOUNT.DataPathPrefix(), account.Source)
+	assert.Equal(2, account.Objects)
+	if assert.Len(account.Table.Indices, 1) {
+		assert.Equal("Name", account.Table.Indices[0].Field)
+	}
+	// the existing index is not suggested again
+	assert.Empty(account.Suggestions)
+
+	customers := tables[1]
+	assert.Equal(DATABASE, customers.Table.Database)
+	assert.Equal("customers", customers.Table.Name)
+	assert.False(customers.Native)
+	assert.Equal(4, customers.Objects)
+	assert.Equal(1, customers.Invalid)
+	keys := make([]string, 0, len(customers.Fields))
+	for _, field := range customers.Fields {
+		keys = append(keys, field.Key)
+	}
+	assert.Equal([]string{"age", "bio", "createdAt", "email", "status"}, keys)
+	assert.Equal("CreatedAt", customers.Fields[2].Field)
+	assert.Equal([]string{"string"}, customers.Fields[2].Types)
+
+	suggestions := make(map[string]schema.Index)
+	for _, suggestion := range customers.Suggestions {
+		assert.NotEmpty(suggestion.Reason)
+		suggestions[suggestion.Index.Field] = suggestion.Index
+	}
+	assert.Len(suggestions, 4)
+	assert.True(suggestions["Age"].Numeric)
+	assert.True(suggestions["CreatedAt"].Time)
+	assert.True(suggestions["Email"].Unique)
+	assert.Contains(suggestions, "Status")
+	assert.NotContains(suggestions, "Bio")
+}
+
+func TestScanTable_RecordBatchesFromASnapshot(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Sale struct {
+		Id       string            `json:"id"`
+		Product  string            `json:"product"`
+		Amount   float64           `json:"amount"`
+		Paid     bool              `json:"paid"`
+		SoldAt   time.Time         `json:"soldAt"`
+		Discount *float64          `json:"discount"`
+		Extra    map[string]string `json:"extra,omitempty"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("inference-" + uuid.New().String())
+	T_SALE := schema.NewTable(DATABASE, "sale", []string{})
+
+	soldAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	discount := 0.1
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		sale := &Sale{Id: fmt.Sprintf("%d", i), Product: "p", Amount: float64(i), Paid: i%2 == 0, SoldAt: soldAt}
+		if i == 0 {
+			sale.Discount = &discount
+			sale.Extra = map[string]string{"note": "first"}
+		}
+		_, err = repo.InsertIntoTable(ctx, &tx, T_SALE, sale)
+		assert.NoError(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tables, err := repo.InferSchema(ctx, string(DATABASE))
+	assert.NoError(err)
+	if !assert.Len(tables, 1) {
+		return
+	}
+	columns := min.InferredColumns(tables[0])
+	assert.Equal([]min.Column{
+		{Name: "amount", Type: min.COLUMN_NUMBER},
+		{Name: "discount", Type: min.COLUMN_NUMBER},
+		{Name: "extra", Type: min.COLUMN_JSON},
+		{Name: "id", Type: min.COLUMN_STRING},
+		{Name: "paid", Type: min.COLUMN_BOOLEAN},
+		{Name: "product", Type: min.COLUMN_STRING},
+		{Name: "soldAt", Type: min.COLUMN_TIME},
+	}, columns)
+
+	snapshot := schema.NewReadOnlyTransaction(10 * time.Second)
+	snapshot.BypassCache = true
+	batches := []*min.RecordBatch{}
+	for batch, err := range min.ScanTable(ctx, repo, &snapshot, T_SALE, columns, 2) {
+		if !assert.NoError(err) {
+			return
+		}
+		batches = append(batches, batch)
+	}
+	if !assert.Len(batches, 3) {
+		return
+	}
+	assert.Equal(2, batches[0].Rows)
+	assert.Equal(1, batches[2].Rows)
+	first := batches[0]
+	assert.Equal([]string{"0", "1"}, first.Ids)
+	assert.Equal([]float64{0, 1}, first.Values[0].Numbers)
+	assert.Equal([]bool{true, false}, first.Values[1].Valid)
+	assert.Equal([]float64{0.1, 0}, first.Values[1].Numbers)
+	assert.JSONEq(`{"note":"first"}`, first.Values[2].Strings[0])
+	assert.Equal([]bool{true, false}, first.Values[2].Valid)
+	assert.Equal([]bool{true, false}, first.Values[4].Booleans)
+	assert.True(soldAt.Equal(first.Values[6].Times[1]))
+
+	// values which do not have the type of their column
+	for _, err := range min.ScanTable(ctx, repo, &snapshot, T_SALE, []min.Column{{Name: "product", Type: min.COLUMN_NUMBER}}, 0) {
+		assert.ErrorContains(err, "ADB-0135")
+		break
+	}
+}
@@ -0,0 +1,57 @@
+package minio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+func TestJournal_RecordsCommitsInOrderPerDatabase(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableCommitJournal()
+	defer repo.DisableCommitJournal()
+	ctx := context.Background()
+
+	DATABASE := schema.NewDatabase("journal-tests-" + uuid.New().String())
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	txIds := []string{}
+	for _, name := range []string{"John", "Jane"} {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(repo.Commit(ctx, &tx))
+		txIds = append(txIds, tx.Id)
+	}
+
+	entries, err := repo.ReadCommitJournal(ctx, DATABASE, 0, 10)
+	assert.NoError(err)
+	assert.Equal(2, len(entries))
+	for i, entry := range entries {
+		assert.Equal(uint64(i+1), entry.Sequence)
+		assert.Equal(txIds[i], entry.TransactionId)
+		// data, index and reverse indices
+		assert.Equal(3, len(entry.Steps))
+		assert.Equal(schema.STEP_INSERT_DATA, entry.Steps[0].Type)
+		assert.NotNil(entry.Steps[0].FinalVersionId)
+	}
+
+	// reading continues after a sequence number
+	entries, err = repo.ReadCommitJournal(ctx, DATABASE, 1, 10)
+	assert.NoError(err)
+	assert.Equal(1, len(entries))
+	assert.Equal(txIds[1], entries[0].TransactionId)
+}
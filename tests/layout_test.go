@@ -0,0 +1,109 @@
+package minio
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	m "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+// stores objects as `<folder>/<id>`, without an extension, and names index entries after just the id
+type flatPathLayout struct {
+	schema.DefaultPathLayout
+	folder string
+}
+
+func (l flatPathLayout) DataPath(table *schema.Table, id string) string {
+	return l.folder + "/" + id
+}
+
+func (l flatPathLayout) DataPathPrefix(table *schema.Table) string {
+	return l.folder + "/"
+}
+
+func (l flatPathLayout) IdFromDataPath(table *schema.Table, path string) (string, bool) {
+	id, found := strings.CutPrefix(path, l.DataPathPrefix(table))
+	return id, found && id != "" && !strings.Contains(id, "/")
+}
+
+func (flatPathLayout) IndexEntryName(index *schema.Index, id string) string {
+	return id
+}
+
+func (flatPathLayout) ParseIndexEntryName(index *schema.Index, name string) (*schema.DatabaseTableIdTuple, error) {
+	return &schema.DatabaseTableIdTuple{Database: string(index.Table.Database), Table: index.Table.Name, Id: name}, nil
+}
+
+func TestPathLayout_ObjectsAndIndexEntriesAreStoredWhereTheLayoutSays(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Order struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	folder := "flat-" + uuid.New().String()
+	T_ORDER := schema.NewTable(DATABASE, "order-"+uuid.New().String(), []string{"Status"}).WithPathLayout(flatPathLayout{folder: folder})
+	defer schema.RegisterMappedTable(T_ORDER)()
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := &Order{Id: uuid.New().String(), Status: "open"}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ORDER, order)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, folder+"/"+order.Id, m.StatObjectOptions{})
+	assert.NoError(err)
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, fmt.Sprintf("%s/%s/indices/Status/op/open/%s", DATABASE, T_ORDER.Name, order.Id), m.StatObjectOptions{})
+	assert.NoError(err)
+
+	findByStatus := func(status string) ([]*Order, map[string]*string) {
+		tx := schema.NewReadOnlyTransaction(10 * time.Second)
+		orders := []*Order{}
+		etags, err := min.NewTypedQuery[Order](repo, ctx, &tx).SelectFromTable(T_ORDER).WhereIndexedFieldEquals("Status", status).Find(&orders)
+		assert.NoError(err)
+		return orders, *etags
+	}
+	orders, etags := findByStatus("open")
+	if assert.Len(orders, 1) {
+		assert.Equal(*order, *orders[0])
+	}
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Status = "shipped"
+	_, err = repo.UpdateTable(ctx, &tx, T_ORDER, order, etags[order.Id])
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	orders, _ = findByStatus("open")
+	assert.Empty(orders)
+	orders, etags = findByStatus("shipped")
+	assert.Len(orders, 1)
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_ORDER, order, etags[order.Id]))
+	assert.Empty(repo.Commit(ctx, &tx))
+	orders, _ = findByStatus("shipped")
+	assert.Empty(orders)
+}
@@ -0,0 +1,156 @@
+package minio
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+type recordingMetrics struct {
+	counters  map[string]int64
+	gauges    map[string]float64
+	durations []recordedDuration
+	mu        sync.Mutex
+}
+
+type recordedDuration struct {
+	ctx    context.Context
+	name   string
+	labels map[string]string
+}
+
+func (m *recordingMetrics) AddToCounter(name string, delta int64, labels map[string]string) {
+	m.counters[name] += delta
+}
+
+func (m *recordingMetrics) SetGauge(name string, value float64, labels map[string]string) {
+	m.gauges[name] = value
+}
+
+func (m *recordingMetrics) RecordDuration(ctx context.Context, name string, duration time.Duration, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.durations = append(m.durations, recordedDuration{ctx, name, labels})
+}
+
+type recordingIndexHealthCallback struct {
+	TestCallback
+	changes []min.IndexHealth
+}
+
+func (c *recordingIndexHealthCallback) IndexHealthChanged(health min.IndexHealth) {
+	c.changes = append(c.changes, health)
+}
+
+func TestMetrics_CallbacksAreExportedToTheBackendAndPassedOn(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := &recordingMetrics{counters: make(map[string]int64), gauges: make(map[string]float64)}
+	next := &recordingIndexHealthCallback{}
+	callback := min.NewMetricsCallback(metrics, next)
+
+	callback.IndexHealthChanged(min.IndexHealth{Database: "db", Table: "t", Field: "Name", Applied: 7, Pending: 3, Inconsistent: true})
+	callback.MultipartUploadAborted("db/t/data/1.json", 1024)
+	callback.MultipartUploadAborted("db/t/data/2.json", 1024)
+
+	assert.Equal(7.0, metrics.gauges[min.METRIC_INDEX_APPLIED])
+	assert.Equal(3.0, metrics.gauges[min.METRIC_INDEX_PENDING])
+	assert.Equal(1.0, metrics.gauges[min.METRIC_INDEX_INCONSISTENT])
+	assert.Equal(int64(2), metrics.counters[min.METRIC_MULTIPART_UPLOADS_ABORTED])
+	assert.Equal(int64(2048), metrics.counters[min.METRIC_STORAGE_RECLAIMED_BYTES])
+	// the next callback does not implement StorageReclaimedCallback, so it only gets the health
+	assert.Len(next.changes, 1)
+
+	// OpenTelemetry instruments are created as they are used
+	otel := min.NewOpenTelemetryMetrics(noop.NewMeterProvider().Meter("abstrastore"), func(err error) { assert.NoError(err) })
+	otel.AddToCounter(min.METRIC_GC_ERRORS, 1, nil)
+	otel.SetGauge(min.METRIC_INDEX_PENDING, 3, map[string]string{"table": "t"})
+	otel.RecordDuration(context.Background(), min.METRIC_COMMIT_DURATION, time.Second, map[string]string{"outcome": "committed"})
+}
+
+func TestMetrics_StatsdSendsDogStatsdDatagrams(t *testing.T) {
+	assert := assert.New(t)
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	statsd, err := min.NewStatsdMetrics(server.LocalAddr().String(), "myservice.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statsd.Close()
+
+	read := func() string {
+		buffer := make([]byte, 1024)
+		_ = server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := server.ReadFrom(buffer)
+		assert.NoError(err)
+		return string(buffer[:n])
+	}
+	statsd.AddToCounter(min.METRIC_GC_ERRORS, 1, nil)
+	assert.Equal("myservice.abstrastore_gc_errors_total:1|c", read())
+	statsd.SetGauge(min.METRIC_INDEX_PENDING, 2.5, map[string]string{"table": "t", "database": "db"})
+	assert.Equal("myservice.abstrastore_index_pending:2.5|g|#database:db,table:t", read())
+	statsd.RecordDuration(context.Background(), min.METRIC_COMMIT_DURATION, 1500*time.Microsecond, map[string]string{"outcome": "committed"})
+	assert.Equal("myservice.abstrastore_commit_duration_seconds:1.5|ms|#outcome:committed", read())
+}
+
+type traceKey struct{}
+
+func TestMetrics_LatenciesAreRecordedWithTheContextOfTheOperation(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	metrics := &recordingMetrics{counters: make(map[string]int64), gauges: make(map[string]float64)}
+	repo.SetMetrics(metrics)
+	defer repo.SetMetrics(nil)
+
+	// stands for the span of the request, which backends attach to the measurements as exemplars
+	ctx := context.WithValue(context.Background(), traceKey{}, "4bf92f3577b34da6a3ce929d0e0e4736")
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "metrics-account-"+uuid.New().String(), []string{"Name"})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: "John"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	var accounts []*Account
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").Find(&accounts)
+	assert.NoError(err)
+	for _, err := range min.ScanTable(ctx, repo, &tx, T_ACCOUNT, []min.Column{{Name: "name", Type: min.COLUMN_STRING}}, 10) {
+		assert.NoError(err)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	names := make([]string, 0, len(metrics.durations))
+	for _, duration := range metrics.durations {
+		names = append(names, duration.name)
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", duration.ctx.Value(traceKey{}))
+		switch duration.name {
+		case min.METRIC_COMMIT_DURATION:
+			assert.Equal(map[string]string{"outcome": "committed"}, duration.labels)
+		case min.METRIC_QUERY_DURATION:
+			assert.Equal(map[string]string{"database": string(DATABASE), "table": T_ACCOUNT.Name, "field": "Name", "kind": "equals"}, duration.labels)
+		}
+	}
+	assert.Equal([]string{min.METRIC_COMMIT_DURATION, min.METRIC_QUERY_DURATION, min.METRIC_SCAN_DURATION}, names)
+}
@@ -0,0 +1,243 @@
+package minio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	m "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+type recordingSender struct {
+	sent []*min.OutboxMessage
+	fail bool
+}
+
+func (s *recordingSender) Send(ctx context.Context, message *min.OutboxMessage) error {
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.sent = append(s.sent, message)
+	return nil
+}
+
+type OrderConfirmation struct {
+	OrderId string
+	Name    string
+}
+
+func TestOutbox_MessagesAreOnlySentOnceTheTransactionCommits(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	channel := "test-" + uuid.New().String()
+	sender := &recordingSender{}
+	min.RegisterMessageSender(channel, sender)
+	// retried immediately
+	repo.SetOutboxRetryPolicy(min.OutboxRetryPolicy{MaxAttempts: 3})
+	defer repo.SetOutboxRetryPolicy(min.DEFAULT_OUTBOX_RETRY_POLICY)
+
+	confirmation, err := min.NewMessageTemplate(channel, channel, "Order {{.OrderId}} confirmed", "Dear {{.Name}}, thank you.", func(payload OrderConfirmation) error {
+		if payload.OrderId == "" {
+			return errors.New("missing order id")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = min.NewMessageTemplate[OrderConfirmation]("broken", channel, "{{.OrderId", "", nil)
+	assert.ErrorContains(err, "ADB-0080")
+
+	// rolled back, so never sent
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = confirmation.Enqueue(ctx, repo, &tx, []string{"john@example.com"}, OrderConfirmation{})
+	assert.ErrorContains(err, "ADB-0081")
+	_, err = confirmation.Enqueue(ctx, repo, &tx, []string{"john@example.com"}, OrderConfirmation{OrderId: "1", Name: "John"})
+	assert.NoError(err)
+	repo.Rollback(ctx, &tx)
+
+	// committed, so sent, but only once the sender is available
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := confirmation.Enqueue(ctx, repo, &tx, []string{"jane@example.com"}, OrderConfirmation{OrderId: "2", Name: "Jane"})
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	sender.fail = true
+	_, errs := repo.DispatchOutbox(ctx, 1000)
+	assert.NotEmpty(errs)
+	sender.fail = false
+	repo.DispatchOutbox(ctx, 1000)
+
+	assert.Equal(1, len(sender.sent))
+	assert.Equal(message.Id, sender.sent[0].Id)
+	assert.Equal("Order 2 confirmed", sender.sent[0].Subject)
+	assert.Equal("Dear Jane, thank you.", sender.sent[0].Body)
+	assert.Equal(1, sender.sent[0].Attempts)
+
+	// nothing is sent twice
+	repo.DispatchOutbox(ctx, 1000)
+	assert.Equal(1, len(sender.sent))
+}
+
+func TestOutbox_TransactionsOfTenantsEnqueueIntoTheOutboxOfTheirTenant(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	channel := "test-" + uuid.New().String()
+	sender := &recordingSender{}
+	min.RegisterMessageSender(channel, sender)
+	confirmation, err := min.NewMessageTemplate[OrderConfirmation](channel, channel, "Order {{.OrderId}} confirmed", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := schema.NewTenant("acme-" + uuid.New().String())
+
+	tx, err := repo.BeginTransactionForTenant(ctx, acme, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := confirmation.Enqueue(ctx, repo, &tx, []string{"john@example.com"}, OrderConfirmation{OrderId: "1", Name: "John"})
+	assert.NoError(err)
+	outbox := min.T_OUTBOX.WithTenant(acme)
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, outbox.Path(message.Id), m.StatObjectOptions{})
+	assert.NoError(err)
+
+	// not sent while the transaction which enqueued it is in progress
+	repo.DispatchOutbox(ctx, 1000)
+	assert.Empty(sender.sent)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	_, errs := repo.DispatchOutbox(ctx, 1000)
+	assert.Empty(errs)
+	if assert.Len(sender.sent, 1) {
+		assert.Equal(message.Id, sender.sent[0].Id)
+	}
+}
+
+func TestOutbox_MessagesWhichFailTooOftenAreMovedToTheDeadLetters(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	channel := "test-" + uuid.New().String()
+	sender := &recordingSender{fail: true}
+	min.RegisterMessageSender(channel, sender)
+	repo.SetOutboxRetryPolicy(min.OutboxRetryPolicy{MaxAttempts: 2, InitialDelay: time.Hour})
+	defer repo.SetOutboxRetryPolicy(min.DEFAULT_OUTBOX_RETRY_POLICY)
+
+	confirmation, err := min.NewMessageTemplate[OrderConfirmation](channel, channel, "Order {{.OrderId}} confirmed", "Dear {{.Name}}, thank you.", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := confirmation.Enqueue(ctx, repo, &tx, []string{"jane@example.com"}, OrderConfirmation{OrderId: "3", Name: "Jane"})
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	read := func(table schema.Table) (*min.OutboxMessage, error) {
+		tx := schema.NewReadOnlyTransaction(10 * time.Second)
+		read := &min.OutboxMessage{}
+		_, err := min.NewTypedQuery[min.OutboxMessage](repo, ctx, &tx).SelectFromTable(table).WhereIdEquals(message.Id).Find(read)
+		return read, err
+	}
+
+	// the first failure is retried, but not before the delay has passed, so it is skipped and does not block other messages
+	_, errs := repo.DispatchOutbox(ctx, 1000)
+	assert.NotEmpty(errs)
+	waiting, err := read(min.T_OUTBOX)
+	assert.NoError(err)
+	assert.Equal(1, waiting.Attempts)
+	assert.Contains(waiting.LastError, "unavailable")
+	assert.Zero(waiting.ClaimedUntilMicros)
+	assert.Greater(waiting.NextAttemptMicros, time.Now().UnixMicro())
+	_, errs = repo.DispatchOutbox(ctx, 1000)
+	for _, err := range errs {
+		assert.NotContains(err.Error(), message.Id)
+	}
+
+	// once the delay has passed, the second failure moves it to the dead letters
+	repo.SetOutboxRetryPolicy(min.OutboxRetryPolicy{MaxAttempts: 2})
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := min.NewTypedQuery[min.OutboxMessage](repo, ctx, &tx).SelectFromTable(min.T_OUTBOX).WhereIdEquals(message.Id).Find(waiting)
+	assert.NoError(err)
+	waiting.NextAttemptMicros = 0
+	_, err = repo.UpdateTable(ctx, &tx, min.T_OUTBOX, waiting, etag)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+	_, errs = repo.DispatchOutbox(ctx, 1000)
+	found := false
+	for _, err := range errs {
+		found = found || strings.Contains(err.Error(), "ADB-0179")
+	}
+	assert.True(found)
+	_, err = read(min.T_OUTBOX)
+	assert.True(errors.Is(err, min.NoSuchKeyError))
+	dead, err := read(min.T_OUTBOX_DEAD_LETTERS)
+	assert.NoError(err)
+	assert.Equal(2, dead.Attempts)
+
+	// requeued, it is sent once the sender is available
+	assert.NoError(repo.RequeueDeadLetter(ctx, message.Id))
+	sender.fail = false
+	repo.DispatchOutbox(ctx, 1000)
+	assert.Equal(1, len(sender.sent))
+	assert.Equal(message.Id, sender.sent[0].Id)
+	_, err = read(min.T_OUTBOX_DEAD_LETTERS)
+	assert.True(errors.Is(err, min.NoSuchKeyError))
+}
+
+func TestOutbox_SesSenderPostsSignedRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	var request *http.Request
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+		w.Write([]byte(`{"MessageId":"1"}`))
+	}))
+	defer server.Close()
+
+	sender := &min.SesSender{Region: "eu-central-1", AccessKeyId: "AKID", SecretAccessKey: "secret", From: "shop@example.com", Endpoint: server.URL}
+	message := &min.OutboxMessage{Id: uuid.New().String(), To: []string{"jane@example.com"}, Subject: "Order 4 confirmed", Body: "Dear Jane"}
+	assert.NoError(sender.Send(context.Background(), message))
+
+	assert.Equal("/v2/email/outbound-emails", request.URL.Path)
+	assert.True(strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+	assert.Contains(request.Header.Get("Authorization"), "/eu-central-1/ses/aws4_request")
+	assert.Equal("shop@example.com", body["FromEmailAddress"])
+	assert.Equal([]any{"jane@example.com"}, body["Destination"].(map[string]any)["ToAddresses"])
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusForbidden) })
+	assert.ErrorContains(sender.Send(context.Background(), message), "ADB-0183")
+}
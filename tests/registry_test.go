@@ -0,0 +1,476 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	m "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+func TestRegistry_RegisterTable_WatchSchemaEmitsUpdate(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("registry-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+
+	err := repo.RegisterTable(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition, err := repo.GetTableDefinition(context.Background(), T_ACCOUNT.SchemaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(T_ACCOUNT.Definition(), *definition)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := repo.WatchSchema(ctx, 100*time.Millisecond)
+
+	// give the watch time to read the existing definitions
+	time.Sleep(200 * time.Millisecond)
+
+	T_ACCOUNT = schema.NewTable(DATABASE, T_ACCOUNT.Name, []string{"Name", "Email"})
+	err = repo.RegisterTable(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if event.Path != T_ACCOUNT.SchemaPath() {
+				continue // another test
+			}
+			assert.Nil(event.Err)
+			assert.Equal(min.SCHEMA_CHANGE_UPDATED, event.Type)
+			assert.Equal([]string{"Name", "Email"}, event.Definition.Indices)
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event was emitted")
+		}
+	}
+}
+
+func TestRegistry_CheckCompatibility_RefusesDroppedIndex(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("registry-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name", "Email"}).WithVersion("1.1.0")
+
+	// not yet registered
+	err := repo.CheckCompatibility(context.Background(), []schema.Table{T_ACCOUNT})
+	assert.Nil(err)
+
+	err = repo.RegisterTable(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.CheckCompatibility(context.Background(), []schema.Table{T_ACCOUNT})
+	assert.Nil(err)
+
+	T_ACCOUNT_OLD := schema.NewTable(DATABASE, T_ACCOUNT.Name, []string{"Name"}).WithVersion("1.0.0")
+	err = repo.CheckCompatibility(context.Background(), []schema.Table{T_ACCOUNT_OLD})
+	assert.True(errors.Is(err, min.SchemaIncompatibleError))
+	var details *min.SchemaIncompatibleErrorWithDetails
+	assert.True(errors.As(err, &details))
+	assert.Equal(2, len(details.Problems)) // older, and missing the Email index
+}
+
+func TestAliases_ResolveTable_SwitchesPhysicalTable(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("registry-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+
+	// no alias
+	resolved, err := repo.ResolveTable(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(T_ACCOUNT.Name, resolved.Name)
+
+	err = repo.SetTableAlias(context.Background(), DATABASE, T_ACCOUNT.Name, T_ACCOUNT.Name+"-green")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err = repo.ResolveTable(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(T_ACCOUNT.Name+"-green", resolved.Name)
+	assert.Equal(resolved.Name, resolved.Indices[0].Table.Name)
+
+	err = repo.RemoveTableAlias(context.Background(), DATABASE, T_ACCOUNT.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err = repo.ResolveTable(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(T_ACCOUNT.Name, resolved.Name)
+}
+
+func TestRegistry_DataWrittenInANewerFormatIsRefused(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("registry-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+
+	// as if written by a newer node during a rolling upgrade
+	definition := T_ACCOUNT.Definition()
+	assert.Equal(schema.OBJECT_FORMAT_VERSION, definition.FormatVersion)
+	definition.FormatVersion = schema.FORMAT_VERSION + 1
+	data, err := json.Marshal(definition)
+	assert.NoError(err)
+	_, err = repo.Client.PutObject(ctx, repo.BucketName, T_ACCOUNT.SchemaPath(), bytes.NewReader(data), int64(len(data)), m.PutObjectOptions{ContentType: "application/json"})
+	assert.NoError(err)
+
+	err = repo.RegisterTable(ctx, T_ACCOUNT)
+	assert.True(errors.Is(err, min.FormatTooNewError), err)
+	err = repo.CheckCompatibility(ctx, []schema.Table{T_ACCOUNT})
+	var tooNew *min.FormatTooNewErrorWithDetails
+	assert.True(errors.As(err, &tooNew), err)
+	assert.Equal(T_ACCOUNT.SchemaPath(), tooNew.Path)
+	assert.Equal(schema.FORMAT_VERSION+1, tooNew.FormatVersion)
+
+	index, _ := T_ACCOUNT.GetIndex("Name")
+	_, err = repo.Client.PutObject(ctx, repo.BucketName, index.Path("John", uuid.New().String()), bytes.NewReader([]byte{}), 0, m.PutObjectOptions{UserMetadata: map[string]string{
+		schema.LAST_MODIFIED:      "0",
+		schema.FORMAT_VERSION_KEY: fmt.Sprintf("%d", schema.FORMAT_VERSION+1),
+	}})
+	assert.NoError(err)
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	accounts := []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").Find(&accounts)
+	assert.True(errors.Is(err, min.FormatTooNewError), err)
+
+	// data objects are neither read nor overwritten
+	account := &Account{Id: uuid.New().String(), Name: "Jane"}
+	_, err = repo.Client.PutObject(ctx, repo.BucketName, T_ACCOUNT.Path(account.Id), strings.NewReader(`{"id":"`+account.Id+`"}`), -1, m.PutObjectOptions{UserMetadata: map[string]string{
+		schema.LAST_MODIFIED:      "0",
+		schema.FORMAT_VERSION_KEY: fmt.Sprintf("%d", schema.FORMAT_VERSION+1),
+	}})
+	assert.NoError(err)
+	readTx = schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(&Account{})
+	assert.True(errors.Is(err, min.FormatTooNewError), err)
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := "abc"
+	_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, account, &etag)
+	assert.True(errors.Is(err, min.FormatTooNewError), err)
+	err = repo.DeleteFromTable(ctx, &tx, T_ACCOUNT, account, &etag)
+	assert.True(errors.Is(err, min.FormatTooNewError), err)
+	assert.Empty(tx.Steps)
+	repo.Rollback(ctx, &tx)
+}
+
+func TestRegistry_LoadTable_ResolvesTheRegisteredTable(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("registry-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "issue-"+uuid.New().String(), []string{"Title"}).WithUniqueIndex("CreatedBy")
+
+	_, err := repo.LoadTable(ctx, DATABASE, T_ISSUE.Name)
+	assert.True(errors.Is(err, min.NoSuchKeyError), err)
+
+	if err := repo.RegisterTable(ctx, T_ISSUE); err != nil {
+		t.Fatal(err)
+	}
+	T_ISSUE = T_ISSUE.WithSparseIndex("Body").WithVersion("1.1.0")
+	if err := repo.RegisterTable(ctx, T_ISSUE); err != nil {
+		t.Fatal(err)
+	}
+
+	// as another instance of the application resolves it, without declaring it
+	loaded, err := repo.LoadTable(ctx, DATABASE, T_ISSUE.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(T_ISSUE.Definition(), loaded.Definition())
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := &Issue{Id: uuid.New().String(), Title: "first", CreatedBy: "john"}
+	if _, err := repo.InsertIntoTable(ctx, &tx, loaded, issue); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	issues := []*Issue{}
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &readTx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("Title", "first").Find(&issues)
+	assert.NoError(err)
+	assert.Len(issues, 1)
+
+	versions, err := repo.GetTableDefinitionVersions(ctx, T_ISSUE.SchemaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(versions, 2) {
+		assert.Equal("1.1.0", versions[0].Version)
+		assert.Equal(schema.DEFAULT_SCHEMA_VERSION, versions[1].Version)
+		assert.Equal([]string{"Title", "CreatedBy"}, versions[1].Indices)
+	}
+}
+
+func TestRegistry_ListTables_DescribesTheRecordsAndIndicesOfTheTables(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("catalog-tests-" + uuid.New().String())
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+	T_ISSUE := schema.NewTable(DATABASE, "issue", []string{"Title"}).WithSparseIndex("Body")
+	for _, table := range []schema.Table{T_ISSUE, T_ACCOUNT} {
+		if err := repo.RegisterTable(ctx, table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range []*Issue{
+		{Id: uuid.New().String(), Title: "first", Body: "with a body", CreatedBy: "john"},
+		{Id: uuid.New().String(), Title: "second", CreatedBy: "john"},
+	} {
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	tables, err := repo.ListTables(ctx, DATABASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(tables, 2) {
+		assert.Equal("account", tables[0].Name)
+		assert.Equal(0, tables[0].Records)
+		assert.Equal("issue", tables[1].Name)
+		assert.Equal(2, tables[1].Records)
+		assert.Greater(tables[1].Size, int64(0))
+		if assert.Len(tables[1].IndexDescriptions, 2) {
+			assert.Equal("Title", tables[1].IndexDescriptions[0].Field)
+			assert.Equal(2, tables[1].IndexDescriptions[0].Entries)
+			assert.Equal("Body", tables[1].IndexDescriptions[1].Field)
+			assert.True(tables[1].IndexDescriptions[1].Sparse)
+			assert.Equal(1, tables[1].IndexDescriptions[1].Entries)
+		}
+	}
+
+	description, err := repo.DescribeTable(ctx, T_ISSUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(tables[1], *description)
+
+	// tables which are not registered are described by their own definitions
+	T_UNREGISTERED := schema.NewTable(DATABASE, "unregistered", []string{"Name"})
+	description, err = repo.DescribeTable(ctx, T_UNREGISTERED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(T_UNREGISTERED.Definition(), description.TableDefinition)
+	assert.Equal(0, description.Records)
+}
+
+func TestRegistry_TruncateAndDropTable_RemoveEverythingOnceConfirmed(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("registry-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "issue-"+uuid.New().String(), []string{"Title"}).WithUniqueIndex("CreatedBy")
+	T_OTHER := schema.NewTable(DATABASE, "other-"+uuid.New().String(), []string{"Title"})
+	if err := repo.RegisterTable(ctx, T_ISSUE); err != nil {
+		t.Fatal(err)
+	}
+	insert := func(table schema.Table, issue *Issue) {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertIntoTable(ctx, &tx, table, issue); err != nil {
+			t.Fatal(err)
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+	}
+	countObjects := func(table schema.Table) int {
+		count := 0
+		for range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: string(table.Database) + "/" + table.Name + "/", Recursive: true}) {
+			count++
+		}
+		return count
+	}
+	insert(T_ISSUE, &Issue{Id: uuid.New().String(), Title: "first", CreatedBy: "john"})
+	insert(T_OTHER, &Issue{Id: uuid.New().String(), Title: "other", CreatedBy: "john"})
+	others := countObjects(T_OTHER)
+
+	token, err := repo.ConfirmationToken(ctx, T_ISSUE)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(token, string(DATABASE)+"/"+T_ISSUE.Name+"@"), token)
+
+	// the token of another table does not confirm it
+	otherToken, err := repo.ConfirmationToken(ctx, T_OTHER)
+	assert.NoError(err)
+	_, err = repo.TruncateTable(ctx, T_ISSUE, otherToken)
+	assert.True(errors.Is(err, min.InvalidConfirmationTokenError), err)
+
+	// nor once the table was written since
+	insert(T_ISSUE, &Issue{Id: uuid.New().String(), Title: "second", CreatedBy: "jane"})
+	_, err = repo.TruncateTable(ctx, T_ISSUE, token)
+	assert.True(errors.Is(err, min.StaleObjectError), err)
+
+	token, err = repo.ConfirmationToken(ctx, T_ISSUE)
+	assert.NoError(err)
+	removed, err := repo.TruncateTable(ctx, T_ISSUE, token)
+	assert.NoError(err)
+	assert.Greater(removed, 0)
+	assert.Equal(1, countObjects(T_ISSUE), "only the generation is kept")
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	issues := []*Issue{}
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &readTx).SelectFromTable(T_ISSUE).WhereIndexedFieldIsNotNull("Title").Find(&issues)
+	assert.NoError(err)
+	assert.Empty(issues)
+	_, err = repo.TruncateTable(ctx, T_ISSUE, token)
+	assert.True(errors.Is(err, min.StaleObjectError), "the token is used up")
+
+	// the claims were removed too, so the values can be written again
+	insert(T_ISSUE, &Issue{Id: uuid.New().String(), Title: "third", CreatedBy: "john"})
+
+	token, err = repo.ConfirmationToken(ctx, T_ISSUE)
+	assert.NoError(err)
+	_, err = repo.DropTable(ctx, T_ISSUE, token)
+	assert.NoError(err)
+	assert.Equal(0, countObjects(T_ISSUE))
+	_, err = repo.LoadTable(ctx, DATABASE, T_ISSUE.Name)
+	assert.True(errors.Is(err, min.NoSuchKeyError), err)
+
+	assert.Equal(others, countObjects(T_OTHER))
+}
+
+func TestRegistry_RenameTable_MovesTheRecordsAndTheirIndices(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("registry-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "issue-"+uuid.New().String(), []string{"Title"}).WithUniqueIndex("CreatedBy").WithPins()
+	if err := repo.RegisterTable(ctx, T_ISSUE); err != nil {
+		t.Fatal(err)
+	}
+	issue := &Issue{Id: uuid.New().String(), Title: "first", CreatedBy: "john"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	assert.NoError(repo.Pin(ctx, T_ISSUE, issue.Id, "the first one"))
+
+	token, err := repo.ConfirmationToken(ctx, T_ISSUE)
+	assert.NoError(err)
+	renamed, copied, err := repo.RenameTable(ctx, T_ISSUE, "renamed-"+uuid.New().String(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Greater(copied, 0)
+
+	// nothing is left of the old table
+	for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: string(DATABASE) + "/" + T_ISSUE.Name + "/", Recursive: true}) {
+		assert.Fail("not removed", object.Key)
+	}
+	_, err = repo.LoadTable(ctx, DATABASE, T_ISSUE.Name)
+	assert.True(errors.Is(err, min.NoSuchKeyError), err)
+	loaded, err := repo.LoadTable(ctx, DATABASE, renamed.Name)
+	assert.NoError(err)
+	assert.Equal(renamed.Definition(), loaded.Definition())
+
+	// the records are found by their indices, which name the renamed table
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	issues := []*Issue{}
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &readTx).SelectFromTable(renamed).WhereIndexedFieldEquals("Title", "first").Find(&issues)
+	assert.NoError(err)
+	if assert.Len(issues, 1) {
+		assert.Equal(issue.Id, issues[0].Id)
+	}
+	pin, err := repo.GetPin(ctx, renamed, issue.Id)
+	assert.NoError(err)
+	assert.Equal(renamed.Name, pin.Table)
+
+	// and are updated like those of any other table, which replaces their entries
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.OverridePins = true
+	found := &Issue{}
+	etag, err := min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(renamed).WhereIdEquals(issue.Id).Find(found)
+	assert.NoError(err)
+	found.Title = "second"
+	_, err = repo.UpdateTable(ctx, &tx, renamed, found, etag)
+	assert.NoError(err)
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	readTx = schema.NewReadOnlyTransaction(10 * time.Second)
+	issues = []*Issue{}
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &readTx).SelectFromTable(renamed).WhereIndexedFieldEquals("Title", "first").Find(&issues)
+	assert.NoError(err)
+	assert.Empty(issues)
+
+	// the claims were copied, so the values are still taken
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, renamed, &Issue{Id: uuid.New().String(), Title: "third", CreatedBy: "john"})
+	assert.ErrorIs(err, min.UniqueViolationError)
+	repo.Rollback(ctx, &tx)
+}
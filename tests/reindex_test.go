@@ -0,0 +1,519 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	m "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+)
+
+func TestReindex_DualWriteBackfillCutoverDrop(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("reindex-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+
+	// written before the new revision exists
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John DOE",
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// the new revision indexes the lower case name
+	T_ACCOUNT_DUAL := T_ACCOUNT.WithIndexRevision("Name", 1, func(entity any) (*string, error) {
+		lower := strings.ToLower(entity.(*Account).Name)
+		return &lower, nil
+	})
+
+	// written with dual-write
+	tx, err = repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account2 = &Account{
+		Id:   uuid.New().String(),
+		Name: "Jane DOE",
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT_DUAL, account2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	counts, err := repo.VerifyIndex(context.Background(), T_ACCOUNT_DUAL, "Name", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(min.IndexCounts{Records: 2, Entries: 1}, counts)
+
+	// cannot cut over before backfilling
+	err = repo.CutoverIndex(context.Background(), T_ACCOUNT_DUAL, "Name", 1)
+	assert.NotNil(err)
+
+	count, err := min.BackfillIndex[Account](context.Background(), repo, T_ACCOUNT_DUAL, "Name", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(2, count)
+
+	health, ok := repo.GetIndexHealth(T_ACCOUNT_DUAL, "Name", 1)
+	assert.True(ok)
+	assert.Equal(2, health.Applied)
+	assert.Equal(0, health.Pending)
+	assert.Equal(0, health.Errors)
+	assert.NotEmpty(health.LastAppliedId)
+
+	err = repo.CutoverIndex(context.Background(), T_ACCOUNT_DUAL, "Name", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// queries now use the new revision
+	tx = schema.NewReadOnlyTransaction(10*time.Second)
+	var accountsRead = []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, context.Background(), &tx).
+		SelectFromTable(T_ACCOUNT_DUAL).
+		WhereIndexedFieldEquals("Name", "john doe").
+		Find(&accountsRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, len(accountsRead))
+	assert.Equal(account1, accountsRead[0])
+
+	err = repo.DropIndexRevision(context.Background(), T_ACCOUNT_DUAL, "Name", 1)
+	assert.NotNil(err) // in use
+	err = repo.DropIndexRevision(context.Background(), T_ACCOUNT_DUAL, "Name", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the reverse indices of the records no longer refer to the dropped revision, but still to the one in use
+	dropped, _ := T_ACCOUNT_DUAL.GetIndexRevision("Name", 0)
+	used, _ := T_ACCOUNT_DUAL.GetIndexRevision("Name", 1)
+	for _, account := range []*Account{account1, account2} {
+		object, err := repo.Client.GetObject(context.Background(), repo.BucketName, T_ACCOUNT_DUAL.IndicesPath(account.Id), m.GetObjectOptions{})
+		assert.NoError(err)
+		b, err := io.ReadAll(object)
+		assert.NoError(err)
+		assert.NotContains(string(b), dropped.PathPrefix()+"/")
+		assert.Contains(string(b), used.PathPrefix()+"/")
+	}
+}
+
+func TestReindex_QueriesOfAnInconsistentIndexFollowThePolicy(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("reindex-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	// the same table, written by code which does not yet know about the index
+	T_ACCOUNT_UNINDEXED := schema.NewTable(DATABASE, T_ACCOUNT.Name, []string{})
+
+	for _, write := range []struct {
+		table schema.Table
+		name  string
+	}{{T_ACCOUNT, "alice"}, {T_ACCOUNT, "bob"}, {T_ACCOUNT_UNINDEXED, "carol"}} {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = repo.InsertIntoTable(ctx, &tx, write.table, &Account{Id: uuid.New().String(), Name: write.name})
+		assert.NoError(err)
+		assert.Empty(repo.Commit(ctx, &tx))
+	}
+
+	counts, err := repo.VerifyIndex(ctx, T_ACCOUNT, "Name", 0)
+	assert.NoError(err)
+	assert.Equal(min.IndexCounts{Records: 3, Entries: 2}, counts)
+	health, ok := repo.GetIndexHealth(T_ACCOUNT, "Name", 0)
+	assert.True(ok)
+	assert.True(health.Inconsistent)
+	assert.False(health.Available())
+
+	find := func(policy min.IndexUnavailablePolicy) ([]*Account, error) {
+		tx := schema.NewReadOnlyTransaction(10 * time.Second)
+		accounts := []*Account{}
+		query := min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT)
+		if policy != (min.IndexUnavailablePolicy{}) {
+			query = query.WhenIndexUnavailable(policy)
+		}
+		_, err := query.WhereIndexedFieldEquals("Name", "carol").Find(&accounts)
+		return accounts, err
+	}
+
+	// fails fast by default
+	_, err = find(min.IndexUnavailablePolicy{})
+	assert.ErrorIs(err, min.IndexUnavailableError)
+
+	// the index has no entry for carol
+	accounts, err := find(min.PartialResultsWhenIndexUnavailable)
+	var unavailable *min.IndexUnavailableErrorWithDetails
+	if assert.ErrorAs(err, &unavailable) {
+		assert.True(unavailable.Partial)
+		assert.True(unavailable.Health.Inconsistent)
+	}
+	assert.Empty(accounts)
+
+	accounts, err = find(min.ScanWhenIndexUnavailable(10))
+	assert.NoError(err)
+	if assert.Len(accounts, 1) {
+		assert.Equal("carol", accounts[0].Name)
+	}
+	_, err = find(min.ScanWhenIndexUnavailable(2))
+	assert.ErrorIs(err, min.IndexUnavailableError)
+
+	// the global policy applies to queries which do not set their own
+	repo.SetIndexUnavailablePolicy(min.ScanWhenIndexUnavailable(10))
+	accounts, err = find(min.IndexUnavailablePolicy{})
+	repo.SetIndexUnavailablePolicy(min.FailWhenIndexUnavailable)
+	assert.NoError(err)
+	assert.Len(accounts, 1)
+
+	// once repaired, the index is used again
+	_, err = min.BackfillIndex[Account](ctx, repo, T_ACCOUNT, "Name", 0)
+	assert.NoError(err)
+	accounts, err = find(min.IndexUnavailablePolicy{})
+	assert.NoError(err)
+	assert.Len(accounts, 1)
+}
+
+func TestReindex_CreateIndexBackfillsInResumableBatches(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Customer struct {
+		Id    string `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("reindex-tests")
+	T_CUSTOMER := schema.NewTable(DATABASE, "customer-"+uuid.New().String(), []string{"Name"})
+
+	// written before the index exists
+	for i := 0; i < 5; i++ {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		customer := &Customer{Id: uuid.New().String(), Name: fmt.Sprintf("customer %d", i), Email: fmt.Sprintf("c%d@example.com", i)}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_CUSTOMER, customer); err != nil {
+			t.Fatal(err)
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+	}
+
+	// cancelled after the first batch
+	cancellable, cancel := context.WithCancel(ctx)
+	reports := []min.IndexBackfillProgress{}
+	_, err := min.CreateIndex[Customer](cancellable, repo, T_CUSTOMER, "Email", min.CreateIndexOptions{
+		BatchSize: 2,
+		Progress: func(progress min.IndexBackfillProgress) {
+			reports = append(reports, progress)
+			cancel()
+		},
+	})
+	assert.ErrorIs(err, context.Canceled)
+	if assert.Len(reports, 1) {
+		assert.Equal(2, reports[0].Indexed)
+		assert.Equal(3, reports[0].Pending)
+	}
+
+	// continues from the checkpoint
+	reports = []min.IndexBackfillProgress{}
+	T_CUSTOMER, err = min.CreateIndex[Customer](ctx, repo, T_CUSTOMER, "Email", min.CreateIndexOptions{
+		BatchSize: 2,
+		Progress: func(progress min.IndexBackfillProgress) {
+			reports = append(reports, progress)
+		},
+	})
+	assert.NoError(err)
+	if assert.Len(reports, 3) {
+		assert.Equal(min.IndexBackfillProgress{Field: "Email", LastId: reports[1].LastId, Batches: 3, Indexed: 5, Retry: []string{}, Done: true}, reports[2])
+	}
+
+	counts, err := repo.VerifyIndex(ctx, T_CUSTOMER, "Email", 0)
+	assert.NoError(err)
+	assert.Equal(min.IndexCounts{Records: 5, Entries: 5}, counts)
+
+	tx := schema.NewReadOnlyTransaction(10 * time.Second)
+	customers := []*Customer{}
+	_, err = min.NewTypedQuery[Customer](repo, ctx, &tx).SelectFromTable(T_CUSTOMER).WhereIndexedFieldEquals("Email", "c3@example.com").Find(&customers)
+	assert.NoError(err)
+	if assert.Len(customers, 1) {
+		assert.Equal("customer 3", customers[0].Name)
+	}
+
+	definition, err := repo.GetTableDefinition(ctx, T_CUSTOMER.SchemaPath())
+	assert.NoError(err)
+	assert.Equal([]string{"Name", "Email"}, definition.Indices)
+}
+
+func TestReindex_DropIndexRemovesEntriesAndReverseIndices(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Customer struct {
+		Id    string `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("reindex-tests")
+	T_CUSTOMER := schema.NewTable(DATABASE, "customer-"+uuid.New().String(), []string{"Name"}).WithUniqueIndex("Email")
+
+	insert := func(table schema.Table, customer *Customer) error {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertIntoTable(ctx, &tx, table, customer); err != nil {
+			repo.Rollback(ctx, &tx)
+			return err
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		customer := &Customer{Id: uuid.New().String(), Name: fmt.Sprintf("customer %d", i), Email: fmt.Sprintf("c%d@example.com", i)}
+		assert.NoError(insert(T_CUSTOMER, customer))
+		ids = append(ids, customer.Id)
+	}
+
+	dropped, report, err := repo.DropIndex(ctx, T_CUSTOMER, "Email")
+	assert.NoError(err)
+	assert.Equal(3, report.Records)
+	assert.GreaterOrEqual(report.Entries, 6) // an entry and a claim per record
+	_, err = dropped.GetIndex("Email")
+	assert.Error(err)
+
+	index, _ := T_CUSTOMER.GetIndex("Email")
+	for _, prefix := range []string{index.PathPrefix() + "/", index.UniquePathPrefix() + "/"} {
+		for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			assert.Fail("not removed", object.Key)
+		}
+	}
+	for _, id := range ids {
+		object, err := repo.Client.GetObject(ctx, repo.BucketName, dropped.IndicesPath(id), m.GetObjectOptions{})
+		assert.NoError(err)
+		b, err := io.ReadAll(object)
+		assert.NoError(err)
+		assert.NotContains(string(b), "/Email/")
+		assert.Contains(string(b), "/Name/")
+	}
+
+	// the values are no longer unique
+	assert.NoError(insert(dropped, &Customer{Id: uuid.New().String(), Name: "duplicate", Email: "c0@example.com"}))
+
+	definition, err := repo.GetTableDefinition(ctx, dropped.SchemaPath())
+	assert.NoError(err)
+	assert.Equal([]string{"Name"}, definition.Indices)
+}
+
+func TestReindex_RebuildIndexAddsMissingAndRemovesOrphanedEntries(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("reindex-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	index, _ := T_ACCOUNT.GetIndex("Name")
+
+	accounts := []*Account{}
+	for i := 0; i < 3; i++ {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := &Account{Id: uuid.New().String(), Name: fmt.Sprintf("account %d", i)}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account); err != nil {
+			t.Fatal(err)
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		accounts = append(accounts, account)
+	}
+
+	// e.g. edited manually
+	assert.NoError(repo.Client.RemoveObject(ctx, repo.BucketName, index.Path(accounts[0].Name, accounts[0].Id), m.RemoveObjectOptions{}))
+	orphan := index.Path("ghost", uuid.New().String())
+	_, err := repo.Client.PutObject(ctx, repo.BucketName, orphan, strings.NewReader(""), 0, m.PutObjectOptions{UserMetadata: map[string]string{schema.LAST_MODIFIED: "0"}})
+	assert.NoError(err)
+
+	rebuild, err := min.RebuildIndex[Account](ctx, repo, T_ACCOUNT, "Name")
+	assert.NoError(err)
+	assert.Equal(min.IndexRebuild{Records: 3, Added: 1, Removed: 1}, rebuild)
+
+	counts, err := repo.VerifyIndex(ctx, T_ACCOUNT, "Name", 0)
+	assert.NoError(err)
+	assert.Equal(min.IndexCounts{Records: 3, Entries: 3}, counts)
+
+	// nothing to do the second time
+	rebuild, err = min.RebuildIndex[Account](ctx, repo, T_ACCOUNT, "Name")
+	assert.NoError(err)
+	assert.Equal(min.IndexRebuild{Records: 3}, rebuild)
+}
+
+func TestReindex_VerifyTableReportsInconsistentIndexEntries(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("reindex-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	index, _ := T_ACCOUNT.GetIndex("Name")
+
+	accounts := []*Account{}
+	for i := 0; i < 3; i++ {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := &Account{Id: uuid.New().String(), Name: fmt.Sprintf("account %d", i)}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account); err != nil {
+			t.Fatal(err)
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		accounts = append(accounts, account)
+	}
+
+	verification, err := min.VerifyTable[Account](ctx, repo, T_ACCOUNT)
+	assert.NoError(err)
+	assert.True(verification.Ok(), verification.Issues)
+	assert.Equal(3, verification.Records)
+	assert.Equal(3, verification.Entries)
+
+	// e.g. edited manually
+	missing := index.Path(accounts[0].Name, accounts[0].Id)
+	assert.NoError(repo.Client.RemoveObject(ctx, repo.BucketName, missing, m.RemoveObjectOptions{}))
+	ghost := uuid.New().String()
+	dangling := index.Path("ghost", ghost)
+	mismatched := index.PathNoId("other") + "/" + string(DATABASE) + "___other-table___" + accounts[1].Id
+	for _, path := range []string{dangling, mismatched} {
+		_, err := repo.Client.PutObject(ctx, repo.BucketName, path, strings.NewReader(""), 0, m.PutObjectOptions{UserMetadata: map[string]string{schema.LAST_MODIFIED: "0"}})
+		assert.NoError(err)
+	}
+
+	verification, err = min.VerifyTable[Account](ctx, repo, T_ACCOUNT)
+	assert.NoError(err)
+	assert.False(verification.Ok())
+	assert.ElementsMatch([]min.IndexIssue{
+		{Kind: min.INDEX_ISSUE_MISSING_ENTRY, Field: "Name", Path: missing, Id: accounts[0].Id},
+		{Kind: min.INDEX_ISSUE_DANGLING_ENTRY, Field: "Name", Path: dangling, Id: ghost},
+		{Kind: min.INDEX_ISSUE_MISMATCHED_TUPLE, Field: "Name", Path: mismatched},
+	}, verification.Issues)
+
+	// the reverse indices of the record no longer refer to the entry that the record requires
+	_, err = repo.Client.PutObject(ctx, repo.BucketName, T_ACCOUNT.IndicesPath(accounts[2].Id), strings.NewReader(`"`+dangling+`"`), int64(len(dangling)+2), m.PutObjectOptions{UserMetadata: map[string]string{schema.LAST_MODIFIED: "0"}})
+	assert.NoError(err)
+	verification, err = min.VerifyTable[Account](ctx, repo, T_ACCOUNT)
+	assert.NoError(err)
+	assert.Contains(verification.Issues, min.IndexIssue{Kind: min.INDEX_ISSUE_UNREFERENCED_ENTRY, Field: "Name", Path: index.Path(accounts[2].Name, accounts[2].Id), Id: accounts[2].Id})
+	assert.Contains(verification.Issues, min.IndexIssue{Kind: min.INDEX_ISSUE_STALE_REFERENCE, Field: "Name", Path: dangling, Id: accounts[2].Id})
+}
+
+func TestReindex_MigrateToEscapedPathsMovesTheEntriesOfExistingRecords(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("reindex-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	assert.NoError(repo.RegisterTable(ctx, T_ACCOUNT))
+
+	// written before the table escaped its paths
+	names := []string{"john.doe@example.com", "_admin", "plain"}
+	for _, name := range names {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+	}
+
+	escaped := T_ACCOUNT.WithEscapedPaths()
+	_, err := min.MigrateToEscapedPaths[Account](ctx, repo, T_ACCOUNT)
+	assert.ErrorContains(err, "ADB-0228")
+
+	rebuilds, err := min.MigrateToEscapedPaths[Account](ctx, repo, escaped)
+	assert.NoError(err)
+	assert.Equal([]min.IndexRebuild{{Records: 3, Added: 2, Removed: 2}}, rebuilds)
+
+	// nodes declaring the table without escaped paths refuse to use it
+	err = repo.CheckCompatibility(ctx, []schema.Table{T_ACCOUNT})
+	assert.True(errors.Is(err, min.SchemaIncompatibleError), err)
+	assert.NoError(repo.CheckCompatibility(ctx, []schema.Table{escaped}))
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	for _, name := range names {
+		accounts := []*Account{}
+		_, err := min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(escaped).WhereIndexedFieldEquals("Name", name).Find(&accounts)
+		assert.NoError(err)
+		assert.Len(accounts, 1, name)
+	}
+	accounts := []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(escaped).WhereIndexedFieldInStringRange("Name", "_", "k").Find(&accounts)
+	assert.NoError(err)
+	assert.Len(accounts, 2)
+	assert.Equal("_admin", accounts[0].Name)
+
+	verification, err := min.VerifyTable[Account](ctx, repo, escaped)
+	assert.NoError(err)
+	assert.True(verification.Ok(), verification.Issues)
+
+	// nothing to do the second time
+	rebuilds, err = min.MigrateToEscapedPaths[Account](ctx, repo, escaped)
+	assert.NoError(err)
+	assert.Equal([]min.IndexRebuild{{Records: 3}}, rebuilds)
+}
@@ -0,0 +1,93 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/shell"
+)
+
+func TestShell_InsertSelectUpdateAndDeleteAsTheyAreTyped(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("shell-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"name"})
+	assert.NoError(repo.RegisterTable(ctx, T_ACCOUNT))
+
+	out := &bytes.Buffer{}
+	sh := shell.NewShell(repo, out, 10*time.Second)
+	assert.NoError(sh.Refresh(ctx))
+	assert.NotContains(sh.Complete("SELECT * FROM "+T_ACCOUNT.Name[:10]), T_ACCOUNT.Name, "only qualified without a database in use")
+	assert.NoError(sh.Execute(ctx, "USE shell-tests"))
+	assert.Contains(sh.Complete("SELECT * FROM "+T_ACCOUNT.Name[:10]), T_ACCOUNT.Name)
+
+	id := uuid.New().String()
+	script := strings.Join([]string{
+		`INSERT INTO ` + T_ACCOUNT.Name + ` {"id": "` + id + `", "name": "John"}`,
+		`SELECT * FROM ` + T_ACCOUNT.Name + ` WHERE name = 'John'`,
+		`BEGIN`,
+		`UPDATE ` + T_ACCOUNT.Name + ` SET {"id": "` + id + `", "name": "Jane"}`,
+		`COMMIT`,
+		`SELECT * FROM ` + T_ACCOUNT.Name + ` WHERE id = '` + id + `'`,
+		`DELETE FROM ` + T_ACCOUNT.Name + ` WHERE id = '` + id + `'`,
+		`SELECT * FROM ` + T_ACCOUNT.Name + ` WHERE name IS NOT NULL`,
+	}, "\n")
+	assert.NoError(sh.Run(ctx, strings.NewReader(script)))
+
+	output := out.String()
+	assert.Contains(output, "INSERT "+id)
+	assert.Contains(output, id+" | John")
+	assert.Contains(output, "UPDATE "+id)
+	assert.Contains(output, id+" | Jane")
+	assert.Contains(output, "DELETE "+id)
+	assert.True(strings.HasSuffix(output, "(0 rows)\n"), output)
+
+	// as a script reads it
+	out.Reset()
+	assert.NoError(sh.SetOutput(shell.OUTPUT_NDJSON))
+	err := sh.Run(ctx, strings.NewReader(strings.Join([]string{
+		`INSERT INTO ` + T_ACCOUNT.Name + ` {"id": "` + id + `", "name": "John"}`,
+		`SELECT * FROM ` + T_ACCOUNT.Name + ` WHERE name = 'John'`,
+		`INSERT INTO ` + T_ACCOUNT.Name + ` {"id": "` + id + `", "name": "Jane"}`,
+		`SELECT * FROM ` + T_ACCOUNT.Name,
+	}, "\n")))
+	if assert.Error(err) {
+		assert.True(strings.HasPrefix(err.Error(), "line 3: "), err)
+	}
+	assert.Equal(`{"id":"`+id+`"}`+"\n"+`{"id":"`+id+`","name":"John"}`+"\n", out.String())
+}
+
+func TestShell_AWriteWhichFailsWithinATransactionRollsItBack(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("shell-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"name"})
+	assert.NoError(repo.RegisterTable(ctx, T_ACCOUNT))
+
+	out := &bytes.Buffer{}
+	sh := shell.NewShell(repo, out, 10*time.Second)
+	assert.NoError(sh.Execute(ctx, "USE shell-tests"))
+	id, other := uuid.New().String(), uuid.New().String()
+	assert.NoError(sh.Execute(ctx, `INSERT INTO `+T_ACCOUNT.Name+` {"id": "`+id+`", "name": "John"}`))
+
+	assert.NoError(sh.Execute(ctx, "BEGIN"))
+	assert.NoError(sh.Execute(ctx, `INSERT INTO `+T_ACCOUNT.Name+` {"id": "`+other+`", "name": "Jane"}`))
+	err := sh.Execute(ctx, `INSERT INTO `+T_ACCOUNT.Name+` {"id": "`+id+`", "name": "John"}`)
+	assert.ErrorContains(err, "ADB-0250")
+	assert.ErrorContains(sh.Execute(ctx, "COMMIT"), "no transaction is in progress")
+
+	out.Reset()
+	assert.NoError(sh.Execute(ctx, `SELECT * FROM `+T_ACCOUNT.Name+` WHERE id = '`+other+`'`))
+	assert.Contains(out.String(), "(0 rows)")
+}
@@ -1,13 +1,22 @@
 package minio
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,6 +26,7 @@ import (
 
 	min "github.com/abstratium-informatique-sarl/abstrastore/pkg/minio"
 	"github.com/abstratium-informatique-sarl/abstrastore/pkg/schema"
+	"github.com/abstratium-informatique-sarl/abstrastore/pkg/web"
 )
 
 func setupTest(tb *testing.T) func(tb *testing.T) {
@@ -4034,6 +4044,4089 @@ func TestRangeScans_BadRegex(t *testing.T) {
 	t.Fatal("expected panic")
 }
 
+func TestTransactions_T1BeginInsertCommit_T2Read_T3UpdateCommit_T2ValidateDetectsStaleObject(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	tx1, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx1.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx1, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx1)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// T2 reads the account, and nothing has changed yet
+	tx2, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accountRead = &Account{}
+	etag, err := min.NewTypedQuery[Account](repo, context.Background(), &tx2).
+		SelectFromTable(T_ACCOUNT).
+		WhereIdEquals(account1.Id).
+		Find(accountRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = repo.Validate(context.Background(), &tx2)
+	assert.Equal(0, len(errs))
+
+	// T3 updates and commits
+	tx3, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountRead.Name = "Jane Doe " + tx3.Id
+	_, err = repo.UpdateTable(context.Background(), &tx3, T_ACCOUNT, accountRead, etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = repo.Commit(context.Background(), &tx3)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// T2 can detect that what it read is stale, without writing anything
+	errs = repo.Validate(context.Background(), &tx2)
+	assert.Equal(1, len(errs))
+	assert.True(errors.Is(errs[0], min.StaleObjectError))
+	assert.Equal(0, len(tx2.Steps))
+
+	errs = repo.Rollback(context.Background(), &tx2)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestTransactions_InsertWithNullIndexedField_SelectIsNullAndIsNotNull(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-nulls-"+tx.Id, []string{"Name"})
+
+	var accountWithoutName = &Account{
+		Id:   uuid.New().String(),
+		Name: "",
+	}
+	var accountWithName = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx.Id,
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, accountWithoutName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, accountWithName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	tx = schema.NewTransaction(10*time.Second)
+	var accountsRead = []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, context.Background(), &tx).
+		SelectFromTable(T_ACCOUNT).
+		WhereIndexedFieldIsNull("Name").
+		Find(&accountsRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, len(accountsRead))
+	assert.Equal(accountWithoutName, accountsRead[0])
+
+	accountsRead = []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, context.Background(), &tx).
+		SelectFromTable(T_ACCOUNT).
+		WhereIndexedFieldIsNotNull("Name").
+		Find(&accountsRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, len(accountsRead))
+	assert.Equal(accountWithName, accountsRead[0])
+}
+
+func TestTransactions_T1BeginInsertCommit_T2BeginInsert_DuplicateKeyError_AbortReasonIsRecorded(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	tx1, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx1.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx1, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx1)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Empty(tx1.AbortReason)
+	assert.Nil(tx1.FailedStepIndex)
+
+	tx2, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx2, T_ACCOUNT, account1)
+	assert.True(errors.Is(err, min.DuplicateKeyError))
+
+	// the caller may recover from the failure and commit, so it is only recorded once the transaction is rolled back
+	assert.Empty(tx2.AbortReason)
+	assert.Nil(tx2.FailedStepIndex)
+
+	errs = repo.Rollback(context.Background(), &tx2)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// the data step is the first one, and it failed, which rolling back does not overwrite
+	assert.Equal(err.Error(), tx2.AbortReason)
+	assert.NotNil(tx2.FailedStepIndex)
+	assert.Equal(0, *tx2.FailedStepIndex)
+
+	tx3, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = repo.Rollback(context.Background(), &tx3)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(schema.TransactionRolledBackByCallerError.Error(), tx3.AbortReason)
+	assert.Nil(tx3.FailedStepIndex)
+}
+
+func TestTransactions_InsertWithComputedIndex_SelectByComputedValue(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"}).
+		WithComputedIndex("NameLower", func(entity any) (*string, error) {
+			lower := strings.ToLower(entity.(*Account).Name)
+			return &lower, nil
+		})
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John DOE " + tx.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	tx = schema.NewTransaction(10*time.Second)
+	var accountsRead = []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, context.Background(), &tx).
+		SelectFromTable(T_ACCOUNT).
+		WhereIndexedFieldEquals("NameLower", strings.ToLower(account1.Name)).
+		Find(&accountsRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, len(accountsRead))
+	assert.Equal(account1, accountsRead[0])
+}
+
+func TestTransactions_ReadOnlyTransactionCanReadButNotWrite(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	tx1, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx1.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx1, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx1)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	tx2, err := repo.BeginReadOnlyTransaction(10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing was persisted
+	var transactions = []schema.Transaction{}
+	err = repo.GetTransactionsInProgress(context.Background(), &transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(slices.ContainsFunc(transactions, func(tx schema.Transaction) bool { return tx.Id == tx2.Id }))
+
+	var accountRead = &Account{}
+	_, err = min.NewTypedQuery[Account](repo, context.Background(), &tx2).
+		SelectFromTable(T_ACCOUNT).
+		WhereIdEquals(account1.Id).
+		Find(accountRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(account1, accountRead)
+
+	account2 := &Account{
+		Id:   uuid.New().String(),
+		Name: "Jane Doe " + tx2.Id,
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx2, T_ACCOUNT, account2)
+	assert.Equal(schema.TransactionIsReadOnlyError, err)
+}
+
+func TestTransactions_QueryCache_IsInvalidatedByCommit(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableQueryCache(10)
+	defer repo.DisableQueryCache()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-cached-"+tx.Id, []string{"Name"})
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe",
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// the generation is only precise to the second, so start after it
+	time.Sleep(1500 * time.Millisecond)
+
+	selectJohn := func() []*Account {
+		tx := schema.NewReadOnlyTransaction(10*time.Second)
+		var accountsRead = []*Account{}
+		_, err := min.NewTypedQuery[Account](repo, context.Background(), &tx).
+			SelectFromTable(T_ACCOUNT).
+			WhereIndexedFieldMatches("Name", "^john").
+			Find(&accountsRead)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return accountsRead
+	}
+	assert.Equal(1, len(selectJohn()))
+	assert.Equal(1, len(selectJohn())) // from the cache
+
+	tx, err = repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account2 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Smith",
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	time.Sleep(1500 * time.Millisecond)
+
+	// the commit changed the generation, so the cached results are no longer used
+	assert.Equal(2, len(selectJohn()))
+}
+
+func TestTransactions_BeginInsertCommit_TransactionIsArchived(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableTransactionArchive(time.Minute)
+	defer repo.DisableTransactionArchive()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// the archive is not mistaken for a transaction in progress
+	var transactions = []schema.Transaction{}
+	err = repo.GetTransactionsInProgress(context.Background(), &transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(slices.ContainsFunc(transactions, func(t schema.Transaction) bool { return t.Id == tx.Id }))
+
+	transactions = []schema.Transaction{}
+	err = repo.GetArchivedTransactions(context.Background(), &transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := slices.IndexFunc(transactions, func(t schema.Transaction) bool { return t.Id == tx.Id })
+	assert.True(idx >= 0)
+	archived := transactions[idx]
+	assert.Equal(len(tx.Steps), len(archived.Steps))
+	assert.Equal(T_ACCOUNT.Path(account1.Id), archived.Steps[0].Path)
+	assert.Equal(tx.Steps[0].FinalETag, archived.Steps[0].FinalETag)
+	assert.Equal(tx.Steps[0].FinalVersionId, archived.Steps[0].FinalVersionId)
+}
+
+func TestTransactions_TransactionsOfTenantsAreArchived(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	repo.EnableTransactionArchive(time.Minute)
+	defer repo.DisableTransactionArchive()
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	acme := schema.NewTenant("acme-" + uuid.New().String())
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"}).WithTenant(acme)
+	tx, err := repo.BeginTransactionForTenant(ctx, acme, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: "John"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	isTx := func(archived schema.Transaction) bool { return archived.Id == tx.Id }
+	var transactions []schema.Transaction
+	assert.NoError(repo.GetArchivedTransactions(ctx, &transactions))
+	assert.True(slices.ContainsFunc(transactions, isTx))
+	transactions = nil
+	assert.NoError(repo.GetArchivedTransactionsOfTenant(ctx, acme, &transactions))
+	assert.True(slices.ContainsFunc(transactions, isTx))
+	transactions = nil
+	assert.NoError(repo.GetArchivedTransactionsOfTenant(ctx, schema.DEFAULT_TENANT, &transactions))
+	assert.False(slices.ContainsFunc(transactions, isTx))
+}
+
+func TestTransactions_WatchTransaction_EmitsCommitted(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := repo.WatchTransaction(ctx, tx.Id, 50*time.Millisecond)
+
+	event := <-events
+	assert.Nil(event.Err)
+	assert.Equal("InProgress", event.State)
+	assert.Equal(tx.Id, event.Transaction.Id)
+
+	// another worker commits
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	states := []string{}
+	for event := range events {
+		assert.Nil(event.Err)
+		states = append(states, event.State)
+	}
+	// depending on timing, the committing state may not be seen, and without the archive the final state may be unknown
+	final := states[len(states)-1]
+	assert.True(final == min.TX_STATE_COMMITTED || final == min.TX_STATE_COMPLETED)
+}
+
+func TestTransactions_Participants_FailingPrepareRollsBackEverything(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := &TestParticipant{}
+	bad := &TestParticipant{PrepareError: fmt.Errorf("broker unavailable")}
+	assert.Nil(tx.Enlist(good))
+	assert.Nil(tx.Enlist(bad))
+
+	errs := repo.Commit(context.Background(), &tx)
+	assert.Equal(1, len(errs))
+	assert.Equal([]string{"Prepare", "Rollback"}, good.Calls)
+	assert.Equal([]string{"Prepare", "Rollback"}, bad.Calls)
+
+	// the insert was rolled back too
+	var accountRead = &Account{}
+	tx = schema.NewTransaction(10*time.Second)
+	_, err = min.NewTypedQuery[Account](repo, context.Background(), &tx).
+		SelectFromTable(T_ACCOUNT).
+		WhereIdEquals(account1.Id).
+		Find(accountRead)
+	assert.True(errors.Is(err, min.NoSuchKeyError))
+}
+
+func TestTransactions_Participants_AreCommitted(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participant := &TestParticipant{}
+	assert.Nil(tx.Enlist(participant))
+
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal([]string{"Prepare", "Commit"}, participant.Calls)
+}
+
+type TestParticipant struct {
+	PrepareError error
+	Calls []string
+}
+
+func (p *TestParticipant) Prepare(ctx context.Context, tx *schema.Transaction) error {
+	p.Calls = append(p.Calls, "Prepare")
+	return p.PrepareError
+}
+
+func (p *TestParticipant) Commit(ctx context.Context, tx *schema.Transaction) error {
+	p.Calls = append(p.Calls, "Commit")
+	return nil
+}
+
+func (p *TestParticipant) Rollback(ctx context.Context, tx *schema.Transaction) error {
+	p.Calls = append(p.Calls, "Rollback")
+	return nil
+}
+
+func TestTransactions_SingleWriterTable_RequiresLease(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-leased-"+tx.Id, []string{"Name"}).WithSingleWriterLease()
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx.Id, // helps with concurrent tests
+	}
+
+	// no lease
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	assert.True(errors.Is(err, min.LeaseNotHeldError))
+
+	lease, err := repo.AcquireTableLease(context.Background(), T_ACCOUNT, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(lease.IsExpired())
+
+	// renewing works, and keeps the owner
+	renewed, err := repo.AcquireTableLease(context.Background(), T_ACCOUNT, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(lease.Owner, renewed.Owner)
+
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	err = repo.ReleaseTableLease(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err = repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anyETag := ""
+	err = repo.DeleteFromTable(context.Background(), &tx, T_ACCOUNT, account1, &anyETag)
+	assert.True(errors.Is(err, min.LeaseNotHeldError))
+	errs = repo.Rollback(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestTransactions_UserMetadataIsStoredWithEachVersion(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(tx.SetUserMetadata("actorId", "1")) // not canonical
+	assert.NotNil(tx.SetUserMetadata(schema.TX_ID, "1")) // reserved
+	assert.Nil(tx.SetUserMetadata("Actor-Id", "actor-1"))
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := repo.Commit(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	info, err := repo.Client.StatObject(context.Background(), repo.BucketName, T_ACCOUNT.Path(account1.Id), m.StatObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("actor-1", info.UserMetadata["Actor-Id"])
+	assert.Equal(tx.Id, info.UserMetadata[schema.TX_ID])
+}
+
+func TestTransactions_CommitWithResult_ReportsTheOutcome(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := repo.CommitWithResult(ctx, &tx)
+	assert.Empty(result.Errors)
+	assert.True(result.Committed)
+	assert.False(result.RolledBack)
+	assert.Equal(-1, result.FailedStepIndex)
+
+	// an update replaces the index entry, whose tombstone is written during the commit
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.Name = "Jane"
+	_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, account, etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = repo.CommitWithResult(ctx, &tx)
+	assert.Empty(result.Errors)
+	assert.True(result.Committed)
+
+	// committing again is not possible, and changes nothing
+	result = repo.CommitWithResult(ctx, &tx)
+	assert.ErrorIs(result.Errors[0], schema.TransactionAlreadyCommittedError)
+	assert.False(result.Committed)
+	assert.False(result.RolledBack)
+}
+
+func TestTransactions_ResumeFromToken_ContinuesTheSameTransaction(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	schema.SetTransactionTokenKey([]byte("secret"))
+	defer schema.SetTransactionTokenKey(nil)
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	// the frontend starts the transaction and hands it off
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := tx.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the backend continues it, and sees its changes
+	resumed, err := repo.ResumeFromToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(tx.Id, resumed.Id)
+	found := &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, resumed).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("John", found.Name)
+
+	other := &Account{Id: uuid.New().String(), Name: "Jane"}
+	_, err = repo.InsertIntoTable(ctx, resumed, T_ACCOUNT, other)
+	assert.NoError(err)
+
+	// the token is no longer valid, since the transaction has changed
+	_, err = repo.ResumeFromToken(ctx, token)
+	assert.ErrorIs(err, min.StaleObjectError)
+	_, err = repo.ResumeFromToken(ctx, token[:len(token)-2]+"xx")
+	assert.ErrorIs(err, schema.InvalidTransactionTokenError)
+
+	assert.Empty(repo.Commit(ctx, resumed))
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIdEquals(other.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("Jane", found.Name)
+}
+
+func TestTransactions_GetMany_ReadsFromOneSnapshotAndTheCache(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	john := &Account{Id: uuid.New().String(), Name: "John"}
+	jane := &Account{Id: uuid.New().String(), Name: "Jane"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, john)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Rollback(ctx, &tx)
+	// written within the transaction, so it comes from the cache
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, jane)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := T_ACCOUNT.Path(uuid.New().String())
+	results, err := min.GetMany[Account](ctx, repo, &tx, T_ACCOUNT.Path(john.Id), T_ACCOUNT.Path(jane.Id), missing, T_ACCOUNT.Path(john.Id))
+	assert.NoError(err)
+	assert.Equal(4, len(results))
+	assert.Equal("John", results[0].Object.Name)
+	assert.NotNil(results[0].ETag)
+	assert.Equal("Jane", results[1].Object.Name)
+	assert.Equal(missing, results[2].Path)
+	assert.Nil(results[2].Object)
+	assert.Equal("John", results[3].Object.Name)
+
+	// now cached, so reading it again is repeatable
+	_, cached, _ := tx.GetCached(ctx, T_ACCOUNT.Path(john.Id))
+	assert.True(cached)
+
+	// as is the object which does not exist, so that looking it up again costs no requests
+	object, cached, _ := tx.GetCached(ctx, missing)
+	assert.True(cached)
+	assert.Nil(object)
+	results, err = min.GetMany[Account](ctx, repo, &tx, missing)
+	assert.NoError(err)
+	assert.Nil(results[0].Object)
+}
+
+func TestTransactions_Preempt_RollsBackALowerPriorityTransactionThatBlocks(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	low, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &low, T_ACCOUNT, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	high, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	high.Priority = 10
+	_, err = repo.InsertIntoTable(ctx, &high, T_ACCOUNT, account)
+	assert.ErrorIs(err, min.ObjectLockedError)
+	repo.Rollback(ctx, &high)
+
+	// still within the grace period
+	assert.Empty(repo.Preempt(ctx, time.Hour))
+	assert.Empty(repo.Preempt(ctx, 0))
+
+	// the low priority transaction was rolled back, so it can no longer commit
+	assert.NotEmpty(repo.Commit(ctx, &low))
+
+	high, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	high.Priority = 10
+	_, err = repo.InsertIntoTable(ctx, &high, T_ACCOUNT, account)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &high))
+}
+
+func TestTransactions_WriteIntents_IdentifyUncommittedVersions(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	repo.EnableWriteIntents()
+	defer repo.DisableWriteIntents()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	tx1, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intents, err := repo.GetWriteIntents(ctx, T_ACCOUNT.Path(account.Id))
+	assert.NoError(err)
+	assert.Equal(1, len(intents))
+	assert.Equal(tx1.Id, intents[0].TransactionId)
+	assert.Equal(min.INTENT_LIVE, intents[0].State)
+
+	// not visible to others until committed
+	time.Sleep(10 * time.Millisecond)
+	tx2 := schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx2).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(&Account{})
+	assert.ErrorIs(err, min.NoSuchKeyError)
+
+	assert.Empty(repo.Commit(ctx, &tx1))
+	intents, err = repo.GetWriteIntents(ctx, T_ACCOUNT.Path(account.Id))
+	assert.NoError(err)
+	assert.Empty(intents)
+
+	tx3 := schema.NewReadOnlyTransaction(10 * time.Second)
+	found := &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx3).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("John", found.Name)
+}
+
+func TestTransactions_CacheSpilledToBucket_KeepsReadsRepeatable(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	john := &Account{Id: uuid.New().String(), Name: "John"}
+	jane := &Account{Id: uuid.New().String(), Name: "Jane"}
+	tx1, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, john)
+	assert.NoError(err)
+	_, err = repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, jane)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx1))
+
+	time.Sleep(10 * time.Millisecond)
+	tx2, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.SpillCacheToBucket(&tx2, schema.CacheLimits{MaxEntries: 1})
+	found := &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx2).SelectFromTable(T_ACCOUNT).WhereIdEquals(john.Id).Find(found)
+	assert.NoError(err)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx2).SelectFromTable(T_ACCOUNT).WhereIdEquals(jane.Id).Find(found) // spills john
+	assert.NoError(err)
+
+	// john is changed after tx2 first read him
+	tx3, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	john.Name = "John Updated"
+	overwrite := ""
+	_, err = repo.UpdateTable(ctx, &tx3, T_ACCOUNT, john, &overwrite)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx3))
+
+	// spilled objects are validated without being restored
+	errs := repo.Validate(ctx, &tx2)
+	assert.Equal(1, len(errs))
+	assert.True(errors.Is(errs[0], min.StaleObjectError))
+
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx2).SelectFromTable(T_ACCOUNT).WhereIdEquals(john.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("John", found.Name) // restored, rather than read again
+
+	assert.Empty(repo.Rollback(ctx, &tx2))
+	countSpilled := func(tx schema.Transaction) int {
+		count := 0
+		for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: min.SPILL_ROOT + tx.Id + "/", Recursive: true}) {
+			assert.NoError(object.Err)
+			count++
+		}
+		return count
+	}
+	assert.Equal(0, countSpilled(tx2))
+
+	// spilled by a transaction which never ended, e.g. because its process did, so they are removed by the garbage collection
+	tx4 := schema.NewReadOnlyTransaction(10 * time.Second)
+	repo.SpillCacheToBucket(&tx4, schema.CacheLimits{MaxEntries: 1})
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx4).SelectFromTable(T_ACCOUNT).WhereIdEquals(john.Id).Find(found)
+	assert.NoError(err)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx4).SelectFromTable(T_ACCOUNT).WhereIdEquals(jane.Id).Find(found) // spills john
+	assert.NoError(err)
+	assert.Equal(1, countSpilled(tx4))
+	min.ExecuteGc()
+	assert.Equal(1, countSpilled(tx4)) // the transaction may still be in progress
+	schema.SetClock(schema.NewManualClock(time.Now().Add(schema.MaxTimeout() + time.Minute)))
+	defer schema.SetClock(nil)
+	min.ExecuteGc()
+	assert.Equal(0, countSpilled(tx4))
+}
+
+func TestTransactions_DeclaredDependency_ChildRequiresParent(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	parent := &Account{Id: uuid.New().String(), Name: "Parent"}
+	child := &Account{Id: uuid.New().String(), Name: "Child"}
+
+	// a child whose parent is never written cannot be committed
+	tx1, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(tx1.DeclareDependency(T_ACCOUNT.Path(child.Id), T_ACCOUNT.Path(parent.Id)))
+	etag, err := repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, child)
+	assert.NoError(err)
+	assert.Nil(etag) // waiting for its parent
+	result := repo.CommitWithResult(ctx, &tx1)
+	assert.True(result.RolledBack)
+	assert.ErrorIs(result.Errors[0], schema.StepDependencyNotAppliedError)
+
+	// parent first succeeds
+	tx2, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(tx2.DeclareDependency(T_ACCOUNT.Path(child.Id), T_ACCOUNT.Path(parent.Id)))
+	_, err = repo.InsertIntoTable(ctx, &tx2, T_ACCOUNT, parent)
+	assert.NoError(err)
+	_, err = repo.InsertIntoTable(ctx, &tx2, T_ACCOUNT, child)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx2))
+
+	tx3 := schema.NewReadOnlyTransaction(10 * time.Second)
+	found := &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx3).SelectFromTable(T_ACCOUNT).WhereIdEquals(child.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("Child", found.Name)
+
+	// a child added before its parent waits, and is written once its parent is
+	grandchild := &Account{Id: uuid.New().String(), Name: "Grandchild"}
+	otherParent := &Account{Id: uuid.New().String(), Name: "Other parent"}
+	tx4, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(tx4.DeclareDependency(T_ACCOUNT.Path(grandchild.Id), T_ACCOUNT.Path(otherParent.Id)))
+	etag, err = repo.InsertIntoTable(ctx, &tx4, T_ACCOUNT, grandchild)
+	assert.NoError(err)
+	assert.Nil(etag)
+	etag, err = repo.InsertIntoTable(ctx, &tx4, T_ACCOUNT, otherParent)
+	assert.NoError(err)
+	assert.NotNil(etag)
+	parentStep := slices.IndexFunc(tx4.Steps, func(s *schema.TransactionStep) bool { return s.Path == T_ACCOUNT.Path(otherParent.Id) })
+	childStep := slices.IndexFunc(tx4.Steps, func(s *schema.TransactionStep) bool { return s.Path == T_ACCOUNT.Path(grandchild.Id) })
+	assert.True(tx4.Steps[childStep].Executed)
+	assert.Equal(*etag, *tx4.Steps[parentStep].FinalETag)
+	assert.Empty(repo.Commit(ctx, &tx4))
+
+	tx5 := schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx5).SelectFromTable(T_ACCOUNT).WhereIdEquals(grandchild.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("Grandchild", found.Name)
+}
+
+func TestTransactions_GetTransactionSummaries_LargestFirst(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	small, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err = repo.InsertIntoTable(ctx, &large, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: strings.Repeat("x", 1000)})
+		assert.NoError(err)
+	}
+
+	summaries, err := repo.GetTransactionSummaries(ctx)
+	assert.NoError(err)
+	// other tests may have left transactions behind
+	largeIndex := slices.IndexFunc(summaries, func(s min.TransactionSummary) bool { return s.Id == large.Id })
+	smallIndex := slices.IndexFunc(summaries, func(s min.TransactionSummary) bool { return s.Id == small.Id })
+	assert.GreaterOrEqual(largeIndex, 0)
+	assert.Greater(smallIndex, largeIndex)
+	assert.Equal(len(large.Steps), summaries[largeIndex].StepCount)
+	assert.Greater(summaries[largeIndex].ApproximateSize, int64(3000))
+	assert.Equal(0, summaries[smallIndex].StepCount)
+
+	assert.Empty(repo.Rollback(ctx, &large))
+	assert.Empty(repo.Rollback(ctx, &small))
+}
+
+func TestTransactions_CommitBatch(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	transactions := make([]*schema.Transaction, 0, 4)
+	accounts := make([]*Account, 0, 3)
+	for i := 0; i < 3; i++ {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := &Account{Id: uuid.New().String(), Name: fmt.Sprintf("John %d", i)}
+		_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+		assert.NoError(err)
+		transactions = append(transactions, &tx)
+		accounts = append(accounts, account)
+	}
+	timedOut, err := repo.BeginTransaction(ctx, 0*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions = append(transactions, &timedOut)
+
+	results := repo.CommitBatch(ctx, transactions)
+	assert.Equal(4, len(results))
+	for i := 0; i < 3; i++ {
+		assert.Empty(results[i].Errors)
+		assert.True(results[i].Committed)
+	}
+	assert.False(results[3].Committed)
+	assert.ErrorIs(results[3].Errors[0], schema.TransactionTimedOutError)
+	assert.Empty(repo.Rollback(ctx, &timedOut))
+
+	reader := schema.NewReadOnlyTransaction(10 * time.Second)
+	for _, account := range accounts {
+		found := &Account{}
+		_, err = min.NewTypedQuery[Account](repo, ctx, &reader).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(found)
+		assert.NoError(err)
+		assert.Equal(account.Name, found.Name)
+	}
+}
+
+func TestTransactions_ConditionalSteps_OnlyWrittenIfChanged(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+	T_AUDIT := schema.NewTable(DATABASE, "audit", []string{})
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	tx1, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, account)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx1))
+
+	upsertWithAudit := func(name string) *Account {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := &Account{}
+		etag, err := min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(read)
+		assert.NoError(err)
+		read.Name = name
+		_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, read, etag)
+		assert.NoError(err)
+		audit := &Account{Id: uuid.New().String(), Name: "audit of " + name}
+		assert.NoError(tx.When(schema.Changed(T_ACCOUNT.Path(account.Id)), func() error {
+			_, err := repo.InsertIntoTable(ctx, &tx, T_AUDIT, audit)
+			return err
+		}))
+		assert.Empty(repo.Commit(ctx, &tx))
+		return audit
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	unchanged := upsertWithAudit("John")
+	time.Sleep(10 * time.Millisecond)
+	changed := upsertWithAudit("Jane")
+
+	time.Sleep(10 * time.Millisecond)
+	reader := schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &reader).SelectFromTable(T_AUDIT).WhereIdEquals(unchanged.Id).Find(&Account{})
+	assert.ErrorIs(err, min.NoSuchKeyError)
+	found := &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &reader).SelectFromTable(T_AUDIT).WhereIdEquals(changed.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("audit of Jane", found.Name)
+}
+
+func TestTransactions_Compensations_ExecutedOnRollbackOnly(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	type refund struct {
+		PaymentId string `json:"paymentId"`
+	}
+	refunded := make([]string, 0)
+	min.RegisterCompensator("refund-"+t.Name(), func(ctx context.Context, repo *min.MinioRepository, tx *schema.Transaction, args json.RawMessage) error {
+		r := refund{}
+		if err := json.Unmarshal(args, &r); err != nil {
+			return err
+		}
+		refunded = append(refunded, r.PaymentId)
+		return nil
+	})
+
+	for _, commit := range []bool{true, false} {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: "John"})
+		assert.NoError(err)
+		assert.NoError(repo.Compensate(ctx, &tx, "refund-"+t.Name(), refund{PaymentId: fmt.Sprintf("payment-%t", commit)}))
+		if commit {
+			assert.Empty(repo.Commit(ctx, &tx))
+		} else {
+			assert.Empty(repo.Rollback(ctx, &tx))
+			assert.True(tx.Compensations[0].Executed)
+		}
+	}
+	assert.Equal([]string{"payment-false"}, refunded)
+}
+
+func TestTransactions_Compensations_UnknownCompensatorKeepsTransactionForRecovery(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(repo.Compensate(ctx, &tx, "unknown-"+t.Name(), nil))
+
+	// stored at once, so that a process which recovers the transaction executes it
+	stored := make([]schema.Transaction, 0)
+	assert.NoError(repo.GetTransactionsInProgress(ctx, &stored))
+	index := slices.IndexFunc(stored, func(s schema.Transaction) bool { return s.Id == tx.Id })
+	assert.GreaterOrEqual(index, 0)
+	assert.Equal(1, len(stored[index].Compensations))
+
+	errs := repo.Rollback(ctx, &tx)
+	assert.Equal(1, len(errs))
+	assert.ErrorContains(errs[0], "ADB-0110")
+
+	// a process that registers the compensator can recover it
+	called := false
+	min.RegisterCompensator("unknown-"+t.Name(), func(ctx context.Context, repo *min.MinioRepository, tx *schema.Transaction, args json.RawMessage) error {
+		called = true
+		return nil
+	})
+	transactions := make([]schema.Transaction, 0)
+	assert.NoError(repo.GetTransactionsInProgress(ctx, &transactions))
+	index = slices.IndexFunc(transactions, func(recovered schema.Transaction) bool { return recovered.Id == tx.Id })
+	assert.GreaterOrEqual(index, 0)
+	recovered := transactions[index]
+	assert.Equal("RollingBack", recovered.State)
+	assert.Empty(repo.ExecuteCompensations(ctx, &recovered))
+	assert.True(called)
+}
+
+func TestTransactions_RollbackOfDelete_RestoresPinnedVersion(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	tx1, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, account)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx1))
+	insertedVersionId := *tx1.Steps[0].FinalVersionId
+
+	time.Sleep(10 * time.Millisecond)
+	tx2, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := &Account{}
+	etag, err := min.NewTypedQuery[Account](repo, ctx, &tx2).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(read)
+	assert.NoError(err)
+	assert.NoError(repo.DeleteFromTable(ctx, &tx2, T_ACCOUNT, read, etag))
+	assert.Equal(schema.STEP_DELETE_DATA, tx2.Steps[0].Type)
+	assert.Equal(insertedVersionId, tx2.Steps[0].InitialVersionId)
+
+	// as if the transaction could not be updated after the tombstone was written
+	tx2.Steps[0].FinalVersionId = nil
+	assert.Empty(repo.Rollback(ctx, &tx2))
+
+	time.Sleep(10 * time.Millisecond)
+	reader := schema.NewReadOnlyTransaction(10 * time.Second)
+	found := &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &reader).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(found)
+	assert.NoError(err)
+	assert.Equal("John", found.Name)
+}
+
+func TestTransactions_CommitWithResult_ReportsFinalETags(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+	assert.NoError(err)
+	account.Name = "Jane"
+	etag, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, account, etag)
+	assert.NoError(err)
+
+	result := repo.CommitWithResult(ctx, &tx)
+	assert.Empty(result.Errors)
+	assert.NotNil(result.Report)
+	assert.Equal(tx.Id, result.Report.TransactionId)
+
+	committed, ok := result.Report.Get(T_ACCOUNT.Path(account.Id))
+	assert.True(ok)
+	assert.Equal(schema.STEP_UPDATE_DATA, committed.Type) // the last write wins
+	assert.Equal(*etag, *committed.FinalETag)
+	assert.NotNil(committed.FinalVersionId)
+	_, ok = result.Report.Get(T_ACCOUNT.IndicesPath(account.Id))
+	assert.True(ok)
+
+	reader := schema.NewReadOnlyTransaction(10 * time.Second)
+	readETag, err := min.NewTypedQuery[Account](repo, ctx, &reader).SelectFromTable(T_ACCOUNT).WhereIdEquals(account.Id).Find(&Account{})
+	assert.NoError(err)
+	assert.Equal(*readETag, *committed.FinalETag)
+}
+
+func TestTransactions_ConditionalGet_NotModifiedUntilCommitted(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	tx1, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, account)
+	assert.NoError(err)
+
+	// not yet committed, so there is nothing to revalidate against
+	committedETag, err := repo.GetCommittedETag(ctx, T_ACCOUNT.Path(account.Id))
+	assert.NoError(err)
+	assert.Nil(committedETag)
+
+	result := repo.CommitWithResult(ctx, &tx1)
+	assert.Empty(result.Errors)
+	committedETag, err = repo.GetCommittedETag(ctx, T_ACCOUNT.Path(account.Id))
+	assert.NoError(err)
+	assert.Equal(*etag, *committedETag)
+
+	r := httptest.NewRequest(http.MethodGet, "/accounts/"+account.Id, nil)
+	r.Header.Set("If-None-Match", `"`+*etag+`"`)
+	w := httptest.NewRecorder()
+	handled, err := web.ConditionalGetObject(w, r, repo, T_ACCOUNT.Path(account.Id))
+	assert.NoError(err)
+	assert.True(handled)
+	assert.Equal(http.StatusNotModified, w.Code)
+
+	// the table's token changes with the next commit
+	tableETag, err := repo.GetTableETag(ctx, T_ACCOUNT)
+	assert.NoError(err)
+	r.Header.Set("If-None-Match", `"`+tableETag+`"`)
+	w = httptest.NewRecorder()
+	handled, err = web.ConditionalGetTable(w, r, repo, T_ACCOUNT)
+	assert.NoError(err)
+	assert.True(handled)
+
+	tx2, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx2, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: "Jane"})
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx2))
+	w = httptest.NewRecorder()
+	handled, err = web.ConditionalGetTable(w, r, repo, T_ACCOUNT)
+	assert.NoError(err)
+	assert.False(handled)
+	assert.NotEqual(`"`+tableETag+`"`, w.Header().Get("ETag"))
+}
+
+func TestTransactions_Ephemeral_RemovedOnCommitAndRollback(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account", []string{"Name"})
+
+	for _, commit := range []bool{true, false} {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := repo.PutEphemeral(ctx, &tx, "staging.csv", "text/csv", []byte("a,b\n"))
+		assert.NoError(err)
+		_, err = repo.PutEphemeral(ctx, &tx, "staging.csv", "text/csv", []byte("a,b\n1,2\n"))
+		assert.NoError(err)
+		data, err := repo.GetEphemeral(ctx, &tx, "staging.csv")
+		assert.NoError(err)
+		assert.Equal("a,b\n1,2\n", string(data))
+		_, err = repo.GetEphemeral(ctx, &tx, "other.csv")
+		assert.ErrorContains(err, "ADB-0115")
+
+		account := &Account{Id: uuid.New().String(), Name: "John"}
+		_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+		assert.NoError(err)
+
+		if commit {
+			result := repo.CommitWithResult(ctx, &tx)
+			assert.Empty(result.Errors)
+			_, reported := result.Report.Get(path)
+			assert.False(reported)
+		} else {
+			assert.Empty(repo.Rollback(ctx, &tx))
+		}
+
+		remaining := 0
+		for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: min.EPHEMERAL_ROOT + tx.Id + "/", Recursive: true, WithVersions: true}) {
+			assert.NoError(object.Err)
+			remaining++
+		}
+		assert.Equal(0, remaining)
+	}
+}
+
+func TestTransactions_Bulk_ImportUpsertAndExport(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "bulk-account-"+uuid.New().String(), []string{"Name"})
+	mux := http.NewServeMux()
+	web.RegisterBulkEndpoints[Account](mux, repo, T_ACCOUNT, 10*time.Second)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := server.URL + "/bulk/" + string(DATABASE) + "/" + T_ACCOUNT.Name + "/"
+
+	statuses := func(response *http.Response) []web.BulkStatus {
+		defer response.Body.Close()
+		statuses := make([]web.BulkStatus, 0)
+		decoder := json.NewDecoder(response.Body)
+		for decoder.More() {
+			var status web.BulkStatus
+			assert.NoError(decoder.Decode(&status))
+			statuses = append(statuses, status)
+		}
+		return statuses
+	}
+
+	id1, id2 := uuid.New().String(), uuid.New().String()
+	body := fmt.Sprintf("{\"Id\":%q,\"Name\":\"John\"}\n{\"Id\":%q,\"Name\":\"Jane\"}\n{\"Id\":%q,\"Name\":\"Again\"}\nnot json\n", id1, id2, id1)
+	response, err := http.Post(url+"import", web.CONTENT_TYPE_NDJSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := statuses(response)
+	if assert.Len(imported, 4) {
+		assert.Equal(http.StatusCreated, imported[0].Status)
+		assert.Equal(T_ACCOUNT.Path(id1), imported[0].Path)
+		assert.NotEmpty(imported[0].ETag)
+		assert.NotEmpty(imported[0].CommitToken)
+		assert.Equal(http.StatusCreated, imported[1].Status)
+		assert.Equal(http.StatusConflict, imported[2].Status) // duplicate key, or locked by the first line
+		assert.Equal(http.StatusBadRequest, imported[3].Status)
+	}
+
+	body = fmt.Sprintf("{\"Id\":%q,\"Name\":\"Johnny\"}\n", id1)
+	response, err = http.Post(url+"upsert", web.CONTENT_TYPE_NDJSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upserted := statuses(response)
+	if assert.Len(upserted, 1) {
+		assert.Equal(http.StatusOK, upserted[0].Status)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url+"export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set(web.HEADER_MIN_COMMIT_TOKEN, upserted[0].CommitToken)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+	exported := make(map[string]string)
+	decoder := json.NewDecoder(response.Body)
+	for decoder.More() {
+		var account Account
+		assert.NoError(decoder.Decode(&account))
+		exported[account.Id] = account.Name
+	}
+	assert.Equal(map[string]string{id1: "Johnny", id2: "Jane"}, exported)
+}
+
+func TestTransactions_UniqueIndex_RejectsDuplicateValues(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "unique-account-"+uuid.New().String(), []string{}).WithUniqueIndex("Name")
+
+	insert := func(account *Account) error {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account); err != nil {
+			repo.Rollback(ctx, &tx)
+			return err
+		}
+		assert.Empty(repo.Commit(ctx, &tx))
+		return nil
+	}
+
+	john := &Account{Id: uuid.New().String(), Name: "John"}
+	assert.NoError(insert(john))
+	other := &Account{Id: uuid.New().String(), Name: "john"} // index values ignore case
+	err := insert(other)
+	assert.ErrorIs(err, min.UniqueViolationError)
+
+	// renaming releases the value
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	john.Name = "Johnny"
+	_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, john, new(string))
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+	assert.NoError(insert(other))
+	assert.ErrorIs(insert(&Account{Id: uuid.New().String(), Name: "Johnny"}), min.UniqueViolationError)
+
+	// deleting releases it too
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_ACCOUNT, other, new(string)))
+	assert.Empty(repo.Commit(ctx, &tx))
+	assert.NoError(insert(&Account{Id: uuid.New().String(), Name: "John"}))
+
+	// a value being written by a transaction in progress cannot be claimed
+	tx1, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx1, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: "Zed"})
+	assert.NoError(err)
+	assert.ErrorIs(insert(&Account{Id: uuid.New().String(), Name: "Zed"}), min.UniqueViolationError)
+	assert.Empty(repo.Rollback(ctx, &tx1))
+	assert.NoError(insert(&Account{Id: uuid.New().String(), Name: "Zed"}))
+}
+
+func TestTransactions_NumericIndex_RangeQueries(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Person struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+		Age  *int   `json:"age"`
+	}
+	age := func(a int) *int { return &a }
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_PERSON := schema.NewTable(DATABASE, "person-"+uuid.New().String(), []string{}).WithNumericIndex("Age")
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, person := range []*Person{
+		{Id: uuid.New().String(), Name: "baby", Age: age(0)},
+		{Id: uuid.New().String(), Name: "teenager", Age: age(17)},
+		{Id: uuid.New().String(), Name: "adult", Age: age(18)},
+		{Id: uuid.New().String(), Name: "nine", Age: age(9)},
+		{Id: uuid.New().String(), Name: "senior", Age: age(65)},
+		{Id: uuid.New().String(), Name: "middle", Age: age(40)},
+		{Id: uuid.New().String(), Name: "unknown"},
+	} {
+		_, err = repo.InsertIntoTable(ctx, &tx, T_PERSON, person)
+		assert.NoError(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	names := func(from float64, to float64) []string {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer repo.Rollback(ctx, &tx)
+		people := make([]*Person, 0)
+		_, err = min.NewTypedQuery[Person](repo, ctx, &tx).SelectFromTable(T_PERSON).WhereIndexedFieldInRange("Age", from, to).Find(&people)
+		assert.NoError(err)
+		result := make([]string, 0, len(people))
+		for _, person := range people {
+			result = append(result, person.Name)
+		}
+		slices.Sort(result)
+		return result
+	}
+	assert.Equal([]string{"adult", "middle"}, names(18, 65))
+	assert.Equal([]string{"baby", "nine", "teenager"}, names(math.Inf(-1), 18))
+	assert.Equal([]string{"middle", "senior"}, names(40, math.Inf(1)))
+	assert.Empty(names(66, 100))
+
+	// equality is numeric too
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	people := make([]*Person, 0)
+	_, err = min.NewTypedQuery[Person](repo, ctx, &tx).SelectFromTable(T_PERSON).WhereIndexedFieldEquals("Age", "9.0").Find(&people)
+	assert.NoError(err)
+	if assert.Len(people, 1) {
+		assert.Equal("nine", people[0].Name)
+	}
+	assert.Empty(repo.Rollback(ctx, &tx))
+}
+
+func TestTransactions_TimeIndex_PeriodAndRangeQueries(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Event struct {
+		Id         string     `json:"id"`
+		Name       string     `json:"name"`
+		OccurredAt *time.Time `json:"occurredAt"`
+	}
+	at := func(s string) *time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return &t
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_EVENT := schema.NewTable(DATABASE, "event-"+uuid.New().String(), []string{}).WithTimeIndex("OccurredAt")
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []*Event{
+		{Id: uuid.New().String(), Name: "february", OccurredAt: at("2026-02-28T23:59:59Z")},
+		{Id: uuid.New().String(), Name: "march-first", OccurredAt: at("2026-03-01T00:00:00Z")},
+		// in UTC, this is still in march
+		{Id: uuid.New().String(), Name: "march-last", OccurredAt: at("2026-04-01T01:00:00+02:00")},
+		{Id: uuid.New().String(), Name: "april", OccurredAt: at("2026-04-01T00:00:00Z")},
+		{Id: uuid.New().String(), Name: "last-year", OccurredAt: at("2025-03-15T12:00:00Z")},
+		{Id: uuid.New().String(), Name: "unknown"},
+	} {
+		_, err = repo.InsertIntoTable(ctx, &tx, T_EVENT, event)
+		assert.NoError(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	names := func(query func(where min.WhereContainer[Event]) min.FindByIndexedFieldInTimeRangeContainer[Event]) []string {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer repo.Rollback(ctx, &tx)
+		events := make([]*Event, 0)
+		_, err = query(min.NewTypedQuery[Event](repo, ctx, &tx).SelectFromTable(T_EVENT)).Find(&events)
+		assert.NoError(err)
+		result := make([]string, 0, len(events))
+		for _, event := range events {
+			result = append(result, event.Name)
+		}
+		slices.Sort(result)
+		return result
+	}
+	inPeriod := func(period string) []string {
+		return names(func(where min.WhereContainer[Event]) min.FindByIndexedFieldInTimeRangeContainer[Event] {
+			return where.WhereIndexedFieldInPeriod("OccurredAt", period)
+		})
+	}
+	assert.Equal([]string{"march-first", "march-last"}, inPeriod("2026/03"))
+	assert.Equal([]string{"april", "february", "march-first", "march-last"}, inPeriod("2026"))
+	assert.Equal([]string{"march-first"}, inPeriod("2026/03/01"))
+	assert.Empty(inPeriod("2024"))
+	assert.Equal([]string{"february", "last-year"}, names(func(where min.WhereContainer[Event]) min.FindByIndexedFieldInTimeRangeContainer[Event] {
+		return where.WhereIndexedFieldInTimeRange("OccurredAt", time.Time{}, *at("2026-03-01T00:00:00Z"))
+	}))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make([]*Event, 0)
+	_, err = min.NewTypedQuery[Event](repo, ctx, &tx).SelectFromTable(T_EVENT).WhereIndexedFieldInPeriod("OccurredAt", "March").Find(&events)
+	assert.ErrorContains(err, "ADB-0280")
+	_, err = min.NewTypedQuery[Event](repo, ctx, &tx).SelectFromTable(T_EVENT).WhereIndexedFieldEquals("OccurredAt", "2026-04-01T00:00:00Z").Find(&events)
+	assert.NoError(err)
+	if assert.Len(events, 1) {
+		assert.Equal("april", events[0].Name)
+	}
+	assert.Empty(repo.Rollback(ctx, &tx))
+
+	// the entries of a period share a prefix, e.g. for a lifecycle rule which expires them
+	index, err := T_EVENT.GetIndexRevision("OccurredAt", 0)
+	assert.NoError(err)
+	prefix, err := index.PeriodPathPrefix("2025")
+	assert.NoError(err)
+	count := 0
+	for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		assert.NoError(object.Err)
+		count++
+	}
+	assert.Equal(1, count)
+}
+
+func TestTransactions_PartialIndex_OnlyContainsMatchingEntities(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Member struct {
+		Id     string `json:"id"`
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_MEMBER := schema.NewTable(DATABASE, "member-"+uuid.New().String(), []string{}).
+		WithPartialIndex("Name", func(entity any) (bool, error) { return entity.(*Member).Status == "active", nil }).
+		WithUniqueIndex("Name")
+	index, err := T_MEMBER.GetIndex("Name")
+	assert.NoError(err)
+
+	write := func(member *Member, insert bool) error {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if insert {
+			_, err = repo.InsertIntoTable(ctx, &tx, T_MEMBER, member)
+		} else {
+			overwrite := ""
+			_, err = repo.UpdateTable(ctx, &tx, T_MEMBER, member, &overwrite)
+		}
+		if err != nil {
+			repo.Rollback(ctx, &tx)
+			return err
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}
+	entries := func() int {
+		count := 0
+		for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: index.PathPrefix() + "/", Recursive: true, WithMetadata: true}) {
+			assert.NoError(object.Err)
+			if object.UserMetadata[min.MINIO_META_PREFIX+min.TOMBSTONE_AND_EXISTS_UNTIL] == "" {
+				count++
+			}
+		}
+		return count
+	}
+	activeNamed := func(name string) []*Member {
+		tx := schema.NewReadOnlyTransaction(10 * time.Second)
+		members := []*Member{}
+		_, err := min.NewTypedQuery[Member](repo, ctx, &tx).SelectFromTable(T_MEMBER).WhereIndexedFieldEquals("Name", name).Find(&members)
+		assert.NoError(err)
+		return members
+	}
+
+	alice := &Member{Id: uuid.New().String(), Name: "alice", Status: "active"}
+	assert.NoError(write(alice, true))
+	// closed members are neither indexed nor constrained
+	assert.NoError(write(&Member{Id: uuid.New().String(), Name: "bob", Status: "closed"}, true))
+	assert.NoError(write(&Member{Id: uuid.New().String(), Name: "bob", Status: "closed"}, true))
+	assert.Equal(1, entries())
+	assert.Len(activeNamed("alice"), 1)
+	assert.Empty(activeNamed("bob"))
+
+	assert.ErrorIs(write(&Member{Id: uuid.New().String(), Name: "alice", Status: "active"}, true), min.UniqueViolationError)
+
+	// leaving the filter removes the entry
+	alice.Status = "closed"
+	assert.NoError(write(alice, false))
+	assert.Equal(0, entries())
+	assert.Empty(activeNamed("alice"))
+	assert.NoError(write(&Member{Id: uuid.New().String(), Name: "alice", Status: "active"}, true))
+	assert.Len(activeNamed("alice"), 1)
+}
+
+func TestTransactions_PathTemplate_ManagesAForeignLayoutInPlace(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	folder := "legacy-" + uuid.New().String()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "legacy-account-"+uuid.New().String(), []string{"Name"}).WithPathTemplate(folder + "/accounts/{id}.json")
+	defer schema.RegisterMappedTable(T_ACCOUNT)()
+
+	// written by something else, before the table is adopted
+	existing := Account{Id: uuid.New().String(), Name: "Alice"}
+	data, err := json.Marshal(existing)
+	assert.NoError(err)
+	_, err = repo.Client.PutObject(ctx, repo.BucketName, folder+"/accounts/"+existing.Id+".json", bytes.NewReader(data), int64(len(data)), m.PutObjectOptions{ContentType: "application/json"})
+	assert.NoError(err)
+
+	count, err := min.BackfillIndex[Account](ctx, repo, T_ACCOUNT, "Name", 0)
+	assert.NoError(err)
+	assert.Equal(1, count)
+
+	findByName := func(name string) []*Account {
+		tx := schema.NewReadOnlyTransaction(10 * time.Second)
+		accounts := []*Account{}
+		_, err := min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", name).Find(&accounts)
+		assert.NoError(err)
+		return accounts
+	}
+	if assert.Len(findByName("Alice"), 1) {
+		assert.Equal(existing, *findByName("Alice")[0])
+	}
+
+	// writes go to the foreign layout, transactionally
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserted := &Account{Id: uuid.New().String(), Name: "Bob"}
+	insertedETag, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, inserted)
+	assert.NoError(err)
+	existing.Name = "Alicia"
+	overwrite := ""
+	_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, &existing, &overwrite)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	object, err := repo.Client.GetObject(ctx, repo.BucketName, folder+"/accounts/"+inserted.Id+".json", m.GetObjectOptions{})
+	assert.NoError(err)
+	written, err := io.ReadAll(object)
+	object.Close()
+	assert.NoError(err)
+	assert.Contains(string(written), "Bob")
+	assert.Len(findByName("Bob"), 1)
+	assert.Empty(findByName("Alice"))
+	assert.Len(findByName("Alicia"), 1)
+
+	// nothing but the objects themselves is written to the foreign layout
+	keys := make([]string, 0)
+	for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: folder + "/", Recursive: true}) {
+		assert.NoError(object.Err)
+		keys = append(keys, object.Key)
+	}
+	slices.Sort(keys)
+	expected := []string{folder + "/accounts/" + existing.Id + ".json", folder + "/accounts/" + inserted.Id + ".json"}
+	slices.Sort(expected)
+	assert.Equal(expected, keys)
+
+	// an object written before the table was adopted has no reverse indices, so it can be updated with its ETag without them
+	other := Account{Id: uuid.New().String(), Name: "Carol"}
+	data, err = json.Marshal(other)
+	assert.NoError(err)
+	info, err := repo.Client.PutObject(ctx, repo.BucketName, folder+"/accounts/"+other.Id+".json", bytes.NewReader(data), int64(len(data)), m.PutObjectOptions{ContentType: "application/json"})
+	assert.NoError(err)
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Name = "Caroline"
+	_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, &other, &info.ETag)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+	assert.Len(findByName("Caroline"), 1)
+
+	// but objects written by the repository have them, so that their index entries are not left behind when they change
+	assert.NoError(repo.Client.RemoveObject(ctx, repo.BucketName, T_ACCOUNT.IndicesPath(inserted.Id), m.RemoveObjectOptions{}))
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inserted.Name = "Robert"
+	_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, inserted, insertedETag)
+	assert.Error(err)
+	assert.Empty(repo.Rollback(ctx, &tx))
+
+	// tables with a path template are only written once registered
+	unregistered := schema.NewTable(DATABASE, "legacy-account-"+uuid.New().String(), []string{"Name"}).WithPathTemplate(folder + "/others/{id}.json")
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, unregistered, &Account{Id: uuid.New().String(), Name: "Dave"})
+	assert.ErrorContains(err, "ADB-0188")
+	assert.Empty(repo.Rollback(ctx, &tx))
+}
+
+func TestTransactions_TTLIndex_SweepDeletesExpiredEntities(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Session struct {
+		Id       string    `json:"id"`
+		Name     string    `json:"name"`
+		LastUsed time.Time `json:"lastUsed"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_SESSION := schema.NewTable(DATABASE, "session-"+uuid.New().String(), []string{}).WithTTLIndex("LastUsed", 30*time.Minute)
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := schema.Now()
+	for _, session := range []*Session{
+		{Id: uuid.New().String(), Name: "expired", LastUsed: now.Add(-time.Hour)},
+		{Id: uuid.New().String(), Name: "also-expired", LastUsed: now.Add(-31 * time.Minute)},
+		{Id: uuid.New().String(), Name: "active", LastUsed: now.Add(-time.Minute)},
+	} {
+		_, err = repo.InsertIntoTable(ctx, &tx, T_SESSION, session)
+		assert.NoError(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	count, err := min.SweepExpired[Session](ctx, repo, T_SESSION, "LastUsed")
+	assert.NoError(err)
+	assert.Equal(2, count)
+
+	// the index entries are gone too
+	snapshot := schema.NewReadOnlyTransaction(10 * time.Second)
+	sessions := make([]*Session, 0)
+	_, err = min.NewTypedQuery[Session](repo, ctx, &snapshot).SelectFromTable(T_SESSION).WhereIndexedFieldInTimeRange("LastUsed", time.Time{}, now.Add(time.Hour)).Find(&sessions)
+	assert.NoError(err)
+	if assert.Len(sessions, 1) {
+		assert.Equal("active", sessions[0].Name)
+	}
+
+	// nothing left to sweep
+	count, err = min.SweepExpired[Session](ctx, repo, T_SESSION, "LastUsed")
+	assert.NoError(err)
+	assert.Equal(0, count)
+
+	T_PLAIN := schema.NewTable(DATABASE, "session-"+uuid.New().String(), []string{"Name"})
+	_, err = min.SweepExpired[Session](ctx, repo, T_PLAIN, "Name")
+	assert.ErrorContains(err, "ADB-0130")
+}
+
+func TestTransactions_IndexCollation_CaseSensitiveAndInsensitive(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Account struct {
+		Id       string `json:"id"`
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{}).
+		WithUniqueIndex("Email").WithCollation("Email", schema.IndexCollation{Case: schema.CASE_INSENSITIVE}).
+		WithUniqueIndex("Username").WithCollation("Username", schema.IndexCollation{Case: schema.CASE_SENSITIVE})
+
+	insert := func(account *Account) error {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account); err != nil {
+			repo.Rollback(ctx, &tx)
+			return err
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}
+	assert.NoError(insert(&Account{Id: uuid.New().String(), Email: "alice@example.com", Username: "alice"}))
+	// usernames which only differ by case are different
+	assert.NoError(insert(&Account{Id: uuid.New().String(), Email: "bob@example.com", Username: "Alice"}))
+	// emails are not
+	err := insert(&Account{Id: uuid.New().String(), Email: "ALICE@example.com", Username: "carol"})
+	assert.ErrorIs(err, min.UniqueViolationError)
+
+	snapshot := schema.NewReadOnlyTransaction(10 * time.Second)
+	accounts := make([]*Account, 0)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &snapshot).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Email", "Alice@Example.com").Find(&accounts)
+	assert.NoError(err)
+	if assert.Len(accounts, 1) {
+		assert.Equal("alice", accounts[0].Username)
+	}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &snapshot).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Username", "Alice").Find(&accounts)
+	assert.NoError(err)
+	if assert.Len(accounts, 1) {
+		assert.Equal("bob@example.com", accounts[0].Email)
+	}
+}
+
+func TestTransactions_JsonPathIndex_NestedAndArrayValues(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Address struct {
+		City string `json:"city"`
+		Zip  int    `json:"zip"`
+	}
+	type Tag struct {
+		Name string `json:"name"`
+	}
+	type Person struct {
+		Id      string   `json:"id"`
+		Name    string   `json:"name"`
+		Address *Address `json:"address"`
+		Tags    []Tag    `json:"tags"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_PERSON := schema.NewTable(DATABASE, "person-"+uuid.New().String(), []string{}).
+		WithJsonPathIndex("address.city").
+		WithJsonPathIndex("address.zip").WithNumericIndex("address.zip").
+		WithJsonPathIndex("tags[].name")
+
+	alice := &Person{Id: uuid.New().String(), Name: "alice", Address: &Address{City: "Bern", Zip: 3000}, Tags: []Tag{{Name: "admin"}, {Name: "dev"}}}
+	bob := &Person{Id: uuid.New().String(), Name: "bob", Address: &Address{City: "Zurich", Zip: 8000}, Tags: []Tag{{Name: "dev"}}}
+	carol := &Person{Id: uuid.New().String(), Name: "carol"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, person := range []*Person{alice, bob, carol} {
+		_, err = repo.InsertIntoTable(ctx, &tx, T_PERSON, person)
+		assert.NoError(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	names := func(query func(where min.WhereContainer[Person]) ([]*Person, error)) []string {
+		people, err := query(min.NewTypedQuery[Person](repo, ctx, &tx).SelectFromTable(T_PERSON))
+		assert.NoError(err)
+		result := make([]string, 0, len(people))
+		for _, person := range people {
+			result = append(result, person.Name)
+		}
+		slices.Sort(result)
+		return result
+	}
+	equals := func(field string, value string) []string {
+		return names(func(where min.WhereContainer[Person]) ([]*Person, error) {
+			people := []*Person{}
+			_, err := where.WhereIndexedFieldEquals(field, value).Find(&people)
+			return people, err
+		})
+	}
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	assert.Equal([]string{"alice"}, equals("address.city", "Bern"))
+	assert.Equal([]string{"alice", "bob"}, equals("tags[].name", "dev"))
+	assert.Equal([]string{"alice"}, equals("tags[].name", "admin"))
+	assert.Equal([]string{"carol"}, names(func(where min.WhereContainer[Person]) ([]*Person, error) {
+		people := []*Person{}
+		_, err := where.WhereIndexedFieldIsNull("tags[].name").Find(&people)
+		return people, err
+	}))
+	assert.Equal([]string{"bob"}, names(func(where min.WhereContainer[Person]) ([]*Person, error) {
+		people := []*Person{}
+		_, err := where.WhereIndexedFieldInRange("address.zip", 5000, 9000).Find(&people)
+		return people, err
+	}))
+
+	// updates replace the entries of the values which are removed
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := min.NewTypedQuery[Person](repo, ctx, &tx).SelectFromTable(T_PERSON).WhereIdEquals(alice.Id).Find(&Person{})
+	assert.NoError(err)
+	alice.Tags = []Tag{{Name: "ops"}}
+	_, err = repo.UpdateTable(ctx, &tx, T_PERSON, alice, etag)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	assert.Equal([]string{"bob"}, equals("tags[].name", "dev"))
+	assert.Empty(equals("tags[].name", "admin"))
+	assert.Equal([]string{"alice"}, equals("tags[].name", "ops"))
+
+	// records with several values are counted once when verifying the index
+	alice.Tags = []Tag{{Name: "ops"}, {Name: "dev"}}
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overwrite := ""
+	_, err = repo.UpdateTable(ctx, &tx, T_PERSON, alice, &overwrite)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+	counts, err := repo.VerifyIndex(ctx, T_PERSON, "tags[].name", 0)
+	assert.NoError(err)
+	assert.Equal(min.IndexCounts{Records: 3, Entries: 3}, counts)
+	assert.True(counts.Matches())
+}
+
+func TestTransactions_SliceIndex_EntryPerElement(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Document struct {
+		Id     string   `json:"id"`
+		Name   string   `json:"name"`
+		Tags   []string `json:"tags"`
+		Scores []int    `json:"scores"`
+		Codes  []string `json:"codes"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_DOCUMENT := schema.NewTable(DATABASE, "document-"+uuid.New().String(), []string{"Tags"}).WithNumericIndex("Scores").WithUniqueIndex("Codes")
+
+	insert := func(document *Document) error {
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_DOCUMENT, document); err != nil {
+			repo.Rollback(ctx, &tx)
+			return err
+		}
+		if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}
+	first := &Document{Id: uuid.New().String(), Name: "first", Tags: []string{"go", "db", "go"}, Scores: []int{3, 7}, Codes: []string{"A1"}}
+	second := &Document{Id: uuid.New().String(), Name: "second", Tags: []string{"db"}, Scores: []int{5}, Codes: []string{"B1", "B2"}}
+	untagged := &Document{Id: uuid.New().String(), Name: "untagged"}
+	for _, document := range []*Document{first, second, untagged} {
+		assert.NoError(insert(document))
+	}
+	// no two documents may share a code
+	assert.ErrorIs(insert(&Document{Id: uuid.New().String(), Name: "third", Codes: []string{"C1", "B2"}}), min.UniqueViolationError)
+
+	names := func(find func(where min.WhereContainer[Document], documents *[]*Document) error) []string {
+		tx := schema.NewReadOnlyTransaction(10 * time.Second)
+		documents := []*Document{}
+		assert.NoError(find(min.NewTypedQuery[Document](repo, ctx, &tx).SelectFromTable(T_DOCUMENT), &documents))
+		result := make([]string, 0, len(documents))
+		for _, document := range documents {
+			result = append(result, document.Name)
+		}
+		slices.Sort(result)
+		return result
+	}
+	tagged := func(tag string) []string {
+		return names(func(where min.WhereContainer[Document], documents *[]*Document) error {
+			_, err := where.WhereIndexedFieldEquals("Tags", tag).Find(documents)
+			return err
+		})
+	}
+	assert.Equal([]string{"first", "second"}, tagged("db"))
+	assert.Equal([]string{"first"}, tagged("go"))
+	assert.Equal([]string{"untagged"}, names(func(where min.WhereContainer[Document], documents *[]*Document) error {
+		_, err := where.WhereIndexedFieldIsNull("Tags").Find(documents)
+		return err
+	}))
+	assert.Equal([]string{"first", "second"}, names(func(where min.WhereContainer[Document], documents *[]*Document) error {
+		_, err := where.WhereIndexedFieldInRange("Scores", 4, 8).Find(documents)
+		return err
+	}))
+
+	// updates add the entries of new elements and remove those of removed ones
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := min.NewTypedQuery[Document](repo, ctx, &tx).SelectFromTable(T_DOCUMENT).WhereIdEquals(first.Id).Find(&Document{})
+	assert.NoError(err)
+	first.Tags = []string{"go", "web"}
+	first.Codes = []string{"A1", "C1"}
+	_, err = repo.UpdateTable(ctx, &tx, T_DOCUMENT, first, etag)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	assert.Equal([]string{"second"}, tagged("db"))
+	assert.Equal([]string{"first"}, tagged("go"))
+	assert.Equal([]string{"first"}, tagged("web"))
+
+	// records with several elements are counted once when verifying the indices
+	for _, field := range []string{"Tags", "Scores"} {
+		counts, err := repo.VerifyIndex(ctx, T_DOCUMENT, field, 0)
+		assert.NoError(err)
+		assert.Equal(min.IndexCounts{Records: 3, Entries: 3}, counts, field)
+	}
+}
+
+func TestTransactions_ResumableUploadAttachedWithTheOwningRecord(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Document struct {
+		Id   string         `json:"id"`
+		Name string         `json:"name"`
+		File min.Attachment `json:"file"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_DOCUMENT := schema.NewTable(DATABASE, "document-"+uuid.New().String(), []string{"Name"})
+
+	content := bytes.Repeat([]byte("0123456789"), (min.UPLOAD_MIN_CHUNK_SIZE+100)/10)
+	upload := func() *min.UploadSession {
+		session, err := repo.CreateUpload(ctx, T_DOCUMENT, int64(len(content)), "text/plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the first chunk is too small
+		_, err = repo.UploadChunk(ctx, session.Id, 0, bytes.NewReader(content[:100]), 100)
+		assert.Error(err)
+		session, err = repo.UploadChunk(ctx, session.Id, 0, bytes.NewReader(content[:min.UPLOAD_MIN_CHUNK_SIZE]), min.UPLOAD_MIN_CHUNK_SIZE)
+		assert.NoError(err)
+		// e.g. the client resends the first chunk, since it did not get the response
+		_, err = repo.UploadChunk(ctx, session.Id, 0, bytes.NewReader(content[:min.UPLOAD_MIN_CHUNK_SIZE]), min.UPLOAD_MIN_CHUNK_SIZE)
+		var mismatch *min.UploadOffsetMismatchErrorWithDetails
+		if assert.ErrorAs(err, &mismatch) {
+			assert.Equal(int64(min.UPLOAD_MIN_CHUNK_SIZE), mismatch.Offset)
+		}
+		rest := content[min.UPLOAD_MIN_CHUNK_SIZE:]
+		session, err = repo.UploadChunk(ctx, session.Id, mismatch.Offset, bytes.NewReader(rest), int64(len(rest)))
+		assert.NoError(err)
+		assert.Equal(session.Length, session.Offset)
+		return session
+	}
+
+	// rolled back, so the object does not exist, and the session can no longer be attached
+	session := upload()
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachment, err := repo.AttachUpload(ctx, &tx, session.Id)
+	assert.NoError(err)
+	_, err = repo.InsertIntoTable(ctx, &tx, T_DOCUMENT, &Document{Id: uuid.New().String(), Name: "rolled back", File: *attachment})
+	assert.NoError(err)
+	assert.Empty(repo.Rollback(ctx, &tx))
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, attachment.Path, m.StatObjectOptions{})
+	assert.Error(err)
+
+	// committed along with the record which refers to it
+	session = upload()
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachment, err = repo.AttachUpload(ctx, &tx, session.Id)
+	assert.NoError(err)
+	document := &Document{Id: uuid.New().String(), Name: "committed", File: *attachment}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_DOCUMENT, document)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	info, err := repo.Client.StatObject(ctx, repo.BucketName, document.File.Path, m.StatObjectOptions{})
+	assert.NoError(err)
+	assert.Equal(int64(len(content)), info.Size)
+	assert.Equal("text/plain", info.ContentType)
+	_, err = repo.GetUpload(ctx, session.Id)
+	assert.ErrorIs(err, min.NoSuchKeyError)
+
+	// abandoned sessions are removed once they expire
+	session, err = repo.CreateUpload(ctx, T_DOCUMENT, 10, "")
+	assert.NoError(err)
+	schema.SetClock(schema.NewManualClock(time.Now().Add(2 * min.UPLOAD_EXPIRY)))
+	defer schema.SetClock(nil)
+	count, err := repo.SweepExpiredUploads(ctx)
+	assert.NoError(err)
+	assert.GreaterOrEqual(count, 1)
+}
+
+func TestTransactions_CleanStaleMultipartUploads(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_DOCUMENT := schema.NewTable(DATABASE, "document-"+uuid.New().String(), []string{})
+
+	chunk := bytes.Repeat([]byte("x"), min.UPLOAD_MIN_CHUNK_SIZE)
+	start := func() *min.UploadSession {
+		session, err := repo.CreateUpload(ctx, T_DOCUMENT, 2*min.UPLOAD_MIN_CHUNK_SIZE, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, err = repo.UploadChunk(ctx, session.Id, 0, bytes.NewReader(chunk), int64(len(chunk)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+	live := start()
+	orphaned := start()
+	// e.g. the session was removed without aborting the upload
+	assert.NoError(repo.Client.RemoveObject(ctx, repo.BucketName, min.UPLOADS_ROOT+orphaned.Id+".json", m.RemoveObjectOptions{}))
+
+	// uploads which are not yet stale are kept
+	report, err := repo.CleanStaleMultipartUploads(ctx, time.Hour)
+	assert.NoError(err)
+	assert.Equal(0, report.Aborted)
+
+	schema.SetClock(schema.NewManualClock(time.Now().Add(2 * time.Hour)))
+	defer schema.SetClock(nil)
+	report, err = repo.CleanStaleMultipartUploads(ctx, time.Hour)
+	assert.NoError(err)
+	assert.Equal(1, report.Aborted)
+	assert.Equal(int64(len(chunk)), report.Bytes)
+	assert.Equal(1, report.Kept)
+
+	// the live session can still be completed
+	_, err = repo.UploadChunk(ctx, live.Id, live.Offset, bytes.NewReader(chunk), int64(len(chunk)))
+	assert.NoError(err)
+	assert.NoError(repo.AbortUpload(ctx, live.Id))
+}
+
+func TestTransactions_MoveBetweenTables(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	suffix := uuid.New().String()
+	T_DRAFTS := schema.NewTable(DATABASE, "drafts-"+suffix, []string{"Name"})
+	T_PUBLISHED := schema.NewTable(DATABASE, "published-"+suffix, []string{"Name"})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft := &Account{Id: uuid.New().String(), Name: "release notes"}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_DRAFTS, draft)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, etag, err := min.Move[Account](ctx, repo, &tx, T_DRAFTS, T_PUBLISHED, draft.Id)
+	assert.NoError(err)
+	assert.Equal(draft, moved)
+	// it can be changed further, within the same transaction
+	moved.Name = "Release Notes"
+	_, err = repo.UpdateTable(ctx, &tx, T_PUBLISHED, moved, etag)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	named := func(table schema.Table, name string) []*Account {
+		tx := schema.NewReadOnlyTransaction(10 * time.Second)
+		accounts := []*Account{}
+		_, err := min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(table).WhereIndexedFieldEquals("Name", name).Find(&accounts)
+		assert.NoError(err)
+		return accounts
+	}
+	assert.Empty(named(T_DRAFTS, "release notes"))
+	if published := named(T_PUBLISHED, "Release Notes"); assert.Len(published, 1) {
+		assert.Equal(draft.Id, published[0].Id)
+	}
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_DRAFTS).WhereIdEquals(draft.Id).Find(&Account{})
+	assert.ErrorIs(err, min.NoSuchKeyError)
+
+	// it is no longer a draft
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = min.Move[Account](ctx, repo, &tx, T_DRAFTS, T_PUBLISHED, draft.Id)
+	assert.ErrorIs(err, min.NoSuchKeyError)
+	_, _, err = min.Move[Account](ctx, repo, &tx, T_PUBLISHED, T_PUBLISHED, draft.Id)
+	assert.Error(err)
+	assert.Empty(repo.Rollback(ctx, &tx))
+}
+
+type catalogedAsset struct {
+	Id    string
+	Links []schema.ExternalLink
+}
+
+func TestTransactions_VerifyLinksDetectsDriftOfExternalObjects(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ASSET := schema.NewTable(DATABASE, "asset-"+uuid.New().String(), []string{})
+
+	content := "version 1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logo.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+	key := "external/" + uuid.New().String()
+	_, err := repo.Client.PutObject(ctx, repo.BucketName, key, strings.NewReader("owned elsewhere"), -1, m.PutObjectOptions{})
+	assert.NoError(err)
+
+	_, err = repo.PinExternalLink(ctx, server.URL+"/logo.png")
+	assert.ErrorContains(err, "is not allowed")
+	repo.AllowExternalLinkOrigins("s3://"+repo.BucketName, server.URL)
+
+	pinnedObject, err := repo.PinExternalLink(ctx, fmt.Sprintf("s3://%s/%s", repo.BucketName, key))
+	assert.NoError(err)
+	assert.True(pinnedObject.Pinned())
+	pinnedUrl, err := repo.PinExternalLink(ctx, server.URL+"/logo.png")
+	assert.NoError(err)
+	unpinned, err := schema.NewExternalLink(server.URL+"/missing.png", "")
+	assert.NoError(err)
+	_, err = repo.PinExternalLink(ctx, server.URL+"/missing.png")
+	assert.True(errors.Is(err, min.NoSuchKeyError))
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset := &catalogedAsset{Id: uuid.New().String(), Links: []schema.ExternalLink{pinnedObject, pinnedUrl, unpinned}}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ASSET, asset); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	verification, err := min.VerifyLinks[catalogedAsset](ctx, repo, T_ASSET, "Links")
+	assert.NoError(err)
+	assert.Equal(1, verification.Records)
+	assert.Equal(3, verification.Links)
+	assert.Equal([]min.LinkIssue{{Kind: min.LINK_ISSUE_MISSING, Id: asset.Id, Field: "Links", Link: unpinned}}, verification.Issues)
+
+	// changed and removed by their owners
+	content = "version 2"
+	assert.NoError(repo.Client.RemoveObject(ctx, repo.BucketName, key, m.RemoveObjectOptions{}))
+
+	verification, err = min.VerifyLinks[catalogedAsset](ctx, repo, T_ASSET, "Links")
+	assert.NoError(err)
+	assert.Len(verification.Issues, 3)
+	assert.Equal(min.LINK_ISSUE_MISSING, verification.Issues[0].Kind)
+	assert.Equal(pinnedObject, verification.Issues[0].Link)
+	assert.Equal(min.LINK_ISSUE_DRIFTED, verification.Issues[1].Kind)
+	assert.Equal(pinnedUrl, verification.Issues[1].Link)
+	assert.NotEqual(pinnedUrl.SHA256, verification.Issues[1].Actual)
+	assert.Equal(min.LINK_ISSUE_MISSING, verification.Issues[2].Kind)
+
+	_, err = min.VerifyLinks[catalogedAsset](ctx, repo, T_ASSET, "Id")
+	assert.Error(err)
+}
+
+func TestTransactions_CapabilitiesOfTheBucket(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+
+	capabilities, err := repo.Capabilities(ctx)
+	assert.NoError(err)
+	// required by transactions, so Setup would have failed otherwise
+	assert.True(capabilities.Versioning)
+	assert.True(capabilities.Supports(min.CAPABILITY_VERSIONING))
+	assert.False(capabilities.Supports("teleportation"))
+
+	// the probe is not left behind
+	for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: min.CAPABILITIES_PROBE_FOLDER, Recursive: true}) {
+		assert.NoError(object.Err)
+		assert.Fail("the probe was left behind", object.Key)
+	}
+
+	again, err := repo.Capabilities(ctx)
+	assert.NoError(err)
+	assert.Equal(capabilities, again)
+
+	assert.NoError(repo.RequireCapabilities(ctx, min.CAPABILITY_VERSIONING))
+	err = repo.RequireCapabilities(ctx, min.CAPABILITY_VERSIONING, "teleportation")
+	assert.True(errors.Is(err, min.UnsupportedCapabilityError))
+	var unsupported *min.UnsupportedCapabilityErrorWithDetails
+	assert.True(errors.As(err, &unsupported))
+	assert.Equal("teleportation", unsupported.Capability)
+
+	// tables whose versions are retained are only written if the bucket can lock objects
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{}).WithStorage(schema.TableStorage{VersionRetention: time.Hour})
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: "John"})
+	if capabilities.ObjectLock {
+		assert.NoError(err)
+	} else {
+		assert.True(errors.Is(err, min.UnsupportedCapabilityError), err)
+	}
+	repo.Rollback(ctx, &tx)
+}
+
+func TestTransactions_IndexFanOutIsConfigurable(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{}).
+		WithFanOut("Name", schema.IndexFanOut{Length: schema.NO_FAN_OUT})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	index, _ := T_ACCOUNT.GetIndex("Name")
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, index.Path("John", account.Id), m.StatObjectOptions{})
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(index.Path("John", account.Id), index.PathPrefix()+"/john/"+string(DATABASE)+"___"))
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	accounts := []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").Find(&accounts)
+	assert.NoError(err)
+	assert.Len(accounts, 1)
+}
+
+func TestTransactions_CoveringIndexReturnsProjections(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "issue-"+uuid.New().String(), []string{}).
+		WithProjection("CreatedBy", "Title")
+	accountId := uuid.New().String()
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := &Issue{Id: uuid.New().String(), Title: "first", Body: "a long body", CreatedBy: accountId}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// own writes are found from the cache
+	issues := []*Issue{}
+	err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("CreatedBy", accountId).FindProjections(&issues)
+	assert.NoError(err)
+	assert.Equal([]*Issue{{Id: issue.Id, Title: "first"}}, issues)
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	issues = []*Issue{}
+	err = min.NewTypedQuery[Issue](repo, ctx, &readTx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("CreatedBy", accountId).FindProjections(&issues)
+	assert.NoError(err)
+	assert.Equal([]*Issue{{Id: issue.Id, Title: "first"}}, issues)
+
+	// updating the entity rewrites the projection, without hiding the entry from transactions that started before
+	time.Sleep(10 * time.Millisecond)
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue.Title = "second"
+	if _, err := repo.UpdateTable(ctx, &tx, T_ISSUE, issue, etag); err != nil {
+		t.Fatal(err)
+	}
+	issues = []*Issue{}
+	err = min.NewTypedQuery[Issue](repo, ctx, &readTx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("CreatedBy", accountId).FindProjections(&issues)
+	assert.NoError(err)
+	assert.Equal([]*Issue{{Id: issue.Id, Title: "first"}}, issues)
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	issues = []*Issue{}
+	err = min.NewTypedQuery[Issue](repo, ctx, &readTx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("CreatedBy", accountId).FindProjections(&issues)
+	assert.NoError(err)
+	assert.Equal([]*Issue{{Id: issue.Id, Title: "first"}}, issues, "the snapshot is unchanged")
+
+	laterTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	issues = []*Issue{}
+	err = min.NewTypedQuery[Issue](repo, ctx, &laterTx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("CreatedBy", accountId).FindProjections(&issues)
+	assert.NoError(err)
+	assert.Equal([]*Issue{{Id: issue.Id, Title: "second"}}, issues)
+
+	// indices which are not covering have no projections
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	err = min.NewTypedQuery[Account](repo, ctx, &laterTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").FindProjections(&[]*Account{})
+	assert.ErrorContains(err, "ADB-0147")
+}
+
+type payment struct {
+	Id     string    `json:"id"`
+	Amount string    `json:"amount"`
+	PaidAt time.Time `json:"paidAt"`
+}
+
+func TestTransactions_CodecNormalisesTimesAndDecimalIndicesAreExact(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_PAYMENT := schema.NewTable(DATABASE, "payment-"+uuid.New().String(), []string{}).
+		WithDecimalIndex("Amount").
+		WithTimeIndex("PaidAt").
+		WithCodec(schema.TableCodec{TimePrecision: time.Millisecond, TimeZone: "UTC"})
+
+	zurich, _ := time.LoadLocation("Europe/Zurich")
+	paidAt := time.Date(2026, 3, 14, 15, 30, 0, 123456789, zurich)
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments := []*payment{
+		{Id: uuid.New().String(), Amount: "0.10000000000000000001", PaidAt: paidAt},
+		{Id: uuid.New().String(), Amount: "0.1", PaidAt: paidAt},
+		{Id: uuid.New().String(), Amount: "-12.50", PaidAt: paidAt},
+	}
+	for _, p := range payments {
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_PAYMENT, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	// the caller holds what was written
+	assert.Equal(time.Date(2026, 3, 14, 14, 30, 0, 123000000, time.UTC), payments[0].PaidAt)
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	var read payment
+	_, err = min.NewTypedQuery[payment](repo, ctx, &readTx).SelectFromTable(T_PAYMENT).WhereIdEquals(payments[0].Id).Find(&read)
+	assert.NoError(err)
+	assert.Equal(*payments[0], read, "it round-trips exactly")
+
+	// decimals which a float64 cannot tell apart are indexed apart, and equal ones alike
+	found := []*payment{}
+	_, err = min.NewTypedQuery[payment](repo, ctx, &readTx).SelectFromTable(T_PAYMENT).WhereIndexedFieldEquals("Amount", "0.10").Find(&found)
+	assert.NoError(err)
+	assert.Len(found, 1)
+	assert.Equal(payments[1].Id, found[0].Id)
+
+	found = []*payment{}
+	_, err = min.NewTypedQuery[payment](repo, ctx, &readTx).SelectFromTable(T_PAYMENT).WhereIndexedFieldInRange("Amount", -20, 0.1).Find(&found)
+	assert.NoError(err)
+	assert.Len(found, 1)
+	assert.Equal(payments[2].Id, found[0].Id)
+
+	// queried times are normalised as written ones are
+	found = []*payment{}
+	_, err = min.NewTypedQuery[payment](repo, ctx, &readTx).SelectFromTable(T_PAYMENT).WhereIndexedFieldEquals("PaidAt", paidAt.Format(time.RFC3339Nano)).Find(&found)
+	assert.NoError(err)
+	assert.Len(found, 3)
+}
+
+type invoice struct {
+	Id     string         `json:"id"`
+	Amount schema.Decimal `json:"amount"`
+}
+
+func TestTransactions_DecimalFieldsAreCheckedAndIndexedExactly(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_INVOICE := schema.NewTable(DATABASE, "invoice-"+uuid.New().String(), []string{}).
+		WithDecimalField("Amount", 10, 2).
+		WithDecimalIndex("Amount")
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_INVOICE, &invoice{Id: uuid.New().String(), Amount: schema.MustDecimal("0.001")})
+	assert.ErrorIs(err, min.DecimalConstraintError)
+	assert.ErrorContains(err, "ADB-0149")
+	// entities which are maps, e.g. those of the shell, are checked alike
+	_, err = repo.InsertIntoTable(ctx, &tx, T_INVOICE, &map[string]any{"id": uuid.New().String(), "amount": 0.001})
+	assert.ErrorIs(err, min.DecimalConstraintError)
+
+	invoices := []*invoice{
+		{Id: uuid.New().String(), Amount: schema.MustDecimal("99999999.99")},
+		{Id: uuid.New().String(), Amount: schema.MustDecimal("0.10")},
+		{Id: uuid.New().String(), Amount: schema.MustDecimal("-5")},
+	}
+	for _, i := range invoices {
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_INVOICE, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	var read invoice
+	_, err = min.NewTypedQuery[invoice](repo, ctx, &readTx).SelectFromTable(T_INVOICE).WhereIdEquals(invoices[0].Id).Find(&read)
+	assert.NoError(err)
+	assert.Equal(*invoices[0], read)
+
+	found := []*invoice{}
+	_, err = min.NewTypedQuery[invoice](repo, ctx, &readTx).SelectFromTable(T_INVOICE).WhereIndexedFieldInRange("Amount", 0, 1e9).Find(&found)
+	assert.NoError(err)
+	assert.Len(found, 2)
+
+	found = []*invoice{}
+	_, err = min.NewTypedQuery[invoice](repo, ctx, &readTx).SelectFromTable(T_INVOICE).WhereIndexedFieldEquals("Amount", "0.1").Find(&found)
+	assert.NoError(err)
+	assert.Len(found, 1)
+}
+
+func TestTransactions_IndexEntriesCarryTheETagOfTheirRecord(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_PLAIN := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), nil).WithRecordETags("Name")
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainEtag, err := repo.InsertIntoTable(ctx, &tx, T_PLAIN, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_PLAIN).WhereIndexedFieldEquals("Name", "John").FindETags()
+	assert.ErrorContains(err, "ADB-0233")
+	// unknown to the transaction which wrote the record
+	etags, err := min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").FindETags()
+	assert.NoError(err)
+	assert.Equal(map[string]*string{account.Id: nil}, etags)
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	index, _ := T_ACCOUNT.GetIndex("Name")
+	info, err := repo.Client.StatObject(ctx, repo.BucketName, index.Path("John", account.Id), m.StatObjectOptions{})
+	assert.NoError(err)
+	assert.Equal(*etag, info.UserMetadata[schema.RECORD_ETAG])
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	etags, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").FindETags()
+	assert.NoError(err)
+	assert.Equal(map[string]*string{account.Id: etag}, etags)
+
+	// entries which are kept by an update carry the new ETag, but only once the snapshot contains it
+	time.Sleep(10 * time.Millisecond)
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := repo.UpdateTable(ctx, &tx, T_ACCOUNT, account, etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.UpdateTable(ctx, &tx, T_PLAIN, account, plainEtag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	// entries of indices which neither project fields nor carry ETags are not rewritten
+	plainIndex, _ := T_PLAIN.GetIndex("Name")
+	versions := 0
+	for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: plainIndex.Path("John", account.Id), WithVersions: true}) {
+		assert.NoError(object.Err)
+		versions++
+	}
+	assert.Equal(1, versions)
+	etags, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").FindETags()
+	assert.NoError(err)
+	assert.Equal(map[string]*string{account.Id: nil}, etags)
+
+	laterTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	etags, err = min.NewTypedQuery[Account](repo, ctx, &laterTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").FindETags()
+	assert.NoError(err)
+	assert.Equal(map[string]*string{account.Id: updated}, etags)
+}
+
+func TestTransactions_StringRangesAreInTheOrderOfTheLocale(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{}).
+		WithCollation("Name", schema.IndexCollation{Locale: "sv", Case: schema.CASE_INSENSITIVE})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Örjan", "adam", "Zacke", "Åsa", "Bertil", ""} {
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	names := func(from string, to string) []string {
+		readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+		accounts := []*Account{}
+		_, err := min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldInStringRange("Name", from, to).Find(&accounts)
+		assert.NoError(err)
+		names := make([]string, len(accounts))
+		for i, account := range accounts {
+			names[i] = account.Name
+		}
+		return names
+	}
+	// in swedish, å, ä and ö are after z
+	assert.Equal([]string{"adam", "Bertil", "Zacke", "Åsa", "Örjan"}, names("", ""))
+	assert.Equal([]string{"Bertil", "Zacke"}, names("b", "å"))
+	assert.Equal([]string{"Zacke", "Åsa", "Örjan"}, names("z", ""))
+	assert.Equal([]string{"adam"}, names("", "B"))
+
+	T_NUMBERS := schema.NewTable(DATABASE, "numbers-"+uuid.New().String(), []string{}).WithNumericIndex("Name")
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_NUMBERS).WhereIndexedFieldInStringRange("Name", "a", "b").Find(&[]*Account{})
+	assert.ErrorContains(err, "ADB-0150")
+}
+
+func TestTransactions_SparseIndicesHaveNoEntriesForNulls(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{}).WithSparseIndex("Name")
+	index := T_ACCOUNT.Indices[0]
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := &Account{Id: uuid.New().String(), Name: "John"}
+	unnamed := &Account{Id: uuid.New().String(), Name: ""}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, named); err != nil {
+		t.Fatal(err)
+	}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, unnamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// no entries are written to the folder of nulls
+	count := 0
+	for object := range repo.Client.ListObjects(ctx, repo.BucketName, m.ListObjectsOptions{Prefix: index.NullPathNoId() + "/", Recursive: true}) {
+		assert.NoError(object.Err)
+		count++
+	}
+	assert.Equal(0, count)
+
+	// the record without an entry does not make the index inconsistent
+	counts, err := repo.VerifyIndex(ctx, T_ACCOUNT, "Name", 0)
+	assert.NoError(err)
+	assert.Equal(min.IndexCounts{Records: 2, Entries: 1, Sparse: true}, counts)
+	assert.True(counts.Matches())
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	accounts := []*Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldIsNotNull("Name").Find(&accounts)
+	assert.NoError(err)
+	if assert.Len(accounts, 1) {
+		assert.Equal(named.Id, accounts[0].Id)
+	}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldIsNull("Name").Find(&accounts)
+	assert.ErrorContains(err, "ADB-0151")
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "").Find(&accounts)
+	assert.ErrorContains(err, "ADB-0151")
+
+	// once the field is set, the entity has an entry like any other
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unnamed.Name = "Jane"
+	if _, err := repo.UpdateTable(ctx, &tx, T_ACCOUNT, unnamed, etag); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	readTx = schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[Account](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "Jane").Find(&accounts)
+	assert.NoError(err)
+	if assert.Len(accounts, 1) {
+		assert.Equal(unnamed.Id, accounts[0].Id)
+	}
+}
+
+func TestTransactions_SoftSchemaKeepsUnknownFieldsWhenUpdating(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	// written by a newer version of the application, which knows the email of an account
+	type accountWithEmail struct {
+		Id    string `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"}).WithSoftSchema()
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer := &accountWithEmail{Id: uuid.New().String(), Name: "John", Email: "john@example.com"}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, newer); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// an older version reads it, without the email, and writes it back
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	older := &Account{}
+	etag, err := min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIdEquals(newer.Id).Find(older)
+	if err != nil {
+		t.Fatal(err)
+	}
+	older.Name = "Johnny"
+	if _, err := repo.UpdateTable(ctx, &tx, T_ACCOUNT, older, etag); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	read := &accountWithEmail{}
+	_, err = min.NewTypedQuery[accountWithEmail](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIdEquals(newer.Id).Find(read)
+	assert.NoError(err)
+	assert.Equal("Johnny", read.Name)
+	assert.Equal("john@example.com", read.Email)
+
+	// upserts keep them too, and validators see them, since they check what is written
+	validated := []string{}
+	unregister := schema.RegisterTableStepValidator(T_ACCOUNT, func(tx *schema.Transaction, step *schema.TransactionStep, data []byte) error {
+		validated = append(validated, string(data))
+		return nil
+	})
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	older.Name = "Jack"
+	if _, err := repo.UpdateTable(ctx, &tx, T_ACCOUNT, older, new(string)); err != nil {
+		t.Fatal(err)
+	}
+	unregister()
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if assert.Len(validated, 1) {
+		assert.Contains(validated[0], "john@example.com")
+	}
+	readTx = schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[accountWithEmail](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIdEquals(newer.Id).Find(read)
+	assert.NoError(err)
+	assert.Equal("Jack", read.Name)
+	assert.Equal("john@example.com", read.Email)
+
+	// the newer version can still clear it
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err = min.NewTypedQuery[accountWithEmail](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIdEquals(newer.Id).Find(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read.Email = ""
+	if _, err := repo.UpdateTable(ctx, &tx, T_ACCOUNT, read, etag); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	readTx = schema.NewReadOnlyTransaction(10 * time.Second)
+	_, err = min.NewTypedQuery[accountWithEmail](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIdEquals(newer.Id).Find(read)
+	assert.NoError(err)
+	assert.Equal("", read.Email)
+}
+
+func TestTransactions_ClientChangeSetsAreMergedWithTheChangesOfOthers(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "issue-"+uuid.New().String(), []string{})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := &Issue{Id: uuid.New().String(), Title: "first", Body: "a body", CreatedBy: "john"}
+	baseETag, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// someone else changes the title and the creator, while the client is offline
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	online := *issue
+	online.Title = "second"
+	online.CreatedBy = "jane"
+	if _, err := repo.UpdateTable(ctx, &tx, T_ISSUE, &online, baseETag); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the client changed the title too, but differently, as well as the body, and made the same change to the creator
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeSet := min.ClientChangeSet{Id: issue.Id, BaseETag: *baseETag, Changes: map[string]json.RawMessage{
+		"title":     json.RawMessage(`"third"`),
+		"body":      json.RawMessage(`"a longer body"`),
+		"createdBy": json.RawMessage(`"jane"`),
+	}}
+	merged, etag, conflicts, err := min.ApplyClientChangeSet[Issue](ctx, repo, &tx, T_ISSUE, changeSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal("second", merged.Title)
+	assert.Equal("a longer body", merged.Body)
+	assert.Equal("jane", merged.CreatedBy)
+	if assert.Len(conflicts, 1) {
+		assert.Equal("title", conflicts[0].Field)
+		assert.JSONEq(`"first"`, string(conflicts[0].Base))
+		assert.JSONEq(`"second"`, string(conflicts[0].Current))
+		assert.JSONEq(`"third"`, string(conflicts[0].Client))
+	}
+
+	// once the user resolved the conflict, it is sent again, based on the merged version
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeSet = min.ClientChangeSet{Id: issue.Id, BaseETag: *etag, Changes: map[string]json.RawMessage{"title": json.RawMessage(`"third"`)}}
+	merged, _, conflicts, err = min.ApplyClientChangeSet[Issue](ctx, repo, &tx, T_ISSUE, changeSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	assert.Empty(conflicts)
+	assert.Equal("third", merged.Title)
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeSet = min.ClientChangeSet{Id: issue.Id, BaseETag: *etag, Changes: map[string]json.RawMessage{"priority": json.RawMessage(`1`)}}
+	_, _, _, err = min.ApplyClientChangeSet[Issue](ctx, repo, &tx, T_ISSUE, changeSet)
+	assert.ErrorContains(err, "ADB-0153")
+	repo.Rollback(ctx, &tx)
+}
+
+func TestTransactions_TableForDerivesIndicesFromTags(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.TableFor[TaggedAccount](DATABASE)
+	assert.Equal("tagged-account", T_ACCOUNT.Name)
+	T_ACCOUNT = T_ACCOUNT.WithName(T_ACCOUNT.Name + "-" + uuid.New().String())
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &TaggedAccount{Id: uuid.New().String(), Email: "john@example.com", Name: "John"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &TaggedAccount{Id: uuid.New().String(), Email: "john@example.com", Name: "Johnny"})
+	assert.ErrorIs(err, min.UniqueViolationError)
+	repo.Rollback(ctx, &tx)
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &TaggedAccount{Id: uuid.New().String(), Email: "jane@example.com", Name: "Jane"}); err != nil {
+		t.Fatal(err)
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	accounts := []*TaggedAccount{}
+	_, err = min.NewTypedQuery[TaggedAccount](repo, ctx, &readTx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "Jane").Find(&accounts)
+	assert.NoError(err)
+	assert.Len(accounts, 1)
+}
+
+func TestTransactions_BundlesAreEncryptedSignedAndVerified(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "bundle-account-"+uuid.New().String(), []string{"Name"})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"John", "Jane"} {
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, &Account{Id: uuid.New().String(), Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := bytes.Buffer{}
+	count, err := min.ExportBundle(ctx, repo, T_ACCOUNT, &bundle, min.BundleOptions{EncryptionKey: key, SigningKey: privateKey})
+	assert.NoError(err)
+	assert.Equal(2, count)
+	assert.NotContains(bundle.String(), "John") // encrypted
+
+	names := make([]string, 0)
+	header, err := min.VerifyBundle(bytes.NewReader(bundle.Bytes()), min.BundleVerifyOptions{DecryptionKey: key, PublicKey: publicKey}, func(object json.RawMessage) error {
+		var account Account
+		if err := json.Unmarshal(object, &account); err != nil {
+			return err
+		}
+		names = append(names, account.Name)
+		return nil
+	})
+	assert.NoError(err)
+	assert.True(header.Encrypted)
+	assert.True(header.Signed)
+	assert.Equal(T_ACCOUNT.Name, header.Table)
+	assert.ElementsMatch([]string{"John", "Jane"}, names)
+
+	ignore := func(json.RawMessage) error { return nil }
+	tampered := bytes.Clone(bundle.Bytes())
+	tampered[len(tampered)/2] ^= 1
+	_, err = min.VerifyBundle(bytes.NewReader(tampered), min.BundleVerifyOptions{DecryptionKey: key, PublicKey: publicKey}, ignore)
+	assert.ErrorIs(err, min.InvalidBundleError)
+
+	_, err = min.VerifyBundle(bytes.NewReader(bundle.Bytes()[:bundle.Len()-20]), min.BundleVerifyOptions{DecryptionKey: key, PublicKey: publicKey}, ignore)
+	assert.ErrorIs(err, min.InvalidBundleError)
+
+	otherPublicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, err = min.VerifyBundle(bytes.NewReader(bundle.Bytes()), min.BundleVerifyOptions{DecryptionKey: key, PublicKey: otherPublicKey}, ignore)
+	assert.ErrorIs(err, min.InvalidBundleError)
+
+	_, err = min.VerifyBundle(bytes.NewReader(bundle.Bytes()), min.BundleVerifyOptions{}, ignore)
+	assert.ErrorIs(err, min.InvalidBundleError) // no key
+}
+
+func TestTransactions_ForeignKeysRestrictCascadeOrSetNullWhenDeleting(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+
+	// the fields of entities which are maps cannot be checked, so their foreign keys are not enabled
+	T_MAP := schema.NewTable(DATABASE, "fk-map-"+uuid.New().String(), []string{"Title"}).WithForeignKey("CreatedBy", schema.NewTable(DATABASE, "fk-account", []string{"Name"}), schema.ON_DELETE_SET_NULL)
+	assert.Panics(func() { min.EnableForeignKeys[map[string]any](repo, T_MAP) })
+
+	for _, onDelete := range []schema.OnDelete{schema.ON_DELETE_RESTRICT, schema.ON_DELETE_CASCADE, schema.ON_DELETE_SET_NULL} {
+		T_ACCOUNT := schema.NewTable(DATABASE, "fk-account-"+uuid.New().String(), []string{"Name"})
+		T_ISSUE := schema.NewTable(DATABASE, "fk-issue-"+uuid.New().String(), []string{"Title"}).WithForeignKey("CreatedBy", T_ACCOUNT, onDelete)
+		min.EnableForeignKeys[Issue](repo, T_ISSUE)
+
+		tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account := &Account{Id: uuid.New().String(), Name: "John"}
+		etag, err := repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issue := &Issue{Id: uuid.New().String(), Title: "broken", CreatedBy: account.Id}
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue); err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(repo.Commit(ctx, &tx))
+
+		tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.DeleteFromTable(ctx, &tx, T_ACCOUNT, account, etag)
+		if onDelete == schema.ON_DELETE_RESTRICT {
+			assert.ErrorIs(err, min.ReferencedError)
+			var referenced *min.ReferencedErrorWithDetails
+			if assert.ErrorAs(err, &referenced) {
+				assert.Equal([]string{issue.Id}, referenced.Ids)
+			}
+			assert.Empty(repo.Rollback(ctx, &tx))
+			continue
+		}
+		assert.NoError(err)
+		assert.Empty(repo.Commit(ctx, &tx))
+
+		tx = schema.NewReadOnlyTransaction(10 * time.Second)
+		found := &Issue{}
+		_, err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIdEquals(issue.Id).Find(found)
+		if onDelete == schema.ON_DELETE_CASCADE {
+			assert.ErrorIs(err, min.NoSuchKeyError)
+		} else {
+			assert.NoError(err)
+			assert.Equal("", found.CreatedBy)
+			assert.Equal("broken", found.Title)
+		}
+	}
+}
+
+func TestTransactions_ForeignKeysCascadeOnceThroughCyclesAndSelfReferences(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "fk-issue-"+uuid.New().String(), []string{"Title"})
+	T_ISSUE = T_ISSUE.WithForeignKey("CreatedBy", T_ISSUE, schema.ON_DELETE_CASCADE)
+	min.EnableForeignKeys[Issue](repo, T_ISSUE)
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a and b reference each other, and c references itself
+	a := &Issue{Id: uuid.New().String(), Title: "a"}
+	b := &Issue{Id: uuid.New().String(), Title: "b", CreatedBy: a.Id}
+	c := &Issue{Id: uuid.New().String(), Title: "c"}
+	a.CreatedBy, c.CreatedBy = b.Id, c.Id
+	etags := map[string]*string{}
+	for _, issue := range []*Issue{a, b, c} {
+		if etags[issue.Id], err = repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_ISSUE, a, etags[a.Id]))
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_ISSUE, c, etags[c.Id]))
+	deleted := []string{}
+	for _, step := range tx.Steps {
+		if step.Type == schema.STEP_DELETE_DATA {
+			deleted = append(deleted, step.Path)
+		}
+	}
+	assert.ElementsMatch([]string{T_ISSUE.Path(a.Id), T_ISSUE.Path(b.Id), T_ISSUE.Path(c.Id)}, deleted)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	for _, issue := range []*Issue{a, b, c} {
+		_, err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIdEquals(issue.Id).Find(&Issue{})
+		assert.ErrorIs(err, min.NoSuchKeyError, issue.Title)
+	}
+}
+
+func TestTransactions_ForeignKeysRollBackTheCascadeOfADeleteWhichIsRestrictedAfterwards(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "fk-issue-"+uuid.New().String(), []string{"Title"})
+	T_ISSUE = T_ISSUE.WithForeignKey("CreatedBy", T_ISSUE, schema.ON_DELETE_CASCADE)
+	T_LOCK := schema.NewTable(DATABASE, "fk-lock-"+uuid.New().String(), []string{"Title"})
+	T_LOCK = T_LOCK.WithForeignKey("CreatedBy", T_ISSUE, schema.ON_DELETE_RESTRICT)
+	// the cascade is enabled first, so that it is followed before the restriction
+	min.EnableForeignKeys[Issue](repo, T_ISSUE)
+	min.EnableForeignKeys[Issue](repo, T_LOCK)
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Issue{Id: uuid.New().String(), Title: "a"}
+	b := &Issue{Id: uuid.New().String(), Title: "b", CreatedBy: a.Id}
+	etagA, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.InsertIntoTable(ctx, &tx, T_ISSUE, b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.InsertIntoTable(ctx, &tx, T_LOCK, &Issue{Id: uuid.New().String(), Title: "lock", CreatedBy: a.Id}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.DeleteFromTable(ctx, &tx, T_ISSUE, a, etagA)
+	assert.ErrorIs(err, min.ReferencedError)
+	// the steps of b, which the cascade deleted, are rolled back, so that committing deletes nothing
+	assert.Empty(tx.Steps)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	for _, issue := range []*Issue{a, b} {
+		_, err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIdEquals(issue.Id).Find(&Issue{})
+		assert.NoError(err, issue.Title)
+	}
+}
+
+func TestTransactions_ComputedIndexOfTheDomainOfAnEmailAddress(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "computed-issue-"+uuid.New().String(), []string{"Title"}).
+		WithComputedIndex("CreatedByDomain", schema.Computed(func(issue *Issue) string {
+			_, domain, _ := strings.Cut(issue.CreatedBy, "@")
+			return strings.ToLower(domain)
+		}))
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, createdBy := range []string{"john@Example.com", "jane@example.COM", "someone@example.org", "anonymous"} {
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, &Issue{Id: uuid.New().String(), Title: "broken", CreatedBy: createdBy}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	var issues []*Issue
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("CreatedByDomain", "example.com").Find(&issues)
+	assert.NoError(err)
+	createdBy := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		createdBy = append(createdBy, issue.CreatedBy)
+	}
+	assert.ElementsMatch([]string{"john@Example.com", "jane@example.COM"}, createdBy)
+
+	// the value is not materialised into the document
+	if assert.NotEmpty(issues) {
+		var document map[string]any
+		_, err = min.NewTypedQuery[map[string]any](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIdEquals(issues[0].Id).Find(&document)
+		assert.NoError(err)
+		assert.NotContains(document, "CreatedByDomain")
+	}
+}
+
+func TestTransactions_PinnedRecordsAreOnlyWrittenByTransactionsWhichOverridePins(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("pin-tests")
+	T_SETTING := schema.NewTable(DATABASE, "setting-"+uuid.New().String(), []string{"Name"}).WithPins()
+
+	setting := &Account{Id: uuid.New().String(), Name: "maintenance-window"}
+	other := &Account{Id: uuid.New().String(), Name: "theme"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_SETTING, setting)
+	assert.NoError(err)
+	otherETag, err := repo.InsertIntoTable(ctx, &tx, T_SETTING, other)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	assert.Error(repo.Pin(ctx, T_SETTING, setting.Id, ""), "a reason is required")
+	assert.Error(repo.Pin(ctx, schema.NewTable(DATABASE, "unpinnable", []string{"Name"}), setting.Id, "critical"))
+	assert.NoError(repo.Pin(ctx, T_SETTING, setting.Id, "read by every service at startup"))
+	pin, err := repo.GetPin(ctx, T_SETTING, setting.Id)
+	assert.NoError(err)
+	assert.Equal("read by every service at startup", pin.Reason)
+	pin, err = repo.GetPin(ctx, T_SETTING, other.Id)
+	assert.NoError(err)
+	assert.Nil(pin)
+
+	// neither updated nor deleted, but the others are
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setting.Name = "changed"
+	_, err = repo.UpdateTable(ctx, &tx, T_SETTING, setting, etag)
+	var pinned *min.PinnedErrorWithDetails
+	if assert.True(errors.As(err, &pinned), err) {
+		assert.Equal(setting.Id, pinned.Pin.Id)
+	}
+	err = repo.DeleteFromTable(ctx, &tx, T_SETTING, setting, etag)
+	assert.True(errors.Is(err, min.PinnedError), err)
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_SETTING, other, otherETag))
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// unless the transaction overrides pins
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.OverridePins = true
+	etag, err = repo.UpdateTable(ctx, &tx, T_SETTING, setting, etag)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// or it is unpinned
+	assert.NoError(repo.Unpin(ctx, T_SETTING, setting.Id))
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_SETTING, setting, etag))
+	assert.Empty(repo.Commit(ctx, &tx))
+}
+
+func TestTransactions_TablesWithStorageOptionsAreWrittenAsTheySay(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("storage-tests")
+	T_ISSUE := schema.NewTable(DATABASE, "issue-"+uuid.New().String(), []string{"Title"}).
+		WithStorage(schema.TableStorage{ContentType: "application/vnd.abstratium.issue+json", Compression: schema.STORAGE_COMPRESSION_GZIP})
+	assert.Panics(func() { T_ISSUE.WithStorage(schema.TableStorage{Compression: "zstd"}) })
+	assert.Panics(func() { T_ISSUE.WithStorage(schema.TableStorage{Encryption: schema.STORAGE_ENCRYPTION_SSE_KMS}) })
+
+	issue := &Issue{Id: uuid.New().String(), Title: "compressible", Body: strings.Repeat("compressible ", 100)}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_ISSUE, issue)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// compressed, and with the content type of the table
+	info, err := repo.Client.StatObject(ctx, repo.BucketName, T_ISSUE.Path(issue.Id), m.StatObjectOptions{})
+	assert.NoError(err)
+	assert.Equal("application/vnd.abstratium.issue+json", info.ContentType)
+	assert.Equal("gzip", info.Metadata.Get("Content-Encoding"))
+	assert.Less(info.Size, int64(len(issue.Body)))
+
+	// but read as it was written, by id and by index
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Issue
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIdEquals(issue.Id).Find(&read)
+	assert.NoError(err)
+	assert.Equal(*issue, read)
+	var found []*Issue
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIndexedFieldEquals("Title", issue.Title).Find(&found)
+	assert.NoError(err)
+	if assert.Len(found, 1) {
+		assert.Equal(*issue, *found[0])
+	}
+
+	// updates are compressed too, and deletes leave the tombstone empty
+	issue.Body = "short"
+	etag, err = repo.UpdateTable(ctx, &tx, T_ISSUE, issue, etag)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = min.NewTypedQuery[Issue](repo, ctx, &tx).SelectFromTable(T_ISSUE).WhereIdEquals(issue.Id).Find(&read)
+	assert.NoError(err)
+	assert.Equal("short", read.Body)
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_ISSUE, issue, etag))
+	assert.Empty(repo.Commit(ctx, &tx))
+	info, err = repo.Client.StatObject(ctx, repo.BucketName, T_ISSUE.Path(issue.Id), m.StatObjectOptions{})
+	if err == nil {
+		assert.Equal(int64(0), info.Size)
+	}
+}
+
+func TestTransactions_EnumFieldsAreCheckedAndIndexedByTheirCodes(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type OrderStatus string
+	type Order struct {
+		Id     string      `json:"id"`
+		Status OrderStatus `json:"status"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ORDER := schema.NewTable(DATABASE, "order-"+uuid.New().String(), []string{"Status"}).
+		WithEnumField("Status", schema.EnumValue{Value: "AWAITING_PAYMENT", Code: "ap"}, schema.EnumValue{Value: "SHIPPED", Code: "s"})
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ORDER, &Order{Id: uuid.New().String(), Status: "LOST"})
+	var violated *min.EnumConstraintErrorWithDetails
+	if assert.True(errors.As(err, &violated), err) {
+		assert.Equal("LOST", violated.Value)
+		assert.Equal("Status", violated.Enum.Field)
+	}
+	// entities which are maps, e.g. those of the shell, are checked alike
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ORDER, &map[string]any{"id": uuid.New().String(), "status": "LOST"})
+	if assert.True(errors.As(err, &violated), err) {
+		assert.Equal("LOST", violated.Value)
+	}
+
+	awaiting := &Order{Id: uuid.New().String(), Status: "AWAITING_PAYMENT"}
+	shipped := &Order{Id: uuid.New().String(), Status: "SHIPPED"}
+	unknown := &Order{Id: uuid.New().String()}
+	for _, o := range []*Order{awaiting, shipped, unknown} {
+		if _, err := repo.InsertIntoTable(ctx, &tx, T_ORDER, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := repo.Commit(ctx, &tx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the paths contain the codes, which are decoded to the values
+	index := T_ORDER.Indices[0]
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, index.Path("SHIPPED", shipped.Id), m.StatObjectOptions{})
+	assert.NoError(err)
+	assert.NotContains(index.Path("SHIPPED", shipped.Id), "SHIPPED")
+	value, err := T_ORDER.EnumField("Status").Value("s")
+	assert.NoError(err)
+	assert.Equal("SHIPPED", value)
+
+	// and are queried by value, so that a code is not a value
+	readTx := schema.NewReadOnlyTransaction(10 * time.Second)
+	found := []*Order{}
+	_, err = min.NewTypedQuery[Order](repo, ctx, &readTx).SelectFromTable(T_ORDER).WhereIndexedFieldEquals("Status", "SHIPPED").Find(&found)
+	assert.NoError(err)
+	if assert.Len(found, 1) {
+		assert.Equal(*shipped, *found[0])
+	}
+	found = []*Order{}
+	_, err = min.NewTypedQuery[Order](repo, ctx, &readTx).SelectFromTable(T_ORDER).WhereIndexedFieldEquals("Status", "s").Find(&found)
+	assert.NoError(err)
+	assert.Empty(found)
+	found = []*Order{}
+	_, err = min.NewTypedQuery[Order](repo, ctx, &readTx).SelectFromTable(T_ORDER).WhereIndexedFieldMatches("Status", "^AWAITING").Find(&found)
+	assert.NoError(err)
+	if assert.Len(found, 1) {
+		assert.Equal(*awaiting, *found[0])
+	}
+}
+
+func TestTransactions_TablesWithCompositeKeysIdentifyEntitiesByThem(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	type Order struct {
+		TenantId string `json:"tenantId"`
+		OrderId  int    `json:"orderId"`
+		Status   string `json:"status"`
+	}
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ORDER := schema.NewTable(DATABASE, "order-"+uuid.New().String(), []string{"Status"}).WithCompositeKey("TenantId", "OrderId")
+
+	acme := &Order{TenantId: "acme", OrderId: 42, Status: "open"}
+	globex := &Order{TenantId: "globex", OrderId: 42, Status: "open"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := repo.InsertIntoTable(ctx, &tx, T_ORDER, acme)
+	assert.NoError(err)
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ORDER, globex)
+	assert.NoError(err)
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ORDER, &Order{OrderId: 7})
+	assert.ErrorContains(err, "ADB-0268")
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	id, err := schema.EncodeCompositeKey("acme", "42")
+	assert.NoError(err)
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, T_ORDER.Path(id), m.StatObjectOptions{})
+	assert.NoError(err)
+
+	// the same key is a duplicate
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ORDER, &Order{TenantId: "acme", OrderId: 42, Status: "closed"})
+	assert.ErrorIs(err, min.DuplicateKeyError)
+	assert.Empty(repo.Rollback(ctx, &tx))
+
+	// and entities are found by it, and by their indices, which name them by it
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Order
+	_, err = min.NewTypedQuery[Order](repo, ctx, &tx).SelectFromTable(T_ORDER).WhereIdEquals(id).Find(&read)
+	assert.NoError(err)
+	assert.Equal(*acme, read)
+	found := []*Order{}
+	etags, err := min.NewTypedQuery[Order](repo, ctx, &tx).SelectFromTable(T_ORDER).WhereIndexedFieldEquals("Status", "open").Find(&found)
+	assert.NoError(err)
+	assert.Len(found, 2)
+	assert.Contains(*etags, id)
+
+	acme.Status = "closed"
+	etag, err = repo.UpdateTable(ctx, &tx, T_ORDER, acme, etag)
+	assert.NoError(err)
+	assert.NoError(repo.DeleteFromTable(ctx, &tx, T_ORDER, acme, etag))
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = []*Order{}
+	_, err = min.NewTypedQuery[Order](repo, ctx, &tx).SelectFromTable(T_ORDER).WhereIndexedFieldEquals("Status", "open").Find(&found)
+	assert.NoError(err)
+	if assert.Len(found, 1) {
+		assert.Equal(*globex, *found[0])
+	}
+	assert.Empty(repo.Rollback(ctx, &tx))
+}
+
+func TestTransactions_TenantsAreIsolatedAndCanBeDeleted(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-"+uuid.New().String(), []string{"Name"})
+	acme := schema.NewTenant("acme-" + uuid.New().String())
+	T_ACME_ACCOUNT := T_ACCOUNT.WithTenant(acme)
+
+	account := &Account{Id: uuid.New().String(), Name: "John"}
+	tx, err := repo.BeginTransactionForTenant(ctx, acme, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+	assert.ErrorContains(err, "ADB-0170")
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACME_ACCOUNT, account)
+	assert.NoError(err)
+	var transactions []schema.Transaction
+	assert.NoError(repo.GetTransactionsInProgress(ctx, &transactions))
+	assert.Len(transactions, 1)
+	_, err = repo.DeleteTenant(ctx, acme)
+	assert.ErrorContains(err, "ADB-0253")
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// the record is only visible to the tenant
+	tx, err = repo.BeginReadOnlyTransactionForTenant(acme, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accounts []*Account
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACME_ACCOUNT).WhereIndexedFieldEquals("Name", "John").Find(&accounts)
+	assert.NoError(err)
+	assert.Len(accounts, 1)
+	tx, err = repo.BeginReadOnlyTransaction(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts = nil
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "John").Find(&accounts)
+	assert.NoError(err)
+	assert.Empty(accounts)
+
+	tenants, err := repo.ListTenants(ctx)
+	assert.NoError(err)
+	assert.Contains(tenants, acme)
+
+	removed, err := repo.DeleteTenant(ctx, acme)
+	assert.NoError(err)
+	assert.Positive(removed)
+	tenants, err = repo.ListTenants(ctx)
+	assert.NoError(err)
+	assert.NotContains(tenants, acme)
+	_, err = repo.Client.StatObject(ctx, repo.BucketName, T_ACME_ACCOUNT.Path(account.Id), m.StatObjectOptions{})
+	assert.Error(err)
+}
+
+func TestTransactions_SequencesAllocateDistinctValuesInBlocks(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_INVOICE := schema.NewTable(DATABASE, "invoice-"+uuid.New().String(), []string{})
+
+	// two processes, which allocate blocks of the same sequence concurrently
+	sequences := []*min.Sequence{min.NewSequence(repo, T_INVOICE, 5), min.NewSequence(repo, T_INVOICE, 5)}
+	first, err := sequences[0].Next(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(1), first)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[int64]bool{first: true}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(sequence *min.Sequence) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				value, err := sequence.Next(ctx)
+				assert.NoError(err)
+				mu.Lock()
+				assert.False(seen[value], "allocated twice: %d", value)
+				seen[value] = true
+				mu.Unlock()
+			}
+		}(sequences[i%2])
+	}
+	wg.Wait()
+	assert.Len(seen, 41)
+
+	// the values of allocated blocks are never allocated again, even by a new process
+	value, err := min.NewSequence(repo, T_INVOICE, 1).Next(ctx)
+	assert.NoError(err)
+	assert.False(seen[value])
+
+	assert.PanicsWithValue(fmt.Sprintf("ADB-0171 invalid block size 0 of the sequence of table %s/%s", DATABASE, T_INVOICE.Name), func() {
+		min.NewSequence(repo, T_INVOICE, 0)
+	})
+}
+
+func TestTransactions_RecordsIndexedUnderTheLegacyNullFolderAreFoundByIsNull(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-legacy-nulls-"+uuid.New().String(), []string{"Name"})
+
+	account := &Account{Id: uuid.New().String()}
+	other := &Account{Id: uuid.New().String(), Name: "John"}
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account)
+	assert.NoError(err)
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, other)
+	assert.NoError(err)
+	assert.Empty(repo.Commit(ctx, &tx))
+
+	// move the entry to where empty values were indexed before they were indexed as null
+	index := T_ACCOUNT.Indices[0]
+	legacyPath := index.LegacyNullPathNoId() + "/" + schema.DefaultPathLayout{}.IndexEntryName(&index, account.Id)
+	_, err = repo.Client.CopyObject(ctx, m.CopyDestOptions{Bucket: repo.BucketName, Object: legacyPath}, m.CopySrcOptions{Bucket: repo.BucketName, Object: index.NullPath(account.Id)})
+	assert.NoError(err)
+	assert.NoError(repo.Client.RemoveObject(ctx, repo.BucketName, index.NullPath(account.Id), m.RemoveObjectOptions{}))
+
+	tx = schema.NewReadOnlyTransaction(10 * time.Second)
+	var accounts []*Account
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldIsNull("Name").Find(&accounts)
+	assert.NoError(err)
+	assert.Equal([]*Account{account}, accounts)
+	accounts = nil
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldEquals("Name", "").Find(&accounts)
+	assert.NoError(err)
+	assert.Equal([]*Account{account}, accounts)
+	accounts = nil
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).SelectFromTable(T_ACCOUNT).WhereIndexedFieldIsNotNull("Name").Find(&accounts)
+	assert.NoError(err)
+	assert.Equal([]*Account{other}, accounts)
+}
+
+func TestTransactions_SingleWriterTable_LeaseIsCheckedAgainWhenCommitting(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+
+	tx, err := repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-leased-commit-"+tx.Id, []string{"Name"}).WithSingleWriterLease()
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx.Id, // helps with concurrent tests
+	}
+
+	_, err = repo.AcquireTableLease(context.Background(), T_ACCOUNT, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertIntoTable(context.Background(), &tx, T_ACCOUNT, account1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lease is lost while the transaction is in progress
+	err = repo.ReleaseTableLease(context.Background(), T_ACCOUNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := repo.CommitWithResult(context.Background(), &tx)
+	assert.True(result.RolledBack)
+	assert.True(len(result.Errors) > 0)
+	assert.True(errors.Is(result.Errors[0], min.LeaseNotHeldError))
+
+	// nothing was written
+	tx, err = repo.BeginTransaction(context.Background(), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read = &Account{}
+	_, err = min.NewTypedQuery[Account](repo, context.Background(), &tx).
+		SelectFromTable(T_ACCOUNT).
+		WhereIdEquals(account1.Id).
+		Find(read)
+	assert.True(errors.Is(err, min.NoSuchKeyError))
+	errs := repo.Rollback(context.Background(), &tx)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestTransactions_BeginTransaction_ZeroTimeoutUsesTheDefault(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+	defer schema.SetTimeouts(schema.DefaultTimeout(), schema.MaxTimeout())
+	assert.NoError(schema.SetTimeouts(5*time.Second, time.Minute))
+
+	tx, err := repo.BeginTransaction(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal((5 * time.Second).Microseconds(), tx.TimeoutMicroseconds-tx.StartMicroseconds)
+	assert.Empty(repo.Rollback(ctx, &tx))
+
+	readOnly, err := repo.BeginReadOnlyTransaction(0)
+	assert.NoError(err)
+	assert.Equal((5 * time.Second).Microseconds(), readOnly.TimeoutMicroseconds-readOnly.StartMicroseconds)
+
+	_, err = repo.BeginTransaction(ctx, 2*time.Minute)
+	assert.ErrorContains(err, "ADB-0024")
+}
+
+func TestTransactions_Insert_StepsOfARejectedInsertAreDiscarded(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-rejected-"+tx.Id, []string{"Name"})
+
+	// the entity is accepted, but the entry of its index is not, so the insert fails after its first step was added
+	unregister := schema.RegisterStepValidator(func(tx *schema.Transaction, step *schema.TransactionStep, data []byte) error {
+		if step.Type == schema.STEP_INSERT_ADD_INDEX && strings.HasPrefix(step.Path, T_ACCOUNT.Folder()) {
+			return errors.New("no entries")
+		}
+		return nil
+	})
+	defer unregister()
+
+	var account1 = &Account{
+		Id:   uuid.New().String(),
+		Name: "John Doe " + tx.Id, // helps with concurrent tests
+	}
+	_, err = repo.InsertIntoTable(ctx, &tx, T_ACCOUNT, account1)
+	assert.True(errors.Is(err, schema.StepRejectedError))
+	assert.Empty(tx.Steps)
+
+	result := repo.CommitWithResult(ctx, &tx)
+	assert.Empty(result.Errors)
+
+	// nothing was written
+	tx, err = repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read = &Account{}
+	_, err = min.NewTypedQuery[Account](repo, ctx, &tx).
+		SelectFromTable(T_ACCOUNT).
+		WhereIdEquals(account1.Id).
+		Find(read)
+	assert.True(errors.Is(err, min.NoSuchKeyError))
+	assert.Empty(repo.Rollback(ctx, &tx))
+}
+
+func TestTransactions_Rollback_WithoutVersionIdsRemovesOnlyTheVersionsOfTheTransaction(t *testing.T) {
+	defer setupAndTeardown()()
+	assert := assert.New(t)
+
+	repo := getRepo()
+	ctx := context.Background()
+
+	tx, err := repo.BeginTransaction(ctx, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DATABASE := schema.NewDatabase("transactions-tests")
+	T_ACCOUNT := schema.NewTable(DATABASE, "account-rollback-versions-"+tx.Id, []string{"Name"})
+	id := uuid.New().String()
+
+	// a version which was not written by any transaction, e.g. by a tool
+	legacy := []byte(`{"id":"` + id + `","name":"Legacy"}`)
+	_, err = repo.Client.PutObject(ctx, repo.BucketName, T_ACCOUNT.Path(id), bytes.NewReader(legacy), int64(len(legacy)), m.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty := ""
+	_, err = repo.UpdateTable(ctx, &tx, T_ACCOUNT, &Account{Id: id, Name: "Upserted"}, &empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as if the transaction could not be stored after the version was written, so that the rollback finds it by its metadata
+	for _, step := range tx.Steps {
+		step.FinalVersionId = nil
+	}
+	assert.Empty(repo.Rollback(ctx, &tx))
+
+	object, err := repo.Client.GetObject(ctx, repo.BucketName, T_ACCOUNT.Path(id), m.GetObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer object.Close()
+	b, err := io.ReadAll(object)
+	assert.NoError(err)
+	assert.Equal(legacy, b)
+}
+
 func TestTransactions_TODO(t *testing.T) {
 
 	assert.Fail(t, "TODO delete update delete again")
@@ -4086,3 +8179,9 @@ type Watch struct {
 	AccountId string `json:"accountId"`
 }
 
+// for TableFor, whose indices are declared by tags
+type TaggedAccount struct {
+	Id    string `json:"id"`
+	Email string `json:"email" abstrastore:"unique"`
+	Name  string `json:"name" abstrastore:"index,sparse"`
+}